@@ -0,0 +1,153 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/huimingz/mongo-tools/common/archive"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// openArchive opens the --archive file, or standard input if it is "-",
+// decompressing it if needed. Archives split into volumes by mongodump
+// are read as one stream.
+func (oo *OutputOptions) openArchive() (io.ReadCloser, error) {
+	var rc io.ReadCloser = ReadNopCloser{os.Stdin}
+	if oo.Archive != "-" {
+		path := util.ToUniversalPath(oo.Archive)
+		var err error
+		if _, statErr := os.Stat(path); os.IsNotExist(statErr) && archive.HasVolumes(path) {
+			rc, err = archive.NewVolumeReader(path)
+		} else {
+			rc, err = os.Open(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't open archive: %v", err)
+		}
+	}
+	return archive.NewDecompressingReader(rc)
+}
+
+// archiveSource reads the documents of one collection from a mongodump
+// archive. The archive is parsed on its own goroutine, which stops at the
+// end of the collection's data.
+type archiveSource struct {
+	in   io.ReadCloser
+	docs chan []byte
+	done chan struct{}
+	stop sync.Once
+	err  error
+}
+
+// newArchiveSource checks that the archive has the namespace and starts
+// reading its documents.
+func newArchiveSource(in io.ReadCloser, namespace string) (*archiveSource, error) {
+	dbName, collName := util.SplitNamespace(namespace)
+	prelude := &archive.Prelude{}
+	if err := prelude.Read(in); err != nil {
+		return nil, err
+	}
+	found := false
+	var namespaces []string
+	for _, cm := range prelude.NamespaceMetadatas {
+		namespaces = append(namespaces, cm.Database+"."+cm.Collection)
+		found = found || (cm.Database == dbName && cm.Collection == collName)
+	}
+	if !found {
+		return nil, fmt.Errorf("namespace '%v' is not in the archive, which has: %v",
+			namespace, strings.Join(namespaces, ", "))
+	}
+
+	as := &archiveSource{
+		in:   in,
+		docs: make(chan []byte, workerBufferSize),
+		done: make(chan struct{}),
+	}
+	consumer := &namespaceConsumer{source: as, db: dbName, collection: collName}
+	go func() {
+		parser := archive.Parser{In: in}
+		var err error
+		for err == nil && !consumer.finished {
+			err = parser.ReadBlock(consumer)
+		}
+		if err != nil && err != io.EOF && !as.stopped() {
+			as.err = fmt.Errorf("error reading archive: %v", err)
+		}
+		close(as.docs)
+	}()
+	return as, nil
+}
+
+func (as *archiveSource) stopped() bool {
+	select {
+	case <-as.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// LoadNext returns the next document of the collection, or nil once they
+// have all been read.
+func (as *archiveSource) LoadNext() []byte {
+	return <-as.docs
+}
+
+func (as *archiveSource) Err() error {
+	return as.err
+}
+
+func (as *archiveSource) Close() error {
+	as.stop.Do(func() { close(as.done) })
+	return as.in.Close()
+}
+
+// namespaceConsumer is an archive.ParserConsumer that passes on the body
+// documents of the blocks of one namespace.
+type namespaceConsumer struct {
+	source     *archiveSource
+	db         string
+	collection string
+	current    bool
+	finished   bool
+}
+
+func (nc *namespaceConsumer) HeaderBSON(data []byte) error {
+	var header archive.NamespaceHeader
+	if err := bson.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	nc.current = header.Database == nc.db && header.Collection == nc.collection
+	if nc.current && header.EOF {
+		nc.current = false
+		nc.finished = true
+	}
+	return nil
+}
+
+func (nc *namespaceConsumer) BodyBSON(data []byte) error {
+	if !nc.current {
+		return nil
+	}
+	// the parser reuses its buffer for the next document
+	select {
+	case nc.source.docs <- append([]byte(nil), data...):
+		return nil
+	case <-nc.source.done:
+		return fmt.Errorf("archive closed")
+	}
+}
+
+func (nc *namespaceConsumer) End() error {
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/archive"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestArchiveSource(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	var buf bytes.Buffer
+	write := func(v interface{}) {
+		raw, err := bson.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(raw)
+	}
+	terminate := func() { buf.Write([]byte{0xff, 0xff, 0xff, 0xff}) }
+	block := func(db, coll string, ids ...int) {
+		write(archive.NamespaceHeader{Database: db, Collection: coll})
+		for _, id := range ids {
+			write(bson.D{{Key: "_id", Value: id}})
+		}
+		terminate()
+	}
+
+	magic := make([]byte, 4)
+	binary.LittleEndian.PutUint32(magic, archive.MagicNumber)
+	buf.Write(magic)
+	write(archive.Header{FormatVersion: "0.1"})
+	write(archive.CollectionMetadata{Database: "app", Collection: "users"})
+	write(archive.CollectionMetadata{Database: "app", Collection: "orders"})
+	terminate()
+	// the blocks of the two collections are interleaved
+	block("app", "users", 1, 2)
+	block("app", "orders", 100)
+	block("app", "users", 3)
+	write(archive.NamespaceHeader{Database: "app", Collection: "users", EOF: true})
+	terminate()
+	block("app", "orders", 101)
+	write(archive.NamespaceHeader{Database: "app", Collection: "orders", EOF: true})
+	terminate()
+
+	read := func(namespace string) ([]int32, error) {
+		source, err := newArchiveSource(ioutil.NopCloser(bytes.NewReader(buf.Bytes())), namespace)
+		if err != nil {
+			return nil, err
+		}
+		defer source.Close()
+		var ids []int32
+		for doc := source.LoadNext(); doc != nil; doc = source.LoadNext() {
+			ids = append(ids, bson.Raw(doc).Lookup("_id").Int32())
+		}
+		return ids, source.Err()
+	}
+
+	Convey("Only the documents of the namespace are read from an archive", t, func() {
+		ids, err := read("app.users")
+		So(err, ShouldBeNil)
+		So(ids, ShouldResemble, []int32{1, 2, 3})
+
+		ids, err = read("app.orders")
+		So(err, ShouldBeNil)
+		So(ids, ShouldResemble, []int32{100, 101})
+	})
+
+	Convey("A namespace that isn't in the archive is an error", t, func() {
+		_, err := read("app.missing")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "app.users, app.orders")
+	})
+
+	Convey("--namespace goes with --archive", t, func() {
+		_, err := ParseOptions([]string{"--archive", "dump.archive"}, "", "")
+		So(err, ShouldNotBeNil)
+		_, err = ParseOptions([]string{"--namespace", "app.users"}, "", "")
+		So(err, ShouldNotBeNil)
+		_, err = ParseOptions([]string{"--archive", "dump.archive", "--namespace", "app.users", "file.bson"}, "", "")
+		So(err, ShouldNotBeNil)
+		_, err = ParseOptions([]string{"--archive", "dump.archive", "--namespace", "app.users"}, "", "")
+		So(err, ShouldBeNil)
+	})
+}
@@ -18,6 +18,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/bsontype"
 
+	"github.com/huimingz/mongo-tools/common/bsonutil"
 	"github.com/huimingz/mongo-tools/common/db"
 	"github.com/huimingz/mongo-tools/common/failpoint"
 	"github.com/huimingz/mongo-tools/common/json"
@@ -38,7 +39,14 @@ type BSONDump struct {
 	// File handle for the output data.
 	OutputWriter io.WriteCloser
 
-	InputSource *db.BSONSource
+	InputSource db.RawDocSource
+
+	// jsonInput is the Extended JSON read by --reverse
+	jsonInput io.ReadCloser
+
+	// match and fields select the documents and fields displayed
+	match  bsonutil.DocPredicate
+	fields *fieldTree
 }
 
 type ReadNopCloser struct {
@@ -80,6 +88,20 @@ func (oo *OutputOptions) GetBSONReader() (io.ReadCloser, error) {
 	return ReadNopCloser{os.Stdin}, nil
 }
 
+// openBSONSource opens the BSON file to dump.
+func (bd *BSONDump) openBSONSource() error {
+	reader, err := bd.OutputOptions.GetBSONReader()
+	if err != nil {
+		return fmt.Errorf("getting BSON reader failed: %v", err)
+	}
+	if bd.OutputOptions.Recover {
+		bd.InputSource = newRecoveringSource(reader)
+	} else {
+		bd.InputSource = db.NewBSONSource(reader)
+	}
+	return nil
+}
+
 // New constructs a new instance of BSONDump configured by the provided options.
 // A successfully created instance must be closed with Close().
 func New(opts Options) (*BSONDump, error) {
@@ -87,16 +109,33 @@ func New(opts Options) (*BSONDump, error) {
 		ToolOptions:   opts.ToolOptions,
 		OutputOptions: opts.OutputOptions,
 	}
+	if err := dumper.initSelection(); err != nil {
+		return nil, err
+	}
 
-	reader, err := opts.GetBSONReader()
-	if err != nil {
-		return nil, fmt.Errorf("getting BSON reader failed: %v", err)
+	if opts.Archive != "" {
+		reader, err := opts.openArchive()
+		if err != nil {
+			return nil, err
+		}
+		dumper.InputSource, err = newArchiveSource(reader, opts.ArchiveNamespace)
+		if err != nil {
+			_ = reader.Close()
+			return nil, fmt.Errorf("error reading archive: %v", err)
+		}
+	} else if opts.Reverse {
+		reader, err := opts.GetBSONReader()
+		if err != nil {
+			return nil, fmt.Errorf("getting JSON reader failed: %v", err)
+		}
+		dumper.jsonInput = reader
+	} else if err := dumper.openBSONSource(); err != nil {
+		return nil, err
 	}
-	dumper.InputSource = db.NewBSONSource(reader)
 
 	writer, err := opts.GetWriter()
 	if err != nil {
-		_ = dumper.InputSource.Close()
+		_ = dumper.closeInput()
 		return nil, fmt.Errorf("getting Writer failed: %v", err)
 	}
 	dumper.OutputWriter = writer
@@ -107,12 +146,27 @@ func New(opts Options) (*BSONDump, error) {
 // Close cleans up the internal state of the given BSONDump instance. The instance should not be used again
 // after Close is called.
 func (bd *BSONDump) Close() error {
-	_ = bd.InputSource.Close()
+	_ = bd.closeInput()
 	return bd.OutputWriter.Close()
 }
 
-func formatJSON(doc *bson.Raw, pretty bool) ([]byte, error) {
-	extendedJSON, err := bson.MarshalExtJSON(doc, true, false)
+func (bd *BSONDump) closeInput() error {
+	if bd.jsonInput != nil {
+		return bd.jsonInput.Close()
+	}
+	return bd.InputSource.Close()
+}
+
+// formatJSON converts a document to Extended JSON in one of the --jsonFormat
+// formats.
+func formatJSON(doc *bson.Raw, format string, pretty bool) ([]byte, error) {
+	var extendedJSON []byte
+	var err error
+	if format == LegacyJSONFormat {
+		extendedJSON, err = formatLegacyJSON(*doc)
+	} else {
+		extendedJSON, err = bson.MarshalExtJSON(doc, format != RelaxedJSONFormat, false)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error converting BSON to extended JSON: %v", err)
 	}
@@ -127,11 +181,27 @@ func formatJSON(doc *bson.Raw, pretty bool) ([]byte, error) {
 	return extendedJSON, nil
 }
 
+// formatLegacyJSON converts a document to the legacy Extended JSON of tools
+// before 4.2, in which numbers that fit in a JSON number aren't wrapped.
+func formatLegacyJSON(doc bson.Raw) ([]byte, error) {
+	var decoded bson.D
+	if err := bson.Unmarshal(doc, &decoded); err != nil {
+		return nil, err
+	}
+	legacy, err := bsonutil.ConvertBSONValueToLegacyExtJSON(decoded)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(legacy)
+}
+
 // JSON iterates through the BSON file and for each document it finds,
 // recursively descends into objects and arrays and prints the human readable
-// JSON representation.
+// JSON representation. Documents are converted by --numDecodingWorkers
+// workers and printed in the order of the file.
 // It returns the number of documents processed and a non-nil error if one is
-// encountered before the end of the file is reached.
+// encountered before the end of the file is reached. Documents that don't
+// match --filter are skipped and not counted.
 func (bd *BSONDump) JSON() (int, error) {
 	numFound := 0
 
@@ -139,22 +209,27 @@ func (bd *BSONDump) JSON() (int, error) {
 		panic("Tried to call JSON() before opening file")
 	}
 
+	converter := bd.startConverter(bd.OutputOptions.NumDecodingWorkers)
+	defer converter.stop()
+
 	for {
-		result := bson.Raw(bd.InputSource.LoadNext())
-		if result == nil {
+		result, ok := converter.result()
+		if !ok {
 			break
 		}
+		if !result.matched {
+			continue
+		}
 
-		if bytes, err := formatJSON(&result, bd.OutputOptions.Pretty); err != nil {
-			log.Logvf(log.Always, "unable to dump document %v: %v", numFound+1, err)
+		if result.err != nil {
+			log.Logvf(log.Always, "unable to dump document %v: %v", numFound+1, result.err)
 
 			//if objcheck is turned on, stop now. otherwise keep on dumpin'
 			if bd.OutputOptions.ObjCheck {
-				return numFound, err
+				return numFound, result.err
 			}
 		} else {
-			bytes = append(bytes, '\n')
-			_, err := bd.OutputWriter.Write(bytes)
+			_, err := bd.OutputWriter.Write(result.out)
 			if err != nil {
 				return numFound, err
 			}
@@ -173,9 +248,11 @@ func (bd *BSONDump) JSON() (int, error) {
 
 // Debug iterates through the BSON file and for each document it finds,
 // recursively descends into objects and arrays and prints a human readable
-// BSON representation containing the type and size of each field.
+// BSON representation containing the type and size of each field. With
+// --stats, it prints a summary of the fields across the file instead.
 // It returns the number of documents processed and a non-nil error if one is
-// encountered before the end of the file is reached.
+// encountered before the end of the file is reached. Documents that don't
+// match --filter are skipped and not counted.
 func (bd *BSONDump) Debug() (int, error) {
 	numFound := 0
 
@@ -183,6 +260,12 @@ func (bd *BSONDump) Debug() (int, error) {
 		panic("Tried to call Debug() before opening file")
 	}
 
+	var stats *schemaStats
+	if bd.OutputOptions.Stats {
+		stats = newSchemaStats()
+		defer stats.write(bd.OutputWriter)
+	}
+
 	for {
 		result := bson.Raw(bd.InputSource.LoadNext())
 		if result == nil {
@@ -197,7 +280,15 @@ func (bd *BSONDump) Debug() (int, error) {
 				return numFound, fmt.Errorf("failed to validate bson during objcheck: %v", err)
 			}
 		}
-		err := printBSON(result, 0, bd.OutputWriter)
+		result, matched, err := bd.selectDoc(result)
+		if !matched {
+			continue
+		}
+		if err == nil && stats != nil {
+			err = stats.add(result)
+		} else if err == nil {
+			err = printBSON(result, 0, bd.OutputWriter)
+		}
 		if err != nil {
 			log.Logvf(log.Always, "encountered error debugging BSON data: %v", err)
 		}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/huimingz/mongo-tools/common/testtype"
 	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func TestBsondump(t *testing.T) {
@@ -177,3 +178,32 @@ func TestBsondump(t *testing.T) {
 		})
 	})
 }
+
+func TestJSONFormats(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	doc, err := bson.Marshal(bson.D{{Key: "n", Value: int64(5)}, {Key: "i", Value: 3}, {Key: "f", Value: 1.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := bson.Raw(doc)
+
+	Convey("Documents are converted to each --jsonFormat", t, func() {
+		for format, want := range map[string]string{
+			CanonicalJSONFormat: `{"n":{"$numberLong":"5"},"i":{"$numberInt":"3"},"f":{"$numberDouble":"1.5"}}`,
+			RelaxedJSONFormat:   `{"n":5,"i":3,"f":1.5}`,
+			LegacyJSONFormat:    `{"n":{"$numberLong":"5"},"i":3,"f":1.5}`,
+		} {
+			out, err := formatJSON(&raw, format, false)
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, want)
+		}
+	})
+
+	Convey("Unknown formats are rejected", t, func() {
+		_, err := ParseOptions([]string{"--jsonFormat", "strict"}, "", "")
+		So(err, ShouldNotBeNil)
+		_, err = ParseOptions([]string{"--jsonFormat", "legacy"}, "", "")
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/bsonutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// fieldTree holds the dotted paths of --fields by their first key. A node
+// with all set keeps the whole value at its path.
+type fieldTree struct {
+	all bool
+	sub map[string]*fieldTree
+}
+
+// parseFields parses the --fields list. As in a query projection, _id is
+// always displayed.
+func parseFields(fields string) (*fieldTree, error) {
+	tree := &fieldTree{sub: map[string]*fieldTree{}}
+	tree.add([]string{"_id"})
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		path := strings.Split(field, ".")
+		for _, key := range path {
+			if key == "" {
+				return nil, fmt.Errorf("invalid field name '%v'", field)
+			}
+		}
+		tree.add(path)
+	}
+	return tree, nil
+}
+
+func (tree *fieldTree) add(path []string) {
+	node := tree
+	for _, key := range path {
+		if node.all {
+			return
+		}
+		child, ok := node.sub[key]
+		if !ok {
+			child = &fieldTree{sub: map[string]*fieldTree{}}
+			node.sub[key] = child
+		}
+		node = child
+	}
+	node.all = true
+	node.sub = nil
+}
+
+// project returns the fields of a document that are in the tree, in the
+// order of the document. Paths through an array select from each of the
+// documents in it.
+func (tree *fieldTree) project(doc bson.Raw) (bson.D, error) {
+	elements, err := doc.Elements()
+	if err != nil {
+		return nil, err
+	}
+	projected := bson.D{}
+	for _, elem := range elements {
+		node, ok := tree.sub[elem.Key()]
+		if !ok {
+			continue
+		}
+		value := elem.Value()
+		if node.all {
+			projected = append(projected, bson.E{Key: elem.Key(), Value: value})
+			continue
+		}
+		switch value.Type {
+		case bsontype.EmbeddedDocument:
+			sub, err := node.project(value.Document())
+			if err != nil {
+				return nil, err
+			}
+			projected = append(projected, bson.E{Key: elem.Key(), Value: sub})
+		case bsontype.Array:
+			values, err := value.Array().Values()
+			if err != nil {
+				return nil, err
+			}
+			array := bson.A{}
+			for _, v := range values {
+				if v.Type != bsontype.EmbeddedDocument {
+					continue
+				}
+				sub, err := node.project(v.Document())
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, sub)
+			}
+			projected = append(projected, bson.E{Key: elem.Key(), Value: array})
+		}
+	}
+	return projected, nil
+}
+
+// initSelection sets up the --filter query and --fields projection.
+func (bd *BSONDump) initSelection() error {
+	if bd.OutputOptions.Filter != "" {
+		match, err := bsonutil.ParseDocFilter(bd.OutputOptions.Filter)
+		if err != nil {
+			return fmt.Errorf("invalid --filter: %v", err)
+		}
+		bd.match = match
+	}
+	if bd.OutputOptions.Fields != "" {
+		fields, err := parseFields(bd.OutputOptions.Fields)
+		if err != nil {
+			return fmt.Errorf("invalid --fields: %v", err)
+		}
+		bd.fields = fields
+	}
+	return nil
+}
+
+// selectDoc applies --filter and --fields to a document. It returns false
+// if the document doesn't match the filter.
+func (bd *BSONDump) selectDoc(doc bson.Raw) (bson.Raw, bool, error) {
+	if bd.match != nil && !bd.match(doc) {
+		return nil, false, nil
+	}
+	if bd.fields == nil {
+		return doc, true, nil
+	}
+	projected, err := bd.fields.project(doc)
+	if err != nil {
+		return nil, true, fmt.Errorf("error selecting fields: %v", err)
+	}
+	selected, err := bson.Marshal(projected)
+	if err != nil {
+		return nil, true, fmt.Errorf("error selecting fields: %v", err)
+	}
+	return selected, true, nil
+}
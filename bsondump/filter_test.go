@@ -0,0 +1,81 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFilterAndFields(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	var input bytes.Buffer
+	for _, doc := range []bson.D{
+		{{Key: "_id", Value: 1}, {Key: "status", Value: "ok"}, {Key: "address", Value: bson.D{{Key: "city", Value: "Dublin"}, {Key: "zip", Value: "D01"}}}},
+		{{Key: "_id", Value: 2}, {Key: "status", Value: "failed"}, {Key: "items", Value: bson.A{bson.D{{Key: "sku", Value: "x"}, {Key: "qty", Value: 2}}, "loose"}}},
+		{{Key: "_id", Value: 3}, {Key: "status", Value: "failed"}, {Key: "address", Value: "unknown"}},
+	} {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input.Write(raw)
+	}
+
+	dump := func(outputOpts OutputOptions) (int, string, error) {
+		var out bytes.Buffer
+		bd := &BSONDump{
+			OutputOptions: &outputOpts,
+			OutputWriter:  WriteNopCloser{&out},
+			InputSource:   db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(input.Bytes()))),
+		}
+		if err := bd.initSelection(); err != nil {
+			return 0, "", err
+		}
+		n, err := bd.JSON()
+		return n, out.String(), err
+	}
+
+	Convey("--filter only displays matching documents", t, func() {
+		n, out, err := dump(OutputOptions{Filter: `{"status": "failed", "_id": {"$gt": 2}}`})
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1)
+		So(out, ShouldEqual, `{"_id":{"$numberInt":"3"},"status":"failed","address":"unknown"}`+"\n")
+	})
+
+	Convey("--fields displays the listed fields and _id", t, func() {
+		n, out, err := dump(OutputOptions{Fields: "address.city, items.qty"})
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 3)
+		So(strings.Split(strings.TrimSpace(out), "\n"), ShouldResemble, []string{
+			`{"_id":{"$numberInt":"1"},"address":{"city":"Dublin"}}`,
+			`{"_id":{"$numberInt":"2"},"items":[{"qty":{"$numberInt":"2"}}]}`,
+			`{"_id":{"$numberInt":"3"}}`,
+		})
+	})
+
+	Convey("A field and a path under it display the whole field", t, func() {
+		_, out, err := dump(OutputOptions{Filter: `{"_id": 1}`, Fields: "address.zip,address"})
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, `{"_id":{"$numberInt":"1"},"address":{"city":"Dublin","zip":"D01"}}`+"\n")
+	})
+
+	Convey("Invalid filters and fields are rejected", t, func() {
+		_, _, err := dump(OutputOptions{Filter: `{"$where": "true"}`})
+		So(err, ShouldNotBeNil)
+		_, _, err = dump(OutputOptions{Fields: "a..b"})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -58,13 +58,21 @@ func main() {
 	log.Logvf(log.DebugLow, "running bsondump with --objcheck: %v", opts.ObjCheck)
 
 	var numFound int
-	if opts.Type == bsondump.DebugOutputType {
+	if opts.Reverse {
+		numFound, err = dumper.Reverse()
+	} else if opts.Validate != "" {
+		numFound, err = dumper.Validate()
+	} else if opts.Type == bsondump.DebugOutputType {
 		numFound, err = dumper.Debug()
 	} else {
 		numFound, err = dumper.JSON()
 	}
 
 	log.Logvf(log.Always, "%v objects found", numFound)
+	if ranges, skipped := dumper.Skipped(); ranges > 0 {
+		log.Logvf(log.Always, "skipped %v corrupt bytes in %v %v", skipped, ranges,
+			util.Pluralize(ranges, "range", "ranges"))
+	}
 	if err != nil {
 		log.Logv(log.Always, err.Error())
 		os.Exit(util.ExitFailure)
@@ -8,6 +8,7 @@ package bsondump
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/huimingz/mongo-tools/common/log"
 	"github.com/huimingz/mongo-tools/common/options"
@@ -31,6 +32,13 @@ const (
 	JSONOutputType  = "json"
 )
 
+// Extended JSON formats supported by the --jsonFormat option
+const (
+	CanonicalJSONFormat = "canonical"
+	RelaxedJSONFormat   = "relaxed"
+	LegacyJSONFormat    = "legacy"
+)
+
 type OutputOptions struct {
 	// Format to display the BSON data file
 	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"type of output: debug, json"`
@@ -38,14 +46,44 @@ type OutputOptions struct {
 	// Validate each BSON document before displaying
 	ObjCheck bool `long:"objcheck" description:"validate BSON during processing"`
 
+	// Extended JSON format of the output
+	JSONFormat string `long:"jsonFormat" value-name:"<format>" default:"canonical" description:"the extended JSON format to output: canonical, relaxed, or legacy, as written by tools before 4.2 (defaults to 'canonical')"`
+
 	// Display JSON data with indents
 	Pretty bool `long:"pretty" description:"output JSON formatted to be human-readable"`
 
 	// Path to input BSON file
-	BSONFileName string `long:"bsonFile" description:"path to BSON file to dump to JSON; default is stdin"`
+	BSONFileName string `long:"bsonFile" description:"path to BSON file to dump to JSON, or with --reverse the JSON file to convert to BSON; default is stdin"`
+
+	// Path to a mongodump archive to read a collection from
+	Archive string `long:"archive" value-name:"<file>" description:"read the documents of --namespace from a mongodump archive, or from standard input if '-', instead of a BSON file"`
+
+	// Collection to read from --archive
+	ArchiveNamespace string `long:"namespace" value-name:"<db.collection>" description:"namespace of the collection to dump from --archive"`
+
+	// Check each document instead of displaying it
+	Validate string `long:"validate" value-name:"strict" choice:"strict" description:"check every document for invalid BSON or UTF-8, duplicate field names, excessive nesting and field names that can't be stored, and report the file offsets of the problems found"`
+
+	// Convert Extended JSON to BSON instead
+	Reverse bool `long:"reverse" description:"read Extended JSON, in canonical or relaxed form, from the input file or stdin and write it as BSON"`
 
 	// Path to output file
 	OutFileName string `long:"outFile" description:"path to output file to dump BSON to; default is stdout"`
+
+	// Query that documents must match to be displayed
+	Filter string `long:"filter" value-name:"<json>" description:"only display documents that match a query, as Extended JSON, e.g. '{\"status\": \"failed\"}'"`
+
+	// Summarize the fields of the file instead of displaying each document
+	Stats bool `long:"stats" description:"with --type=debug, print a summary of the fields, types and sizes seen across the file instead of each document"`
+
+	// Number of workers converting documents to JSON
+	NumDecodingWorkers int `long:"numDecodingWorkers" value-name:"<number>" default:"0" default-mask:"-" description:"number of workers that convert documents to JSON (defaults to the number of CPUs)"`
+
+	// Skip over corrupt data instead of stopping at it
+	Recover bool `long:"recover" description:"skip over invalid or truncated documents to the next valid one, reporting the byte ranges skipped"`
+
+	// Fields to display from each document
+	Fields string `long:"fields" value-name:"<field>[,<field>]*" short:"f" description:"comma separated list of field names, e.g. -f name,address.city; only these fields and _id are displayed"`
 }
 
 func (*OutputOptions) Name() string {
@@ -78,6 +116,58 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 		outputOpts.BSONFileName = args[0]
 	}
 
+	switch outputOpts.JSONFormat {
+	case CanonicalJSONFormat, RelaxedJSONFormat, LegacyJSONFormat:
+	default:
+		return Options{}, fmt.Errorf("invalid JSON format '%v', choose '%v', '%v' or '%v'",
+			outputOpts.JSONFormat, CanonicalJSONFormat, RelaxedJSONFormat, LegacyJSONFormat)
+	}
+
+	if outputOpts.Reverse {
+		switch {
+		case outputOpts.Type == DebugOutputType:
+			return Options{}, fmt.Errorf("cannot use --type=%v with --reverse", DebugOutputType)
+		case outputOpts.Archive != "":
+			return Options{}, fmt.Errorf("cannot use --archive with --reverse")
+		case outputOpts.Recover:
+			return Options{}, fmt.Errorf("cannot use --recover with --reverse")
+		}
+	}
+
+	if outputOpts.Validate != "" {
+		switch {
+		case outputOpts.Reverse:
+			return Options{}, fmt.Errorf("cannot use --validate with --reverse")
+		case outputOpts.Archive != "":
+			return Options{}, fmt.Errorf("cannot use --validate with --archive")
+		case outputOpts.Stats:
+			return Options{}, fmt.Errorf("cannot use --validate with --stats")
+		}
+	}
+
+	if outputOpts.Archive != "" {
+		switch {
+		case outputOpts.BSONFileName != "":
+			return Options{}, fmt.Errorf("cannot dump a BSON file and an --archive")
+		case outputOpts.ArchiveNamespace == "":
+			return Options{}, fmt.Errorf("--archive requires --namespace")
+		case !strings.Contains(outputOpts.ArchiveNamespace, "."):
+			return Options{}, fmt.Errorf("--namespace must be of the form <db.collection>")
+		case outputOpts.Recover:
+			return Options{}, fmt.Errorf("cannot use --recover with --archive")
+		}
+	} else if outputOpts.ArchiveNamespace != "" {
+		return Options{}, fmt.Errorf("--namespace can only be used with --archive")
+	}
+
+	if outputOpts.NumDecodingWorkers <= 0 {
+		outputOpts.NumDecodingWorkers = toolOpts.MaxProcs
+	}
+
+	if outputOpts.Stats && outputOpts.Type != DebugOutputType {
+		return Options{}, fmt.Errorf("--stats can only be used with --type=%v", DebugOutputType)
+	}
+
 	switch outputOpts.Type {
 	case "", DebugOutputType, JSONOutputType:
 		return Options{toolOpts, outputOpts}, nil
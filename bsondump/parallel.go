@@ -0,0 +1,114 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// workerBufferSize is the number of documents queued for or by each worker.
+const workerBufferSize = 64
+
+// jsonResult is a document converted to JSON by a worker.
+type jsonResult struct {
+	out     []byte
+	matched bool
+	err     error
+}
+
+// convertJSON applies --filter and --fields to a document and converts it
+// to a line of JSON.
+func (bd *BSONDump) convertJSON(doc bson.Raw) jsonResult {
+	doc, matched, err := bd.selectDoc(doc)
+	if !matched || err != nil {
+		return jsonResult{matched: matched, err: err}
+	}
+	out, err := formatJSON(&doc, bd.OutputOptions.JSONFormat, bd.OutputOptions.Pretty)
+	if err != nil {
+		return jsonResult{matched: true, err: err}
+	}
+	return jsonResult{out: append(out, '\n'), matched: true}
+}
+
+// sequencedConverter converts the documents of the input source on several
+// workers. Documents are handed to the workers in turn, and results are
+// read back from them in the same turn, so they come out in input order.
+type sequencedConverter struct {
+	outs []chan jsonResult
+	next int
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (bd *BSONDump) startConverter(numWorkers int) *sequencedConverter {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	sc := &sequencedConverter{done: make(chan struct{})}
+	ins := make([]chan bson.Raw, numWorkers)
+	for i := range ins {
+		ins[i] = make(chan bson.Raw, workerBufferSize)
+		out := make(chan jsonResult, workerBufferSize)
+		sc.outs = append(sc.outs, out)
+		sc.wg.Add(1)
+		go func(in chan bson.Raw) {
+			defer sc.wg.Done()
+			defer close(out)
+			for doc := range in {
+				select {
+				case out <- bd.convertJSON(doc):
+				case <-sc.done:
+					return
+				}
+			}
+		}(ins[i])
+	}
+
+	sc.wg.Add(1)
+	go func() {
+		defer sc.wg.Done()
+		defer func() {
+			for _, in := range ins {
+				close(in)
+			}
+		}()
+		for i := 0; ; i++ {
+			doc := bd.InputSource.LoadNext()
+			if doc == nil {
+				return
+			}
+			// the source reuses its buffer for the next document
+			select {
+			case ins[i%len(ins)] <- append(bson.Raw(nil), doc...):
+			case <-sc.done:
+				return
+			}
+		}
+	}()
+	return sc
+}
+
+// result returns the next result in input order, or false once every
+// document has been converted.
+func (sc *sequencedConverter) result() (jsonResult, bool) {
+	result, ok := <-sc.outs[sc.next]
+	sc.next = (sc.next + 1) % len(sc.outs)
+	return result, ok
+}
+
+// stop stops the workers and waits for them to exit. The results still
+// queued are drained, so that no worker stays blocked sending one.
+func (sc *sequencedConverter) stop() {
+	close(sc.done)
+	for _, out := range sc.outs {
+		for range out {
+		}
+	}
+	sc.wg.Wait()
+}
@@ -0,0 +1,93 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParallelJSON(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	var input, expected bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		raw, err := bson.Marshal(bson.D{{Key: "_id", Value: i}, {Key: "even", Value: i%2 == 0}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		input.Write(raw)
+		if i%2 == 0 {
+			fmt.Fprintf(&expected, `{"_id":{"$numberInt":"%v"},"even":true}`+"\n", i)
+		}
+	}
+	// a document with an invalid element type
+	corrupt := []byte{8, 0, 0, 0, 0x7a, 'a', 0, 0}
+
+	dump := func(data []byte, outputOpts OutputOptions) (int, string, error) {
+		var out bytes.Buffer
+		bd := &BSONDump{
+			OutputOptions: &outputOpts,
+			OutputWriter:  WriteNopCloser{&out},
+			InputSource:   db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(data))),
+		}
+		So(bd.initSelection(), ShouldBeNil)
+		n, err := bd.JSON()
+		return n, out.String(), err
+	}
+
+	Convey("Documents converted by several workers are printed in order", t, func() {
+		for _, workers := range []int{1, 4, 7} {
+			n, out, err := dump(input.Bytes(), OutputOptions{NumDecodingWorkers: workers, Filter: `{"even": true}`})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 500)
+			So(out, ShouldEqual, expected.String())
+		}
+	})
+
+	Convey("--objcheck stops the workers at the first bad document", t, func() {
+		data := append(append([]byte{}, corrupt...), input.Bytes()...)
+		n, out, err := dump(data, OutputOptions{NumDecodingWorkers: 4, ObjCheck: true})
+		So(err, ShouldNotBeNil)
+		So(n, ShouldEqual, 0)
+		So(out, ShouldEqual, "")
+
+		n, _, err = dump(data, OutputOptions{NumDecodingWorkers: 4})
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 1001)
+	})
+
+	Convey("Stopping the workers before every result is read doesn't block", t, func() {
+		bd := &BSONDump{
+			OutputOptions: &OutputOptions{},
+			InputSource:   db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(input.Bytes()))),
+		}
+		So(bd.initSelection(), ShouldBeNil)
+		converter := bd.startConverter(4)
+		_, ok := converter.result()
+		So(ok, ShouldBeTrue)
+
+		stopped := make(chan struct{})
+		go func() {
+			converter.stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("stop blocked with results left unread")
+		}
+	})
+}
@@ -0,0 +1,149 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// minResyncSize is the size of the smallest document that ends a corrupt
+// span: one with a single element. An empty document is only five bytes,
+// four of them zero, so corrupt or zeroed bytes hold many of them.
+const minResyncSize = 7
+
+// byteRange is a range of offsets in the input, end exclusive.
+type byteRange struct {
+	start, end int64
+}
+
+// recoveringSource reads the documents of a BSON stream for --recover.
+// Where the stream doesn't hold a valid document, it scans forward a byte at
+// a time for the next plausible document and records the bytes it skipped.
+type recoveringSource struct {
+	stream  io.ReadCloser
+	reader  *bufio.Reader
+	buf     []byte
+	offset  int64
+	skipped []byteRange
+	err     error
+}
+
+func newRecoveringSource(in io.ReadCloser) *recoveringSource {
+	return &recoveringSource{
+		stream: in,
+		// a candidate document has to fit in the buffer to be validated
+		reader: bufio.NewReaderSize(in, db.MaxBSONSize),
+	}
+}
+
+// LoadNext returns the next valid document in the stream, or nil at the end
+// of the stream or on a read error. The returned slice is reused by the
+// next call.
+func (rs *recoveringSource) LoadNext() []byte {
+	skipStart := int64(-1)
+	endSkip := func() {
+		if skipStart >= 0 {
+			rs.skip(skipStart, rs.offset)
+		}
+	}
+
+	for {
+		head, err := rs.reader.Peek(4)
+		if err != nil && err != io.EOF {
+			rs.err = err
+			endSkip()
+			return nil
+		}
+		if len(head) < 4 {
+			// a truncated document at the end of the stream
+			if len(head) > 0 && skipStart < 0 {
+				skipStart = rs.offset
+			}
+			n, _ := rs.reader.Discard(len(head))
+			rs.offset += int64(n)
+			endSkip()
+			rs.err = nil
+			return nil
+		}
+
+		minSize := 5
+		if skipStart >= 0 {
+			minSize = minResyncSize
+		}
+		if doc := rs.candidate(int(int32(binary.LittleEndian.Uint32(head))), minSize); doc != nil {
+			endSkip()
+			rs.buf = append(rs.buf[:0], doc...)
+			n, _ := rs.reader.Discard(len(doc))
+			rs.offset += int64(n)
+			rs.err = nil
+			return rs.buf
+		}
+		if rs.err != nil {
+			endSkip()
+			return nil
+		}
+
+		if skipStart < 0 {
+			skipStart = rs.offset
+		}
+		n, _ := rs.reader.Discard(1)
+		rs.offset += int64(n)
+	}
+}
+
+// candidate returns the document of the given size at the current offset if
+// it is a valid BSON document of at least minSize bytes.
+func (rs *recoveringSource) candidate(size, minSize int) []byte {
+	if size < minSize || size > db.MaxBSONSize {
+		return nil
+	}
+	doc, err := rs.reader.Peek(size)
+	if err != nil && err != io.EOF {
+		rs.err = err
+		return nil
+	}
+	if len(doc) < size || doc[size-1] != 0 {
+		return nil
+	}
+	if bson.Raw(doc).Validate() != nil {
+		return nil
+	}
+	return doc
+}
+
+func (rs *recoveringSource) skip(start, end int64) {
+	rs.skipped = append(rs.skipped, byteRange{start, end})
+	log.Logvf(log.Always, "skipped %v corrupt bytes at offset %v-%v", end-start, start, end)
+}
+
+func (rs *recoveringSource) Err() error {
+	return rs.err
+}
+
+func (rs *recoveringSource) Close() error {
+	return rs.stream.Close()
+}
+
+// Skipped returns the number of byte ranges that --recover skipped over and
+// their total size.
+func (bd *BSONDump) Skipped() (int, int64) {
+	rs, ok := bd.InputSource.(*recoveringSource)
+	if !ok {
+		return 0, 0
+	}
+	var total int64
+	for _, r := range rs.skipped {
+		total += r.end - r.start
+	}
+	return len(rs.skipped), total
+}
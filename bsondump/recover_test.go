@@ -0,0 +1,95 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRecover(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	marshal := func(id int) []byte {
+		raw, err := bson.Marshal(bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "doc"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	Convey("With a dump that has garbage, a bad length and a truncated document", t, func() {
+		doc1, doc2, doc3, doc4 := marshal(1), marshal(2), marshal(3), marshal(4)
+		badLength := append([]byte{}, doc3...)
+		badLength[0] = 0xff
+
+		var input bytes.Buffer
+		input.Write(doc1)
+		input.Write([]byte("garbage"))
+		input.Write(doc2)
+		input.Write(badLength)
+		input.Write(doc4)
+		input.Write(doc1[:10])
+
+		source := newRecoveringSource(ioutil.NopCloser(&input))
+		var found [][]byte
+		for doc := source.LoadNext(); doc != nil; doc = source.LoadNext() {
+			found = append(found, append([]byte{}, doc...))
+		}
+
+		Convey("the valid documents are read and the bytes in between are skipped", func() {
+			So(source.Err(), ShouldBeNil)
+			So(found, ShouldResemble, [][]byte{doc1, doc2, doc4})
+
+			start := int64(len(doc1))
+			afterDoc2 := start + 7 + int64(len(doc2))
+			afterDoc4 := afterDoc2 + int64(len(badLength)+len(doc4))
+			So(source.skipped, ShouldResemble, []byteRange{
+				{start, start + 7},
+				{afterDoc2, afterDoc2 + int64(len(badLength))},
+				{afterDoc4, afterDoc4 + 10},
+			})
+
+			bd := &BSONDump{InputSource: source}
+			ranges, total := bd.Skipped()
+			So(ranges, ShouldEqual, 3)
+			So(total, ShouldEqual, 7+len(badLength)+10)
+		})
+	})
+
+	Convey("With empty documents", t, func() {
+		doc1, doc2 := marshal(1), marshal(2)
+		empty := []byte{5, 0, 0, 0, 0}
+		read := func(input []byte) ([][]byte, *recoveringSource) {
+			source := newRecoveringSource(ioutil.NopCloser(bytes.NewReader(input)))
+			var found [][]byte
+			for doc := source.LoadNext(); doc != nil; doc = source.LoadNext() {
+				found = append(found, append([]byte{}, doc...))
+			}
+			return found, source
+		}
+
+		Convey("one between valid documents is read", func() {
+			found, source := read(bytes.Join([][]byte{doc1, empty, doc2}, nil))
+			So(found, ShouldResemble, [][]byte{doc1, empty, doc2})
+			So(source.skipped, ShouldBeEmpty)
+		})
+
+		Convey("ones inside corrupt bytes are skipped with them", func() {
+			corrupt := bytes.Join([][]byte{[]byte("xx"), empty, make([]byte, 20), empty, []byte("yy")}, nil)
+			found, source := read(bytes.Join([][]byte{doc1, corrupt, doc2}, nil))
+			So(found, ShouldResemble, [][]byte{doc1, doc2})
+			start := int64(len(doc1))
+			So(source.skipped, ShouldResemble, []byteRange{{start, start + int64(len(corrupt))}})
+		})
+	})
+}
@@ -0,0 +1,87 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Reverse reads Extended JSON documents, in canonical or relaxed form, and
+// writes them as BSON. The input is a sequence of documents, as written by
+// bsondump or mongoexport, or a JSON array of documents.
+// It returns the number of documents written and a non-nil error if one is
+// encountered before the end of the input is reached.
+func (bd *BSONDump) Reverse() (int, error) {
+	numFound := 0
+
+	if bd.jsonInput == nil {
+		panic("Tried to call Reverse() before opening file")
+	}
+
+	out := bufio.NewWriter(bd.OutputWriter)
+	write := func(value json.RawMessage) error {
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(value, false, &doc); err != nil {
+			return fmt.Errorf("error converting document %v to BSON: %v", numFound+1, err)
+		}
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("error converting document %v to BSON: %v", numFound+1, err)
+		}
+		raw, matched, err := bd.selectDoc(raw)
+		if !matched {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = out.Write(raw); err != nil {
+			return err
+		}
+		numFound++
+		return nil
+	}
+
+	decoder := json.NewDecoder(bd.jsonInput)
+	for {
+		var value json.RawMessage
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = out.Flush()
+			return numFound, fmt.Errorf("error reading JSON after document %v: %v", numFound, err)
+		}
+
+		if len(value) > 0 && value[0] == '[' {
+			var values []json.RawMessage
+			if err = json.Unmarshal(value, &values); err != nil {
+				_ = out.Flush()
+				return numFound, fmt.Errorf("error reading JSON array: %v", err)
+			}
+			for _, v := range values {
+				if err = write(v); err != nil {
+					break
+				}
+			}
+		} else {
+			err = write(value)
+		}
+		if err != nil {
+			// keep the documents before the bad one
+			_ = out.Flush()
+			return numFound, err
+		}
+	}
+	return numFound, out.Flush()
+}
@@ -0,0 +1,72 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestReverse(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	reverse := func(input string) (int, []bson.D, error) {
+		var out bytes.Buffer
+		bd := &BSONDump{
+			OutputOptions: &OutputOptions{},
+			OutputWriter:  WriteNopCloser{&out},
+			jsonInput:     ioutil.NopCloser(strings.NewReader(input)),
+		}
+		n, err := bd.Reverse()
+
+		var docs []bson.D
+		source := db.NewDecodedBSONSource(db.NewBSONSource(ioutil.NopCloser(&out)))
+		for {
+			var doc bson.D
+			if !source.Next(&doc) {
+				break
+			}
+			docs = append(docs, doc)
+		}
+		So(source.Err(), ShouldBeNil)
+		return n, docs, err
+	}
+
+	Convey("Canonical, relaxed and pretty-printed documents are converted to BSON", t, func() {
+		n, docs, err := reverse(`{"_id":{"$numberInt":"1"},"n":{"$numberLong":"5"}}
+{"_id": 2, "when": {"$date": "2021-01-01T00:00:00Z"}}
+{
+	"_id": {"$oid": "5f1b2c3d4e5f6a7b8c9d0e1f"}
+}`)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 3)
+		So(docs[0], ShouldResemble, bson.D{{Key: "_id", Value: int32(1)}, {Key: "n", Value: int64(5)}})
+		So(docs[1][0], ShouldResemble, bson.E{Key: "_id", Value: int32(2)})
+		So(len(docs), ShouldEqual, 3)
+	})
+
+	Convey("A JSON array of documents is converted to BSON", t, func() {
+		n, docs, err := reverse(`[{"a": 1}, {"a": 2}]`)
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		So(docs[1], ShouldResemble, bson.D{{Key: "a", Value: int32(2)}})
+	})
+
+	Convey("The documents before invalid JSON are written", t, func() {
+		n, docs, err := reverse(`{"a": 1} {"a": }`)
+		So(err, ShouldNotBeNil)
+		So(n, ShouldEqual, 1)
+		So(len(docs), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,155 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/text"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// arrayElements is the path component used for the elements of an array.
+const arrayElements = "[]"
+
+// fieldStats aggregates the values found at one field path.
+type fieldStats struct {
+	// docs is the number of documents the field appears in
+	docs  int64
+	types map[bsontype.Type]int64
+	// minSize and maxSize are element sizes, as in the debug output
+	minSize int
+	maxSize int
+}
+
+// schemaStats is the --stats summary of a file.
+type schemaStats struct {
+	docs       int64
+	totalSize  int64
+	minDocSize int
+	maxDocSize int
+	fields     map[string]*fieldStats
+	// order has the field paths in the order they were first seen
+	order []string
+}
+
+func newSchemaStats() *schemaStats {
+	return &schemaStats{fields: map[string]*fieldStats{}}
+}
+
+// add records a document. Documents nested in arrays have their fields
+// recorded under "<array>.[]".
+func (s *schemaStats) add(doc bson.Raw) error {
+	if s.docs == 0 || len(doc) < s.minDocSize {
+		s.minDocSize = len(doc)
+	}
+	if len(doc) > s.maxDocSize {
+		s.maxDocSize = len(doc)
+	}
+	s.docs++
+	s.totalSize += int64(len(doc))
+	return s.addFields(doc, "", false, map[string]bool{})
+}
+
+// addFields records the fields of a document, or the elements of an array
+// under the single path prefix.
+func (s *schemaStats) addFields(doc bson.Raw, prefix string, array bool, seen map[string]bool) error {
+	elements, err := doc.Elements()
+	if err != nil {
+		return err
+	}
+	for _, elem := range elements {
+		path := elem.Key()
+		if array {
+			path = prefix
+		} else if prefix != "" {
+			path = prefix + "." + path
+		}
+		s.addValue(path, elem.Value().Type, len(elem), seen)
+
+		value := elem.Value()
+		switch value.Type {
+		case bsontype.EmbeddedDocument:
+			err = s.addFields(value.Document(), path, false, seen)
+		case bsontype.Array:
+			err = s.addFields(bson.Raw(value.Array()), path+"."+arrayElements, true, seen)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *schemaStats) addValue(path string, t bsontype.Type, size int, seen map[string]bool) {
+	field, ok := s.fields[path]
+	if !ok {
+		field = &fieldStats{types: map[bsontype.Type]int64{}, minSize: size}
+		s.fields[path] = field
+		s.order = append(s.order, path)
+	}
+	if !seen[path] {
+		seen[path] = true
+		field.docs++
+	}
+	field.types[t]++
+	if size < field.minSize {
+		field.minSize = size
+	}
+	if size > field.maxSize {
+		field.maxSize = size
+	}
+}
+
+// write prints the summary: document counts and sizes, then a row for each
+// field with the documents it is in, the types seen and the element sizes.
+func (s *schemaStats) write(out io.Writer) {
+	fmt.Fprintf(out, "--- stats ---\n")
+	fmt.Fprintf(out, "documents: %v\n", s.docs)
+	if s.docs == 0 {
+		return
+	}
+	fmt.Fprintf(out, "document size: min %v, max %v, avg %v, total %v\n",
+		s.minDocSize, s.maxDocSize, s.totalSize/s.docs, s.totalSize)
+
+	grid := &text.GridWriter{ColumnPadding: 4}
+	grid.WriteCells("field", "present", "types", "size min", "size max")
+	grid.EndRow()
+	for _, path := range s.order {
+		field := s.fields[path]
+		grid.WriteCells(path,
+			fmt.Sprintf("%v (%.1f%%)", field.docs, 100*float64(field.docs)/float64(s.docs)),
+			formatTypes(field.types),
+			fmt.Sprint(field.minSize),
+			fmt.Sprint(field.maxSize))
+		grid.EndRow()
+	}
+	grid.Flush(out)
+}
+
+// formatTypes lists the types seen with their counts, most common first.
+func formatTypes(types map[bsontype.Type]int64) string {
+	seen := make([]bsontype.Type, 0, len(types))
+	for t := range types {
+		seen = append(seen, t)
+	}
+	sort.Slice(seen, func(i, j int) bool {
+		if types[seen[i]] != types[seen[j]] {
+			return types[seen[i]] > types[seen[j]]
+		}
+		return seen[i] < seen[j]
+	})
+	parts := make([]string, len(seen))
+	for i, t := range seen {
+		parts[i] = fmt.Sprintf("%v:%v", t, types[t])
+	}
+	return strings.Join(parts, ",")
+}
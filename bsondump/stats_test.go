@@ -0,0 +1,52 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+func TestSchemaStats(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Field presence, types and sizes are aggregated across documents", t, func() {
+		stats := newSchemaStats()
+		for _, doc := range []bson.D{
+			{{Key: "_id", Value: 1}, {Key: "name", Value: "ada"}, {Key: "tags", Value: bson.A{"a", "bb"}}},
+			{{Key: "_id", Value: int64(2)}, {Key: "items", Value: bson.A{bson.D{{Key: "qty", Value: 1}}, bson.D{{Key: "qty", Value: 2}}}}},
+		} {
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			So(stats.add(raw), ShouldBeNil)
+		}
+
+		So(stats.docs, ShouldEqual, 2)
+		So(stats.order, ShouldResemble, []string{"_id", "name", "tags", "tags.[]", "items", "items.[]", "items.[].qty"})
+
+		id := stats.fields["_id"]
+		So(id.docs, ShouldEqual, 2)
+		So(id.types, ShouldResemble, map[bsontype.Type]int64{bsontype.Int32: 1, bsontype.Int64: 1})
+		So(id.minSize, ShouldEqual, 9)
+		So(id.maxSize, ShouldEqual, 13)
+
+		So(stats.fields["tags.[]"].types[bsontype.String], ShouldEqual, 2)
+		qty := stats.fields["items.[].qty"]
+		So(qty.docs, ShouldEqual, 1)
+		So(qty.types[bsontype.Int32], ShouldEqual, 2)
+
+		var out bytes.Buffer
+		stats.write(&out)
+		So(out.String(), ShouldContainSubstring, "documents: 2\n")
+		So(out.String(), ShouldContainSubstring, "1 (50.0%)")
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// StrictValidation is the --validate mode that checks the contents of each
+// document as well as its structure.
+const StrictValidation = "strict"
+
+// maxNestingDepth is the deepest nesting of documents and arrays that the
+// server accepts in a stored document.
+const maxNestingDepth = 100
+
+// violation is a problem found in a document by --validate. The offset is
+// the offset of the element in the file.
+type violation struct {
+	path    string
+	offset  int64
+	problem string
+}
+
+func (v violation) String() string {
+	if v.path == "" {
+		return fmt.Sprintf("offset %v: %v", v.offset, v.problem)
+	}
+	return fmt.Sprintf("field '%v' at offset %v: %v", v.path, v.offset, v.problem)
+}
+
+// validateDocument checks a document at an offset in the file for invalid
+// BSON, invalid UTF-8, duplicate keys, excessive nesting and field names
+// that can't be stored.
+func validateDocument(doc bson.Raw, offset int64) []violation {
+	if err := doc.Validate(); err != nil {
+		return []violation{{offset: offset, problem: fmt.Sprintf("invalid BSON: %v", err)}}
+	}
+	var violations []violation
+	validateFields(doc, "", offset, 1, false, &violations)
+	return violations
+}
+
+func validateFields(doc bson.Raw, prefix string, offset int64, depth int, array bool, violations *[]violation) {
+	report := func(path string, at int64, format string, args ...interface{}) {
+		*violations = append(*violations, violation{path: path, offset: at, problem: fmt.Sprintf(format, args...)})
+	}
+	if depth > maxNestingDepth {
+		report(prefix, offset, "nested more than %v levels deep", maxNestingDepth)
+		return
+	}
+
+	elements, _ := doc.Elements()
+	seen := make(map[string]bool, len(elements))
+	elemOffset := offset + 4
+	for i, elem := range elements {
+		key := elem.Key()
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		switch {
+		case !utf8.ValidString(key):
+			report(path, elemOffset, "field name is not valid UTF-8")
+		case array && key != strconv.Itoa(i):
+			report(path, elemOffset, "array element has index %q, expected \"%v\"", key, i)
+		case array:
+		case seen[key]:
+			report(path, elemOffset, "duplicate field name")
+		case key == "":
+			report(path, elemOffset, "empty field name")
+		case strings.Contains(key, "."):
+			report(path, elemOffset, "field name contains '.'")
+		case strings.HasPrefix(key, "$") && !util.StringSliceContains([]string{"$ref", "$id", "$db"}, key):
+			report(path, elemOffset, "field name starts with '$'")
+		}
+		seen[key] = true
+
+		value := elem.Value()
+		for _, s := range stringsOf(value) {
+			if !utf8.ValidString(s) {
+				report(path, elemOffset, "%v is not valid UTF-8", value.Type)
+				break
+			}
+		}
+
+		valueOffset := elemOffset + int64(len(key)) + 2
+		switch value.Type {
+		case bsontype.EmbeddedDocument:
+			validateFields(value.Document(), path, valueOffset, depth+1, false, violations)
+		case bsontype.Array:
+			validateFields(bson.Raw(value.Array()), path, valueOffset, depth+1, true, violations)
+		}
+		elemOffset += int64(len(elem))
+	}
+}
+
+// stringsOf returns the strings in a value that must be valid UTF-8.
+func stringsOf(value bson.RawValue) []string {
+	switch value.Type {
+	case bsontype.String:
+		return []string{value.StringValue()}
+	case bsontype.Symbol:
+		return []string{value.Symbol()}
+	case bsontype.JavaScript:
+		return []string{value.JavaScript()}
+	case bsontype.CodeWithScope:
+		code, _ := value.CodeWithScope()
+		return []string{code}
+	case bsontype.Regex:
+		pattern, options := value.Regex()
+		return []string{pattern, options}
+	case bsontype.DBPointer:
+		ns, _ := value.DBPointer()
+		return []string{ns}
+	}
+	return nil
+}
+
+// Validate iterates through the BSON file and checks each document with
+// validateDocument, printing the violations found.
+// It returns the number of documents checked and a non-nil error if any
+// document has violations, or if one is encountered before the end of the
+// file is reached.
+func (bd *BSONDump) Validate() (int, error) {
+	numFound := 0
+	invalid := 0
+
+	if bd.InputSource == nil {
+		panic("Tried to call Validate() before opening file")
+	}
+
+	var offset int64
+	for {
+		doc := bson.Raw(bd.InputSource.LoadNext())
+		if doc == nil {
+			break
+		}
+		if rs, ok := bd.InputSource.(*recoveringSource); ok {
+			offset = rs.offset - int64(len(doc))
+		}
+
+		violations := validateDocument(doc, offset)
+		for _, v := range violations {
+			_, err := fmt.Fprintf(bd.OutputWriter, "document %v (offset %v): %v\n", numFound+1, offset, v)
+			if err != nil {
+				return numFound, err
+			}
+		}
+		if len(violations) > 0 {
+			invalid++
+		}
+		numFound++
+		offset += int64(len(doc))
+	}
+	if err := bd.InputSource.Err(); err != nil {
+		return numFound, fmt.Errorf("error at offset %v: %v", offset, err)
+	}
+	if invalid > 0 {
+		return numFound, fmt.Errorf("%v of %v %v failed validation", invalid, numFound,
+			util.Pluralize(numFound, "document", "documents"))
+	}
+	return numFound, nil
+}
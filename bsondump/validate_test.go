@@ -0,0 +1,74 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestValidate(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	marshal := func(doc interface{}) bson.Raw {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	Convey("Violations are reported with their paths and offsets", t, func() {
+		doc := marshal(bson.D{
+			{Key: "a", Value: 1},
+			{Key: "a", Value: 2},
+			{Key: "sub", Value: bson.D{{Key: "x.y", Value: "\xff"}}},
+			{Key: "$set", Value: 1},
+			{Key: "ref", Value: bson.D{{Key: "$ref", Value: "c"}, {Key: "$id", Value: 1}}},
+		})
+		violations := validateDocument(doc, 100)
+		So(violations, ShouldResemble, []violation{
+			{path: "a", offset: 111, problem: "duplicate field name"},
+			{path: "sub.x.y", offset: 127, problem: "field name contains '.'"},
+			{path: "sub.x.y", offset: 127, problem: "string is not valid UTF-8"},
+			{path: "$set", offset: 139, problem: "field name starts with '$'"},
+		})
+	})
+
+	Convey("Documents nested too deeply are reported once", t, func() {
+		nested := bson.D{{Key: "leaf", Value: 1}}
+		for i := 0; i < maxNestingDepth; i++ {
+			nested = bson.D{{Key: "n", Value: nested}}
+		}
+		violations := validateDocument(marshal(nested), 0)
+		So(len(violations), ShouldEqual, 1)
+		So(violations[0].problem, ShouldEqual, "nested more than 100 levels deep")
+	})
+
+	Convey("Validate reports the documents with violations and fails", t, func() {
+		var input bytes.Buffer
+		input.Write(marshal(bson.D{{Key: "_id", Value: 1}}))
+		input.Write(marshal(bson.D{{Key: "_id", Value: 2}, {Key: "_id", Value: 3}}))
+
+		var out bytes.Buffer
+		bd := &BSONDump{
+			OutputOptions: &OutputOptions{Validate: StrictValidation},
+			OutputWriter:  WriteNopCloser{&out},
+			InputSource:   db.NewBSONSource(ioutil.NopCloser(&input)),
+		}
+		n, err := bd.Validate()
+		So(n, ShouldEqual, 2)
+		So(err, ShouldNotBeNil)
+		So(out.String(), ShouldEqual, "document 2 (offset 14): field '_id' at offset 27: duplicate field name\n")
+	})
+}
@@ -0,0 +1,126 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package alert implements the --alert rules of the monitoring tools: a
+// threshold on a metric that fires an alert once it is breached for a number
+// of consecutive polls.
+package alert
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Rule is a threshold given to --alert, such as "qrw>100" or "write>500ms".
+type Rule struct {
+	Field     string
+	Op        string
+	Threshold float64
+	text      string
+}
+
+func (r Rule) String() string {
+	return r.text
+}
+
+// Breached reports whether a value breaches the rule.
+func (r Rule) Breached(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	default:
+		return value <= r.Threshold
+	}
+}
+
+// Syntax describes the rules a tool accepts.
+type Syntax struct {
+	// Fields is a regular expression matching the fields rules can compare.
+	Fields string
+	// Expected describes a valid rule in error messages.
+	Expected string
+	// Threshold converts the threshold of a rule to the number its field is
+	// compared with.
+	Threshold func(text string) (float64, error)
+}
+
+// ParseRules parses a comma-separated list of rules, each a field, one of
+// >, >=, < or <=, and a threshold.
+func ParseRules(spec string, syntax Syntax) ([]Rule, error) {
+	ruleRE, err := regexp.Compile(`^\s*(` + syntax.Fields + `)\s*(>=|<=|>|<)\s*(\S+)\s*$`)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	for _, text := range strings.Split(spec, ",") {
+		match := ruleRE.FindStringSubmatch(text)
+		if match == nil {
+			return nil, fmt.Errorf("invalid alert '%v': expected %v", text, syntax.Expected)
+		}
+		threshold, err := syntax.Threshold(match[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid threshold in alert '%v': %v", text, err)
+		}
+		rules = append(rules, Rule{Field: match[1], Op: match[2], Threshold: threshold, text: strings.TrimSpace(text)})
+	}
+	return rules, nil
+}
+
+// Streaks counts the consecutive polls in which each source, such as a host
+// or a namespace, breaches each rule.
+type Streaks struct {
+	intervals int
+	counts    map[string]int
+	updated   map[string]bool
+}
+
+// NewStreaks creates Streaks that fire after the given number of polls.
+func NewStreaks(intervals int) *Streaks {
+	return &Streaks{intervals: intervals, counts: map[string]int{}, updated: map[string]bool{}}
+}
+
+// Update records whether a source breached a rule in this poll, and reports
+// whether the alert fires. It fires once per streak of breaches, when the
+// streak reaches the number of polls.
+func (s *Streaks) Update(source string, rule Rule, breached bool) bool {
+	key := source + "\x00" + rule.text
+	s.updated[key] = true
+	if !breached {
+		delete(s.counts, key)
+		return false
+	}
+	s.counts[key]++
+	return s.counts[key] == s.intervals
+}
+
+// EndPoll ends the streaks that weren't updated since the last poll, such as
+// those of a source that is no longer reported.
+func (s *Streaks) EndPoll() {
+	for key := range s.counts {
+		if !s.updated[key] {
+			delete(s.counts, key)
+		}
+	}
+	s.updated = map[string]bool{}
+}
+
+// RunCommand runs an --alertCmd in the shell, with the alert in the given
+// environment variables. Its output goes to stderr, to keep it apart from
+// the tool's.
+func RunCommand(command string, env ...string) error {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,64 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package alert
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAlerts(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	syntax := Syntax{
+		Fields:   "a|b",
+		Expected: "a or b",
+		Threshold: func(text string) (float64, error) {
+			return strconv.ParseFloat(text, 64)
+		},
+	}
+
+	Convey("Rules are parsed and compared with values", t, func() {
+		rules, err := ParseRules("a>1, b<=2", syntax)
+		So(err, ShouldBeNil)
+		So(rules, ShouldHaveLength, 2)
+		So(rules[0].String(), ShouldEqual, "a>1")
+		So(rules[0].Breached(1), ShouldBeFalse)
+		So(rules[0].Breached(1.5), ShouldBeTrue)
+		So(rules[1].Breached(2), ShouldBeTrue)
+
+		_, err = ParseRules("c>1", syntax)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "expected a or b")
+		_, err = ParseRules("a>x", syntax)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("A streak fires once when it reaches the number of polls", t, func() {
+		rules, err := ParseRules("a>1", syntax)
+		So(err, ShouldBeNil)
+		streaks := NewStreaks(2)
+		So(streaks.Update("x", rules[0], true), ShouldBeFalse)
+		So(streaks.Update("x", rules[0], true), ShouldBeTrue)
+		So(streaks.Update("x", rules[0], true), ShouldBeFalse)
+
+		So(streaks.Update("x", rules[0], false), ShouldBeFalse)
+		So(streaks.Update("x", rules[0], true), ShouldBeFalse)
+		So(streaks.Update("x", rules[0], true), ShouldBeTrue)
+
+		Convey("and ends when its source isn't updated in a poll", func() {
+			streaks.EndPoll()
+			So(streaks.Update("y", rules[0], true), ShouldBeFalse)
+			streaks.EndPoll()
+			streaks.EndPoll()
+			So(streaks.Update("y", rules[0], true), ShouldBeFalse)
+		})
+	})
+}
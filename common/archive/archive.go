@@ -38,6 +38,8 @@ type Header struct {
 	FormatVersion         string `bson:"version"`
 	ServerVersion         string `bson:"server_version"`
 	ToolVersion           string `bson:"tool_version"`
+	// Indexed is set when the archive ends with an index of its blocks.
+	Indexed bool `bson:"indexed,omitempty"`
 }
 
 const minBSONSize = 4 + 1 // an empty BSON document should be exactly five bytes long
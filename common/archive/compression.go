@@ -0,0 +1,30 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/huimingz/mongo-tools/common/compression"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+)
+
+// NewDecompressingReader detects whether an archive stream is compressed with
+// gzip, zstd or lz4 and returns a reader of the decompressed archive. An
+// uncompressed archive is read as is. Closing the reader closes in.
+func NewDecompressingReader(in io.ReadCloser) (io.ReadCloser, error) {
+	rc, codec, err := compression.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("error reading archive: %v", err)
+	}
+	if codec != compression.None {
+		log.Logvf(log.DebugLow, "decompressing %v archive", codec)
+	}
+	return &util.WrappedReadCloser{ReadCloser: rc, Inner: in}, nil
+}
@@ -0,0 +1,52 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	"github.com/klauspost/compress/zstd"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewDecompressingReader(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	// the archive magic number followed by some data
+	archive := []byte{0x6d, 0xe2, 0x99, 0x81, 1, 2, 3, 4}
+	read := func(data []byte) []byte {
+		rc, err := NewDecompressingReader(ioutil.NopCloser(bytes.NewReader(data)))
+		So(err, ShouldBeNil)
+		defer rc.Close()
+		out, err := ioutil.ReadAll(rc)
+		So(err, ShouldBeNil)
+		return out
+	}
+
+	Convey("Uncompressed archives are read as is", t, func() {
+		So(read(archive), ShouldResemble, archive)
+	})
+
+	Convey("gzip and zstd archives are decompressed", t, func() {
+		var gz bytes.Buffer
+		gw := gzip.NewWriter(&gz)
+		_, _ = gw.Write(archive)
+		So(gw.Close(), ShouldBeNil)
+		So(read(gz.Bytes()), ShouldResemble, archive)
+
+		var zs bytes.Buffer
+		zw, err := zstd.NewWriter(&zs)
+		So(err, ShouldBeNil)
+		_, _ = zw.Write(archive)
+		So(zw.Close(), ShouldBeNil)
+		So(read(zs.Bytes()), ShouldResemble, archive)
+	})
+}
@@ -242,6 +242,22 @@ func (demux *Demultiplexer) Open(ns string, out DemuxOut) {
 	demux.lengths[ns] = 0
 }
 
+// SkipMuted removes the namespaces whose DemuxOut is a MutedCollection, and
+// marks them closed, so the demultiplexer doesn't expect their blocks. It's
+// used when only the other namespaces are read from an indexed archive.
+func (demux *Demultiplexer) SkipMuted() []string {
+	var skipped []string
+	for ns, out := range demux.outs {
+		if _, ok := out.(*MutedCollection); ok {
+			delete(demux.outs, ns)
+			delete(demux.lengths, ns)
+			demux.NamespaceStatus[ns] = NamespaceClosed
+			skipped = append(skipped, ns)
+		}
+	}
+	return skipped
+}
+
 // RegularCollectionReceiver implements the intents.file interface.
 type RegularCollectionReceiver struct {
 	pos              int64 // updated atomically, aligned at the beginning of the struct
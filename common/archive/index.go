@@ -0,0 +1,269 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// footerSize is the size of the footer at the end of an indexed archive: the
+// offset of the index block as an int64, followed by the magic number.
+const footerSize = 8 + 4
+
+// maxRangesPerEntry limits the number of ranges in one index entry, so that
+// entries stay well under the maximum BSON size.
+const maxRangesPerEntry = 100000
+
+// IndexHeader is the header of the index block at the end of an indexed
+// archive. Readers that stream the archive stop when they reach it.
+type IndexHeader struct {
+	Index bool `bson:"index"`
+}
+
+// IndexEntry is a document in the index block. It holds the byte ranges of
+// the blocks of one namespace, as start and end offsets from the beginning
+// of the first block after the prelude. A namespace with many ranges may
+// have several entries.
+type IndexEntry struct {
+	Database   string  `bson:"db"`
+	Collection string  `bson:"collection"`
+	Ranges     []int64 `bson:"ranges"`
+}
+
+// BlockRange is the byte range [Start, End) of one or more consecutive
+// blocks of a namespace.
+type BlockRange struct {
+	Start int64
+	End   int64
+}
+
+// Index maps each namespace in an archive to the ranges of its blocks.
+type Index map[string][]BlockRange
+
+// add records a block of a namespace, merging it into the last range if
+// the two are adjacent.
+func (index Index) add(ns string, start, end int64) {
+	ranges := index[ns]
+	if n := len(ranges); n > 0 && ranges[n-1].End == start {
+		ranges[n-1].End = end
+		return
+	}
+	index[ns] = append(ranges, BlockRange{Start: start, End: end})
+}
+
+// write writes the index block and the footer. The offset is where the
+// index block starts, relative to the first block after the prelude.
+func (index Index) write(out io.Writer, offset int64) error {
+	header, err := bson.Marshal(IndexHeader{Index: true})
+	if err != nil {
+		return err
+	}
+	if err = writeAll(out, header); err != nil {
+		return err
+	}
+
+	namespaces := make([]string, 0, len(index))
+	for ns := range index {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		dbName, collName := util.SplitNamespace(ns)
+		ranges := index[ns]
+		for len(ranges) > 0 {
+			n := len(ranges)
+			if n > maxRangesPerEntry {
+				n = maxRangesPerEntry
+			}
+			entry := IndexEntry{Database: dbName, Collection: collName}
+			for _, r := range ranges[:n] {
+				entry.Ranges = append(entry.Ranges, r.Start, r.End)
+			}
+			ranges = ranges[n:]
+			data, err := bson.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err = writeAll(out, data); err != nil {
+				return err
+			}
+		}
+	}
+	if err = writeAll(out, terminatorBytes); err != nil {
+		return err
+	}
+
+	footer := make([]byte, footerSize)
+	binary.LittleEndian.PutUint64(footer, uint64(offset))
+	binary.LittleEndian.PutUint32(footer[8:], MagicNumber)
+	return writeAll(out, footer)
+}
+
+func writeAll(out io.Writer, data []byte) error {
+	l, err := out.Write(data)
+	if err != nil {
+		return err
+	}
+	if l != len(data) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// isIndexHeader reports whether a block header is the header of the index
+// block.
+func isIndexHeader(header []byte) bool {
+	value, err := bson.Raw(header).LookupErr("index")
+	return err == nil && value.Type == bsontype.Boolean && value.Boolean()
+}
+
+// ReadIndex reads the index at the end of an archive. The blocksStart is the
+// offset in the file of the first block after the prelude.
+func ReadIndex(file io.ReaderAt, size, blocksStart int64) (Index, error) {
+	if size-blocksStart < footerSize {
+		return nil, fmt.Errorf("archive is too short to have an index")
+	}
+	footer := make([]byte, footerSize)
+	if _, err := file.ReadAt(footer, size-footerSize); err != nil {
+		return nil, fmt.Errorf("error reading archive index footer: %v", err)
+	}
+	if binary.LittleEndian.Uint32(footer[8:]) != MagicNumber {
+		return nil, fmt.Errorf("archive index footer is missing")
+	}
+	offset := int64(binary.LittleEndian.Uint64(footer))
+	indexStart := blocksStart + offset
+	if offset < 0 || indexStart > size-footerSize {
+		return nil, fmt.Errorf("archive index offset %v is out of range", offset)
+	}
+
+	parser := Parser{In: io.NewSectionReader(file, indexStart, size-footerSize-indexStart)}
+	isTerminator, err := parser.readBSONOrTerminator()
+	if err != nil {
+		return nil, fmt.Errorf("error reading archive index header: %v", err)
+	}
+	if isTerminator || !isIndexHeader(parser.buf[:parser.length]) {
+		return nil, fmt.Errorf("archive index offset doesn't point to the index")
+	}
+	index := Index{}
+	for {
+		isTerminator, err = parser.readBSONOrTerminator()
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive index: %v", err)
+		}
+		if isTerminator {
+			return index, nil
+		}
+		var entry IndexEntry
+		if err = bson.Unmarshal(parser.buf[:parser.length], &entry); err != nil {
+			return nil, fmt.Errorf("error reading archive index entry: %v", err)
+		}
+		if len(entry.Ranges)%2 != 0 {
+			return nil, fmt.Errorf("archive index entry for %v.%v has an odd number of offsets",
+				entry.Database, entry.Collection)
+		}
+		ns := entry.Database + "." + entry.Collection
+		for i := 0; i < len(entry.Ranges); i += 2 {
+			start, end := entry.Ranges[i], entry.Ranges[i+1]
+			if start < 0 || end < start || end > offset {
+				return nil, fmt.Errorf("archive index entry for %v has an invalid range [%v, %v)", ns, start, end)
+			}
+			index.add(ns, start, end)
+		}
+	}
+}
+
+// IndexedArchive is an uncompressed archive file with an index, from which
+// the blocks of some namespaces can be read without reading the others.
+type IndexedArchive struct {
+	Prelude     *Prelude
+	Index       Index
+	file        *os.File
+	blocksStart int64
+}
+
+// OpenIndexed opens an archive file to be read through its index. It returns
+// nil if the archive is compressed or has no index, in which case it has to
+// be read as a stream.
+func OpenIndexed(path string) (*IndexedArchive, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	counter := &countingReader{r: file}
+	prelude := &Prelude{}
+	// a compressed archive doesn't start with the magic number
+	if err = prelude.Read(counter); err != nil || prelude.Header == nil || !prelude.Header.Indexed {
+		file.Close()
+		return nil, nil
+	}
+	index, err := ReadIndex(file, info.Size(), counter.n)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &IndexedArchive{
+		Prelude:     prelude,
+		Index:       index,
+		file:        file,
+		blocksStart: counter.n,
+	}, nil
+}
+
+// Reader returns a reader of the blocks of the given namespaces, in the order
+// they are in the archive.
+func (ia *IndexedArchive) Reader(namespaces []string) io.Reader {
+	var ranges []BlockRange
+	for _, ns := range namespaces {
+		ranges = append(ranges, ia.Index[ns]...)
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	readers := make([]io.Reader, len(ranges))
+	for i, r := range ranges {
+		readers[i] = io.NewSectionReader(ia.file, ia.blocksStart+r.Start, r.End-r.Start)
+	}
+	return io.MultiReader(readers...)
+}
+
+// Close closes the archive file.
+func (ia *IndexedArchive) Close() error {
+	return ia.file.Close()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	io.WriteCloser
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.WriteCloser.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,131 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"bytes"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// buildArchive writes a whole archive of the test intents to a file.
+func buildArchive(dir string, indexed bool) (string, map[string]hash.Hash, map[string]*int) {
+	buf := &closingBuffer{bytes.Buffer{}}
+	prelude := &Prelude{Header: &Header{FormatVersion: archiveFormatVersion, Indexed: indexed}}
+	for _, intent := range testIntents {
+		prelude.AddMetadata(&CollectionMetadata{Database: intent.DB, Collection: intent.C})
+	}
+	So(prelude.Write(buf), ShouldBeNil)
+
+	mux := NewMultiplexer(buf, new(testNotifier))
+	if indexed {
+		mux.EnableIndex()
+	}
+	inChecksum := map[string]hash.Hash{}
+	inLengths := map[string]*int{}
+	errChan := make(chan error)
+	makeIns(testIntents, mux, inChecksum, map[string]*MuxIn{}, inLengths, errChan)
+	go mux.Run()
+	for range testIntents {
+		So(<-errChan, ShouldBeNil)
+	}
+	close(mux.Control)
+	So(<-mux.Completed, ShouldBeNil)
+
+	path := filepath.Join(dir, "archive")
+	So(ioutil.WriteFile(path, buf.Bytes(), 0644), ShouldBeNil)
+	return path, inChecksum, inLengths
+}
+
+func TestIndexedArchive(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("with an archive written with an index", t, func() {
+		dir, err := ioutil.TempDir("", "indexed-archive")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path, inChecksum, inLengths := buildArchive(dir, true)
+
+		Convey("the index has the blocks of every namespace", func() {
+			indexed, err := OpenIndexed(path)
+			So(err, ShouldBeNil)
+			So(indexed, ShouldNotBeNil)
+			defer indexed.Close()
+			So(indexed.Prelude.Header.Indexed, ShouldBeTrue)
+			So(len(indexed.Index), ShouldEqual, len(testIntents))
+			for _, intent := range testIntents {
+				So(indexed.Index[intent.Namespace()], ShouldNotBeEmpty)
+			}
+		})
+
+		Convey("some namespaces can be read without the others", func() {
+			indexed, err := OpenIndexed(path)
+			So(err, ShouldBeNil)
+			defer indexed.Close()
+
+			wanted, muted := testIntents[1:3], append(testIntents[:1:1], testIntents[3:]...)
+			demux := CreateDemux(indexed.Prelude.NamespaceMetadatas, nil)
+			outChecksum := map[string]hash.Hash{}
+			outLengths := map[string]*int{}
+			errChan := make(chan error)
+			makeOuts(wanted, demux, outChecksum, map[string]*RegularCollectionReceiver{}, outLengths, errChan)
+			for _, intent := range muted {
+				demux.Open(intent.Namespace(), &MutedCollection{Intent: intent, Demux: demux})
+			}
+			So(len(demux.SkipMuted()), ShouldEqual, len(muted))
+			demux.In = indexed.Reader([]string{wanted[0].Namespace(), wanted[1].Namespace()})
+
+			So(demux.Run(), ShouldBeNil)
+			for range wanted {
+				So(<-errChan, ShouldBeNil)
+			}
+			for _, intent := range wanted {
+				ns := intent.Namespace()
+				So(*outLengths[ns], ShouldEqual, *inLengths[ns])
+				So(outChecksum[ns].Sum(nil), ShouldResemble, inChecksum[ns].Sum(nil))
+			}
+		})
+
+		Convey("the archive can still be read as a stream", func() {
+			file, err := os.Open(path)
+			So(err, ShouldBeNil)
+			defer file.Close()
+			prelude := &Prelude{}
+			So(prelude.Read(file), ShouldBeNil)
+
+			demux := CreateDemux(prelude.NamespaceMetadatas, file)
+			outChecksum := map[string]hash.Hash{}
+			errChan := make(chan error)
+			makeOuts(testIntents, demux, outChecksum, map[string]*RegularCollectionReceiver{}, map[string]*int{}, errChan)
+			So(demux.Run(), ShouldBeNil)
+			for range testIntents {
+				So(<-errChan, ShouldBeNil)
+			}
+			for _, intent := range testIntents {
+				ns := intent.Namespace()
+				So(outChecksum[ns].Sum(nil), ShouldResemble, inChecksum[ns].Sum(nil))
+			}
+		})
+	})
+
+	Convey("an archive written without an index isn't opened as indexed", t, func() {
+		dir, err := ioutil.TempDir("", "indexed-archive")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path, _, _ := buildArchive(dir, false)
+
+		indexed, err := OpenIndexed(path)
+		So(err, ShouldBeNil)
+		So(indexed, ShouldBeNil)
+	})
+}
@@ -0,0 +1,136 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"fmt"
+	"hash"
+	"hash/crc64"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// NamespaceSummary describes a namespace in an archive and the data found
+// for it.
+type NamespaceSummary struct {
+	Database   string
+	Collection string
+	// Type is "timeseries", "view" or "", as in the CollectionMetadata.
+	Type string
+	// Metadata is the Extended JSON of the collection options and indexes.
+	Metadata string
+	// Documents and Size are the number and total size of the documents.
+	Documents int64
+	Size      int64
+	// HasData is set if the archive has any blocks for the namespace, and
+	// Complete once the end of its data has been read and its checksum has
+	// been verified. Views and metadata-only dumps have no data.
+	HasData  bool
+	Complete bool
+
+	hash hash.Hash64
+}
+
+// Namespace returns the namespace in the form <db>.<collection>.
+func (ns *NamespaceSummary) Namespace() string {
+	return ns.Database + "." + ns.Collection
+}
+
+// Summary describes the contents of an archive.
+type Summary struct {
+	Header     *Header
+	Namespaces []*NamespaceSummary
+}
+
+// Inspect reads a whole archive and summarizes it, without restoring
+// anything. Namespaces are listed in the order of the prelude, followed by
+// any that only appear in the data. The data of a timeseries collection is
+// counted for the collection, rather than for its buckets collection.
+func Inspect(in io.Reader) (*Summary, error) {
+	prelude := &Prelude{}
+	if err := prelude.Read(in); err != nil {
+		return nil, err
+	}
+
+	consumer := &inspectConsumer{
+		summary:     &Summary{Header: prelude.Header},
+		byNamespace: make(map[string]*NamespaceSummary),
+	}
+	for _, cm := range prelude.NamespaceMetadatas {
+		ns := &NamespaceSummary{
+			Database:   cm.Database,
+			Collection: cm.Collection,
+			Type:       cm.Type,
+			Metadata:   cm.Metadata,
+		}
+		consumer.summary.Namespaces = append(consumer.summary.Namespaces, ns)
+		dataCollection := cm.Collection
+		if cm.Type == "timeseries" {
+			dataCollection = "system.buckets." + cm.Collection
+		}
+		consumer.byNamespace[cm.Database+"."+dataCollection] = ns
+	}
+
+	parser := Parser{In: in}
+	if err := parser.ReadAllBlocks(consumer); err != nil {
+		return consumer.summary, err
+	}
+	return consumer.summary, nil
+}
+
+// inspectConsumer is a ParserConsumer that counts the documents of each
+// namespace.
+type inspectConsumer struct {
+	summary     *Summary
+	byNamespace map[string]*NamespaceSummary
+	current     *NamespaceSummary
+}
+
+func (ic *inspectConsumer) HeaderBSON(data []byte) error {
+	var header NamespaceHeader
+	if err := bson.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("header bson doesn't unmarshal as a collection header: %v", err)
+	}
+	name := header.Database + "." + header.Collection
+	ns, ok := ic.byNamespace[name]
+	if !ok {
+		ns = &NamespaceSummary{Database: header.Database, Collection: header.Collection}
+		ic.summary.Namespaces = append(ic.summary.Namespaces, ns)
+		ic.byNamespace[name] = ns
+	}
+	if ns.Complete {
+		return fmt.Errorf("data for namespace %v after its end", name)
+	}
+	if !ns.HasData {
+		ns.HasData = true
+		ns.hash = crc64.New(crc64.MakeTable(crc64.ECMA))
+	}
+	ic.current = ns
+	if header.EOF {
+		if crc := int64(ns.hash.Sum64()); crc != header.CRC {
+			return fmt.Errorf("CRC mismatch for namespace %v, %v!=%v", name, crc, header.CRC)
+		}
+		ns.Complete = true
+		ic.current = nil
+	}
+	return nil
+}
+
+func (ic *inspectConsumer) BodyBSON(data []byte) error {
+	if ic.current == nil {
+		return fmt.Errorf("collection data without a collection header")
+	}
+	ic.current.Documents++
+	ic.current.Size += int64(len(data))
+	ic.current.hash.Write(data)
+	return nil
+}
+
+func (ic *inspectConsumer) End() error {
+	return nil
+}
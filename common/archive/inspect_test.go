@@ -0,0 +1,56 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInspect(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("with an archive of several collections", t, func() {
+		dir, err := ioutil.TempDir("", "inspect-archive")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		for _, indexed := range []bool{false, true} {
+			indexed := indexed
+			path, _, inLengths := buildArchive(dir, indexed)
+			data, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+
+			Convey(fmt.Sprintf("every namespace is counted (indexed: %v)", indexed), func() {
+				summary, err := Inspect(bytes.NewReader(data))
+				So(err, ShouldBeNil)
+				So(summary.Header.Indexed, ShouldEqual, indexed)
+				So(len(summary.Namespaces), ShouldEqual, len(testIntents))
+				for i, ns := range summary.Namespaces {
+					So(ns.Namespace(), ShouldEqual, testIntents[i].Namespace())
+					So(ns.Documents, ShouldEqual, testDocCount)
+					So(ns.Size, ShouldEqual, *inLengths[ns.Namespace()])
+					So(ns.HasData, ShouldBeTrue)
+					So(ns.Complete, ShouldBeTrue)
+				}
+			})
+
+			Convey(fmt.Sprintf("a corrupted archive is reported (indexed: %v)", indexed), func() {
+				// flip a byte in the middle of a document in the last block
+				data[len(data)/2] ^= 0xff
+				_, err := Inspect(bytes.NewReader(data))
+				So(err, ShouldNotBeNil)
+			})
+		}
+	})
+}
@@ -36,6 +36,10 @@ type Multiplexer struct {
 	ins              []*MuxIn
 	selectCases      []reflect.SelectCase
 	currentNamespace string
+	// index and counter are set when the archive is written with an index
+	index      Index
+	counter    *countingWriter
+	blockStart int64
 }
 
 type notifier interface {
@@ -66,6 +70,29 @@ func NewMultiplexer(out io.WriteCloser, shutdownInputs notifier) *Multiplexer {
 	return mux
 }
 
+// EnableIndex makes the multiplexer record where the blocks of each namespace
+// are, and write an index of them at the end of the archive. The prelude must
+// be written before the multiplexer writes anything.
+func (mux *Multiplexer) EnableIndex() {
+	mux.counter = &countingWriter{WriteCloser: mux.Out}
+	mux.Out = mux.counter
+	mux.index = Index{}
+}
+
+// startBlock and endBlock record the range of each block in the index, if
+// there is one.
+func (mux *Multiplexer) startBlock() {
+	if mux.index != nil {
+		mux.blockStart = mux.counter.n
+	}
+}
+
+func (mux *Multiplexer) endBlock(ns string) {
+	if mux.index != nil {
+		mux.index.add(ns, mux.blockStart, mux.counter.n)
+	}
+}
+
 // Run multiplexes until it receives an EOF on its Control chan.
 func (mux *Multiplexer) Run() {
 	var err, completionErr error
@@ -75,6 +102,9 @@ func (mux *Multiplexer) Run() {
 		if index == 0 { //Control index
 			if EOF {
 				log.Logvf(log.DebugLow, "Mux finish")
+				if mux.index != nil && completionErr == nil {
+					completionErr = mux.index.write(mux.Out, mux.counter.n)
+				}
 				mux.Out.Close()
 				if completionErr != nil {
 					mux.Completed <- completionErr
@@ -159,7 +189,9 @@ func (mux *Multiplexer) formatBody(in *MuxIn, bsonBytes []byte) error {
 			if l != len(terminatorBytes) {
 				return io.ErrShortWrite
 			}
+			mux.endBlock(mux.currentNamespace)
 		}
+		mux.startBlock()
 		header, err := bson.Marshal(NamespaceHeader{
 			Database:   in.Intent.DB,
 			Collection: in.Intent.DataCollection(),
@@ -194,7 +226,9 @@ func (mux *Multiplexer) formatEOF(index int, in *MuxIn) error {
 		if l != len(terminatorBytes) {
 			return io.ErrShortWrite
 		}
+		mux.endBlock(mux.currentNamespace)
 	}
+	mux.startBlock()
 	eofHeader, err := bson.Marshal(NamespaceHeader{
 		Database:   in.Intent.DB,
 		Collection: in.Intent.DataCollection(),
@@ -218,6 +252,7 @@ func (mux *Multiplexer) formatEOF(index int, in *MuxIn) error {
 	if l != len(terminatorBytes) {
 		return io.ErrShortWrite
 	}
+	mux.endBlock(in.Intent.DataNamespace())
 	return nil
 }
 
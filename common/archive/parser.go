@@ -128,7 +128,8 @@ func (parse *Parser) ReadAllBlocks(consumer ParserConsumer) (err error) {
 // ReadBlock reads one archive block ( header + body* + terminator )
 // calling consumer.HeaderBSON() on the header, consumer.BodyBSON() on each piece of body,
 // and consumer.EOF() when EOF is encountered before any data was read.
-// It returns nil if a whole block was read, io.EOF if nothing was read,
+// It returns nil if a whole block was read, io.EOF if nothing was read or the
+// index block of an indexed archive was reached,
 // and a parserError if there was any io error in the middle of the block,
 // if either of the consumer methods return error, or if there was any sort of
 // parsing failure.
@@ -140,6 +141,10 @@ func (parse *Parser) ReadBlock(consumer ParserConsumer) (err error) {
 	if isTerminator {
 		return newParserError("consecutive terminators / headerless blocks are not allowed")
 	}
+	if isIndexHeader(parse.buf[:parse.length]) {
+		// the index at the end of an indexed archive isn't read as a stream
+		return io.EOF
+	}
 	err = consumer.HeaderBSON(parse.buf[:parse.length])
 	if err != nil {
 		return newParserWrappedError("ParserConsumer.HeaderBSON()", err)
@@ -0,0 +1,182 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// VolumeName returns the file name of the nth (1-based) volume of a
+// multi-volume archive, e.g. backup.archive.001.
+func VolumeName(base string, n int) string {
+	return fmt.Sprintf("%v.%03d", base, n)
+}
+
+// HasVolumes reports whether the first volume of a multi-volume archive
+// with the given base name exists.
+func HasVolumes(base string) bool {
+	_, err := os.Stat(VolumeName(base, 1))
+	return err == nil
+}
+
+// CheckVolumeConflict returns an error if both a single-file archive named
+// base and the volumes of a multi-volume archive with that name exist, as
+// happens when archives were written there both with and without a volume
+// size. Which of them is current can't be told, so neither is read.
+func CheckVolumeConflict(base string) error {
+	if _, err := os.Stat(base); err == nil && HasVolumes(base) {
+		return fmt.Errorf("both the archive %v and archive volumes starting with %v exist; remove the stale one",
+			base, VolumeName(base, 1))
+	}
+	return nil
+}
+
+// VolumeWriter is an io.WriteCloser that splits the archive byte stream across
+// numbered volume files of at most MaxSize bytes each. Volumes are created as
+// they are needed, so an empty stream produces no files.
+type VolumeWriter struct {
+	Base    string
+	MaxSize int64
+
+	current *os.File
+	volume  int
+	written int64
+}
+
+// NewVolumeWriter returns a VolumeWriter for volumes named after base.
+func NewVolumeWriter(base string, maxSize int64) (*VolumeWriter, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("archive volume size must be positive, got %v", maxSize)
+	}
+	if _, err := os.Stat(base); err == nil {
+		return nil, fmt.Errorf("the archive %v already exists; remove it before writing archive volumes with that name", base)
+	}
+	return &VolumeWriter{Base: base, MaxSize: maxSize}, nil
+}
+
+// Write writes p to the current volume, rolling over to a new volume
+// whenever the current one is full.
+func (vw *VolumeWriter) Write(p []byte) (int, error) {
+	var total int
+	for len(p) > 0 {
+		if vw.current == nil || vw.written >= vw.MaxSize {
+			if err := vw.nextVolume(); err != nil {
+				return total, err
+			}
+		}
+		chunk := p
+		if room := vw.MaxSize - vw.written; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		n, err := vw.current.Write(chunk)
+		total += n
+		vw.written += int64(n)
+		if err != nil {
+			return total, fmt.Errorf("error writing archive volume %v: %v", vw.current.Name(), err)
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// nextVolume closes the current volume, if any, and creates the next one.
+func (vw *VolumeWriter) nextVolume() error {
+	if vw.current != nil {
+		if err := vw.current.Close(); err != nil {
+			return fmt.Errorf("error closing archive volume %v: %v", vw.current.Name(), err)
+		}
+	}
+	vw.volume++
+	file, err := os.Create(VolumeName(vw.Base, vw.volume))
+	if err != nil {
+		return fmt.Errorf("error creating archive volume: %v", err)
+	}
+	vw.current = file
+	vw.written = 0
+	return nil
+}
+
+// Close closes the last volume and removes any higher-numbered volumes left
+// behind by an earlier archive with the same name, so that a reader does not
+// run on into stale data.
+func (vw *VolumeWriter) Close() error {
+	if vw.current != nil {
+		if err := vw.current.Close(); err != nil {
+			return fmt.Errorf("error closing archive volume %v: %v", vw.current.Name(), err)
+		}
+		vw.current = nil
+	}
+	for n := vw.volume + 1; ; n++ {
+		err := os.Remove(VolumeName(vw.Base, n))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error removing stale archive volume: %v", err)
+		}
+	}
+}
+
+// VolumeReader is an io.ReadCloser that reads the volumes of a multi-volume
+// archive in order as a single byte stream. The stream ends at the first
+// missing volume number.
+type VolumeReader struct {
+	Base string
+
+	current *os.File
+	volume  int
+}
+
+// NewVolumeReader opens the first volume of the archive named after base.
+func NewVolumeReader(base string) (*VolumeReader, error) {
+	vr := &VolumeReader{Base: base}
+	file, err := os.Open(VolumeName(base, 1))
+	if err != nil {
+		return nil, err
+	}
+	vr.current = file
+	vr.volume = 1
+	return vr, nil
+}
+
+// Read reads from the current volume, moving on to the next volume when the
+// current one is exhausted.
+func (vr *VolumeReader) Read(p []byte) (int, error) {
+	for vr.current != nil {
+		n, err := vr.current.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		vr.current.Close()
+		vr.current = nil
+		next, err := os.Open(VolumeName(vr.Base, vr.volume+1))
+		if os.IsNotExist(err) {
+			return n, io.EOF
+		}
+		if err != nil {
+			return n, fmt.Errorf("error opening archive volume: %v", err)
+		}
+		vr.volume++
+		vr.current = next
+		if n > 0 {
+			return n, nil
+		}
+	}
+	return 0, io.EOF
+}
+
+// Close closes the volume currently being read.
+func (vr *VolumeReader) Close() error {
+	if vr.current == nil {
+		return nil
+	}
+	err := vr.current.Close()
+	vr.current = nil
+	return err
+}
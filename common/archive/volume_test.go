@@ -0,0 +1,90 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVolumeRoundTrip(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a multi-volume archive", t, func() {
+		dir, err := ioutil.TempDir("", "archive-volumes")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		base := filepath.Join(dir, "backup.archive")
+
+		data := make([]byte, 2500)
+		for i := range data {
+			data[i] = byte(i % 251)
+		}
+
+		vw, err := NewVolumeWriter(base, 1000)
+		So(err, ShouldBeNil)
+		for i := 0; i < len(data); i += 300 {
+			end := i + 300
+			if end > len(data) {
+				end = len(data)
+			}
+			_, err = vw.Write(data[i:end])
+			So(err, ShouldBeNil)
+		}
+		So(vw.Close(), ShouldBeNil)
+
+		Convey("the stream is split into volumes of at most the maximum size", func() {
+			for n, size := range []int64{1000, 1000, 500} {
+				stat, err := os.Stat(VolumeName(base, n+1))
+				So(err, ShouldBeNil)
+				So(stat.Size(), ShouldEqual, size)
+			}
+			So(HasVolumes(base), ShouldBeTrue)
+			_, err := os.Stat(VolumeName(base, 4))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("the reader concatenates the volumes", func() {
+			vr, err := NewVolumeReader(base)
+			So(err, ShouldBeNil)
+			read, err := ioutil.ReadAll(vr)
+			So(err, ShouldBeNil)
+			So(vr.Close(), ShouldBeNil)
+			So(bytes.Equal(read, data), ShouldBeTrue)
+		})
+
+		Convey("rewriting a smaller archive removes stale volumes", func() {
+			vw, err := NewVolumeWriter(base, 1000)
+			So(err, ShouldBeNil)
+			_, err = vw.Write(data[:1200])
+			So(err, ShouldBeNil)
+			So(vw.Close(), ShouldBeNil)
+
+			_, err = os.Stat(VolumeName(base, 3))
+			So(os.IsNotExist(err), ShouldBeTrue)
+			vr, err := NewVolumeReader(base)
+			So(err, ShouldBeNil)
+			read, err := ioutil.ReadAll(vr)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(read, data[:1200]), ShouldBeTrue)
+		})
+
+		Convey("a single-file archive with the same name is a conflict", func() {
+			So(CheckVolumeConflict(base), ShouldBeNil)
+			So(ioutil.WriteFile(base, data, 0644), ShouldBeNil)
+			So(CheckVolumeConflict(base), ShouldNotBeNil)
+			_, err := NewVolumeWriter(base, 1000)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,554 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	gojson "encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ConvertCanonicalExtJSONDocumentToBSON iterates through a document decoded
+// from Extended JSON v2, in canonical or relaxed form, and replaces each
+// value with its BSON value, e.g. {"$numberLong": "5"} with int64(5).
+func ConvertCanonicalExtJSONDocumentToBSON(doc map[string]interface{}) error {
+	for key, jsonValue := range doc {
+		bsonValue, err := ConvertCanonicalExtJSONValueToBSON(jsonValue)
+		if err != nil {
+			return fmt.Errorf("error converting field '%v': %v", key, err)
+		}
+		doc[key] = bsonValue
+	}
+	return nil
+}
+
+// ConvertCanonicalExtJSONValueToBSON converts a value decoded from Extended
+// JSON v2, in canonical or relaxed form, to its BSON value. Documents may be
+// a map[string]interface{} or a bson.D, and are converted in place, as are
+// arrays. Numbers decoded as json.Number keep the distinction between
+// integers and doubles; float64 numbers stay doubles.
+// Unlike bson.UnmarshalExtJSON, it accepts any value, not just documents,
+// and it also accepts the legacy $binary/$type and $regex/$options forms.
+func ConvertCanonicalExtJSONValueToBSON(x interface{}) (interface{}, error) {
+	switch v := x.(type) {
+	case nil, bool, string, int32, int64, float64:
+		return v, nil
+
+	case int:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return int32(v), nil
+		}
+		return int64(v), nil
+
+	case gojson.Number:
+		s := string(v)
+		if !strings.ContainsAny(s, ".eE") {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				if n >= math.MinInt32 && n <= math.MaxInt32 {
+					return int32(n), nil
+				}
+				return n, nil
+			}
+		}
+		return v.Float64()
+
+	case map[string]interface{}:
+		doc := make(bson.D, 0, len(v))
+		for key, value := range v {
+			doc = append(doc, bson.E{Key: key, Value: value})
+		}
+		if value, ok, err := parseExtJSONWrapper(doc); ok || err != nil {
+			return value, err
+		}
+		return v, ConvertCanonicalExtJSONDocumentToBSON(v)
+
+	case bson.D:
+		if value, ok, err := parseExtJSONWrapper(v); ok || err != nil {
+			return value, err
+		}
+		for i := range v {
+			value, err := ConvertCanonicalExtJSONValueToBSON(v[i].Value)
+			if err != nil {
+				return nil, fmt.Errorf("error converting field '%v': %v", v[i].Key, err)
+			}
+			v[i].Value = value
+		}
+		return v, nil
+
+	case []interface{}:
+		for i := range v {
+			value, err := ConvertCanonicalExtJSONValueToBSON(v[i])
+			if err != nil {
+				return nil, fmt.Errorf("error converting array element %v: %v", i, err)
+			}
+			v[i] = value
+		}
+		return v, nil
+
+	case bson.A:
+		_, err := ConvertCanonicalExtJSONValueToBSON([]interface{}(v))
+		return v, err
+	}
+	return nil, fmt.Errorf("conversion of JSON value '%v' of type '%T' not supported", x, x)
+}
+
+// parseExtJSONWrapper converts a document that is an Extended JSON type
+// wrapper, such as {"$oid": "..."}, to the value it wraps. It returns false
+// if the document is an ordinary document, including query operators and
+// DBRefs.
+func parseExtJSONWrapper(doc bson.D) (interface{}, bool, error) {
+	if len(doc) == 0 || len(doc) > 2 || !strings.HasPrefix(doc[0].Key, "$") {
+		return nil, false, nil
+	}
+	fields := make(map[string]interface{}, len(doc))
+	for _, elem := range doc {
+		fields[elem.Key] = elem.Value
+	}
+	has := func(keys ...string) bool {
+		if len(keys) != len(fields) {
+			return false
+		}
+		for _, key := range keys {
+			if _, ok := fields[key]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	var value interface{}
+	var err error
+	switch {
+	case has("$oid"):
+		var s string
+		if s, err = wrapperString(fields, "$oid"); err == nil {
+			value, err = primitive.ObjectIDFromHex(s)
+		}
+	case has("$symbol"):
+		var s string
+		s, err = wrapperString(fields, "$symbol")
+		value = primitive.Symbol(s)
+	case has("$numberInt"):
+		var s string
+		var n int64
+		if s, err = wrapperString(fields, "$numberInt"); err == nil {
+			n, err = strconv.ParseInt(s, 10, 32)
+			value = int32(n)
+		}
+	case has("$numberLong"):
+		var s string
+		if s, err = wrapperString(fields, "$numberLong"); err == nil {
+			value, err = strconv.ParseInt(s, 10, 64)
+		}
+	case has("$numberDouble"):
+		var s string
+		if s, err = wrapperString(fields, "$numberDouble"); err == nil {
+			value, err = parseExtJSONDouble(s)
+		}
+	case has("$numberDecimal"):
+		var s string
+		if s, err = wrapperString(fields, "$numberDecimal"); err == nil {
+			value, err = primitive.ParseDecimal128(s)
+		}
+	case has("$binary"):
+		value, err = parseExtJSONBinary(fields["$binary"])
+	case has("$binary", "$type"):
+		value, err = parseLegacyExtJSONBinary(fields["$binary"], fields["$type"])
+	case has("$uuid"):
+		var s string
+		if s, err = wrapperString(fields, "$uuid"); err == nil {
+			value, err = parseExtJSONUUID(s)
+		}
+	case has("$code"):
+		var s string
+		s, err = wrapperString(fields, "$code")
+		value = primitive.JavaScript(s)
+	case has("$code", "$scope"):
+		var code string
+		if code, err = wrapperString(fields, "$code"); err == nil {
+			var scope interface{}
+			if scope, err = ConvertCanonicalExtJSONValueToBSON(fields["$scope"]); err == nil {
+				value = primitive.CodeWithScope{Code: primitive.JavaScript(code), Scope: scope}
+			}
+		}
+	case has("$timestamp"):
+		var t, i uint32
+		var sub map[string]interface{}
+		if sub, err = wrapperDocument(fields["$timestamp"], "t", "i"); err == nil {
+			if t, err = wrapperUint32(sub["t"]); err == nil {
+				i, err = wrapperUint32(sub["i"])
+			}
+		}
+		value = primitive.Timestamp{T: t, I: i}
+	case has("$regularExpression"):
+		var sub map[string]interface{}
+		if sub, err = wrapperDocument(fields["$regularExpression"], "pattern", "options"); err == nil {
+			value, err = parseExtJSONRegex(sub["pattern"], sub["options"])
+		}
+	case has("$regex", "$options"):
+		value, err = parseExtJSONRegex(fields["$regex"], fields["$options"])
+	case has("$dbPointer"):
+		value, err = parseExtJSONDBPointer(fields["$dbPointer"])
+	case has("$date"):
+		value, err = parseExtJSONDate(fields["$date"])
+	case has("$minKey"):
+		value = primitive.MinKey{}
+	case has("$maxKey"):
+		value = primitive.MaxKey{}
+	case has("$undefined"):
+		value = primitive.Undefined{}
+	default:
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, true, fmt.Errorf("invalid %v: %v", doc[0].Key, err)
+	}
+	return value, true, nil
+}
+
+func wrapperString(fields map[string]interface{}, key string) (string, error) {
+	s, ok := fields[key].(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string for %v, got %T", key, fields[key])
+	}
+	return s, nil
+}
+
+// wrapperDocument returns the fields of the document in a type wrapper,
+// which must have exactly the given keys.
+func wrapperDocument(x interface{}, keys ...string) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	switch v := x.(type) {
+	case map[string]interface{}:
+		fields = v
+	case bson.D:
+		for _, elem := range v {
+			fields[elem.Key] = elem.Value
+		}
+	default:
+		return nil, fmt.Errorf("expected a document, got %T", x)
+	}
+	if len(fields) != len(keys) {
+		return nil, fmt.Errorf("expected a document with the fields %v", strings.Join(keys, ", "))
+	}
+	for _, key := range keys {
+		if _, ok := fields[key]; !ok {
+			return nil, fmt.Errorf("expected a document with the fields %v", strings.Join(keys, ", "))
+		}
+	}
+	return fields, nil
+}
+
+func wrapperUint32(x interface{}) (uint32, error) {
+	var n float64
+	switch v := x.(type) {
+	case float64:
+		n = v
+	case gojson.Number:
+		i, err := strconv.ParseUint(string(v), 10, 32)
+		return uint32(i), err
+	case int32:
+		n = float64(v)
+	case int64:
+		n = float64(v)
+	case int:
+		n = float64(v)
+	default:
+		return 0, fmt.Errorf("expected a number, got %T", x)
+	}
+	if n < 0 || n > math.MaxUint32 || n != math.Trunc(n) {
+		return 0, fmt.Errorf("%v is not an unsigned 32-bit integer", n)
+	}
+	return uint32(n), nil
+}
+
+func parseExtJSONDouble(s string) (float64, error) {
+	switch s {
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseExtJSONBinary(x interface{}) (primitive.Binary, error) {
+	fields, err := wrapperDocument(x, "base64", "subType")
+	if err != nil {
+		return primitive.Binary{}, err
+	}
+	data, ok := fields["base64"].(string)
+	if !ok {
+		return primitive.Binary{}, fmt.Errorf("expected a string for base64")
+	}
+	subtype, ok := fields["subType"].(string)
+	if !ok {
+		return primitive.Binary{}, fmt.Errorf("expected a string for subType")
+	}
+	return decodeBinary(data, subtype)
+}
+
+func parseLegacyExtJSONBinary(data, subtype interface{}) (primitive.Binary, error) {
+	dataString, ok := data.(string)
+	if !ok {
+		return primitive.Binary{}, fmt.Errorf("expected a string for $binary")
+	}
+	subtypeString, ok := subtype.(string)
+	if !ok {
+		return primitive.Binary{}, fmt.Errorf("expected a string for $type")
+	}
+	return decodeBinary(dataString, subtypeString)
+}
+
+func decodeBinary(data, subtype string) (primitive.Binary, error) {
+	if len(subtype) == 0 || len(subtype) > 2 {
+		return primitive.Binary{}, fmt.Errorf("subtype '%v' is not one or two hex digits", subtype)
+	}
+	st, err := strconv.ParseUint(subtype, 16, 8)
+	if err != nil {
+		return primitive.Binary{}, fmt.Errorf("invalid subtype '%v': %v", subtype, err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return primitive.Binary{}, err
+	}
+	return primitive.Binary{Subtype: byte(st), Data: decoded}, nil
+}
+
+func parseExtJSONUUID(s string) (primitive.Binary, error) {
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return primitive.Binary{}, fmt.Errorf("'%v' is not a UUID in the form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx", s)
+	}
+	data, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil {
+		return primitive.Binary{}, err
+	}
+	return primitive.Binary{Subtype: 0x04, Data: data}, nil
+}
+
+func parseExtJSONRegex(pattern, options interface{}) (primitive.Regex, error) {
+	p, ok := pattern.(string)
+	if !ok {
+		return primitive.Regex{}, fmt.Errorf("expected a string for the pattern")
+	}
+	o, ok := options.(string)
+	if !ok {
+		return primitive.Regex{}, fmt.Errorf("expected a string for the options")
+	}
+	return primitive.Regex{Pattern: p, Options: sortRegexOptions(o)}, nil
+}
+
+func parseExtJSONDBPointer(x interface{}) (primitive.DBPointer, error) {
+	fields, err := wrapperDocument(x, "$ref", "$id")
+	if err != nil {
+		return primitive.DBPointer{}, err
+	}
+	ns, ok := fields["$ref"].(string)
+	if !ok {
+		return primitive.DBPointer{}, fmt.Errorf("expected a string for $ref")
+	}
+	id, err := ConvertCanonicalExtJSONValueToBSON(fields["$id"])
+	if err != nil {
+		return primitive.DBPointer{}, err
+	}
+	oid, ok := id.(primitive.ObjectID)
+	if !ok {
+		return primitive.DBPointer{}, fmt.Errorf("expected an ObjectId for $id")
+	}
+	return primitive.DBPointer{DB: ns, Pointer: oid}, nil
+}
+
+// parseExtJSONDate accepts the canonical {"$numberLong": "<millis>"}, the
+// relaxed ISO-8601 string, and a number of milliseconds.
+func parseExtJSONDate(x interface{}) (primitive.DateTime, error) {
+	switch v := x.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return 0, err
+		}
+		return primitive.NewDateTimeFromTime(t), nil
+	case map[string]interface{}, bson.D:
+		value, err := ConvertCanonicalExtJSONValueToBSON(v)
+		if err != nil {
+			return 0, err
+		}
+		millis, ok := value.(int64)
+		if !ok {
+			return 0, fmt.Errorf("expected {\"$numberLong\": \"<millis>\"}")
+		}
+		return primitive.DateTime(millis), nil
+	case float64:
+		return primitive.DateTime(int64(v)), nil
+	case gojson.Number:
+		millis, err := v.Int64()
+		return primitive.DateTime(millis), err
+	case int64:
+		return primitive.DateTime(v), nil
+	case int32:
+		return primitive.DateTime(v), nil
+	case int:
+		return primitive.DateTime(v), nil
+	}
+	return 0, fmt.Errorf("unexpected value of type %T", x)
+}
+
+// sortRegexOptions puts regular expression options in alphabetical order, as
+// Extended JSON v2 requires.
+func sortRegexOptions(options string) string {
+	chars := strings.Split(options, "")
+	sort.Strings(chars)
+	return strings.Join(chars, "")
+}
+
+// ConvertBSONValueToCanonicalExtJSON converts a BSON value to its canonical
+// Extended JSON v2 form, such as {"$numberLong": "5"} for int64(5), which
+// marshals to JSON with the json package. Documents become MarshalD, so
+// that they keep their order, or maps, and arrays become []interface{}.
+// It does not mutate its argument.
+func ConvertBSONValueToCanonicalExtJSON(x interface{}) (interface{}, error) {
+	wrap := func(key string, value interface{}) MarshalD {
+		return MarshalD{{Key: key, Value: value}}
+	}
+	switch v := x.(type) {
+	case nil, primitive.Null:
+		return nil, nil
+	case bool, string:
+		return v, nil
+
+	case bson.D:
+		out := make(MarshalD, 0, len(v))
+		for _, elem := range v {
+			value, err := ConvertBSONValueToCanonicalExtJSON(elem.Value)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, bson.E{Key: elem.Key, Value: value})
+		}
+		return out, nil
+	case MarshalD:
+		return ConvertBSONValueToCanonicalExtJSON(bson.D(v))
+	case bson.Raw:
+		var doc bson.D
+		if err := bson.Unmarshal(v, &doc); err != nil {
+			return nil, err
+		}
+		return ConvertBSONValueToCanonicalExtJSON(doc)
+	case bson.M:
+		return ConvertBSONValueToCanonicalExtJSON(map[string]interface{}(v))
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			converted, err := ConvertBSONValueToCanonicalExtJSON(value)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = converted
+		}
+		return out, nil
+	case bson.A:
+		return ConvertBSONValueToCanonicalExtJSON([]interface{}(v))
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			converted, err := ConvertBSONValueToCanonicalExtJSON(value)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = converted
+		}
+		return out, nil
+
+	case int:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return wrap("$numberInt", strconv.Itoa(v)), nil
+		}
+		return wrap("$numberLong", strconv.Itoa(v)), nil
+	case int32:
+		return wrap("$numberInt", strconv.FormatInt(int64(v), 10)), nil
+	case int64:
+		return wrap("$numberLong", strconv.FormatInt(v, 10)), nil
+	case float64:
+		return wrap("$numberDouble", formatExtJSONDouble(v)), nil
+	case float32:
+		return wrap("$numberDouble", formatExtJSONDouble(float64(v))), nil
+	case primitive.Decimal128:
+		return wrap("$numberDecimal", v.String()), nil
+
+	case primitive.ObjectID:
+		return wrap("$oid", v.Hex()), nil
+	case primitive.Symbol:
+		return wrap("$symbol", string(v)), nil
+	case primitive.DateTime:
+		return wrap("$date", wrap("$numberLong", strconv.FormatInt(int64(v), 10))), nil
+	case time.Time:
+		return ConvertBSONValueToCanonicalExtJSON(primitive.NewDateTimeFromTime(v))
+	case []byte:
+		return ConvertBSONValueToCanonicalExtJSON(primitive.Binary{Data: v})
+	case primitive.Binary:
+		return wrap("$binary", MarshalD{
+			{Key: "base64", Value: base64.StdEncoding.EncodeToString(v.Data)},
+			{Key: "subType", Value: fmt.Sprintf("%02x", v.Subtype)},
+		}), nil
+	case primitive.Regex:
+		return wrap("$regularExpression", MarshalD{
+			{Key: "pattern", Value: v.Pattern},
+			{Key: "options", Value: sortRegexOptions(v.Options)},
+		}), nil
+	case primitive.DBPointer:
+		return wrap("$dbPointer", MarshalD{
+			{Key: "$ref", Value: v.DB},
+			{Key: "$id", Value: wrap("$oid", v.Pointer.Hex())},
+		}), nil
+	case primitive.Timestamp:
+		return wrap("$timestamp", MarshalD{{Key: "t", Value: v.T}, {Key: "i", Value: v.I}}), nil
+	case primitive.JavaScript:
+		return wrap("$code", string(v)), nil
+	case primitive.CodeWithScope:
+		scope, err := ConvertBSONValueToCanonicalExtJSON(v.Scope)
+		if err != nil {
+			return nil, err
+		}
+		return MarshalD{{Key: "$code", Value: string(v.Code)}, {Key: "$scope", Value: scope}}, nil
+	case primitive.MinKey:
+		return wrap("$minKey", 1), nil
+	case primitive.MaxKey:
+		return wrap("$maxKey", 1), nil
+	case primitive.Undefined:
+		return wrap("$undefined", true), nil
+	}
+	return nil, fmt.Errorf("conversion of BSON value '%v' of type '%T' not supported", x, x)
+}
+
+// formatExtJSONDouble formats a double as in canonical Extended JSON, in the
+// same way as the driver.
+func formatExtJSONDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	s := strconv.FormatFloat(f, 'G', -1, 64)
+	if !strings.ContainsAny(s, "E.") {
+		s += ".0"
+	}
+	return s
+}
@@ -0,0 +1,142 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	gojson "encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/json"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func decodeJSON(s string) map[string]interface{} {
+	decoder := gojson.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	doc := map[string]interface{}{}
+	So(decoder.Decode(&doc), ShouldBeNil)
+	return doc
+}
+
+func TestBSONToCanonicalExtJSON(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Converting BSON to canonical Extended JSON", t, func() {
+		oid := primitive.NewObjectID()
+		decimal, _ := primitive.ParseDecimal128("1.5")
+		doc := bson.D{
+			{Key: "int", Value: int32(1)},
+			{Key: "long", Value: int64(1) << 40},
+			{Key: "double", Value: 2.0},
+			{Key: "inf", Value: math.Inf(-1)},
+			{Key: "nan", Value: math.NaN()},
+			{Key: "decimal", Value: decimal},
+			{Key: "oid", Value: oid},
+			{Key: "date", Value: primitive.DateTime(1234567890123)},
+			{Key: "binary", Value: primitive.Binary{Subtype: 4, Data: []byte("0123456789abcdef")}},
+			{Key: "regex", Value: primitive.Regex{Pattern: "^a", Options: "mi"}},
+			{Key: "pointer", Value: primitive.DBPointer{DB: "test.foo", Pointer: oid}},
+			{Key: "ts", Value: primitive.Timestamp{T: 1, I: 2}},
+			{Key: "code", Value: primitive.CodeWithScope{Code: "f()", Scope: bson.D{{Key: "x", Value: int32(1)}}}},
+			{Key: "symbol", Value: primitive.Symbol("s")},
+			{Key: "keys", Value: bson.A{primitive.MinKey{}, primitive.MaxKey{}, primitive.Undefined{}, nil}},
+			{Key: "nested", Value: bson.D{{Key: "b", Value: true}, {Key: "s", Value: "str"}}},
+		}
+
+		Convey("should produce the same JSON as the driver", func() {
+			converted, err := ConvertBSONValueToCanonicalExtJSON(doc)
+			So(err, ShouldBeNil)
+			out, err := json.Marshal(converted)
+			So(err, ShouldBeNil)
+			expected, err := bson.MarshalExtJSON(doc, true, false)
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, string(expected))
+		})
+
+		Convey("should not modify its argument", func() {
+			_, err := ConvertBSONValueToCanonicalExtJSON(doc)
+			So(err, ShouldBeNil)
+			So(doc[0].Value, ShouldEqual, int32(1))
+		})
+
+		Convey("should round trip through the reverse conversion", func() {
+			converted, err := ConvertBSONValueToCanonicalExtJSON(doc)
+			So(err, ShouldBeNil)
+			out, err := json.Marshal(converted)
+			So(err, ShouldBeNil)
+			parsed := decodeJSON(string(out))
+			So(ConvertCanonicalExtJSONDocumentToBSON(parsed), ShouldBeNil)
+			So(parsed["long"], ShouldEqual, int64(1)<<40)
+			So(math.IsNaN(parsed["nan"].(float64)), ShouldBeTrue)
+			So(parsed["oid"], ShouldEqual, oid)
+			So(parsed["date"], ShouldEqual, primitive.DateTime(1234567890123))
+			So(parsed["regex"], ShouldResemble, primitive.Regex{Pattern: "^a", Options: "im"})
+			So(parsed["code"], ShouldResemble, primitive.CodeWithScope{
+				Code: "f()", Scope: map[string]interface{}{"x": int32(1)}})
+			So(parsed["keys"], ShouldResemble, []interface{}{primitive.MinKey{}, primitive.MaxKey{}, primitive.Undefined{}, nil})
+		})
+	})
+}
+
+func TestCanonicalExtJSONToBSON(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Converting Extended JSON v2 to BSON", t, func() {
+		Convey("should accept canonical and relaxed values", func() {
+			doc := decodeJSON(`{
+				"int": 5, "bigInt": 5000000000, "double": 5.0,
+				"inf": {"$numberDouble": "Infinity"},
+				"uuid": {"$uuid": "00112233-4455-6677-8899-aabbccddeeff"},
+				"date": {"$date": "2021-01-02T03:04:05.678Z"},
+				"legacyBinary": {"$binary": "AQI=", "$type": "80"},
+				"legacyRegex": {"$regex": "x", "$options": "si"},
+				"query": {"$gt": {"$numberLong": "7"}},
+				"ref": {"$ref": "coll", "$id": {"$oid": "5f0000000000000000000000"}}
+			}`)
+			So(ConvertCanonicalExtJSONDocumentToBSON(doc), ShouldBeNil)
+			So(doc["int"], ShouldEqual, int32(5))
+			So(doc["bigInt"], ShouldEqual, int64(5000000000))
+			So(doc["double"], ShouldEqual, 5.0)
+			So(math.IsInf(doc["inf"].(float64), 1), ShouldBeTrue)
+			So(doc["uuid"], ShouldResemble, primitive.Binary{
+				Subtype: 4,
+				Data:    []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+			})
+			So(doc["date"], ShouldEqual, primitive.NewDateTimeFromTime(
+				time.Date(2021, 1, 2, 3, 4, 5, 678e6, time.UTC)))
+			So(doc["legacyBinary"], ShouldResemble, primitive.Binary{Subtype: 0x80, Data: []byte{1, 2}})
+			So(doc["legacyRegex"], ShouldResemble, primitive.Regex{Pattern: "x", Options: "is"})
+			So(doc["query"], ShouldResemble, map[string]interface{}{"$gt": int64(7)})
+			oid, _ := primitive.ObjectIDFromHex("5f0000000000000000000000")
+			So(doc["ref"], ShouldResemble, map[string]interface{}{"$ref": "coll", "$id": oid})
+		})
+
+		Convey("should accept values that aren't documents", func() {
+			value, err := ConvertCanonicalExtJSONValueToBSON(bson.D{{Key: "$numberDouble", Value: "-Infinity"}})
+			So(err, ShouldBeNil)
+			So(math.IsInf(value.(float64), -1), ShouldBeTrue)
+		})
+
+		Convey("should reject invalid type wrappers", func() {
+			for _, s := range []string{
+				`{"a": {"$numberInt": "5000000000"}}`,
+				`{"a": {"$oid": 5}}`,
+				`{"a": {"$uuid": "not-a-uuid"}}`,
+				`{"a": {"$binary": {"base64": "AQI=", "subType": "100"}}}`,
+				`{"a": {"$timestamp": {"t": -1, "i": 0}}}`,
+			} {
+				So(ConvertCanonicalExtJSONDocumentToBSON(decodeJSON(s)), ShouldNotBeNil)
+			}
+		})
+	})
+}
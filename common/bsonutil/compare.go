@@ -0,0 +1,178 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"bytes"
+	"math/big"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// canonicalTypeOrder gives the position of each BSON type in the server's
+// sort order. Types that share a position, such as the numeric types, are
+// compared by value.
+var canonicalTypeOrder = map[bsontype.Type]int{
+	bsontype.MinKey:           1,
+	bsontype.Undefined:        2,
+	bsontype.Null:             2,
+	bsontype.Int32:            3,
+	bsontype.Int64:            3,
+	bsontype.Double:           3,
+	bsontype.Decimal128:       3,
+	bsontype.String:           4,
+	bsontype.Symbol:           4,
+	bsontype.EmbeddedDocument: 5,
+	bsontype.Array:            6,
+	bsontype.Binary:           7,
+	bsontype.ObjectID:         8,
+	bsontype.Boolean:          9,
+	bsontype.DateTime:         10,
+	bsontype.Timestamp:        11,
+	bsontype.Regex:            12,
+	bsontype.DBPointer:        13,
+	bsontype.JavaScript:       14,
+	bsontype.CodeWithScope:    15,
+	bsontype.MaxKey:           16,
+}
+
+// CompareValues compares two BSON values following the server's sort order,
+// returning -1, 0 or 1.
+func CompareValues(a, b bson.RawValue) int {
+	orderA, orderB := canonicalTypeOrder[a.Type], canonicalTypeOrder[b.Type]
+	if orderA != orderB {
+		return compareInts(int64(orderA), int64(orderB))
+	}
+	switch orderA {
+	case 1, 2, 16:
+		return 0
+	case 3:
+		return numberOf(a).Cmp(numberOf(b))
+	case 4:
+		return bytes.Compare([]byte(stringOf(a)), []byte(stringOf(b)))
+	case 5:
+		return compareDocuments(a.Document(), b.Document())
+	case 6:
+		return compareDocuments(a.Array(), b.Array())
+	case 7:
+		return compareBinaries(a, b)
+	case 9:
+		return compareInts(boolInt(a.Boolean()), boolInt(b.Boolean()))
+	case 10:
+		return compareInts(a.DateTime(), b.DateTime())
+	case 11:
+		tA, iA := a.Timestamp()
+		tB, iB := b.Timestamp()
+		if tA != tB {
+			return compareInts(int64(tA), int64(tB))
+		}
+		return compareInts(int64(iA), int64(iB))
+	case 13:
+		// the server compares DBPointers by size before their bytes
+		if c := compareInts(int64(len(a.Value)), int64(len(b.Value))); c != 0 {
+			return c
+		}
+	case 14:
+		return bytes.Compare([]byte(a.JavaScript()), []byte(b.JavaScript()))
+	case 15:
+		codeA, scopeA := a.CodeWithScope()
+		codeB, scopeB := b.CodeWithScope()
+		if c := bytes.Compare([]byte(codeA), []byte(codeB)); c != 0 {
+			return c
+		}
+		return compareDocuments(scopeA, scopeB)
+	}
+	// ObjectIDs and regular expressions sort by their encoded bytes
+	return bytes.Compare(a.Value, b.Value)
+}
+
+// compareDocuments compares documents, or arrays, element by element: first
+// by the sort order of their values' types, then by their field names, and
+// then by their values. A document that is a prefix of another sorts first.
+func compareDocuments(a, b bson.Raw) int {
+	elemsA, _ := a.Elements()
+	elemsB, _ := b.Elements()
+	for i := 0; i < len(elemsA) && i < len(elemsB); i++ {
+		valueA, valueB := elemsA[i].Value(), elemsB[i].Value()
+		orderA, orderB := canonicalTypeOrder[valueA.Type], canonicalTypeOrder[valueB.Type]
+		if orderA != orderB {
+			return compareInts(int64(orderA), int64(orderB))
+		}
+		if c := bytes.Compare([]byte(elemsA[i].Key()), []byte(elemsB[i].Key())); c != 0 {
+			return c
+		}
+		if c := CompareValues(valueA, valueB); c != 0 {
+			return c
+		}
+	}
+	return compareInts(int64(len(elemsA)), int64(len(elemsB)))
+}
+
+// compareBinaries compares binary data by length, then subtype, then bytes.
+func compareBinaries(a, b bson.RawValue) int {
+	subtypeA, dataA := a.Binary()
+	subtypeB, dataB := b.Binary()
+	if c := compareInts(int64(len(dataA)), int64(len(dataB))); c != 0 {
+		return c
+	}
+	if c := compareInts(int64(subtypeA), int64(subtypeB)); c != 0 {
+		return c
+	}
+	return bytes.Compare(dataA, dataB)
+}
+
+// SameTypeBracket reports whether two BSON values share a position in the
+// server's sort order, which is when query comparisons such as $gt match.
+func SameTypeBracket(a, b bson.RawValue) bool {
+	return canonicalTypeOrder[a.Type] == canonicalTypeOrder[b.Type]
+}
+
+func numberOf(v bson.RawValue) *big.Float {
+	switch v.Type {
+	case bsontype.Int32:
+		return new(big.Float).SetInt64(int64(v.Int32()))
+	case bsontype.Int64:
+		return new(big.Float).SetInt64(v.Int64())
+	case bsontype.Decimal128:
+		f, _, err := big.ParseFloat(v.Decimal128().String(), 10, 113, big.ToNearestEven)
+		if err == nil {
+			return f
+		}
+		return new(big.Float)
+	default:
+		f := v.Double()
+		if f != f { // NaN sorts before all other numbers
+			return big.NewFloat(0).SetInf(true)
+		}
+		return big.NewFloat(f)
+	}
+}
+
+func stringOf(v bson.RawValue) string {
+	if v.Type == bsontype.Symbol {
+		return v.Symbol()
+	}
+	return v.StringValue()
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
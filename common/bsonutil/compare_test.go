@@ -0,0 +1,77 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func rawValue(v interface{}) bson.RawValue {
+	t, data, err := bson.MarshalValue(v)
+	if err != nil {
+		panic(err)
+	}
+	return bson.RawValue{Type: t, Value: data}
+}
+
+func TestCompareValues(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When comparing BSON values", t, func() {
+		Convey("numbers of different types are compared by value", func() {
+			So(CompareValues(rawValue(int32(5)), rawValue(int64(5))), ShouldEqual, 0)
+			So(CompareValues(rawValue(int32(5)), rawValue(5.5)), ShouldEqual, -1)
+			So(CompareValues(rawValue(int64(7)), rawValue(6.9)), ShouldEqual, 1)
+		})
+
+		Convey("values of different types follow the server's type order", func() {
+			So(CompareValues(rawValue(primitive.MinKey{}), rawValue(int32(1))), ShouldEqual, -1)
+			So(CompareValues(rawValue(int64(100)), rawValue("1")), ShouldEqual, -1)
+			So(CompareValues(rawValue("z"), rawValue(primitive.NewObjectID())), ShouldEqual, -1)
+			So(CompareValues(rawValue(primitive.MaxKey{}), rawValue(true)), ShouldEqual, 1)
+		})
+
+		Convey("strings and object ids are compared by their bytes", func() {
+			So(CompareValues(rawValue("abc"), rawValue("abd")), ShouldEqual, -1)
+			So(CompareValues(rawValue("b"), rawValue("abc")), ShouldEqual, 1)
+			first := primitive.NewObjectID()
+			second := first
+			second[11]++
+			So(CompareValues(rawValue(first), rawValue(second)), ShouldEqual, -1)
+			So(CompareValues(rawValue(first), rawValue(first)), ShouldEqual, 0)
+		})
+
+		Convey("documents are compared field by field", func() {
+			So(CompareValues(rawValue(bson.D{{"a", 256}}), rawValue(bson.D{{"a", 2}})), ShouldEqual, 1)
+			So(CompareValues(rawValue(bson.D{{"a", 1}, {"b", 1}}), rawValue(bson.D{{"b", 0}})), ShouldEqual, -1)
+			So(CompareValues(rawValue(bson.D{{"a", 1}}), rawValue(bson.D{{"a", 1}, {"b", 1}})), ShouldEqual, -1)
+			So(CompareValues(rawValue(bson.D{{"a", "x"}}), rawValue(bson.D{{"a", 5}})), ShouldEqual, 1)
+			So(CompareValues(rawValue(bson.D{{"a", int32(5)}}), rawValue(bson.D{{"a", 5.0}})), ShouldEqual, 0)
+		})
+
+		Convey("arrays are compared element by element", func() {
+			So(CompareValues(rawValue(bson.A{256}), rawValue(bson.A{2})), ShouldEqual, 1)
+			So(CompareValues(rawValue(bson.A{1}), rawValue(bson.A{"a"})), ShouldEqual, -1)
+			So(CompareValues(rawValue(bson.A{1, 2}), rawValue(bson.A{1})), ShouldEqual, 1)
+		})
+
+		Convey("binary data is compared by length, then subtype, then bytes", func() {
+			long := primitive.Binary{Data: make([]byte, 256)}
+			short := primitive.Binary{Data: []byte{0xff, 0xff}}
+			So(CompareValues(rawValue(long), rawValue(short)), ShouldEqual, 1)
+			So(CompareValues(rawValue(primitive.Binary{Subtype: 4, Data: []byte{1}}),
+				rawValue(primitive.Binary{Data: []byte{2}})), ShouldEqual, 1)
+			So(CompareValues(rawValue(primitive.Binary{Data: []byte{1}}),
+				rawValue(primitive.Binary{Data: []byte{2}})), ShouldEqual, -1)
+		})
+	})
+}
@@ -0,0 +1,248 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// DocPredicate reports whether a document matches a query.
+type DocPredicate func(doc bson.Raw) bool
+
+// ParseDocFilter parses a query given as Extended JSON, so that tools can
+// match documents without a server.
+func ParseDocFilter(query string) (DocPredicate, error) {
+	var filter bson.D
+	if err := bson.UnmarshalExtJSON([]byte(query), false, &filter); err != nil {
+		return nil, fmt.Errorf("error parsing query as Extended JSON: %v", err)
+	}
+	return CompileDocFilter(filter)
+}
+
+// CompileDocFilter compiles a query document. It supports the subset of the
+// query language that can be evaluated against a single document: equality,
+// the comparison operators, $in, $nin, $exists, $and, $or and $nor.
+func CompileDocFilter(filter bson.D) (DocPredicate, error) {
+	var clauses []DocPredicate
+	for _, elem := range filter {
+		var clause DocPredicate
+		var err error
+		switch {
+		case elem.Key == "$and" || elem.Key == "$or" || elem.Key == "$nor":
+			clause, err = compileLogical(elem.Key, elem.Value)
+		case strings.HasPrefix(elem.Key, "$"):
+			err = fmt.Errorf("unsupported operator %v", elem.Key)
+		default:
+			clause, err = compileField(strings.Split(elem.Key, "."), elem.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	return allOf(clauses), nil
+}
+
+// allOf matches the documents that every clause matches.
+func allOf(clauses []DocPredicate) DocPredicate {
+	return func(doc bson.Raw) bool {
+		for _, clause := range clauses {
+			if !clause(doc) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func compileLogical(op string, value interface{}) (DocPredicate, error) {
+	filters, ok := value.(bson.A)
+	if !ok || len(filters) == 0 {
+		return nil, fmt.Errorf("%v must be a non-empty array", op)
+	}
+	var clauses []DocPredicate
+	for _, filter := range filters {
+		doc, ok := filter.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("%v must be an array of documents", op)
+		}
+		clause, err := CompileDocFilter(doc)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	if op == "$and" {
+		return allOf(clauses), nil
+	}
+	return func(doc bson.Raw) bool {
+		for _, clause := range clauses {
+			if clause(doc) {
+				return op == "$or"
+			}
+		}
+		return op == "$nor"
+	}, nil
+}
+
+func compileField(path []string, value interface{}) (DocPredicate, error) {
+	ops, ok := value.(bson.D)
+	if !ok || len(ops) == 0 || !strings.HasPrefix(ops[0].Key, "$") {
+		return compileComparison(path, "$eq", value)
+	}
+	var clauses []DocPredicate
+	for _, op := range ops {
+		clause, err := compileComparison(path, op.Key, op.Value)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	return allOf(clauses), nil
+}
+
+func compileComparison(path []string, op string, value interface{}) (DocPredicate, error) {
+	switch op {
+	case "$exists":
+		want, err := truthy(value)
+		if err != nil {
+			return nil, fmt.Errorf("$exists: %v", err)
+		}
+		return func(doc bson.Raw) bool {
+			return (len(lookupPath(doc, path)) > 0) == want
+		}, nil
+	case "$in", "$nin":
+		list, ok := value.(bson.A)
+		if !ok {
+			return nil, fmt.Errorf("%v needs an array", op)
+		}
+		var wanted []bson.RawValue
+		for _, v := range list {
+			raw, err := toRawValue(v)
+			if err != nil {
+				return nil, err
+			}
+			wanted = append(wanted, raw)
+		}
+		return func(doc bson.Raw) bool {
+			values := lookupPath(doc, path)
+			for _, want := range wanted {
+				if equalsAny(values, want) {
+					return op == "$in"
+				}
+			}
+			return op == "$nin"
+		}, nil
+	}
+
+	want, err := toRawValue(value)
+	if err != nil {
+		return nil, err
+	}
+	var accept func(cmp int) bool
+	switch op {
+	case "$eq", "$ne":
+		return func(doc bson.Raw) bool {
+			return equalsAny(lookupPath(doc, path), want) == (op == "$eq")
+		}, nil
+	case "$gt":
+		accept = func(cmp int) bool { return cmp > 0 }
+	case "$gte":
+		accept = func(cmp int) bool { return cmp >= 0 }
+	case "$lt":
+		accept = func(cmp int) bool { return cmp < 0 }
+	case "$lte":
+		accept = func(cmp int) bool { return cmp <= 0 }
+	default:
+		return nil, fmt.Errorf("unsupported operator %v", op)
+	}
+	return func(doc bson.Raw) bool {
+		for _, v := range lookupPath(doc, path) {
+			if SameTypeBracket(v, want) && accept(CompareValues(v, want)) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// equalsAny reports whether any of the values at a path equals want. A null
+// matches a missing field.
+func equalsAny(values []bson.RawValue, want bson.RawValue) bool {
+	if want.Type == bsontype.Null && len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if SameTypeBracket(v, want) && CompareValues(v, want) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupPath returns the values at a dotted path, descending into the
+// documents of arrays on the way. An array at the end of the path yields
+// itself and each of its elements, as in a server query.
+func lookupPath(doc bson.Raw, path []string) []bson.RawValue {
+	value, err := doc.LookupErr(path[0])
+	if err != nil {
+		return nil
+	}
+	if len(path) == 1 {
+		values := []bson.RawValue{value}
+		if array, ok := value.ArrayOK(); ok {
+			elems, _ := array.Values()
+			values = append(values, elems...)
+		}
+		return values
+	}
+
+	switch value.Type {
+	case bsontype.EmbeddedDocument:
+		return lookupPath(value.Document(), path[1:])
+	case bsontype.Array:
+		// an array is also a document keyed by index, for paths like a.0.b
+		values := lookupPath(bson.Raw(value.Array()), path[1:])
+		elems, _ := value.Array().Values()
+		for _, elem := range elems {
+			if sub, ok := elem.DocumentOK(); ok {
+				values = append(values, lookupPath(sub, path[1:])...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func toRawValue(v interface{}) (bson.RawValue, error) {
+	if v == nil {
+		return bson.RawValue{Type: bsontype.Null}, nil
+	}
+	t, data, err := bson.MarshalValue(v)
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+	return bson.RawValue{Type: t, Value: data}, nil
+}
+
+func truthy(v interface{}) (bool, error) {
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case int32:
+		return v != 0, nil
+	case int64:
+		return v != 0, nil
+	case float64:
+		return v != 0, nil
+	}
+	return false, fmt.Errorf("expected a boolean, got %v", v)
+}
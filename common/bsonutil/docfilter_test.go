@@ -0,0 +1,69 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDocFilter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	doc, err := bson.Marshal(bson.M{
+		"_id":        1,
+		"customerId": int64(1234),
+		"name":       "ada",
+		"tags":       bson.A{"a", "b"},
+		"orders":     bson.A{bson.M{"sku": "x", "qty": 2}, bson.M{"sku": "y", "qty": 5}},
+		"address":    bson.M{"city": "Dublin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches := func(query string) bool {
+		match, err := ParseDocFilter(query)
+		So(err, ShouldBeNil)
+		return match(doc)
+	}
+
+	Convey("Equality matches numbers of any type, nested fields and array elements", t, func() {
+		So(matches(`{"customerId": 1234}`), ShouldBeTrue)
+		So(matches(`{"customerId": 1235}`), ShouldBeFalse)
+		So(matches(`{"address.city": "Dublin"}`), ShouldBeTrue)
+		So(matches(`{"tags": "b"}`), ShouldBeTrue)
+		So(matches(`{"orders.sku": "y"}`), ShouldBeTrue)
+		So(matches(`{"orders.1.qty": 5}`), ShouldBeTrue)
+		So(matches(`{"missing": null}`), ShouldBeTrue)
+	})
+
+	Convey("Comparisons only match values of the same type", t, func() {
+		So(matches(`{"customerId": {"$gte": 1000, "$lt": 2000}}`), ShouldBeTrue)
+		So(matches(`{"orders.qty": {"$gt": 4}}`), ShouldBeTrue)
+		So(matches(`{"name": {"$gt": 5}}`), ShouldBeFalse)
+		So(matches(`{"name": {"$in": ["bob", "ada"]}}`), ShouldBeTrue)
+		So(matches(`{"name": {"$nin": ["ada"]}}`), ShouldBeFalse)
+		So(matches(`{"name": {"$ne": "bob"}, "missing": {"$exists": false}}`), ShouldBeTrue)
+	})
+
+	Convey("Logical operators combine clauses", t, func() {
+		So(matches(`{"$or": [{"name": "bob"}, {"customerId": 1234}]}`), ShouldBeTrue)
+		So(matches(`{"$nor": [{"name": "bob"}, {"customerId": 1234}]}`), ShouldBeFalse)
+		So(matches(`{"$and": [{"name": "ada"}, {"tags": "c"}]}`), ShouldBeFalse)
+	})
+
+	Convey("Unsupported queries are rejected", t, func() {
+		for _, query := range []string{`{"$where": "true"}`, `{"name": {"$regex": "a"}}`, `{"$or": []}`, `not json`} {
+			_, err := ParseDocFilter(query)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
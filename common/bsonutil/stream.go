@@ -0,0 +1,207 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	gojson "encoding/json"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+)
+
+// StreamFormat is the format of the documents in a stream converted by
+// ConvertStream.
+type StreamFormat int
+
+const (
+	// BSONStream is a sequence of BSON documents, as in a .bson file.
+	BSONStream StreamFormat = iota
+	// CanonicalExtJSONStream is a sequence of Extended JSON v2 documents,
+	// written in canonical form.
+	CanonicalExtJSONStream
+	// RelaxedExtJSONStream is a sequence of Extended JSON v2 documents,
+	// written in relaxed form.
+	RelaxedExtJSONStream
+)
+
+// maxStreamDocumentSize is the largest BSON document accepted in a stream,
+// the maximum size of a document stored on a server plus room for the
+// overhead of commands.
+const maxStreamDocumentSize = 16*1024*1024 + 16*1024
+
+func (f StreamFormat) isExtJSON() bool {
+	return f == CanonicalExtJSONStream || f == RelaxedExtJSONStream
+}
+
+// ConvertStream reads documents in one format from in and writes them in
+// another to out. Each document is converted a value at a time, by copying
+// from a value reader to a value writer, so no intermediate tree of maps or
+// bson.D is built, and the buffers are reused from one document to the next.
+// Extended JSON input may be in canonical or relaxed form, either as a
+// sequence of documents or as a JSON array of documents, which is read an
+// element at a time. Extended JSON output has one document per line.
+// It returns the number of documents converted.
+func ConvertStream(in io.Reader, out io.Writer, from, to StreamFormat) (int64, error) {
+	var next func() (bsonrw.ValueReader, error)
+	if from.isExtJSON() {
+		next = extJSONDocuments(in)
+	} else {
+		next = bsonDocuments(in)
+	}
+
+	w := bufio.NewWriter(out)
+	converter := NewDocumentConverter(to)
+	var numConverted int64
+	for {
+		vr, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return numConverted, fmt.Errorf("error reading document %v: %v", numConverted+1, err)
+		}
+
+		doc, err := converter.Convert(vr)
+		if err != nil {
+			return numConverted, fmt.Errorf("error converting document %v: %v", numConverted+1, err)
+		}
+		if to.isExtJSON() {
+			doc = append(doc, '\n')
+		}
+		if _, err = w.Write(doc); err != nil {
+			return numConverted, err
+		}
+		numConverted++
+	}
+	return numConverted, w.Flush()
+}
+
+// DocumentConverter converts documents one at a time to a format, a value
+// at a time like ConvertStream, reusing its buffers from one document to the
+// next. mongoexport uses it to write documents straight from the BSON
+// returned by the server.
+type DocumentConverter struct {
+	to      StreamFormat
+	doc     []byte
+	jsonBuf bytes.Buffer
+}
+
+// NewDocumentConverter returns a DocumentConverter to the given format.
+func NewDocumentConverter(to StreamFormat) *DocumentConverter {
+	return &DocumentConverter{to: to}
+}
+
+// Convert reads a document from vr and returns it in the converter's
+// format. The result is only valid until the next call.
+func (c *DocumentConverter) Convert(vr bsonrw.ValueReader) ([]byte, error) {
+	if !c.to.isExtJSON() {
+		var err error
+		c.doc, err = bsonrw.Copier{}.AppendDocumentBytes(c.doc[:0], vr)
+		return c.doc, err
+	}
+	c.jsonBuf.Reset()
+	vw, err := bsonrw.NewExtJSONValueWriter(&c.jsonBuf, c.to == CanonicalExtJSONStream, false)
+	if err != nil {
+		return nil, err
+	}
+	if err = (bsonrw.Copier{}).CopyDocument(vw, vr); err != nil {
+		return nil, err
+	}
+	return c.jsonBuf.Bytes(), nil
+}
+
+// ConvertBSON converts a BSON document.
+func (c *DocumentConverter) ConvertBSON(doc []byte) ([]byte, error) {
+	return c.Convert(bsonrw.NewBSONDocumentReader(doc))
+}
+
+// bsonDocuments returns a function that reads the next BSON document from
+// in, reusing the same buffer for every document.
+func bsonDocuments(in io.Reader) func() (bsonrw.ValueReader, error) {
+	r := bufio.NewReader(in)
+	var buf []byte
+	return func() (bsonrw.ValueReader, error) {
+		var sizeBytes [4]byte
+		if _, err := io.ReadFull(r, sizeBytes[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("truncated document size")
+			}
+			return nil, err
+		}
+		size := int32(binary.LittleEndian.Uint32(sizeBytes[:]))
+		if size < 5 || size > maxStreamDocumentSize {
+			return nil, fmt.Errorf("invalid document size %v", size)
+		}
+		if cap(buf) < int(size) {
+			buf = make([]byte, size)
+		}
+		buf = buf[:size]
+		copy(buf, sizeBytes[:])
+		if _, err := io.ReadFull(r, buf[4:]); err != nil {
+			return nil, fmt.Errorf("truncated document: %v", err)
+		}
+		return bsonrw.NewBSONDocumentReader(buf), nil
+	}
+}
+
+// extJSONDocuments returns a function that reads the next Extended JSON
+// document from in. The raw JSON of one document is held at a time.
+func extJSONDocuments(in io.Reader) func() (bsonrw.ValueReader, error) {
+	r := bufio.NewReader(in)
+	var decoder *gojson.Decoder
+	inArray := false
+	var raw gojson.RawMessage
+	return func() (bsonrw.ValueReader, error) {
+		if decoder == nil {
+			first, err := firstNonSpace(r)
+			if err != nil {
+				return nil, err
+			}
+			decoder = gojson.NewDecoder(r)
+			if first == '[' {
+				if _, err = decoder.Token(); err != nil {
+					return nil, err
+				}
+				inArray = true
+			}
+		}
+		if inArray && !decoder.More() {
+			if _, err := decoder.Token(); err != nil {
+				return nil, err
+			}
+			inArray = false
+		}
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+		if len(raw) == 0 || raw[0] != '{' {
+			return nil, fmt.Errorf("expected a document, got %v", string(raw))
+		}
+		return bsonrw.NewExtJSONValueReader(bytes.NewReader(raw), false)
+	}
+}
+
+// firstNonSpace returns the first byte of the input that isn't whitespace,
+// without consuming it.
+func firstNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = r.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
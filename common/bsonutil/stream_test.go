@@ -0,0 +1,177 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func streamTestDocs(n int) []bson.D {
+	docs := make([]bson.D, n)
+	for i := range docs {
+		docs[i] = bson.D{
+			{Key: "_id", Value: int32(i)},
+			{Key: "long", Value: int64(i) << 33},
+			{Key: "date", Value: primitive.DateTime(1600000000000 + int64(i))},
+			{Key: "nested", Value: bson.D{{Key: "s", Value: fmt.Sprintf("doc %v", i)}, {Key: "a", Value: bson.A{1.5, true, nil}}}},
+		}
+	}
+	return docs
+}
+
+func bsonStream(docs []bson.D) []byte {
+	var buf bytes.Buffer
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		So(err, ShouldBeNil)
+		buf.Write(raw)
+	}
+	return buf.Bytes()
+}
+
+func TestConvertStream(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Converting a stream of documents", t, func() {
+		docs := streamTestDocs(3)
+		input := bsonStream(docs)
+
+		Convey("from BSON to Extended JSON should write one document per line", func() {
+			for _, format := range []StreamFormat{CanonicalExtJSONStream, RelaxedExtJSONStream} {
+				var out bytes.Buffer
+				n, err := ConvertStream(bytes.NewReader(input), &out, BSONStream, format)
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 3)
+				lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+				So(len(lines), ShouldEqual, 3)
+				for i, line := range lines {
+					expected, err := bson.MarshalExtJSON(docs[i], format == CanonicalExtJSONStream, false)
+					So(err, ShouldBeNil)
+					So(line, ShouldEqual, string(expected))
+				}
+			}
+		})
+
+		Convey("from canonical Extended JSON back to BSON should give the same bytes", func() {
+			var jsonOut, bsonOut bytes.Buffer
+			_, err := ConvertStream(bytes.NewReader(input), &jsonOut, BSONStream, CanonicalExtJSONStream)
+			So(err, ShouldBeNil)
+			n, err := ConvertStream(&jsonOut, &bsonOut, CanonicalExtJSONStream, BSONStream)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 3)
+			So(bsonOut.Bytes(), ShouldResemble, input)
+		})
+
+		Convey("should read a JSON array of documents", func() {
+			var out bytes.Buffer
+			in := ` [ {"a": {"$numberLong": "1"}}, {"a": 2.5} ] `
+			n, err := ConvertStream(strings.NewReader(in), &out, CanonicalExtJSONStream, CanonicalExtJSONStream)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(out.String(), ShouldEqual,
+				"{\"a\":{\"$numberLong\":\"1\"}}\n{\"a\":{\"$numberDouble\":\"2.5\"}}\n")
+		})
+
+		Convey("should report the document that can't be read", func() {
+			var out bytes.Buffer
+			in := `{"a": 1} {"a": {"$numberInt": "x"}}`
+			n, err := ConvertStream(strings.NewReader(in), &out, RelaxedExtJSONStream, BSONStream)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "document 2")
+			So(n, ShouldEqual, 1)
+
+			_, err = ConvertStream(bytes.NewReader(input[:len(input)-3]), &out, BSONStream, BSONStream)
+			So(err, ShouldNotBeNil)
+
+			_, err = ConvertStream(strings.NewReader(`[1, 2]`), &out, RelaxedExtJSONStream, BSONStream)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("of nothing should convert no documents", func() {
+			var out bytes.Buffer
+			n, err := ConvertStream(strings.NewReader(" \n"), &out, RelaxedExtJSONStream, BSONStream)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 0)
+		})
+	})
+}
+
+func BenchmarkConvertStream(b *testing.B) {
+	var input []byte
+	for _, doc := range streamTestDocs(1000) {
+		raw, _ := bson.Marshal(doc)
+		input = append(input, raw...)
+	}
+	var jsonInput bytes.Buffer
+	if _, err := ConvertStream(bytes.NewReader(input), &jsonInput, BSONStream, RelaxedExtJSONStream); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("ConvertStream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ConvertStream(bytes.NewReader(jsonInput.Bytes()), ioutil.Discard, RelaxedExtJSONStream, BSONStream); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("UnmarshalExtJSON", func(b *testing.B) {
+		b.ReportAllocs()
+		lines := bytes.Split(bytes.TrimSpace(jsonInput.Bytes()), []byte("\n"))
+		for i := 0; i < b.N; i++ {
+			for _, line := range lines {
+				var doc bson.D
+				if err := bson.UnmarshalExtJSON(line, false, &doc); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := bson.Marshal(doc); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("DocumentConverter", func(b *testing.B) {
+		b.ReportAllocs()
+		converter := NewDocumentConverter(RelaxedExtJSONStream)
+		for i := 0; i < b.N; i++ {
+			for doc := input; len(doc) > 0; {
+				raw := bson.Raw(doc[:binary.LittleEndian.Uint32(doc)])
+				if _, err := converter.ConvertBSON(raw); err != nil {
+					b.Fatal(err)
+				}
+				doc = doc[len(raw):]
+			}
+		}
+	})
+	b.Run("MarshalExtJSON", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for doc := input; len(doc) > 0; {
+				raw := bson.Raw(doc[:binary.LittleEndian.Uint32(doc)])
+				var d bson.D
+				if err := bson.Unmarshal(raw, &d); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := bson.MarshalExtJSON(d, false, false); err != nil {
+					b.Fatal(err)
+				}
+				doc = doc[len(raw):]
+			}
+		}
+	})
+}
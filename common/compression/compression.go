@@ -0,0 +1,108 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package compression detects and decompresses the compression formats that
+// dumps and archives may be written in.
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is a compression format.
+type Codec string
+
+// The supported codecs. None means the stream is not compressed.
+const (
+	None Codec = ""
+	Gzip Codec = "gzip"
+	Zstd Codec = "zstd"
+	LZ4  Codec = "lz4"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	lz4Magic  = []byte{0x04, 0x22, 0x4d, 0x18}
+)
+
+// extensions maps file name extensions to the codec they imply.
+var extensions = map[string]Codec{
+	".gz":  Gzip,
+	".zst": Zstd,
+	".lz4": LZ4,
+}
+
+// Detect returns the codec whose magic number starts header, or None. Four
+// bytes are enough to recognize every codec.
+func Detect(header []byte) Codec {
+	switch {
+	case bytes.HasPrefix(header, zstdMagic):
+		return Zstd
+	case bytes.HasPrefix(header, lz4Magic):
+		return LZ4
+	case bytes.HasPrefix(header, gzipMagic):
+		return Gzip
+	}
+	return None
+}
+
+// TrimExtension removes a compression extension from a file name, returning
+// the rest of the name and the codec the extension implies.
+func TrimExtension(name string) (string, Codec) {
+	for ext, codec := range extensions {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext), codec
+		}
+	}
+	return name, None
+}
+
+// NewCodecReader returns a reader that decompresses r with the given codec.
+// Closing it does not close r.
+func NewCodecReader(codec Codec, r io.Reader) (io.ReadCloser, error) {
+	switch codec {
+	case None:
+		return ioutil.NopCloser(r), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case LZ4:
+		return ioutil.NopCloser(NewLZ4Reader(r)), nil
+	}
+	return nil, fmt.Errorf("unknown compression %q", codec)
+}
+
+// NewReader detects the compression of r from its first bytes and returns a
+// reader of the decompressed stream, along with the codec it found. Streams
+// that are not compressed are passed through. Closing the reader does not
+// close r.
+func NewReader(r io.Reader) (io.ReadCloser, Codec, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, None, err
+	}
+	codec := Detect(header)
+	rc, err := NewCodecReader(codec, buffered)
+	if err != nil {
+		return nil, codec, fmt.Errorf("error reading %v stream: %v", codec, err)
+	}
+	return rc, codec, nil
+}
@@ -0,0 +1,163 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	"github.com/klauspost/compress/zstd"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testText = "mongorestore mongorestore mongorestore mongorestore\n"
+
+// testLZ4Frame is testText compressed by the lz4 command line tool; its
+// block repeats the first word with a match.
+var testLZ4Frame = []byte{
+	0x04, 0x22, 0x4d, 0x18, 0x64, 0x40, 0xa7, 0x17, 0x00, 0x00, 0x00, 0xdf,
+	0x6d, 0x6f, 0x6e, 0x67, 0x6f, 0x72, 0x65, 0x73, 0x74, 0x6f, 0x72, 0x65,
+	0x20, 0x0d, 0x00, 0x0f, 0x50, 0x74, 0x6f, 0x72, 0x65, 0x0a, 0x00, 0x00,
+	0x00, 0x00, 0x67, 0xdb, 0x6c, 0x4e,
+}
+
+func readAll(data []byte) (string, Codec, error) {
+	rc, codec, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", codec, err
+	}
+	defer rc.Close()
+	out, err := ioutil.ReadAll(rc)
+	return string(out), codec, err
+}
+
+func TestNewReader(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Uncompressed streams are passed through", t, func() {
+		out, codec, err := readAll([]byte(testText))
+		So(err, ShouldBeNil)
+		So(codec, ShouldEqual, None)
+		So(out, ShouldEqual, testText)
+
+		out, _, err = readAll(nil)
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, "")
+	})
+
+	Convey("gzip streams are detected", t, func() {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write([]byte(testText))
+		So(w.Close(), ShouldBeNil)
+		out, codec, err := readAll(buf.Bytes())
+		So(err, ShouldBeNil)
+		So(codec, ShouldEqual, Gzip)
+		So(out, ShouldEqual, testText)
+	})
+
+	Convey("zstd streams are detected", t, func() {
+		var buf bytes.Buffer
+		w, err := zstd.NewWriter(&buf)
+		So(err, ShouldBeNil)
+		_, _ = w.Write([]byte(testText))
+		So(w.Close(), ShouldBeNil)
+		out, codec, err := readAll(buf.Bytes())
+		So(err, ShouldBeNil)
+		So(codec, ShouldEqual, Zstd)
+		So(out, ShouldEqual, testText)
+	})
+
+	Convey("lz4 streams are detected", t, func() {
+		out, codec, err := readAll(testLZ4Frame)
+		So(err, ShouldBeNil)
+		So(codec, ShouldEqual, LZ4)
+		So(out, ShouldEqual, testText)
+
+		Convey("including concatenated and skippable frames", func() {
+			skippable := []byte{0x50, 0x2a, 0x4d, 0x18, 0x02, 0x00, 0x00, 0x00, 0xff, 0xff}
+			stream := append(append(append([]byte{}, testLZ4Frame...), skippable...), testLZ4Frame...)
+			out, _, err := readAll(stream)
+			So(err, ShouldBeNil)
+			So(out, ShouldEqual, testText+testText)
+		})
+
+		Convey("a truncated frame is an error", func() {
+			_, _, err := readAll(testLZ4Frame[:20])
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("corrupt frames fail their checksums", func() {
+			for _, i := range []int{5, 20, len(testLZ4Frame) - 1} {
+				corrupt := append([]byte{}, testLZ4Frame...)
+				corrupt[i] ^= 0x01
+				_, _, err := readAll(corrupt)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestXXH32(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("xxh32 matches the reference hashes", t, func() {
+		So(xxh32Sum(nil), ShouldEqual, uint32(0x02cc5d05))
+		So(xxh32Sum([]byte("a")), ShouldEqual, uint32(0x550d7456))
+		So(xxh32Sum([]byte("abc")), ShouldEqual, uint32(0x32d153ff))
+		So(xxh32Sum([]byte("Nobody inspects the spammish repetition")), ShouldEqual, uint32(0xe2293b2f))
+	})
+
+	Convey("Data may be written in pieces", t, func() {
+		h := newXXH32()
+		for _, piece := range []string{"mongo", "restore mongorestore mongor", "estore mongorestore\n"} {
+			_, _ = h.Write([]byte(piece))
+		}
+		So(h.Sum32(), ShouldEqual, xxh32Sum([]byte(testText)))
+	})
+}
+
+func TestDecodeLZ4Block(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Matches may overlap their own output", t, func() {
+		// "abc" followed by a 9 byte match at offset 3
+		out, err := decodeLZ4Block(nil, []byte{0x35, 'a', 'b', 'c', 0x03, 0x00})
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "abcabcabcabc")
+	})
+
+	Convey("Matches may reach into the previous block", t, func() {
+		out, err := decodeLZ4Block([]byte("xyz"), []byte{0x00, 0x03, 0x00, 0x10, '!'})
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "xyzxyzx!")
+	})
+
+	Convey("Offsets before the start of the output are corrupt", t, func() {
+		_, err := decodeLZ4Block(nil, []byte{0x10, 'a', 0x05, 0x00})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestTrimExtension(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Compression extensions are recognized", t, func() {
+		name, codec := TrimExtension("c.bson.zst")
+		So(name, ShouldEqual, "c.bson")
+		So(codec, ShouldEqual, Zstd)
+		name, codec = TrimExtension("c.metadata.json.lz4")
+		So(name, ShouldEqual, "c.metadata.json")
+		So(codec, ShouldEqual, LZ4)
+		name, codec = TrimExtension("c.bson")
+		So(name, ShouldEqual, "c.bson")
+		So(codec, ShouldEqual, None)
+	})
+}
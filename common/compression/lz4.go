@@ -0,0 +1,279 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package compression
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// lz4 frame header flags.
+const (
+	lz4FlagBlockIndependence = 1 << 5
+	lz4FlagBlockChecksum     = 1 << 4
+	lz4FlagContentSize       = 1 << 3
+	lz4FlagContentChecksum   = 1 << 2
+	lz4FlagDictID            = 1 << 0
+
+	// lz4Window is how far back a match may reach.
+	lz4Window = 64 * 1024
+
+	lz4SkippableMagicMin = 0x184D2A50
+	lz4SkippableMagicMax = 0x184D2A5F
+)
+
+var (
+	errLZ4Corrupt  = errors.New("corrupt lz4 block")
+	errLZ4Checksum = errors.New("lz4 checksum mismatch")
+)
+
+// lz4Reader decompresses a stream of LZ4 frames, verifying the header, block
+// and content checksums of the frames that have them.
+type lz4Reader struct {
+	r io.Reader
+
+	// flags of the current frame, or -1 between frames
+	flags int
+	// content hashes the decompressed data of the current frame
+	content *xxh32
+
+	// history holds the end of the previous block for linked blocks, and out
+	// the decompressed data not read yet.
+	history []byte
+	out     []byte
+	block   []byte
+	err     error
+}
+
+// NewLZ4Reader returns a reader that decompresses the LZ4 frames read from r.
+func NewLZ4Reader(r io.Reader) io.Reader {
+	return &lz4Reader{r: r, flags: -1, content: newXXH32()}
+}
+
+func (z *lz4Reader) Read(p []byte) (int, error) {
+	for len(z.out) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.next()
+	}
+	n := copy(p, z.out)
+	z.out = z.out[n:]
+	return n, nil
+}
+
+// next decompresses the next block, reading frame headers as needed.
+func (z *lz4Reader) next() error {
+	if z.flags < 0 {
+		if err := z.readFrameHeader(); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	var size uint32
+	if err := binary.Read(z.r, binary.LittleEndian, &size); err != nil {
+		return unexpected(err)
+	}
+	if size == 0 {
+		// end of frame
+		if z.flags&lz4FlagContentChecksum != 0 {
+			if err := z.verify(z.content.Sum32()); err != nil {
+				return err
+			}
+		}
+		z.flags = -1
+		z.history = z.history[:0]
+		return nil
+	}
+
+	uncompressed := size&(1<<31) != 0
+	size &^= 1 << 31
+	if cap(z.block) < int(size) {
+		z.block = make([]byte, size)
+	}
+	z.block = z.block[:size]
+	if _, err := io.ReadFull(z.r, z.block); err != nil {
+		return unexpected(err)
+	}
+	if z.flags&lz4FlagBlockChecksum != 0 {
+		if err := z.verify(xxh32Sum(z.block)); err != nil {
+			return err
+		}
+	}
+
+	start := len(z.history)
+	var err error
+	if uncompressed {
+		z.history = append(z.history, z.block...)
+	} else if z.history, err = decodeLZ4Block(z.history, z.block); err != nil {
+		return err
+	}
+	z.out = append(z.out[:0], z.history[start:]...)
+	if z.flags&lz4FlagContentChecksum != 0 {
+		_, _ = z.content.Write(z.out)
+	}
+
+	if z.flags&lz4FlagBlockIndependence != 0 {
+		z.history = z.history[:0]
+	} else if len(z.history) > lz4Window {
+		z.history = append(z.history[:0], z.history[len(z.history)-lz4Window:]...)
+	}
+	return nil
+}
+
+// readFrameHeader reads the header of the next frame, skipping skippable
+// frames. It returns io.EOF at the end of the stream.
+func (z *lz4Reader) readFrameHeader() error {
+	for {
+		var magic uint32
+		if err := binary.Read(z.r, binary.LittleEndian, &magic); err != nil {
+			if err == io.EOF {
+				return io.EOF
+			}
+			return unexpected(err)
+		}
+		if magic >= lz4SkippableMagicMin && magic <= lz4SkippableMagicMax {
+			var size uint32
+			if err := binary.Read(z.r, binary.LittleEndian, &size); err != nil {
+				return unexpected(err)
+			}
+			if err := z.discard(int64(size)); err != nil {
+				return err
+			}
+			continue
+		}
+		if magic != binary.LittleEndian.Uint32(lz4Magic) {
+			return fmt.Errorf("invalid lz4 frame magic number %#x", magic)
+		}
+		break
+	}
+
+	// the descriptor is followed by the content size, if any, and the
+	// header checksum
+	descriptor := make([]byte, 2, 11)
+	if _, err := io.ReadFull(z.r, descriptor); err != nil {
+		return unexpected(err)
+	}
+	flags := int(descriptor[0])
+	if flags>>6 != 1 {
+		return fmt.Errorf("unsupported lz4 frame version %v", flags>>6)
+	}
+	if flags&lz4FlagDictID != 0 {
+		return fmt.Errorf("lz4 frames with a dictionary are not supported")
+	}
+	if flags&lz4FlagContentSize != 0 {
+		descriptor = descriptor[:10]
+		if _, err := io.ReadFull(z.r, descriptor[2:]); err != nil {
+			return unexpected(err)
+		}
+	}
+	var checksum [1]byte
+	if _, err := io.ReadFull(z.r, checksum[:]); err != nil {
+		return unexpected(err)
+	}
+	if byte(xxh32Sum(descriptor)>>8) != checksum[0] {
+		return fmt.Errorf("%v in frame header", errLZ4Checksum)
+	}
+	z.flags = flags
+	z.content.Reset()
+	return nil
+}
+
+// verify reads a checksum and compares it with sum.
+func (z *lz4Reader) verify(sum uint32) error {
+	var checksum uint32
+	if err := binary.Read(z.r, binary.LittleEndian, &checksum); err != nil {
+		return unexpected(err)
+	}
+	if checksum != sum {
+		return errLZ4Checksum
+	}
+	return nil
+}
+
+func (z *lz4Reader) discard(n int64) error {
+	if _, err := io.CopyN(ioutil.Discard, z.r, n); err != nil {
+		return unexpected(err)
+	}
+	return nil
+}
+
+// unexpected turns an io.EOF in the middle of a frame into an error.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// decodeLZ4Block appends the decompressed contents of an LZ4 block to dst,
+// whose existing contents may be referenced by matches.
+func decodeLZ4Block(dst, src []byte) ([]byte, error) {
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+
+		literals := int(token >> 4)
+		if literals == 15 {
+			for {
+				if i >= len(src) {
+					return nil, errLZ4Corrupt
+				}
+				b := src[i]
+				i++
+				literals += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		if literals > len(src)-i {
+			return nil, errLZ4Corrupt
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+		if i == len(src) {
+			// the last sequence has only literals
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, errLZ4Corrupt
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, errLZ4Corrupt
+		}
+		length := int(token & 15)
+		if length == 15 {
+			for {
+				if i >= len(src) {
+					return nil, errLZ4Corrupt
+				}
+				b := src[i]
+				i++
+				length += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		length += 4
+
+		// matches may overlap the bytes they produce, so copy one at a time
+		from := len(dst) - offset
+		for j := 0; j < length; j++ {
+			dst = append(dst, dst[from+j])
+		}
+	}
+	return dst, nil
+}
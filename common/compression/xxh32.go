@@ -0,0 +1,113 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package compression
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// The xxHash32 primes.
+const (
+	xxhPrime1 uint32 = 2654435761
+	xxhPrime2 uint32 = 2246822519
+	xxhPrime3 uint32 = 3266489917
+	xxhPrime4 uint32 = 668265263
+	xxhPrime5 uint32 = 374761393
+)
+
+// xxh32 computes the 32-bit xxHash with seed 0 that lz4 frames use for
+// their header, block and content checksums. It is written to as data
+// arrives, like a hash.Hash32.
+type xxh32 struct {
+	v     [4]uint32
+	total uint64
+	buf   [16]byte
+	n     int
+}
+
+func newXXH32() *xxh32 {
+	h := &xxh32{}
+	h.Reset()
+	return h
+}
+
+// Reset starts a new hash.
+func (h *xxh32) Reset() {
+	// the sums wrap around, which constant expressions can't
+	p1, p2 := xxhPrime1, xxhPrime2
+	h.v = [4]uint32{p1 + p2, p2, 0, -p1}
+	h.total = 0
+	h.n = 0
+}
+
+func xxhRound(v, lane uint32) uint32 {
+	return bits.RotateLeft32(v+lane*xxhPrime2, 13) * xxhPrime1
+}
+
+func (h *xxh32) stripe(b []byte) {
+	for i := range h.v {
+		h.v[i] = xxhRound(h.v[i], binary.LittleEndian.Uint32(b[4*i:]))
+	}
+}
+
+// Write adds p to the hash. It never fails.
+func (h *xxh32) Write(p []byte) (int, error) {
+	n := len(p)
+	h.total += uint64(n)
+	if h.n > 0 {
+		copied := copy(h.buf[h.n:], p)
+		h.n += copied
+		p = p[copied:]
+		if h.n < len(h.buf) {
+			return n, nil
+		}
+		h.stripe(h.buf[:])
+		h.n = 0
+	}
+	for ; len(p) >= 16; p = p[16:] {
+		h.stripe(p)
+	}
+	h.n = copy(h.buf[:], p)
+	return n, nil
+}
+
+// Sum32 returns the hash of the data written so far.
+func (h *xxh32) Sum32() uint32 {
+	var sum uint32
+	if h.total >= 16 {
+		sum = bits.RotateLeft32(h.v[0], 1) + bits.RotateLeft32(h.v[1], 7) +
+			bits.RotateLeft32(h.v[2], 12) + bits.RotateLeft32(h.v[3], 18)
+	} else {
+		sum = xxhPrime5
+	}
+	sum += uint32(h.total)
+
+	tail := h.buf[:h.n]
+	for ; len(tail) >= 4; tail = tail[4:] {
+		sum += binary.LittleEndian.Uint32(tail) * xxhPrime3
+		sum = bits.RotateLeft32(sum, 17) * xxhPrime4
+	}
+	for _, b := range tail {
+		sum += uint32(b) * xxhPrime5
+		sum = bits.RotateLeft32(sum, 11) * xxhPrime1
+	}
+
+	sum ^= sum >> 15
+	sum *= xxhPrime2
+	sum ^= sum >> 13
+	sum *= xxhPrime3
+	sum ^= sum >> 16
+	return sum
+}
+
+// xxh32Sum returns the hash of data.
+func xxh32Sum(data []byte) uint32 {
+	h := newXXH32()
+	_, _ = h.Write(data)
+	return h.Sum32()
+}
@@ -9,7 +9,10 @@ package db
 import (
 	"context"
 	"fmt"
+	"sort"
+	"time"
 
+	"github.com/huimingz/mongo-tools/common/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -26,8 +29,25 @@ type BufferedBulkInserter struct {
 	docCount      int
 	bulkWriteOpts *options.BulkWriteOptions
 	upsert        bool
+	maxRetries    int
+	comment       string
+
+	// unconfirmed counts the inserts whose outcome is unknown
+	unconfirmed int64
+
+	// bulkWrite performs a bulk write and runCommand runs a write command;
+	// they are replaced in tests.
+	bulkWrite  func(models []mongo.WriteModel) (*mongo.BulkWriteResult, error)
+	runCommand func(cmd bson.D, reply *writeCommandReply) error
 }
 
+// bulkRetryBackoff is the delay before the first retry of a failed bulk
+// write. It doubles with every further retry, up to maxBulkRetryBackoff.
+var (
+	bulkRetryBackoff    = 500 * time.Millisecond
+	maxBulkRetryBackoff = 30 * time.Second
+)
+
 func newBufferedBulkInserter(collection *mongo.Collection, docLimit int, ordered bool) *BufferedBulkInserter {
 	bb := &BufferedBulkInserter{
 		collection:    collection,
@@ -35,6 +55,10 @@ func newBufferedBulkInserter(collection *mongo.Collection, docLimit int, ordered
 		docLimit:      docLimit,
 		writeModels:   make([]mongo.WriteModel, 0, docLimit),
 	}
+	bb.bulkWrite = func(models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+		return bb.collection.BulkWrite(context.Background(), models, bb.bulkWriteOpts)
+	}
+	bb.runCommand = bb.runWriteCommand
 	return bb
 }
 
@@ -63,6 +87,35 @@ func (bb *BufferedBulkInserter) SetUpsert(upsert bool) *BufferedBulkInserter {
 	return bb
 }
 
+// SetComment attaches a comment to the writes, so that they can be told
+// apart in the profiler, currentOp and the server logs. The driver can't
+// attach comments to bulk writes, so the writes are sent as insert, update
+// and delete commands instead. Comments on writes require MongoDB 4.4+, and
+// can be at most MaxCommentBytes long.
+func (bb *BufferedBulkInserter) SetComment(comment string) *BufferedBulkInserter {
+	bb.comment = comment
+	if comment != "" {
+		bb.bulkWrite = bb.writeCommands
+	}
+	return bb
+}
+
+// SetMaxRetries sets how many times writes that fail with a transient error
+// are retried. Each retry splits the failed writes in half and waits twice as
+// long as the one before.
+func (bb *BufferedBulkInserter) SetMaxRetries(maxRetries int) *BufferedBulkInserter {
+	bb.maxRetries = maxRetries
+	return bb
+}
+
+// Unconfirmed returns the number of inserts that failed with a duplicate key
+// error when retried after an attempt whose outcome is unknown. The earlier
+// attempt may have inserted the document, or another document may already
+// have had its _id, so these are counted as neither inserted nor failed.
+func (bb *BufferedBulkInserter) Unconfirmed() int64 {
+	return bb.unconfirmed
+}
+
 // throw away the old bulk and init a new one
 func (bb *BufferedBulkInserter) resetBulk() {
 	bb.writeModels = bb.writeModels[:0]
@@ -124,5 +177,161 @@ func (bb *BufferedBulkInserter) Flush() (*mongo.BulkWriteResult, error) {
 	}
 
 	defer bb.resetBulk()
-	return bb.collection.BulkWrite(context.Background(), bb.writeModels, bb.bulkWriteOpts)
+	if bb.maxRetries == 0 {
+		return bb.bulkWrite(bb.writeModels)
+	}
+
+	batch := make([]pendingWrite, len(bb.writeModels))
+	for i, model := range bb.writeModels {
+		batch[i] = pendingWrite{index: int64(i), model: model}
+	}
+	outcome := &bulkOutcome{result: &mongo.BulkWriteResult{UpsertedIDs: map[int64]interface{}{}}}
+	bb.writeWithRetries(batch, 0, outcome)
+	return outcome.result, outcome.err()
+}
+
+// pendingWrite is a buffered write and its index in the flushed batch.
+// unknown is set when an earlier attempt may have applied the write.
+type pendingWrite struct {
+	index   int64
+	model   mongo.WriteModel
+	unknown bool
+}
+
+// bulkOutcome collects the results and errors of the attempts that make up
+// a flush with retries.
+type bulkOutcome struct {
+	result            *mongo.BulkWriteResult
+	writeErrors       []mongo.BulkWriteError
+	writeConcernError *mongo.WriteConcernError
+	fatal             error
+}
+
+func (o *bulkOutcome) add(batch []pendingWrite, result *mongo.BulkWriteResult) {
+	if result == nil {
+		return
+	}
+	o.result.InsertedCount += result.InsertedCount
+	o.result.MatchedCount += result.MatchedCount
+	o.result.ModifiedCount += result.ModifiedCount
+	o.result.DeletedCount += result.DeletedCount
+	o.result.UpsertedCount += result.UpsertedCount
+	for i, id := range result.UpsertedIDs {
+		o.result.UpsertedIDs[batch[i].index] = id
+	}
+}
+
+func (o *bulkOutcome) err() error {
+	if o.fatal != nil {
+		return o.fatal
+	}
+	if len(o.writeErrors) == 0 && o.writeConcernError == nil {
+		return nil
+	}
+	sort.Slice(o.writeErrors, func(i, j int) bool { return o.writeErrors[i].Index < o.writeErrors[j].Index })
+	return mongo.BulkWriteException{WriteErrors: o.writeErrors, WriteConcernError: o.writeConcernError}
+}
+
+// writeWithRetries writes a batch, retrying the writes that fail with a
+// transient error. It returns false if an ordered write stopped at an error.
+func (bb *BufferedBulkInserter) writeWithRetries(batch []pendingWrite, attempt int, outcome *bulkOutcome) bool {
+	models := make([]mongo.WriteModel, len(batch))
+	for i, write := range batch {
+		models[i] = write.model
+	}
+	result, err := bb.bulkWrite(models)
+	canRetry := attempt < bb.maxRetries
+
+	var retry, resume []pendingWrite
+	ok := true
+	if _, isBulkErr := err.(mongo.BulkWriteException); err != nil && !isBulkErr && canRetry && IsTransientError(err) {
+		// the batch may have been partially applied, so its result can't be
+		// trusted and every write is retried
+		retry = make([]pendingWrite, len(batch))
+		for i, write := range batch {
+			retry[i] = write
+			retry[i].unknown = true
+		}
+	} else {
+		outcome.add(batch, result)
+		if err == nil {
+			return true
+		}
+		retry, resume, ok = bb.failedWrites(batch, err, canRetry, outcome)
+	}
+	if len(resume) > 0 {
+		// the writes weren't attempted, so they are written without waiting,
+		// but as a further attempt so that the retries stay limited
+		log.Logvf(log.DebugLow, "continuing with %v writes after a duplicate key error on an insert that may "+
+			"already have been applied", len(resume))
+		return bb.writeWithRetries(resume, attempt+1, outcome)
+	}
+	if len(retry) == 0 {
+		return ok
+	}
+
+	delay := bulkRetryBackoff << uint(attempt)
+	if delay > maxBulkRetryBackoff {
+		delay = maxBulkRetryBackoff
+	}
+	log.Logvf(log.Always, "retrying %v writes in %v after a transient error: %v", len(retry), delay, err)
+	time.Sleep(delay)
+
+	half := (len(retry) + 1) / 2
+	for _, part := range [][]pendingWrite{retry[:half], retry[half:]} {
+		if len(part) > 0 && !bb.writeWithRetries(part, attempt+1, outcome) && bb.ordered() {
+			return false
+		}
+	}
+	return ok
+}
+
+// failedWrites records the errors of a bulk write in outcome, and returns the
+// writes that failed transiently to retry. An ordered write that stopped at a
+// duplicate of an insert whose outcome is unknown also returns the writes
+// after it, which weren't attempted, to resume. It returns false if an
+// ordered write stopped at an error that is not retried.
+func (bb *BufferedBulkInserter) failedWrites(batch []pendingWrite, err error, canRetry bool, outcome *bulkOutcome) (retry, resume []pendingWrite, ok bool) {
+	bwe, ok := err.(mongo.BulkWriteException)
+	if !ok {
+		outcome.fatal = err
+		return nil, nil, false
+	}
+
+	if bwe.WriteConcernError != nil {
+		outcome.writeConcernError = bwe.WriteConcernError
+	}
+	for _, writeErr := range bwe.WriteErrors {
+		write := batch[writeErr.Index]
+		after := batch[writeErr.Index+1:]
+		if _, isInsert := write.model.(*mongo.InsertOneModel); isInsert && write.unknown &&
+			writeErr.Code == ErrDuplicateKeyCode && (!bb.ordered() || len(after) == 0 || canRetry) {
+			// an earlier attempt may have inserted the document, or another
+			// document may already have had its _id; once the retries are
+			// used up, an ordered write stops at it like at any other error
+			bb.unconfirmed++
+			if bb.ordered() {
+				resume = after
+			}
+			continue
+		}
+		if canRetry && isTransientCode(writeErr.Code) {
+			retry = append(retry, write)
+			if bb.ordered() {
+				// an ordered write stops at its first error
+				retry = append(retry, after...)
+			}
+			continue
+		}
+		writeErr.Index = int(write.index)
+		outcome.writeErrors = append(outcome.writeErrors, writeErr)
+		if bb.ordered() {
+			return retry, nil, false
+		}
+	}
+	return retry, resume, true
+}
+
+func (bb *BufferedBulkInserter) ordered() bool {
+	return bb.bulkWriteOpts.Ordered == nil || *bb.bulkWriteOpts.Ordered
 }
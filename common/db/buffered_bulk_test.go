@@ -8,12 +8,15 @@ package db
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/huimingz/mongo-tools/common/options"
 	"github.com/huimingz/mongo-tools/common/testtype"
 	. "github.com/smartystreets/goconvey/convey"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func TestBufferedBulkInserterInserts(t *testing.T) {
@@ -141,3 +144,261 @@ func TestBufferedBulkInserterInserts(t *testing.T) {
 	})
 
 }
+
+// flakyCollection stands in for a collection in retry tests. Each call fails
+// with the next of its errors after applying the first applied writes. An
+// ordered one stops at the first duplicate key.
+type flakyCollection struct {
+	ordered bool
+	docs    map[int32]bool
+	calls   []int
+	applied []int
+	errs    []func(models []mongo.WriteModel) error
+}
+
+func (c *flakyCollection) bulkWrite(models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	c.calls = append(c.calls, len(models))
+	limit := len(models)
+	var fail func([]mongo.WriteModel) error
+	if len(c.errs) > 0 {
+		fail, c.errs = c.errs[0], c.errs[1:]
+		limit, c.applied = c.applied[0], c.applied[1:]
+	}
+
+	result := &mongo.BulkWriteResult{}
+	var writeErrors []mongo.BulkWriteError
+	for i, model := range models[:limit] {
+		id := bson.Raw(model.(*mongo.InsertOneModel).Document.([]byte)).Lookup("_id").Int32()
+		if c.docs[id] {
+			writeErrors = append(writeErrors, mongo.BulkWriteError{
+				WriteError: mongo.WriteError{Index: i, Code: ErrDuplicateKeyCode},
+			})
+			if c.ordered {
+				break
+			}
+			continue
+		}
+		c.docs[id] = true
+		result.InsertedCount++
+	}
+	if fail != nil {
+		return result, fail(models)
+	}
+	if len(writeErrors) > 0 {
+		return result, mongo.BulkWriteException{WriteErrors: writeErrors}
+	}
+	return result, nil
+}
+
+func TestBufferedBulkInserterRetries(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	defer func(backoff time.Duration) { bulkRetryBackoff = backoff }(bulkRetryBackoff)
+	bulkRetryBackoff = time.Millisecond
+
+	networkError := func([]mongo.WriteModel) error {
+		return mongo.CommandError{Message: "connection reset", Labels: []string{"NetworkError"}}
+	}
+
+	Convey("With a bulk inserter that retries", t, func() {
+		fake := &flakyCollection{docs: map[int32]bool{}}
+		bulk := NewUnorderedBufferedBulkInserter(nil, 100).SetMaxRetries(2)
+		bulk.bulkWrite = fake.bulkWrite
+		insert := func(ids ...int32) {
+			for _, id := range ids {
+				raw, err := bson.Marshal(bson.M{"_id": id})
+				So(err, ShouldBeNil)
+				_, err = bulk.InsertRaw(raw)
+				So(err, ShouldBeNil)
+			}
+		}
+
+		Convey("a partially applied batch is split and retried", func() {
+			fake.errs = append(fake.errs, networkError)
+			fake.applied = append(fake.applied, 3)
+			insert(1, 2, 3, 4, 5, 6)
+
+			result, err := bulk.Flush()
+			So(err, ShouldBeNil)
+			So(fake.calls, ShouldResemble, []int{6, 3, 3})
+			// the retried inserts that were applied the first time find
+			// their own documents, which can't be told from existing ones
+			So(result.InsertedCount, ShouldEqual, 3)
+			So(bulk.Unconfirmed(), ShouldEqual, 3)
+			So(len(fake.docs), ShouldEqual, 6)
+		})
+
+		Convey("only the writes that failed transiently are retried", func() {
+			fake.docs[3] = true
+			fake.errs = append(fake.errs, func([]mongo.WriteModel) error {
+				return mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+					{WriteError: mongo.WriteError{Index: 1, Code: 189}},
+					{WriteError: mongo.WriteError{Index: 2, Code: ErrDuplicateKeyCode}},
+				}}
+			})
+			fake.applied = append(fake.applied, 1)
+			insert(1, 2, 3, 4)
+
+			result, err := bulk.Flush()
+			So(fake.calls, ShouldResemble, []int{4, 1})
+			So(result.InsertedCount, ShouldEqual, 2)
+			bwe, ok := err.(mongo.BulkWriteException)
+			So(ok, ShouldBeTrue)
+			So(len(bwe.WriteErrors), ShouldEqual, 1)
+			So(bwe.WriteErrors[0].Index, ShouldEqual, 2)
+		})
+
+		Convey("the error is returned once the retries are used up", func() {
+			for i := 0; i < 5; i++ {
+				fake.errs = append(fake.errs, networkError)
+				fake.applied = append(fake.applied, 0)
+			}
+			insert(1, 2)
+
+			_, err := bulk.Flush()
+			So(err, ShouldNotBeNil)
+			So(fake.calls, ShouldResemble, []int{2, 1, 1, 1, 1})
+			So(fake.docs, ShouldBeEmpty)
+		})
+	})
+
+	Convey("With an ordered bulk inserter that retries", t, func() {
+		fake := &flakyCollection{ordered: true, docs: map[int32]bool{}}
+		bulk := NewOrderedBufferedBulkInserter(nil, 100)
+		bulk.bulkWrite = fake.bulkWrite
+		insert := func(ids ...int32) {
+			for _, id := range ids {
+				raw, err := bson.Marshal(bson.M{"_id": id})
+				So(err, ShouldBeNil)
+				_, err = bulk.InsertRaw(raw)
+				So(err, ShouldBeNil)
+			}
+		}
+		fake.errs = append(fake.errs, networkError)
+		fake.applied = append(fake.applied, 2)
+		insert(1, 2, 3, 4)
+
+		Convey("the writes after a duplicate of an unconfirmed insert are resumed", func() {
+			bulk.SetMaxRetries(2)
+			result, err := bulk.Flush()
+			So(err, ShouldBeNil)
+			So(fake.calls, ShouldResemble, []int{4, 2, 1, 2})
+			So(result.InsertedCount, ShouldEqual, 2)
+			So(bulk.Unconfirmed(), ShouldEqual, 2)
+			So(len(fake.docs), ShouldEqual, 4)
+		})
+
+		Convey("resuming counts against the retries", func() {
+			bulk.SetMaxRetries(1)
+			_, err := bulk.Flush()
+			bwe, ok := err.(mongo.BulkWriteException)
+			So(ok, ShouldBeTrue)
+			So(bwe.WriteErrors, ShouldHaveLength, 1)
+			So(bwe.WriteErrors[0].Code, ShouldEqual, ErrDuplicateKeyCode)
+			So(fake.calls, ShouldResemble, []int{4, 2})
+			So(bulk.Unconfirmed(), ShouldEqual, 0)
+			So(len(fake.docs), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestBufferedBulkInserterComment(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a bulk inserter that comments its writes", t, func() {
+		client, err := mongo.NewClient()
+		So(err, ShouldBeNil)
+		bulk := NewOrderedBufferedBulkInserter(client.Database("test").Collection("coll"), 100).
+			SetBypassDocumentValidation(true).
+			SetComment("restore-42")
+		var commands []bson.D
+		bulk.runCommand = func(cmd bson.D, reply *writeCommandReply) error {
+			commands = append(commands, cmd)
+			writes := cmd[1].Value.(bson.A)
+			reply.N = int64(len(writes))
+			if cmd[0].Key == "update" {
+				reply.N, reply.NModified = 1, 0
+				reply.Upserted = append(reply.Upserted, struct {
+					Index int64       `bson:"index"`
+					ID    interface{} `bson:"_id"`
+				}{Index: 0, ID: int32(9)})
+			}
+			return nil
+		}
+
+		Convey("consecutive writes of a kind are sent in one command with the comment", func() {
+			for i := int32(1); i <= 3; i++ {
+				_, err := bulk.Insert(bson.D{{"_id", i}})
+				So(err, ShouldBeNil)
+			}
+			bulk.SetUpsert(true)
+			_, err := bulk.Replace(bson.D{{"_id", int32(9)}}, bson.D{{"_id", int32(9)}})
+			So(err, ShouldBeNil)
+
+			result, err := bulk.Flush()
+			So(err, ShouldBeNil)
+			So(commands, ShouldHaveLength, 2)
+			So(commands[0][0], ShouldResemble, bson.E{Key: "insert", Value: "coll"})
+			So(commands[0][1].Value, ShouldHaveLength, 3)
+			So(commands[0][2:], ShouldResemble, bson.D{{"ordered", true}, {"bypassDocumentValidation", true}, {"comment", "restore-42"}})
+			So(commands[1][0], ShouldResemble, bson.E{Key: "update", Value: "coll"})
+			So(result.InsertedCount, ShouldEqual, 3)
+			So(result.UpsertedCount, ShouldEqual, 1)
+			So(result.UpsertedIDs[3], ShouldEqual, int32(9))
+		})
+
+		Convey("write errors are reported at their index in the flushed batch", func() {
+			bulk.runCommand = func(cmd bson.D, reply *writeCommandReply) error {
+				commands = append(commands, cmd)
+				reply.N = 1
+				if cmd[0].Key != "insert" {
+					return nil
+				}
+				reply.WriteErrors = append(reply.WriteErrors, struct {
+					Index   int      `bson:"index"`
+					Code    int      `bson:"code"`
+					Message string   `bson:"errmsg"`
+					Details bson.Raw `bson:"errInfo"`
+				}{Index: 1, Code: ErrDuplicateKeyCode, Message: "duplicate key"})
+				return nil
+			}
+			_, err := bulk.Delete(bson.D{{"_id", int32(1)}}, nil)
+			So(err, ShouldBeNil)
+			for i := int32(1); i <= 3; i++ {
+				_, err := bulk.Insert(bson.D{{"_id", i}})
+				So(err, ShouldBeNil)
+			}
+
+			result, err := bulk.Flush()
+			So(commands, ShouldHaveLength, 2)
+			So(result.DeletedCount, ShouldEqual, 1)
+			So(result.InsertedCount, ShouldEqual, 1)
+			bwe, ok := err.(mongo.BulkWriteException)
+			So(ok, ShouldBeTrue)
+			So(bwe.WriteErrors, ShouldHaveLength, 1)
+			So(bwe.WriteErrors[0].Index, ShouldEqual, 2)
+		})
+
+		Convey("large writes leave room in each command for the comment", func() {
+			// two documents that fill a command only when it has no comment
+			payload := strings.Repeat("x", (maxWriteCommandBytes-writeCommandOverhead)/2-64)
+			for i := int32(1); i <= 2; i++ {
+				_, err := bulk.Insert(bson.D{{"_id", i}, {"payload", payload}})
+				So(err, ShouldBeNil)
+			}
+			_, err := bulk.Flush()
+			So(err, ShouldBeNil)
+			So(commands, ShouldHaveLength, 1)
+
+			commands = nil
+			bulk.SetComment(strings.Repeat("c", MaxCommentBytes))
+			for i := int32(3); i <= 4; i++ {
+				_, err := bulk.Insert(bson.D{{"_id", i}, {"payload", payload}})
+				So(err, ShouldBeNil)
+			}
+			_, err = bulk.Flush()
+			So(err, ShouldBeNil)
+			So(commands, ShouldHaveLength, 2)
+		})
+	})
+}
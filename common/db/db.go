@@ -32,6 +32,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 	"go.mongodb.org/mongo-driver/tag"
+	driverauth "go.mongodb.org/mongo-driver/x/mongo/driver/auth"
 )
 
 type (
@@ -77,6 +78,24 @@ const (
 
 var ignorableWriteErrorCodes = map[int]bool{ErrDuplicateKeyCode: true, ErrFailedDocumentValidation: true}
 
+// transientErrorCodes are the server error codes of failures that may succeed
+// when retried, such as network errors and primary step-downs.
+var transientErrorCodes = map[int]bool{
+	6:     true, // HostUnreachable
+	7:     true, // HostNotFound
+	89:    true, // NetworkTimeout
+	91:    true, // ShutdownInProgress
+	112:   true, // WriteConflict
+	189:   true, // PrimarySteppedDown
+	262:   true, // ExceededTimeLimit
+	9001:  true, // SocketException
+	10107: true, // NotWritablePrimary
+	11600: true, // InterruptedAtShutdown
+	11602: true, // InterruptedDueToReplStateChange
+	13435: true, // NotPrimaryNoSecondaryOk
+	13436: true, // NotPrimaryOrSecondary
+}
+
 const (
 	continueThroughErrorFormat = "continuing through error: %v"
 )
@@ -136,7 +155,7 @@ func NewSessionProvider(opts options.ToolOptions) (*SessionProvider, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = client.Ping(context.Background(), nil)
+	err = pingWithRetries(client, opts.ConnectRetries, time.Duration(opts.ConnectBackoff)*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("could not connect to server: %v", err)
 	}
@@ -145,6 +164,43 @@ func NewSessionProvider(opts options.ToolOptions) (*SessionProvider, error) {
 	return &SessionProvider{client: client}, nil
 }
 
+// maxConnectBackoff is the longest wait between connection retries.
+const maxConnectBackoff = time.Minute
+
+// pingWithRetries pings the server, retrying with exponential backoff so that
+// tools started alongside a cluster can wait for it to come up. Failures to
+// authenticate are not retried.
+func pingWithRetries(client *mongo.Client, retries int, backoff time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		err := client.Ping(context.Background(), nil)
+		if err == nil || attempt >= retries || isAuthenticationError(err) {
+			return err
+		}
+		wait := connectBackoff(backoff, attempt)
+		log.Logvf(log.Always, "could not connect to server: %v; retrying in %v (%v of %v)",
+			err, wait, attempt+1, retries)
+		time.Sleep(wait)
+	}
+}
+
+// connectBackoff returns how long to wait before a retry, doubling the base
+// wait for each earlier retry.
+func connectBackoff(base time.Duration, attempt int) time.Duration {
+	wait := base
+	for i := 0; i < attempt && wait < maxConnectBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxConnectBackoff {
+		wait = maxConnectBackoff
+	}
+	return wait
+}
+
+func isAuthenticationError(err error) bool {
+	var authErr *driverauth.Error
+	return errors.As(err, &authErr)
+}
+
 func NewSessionProviderWithClient(client *mongo.Client) *SessionProvider {
 	return &SessionProvider{client: client}
 }
@@ -309,6 +365,13 @@ func configureClient(opts options.ToolOptions) (*mongo.Client, error) {
 	if opts.Connection.ServerSelectionTimeout > 0 {
 		clientopt.SetServerSelectionTimeout(time.Duration(opts.Connection.ServerSelectionTimeout) * time.Second)
 	}
+	if opts.Connection.Proxy != "" {
+		dialer, err := newProxyDialer(opts.Connection.Proxy, time.Duration(opts.TCPKeepAliveSeconds)*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring client, invalid --proxy: %v", err)
+		}
+		clientopt.SetDialer(dialer)
+	}
 	if opts.ReplicaSetName != "" {
 		clientopt.SetReplicaSet(opts.ReplicaSetName)
 	}
@@ -330,8 +393,15 @@ func configureClient(opts options.ToolOptions) (*mongo.Client, error) {
 		clientopt.SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
 	}
 
-	if opts.Compressors != "" && opts.Compressors != "none" {
-		clientopt.SetCompressors(strings.Split(opts.Compressors, ","))
+	// the compressors may come from the URI as well as --compressors
+	compressors := []string{}
+	for _, compressor := range cs.Compressors {
+		if compressor != "" && compressor != "none" {
+			compressors = append(compressors, compressor)
+		}
+	}
+	if len(compressors) > 0 {
+		clientopt.SetCompressors(compressors)
 	}
 
 	if cs.ZlibLevelSet {
@@ -426,13 +496,20 @@ func configureClient(opts options.ToolOptions) (*mongo.Client, error) {
 			AuthSource:    opts.GetAuthenticationDatabase(),
 			AuthMechanism: opts.Auth.Mechanism,
 		}
-		if cs.AuthMechanism == "MONGODB-AWS" {
-			cred.Username = cs.Username
-			cred.Password = cs.Password
-			cred.AuthSource = cs.AuthSource
-			cred.AuthMechanism = cs.AuthMechanism
+		// without a username, MONGODB-AWS credentials come from the AWS_*
+		// environment variables or the ECS or EC2 instance role
+		if strings.EqualFold(cs.AuthMechanism, "MONGODB-AWS") {
+			cred.AuthSource = "$external"
+			cred.AuthMechanism = "MONGODB-AWS"
 			cred.AuthMechanismProperties = cs.AuthMechanismProperties
 		}
+		if strings.EqualFold(cred.AuthMechanism, OIDCMechanism) {
+			cred.AuthSource = "$external"
+			cred.AuthMechanism = OIDCMechanism
+			if opts.Auth.OIDCTokenFile != "" {
+				cred.AuthMechanismProperties = map[string]string{oidcTokenFileProperty: opts.Auth.OIDCTokenFile}
+			}
+		}
 		// Technically, an empty password is possible, but the tools don't have the
 		// means to easily distinguish and so require a non-empty password.
 		if cred.Password != "" {
@@ -496,6 +573,14 @@ func configureClient(opts options.ToolOptions) (*mongo.Client, error) {
 		clientopt.SetDisableOCSPEndpointCheck(cs.SSLDisableOCSPEndpointCheck)
 	}
 
+	if opts.Encryption.IsSet() {
+		autoEncryption, err := autoEncryptionOptions(opts.Encryption)
+		if err != nil {
+			return nil, fmt.Errorf("error configuring client-side encryption: %v", err)
+		}
+		clientopt.SetAutoEncryptionOptions(autoEncryption)
+	}
+
 	return mongo.NewClient(clientopt)
 }
 
@@ -553,6 +638,28 @@ func CanIgnoreError(err error) bool {
 	return false
 }
 
+// IsTransientError returns whether a failed operation may succeed when
+// retried.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+	switch mongoErr := err.(type) {
+	case mongo.CommandError:
+		return mongoErr.HasErrorLabel("RetryableWriteError") || isTransientCode(int(mongoErr.Code))
+	case mongo.WriteError:
+		return isTransientCode(mongoErr.Code)
+	}
+	return false
+}
+
+func isTransientCode(code int) bool {
+	return transientErrorCodes[code]
+}
+
 // IsMMAPV1 returns whether the storage engine is MMAPV1. Also returns false
 // if the storage engine type cannot be determined for some reason.
 func IsMMAPV1(database *mongo.Database, collectionName string) (bool, error) {
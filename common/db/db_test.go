@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 
@@ -18,6 +19,10 @@ import (
 	"github.com/huimingz/mongo-tools/common/testtype"
 	. "github.com/smartystreets/goconvey/convey"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopt "go.mongodb.org/mongo-driver/mongo/options"
+	driverauth "go.mongodb.org/mongo-driver/x/mongo/driver/auth"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
 )
 
 // var block and functions copied from testutil to avoid import cycle
@@ -453,3 +458,38 @@ func TestConfigureClientMultipleHosts(t *testing.T) {
 		So(err, ShouldBeNil)
 	})
 }
+
+func TestConnectRetries(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Connection retries", t, func() {
+		Convey("back off exponentially up to a limit", func() {
+			So(connectBackoff(time.Second, 0), ShouldEqual, time.Second)
+			So(connectBackoff(time.Second, 1), ShouldEqual, 2*time.Second)
+			So(connectBackoff(time.Second, 3), ShouldEqual, 8*time.Second)
+			So(connectBackoff(time.Second, 20), ShouldEqual, maxConnectBackoff)
+			So(connectBackoff(0, 5), ShouldEqual, 0)
+		})
+
+		Convey("stop at authentication failures", func() {
+			authErr := &driverauth.Error{}
+			So(isAuthenticationError(topology.ConnectionError{Wrapped: authErr}), ShouldBeTrue)
+			So(isAuthenticationError(topology.ServerSelectionError{Wrapped: context.DeadlineExceeded}), ShouldBeFalse)
+		})
+
+		Convey("give up after the last retry", func() {
+			client, err := mongo.NewClient(mopt.Client().
+				ApplyURI("mongodb://127.0.0.1:1").
+				SetServerSelectionTimeout(50 * time.Millisecond))
+			So(err, ShouldBeNil)
+			So(client.Connect(context.Background()), ShouldBeNil)
+			defer client.Disconnect(context.Background())
+
+			start := time.Now()
+			err = pingWithRetries(client, 2, 10*time.Millisecond)
+			So(err, ShouldNotBeNil)
+			// three pings and two waits of 10ms and 20ms
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 180*time.Millisecond)
+		})
+	})
+}
@@ -0,0 +1,84 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/options"
+	"go.mongodb.org/mongo-driver/bson"
+	mopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// autoEncryptionOptions builds the driver's automatic encryption options,
+// so that documents in collections with encrypted fields are decrypted when
+// read and encrypted when written.
+func autoEncryptionOptions(enc *options.Encryption) (*mopt.AutoEncryptionOptions, error) {
+	if !encryptionSupported {
+		return nil, fmt.Errorf("this build of the tools doesn't support client-side encryption; rebuild with the cse build tag")
+	}
+	providers, err := parseKMSProviders(enc.KMSProviders)
+	if err != nil {
+		return nil, err
+	}
+	autoEncryption := mopt.AutoEncryption().
+		SetKeyVaultNamespace(enc.KeyVaultNamespace).
+		SetKmsProviders(providers).
+		SetBypassAutoEncryption(enc.BypassAutoEncryption)
+	if enc.SchemaMapFile != "" {
+		schemaMap, err := readSchemaMap(enc.SchemaMapFile)
+		if err != nil {
+			return nil, err
+		}
+		autoEncryption.SetSchemaMap(schemaMap)
+	}
+	return autoEncryption, nil
+}
+
+// parseKMSProviders parses the --kmsProvider value, which is Extended JSON
+// or '@' and the name of a file holding it.
+func parseKMSProviders(value string) (map[string]map[string]interface{}, error) {
+	data, err := readJSONArg(value)
+	if err != nil {
+		return nil, fmt.Errorf("error reading --kmsProvider: %v", err)
+	}
+	var providers map[string]map[string]interface{}
+	if err = bson.UnmarshalExtJSON(data, false, &providers); err != nil {
+		return nil, fmt.Errorf("error parsing --kmsProvider as Extended JSON: %v", err)
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("--kmsProvider doesn't name a KMS provider")
+	}
+	return providers, nil
+}
+
+// readSchemaMap reads a schema map from an Extended JSON file.
+func readSchemaMap(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading --schemaMapFile: %v", err)
+	}
+	var schemaMap map[string]interface{}
+	if err = bson.UnmarshalExtJSON(data, false, &schemaMap); err != nil {
+		return nil, fmt.Errorf("error parsing --schemaMapFile as Extended JSON: %v", err)
+	}
+	for ns := range schemaMap {
+		if !strings.Contains(ns, ".") {
+			return nil, fmt.Errorf("--schemaMapFile has '%v', which is not a namespace", ns)
+		}
+	}
+	return schemaMap, nil
+}
+
+func readJSONArg(value string) ([]byte, error) {
+	if strings.HasPrefix(value, "@") {
+		return ioutil.ReadFile(value[1:])
+	}
+	return []byte(value), nil
+}
@@ -0,0 +1,13 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// +build !cse
+
+package db
+
+// encryptionSupported is false because the driver's client-side encryption
+// needs libmongocrypt, which is only linked with the cse build tag.
+const encryptionSupported = false
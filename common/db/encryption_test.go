@@ -0,0 +1,87 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/options"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClientSideEncryptionOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	const localKey = `{"local": {"key": {"$binary": {"base64": "AAAA", "subType": "00"}}}}`
+
+	Convey("With encryption options", t, func() {
+		dir, err := ioutil.TempDir("", "encryption")
+		So(err, ShouldBeNil)
+
+		Convey("KMS providers are parsed from Extended JSON", func() {
+			providers, err := parseKMSProviders(localKey)
+			So(err, ShouldBeNil)
+			So(providers, ShouldContainKey, "local")
+			So(providers["local"], ShouldContainKey, "key")
+		})
+
+		Convey("KMS providers are read from a file given with @", func() {
+			path := filepath.Join(dir, "kms.json")
+			So(ioutil.WriteFile(path, []byte(localKey), 0600), ShouldBeNil)
+			providers, err := parseKMSProviders("@" + path)
+			So(err, ShouldBeNil)
+			So(providers, ShouldContainKey, "local")
+		})
+
+		Convey("invalid or empty KMS providers are rejected", func() {
+			_, err := parseKMSProviders("{local:")
+			So(err, ShouldNotBeNil)
+			_, err = parseKMSProviders("{}")
+			So(err.Error(), ShouldContainSubstring, "doesn't name a KMS provider")
+		})
+
+		Convey("a schema map must be keyed by namespace", func() {
+			path := filepath.Join(dir, "schema.json")
+			So(ioutil.WriteFile(path, []byte(`{"test.people": {"bsonType": "object"}}`), 0600), ShouldBeNil)
+			schemaMap, err := readSchemaMap(path)
+			So(err, ShouldBeNil)
+			So(schemaMap, ShouldContainKey, "test.people")
+
+			So(ioutil.WriteFile(path, []byte(`{"people": {"bsonType": "object"}}`), 0600), ShouldBeNil)
+			_, err = readSchemaMap(path)
+			So(err.Error(), ShouldContainSubstring, "not a namespace")
+		})
+
+		Convey("incomplete options fail validation", func() {
+			enc := &options.Encryption{KeyVaultNamespace: "encryption.__keyVault"}
+			So(enc.Validate().Error(), ShouldContainSubstring, "--kmsProvider")
+			enc = &options.Encryption{KeyVaultNamespace: "keyVault", KMSProviders: localKey}
+			So(enc.Validate().Error(), ShouldContainSubstring, "<db.collection>")
+			enc = &options.Encryption{KMSProviders: localKey}
+			So(enc.Validate().Error(), ShouldContainSubstring, "--keyVaultNamespace")
+			So((&options.Encryption{}).Validate(), ShouldBeNil)
+		})
+
+		if !encryptionSupported {
+			Convey("builds without the cse tag explain how to enable encryption", func() {
+				_, err := autoEncryptionOptions(&options.Encryption{
+					KeyVaultNamespace: "encryption.__keyVault",
+					KMSProviders:      localKey,
+				})
+				So(err.Error(), ShouldContainSubstring, "cse build tag")
+			})
+		}
+
+		Reset(func() {
+			_ = os.RemoveAll(dir)
+		})
+	})
+}
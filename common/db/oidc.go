@@ -0,0 +1,309 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	driverauth "go.mongodb.org/mongo-driver/x/mongo/driver/auth"
+)
+
+// OIDCMechanism is the MONGODB-OIDC authentication mechanism.
+const OIDCMechanism = "MONGODB-OIDC"
+
+// oidcTokenFileProperty is the mechanism property that holds the path of a
+// workload token file.
+const oidcTokenFileProperty = "TOKEN_FILE"
+
+// oidcTokenFileEnv is the environment variable that workload platforms use
+// to give the path of a token file.
+const oidcTokenFileEnv = "OIDC_TOKEN_FILE"
+
+// defaultDevicePollInterval is how often the token endpoint is polled during
+// the device flow if the identity provider doesn't say.
+var defaultDevicePollInterval = 5 * time.Second
+
+var oidcHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+func init() {
+	driverauth.RegisterAuthenticatorFactory(OIDCMechanism, newOIDCAuthenticator)
+}
+
+// oidcAuthenticator authenticates with an OIDC access token. With a token
+// file it uses the workload flow, sending the token in the file. Otherwise
+// it asks the server for its identity provider and runs the OAuth device
+// flow, in which the user signs in with a browser. Tokens from the device
+// flow are reused by later connections until they expire.
+type oidcAuthenticator struct {
+	username  string
+	tokenFile string
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func newOIDCAuthenticator(cred *driverauth.Cred) (driverauth.Authenticator, error) {
+	if cred.Password != "" {
+		return nil, fmt.Errorf("a password can't be used with %v", OIDCMechanism)
+	}
+	tokenFile := cred.Props[oidcTokenFileProperty]
+	if tokenFile == "" {
+		tokenFile = os.Getenv(oidcTokenFileEnv)
+	}
+	return &oidcAuthenticator{username: cred.Username, tokenFile: tokenFile}, nil
+}
+
+// Auth authenticates a connection.
+func (a *oidcAuthenticator) Auth(ctx context.Context, cfg *driverauth.Config) error {
+	return driverauth.ConductSaslConversation(ctx, cfg, "$external", &oidcSaslClient{auth: a, ctx: ctx})
+}
+
+// cachedToken returns the token to send in the first message, if there is
+// one.
+func (a *oidcAuthenticator) cachedToken() (string, error) {
+	if a.tokenFile != "" {
+		token, err := ioutil.ReadFile(a.tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading OIDC token file: %v", err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Now().Before(a.expiry) {
+		return a.token, nil
+	}
+	return "", nil
+}
+
+// deviceToken runs the device flow against the identity provider, unless
+// another connection already has.
+func (a *oidcAuthenticator) deviceToken(ctx context.Context, idp oidcIdPInfo) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Now().Before(a.expiry) {
+		return a.token, nil
+	}
+	token, expiry, err := runDeviceFlow(ctx, idp)
+	if err != nil {
+		return "", err
+	}
+	a.token, a.expiry = token, expiry
+	return token, nil
+}
+
+// oidcIdPInfo is the identity provider that the server trusts, sent in
+// reply to the first message of the human flow.
+type oidcIdPInfo struct {
+	Issuer        string   `bson:"issuer"`
+	ClientID      string   `bson:"clientId"`
+	RequestScopes []string `bson:"requestScopes"`
+}
+
+// oidcSaslClient is a driverauth.SaslClient for one MONGODB-OIDC
+// conversation.
+type oidcSaslClient struct {
+	auth *oidcAuthenticator
+	ctx  context.Context
+	done bool
+}
+
+func (c *oidcSaslClient) Start() (string, []byte, error) {
+	token, err := c.auth.cachedToken()
+	if err != nil {
+		return OIDCMechanism, nil, err
+	}
+	if token != "" {
+		c.done = true
+		payload, err := bson.Marshal(bson.D{{Key: "jwt", Value: token}})
+		return OIDCMechanism, payload, err
+	}
+	start := bson.D{}
+	if c.auth.username != "" {
+		start = append(start, bson.E{Key: "n", Value: c.auth.username})
+	}
+	payload, err := bson.Marshal(start)
+	return OIDCMechanism, payload, err
+}
+
+func (c *oidcSaslClient) Next(challenge []byte) ([]byte, error) {
+	if c.done {
+		return nil, fmt.Errorf("unexpected %v server step", OIDCMechanism)
+	}
+	var idp oidcIdPInfo
+	if err := bson.Unmarshal(challenge, &idp); err != nil {
+		return nil, fmt.Errorf("error reading identity provider from server: %v", err)
+	}
+	if idp.Issuer == "" || idp.ClientID == "" {
+		return nil, fmt.Errorf("server didn't name an identity provider for the device flow")
+	}
+	token, err := c.auth.deviceToken(c.ctx, idp)
+	if err != nil {
+		return nil, err
+	}
+	c.done = true
+	return bson.Marshal(bson.D{{Key: "jwt", Value: token}})
+}
+
+func (c *oidcSaslClient) Completed() bool {
+	return c.done
+}
+
+// runDeviceFlow gets an access token with the OAuth 2.0 device authorization
+// grant (RFC 8628), asking the user to sign in at the identity provider.
+func runDeviceFlow(ctx context.Context, idp oidcIdPInfo) (string, time.Time, error) {
+	var discovery struct {
+		DeviceEndpoint string `json:"device_authorization_endpoint"`
+		TokenEndpoint  string `json:"token_endpoint"`
+	}
+	if err := checkIdPURL("identity provider", idp.Issuer); err != nil {
+		return "", time.Time{}, err
+	}
+	discoveryURL := strings.TrimSuffix(idp.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := oidcRequest(ctx, http.MethodGet, discoveryURL, nil, &discovery); err != nil {
+		return "", time.Time{}, fmt.Errorf("error discovering identity provider %v: %v", idp.Issuer, err)
+	}
+	if discovery.DeviceEndpoint == "" || discovery.TokenEndpoint == "" {
+		return "", time.Time{}, fmt.Errorf("identity provider %v doesn't support the device flow", idp.Issuer)
+	}
+	for _, endpoint := range []string{discovery.DeviceEndpoint, discovery.TokenEndpoint} {
+		if err := checkIdPURL("identity provider endpoint", endpoint); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+
+	var device struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+	}
+	form := url.Values{"client_id": {idp.ClientID}}
+	if len(idp.RequestScopes) > 0 {
+		form.Set("scope", strings.Join(idp.RequestScopes, " "))
+	}
+	if err := oidcRequest(ctx, http.MethodPost, discovery.DeviceEndpoint, form, &device); err != nil {
+		return "", time.Time{}, fmt.Errorf("error starting device authorization: %v", err)
+	}
+	if device.VerificationURIComplete != "" {
+		log.Logvf(log.Always, "to authenticate, visit %v", device.VerificationURIComplete)
+	} else {
+		log.Logvf(log.Always, "to authenticate, visit %v and enter the code %v", device.VerificationURI, device.UserCode)
+	}
+
+	interval := time.Duration(device.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDevicePollInterval
+	}
+	deadline := time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+	form = url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {device.DeviceCode},
+		"client_id":   {idp.ClientID},
+	}
+	for device.ExpiresIn <= 0 || time.Now().Before(deadline) {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return "", time.Time{}, ctx.Err()
+		}
+
+		var token struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+			Error       string `json:"error"`
+		}
+		err := oidcRequest(ctx, http.MethodPost, discovery.TokenEndpoint, form, &token)
+		switch {
+		case token.AccessToken != "":
+			expiry := time.Now().Add(time.Hour)
+			if token.ExpiresIn > 0 {
+				expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+			}
+			return token.AccessToken, expiry, nil
+		case token.Error == "authorization_pending":
+		case token.Error == "slow_down":
+			interval += 5 * time.Second
+		case token.Error != "":
+			return "", time.Time{}, fmt.Errorf("device authorization failed: %v", token.Error)
+		case err != nil:
+			return "", time.Time{}, fmt.Errorf("error getting access token: %v", err)
+		}
+	}
+	return "", time.Time{}, fmt.Errorf("device authorization expired before sign-in")
+}
+
+// checkIdPURL returns an error unless a URL of an identity provider, which
+// comes from the server, uses https, so that the device flow and its tokens
+// aren't sent in the clear. Loopback hosts, such as a local provider in
+// tests, may use http.
+func checkIdPURL(what, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid %v URL %v: %v", what, rawURL, err)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || net.ParseIP(host).IsLoopback() {
+			return nil
+		}
+	}
+	return fmt.Errorf("%v %v must use https", what, rawURL)
+}
+
+// oidcRequest sends a request to an identity provider and decodes the JSON
+// response into result, including the error responses of the token endpoint.
+func oidcRequest(ctx context.Context, method, endpoint string, form url.Values, result interface{}) error {
+	var body *strings.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if jsonErr := json.Unmarshal(data, result); jsonErr != nil && resp.StatusCode == http.StatusOK {
+		return fmt.Errorf("invalid response: %v", jsonErr)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v %v: %v", method, endpoint, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/options"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	driverauth "go.mongodb.org/mongo-driver/x/mongo/driver/auth"
+)
+
+func TestOIDCAuthentication(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	jwt := func(payload []byte) string {
+		var doc struct {
+			JWT string `bson:"jwt"`
+		}
+		So(bson.Unmarshal(payload, &doc), ShouldBeNil)
+		return doc.JWT
+	}
+
+	Convey("With a token file, the token is sent in the first message", t, func() {
+		tokenFile := filepath.Join(t.TempDir(), "token")
+		So(ioutil.WriteFile(tokenFile, []byte("workload-token\n"), 0600), ShouldBeNil)
+		authenticator, err := newOIDCAuthenticator(&driverauth.Cred{Props: map[string]string{oidcTokenFileProperty: tokenFile}})
+		So(err, ShouldBeNil)
+
+		client := &oidcSaslClient{auth: authenticator.(*oidcAuthenticator), ctx: context.Background()}
+		mechanism, payload, err := client.Start()
+		So(err, ShouldBeNil)
+		So(mechanism, ShouldEqual, OIDCMechanism)
+		So(jwt(payload), ShouldEqual, "workload-token")
+		So(client.Completed(), ShouldBeTrue)
+	})
+
+	Convey("Without a token file, the device flow gets a token from the identity provider", t, func() {
+		defaultDevicePollInterval = time.Millisecond
+		polls := 0
+		var deviceForm, tokenForm url.Values
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/.well-known/openid-configuration":
+				json.NewEncoder(w).Encode(map[string]string{
+					"device_authorization_endpoint": server.URL + "/device",
+					"token_endpoint":                server.URL + "/token",
+				})
+			case "/device":
+				r.ParseForm()
+				deviceForm = r.PostForm
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"device_code": "dev", "user_code": "ABCD", "verification_uri": server.URL + "/verify", "expires_in": 60,
+				})
+			case "/token":
+				r.ParseForm()
+				tokenForm = r.PostForm
+				polls++
+				if polls < 3 {
+					w.WriteHeader(http.StatusBadRequest)
+					json.NewEncoder(w).Encode(map[string]string{"error": "authorization_pending"})
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "user-token", "expires_in": 3600})
+			}
+		}))
+		defer server.Close()
+
+		authenticator, err := newOIDCAuthenticator(&driverauth.Cred{Username: "ada"})
+		So(err, ShouldBeNil)
+		client := &oidcSaslClient{auth: authenticator.(*oidcAuthenticator), ctx: context.Background()}
+		_, payload, err := client.Start()
+		So(err, ShouldBeNil)
+		var start bson.M
+		So(bson.Unmarshal(payload, &start), ShouldBeNil)
+		So(start, ShouldResemble, bson.M{"n": "ada"})
+
+		idp, err := bson.Marshal(oidcIdPInfo{Issuer: server.URL, ClientID: "tools", RequestScopes: []string{"db", "read"}})
+		So(err, ShouldBeNil)
+		payload, err = client.Next(idp)
+		So(err, ShouldBeNil)
+		So(jwt(payload), ShouldEqual, "user-token")
+		So(polls, ShouldEqual, 3)
+		So(deviceForm.Get("client_id"), ShouldEqual, "tools")
+		So(deviceForm.Get("scope"), ShouldEqual, "db read")
+		So(tokenForm.Get("device_code"), ShouldEqual, "dev")
+
+		Convey("and later connections reuse the token", func() {
+			client := &oidcSaslClient{auth: authenticator.(*oidcAuthenticator), ctx: context.Background()}
+			_, payload, err := client.Start()
+			So(err, ShouldBeNil)
+			So(jwt(payload), ShouldEqual, "user-token")
+		})
+	})
+
+	Convey("The device flow only runs over https, or http to a loopback host", t, func() {
+		for _, issuer := range []string{"https://idp.example.com", "http://127.0.0.1:8080", "http://localhost/", "http://[::1]:9000"} {
+			So(checkIdPURL("identity provider", issuer), ShouldBeNil)
+		}
+		for _, issuer := range []string{"http://idp.example.com", "http://10.0.0.1", "ftp://idp.example.com", "idp.example.com"} {
+			So(checkIdPURL("identity provider", issuer), ShouldNotBeNil)
+		}
+
+		_, _, err := runDeviceFlow(context.Background(), oidcIdPInfo{Issuer: "http://idp.example.com", ClientID: "tools"})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "must use https")
+	})
+
+	Convey("MONGODB-AWS credentials can come from the environment", t, func() {
+		toolOptions := options.New("test", "", "", "", true, options.EnabledOptions{Auth: true, Connection: true, URI: true})
+		_, err := toolOptions.ParseArgs([]string{"--authenticationMechanism", "MONGODB-AWS"})
+		So(err, ShouldBeNil)
+		So(toolOptions.GetAuthenticationDatabase(), ShouldEqual, "$external")
+		_, err = configureClient(*toolOptions)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("MONGODB-OIDC credentials use $external and don't need a password", t, func() {
+		toolOptions := options.New("test", "", "", "", true, options.EnabledOptions{Auth: true, Connection: true, URI: true})
+		_, err := toolOptions.ParseArgs([]string{"--authenticationMechanism", OIDCMechanism, "--oidcTokenFile", "/tmp/token"})
+		So(err, ShouldBeNil)
+		So(toolOptions.Auth.ShouldAskForPassword(), ShouldBeFalse)
+		So(toolOptions.GetAuthenticationDatabase(), ShouldEqual, "$external")
+
+		// the driver only accepts the mechanism with the authenticator registered
+		_, err = configureClient(*toolOptions)
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,221 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// proxyDialer connects to servers through a SOCKS5 or HTTP CONNECT proxy.
+// Host names are passed to the proxy unresolved, so hosts that only resolve
+// behind the proxy can be reached, including those found by SRV lookup.
+type proxyDialer struct {
+	proxy  *url.URL
+	dialer *net.Dialer
+}
+
+// newProxyDialer parses a proxy URL of the form
+// scheme://[user:password@]host:port, where the scheme is socks5, socks5h
+// or http.
+func newProxyDialer(proxyURL string, keepAlive time.Duration) (*proxyDialer, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme '%v', expected socks5 or http", u.Scheme)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return nil, fmt.Errorf("proxy URL must have a host and port")
+	}
+	return &proxyDialer{proxy: u, dialer: &net.Dialer{KeepAlive: keepAlive}}, nil
+}
+
+// DialContext connects to the proxy and asks it for a connection to the
+// address.
+func (pd *proxyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := pd.dialer.DialContext(ctx, "tcp", pd.proxy.Host)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to proxy %v: %v", pd.proxy.Host, err)
+	}
+	// the handshake can't be canceled directly, so bound it by the deadline
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if pd.proxy.Scheme == "http" {
+		err = pd.httpConnect(conn, address)
+	} else {
+		err = pd.socks5Connect(conn, address)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %v couldn't connect to %v: %v", pd.proxy.Host, address, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+const (
+	socks5Version        = 0x05
+	socks5NoAuth         = 0x00
+	socks5UserPass       = 0x02
+	socks5NoAcceptable   = 0xff
+	socks5Connect        = 0x01
+	socks5AddrIPv4       = 0x01
+	socks5AddrDomainName = 0x03
+	socks5AddrIPv6       = 0x04
+)
+
+var socks5Replies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// socks5Connect runs the SOCKS5 handshake (RFC 1928), with username and
+// password authentication (RFC 1929) if the proxy URL has a user.
+func (pd *proxyDialer) socks5Connect(conn net.Conn, address string) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port '%v'", portStr)
+	}
+
+	method := byte(socks5NoAuth)
+	if pd.proxy.User != nil {
+		method = socks5UserPass
+	}
+	if _, err = conn.Write([]byte{socks5Version, 1, method}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("not a SOCKS5 proxy")
+	}
+	if reply[1] == socks5NoAcceptable || reply[1] != method {
+		return fmt.Errorf("proxy doesn't accept the authentication method")
+	}
+
+	if method == socks5UserPass {
+		user := pd.proxy.User.Username()
+		password, _ := pd.proxy.User.Password()
+		if len(user) > 255 || len(password) > 255 {
+			return fmt.Errorf("proxy username and password must be at most 255 bytes")
+		}
+		auth := []byte{0x01, byte(len(user))}
+		auth = append(auth, user...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err = conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err = io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return fmt.Errorf("proxy authentication failed")
+		}
+	}
+
+	req := []byte{socks5Version, socks5Connect, 0}
+	if ip := net.ParseIP(host); ip.To4() != nil {
+		req = append(append(req, socks5AddrIPv4), ip.To4()...)
+	} else if ip != nil {
+		req = append(append(req, socks5AddrIPv6), ip...)
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("host name is too long")
+		}
+		req = append(append(req, socks5AddrDomainName, byte(len(host))), host...)
+	}
+	req = append(req, 0, 0)
+	binary.BigEndian.PutUint16(req[len(req)-2:], uint16(port))
+	if _, err = conn.Write(req); err != nil {
+		return err
+	}
+
+	// the reply has the same layout as the request, ending in the bound address
+	header := make([]byte, 4)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0 {
+		if msg, ok := socks5Replies[header[1]]; ok {
+			return fmt.Errorf("%v", msg)
+		}
+		return fmt.Errorf("SOCKS5 error %v", header[1])
+	}
+	var addrLen int
+	switch header[3] {
+	case socks5AddrIPv4:
+		addrLen = net.IPv4len
+	case socks5AddrIPv6:
+		addrLen = net.IPv6len
+	case socks5AddrDomainName:
+		if _, err = io.ReadFull(conn, header[:1]); err != nil {
+			return err
+		}
+		addrLen = int(header[0])
+	default:
+		return fmt.Errorf("unknown address type %v in reply", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, addrLen+2))
+	return err
+}
+
+// httpConnect asks an HTTP proxy to open a tunnel with the CONNECT method,
+// with basic authentication if the proxy URL has a user.
+func (pd *proxyDialer) httpConnect(conn net.Conn, address string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if pd.proxy.User != nil {
+		password, _ := pd.proxy.User.Password()
+		credentials := pd.proxy.User.Username() + ":" + password
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	// the server doesn't send anything until the driver's first message, so
+	// nothing past the response can be buffered
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// serveProxy accepts connections on a local listener and handles each one
+// with handshake, which returns the address asked for. The connection is
+// then joined to an echo server, standing in for the address.
+func serveProxy(handshake func(net.Conn) (string, error)) (string, chan string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	targets := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				target, err := handshake(conn)
+				if err != nil {
+					return
+				}
+				targets <- target
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String(), targets, func() { listener.Close() }
+}
+
+func socks5Handshake(user, password string) func(net.Conn) (string, error) {
+	return func(conn net.Conn) (string, error) {
+		buf := make([]byte, 512)
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return "", err
+		}
+		if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+			return "", err
+		}
+		if user == "" {
+			_, _ = conn.Write([]byte{5, 0})
+		} else {
+			_, _ = conn.Write([]byte{5, 2})
+			_, _ = io.ReadFull(conn, buf[:2])
+			gotUser := make([]byte, buf[1])
+			_, _ = io.ReadFull(conn, gotUser)
+			_, _ = io.ReadFull(conn, buf[:1])
+			gotPassword := make([]byte, buf[0])
+			_, _ = io.ReadFull(conn, gotPassword)
+			if string(gotUser) != user || string(gotPassword) != password {
+				_, _ = conn.Write([]byte{1, 1})
+				return "", fmt.Errorf("bad credentials")
+			}
+			_, _ = conn.Write([]byte{1, 0})
+		}
+
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+			return "", err
+		}
+		var host string
+		switch buf[3] {
+		case 1:
+			_, _ = io.ReadFull(conn, buf[:4])
+			host = net.IP(buf[:4]).String()
+		case 3:
+			_, _ = io.ReadFull(conn, buf[:1])
+			name := make([]byte, buf[0])
+			_, _ = io.ReadFull(conn, name)
+			host = string(name)
+		}
+		_, _ = io.ReadFull(conn, buf[:2])
+		port := binary.BigEndian.Uint16(buf[:2])
+		_, err := conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+		return net.JoinHostPort(host, fmt.Sprint(port)), err
+	}
+}
+
+func httpConnectHandshake(conn net.Conn) (string, error) {
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		return "", err
+	}
+	if req.Method != http.MethodConnect {
+		_, _ = conn.Write([]byte("HTTP/1.1 405 Method Not Allowed\r\n\r\n"))
+		return "", fmt.Errorf("not CONNECT")
+	}
+	if req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+		_, _ = conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+		return "", fmt.Errorf("bad credentials")
+	}
+	_, err = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	return req.Host, err
+}
+
+func TestProxyDialer(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// echo checks that a dialed connection is joined to the echo server
+	echo := func(conn net.Conn) string {
+		defer conn.Close()
+		_, _ = conn.Write([]byte("ping"))
+		reply := make([]byte, 4)
+		_, _ = io.ReadFull(conn, reply)
+		return string(reply)
+	}
+
+	Convey("With a proxy dialer", t, func() {
+		Convey("SOCKS5 passes host names to the proxy", func() {
+			addr, targets, stop := serveProxy(socks5Handshake("", ""))
+			defer stop()
+			dialer, err := newProxyDialer("socks5://"+addr, 0)
+			So(err, ShouldBeNil)
+			conn, err := dialer.DialContext(ctx, "tcp", "db.internal:27017")
+			So(err, ShouldBeNil)
+			So(echo(conn), ShouldEqual, "ping")
+			So(<-targets, ShouldEqual, "db.internal:27017")
+		})
+
+		Convey("SOCKS5 authenticates with the user in the URL", func() {
+			addr, targets, stop := serveProxy(socks5Handshake("user", "pass"))
+			defer stop()
+			dialer, err := newProxyDialer("socks5://user:pass@"+addr, 0)
+			So(err, ShouldBeNil)
+			conn, err := dialer.DialContext(ctx, "tcp", "10.0.0.1:27018")
+			So(err, ShouldBeNil)
+			So(echo(conn), ShouldEqual, "ping")
+			So(<-targets, ShouldEqual, "10.0.0.1:27018")
+
+			dialer, err = newProxyDialer("socks5://user:wrong@"+addr, 0)
+			So(err, ShouldBeNil)
+			_, err = dialer.DialContext(ctx, "tcp", "10.0.0.1:27018")
+			So(err.Error(), ShouldContainSubstring, "proxy authentication failed")
+		})
+
+		Convey("HTTP CONNECT opens a tunnel", func() {
+			addr, targets, stop := serveProxy(httpConnectHandshake)
+			defer stop()
+			dialer, err := newProxyDialer("http://user:pass@"+addr, 0)
+			So(err, ShouldBeNil)
+			conn, err := dialer.DialContext(ctx, "tcp", "db.internal:27017")
+			So(err, ShouldBeNil)
+			So(echo(conn), ShouldEqual, "ping")
+			So(<-targets, ShouldEqual, "db.internal:27017")
+
+			dialer, err = newProxyDialer("http://"+addr, 0)
+			So(err, ShouldBeNil)
+			_, err = dialer.DialContext(ctx, "tcp", "db.internal:27017")
+			So(err.Error(), ShouldContainSubstring, "407")
+		})
+
+		Convey("invalid proxy URLs are rejected", func() {
+			_, err := newProxyDialer("ftp://proxy:21", 0)
+			So(err.Error(), ShouldContainSubstring, "unsupported proxy scheme")
+			_, err = newProxyDialer("socks5://proxy", 0)
+			So(err.Error(), ShouldContainSubstring, "host and port")
+		})
+	})
+}
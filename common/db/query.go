@@ -8,10 +8,17 @@ import (
 
 // DeferredQuery represents a deferred query
 type DeferredQuery struct {
-	Coll      *mongo.Collection
-	Filter    interface{}
-	Hint      interface{}
-	LogReplay bool
+	Coll       *mongo.Collection
+	Filter     interface{}
+	Hint       interface{}
+	Projection interface{}
+	Sort       interface{}
+	LogReplay  bool
+	// Tailable requests a tailable, awaitData cursor. Only valid on capped collections.
+	Tailable bool
+	// BatchSize is the number of documents in each batch of the cursor, or 0
+	// for the server default.
+	BatchSize int32
 }
 
 // Count issues a EstimatedDocumentCount command when there is no Filter in the query and a CountDocuments command otherwise.
@@ -45,9 +52,21 @@ func (q *DeferredQuery) Iter() (*mongo.Cursor, error) {
 	if q.Hint != nil {
 		opts.SetHint(q.Hint)
 	}
+	if q.Projection != nil {
+		opts.SetProjection(q.Projection)
+	}
+	if q.Sort != nil {
+		opts.SetSort(q.Sort)
+	}
 	if q.LogReplay {
 		opts.SetOplogReplay(true)
 	}
+	if q.Tailable {
+		opts.SetCursorType(mopt.TailableAwait)
+	}
+	if q.BatchSize > 0 {
+		opts.SetBatchSize(q.BatchSize)
+	}
 	filter := q.Filter
 	if filter == nil {
 		filter = bson.D{}
@@ -0,0 +1,143 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	mopt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Replica set member states, as reported in replSetGetStatus.
+const (
+	MemberStatePrimary   = 1
+	MemberStateSecondary = 2
+)
+
+// ReplSetMember is the subset of a replSetGetStatus member document that the
+// tools make use of.
+type ReplSetMember struct {
+	Name       string    `bson:"name"`
+	State      int       `bson:"state"`
+	StateStr   string    `bson:"stateStr"`
+	Self       bool      `bson:"self"`
+	OptimeDate time.Time `bson:"optimeDate"`
+}
+
+// ReplSetStatus is the subset of the replSetGetStatus command result that the
+// tools make use of.
+type ReplSetStatus struct {
+	Set     string          `bson:"set"`
+	Date    time.Time       `bson:"date"`
+	Members []ReplSetMember `bson:"members"`
+}
+
+// GetReplSetStatus runs replSetGetStatus against the member selected by the
+// given read preference, or the client default if rp is nil.
+func (sp *SessionProvider) GetReplSetStatus(rp *readpref.ReadPref) (*ReplSetStatus, error) {
+	session, err := sp.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	opts := mopt.RunCmd()
+	if rp != nil {
+		opts.SetReadPreference(rp)
+	}
+	status := &ReplSetStatus{}
+	result := session.Database("admin").RunCommand(context.Background(), bson.M{"replSetGetStatus": 1}, opts)
+	if err = result.Err(); err != nil {
+		return nil, fmt.Errorf("error running replSetGetStatus: %v", err)
+	}
+	if err = result.Decode(status); err != nil {
+		return nil, fmt.Errorf("error decoding replSetGetStatus result: %v", err)
+	}
+	return status, nil
+}
+
+// Primary returns the primary member, or nil if there is none.
+func (s *ReplSetStatus) Primary() *ReplSetMember {
+	for i := range s.Members {
+		if s.Members[i].State == MemberStatePrimary {
+			return &s.Members[i]
+		}
+	}
+	return nil
+}
+
+// Self returns the member that answered the command, or nil if it is not listed.
+func (s *ReplSetStatus) Self() *ReplSetMember {
+	for i := range s.Members {
+		if s.Members[i].Self {
+			return &s.Members[i]
+		}
+	}
+	return nil
+}
+
+// LagOf returns how far the given member's last applied operation trails the
+// primary's. It returns zero when there is no primary or the member is ahead.
+func (s *ReplSetStatus) LagOf(member *ReplSetMember) time.Duration {
+	primary := s.Primary()
+	if primary == nil || member == nil {
+		return 0
+	}
+	lag := primary.OptimeDate.Sub(member.OptimeDate)
+	if lag < 0 {
+		return 0
+	}
+	return lag
+}
+
+// SelfLag returns the replication lag of the member that answered the command.
+func (s *ReplSetStatus) SelfLag() time.Duration {
+	return s.LagOf(s.Self())
+}
+
+// MaxSecondaryLag returns the largest replication lag among the secondaries.
+func (s *ReplSetStatus) MaxSecondaryLag() time.Duration {
+	var max time.Duration
+	for i := range s.Members {
+		if s.Members[i].State != MemberStateSecondary {
+			continue
+		}
+		if lag := s.LagOf(&s.Members[i]); lag > max {
+			max = lag
+		}
+	}
+	return max
+}
+
+// FlowControlStatus is the flowControl section of serverStatus, reported by
+// MongoDB 4.2 and later.
+type FlowControlStatus struct {
+	Enabled  bool `bson:"enabled"`
+	IsLagged bool `bson:"isLagged"`
+}
+
+// GetFlowControlStatus returns the flow control status of the primary. It
+// returns nil if the server does not report one.
+func (sp *SessionProvider) GetFlowControlStatus() (*FlowControlStatus, error) {
+	session, err := sp.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	var status struct {
+		FlowControl *FlowControlStatus `bson:"flowControl"`
+	}
+	result := session.Database("admin").RunCommand(context.Background(), bson.M{"serverStatus": 1})
+	if err = result.Err(); err != nil {
+		return nil, fmt.Errorf("error running serverStatus: %v", err)
+	}
+	if err = result.Decode(&status); err != nil {
+		return nil, fmt.Errorf("error decoding serverStatus result: %v", err)
+	}
+	return status.FlowControl, nil
+}
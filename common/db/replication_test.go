@@ -0,0 +1,47 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReplSetStatusLag(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a replSetGetStatus result", t, func() {
+		now := time.Now()
+		status := &ReplSetStatus{
+			Members: []ReplSetMember{
+				{Name: "a:1", State: MemberStatePrimary, OptimeDate: now},
+				{Name: "b:1", State: MemberStateSecondary, OptimeDate: now.Add(-3 * time.Second), Self: true},
+				{Name: "c:1", State: MemberStateSecondary, OptimeDate: now.Add(-10 * time.Second)},
+				{Name: "d:1", State: 7, OptimeDate: now.Add(-time.Hour)},
+			},
+		}
+
+		Convey("the primary and self members are found", func() {
+			So(status.Primary().Name, ShouldEqual, "a:1")
+			So(status.Self().Name, ShouldEqual, "b:1")
+		})
+
+		Convey("lag is measured against the primary", func() {
+			So(status.SelfLag(), ShouldEqual, 3*time.Second)
+			So(status.MaxSecondaryLag(), ShouldEqual, 10*time.Second)
+		})
+
+		Convey("lag is zero without a primary", func() {
+			status.Members[0].State = MemberStateSecondary
+			So(status.SelfLag(), ShouldEqual, 0)
+			So(status.MaxSecondaryLag(), ShouldEqual, 0)
+		})
+	})
+}
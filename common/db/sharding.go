@@ -0,0 +1,98 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/huimingz/mongo-tools/common/options"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Shard is the subset of a config.shards document that the tools make use of.
+type Shard struct {
+	ID   string   `bson:"_id"`
+	Host string   `bson:"host"`
+	Tags []string `bson:"tags,omitempty"`
+}
+
+// BalancerStatus is the subset of the balancerStatus command result that the
+// tools make use of.
+type BalancerStatus struct {
+	Mode              string `bson:"mode"`
+	InBalancerRound   bool   `bson:"inBalancerRound"`
+	NumBalancerRounds int64  `bson:"numBalancerRounds"`
+}
+
+// GetShard looks up a shard by name in the config database. It must be run
+// against a mongos.
+func (sp *SessionProvider) GetShard(name string) (*Shard, error) {
+	session, err := sp.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	shard := &Shard{}
+	err = session.Database("config").Collection("shards").FindOne(context.Background(), bson.M{"_id": name}).Decode(shard)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("no shard named '%v' in the cluster", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error looking up shard '%v': %v", name, err)
+	}
+	return shard, nil
+}
+
+// GetShards lists the shards of the cluster from the config database. It
+// must be run against a mongos.
+func (sp *SessionProvider) GetShards() ([]*Shard, error) {
+	session, err := sp.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := session.Database("config").Collection("shards").Find(context.Background(), bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing shards: %v", err)
+	}
+	var shards []*Shard
+	if err = cursor.All(context.Background(), &shards); err != nil {
+		return nil, fmt.Errorf("error listing shards: %v", err)
+	}
+	return shards, nil
+}
+
+// GetBalancerStatus runs balancerStatus. It must be run against a mongos.
+func (sp *SessionProvider) GetBalancerStatus() (*BalancerStatus, error) {
+	status := &BalancerStatus{}
+	if err := sp.Run(bson.M{"balancerStatus": 1}, status, "admin"); err != nil {
+		return nil, fmt.Errorf("error running balancerStatus: %v", err)
+	}
+	return status, nil
+}
+
+// ShardToolOptions returns a copy of opts that connects directly to the given
+// shard rather than to the cluster's mongos. The shard's host string has the
+// form "<replica-set>/<host>,<host>" or "<host>" for a standalone shard.
+func ShardToolOptions(opts options.ToolOptions, shard *Shard) options.ToolOptions {
+	hosts, setName := util.SplitHostArg(shard.Host)
+
+	connection := *opts.Connection
+	connection.Host = shard.Host
+	connection.Port = ""
+	opts.Connection = &connection
+
+	uri := *opts.URI
+	uri.ConnString.Hosts = hosts
+	uri.ConnString.ReplicaSet = setName
+	opts.URI = &uri
+
+	opts.ReplicaSetName = setName
+	opts.Direct = setName == "" && len(hosts) == 1
+	return opts
+}
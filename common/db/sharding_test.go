@@ -0,0 +1,57 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/options"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShardToolOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With tool options connected to a mongos", t, func() {
+		uri, err := options.NewURI("mongodb://router:27017/?appName=dump")
+		So(err, ShouldBeNil)
+		opts := options.ToolOptions{
+			URI:        uri,
+			Connection: &options.Connection{Host: "router", Port: "27017"},
+		}
+
+		Convey("a replica set shard is connected to as a replica set", func() {
+			shardOpts := ShardToolOptions(opts, &Shard{ID: "shard01", Host: "rs1/a:27018,b:27018"})
+			So(shardOpts.URI.ConnString.Hosts, ShouldResemble, []string{"a:27018", "b:27018"})
+			So(shardOpts.URI.ConnString.ReplicaSet, ShouldEqual, "rs1")
+			So(shardOpts.ReplicaSetName, ShouldEqual, "rs1")
+			So(shardOpts.Direct, ShouldBeFalse)
+
+			Convey("without changing the original options", func() {
+				So(opts.URI.ConnString.Hosts, ShouldResemble, []string{"router:27017"})
+				So(opts.Connection.Host, ShouldEqual, "router")
+			})
+		})
+
+		Convey("a standalone shard is connected to directly", func() {
+			shardOpts := ShardToolOptions(opts, &Shard{ID: "shard02", Host: "c:27019"})
+			So(shardOpts.URI.ConnString.Hosts, ShouldResemble, []string{"c:27019"})
+			So(shardOpts.ReplicaSetName, ShouldEqual, "")
+			So(shardOpts.Direct, ShouldBeTrue)
+		})
+
+		Convey("the read preference tag sets select the shard members read from", func() {
+			pref, err := NewReadPreference(`{mode: "secondary", tagSets: [{"use": "backup"}]}`, nil)
+			So(err, ShouldBeNil)
+			opts.ReadPreference = pref
+			shardOpts := ShardToolOptions(opts, &Shard{ID: "shard01", Host: "rs1/a:27018,b:27018"})
+			So(shardOpts.ReadPreference.TagSets(), ShouldHaveLength, 1)
+			So(shardOpts.ReadPreference.TagSets()[0].Contains("use", "backup"), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,186 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Limits on the writes sent in one write command: the server accepts
+// commands of up to 16KiB more than the maximum BSON document size, which
+// leaves room for a maximum size document along with the other fields of the
+// command and its comment, and at most maxWriteBatchSize writes per command.
+const (
+	maxWriteCommandBytes = 16*1024*1024 + 16*1024
+	maxWriteBatchSize    = 100000
+	// arrayElementOverhead bounds the type byte and index key of a write in
+	// the command's array of writes.
+	arrayElementOverhead = 8
+	// writeCommandOverhead bounds the fields of a write command other than
+	// its writes and comment: the command name, the collection name, the
+	// options and the write concern.
+	writeCommandOverhead = 2 * 1024
+)
+
+// MaxCommentBytes is the longest comment SetComment accepts, so that a
+// command holding a maximum size document stays within the server's limit.
+const MaxCommentBytes = 4 * 1024
+
+// writeCommand is a kind of write command and the field listing its writes.
+type writeCommand struct {
+	name  string
+	field string
+}
+
+var (
+	insertCommand = writeCommand{"insert", "documents"}
+	updateCommand = writeCommand{"update", "updates"}
+	deleteCommand = writeCommand{"delete", "deletes"}
+)
+
+// writeCommandReply is the reply to an insert, update or delete command.
+type writeCommandReply struct {
+	N         int64 `bson:"n"`
+	NModified int64 `bson:"nModified"`
+	Upserted  []struct {
+		Index int64       `bson:"index"`
+		ID    interface{} `bson:"_id"`
+	} `bson:"upserted"`
+	WriteErrors []struct {
+		Index   int      `bson:"index"`
+		Code    int      `bson:"code"`
+		Message string   `bson:"errmsg"`
+		Details bson.Raw `bson:"errInfo"`
+	} `bson:"writeErrors"`
+	WriteConcernError *struct {
+		Code    int      `bson:"code"`
+		Message string   `bson:"errmsg"`
+		Details bson.Raw `bson:"errInfo"`
+	} `bson:"writeConcernError"`
+}
+
+// commandWrite returns the kind of write command for a write model and the
+// write as it appears in the command.
+func commandWrite(model mongo.WriteModel) (writeCommand, bson.Raw, error) {
+	var kind writeCommand
+	var write interface{}
+	switch m := model.(type) {
+	case *mongo.InsertOneModel:
+		if raw, ok := m.Document.([]byte); ok {
+			return insertCommand, raw, nil
+		}
+		kind, write = insertCommand, m.Document
+	case *mongo.UpdateOneModel:
+		kind, write = updateCommand, bson.D{{"q", m.Filter}, {"u", m.Update}, {"upsert", m.Upsert != nil && *m.Upsert}}
+	case *mongo.ReplaceOneModel:
+		kind, write = updateCommand, bson.D{{"q", m.Filter}, {"u", m.Replacement}, {"upsert", m.Upsert != nil && *m.Upsert}}
+	case *mongo.DeleteOneModel:
+		kind, write = deleteCommand, bson.D{{"q", m.Filter}, {"limit", 1}}
+	default:
+		return kind, nil, fmt.Errorf("unsupported write model %T", model)
+	}
+	raw, err := bson.Marshal(write)
+	if err != nil {
+		return kind, nil, fmt.Errorf("bson encoding error: %v", err)
+	}
+	return kind, raw, nil
+}
+
+// runWriteCommand runs a write command against the primary.
+func (bb *BufferedBulkInserter) runWriteCommand(cmd bson.D, reply *writeCommandReply) error {
+	database := bb.collection.Database()
+	if wc := database.WriteConcern(); wc != nil {
+		if _, raw, err := wc.MarshalBSONValue(); err == nil {
+			cmd = append(cmd, bson.E{Key: "writeConcern", Value: bson.Raw(raw)})
+		}
+	}
+	opts := options.RunCmd().SetReadPreference(readpref.Primary())
+	return database.RunCommand(context.Background(), cmd, opts).Decode(reply)
+}
+
+// writeCommands performs the writes as insert, update and delete commands
+// rather than as a driver bulk write, so that the commands can carry a
+// comment. Consecutive writes of the same kind are sent together, and the
+// replies are combined into the result and error of a bulk write.
+func (bb *BufferedBulkInserter) writeCommands(models []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	result := &mongo.BulkWriteResult{UpsertedIDs: map[int64]interface{}{}}
+	var bwe mongo.BulkWriteException
+	limit := maxWriteCommandBytes - writeCommandOverhead - len(bb.comment)
+	for start := 0; start < len(models); {
+		kind, write, err := commandWrite(models[start])
+		if err != nil {
+			return result, err
+		}
+		writes := bson.A{write}
+		size := len(write) + arrayElementOverhead
+		end := start + 1
+		for ; end < len(models) && len(writes) < maxWriteBatchSize; end++ {
+			nextKind, next, err := commandWrite(models[end])
+			if err != nil {
+				return result, err
+			}
+			if nextKind != kind || size+len(next)+arrayElementOverhead > limit {
+				break
+			}
+			writes = append(writes, next)
+			size += len(next) + arrayElementOverhead
+		}
+
+		cmd := bson.D{{kind.name, bb.collection.Name()}, {kind.field, writes}, {"ordered", bb.ordered()}}
+		if bypass := bb.bulkWriteOpts.BypassDocumentValidation; bypass != nil && *bypass && kind != deleteCommand {
+			cmd = append(cmd, bson.E{Key: "bypassDocumentValidation", Value: true})
+		}
+		cmd = append(cmd, bson.E{Key: "comment", Value: bb.comment})
+
+		var reply writeCommandReply
+		if err = bb.runCommand(cmd, &reply); err != nil {
+			return result, err
+		}
+		switch kind {
+		case insertCommand:
+			result.InsertedCount += reply.N
+		case updateCommand:
+			result.MatchedCount += reply.N - int64(len(reply.Upserted))
+			result.ModifiedCount += reply.NModified
+			result.UpsertedCount += int64(len(reply.Upserted))
+			for _, upserted := range reply.Upserted {
+				result.UpsertedIDs[int64(start)+upserted.Index] = upserted.ID
+			}
+		case deleteCommand:
+			result.DeletedCount += reply.N
+		}
+		for _, writeErr := range reply.WriteErrors {
+			bwe.WriteErrors = append(bwe.WriteErrors, mongo.BulkWriteError{
+				WriteError: mongo.WriteError{
+					Index:   start + writeErr.Index,
+					Code:    writeErr.Code,
+					Message: writeErr.Message,
+					Details: writeErr.Details,
+				},
+				Request: models[start+writeErr.Index],
+			})
+		}
+		if wcErr := reply.WriteConcernError; wcErr != nil {
+			bwe.WriteConcernError = &mongo.WriteConcernError{Code: wcErr.Code, Message: wcErr.Message, Details: wcErr.Details}
+		}
+		if len(reply.WriteErrors) > 0 && bb.ordered() {
+			// an ordered write stops at its first error
+			break
+		}
+		start = end
+	}
+	if len(bwe.WriteErrors) > 0 || bwe.WriteConcernError != nil {
+		return result, bwe
+	}
+	return result, nil
+}
@@ -428,6 +428,18 @@ func (mgr *Manager) NormalIntents() []*Intent {
 	return allIntents
 }
 
+// NormalIntentsBySource returns the normal intents in the manager keyed by
+// the source namespace they were put with, which differs from the intent's
+// own namespace when it is renamed.
+// NormalIntentsBySource is not thread safe.
+func (mgr *Manager) NormalIntentsBySource() map[string]*Intent {
+	bySource := make(map[string]*Intent, len(mgr.intents))
+	for ns, intent := range mgr.intents {
+		bySource[ns] = intent
+	}
+	return bySource
+}
+
 func (mgr *Manager) IntentForNamespace(ns string) *Intent {
 	intent := mgr.intents[ns]
 	if intent != nil {
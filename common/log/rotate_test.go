@@ -0,0 +1,81 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package log
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogFile(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a log file", t, func() {
+		dir, err := ioutil.TempDir("", "logfile")
+		So(err, ShouldBeNil)
+		path := filepath.Join(dir, "tool.log")
+		read := func(path string) string {
+			data, _ := ioutil.ReadFile(path)
+			return string(data)
+		}
+
+		Convey("the file is rotated when it grows past its size", func() {
+			rf, err := NewRotatingFile(path, 10, 2)
+			So(err, ShouldBeNil)
+			for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+				_, err = rf.Write([]byte(line))
+				So(err, ShouldBeNil)
+			}
+			So(rf.Close(), ShouldBeNil)
+
+			So(read(path), ShouldEqual, "fourth\n")
+			So(read(path+".1"), ShouldEqual, "third\n")
+			So(read(path+".2"), ShouldEqual, "second\n")
+			_, err = os.Stat(path + ".3")
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("an existing file is appended to, and never rotated without a size", func() {
+			So(ioutil.WriteFile(path, []byte("earlier run\n"), 0600), ShouldBeNil)
+			rf, err := NewRotatingFile(path, 0, 2)
+			So(err, ShouldBeNil)
+			_, err = rf.Write([]byte("this run\n"))
+			So(err, ShouldBeNil)
+			So(rf.Close(), ShouldBeNil)
+			So(read(path), ShouldEqual, "earlier run\nthis run\n")
+		})
+
+		Convey("the file has its own verbosity", func() {
+			stderr := &bytes.Buffer{}
+			tl := NewToolLogger(&verbosity{Q: true})
+			tl.SetWriter(stderr)
+			rf, err := NewRotatingFile(path, 0, 0)
+			So(err, ShouldBeNil)
+			tl.SetFileWriter(rf, DebugLow)
+
+			tl.Logvf(Always, "progress")
+			tl.Logvf(DebugLow, "debug detail")
+			tl.Logvf(DebugHigh, "too much detail")
+			So(rf.Close(), ShouldBeNil)
+
+			So(stderr.Len(), ShouldEqual, 0)
+			So(read(path), ShouldContainSubstring, "progress")
+			So(read(path), ShouldContainSubstring, "debug detail")
+			So(read(path), ShouldNotContainSubstring, "too much detail")
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+	})
+}
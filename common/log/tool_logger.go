@@ -8,9 +8,13 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
@@ -25,8 +29,22 @@ const (
 
 const (
 	ToolTimeFormat = "2006-01-02T15:04:05.000-0700"
+	JSONTimeFormat = "2006-01-02T15:04:05.000Z07:00"
 )
 
+// Log output formats
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+// levelNames are the names of the verbosity levels in JSON log records.
+var levelNames = []string{"always", "info", "debugLow", "debugHigh"}
+
+// Fields are structured values attached to a log message. They are only
+// written in JSON log records.
+type Fields map[string]interface{}
+
 //// Tool Logger Definition
 
 type ToolLogger struct {
@@ -34,6 +52,12 @@ type ToolLogger struct {
 	writer    io.Writer
 	format    string
 	verbosity int
+	json      bool
+	tool      string
+
+	// an optional log file with its own verbosity
+	fileWriter    io.Writer
+	fileVerbosity int
 }
 
 type VerbosityLevel interface {
@@ -41,6 +65,12 @@ type VerbosityLevel interface {
 	IsQuiet() bool
 }
 
+// LogFormatter is implemented by verbosity settings that also choose the
+// format of log output.
+type LogFormatter interface {
+	LogFormat() string
+}
+
 func (tl *ToolLogger) SetVerbosity(level VerbosityLevel) {
 	if level == nil {
 		tl.verbosity = 0
@@ -52,6 +82,20 @@ func (tl *ToolLogger) SetVerbosity(level VerbosityLevel) {
 	} else {
 		tl.verbosity = level.Level()
 	}
+	if formatter, ok := level.(LogFormatter); ok {
+		tl.SetLogFormat(formatter.LogFormat())
+	}
+}
+
+// SetLogFormat sets whether log messages are written as text or as JSON
+// records.
+func (tl *ToolLogger) SetLogFormat(logFormat string) {
+	tl.json = logFormat == JSONFormat
+}
+
+// SetToolName sets the tool named in JSON log records.
+func (tl *ToolLogger) SetToolName(tool string) {
+	tl.tool = tool
 }
 
 func (tl *ToolLogger) SetWriter(writer io.Writer) {
@@ -67,10 +111,24 @@ func (tl *ToolLogger) Logvf(minVerb int, format string, a ...interface{}) {
 		panic("cannot set a minimum log verbosity that is less than 0")
 	}
 
-	if minVerb <= tl.verbosity {
+	if tl.enabled(minVerb) {
 		tl.mutex.Lock()
 		defer tl.mutex.Unlock()
-		tl.log(fmt.Sprintf(format, a...))
+		tl.log(minVerb, fmt.Sprintf(format, a...), nil)
+	}
+}
+
+// LogvfWithFields logs a message along with structured fields, which are
+// included in JSON log records.
+func (tl *ToolLogger) LogvfWithFields(minVerb int, fields Fields, format string, a ...interface{}) {
+	if minVerb < 0 {
+		panic("cannot set a minimum log verbosity that is less than 0")
+	}
+
+	if tl.enabled(minVerb) {
+		tl.mutex.Lock()
+		defer tl.mutex.Unlock()
+		tl.log(minVerb, fmt.Sprintf(format, a...), fields)
 	}
 }
 
@@ -79,15 +137,103 @@ func (tl *ToolLogger) Logv(minVerb int, msg string) {
 		panic("cannot set a minimum log verbosity that is less than 0")
 	}
 
-	if minVerb <= tl.verbosity {
+	if tl.enabled(minVerb) {
 		tl.mutex.Lock()
 		defer tl.mutex.Unlock()
-		tl.log(msg)
+		tl.log(minVerb, msg, nil)
 	}
 }
 
-func (tl *ToolLogger) log(msg string) {
-	fmt.Fprintf(tl.writer, "%v\t%v\n", time.Now().Format(tl.format), msg)
+// SetFileWriter sets a second writer, such as a log file, that is written
+// messages up to its own verbosity. A nil writer removes it.
+func (tl *ToolLogger) SetFileWriter(writer io.Writer, verbosity int) {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+	tl.fileWriter = writer
+	tl.fileVerbosity = verbosity
+}
+
+// enabled returns whether a message of the verbosity is written anywhere.
+func (tl *ToolLogger) enabled(minVerb int) bool {
+	return minVerb <= tl.verbosity || (tl.fileWriter != nil && minVerb <= tl.fileVerbosity)
+}
+
+func (tl *ToolLogger) log(minVerb int, msg string, fields Fields) {
+	line := tl.formatLine(minVerb, msg, fields)
+	if minVerb <= tl.verbosity {
+		tl.writer.Write(line)
+	}
+	if tl.fileWriter != nil && minVerb <= tl.fileVerbosity {
+		tl.fileWriter.Write(line)
+	}
+}
+
+// formatLine formats a message as a line of text or a JSON record.
+func (tl *ToolLogger) formatLine(minVerb int, msg string, fields Fields) []byte {
+	if !tl.json {
+		return []byte(fmt.Sprintf("%v\t%v\n", time.Now().Format(tl.format), msg))
+	}
+
+	record := struct {
+		Timestamp string `json:"timestamp"`
+		Level     string `json:"level"`
+		Tool      string `json:"tool"`
+		Component string `json:"component"`
+		Message   string `json:"message"`
+		Fields    Fields `json:"fields,omitempty"`
+	}{
+		Timestamp: time.Now().Format(JSONTimeFormat),
+		Level:     levelNames[len(levelNames)-1],
+		Tool:      tl.tool,
+		Component: callerComponent(),
+		Message:   strings.TrimRight(msg, "\n"),
+		Fields:    fields,
+	}
+	if minVerb < len(levelNames) {
+		record.Level = levelNames[minVerb]
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		// fall back to the text of values that can't be marshaled
+		record.Fields = make(Fields, len(fields))
+		for key, value := range fields {
+			record.Fields[key] = fmt.Sprint(value)
+		}
+		line, _ = json.Marshal(record)
+	}
+	return append(line, '\n')
+}
+
+// callerComponent returns the name of the package that logged a message,
+// e.g. "mongorestore" or "db".
+func callerComponent() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		// the package path ends at the first '.' after the last '/'
+		pkg, function := frame.Function, ""
+		if dot := strings.Index(pkg[strings.LastIndex(pkg, "/")+1:], "."); dot >= 0 {
+			dot += strings.LastIndex(pkg, "/") + 1
+			pkg, function = pkg[:dot], pkg[dot+1:]
+		}
+		if !strings.HasSuffix(pkg, "common/log") || !isLoggingFunction(function) {
+			return pkg[strings.LastIndex(pkg, "/")+1:]
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// isLoggingFunction returns whether a function of this package is part of
+// writing a log message, rather than its caller.
+func isLoggingFunction(function string) bool {
+	switch function {
+	case "Logvf", "Logv", "LogvfWithFields":
+		return true
+	}
+	return strings.HasPrefix(function, "(*ToolLogger).") || strings.HasPrefix(function, "(*toolLogWriter).")
 }
 
 func NewToolLogger(verbosity VerbosityLevel) *ToolLogger {
@@ -95,6 +241,7 @@ func NewToolLogger(verbosity VerbosityLevel) *ToolLogger {
 		mutex:  &sync.Mutex{},
 		writer: os.Stderr, // default to stderr
 		format: ToolTimeFormat,
+		tool:   strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe"),
 	}
 	tl.SetVerbosity(verbosity)
 	return tl
@@ -134,7 +281,7 @@ func init() {
 // IsInVerbosity returns true if the current verbosity level setting is
 // greater than or equal to the given level.
 func IsInVerbosity(minVerb int) bool {
-	return minVerb <= globalToolLogger.verbosity
+	return globalToolLogger.enabled(minVerb)
 }
 
 func Logvf(minVerb int, format string, a ...interface{}) {
@@ -145,6 +292,10 @@ func Logv(minVerb int, msg string) {
 	globalToolLogger.Logv(minVerb, msg)
 }
 
+func LogvfWithFields(minVerb int, fields Fields, format string, a ...interface{}) {
+	globalToolLogger.LogvfWithFields(minVerb, fields, format, a...)
+}
+
 func SetVerbosity(verbosity VerbosityLevel) {
 	globalToolLogger.SetVerbosity(verbosity)
 }
@@ -157,6 +308,26 @@ func SetDateFormat(dateFormat string) {
 	globalToolLogger.SetDateFormat(dateFormat)
 }
 
+// SetLogFile also logs messages up to a verbosity to a file, which is rotated
+// when it grows past maxSize bytes, keeping maxBackups earlier files. A
+// maxSize of 0 turns off rotation.
+func SetLogFile(path string, verbosity int, maxSize int64, maxBackups int) error {
+	file, err := NewRotatingFile(path, maxSize, maxBackups)
+	if err != nil {
+		return err
+	}
+	globalToolLogger.SetFileWriter(file, verbosity)
+	return nil
+}
+
+func SetLogFormat(logFormat string) {
+	globalToolLogger.SetLogFormat(logFormat)
+}
+
+func SetToolName(tool string) {
+	globalToolLogger.SetToolName(tool)
+}
+
 func Writer(minVerb int) io.Writer {
 	return globalToolLogger.Writer(minVerb)
 }
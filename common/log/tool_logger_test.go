@@ -8,6 +8,7 @@ package log
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"strings"
 	"testing"
@@ -130,3 +131,64 @@ func TestToolLoggerWriter(t *testing.T) {
 		})
 	})
 }
+
+type formattedVerbosity struct {
+	verbosity
+	F string
+}
+
+func (v formattedVerbosity) LogFormat() string { return v.F }
+
+func TestJSONLogFormat(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a tool logger that writes JSON records", t, func() {
+		buff := &bytes.Buffer{}
+		tl := NewToolLogger(formattedVerbosity{verbosity{L: 1}, JSONFormat})
+		tl.SetWriter(buff)
+		tl.SetToolName("mongotest")
+
+		Convey("each message is written as one record", func() {
+			tl.Logvf(Info, "restored %v documents", 5)
+			tl.LogvfWithFields(Always, Fields{"ns": "test.foo", "documents": 5}, "done with %v\n", "test.foo")
+			tl.Logvf(DebugLow, "too verbose to be written")
+
+			lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+			So(len(lines), ShouldEqual, 2)
+
+			var record struct {
+				Timestamp string                 `json:"timestamp"`
+				Level     string                 `json:"level"`
+				Tool      string                 `json:"tool"`
+				Component string                 `json:"component"`
+				Message   string                 `json:"message"`
+				Fields    map[string]interface{} `json:"fields"`
+			}
+			So(json.Unmarshal([]byte(lines[0]), &record), ShouldBeNil)
+			So(record.Level, ShouldEqual, "info")
+			So(record.Tool, ShouldEqual, "mongotest")
+			So(record.Component, ShouldEqual, "log")
+			So(record.Message, ShouldEqual, "restored 5 documents")
+			So(record.Fields, ShouldBeNil)
+			_, err := time.Parse(JSONTimeFormat, record.Timestamp)
+			So(err, ShouldBeNil)
+
+			So(json.Unmarshal([]byte(lines[1]), &record), ShouldBeNil)
+			So(record.Level, ShouldEqual, "always")
+			So(record.Message, ShouldEqual, "done with test.foo")
+			So(record.Fields, ShouldResemble, map[string]interface{}{"ns": "test.foo", "documents": 5.0})
+		})
+
+		Convey("values that can't be marshaled are written as text", func() {
+			tl.LogvfWithFields(Always, Fields{"ch": make(chan int)}, "odd field")
+			So(buff.String(), ShouldContainSubstring, `"ch":"0x`)
+		})
+
+		Convey("text format can be restored", func() {
+			tl.SetLogFormat(TextFormat)
+			tl.LogvfWithFields(Always, Fields{"ns": "test.foo"}, "plain message")
+			So(buff.String(), ShouldContainSubstring, "\tplain message\n")
+			So(buff.String(), ShouldNotContainSubstring, "test.foo")
+		})
+	})
+}
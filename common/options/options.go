@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
 	"runtime"
 	"strconv"
@@ -26,6 +28,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/wiremessage"
 	"gopkg.in/yaml.v2"
 )
 
@@ -67,6 +70,7 @@ type ToolOptions struct {
 	*SSL
 	*Auth
 	*Kerberos
+	*Encryption
 	*Namespace
 
 	// Force direct connection to the server and disable the
@@ -96,6 +100,15 @@ type ToolOptions struct {
 
 	// Will attempt to parse positional arguments as connection strings if true
 	parsePositionalArgsAsURI bool
+
+	// Arguments from the config file and environment, parsed before the
+	// command line
+	presetArgs []string
+
+	// Whether a connection string comes from a profile, the config file or
+	// the environment rather than the command line, so that a positional
+	// connection string replaces it
+	presetURI bool
 }
 
 type Namespace struct {
@@ -113,6 +126,7 @@ type General struct {
 	Help       bool   `long:"help" description:"print usage"`
 	Version    bool   `long:"version" description:"print the tool version and exit"`
 	ConfigPath string `long:"config" description:"path to a configuration file"`
+	Profile    string `long:"profile" value-name:"<name>" description:"name of a connection profile in ~/.mongotools/profiles.yaml"`
 
 	MaxProcs   int    `long:"numThreads" hidden:"true"`
 	Failpoints string `long:"failpoints" hidden:"true"`
@@ -121,15 +135,40 @@ type General struct {
 
 // Struct holding verbosity-related options
 type Verbosity struct {
-	SetVerbosity func(string) `short:"v" long:"verbose" value-name:"<level>" description:"more detailed log output (include multiple times for more verbosity, e.g. -vvvvv, or specify a numeric value, e.g. --verbose=N)" optional:"true" optional-value:""`
-	Quiet        bool         `long:"quiet" description:"hide all log output"`
-	VLevel       int          `no-flag:"true"`
+	SetVerbosity      func(string) `short:"v" long:"verbose" value-name:"<level>" description:"more detailed log output (include multiple times for more verbosity, e.g. -vvvvv, or specify a numeric value, e.g. --verbose=N)" optional:"true" optional-value:""`
+	Quiet             bool         `long:"quiet" description:"hide all log output"`
+	LogOutput         string       `long:"logFormat" value-name:"<format>" choice:"text" choice:"json" default:"text" description:"format of log output: text, or json for one structured record per line"`
+	LogFile           string       `long:"logFile" value-name:"<filename>" description:"also write log output to a file, which is rotated as it grows"`
+	LogFileVerbosity  int          `long:"logFileVerbosity" value-name:"<level>" default:"-1" default-mask:"-" description:"verbosity of the log file, like --verbose=N and not affected by --quiet (default: the --verbose level)"`
+	LogFileMaxSize    int          `long:"logFileMaxSize" value-name:"<megabytes>" default:"100" description:"size at which the log file is rotated; 0 never rotates it"`
+	LogFileMaxBackups int          `long:"logFileMaxBackups" value-name:"<count>" default:"5" description:"number of rotated log files to keep"`
+	VLevel            int          `no-flag:"true"`
 }
 
 func (v Verbosity) Level() int {
 	return v.VLevel
 }
 
+// LogFormat returns the format of log output, text or json.
+func (v Verbosity) LogFormat() string {
+	return v.LogOutput
+}
+
+// openLogFile starts logging to the --logFile, if one is given.
+func (v *Verbosity) openLogFile() error {
+	if v == nil || v.LogFile == "" {
+		return nil
+	}
+	if v.LogFileVerbosity < -1 || v.LogFileMaxSize < 0 || v.LogFileMaxBackups < 0 {
+		return fmt.Errorf("--logFileVerbosity, --logFileMaxSize and --logFileMaxBackups can't be negative")
+	}
+	verbosity := v.LogFileVerbosity
+	if verbosity == -1 {
+		verbosity = v.VLevel
+	}
+	return log.SetLogFile(v.LogFile, verbosity, int64(v.LogFileMaxSize)*1024*1024, v.LogFileMaxBackups)
+}
+
 func (v Verbosity) IsQuiet() bool {
 	return v.Quiet
 }
@@ -152,6 +191,11 @@ type Connection struct {
 	TCPKeepAliveSeconds    int    `long:"TCPKeepAliveSeconds" default:"30" hidden:"true" description:"seconds between TCP keep alives"`
 	ServerSelectionTimeout int    `long:"serverSelectionTimeout" hidden:"true" description:"seconds to wait for server selection; 0 means driver default"`
 	Compressors            string `long:"compressors" default:"none" hidden:"true" value-name:"<snappy,...>" description:"comma-separated list of compressors to enable. Use 'none' to disable."`
+	NetworkCompressors     string `long:"networkCompressors" value-name:"<zstd,snappy,zlib>" description:"comma-separated list of compressors to offer the server for network traffic, in order of preference"`
+	ZlibLevel              *int   `long:"zlibCompressionLevel" value-name:"<-1..9>" description:"zlib compression level, when zlib is the network compressor; -1 is zlib's default"`
+	ConnectRetries         int    `long:"connectRetries" value-name:"<count>" default:"0" default-mask:"-" description:"number of times to retry connecting to the server at startup"`
+	ConnectBackoff         int    `long:"connectBackoff" value-name:"<seconds>" default:"1" default-mask:"-" description:"seconds to wait before the first connection retry, doubling for each retry up to a minute (default 1)"`
+	Proxy                  string `long:"proxy" value-name:"<scheme://[user:password@]host:port>" description:"connect through a SOCKS5 (socks5://) or HTTP CONNECT (http://) proxy; host names are resolved by the proxy"`
 }
 
 // Struct holding ssl-related options
@@ -174,6 +218,7 @@ type Auth struct {
 	Source          string `long:"authenticationDatabase" value-name:"<database-name>" description:"database that holds the user's credentials"`
 	Mechanism       string `long:"authenticationMechanism" value-name:"<mechanism>" description:"authentication mechanism to use"`
 	AWSSessionToken string `long:"awsSessionToken" value-name:"<aws-session-token>" description:"session token to authenticate via AWS IAM"`
+	OIDCTokenFile   string `long:"oidcTokenFile" value-name:"<path>" description:"file holding the access token to authenticate with MONGODB-OIDC, re-read for each connection; without it, the device flow asks you to sign in with a browser"`
 }
 
 // Struct for Kerberos/GSSAPI-specific options
@@ -181,6 +226,36 @@ type Kerberos struct {
 	Service     string `long:"gssapiServiceName" value-name:"<service-name>" description:"service name to use when authenticating using GSSAPI/Kerberos (default: mongodb)"`
 	ServiceHost string `long:"gssapiHostName" value-name:"<host-name>" description:"hostname to use when authenticating using GSSAPI/Kerberos (default: <remote server's address>)"`
 }
+
+// Struct for client-side field level encryption options
+type Encryption struct {
+	KeyVaultNamespace    string `long:"keyVaultNamespace" value-name:"<db.collection>" description:"namespace of the key vault collection that holds the data encryption keys; enables automatic encryption and decryption"`
+	KMSProviders         string `long:"kmsProvider" value-name:"<json>|@<file>" description:"KMS provider credentials as Extended JSON, e.g. '{\"local\": {\"key\": {\"$binary\": ...}}}', or @ and the name of a file holding them"`
+	SchemaMapFile        string `long:"schemaMapFile" value-name:"<file>" description:"Extended JSON file mapping namespaces to the JSON schemas of their encrypted fields, instead of the schemas on the server"`
+	BypassAutoEncryption bool   `long:"bypassAutoEncryption" description:"decrypt documents that are read, but don't encrypt documents that are written"`
+}
+
+// IsSet returns true if automatic encryption was asked for.
+func (enc *Encryption) IsSet() bool {
+	return enc != nil && *enc != Encryption{}
+}
+
+// Validate returns an error if the encryption options are incomplete.
+func (enc *Encryption) Validate() error {
+	if !enc.IsSet() {
+		return nil
+	}
+	switch {
+	case enc.KeyVaultNamespace == "":
+		return fmt.Errorf("--keyVaultNamespace is required for client-side encryption")
+	case !strings.Contains(enc.KeyVaultNamespace, "."):
+		return fmt.Errorf("--keyVaultNamespace must be of the form <db.collection>")
+	case enc.KMSProviders == "":
+		return fmt.Errorf("--kmsProvider is required for client-side encryption")
+	}
+	return nil
+}
+
 type WriteConcern struct {
 	// Specifies the write concern for each write operation that mongofiles writes to the target database.
 	// By default, mongofiles waits for a majority of members from the replica set to respond before returning.
@@ -227,6 +302,7 @@ func New(appName, versionStr, gitCommit, usageStr string, parsePositionalArgsAsU
 		Auth:       &Auth{},
 		Namespace:  &Namespace{},
 		Kerberos:   &Kerberos{},
+		Encryption: &Encryption{},
 		parser: flags.NewNamedParser(
 			fmt.Sprintf("%v %v", appName, usageStr), flags.None),
 		enabledOptions:           enabled,
@@ -268,6 +344,9 @@ func New(appName, versionStr, gitCommit, usageStr string, parsePositionalArgsAsU
 		if _, err := opts.parser.AddGroup("ssl options", "", opts.SSL); err != nil {
 			panic(fmt.Errorf("couldn't register SSL options: %v", err))
 		}
+		if _, err := opts.parser.AddGroup("client-side encryption options", "", opts.Encryption); err != nil {
+			panic(fmt.Errorf("couldn't register encryption options: %v", err))
+		}
 	}
 
 	if enabled.Auth {
@@ -362,7 +441,8 @@ type URISetter interface {
 }
 
 func (auth *Auth) RequiresExternalDB() bool {
-	return auth.Mechanism == "GSSAPI" || auth.Mechanism == "PLAIN" || auth.Mechanism == "MONGODB-X509"
+	return auth.Mechanism == "GSSAPI" || auth.Mechanism == "PLAIN" || auth.Mechanism == "MONGODB-X509" ||
+		auth.Mechanism == "MONGODB-AWS" || auth.Mechanism == "MONGODB-OIDC"
 }
 
 func (auth *Auth) IsSet() bool {
@@ -371,9 +451,10 @@ func (auth *Auth) IsSet() bool {
 
 // ShouldAskForPassword returns true if the user specifies a username flag
 // but no password, and the authentication mechanism requires a password.
+// For MONGODB-AWS, the password is the secret access key of the username.
 func (auth *Auth) ShouldAskForPassword() bool {
 	return auth.Username != "" && auth.Password == "" &&
-		!(auth.Mechanism == "MONGODB-X509" || auth.Mechanism == "GSSAPI")
+		!(auth.Mechanism == "MONGODB-X509" || auth.Mechanism == "GSSAPI" || auth.Mechanism == "MONGODB-OIDC")
 }
 
 func NewURI(unparsed string) (*URI, error) {
@@ -449,7 +530,9 @@ func (opts *ToolOptions) ParseArgs(args []string) ([]string, error) {
 		return []string{}, err
 	}
 
-	args, err := opts.parser.ParseArgs(args)
+	// options from the config file and environment come first, so that
+	// the command line overrides them
+	args, err := opts.parser.ParseArgs(append(append([]string{}, opts.presetArgs...), args...))
 	if err != nil {
 		return []string{}, err
 	}
@@ -472,6 +555,11 @@ func (opts *ToolOptions) ParseArgs(args []string) ([]string, error) {
 		return []string{}, err
 	}
 
+	err = opts.Verbosity.openLogFile()
+	if err != nil {
+		return []string{}, err
+	}
+
 	return args, err
 }
 
@@ -482,6 +570,7 @@ func LogSensitiveOptionWarnings(args []string) {
 	passwordMsg := "WARNING: On some systems, a password provided directly using " +
 		"--password may be visible to system status programs such as `ps` that may be " +
 		"invoked by other users. Consider omitting the password to provide it via stdin, " +
+		"using the MONGOTOOLS_PASSWORD environment variable, " +
 		"or using the --config option to specify a configuration file with the password."
 
 	uriMsg := "WARNING: On some systems, a password provided directly in a connection string " +
@@ -525,55 +614,345 @@ func LogSensitiveOptionWarnings(args []string) {
 	}
 }
 
-// ParseConfigFile iterates over args to find a --config option. If not found, we return.
-// If found, we read the contents of the specified config file in YAML format. We parse
-// any values corresponding to --password, --uri and --sslPEMKeyPassword, and store them
-// in the opts.
+// EnvPrefix is the prefix of the environment variables that set options.
+// Any option can be set with the variable named by the prefix followed by
+// the upper-cased long name of the option, e.g. MONGOTOOLS_USERNAME for
+// --username.
+const EnvPrefix = "MONGOTOOLS_"
+
+// configSecrets are the config file fields holding credentials, which are
+// accepted even by tools without the options.
+var configSecrets = []string{"password", "uri", "sslPEMKeyPassword", "destinationPassword"}
+
+// ProfilesPath returns the path of the file holding the connection
+// profiles. It is a variable so that tests can replace it.
+var ProfilesPath = func() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".mongotools", "profiles.yaml"), nil
+}
+
+// ParseConfigFile iterates over args to find the --config and --profile
+// options, which may also be given by the MONGOTOOLS_CONFIG and
+// MONGOTOOLS_PROFILE environment variables. If neither is found, only the
+// environment is used. A config file is in YAML format and maps the long
+// names of options to their values. A profile is a mapping of the same form,
+// found by its name in the profiles file. Values for --password, --uri and
+// --sslPEMKeyPassword are stored in the opts. The other values are kept as
+// arguments that ParseArgs parses before the command line. The command line
+// takes precedence over the environment, which takes precedence over the
+// config file, which takes precedence over the profile: an option given by a
+// source replaces its value from the sources below it, so a later source can
+// set a boolean to false or replace the values of a repeated option.
 // This also applies to --destinationPassword for mongomirror only.
 func (opts *ToolOptions) ParseConfigFile(args []string) error {
-	// Get config file path from the arguments, if specified.
-	_, err := opts.parser.ParseArgs(args)
+	envSettings, err := opts.environmentSettings()
+	if err != nil {
+		return err
+	}
+	commandLine, err := opts.commandLineOptions(args)
+	if err != nil {
+		return err
+	}
+	opts.presetArgs = presetArgs(commandLine, envSettings)
+
+	// Get config file path and profile from the arguments, if specified.
+	_, err = opts.parser.ParseArgs(append(append([]string{}, opts.presetArgs...), args...))
 	if err != nil {
 		return err
 	}
 
-	// No --config option was specified.
-	if opts.General.ConfigPath == "" {
+	var profileSettings, fileSettings []optionSetting
+	if opts.General.Profile != "" {
+		profileSettings, err = opts.parseProfile(opts.General.Profile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.General.ConfigPath != "" {
+		// --config option specifies a file path.
+		configBytes, err := ioutil.ReadFile(opts.General.ConfigPath)
+		if err != nil {
+			return errors.Wrapf(err, "error opening file with --config")
+		}
+		source := "config file " + opts.General.ConfigPath
+		fileSettings, err = opts.parseSettings(source, configBytes)
+		if err != nil {
+			return err
+		}
+		warnIfReadable(source, opts.General.ConfigPath, configBytes)
+	}
+
+	opts.presetArgs = presetArgs(commandLine, profileSettings, fileSettings, envSettings)
+	opts.presetURI = !commandLine["uri"]
+	return nil
+}
+
+// commandLineOptions returns the long names of the options given in args.
+func (opts *ToolOptions) commandLineOptions(args []string) (map[string]bool, error) {
+	if _, err := opts.parser.ParseArgs(args); err != nil {
+		return nil, err
+	}
+	given := map[string]bool{}
+	opts.eachOption(func(option *flags.Option) error {
+		if option.IsSet() && !option.IsSetDefault() && option.LongName != "" {
+			given[option.LongName] = true
+		}
 		return nil
+	})
+	return given, nil
+}
+
+// parseProfile reads the named profile from the profiles file and returns
+// its settings.
+func (opts *ToolOptions) parseProfile(name string) ([]optionSetting, error) {
+	path, err := ProfilesPath()
+	if err != nil {
+		return nil, fmt.Errorf("error finding profiles file: %v", err)
+	}
+	profilesBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening profiles file for --profile")
+	}
+
+	var profiles yaml.MapSlice
+	err = yaml.UnmarshalStrict(profilesBytes, &profiles)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing profiles file %s", path)
+	}
+	var names []string
+	for _, item := range profiles {
+		if fmt.Sprint(item.Key) != name {
+			names = append(names, fmt.Sprint(item.Key))
+			continue
+		}
+		settings, ok := item.Value.(yaml.MapSlice)
+		if !ok && item.Value != nil {
+			return nil, fmt.Errorf("error parsing profiles file %s: profile '%v' is not a mapping of options", path, name)
+		}
+		// the profile is parsed like a config file of its own
+		profileBytes, err := yaml.Marshal(settings)
+		if err != nil {
+			return nil, err
+		}
+		source := fmt.Sprintf("profile '%v' in %s", name, path)
+		profileSettings, err := opts.parseSettings(source, profileBytes)
+		if err != nil {
+			return nil, err
+		}
+		warnIfReadable(source, path, profileBytes)
+		return profileSettings, nil
 	}
+	return nil, fmt.Errorf("no profile '%v' in %s, which has: %v", name, path, strings.Join(names, ", "))
+}
 
-	// --config option specifies a file path.
-	configBytes, err := ioutil.ReadFile(opts.General.ConfigPath)
+// parseSettings parses YAML that maps the long names of options to their
+// values. Credentials are stored in the opts, and the settings of the other
+// options are returned.
+func (opts *ToolOptions) parseSettings(source string, configBytes []byte) ([]optionSetting, error) {
+	// Unmarshal the settings as a top-level YAML mapping.
+	var config yaml.MapSlice
+	err := yaml.UnmarshalStrict(configBytes, &config)
 	if err != nil {
-		return errors.Wrapf(err, "error opening file with --config")
+		return nil, errors.Wrapf(err, "error parsing %s", source)
 	}
 
-	// Unmarshal the config file as a top-level YAML file.
-	var config struct {
+	var settings []optionSetting
+	seen := map[string]bool{}
+	for _, item := range config {
+		key := fmt.Sprint(item.Key)
+		if seen[key] {
+			return nil, fmt.Errorf("error parsing %s: '%v' is given more than once", source, key)
+		}
+		seen[key] = true
+		if util.StringSliceContains(configSecrets, key) {
+			continue
+		}
+		option := opts.parser.FindOptionByLongName(key)
+		if option == nil || key == "config" || key == "profile" {
+			return nil, fmt.Errorf("error parsing %s: unsupported option '%v'", source, key)
+		}
+		values, err := configValues(item.Value)
+		if err == nil {
+			settings, err = appendOptionSetting(settings, option, values)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: invalid value for '%v': %v", source, key, err)
+		}
+	}
+
+	// Unmarshal the credentials again as strings, keeping them as written.
+	var secrets struct {
 		Password            string `yaml:"password"`
 		ConnectionString    string `yaml:"uri"`
 		SSLPEMKeyPassword   string `yaml:"sslPEMKeyPassword"`
 		DestinationPassword string `yaml:"destinationPassword"`
 	}
-	err = yaml.UnmarshalStrict(configBytes, &config)
+	err = yaml.Unmarshal(configBytes, &secrets)
 	if err != nil {
-		return errors.Wrapf(err, "error parsing config file %s", opts.General.ConfigPath)
+		return nil, errors.Wrapf(err, "error parsing %s", source)
 	}
 
-	// Assign each parsed value to its respective ToolOptions field.
-	opts.Auth.Password = config.Password
-	opts.URI.ConnectionString = config.ConnectionString
-	opts.SSL.SSLPEMKeyPassword = config.SSLPEMKeyPassword
+	// Assign each parsed value to its respective ToolOptions field, keeping
+	// those of an earlier profile that aren't given.
+	if secrets.Password != "" {
+		opts.Auth.Password = secrets.Password
+	}
+	if secrets.ConnectionString != "" {
+		opts.URI.ConnectionString = secrets.ConnectionString
+	}
+	if secrets.SSLPEMKeyPassword != "" {
+		opts.SSL.SSLPEMKeyPassword = secrets.SSLPEMKeyPassword
+	}
 
 	// Mongomirror has an extra option to set.
 	for _, extraOpt := range opts.URI.extraOptionsRegistry {
-		if destinationAuth, ok := extraOpt.(DestinationAuthOptions); ok {
-			destinationAuth.SetDestinationPassword(config.DestinationPassword)
+		if destinationAuth, ok := extraOpt.(DestinationAuthOptions); ok && secrets.DestinationPassword != "" {
+			destinationAuth.SetDestinationPassword(secrets.DestinationPassword)
 			break
 		}
 	}
 
-	return nil
+	return settings, nil
+}
+
+// warnIfReadable warns if settings with credentials are in a file that other
+// users can read.
+func warnIfReadable(source, path string, settings []byte) {
+	var keys map[string]interface{}
+	if yaml.Unmarshal(settings, &keys) != nil {
+		return
+	}
+	hasSecret := false
+	for _, key := range configSecrets {
+		_, found := keys[key]
+		hasSecret = hasSecret || found
+	}
+	if info, err := os.Stat(path); err == nil && hasSecret && info.Mode().Perm()&0044 != 0 {
+		log.Logvf(log.Always, "WARNING: %s contains credentials and is readable by other users", source)
+	}
+}
+
+// environmentSettings returns the settings of the options set by
+// MONGOTOOLS_* environment variables.
+func (opts *ToolOptions) environmentSettings() ([]optionSetting, error) {
+	var settings []optionSetting
+	err := opts.eachOption(func(option *flags.Option) error {
+		if option.LongName == "" {
+			return nil
+		}
+		name := EnvPrefix + strings.ToUpper(option.LongName)
+		if value, ok := os.LookupEnv(name); ok {
+			var err error
+			settings, err = appendOptionSetting(settings, option, []string{value})
+			if err != nil {
+				return fmt.Errorf("invalid value for %v: %v", name, err)
+			}
+		}
+		return nil
+	})
+	return settings, err
+}
+
+// eachOption calls f for every option of the tool, stopping at the first
+// error.
+func (opts *ToolOptions) eachOption(f func(*flags.Option) error) error {
+	var visit func(group *flags.Group) error
+	visit = func(group *flags.Group) error {
+		for _, option := range group.Options() {
+			if err := f(option); err != nil {
+				return err
+			}
+		}
+		for _, sub := range group.Groups() {
+			if err := visit(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return visit(opts.parser.Command.Group)
+}
+
+// optionSetting is the value a config file, a profile or the environment
+// gives an option, with one value for each time a repeated option is given.
+type optionSetting struct {
+	option *flags.Option
+	values []string
+}
+
+// appendOptionSetting checks the values given to an option and appends its
+// setting.
+func appendOptionSetting(settings []optionSetting, option *flags.Option, values []string) ([]optionSetting, error) {
+	if option.Field().Type.Kind() == reflect.Bool {
+		for _, value := range values {
+			if _, err := strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("expected true or false")
+			}
+		}
+	}
+	return append(settings, optionSetting{option: option, values: values}), nil
+}
+
+// presetArgs returns the arguments for the settings of sources given in
+// increasing order of precedence. An option's setting replaces its settings
+// from the sources before, and options in commandLine are left out, since
+// the command line replaces them in turn. Boolean options are given without
+// a value when true and left out when false.
+func presetArgs(commandLine map[string]bool, sources ...[]optionSetting) []string {
+	var names []string
+	final := map[string]optionSetting{}
+	for _, source := range sources {
+		for _, setting := range source {
+			name := setting.option.LongName
+			if _, ok := final[name]; !ok {
+				names = append(names, name)
+			}
+			final[name] = setting
+		}
+	}
+	var args []string
+	for _, name := range names {
+		setting := final[name]
+		if commandLine[name] || len(setting.values) == 0 {
+			continue
+		}
+		if setting.option.Field().Type.Kind() != reflect.Bool {
+			for _, value := range setting.values {
+				args = append(args, "--"+name+"="+value)
+			}
+			continue
+		}
+		if set, _ := strconv.ParseBool(setting.values[len(setting.values)-1]); set {
+			args = append(args, "--"+name)
+		}
+	}
+	return args
+}
+
+// configValues converts a config file value to option values. Lists set
+// options that can be repeated.
+func configValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return []string{""}, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, elem := range v {
+			switch elem.(type) {
+			case []interface{}, yaml.MapSlice:
+				return nil, fmt.Errorf("lists must hold single values")
+			}
+			values = append(values, fmt.Sprint(elem))
+		}
+		return values, nil
+	case yaml.MapSlice:
+		return nil, fmt.Errorf("expected a single value or a list")
+	}
+	return []string{fmt.Sprint(value)}, nil
 }
 
 func (opts *ToolOptions) setURIFromPositionalArg(args []string) ([]string, error) {
@@ -600,7 +979,7 @@ func (opts *ToolOptions) setURIFromPositionalArg(args []string) ([]string, error
 	}
 
 	if foundURI { // Successfully parsed a URI
-		if opts.ConnectionString != "" {
+		if opts.ConnectionString != "" && !opts.presetURI {
 			return []string{}, fmt.Errorf(IncompatibleArgsErrorFormat, "a URI in a positional argument")
 		}
 		opts.ConnectionString = parsedURI.Original
@@ -633,10 +1012,23 @@ func (opts *ToolOptions) NormalizeOptionsAndURI() error {
 	if err != nil {
 		return err
 	}
-	err = opts.ConnString.Validate()
+	// the driver's validation predates MONGODB-OIDC, whose options are
+	// checked when its authenticator is created
+	validated := opts.ConnString
+	if strings.EqualFold(validated.AuthMechanism, "MONGODB-OIDC") {
+		validated.AuthMechanism = ""
+		validated.AuthMechanismProperties = nil
+	}
+	err = validated.Validate()
 	if err != nil {
 		return err
 	}
+	if opts.Connection != nil && (opts.ConnectRetries < 0 || opts.ConnectBackoff < 0) {
+		return fmt.Errorf("--connectRetries and --connectBackoff can't be negative")
+	}
+	if err = opts.Encryption.Validate(); err != nil {
+		return err
+	}
 
 	// Connect directly to a host if there's no replica set specified, or
 	// if the connection string already specified a direct connection.
@@ -798,6 +1190,34 @@ func (opts *ToolOptions) setOptionsFromURI(cs connstring.ConnString) error {
 			opts.Connection.SocketTimeout = int(cs.SocketTimeout / time.Millisecond)
 		}
 
+		if opts.Connection.NetworkCompressors != "" {
+			if opts.Connection.Compressors != "none" && opts.Connection.Compressors != opts.Connection.NetworkCompressors {
+				return fmt.Errorf("--compressors and --networkCompressors must not both be given")
+			}
+			opts.Connection.Compressors = opts.Connection.NetworkCompressors
+		}
+		for _, compressor := range strings.Split(opts.Connection.Compressors, ",") {
+			switch compressor {
+			case "", "none", "snappy", "zlib", "zstd":
+			default:
+				return fmt.Errorf("unknown network compressor '%v', expected zstd, snappy or zlib", compressor)
+			}
+		}
+		if opts.Connection.ZlibLevel != nil {
+			level := *opts.Connection.ZlibLevel
+			if level < -1 || level > 9 {
+				return fmt.Errorf("--zlibCompressionLevel must be between -1 and 9")
+			}
+			if level == -1 {
+				level = wiremessage.DefaultZlibLevel
+			}
+			if cs.ZlibLevelSet && cs.ZlibLevel != level {
+				return ConflictingArgsErrorFormat("zlibCompressionLevel", strconv.Itoa(cs.ZlibLevel), strconv.Itoa(level), "--zlibCompressionLevel")
+			}
+			cs.ZlibLevel = level
+			cs.ZlibLevelSet = true
+		}
+
 		if len(cs.Compressors) != 0 {
 			if opts.Connection.Compressors != "none" && opts.Connection.Compressors != strings.Join(cs.Compressors, ",") {
 				return ConflictingArgsErrorFormat("compressors", strings.Join(cs.Compressors, ","), opts.Connection.Compressors, "--compressors")
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/huimingz/mongo-tools/common/log"
@@ -764,6 +765,178 @@ func TestParseConfigFile(t *testing.T) {
 			So(opts.Auth.Password, ShouldEqual, "ghi789")
 		})
 	})
+
+	Convey("with options from a config file and the environment", t, func() {
+		configFilePath := "./test-config.yaml"
+		defer os.Remove(configFilePath)
+		config := "host: filehost\nport: 27018\nverbose: 2\nssl: true\ndialTimeout: 10\npassword: 0123\n"
+		So(ioutil.WriteFile(configFilePath, []byte(config), 0600), ShouldBeNil)
+		enabled := EnabledOptions{Auth: true, Connection: true, Namespace: true, URI: true}
+
+		Convey("the config file sets any option by its long name", func() {
+			opts := New("test", "", "", "", false, enabled)
+			_, err := opts.ParseArgs([]string{"--config", configFilePath})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "filehost")
+			So(opts.Port, ShouldEqual, "27018")
+			So(opts.Verbosity.Level(), ShouldEqual, 2)
+			So(opts.UseSSL, ShouldBeTrue)
+			So(opts.Timeout, ShouldEqual, 10)
+			So(opts.Auth.Password, ShouldEqual, "0123")
+		})
+
+		Convey("environment variables override the config file", func() {
+			os.Setenv("MONGOTOOLS_HOST", "envhost")
+			os.Setenv("MONGOTOOLS_PASSWORD", "envpass")
+			defer os.Unsetenv("MONGOTOOLS_HOST")
+			defer os.Unsetenv("MONGOTOOLS_PASSWORD")
+			opts := New("test", "", "", "", false, enabled)
+			_, err := opts.ParseArgs([]string{"--config", configFilePath})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "envhost")
+			So(opts.Port, ShouldEqual, "27018")
+			So(opts.Auth.Password, ShouldEqual, "envpass")
+
+			Convey("and the command line overrides both", func() {
+				opts := New("test", "", "", "", false, enabled)
+				_, err := opts.ParseArgs([]string{"--config", configFilePath, "--host", "clihost", "--password", "clipass"})
+				So(err, ShouldBeNil)
+				So(opts.Host, ShouldEqual, "clihost")
+				So(opts.Auth.Password, ShouldEqual, "clipass")
+			})
+		})
+
+		Convey("a false environment variable turns off a boolean set in the config file", func() {
+			os.Setenv("MONGOTOOLS_SSL", "false")
+			defer os.Unsetenv("MONGOTOOLS_SSL")
+			opts := New("test", "", "", "", false, enabled)
+			_, err := opts.ParseArgs([]string{"--config", configFilePath})
+			So(err, ShouldBeNil)
+			So(opts.UseSSL, ShouldBeFalse)
+		})
+
+		Convey("a repeated option is replaced rather than added to", func() {
+			So(ioutil.WriteFile(configFilePath, []byte("tag:\n  - a\n  - b\n"), 0600), ShouldBeNil)
+			newOpts := func() (*ToolOptions, *listTester) {
+				opts := New("test", "", "", "", false, enabled)
+				list := &listTester{}
+				opts.AddOptions(list)
+				return opts, list
+			}
+
+			opts, list := newOpts()
+			_, err := opts.ParseArgs([]string{"--config", configFilePath})
+			So(err, ShouldBeNil)
+			So(list.Tags, ShouldResemble, []string{"a", "b"})
+
+			os.Setenv("MONGOTOOLS_TAG", "env")
+			defer os.Unsetenv("MONGOTOOLS_TAG")
+			opts, list = newOpts()
+			_, err = opts.ParseArgs([]string{"--config", configFilePath})
+			So(err, ShouldBeNil)
+			So(list.Tags, ShouldResemble, []string{"env"})
+
+			opts, list = newOpts()
+			_, err = opts.ParseArgs([]string{"--config", configFilePath, "--tag", "x", "--tag", "y"})
+			So(err, ShouldBeNil)
+			So(list.Tags, ShouldResemble, []string{"x", "y"})
+		})
+
+		Convey("the config file can be given in the environment", func() {
+			os.Setenv("MONGOTOOLS_CONFIG", configFilePath)
+			defer os.Unsetenv("MONGOTOOLS_CONFIG")
+			opts := New("test", "", "", "", false, enabled)
+			_, err := opts.ParseArgs([]string{})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "filehost")
+		})
+
+		Convey("values that aren't single values or lists are rejected", func() {
+			So(ioutil.WriteFile(configFilePath, []byte("host:\n  name: foo\n"), 0600), ShouldBeNil)
+			opts := New("test", "", "", "", false, enabled)
+			_, err := opts.ParseArgs([]string{"--config", configFilePath})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseProfile(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a profiles file", t, func() {
+		dir, err := ioutil.TempDir("", "profiles")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		profilesPath := filepath.Join(dir, "profiles.yaml")
+		profiles := `
+prod-analytics:
+  uri: mongodb+srv://analytics.example.net/?authSource=admin
+  username: analyst
+  password: secret
+  ssl: true
+  sslCAFile: /etc/ssl/prod-ca.pem
+staging:
+  host: staging.example.net
+  port: 27018
+dev:
+  uri: mongodb://dev.example.net:27017/
+`
+		So(ioutil.WriteFile(profilesPath, []byte(profiles), 0600), ShouldBeNil)
+		oldProfilesPath := ProfilesPath
+		ProfilesPath = func() (string, error) { return profilesPath, nil }
+		defer func() { ProfilesPath = oldProfilesPath }()
+		enabled := EnabledOptions{Auth: true, Connection: true, Namespace: true, URI: true}
+
+		Convey("--profile applies the settings of the profile", func() {
+			opts := New("test", "", "", "", false, enabled)
+			So(opts.ParseConfigFile([]string{"--profile", "prod-analytics"}), ShouldBeNil)
+			So(opts.URI.ConnectionString, ShouldEqual, "mongodb+srv://analytics.example.net/?authSource=admin")
+			So(opts.Auth.Password, ShouldEqual, "secret")
+
+			opts = New("test", "", "", "", false, enabled)
+			_, err := opts.ParseArgs([]string{"--profile", "staging"})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "staging.example.net")
+			So(opts.Port, ShouldEqual, "27018")
+		})
+
+		Convey("the command line and config file override the profile", func() {
+			configPath := filepath.Join(dir, "config.yaml")
+			So(ioutil.WriteFile(configPath, []byte("port: 27019\n"), 0600), ShouldBeNil)
+			opts := New("test", "", "", "", false, enabled)
+			_, err := opts.ParseArgs([]string{"--profile=staging", "--config", configPath, "--host", "other.example.net"})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "other.example.net")
+			So(opts.Port, ShouldEqual, "27019")
+		})
+
+		Convey("a URI on the command line replaces the profile's", func() {
+			for _, args := range [][]string{
+				{"--profile", "dev", "--uri", "mongodb://other.example.net:27017/"},
+				{"--profile", "dev", "mongodb://other.example.net:27017/"},
+			} {
+				opts := New("test", "", "", "", true, enabled)
+				_, err := opts.ParseArgs(args)
+				So(err, ShouldBeNil)
+				So(opts.URI.ConnectionString, ShouldEqual, "mongodb://other.example.net:27017/")
+			}
+		})
+
+		Convey("an unknown profile names the profiles there are", func() {
+			opts := New("test", "", "", "", false, enabled)
+			err := opts.ParseConfigFile([]string{"--profile", "prod"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "prod-analytics, staging, dev")
+		})
+	})
+}
+
+type listTester struct {
+	Tags []string `long:"tag"`
+}
+
+func (*listTester) Name() string {
+	return "list"
 }
 
 type optionsTester struct {
@@ -846,6 +1019,15 @@ func TestOptionsParsing(t *testing.T) {
 			{"--compressors snappy", "mongodb://foo/?compressors=zlib", ShouldFail},
 			// {"--compressors none", "mongodb://foo/?compressors=snappy", ShouldFail}, // Note: zero value problem
 			{"--compressors snappy", "mongodb://foo/?compressors=none", ShouldFail},
+			{"--networkCompressors zstd,snappy", "mongodb://foo/", ShouldSucceed},
+			{"--networkCompressors zstd", "mongodb://foo/?compressors=zstd", ShouldSucceed},
+			{"--networkCompressors zstd", "mongodb://foo/?compressors=zlib", ShouldFail},
+			{"--networkCompressors lz4", "mongodb://foo/", ShouldFail},
+			{"--networkCompressors zlib --compressors snappy", "mongodb://foo/", ShouldFail},
+			{"--networkCompressors zlib --zlibCompressionLevel 9", "mongodb://foo/", ShouldSucceed},
+			{"--zlibCompressionLevel 9", "mongodb://foo/?compressors=zlib&zlibCompressionLevel=9", ShouldSucceed},
+			{"--zlibCompressionLevel 9", "mongodb://foo/?compressors=zlib&zlibCompressionLevel=1", ShouldFail},
+			{"--zlibCompressionLevel 10", "mongodb://foo/", ShouldFail},
 
 			// Auth
 			{"--username alice", "mongodb://alice@foo", ShouldSucceed},
@@ -0,0 +1,260 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSONTargetStderr is the --progressJson target that writes to standard error.
+const JSONTargetStderr = "stderr"
+
+// unixTargetPrefix introduces a unix socket --progressJson target.
+const unixTargetPrefix = "unix:"
+
+// OpenJSONTarget opens the destination for JSON progress records. The target
+// is either "stderr" or "unix:<path>" to connect to a listening unix socket.
+func OpenJSONTarget(target string) (io.WriteCloser, error) {
+	switch {
+	case target == JSONTargetStderr:
+		return nopCloser{os.Stderr}, nil
+	case strings.HasPrefix(target, unixTargetPrefix):
+		path := strings.TrimPrefix(strings.TrimPrefix(target, unixTargetPrefix), "//")
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to progress socket %v: %v", path, err)
+		}
+		return conn, nil
+	default:
+		return nil, fmt.Errorf("invalid progress target '%v', expected '%v' or '%v<socket-path>'",
+			target, JSONTargetStderr, unixTargetPrefix)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// JSONProgress is the progress of a single named operation in a JSONRecord.
+type JSONProgress struct {
+	Name    string  `json:"name"`
+	Current int64   `json:"current"`
+	Total   int64   `json:"total"`
+	Bytes   int64   `json:"bytes,omitempty"`
+	Percent float64 `json:"percent"`
+	// Rate is the progress per second since the operation was attached.
+	Rate float64 `json:"ratePerSec"`
+	// ETASeconds is omitted when the total is unknown or nothing has
+	// progressed yet.
+	ETASeconds *float64 `json:"etaSeconds,omitempty"`
+}
+
+// JSONRecord is a single line written by a JSONWriter.
+type JSONRecord struct {
+	Time      time.Time      `json:"time"`
+	Tool      string         `json:"tool"`
+	Done      bool           `json:"done,omitempty"`
+	Active    []JSONProgress `json:"active"`
+	Completed int            `json:"completed"`
+	// TotalCurrent and TotalBytes include completed operations.
+	TotalCurrent int64 `json:"totalCurrent"`
+	TotalBytes   int64 `json:"totalBytes"`
+}
+
+type jsonEntry struct {
+	name       string
+	progressor Progressor
+	attached   time.Time
+}
+
+// JSONWriter implements Manager. It periodically writes one JSON record per
+// line describing all attached progressors, for consumption by other programs.
+type JSONWriter struct {
+	sync.Mutex
+
+	tool     string
+	waitTime time.Duration
+	writer   io.Writer
+	entries  []*jsonEntry
+
+	completed     int
+	doneCurrent   int64
+	doneBytes     int64
+	stopChan      chan struct{}
+	stoppedChan   chan struct{}
+	stopOnce      sync.Once
+	writeFailures int
+}
+
+// NewJSONWriter returns a JSONWriter that writes a record to w every waitTime.
+func NewJSONWriter(w io.Writer, tool string, waitTime time.Duration) *JSONWriter {
+	if waitTime <= 0 {
+		waitTime = DefaultWaitTime
+	}
+	return &JSONWriter{
+		tool:        tool,
+		waitTime:    waitTime,
+		writer:      w,
+		stopChan:    make(chan struct{}),
+		stoppedChan: make(chan struct{}),
+	}
+}
+
+// Attach registers the given progressor with the manager.
+func (manager *JSONWriter) Attach(name string, progressor Progressor) {
+	manager.Lock()
+	defer manager.Unlock()
+	for _, entry := range manager.entries {
+		if entry.name == name {
+			panic(fmt.Sprintf("progressor with name '%s' already exists in manager", name))
+		}
+	}
+	manager.entries = append(manager.entries, &jsonEntry{name: name, progressor: progressor, attached: time.Now()})
+}
+
+// Detach removes the progressor with the given name, adding its final
+// progress to the completed totals.
+func (manager *JSONWriter) Detach(name string) {
+	manager.Lock()
+	defer manager.Unlock()
+	for i, entry := range manager.entries {
+		if entry.name != name {
+			continue
+		}
+		current, _ := entry.progressor.Progress()
+		manager.completed++
+		manager.doneCurrent += current
+		if counter, ok := entry.progressor.(ByteCounter); ok {
+			manager.doneBytes += counter.Bytes()
+		}
+		manager.entries = append(manager.entries[:i], manager.entries[i+1:]...)
+		return
+	}
+	panic("could not find progressor")
+}
+
+// Record builds a record describing the current progress.
+func (manager *JSONWriter) Record(now time.Time) JSONRecord {
+	manager.Lock()
+	defer manager.Unlock()
+	record := JSONRecord{
+		Time:         now.UTC(),
+		Tool:         manager.tool,
+		Active:       []JSONProgress{},
+		Completed:    manager.completed,
+		TotalCurrent: manager.doneCurrent,
+		TotalBytes:   manager.doneBytes,
+	}
+	for _, entry := range manager.entries {
+		p := jsonProgressOf(entry, now)
+		record.Active = append(record.Active, p)
+		record.TotalCurrent += p.Current
+		record.TotalBytes += p.Bytes
+	}
+	return record
+}
+
+func jsonProgressOf(entry *jsonEntry, now time.Time) JSONProgress {
+	current, total := entry.progressor.Progress()
+	p := JSONProgress{Name: entry.name, Current: current, Total: total}
+	if counter, ok := entry.progressor.(ByteCounter); ok {
+		p.Bytes = counter.Bytes()
+	}
+	if total > 0 {
+		p.Percent = float64(current) / float64(total) * 100
+	}
+	if elapsed := now.Sub(entry.attached).Seconds(); elapsed > 0 {
+		p.Rate = float64(current) / elapsed
+	}
+	if total > 0 && p.Rate > 0 {
+		eta := float64(total-current) / p.Rate
+		if eta < 0 {
+			eta = 0
+		}
+		p.ETASeconds = &eta
+	}
+	return p
+}
+
+func (manager *JSONWriter) writeRecord(record JSONRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	// a reader that went away must not hold up the tool, so writes are
+	// given up after repeated failures
+	if manager.writeFailures < 3 {
+		if _, err = manager.writer.Write(line); err != nil {
+			manager.writeFailures++
+		}
+	}
+}
+
+// Start begins writing records periodically.
+func (manager *JSONWriter) Start() {
+	if manager.writer == nil {
+		panic("Cannot use a progress.JSONWriter with an unset Writer")
+	}
+	go manager.start()
+}
+
+func (manager *JSONWriter) start() {
+	defer close(manager.stoppedChan)
+	ticker := time.NewTicker(manager.waitTime)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-manager.stopChan:
+			record := manager.Record(time.Now())
+			record.Done = true
+			manager.writeRecord(record)
+			return
+		case now := <-ticker.C:
+			manager.writeRecord(manager.Record(now))
+		}
+	}
+}
+
+// Stop writes a final record marked as done and stops the manager.
+func (manager *JSONWriter) Stop() {
+	manager.stopOnce.Do(func() {
+		close(manager.stopChan)
+		<-manager.stoppedChan
+	})
+}
+
+// multiManager fans Attach and Detach out to several managers.
+type multiManager []Manager
+
+// NewMultiManager returns a Manager that registers progressors with every one
+// of the given managers.
+func NewMultiManager(managers ...Manager) Manager {
+	return multiManager(managers)
+}
+
+func (m multiManager) Attach(name string, progressor Progressor) {
+	for _, manager := range m {
+		manager.Attach(name, progressor)
+	}
+}
+
+func (m multiManager) Detach(name string) {
+	for _, manager := range m {
+		manager.Detach(name)
+	}
+}
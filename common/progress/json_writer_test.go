@@ -0,0 +1,77 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package progress
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSONWriter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a JSONWriter and two counters", t, func() {
+		buffer := &safeBuffer{}
+		manager := NewJSONWriter(buffer, "mongodump", time.Hour)
+		first := NewCounter(100)
+		second := NewCounter(0)
+		manager.Attach("test.first", first)
+		manager.Attach("test.second", second)
+
+		first.Inc(25)
+		first.IncBytes(1000)
+		second.Inc(7)
+
+		Convey("records describe each active progressor", func() {
+			record := manager.Record(time.Now().Add(time.Second))
+			So(record.Tool, ShouldEqual, "mongodump")
+			So(len(record.Active), ShouldEqual, 2)
+			So(record.Active[0].Name, ShouldEqual, "test.first")
+			So(record.Active[0].Percent, ShouldEqual, 25)
+			So(record.Active[0].Bytes, ShouldEqual, 1000)
+			So(record.Active[0].ETASeconds, ShouldNotBeNil)
+			So(record.Active[1].ETASeconds, ShouldBeNil)
+			So(record.TotalCurrent, ShouldEqual, 32)
+		})
+
+		Convey("detached progressors count towards the totals", func() {
+			manager.Detach("test.first")
+			record := manager.Record(time.Now())
+			So(len(record.Active), ShouldEqual, 1)
+			So(record.Completed, ShouldEqual, 1)
+			So(record.TotalCurrent, ShouldEqual, 32)
+			So(record.TotalBytes, ShouldEqual, 1000)
+		})
+
+		Convey("stopping writes a final record as one JSON line", func() {
+			manager.Start()
+			manager.Stop()
+			lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+			So(len(lines), ShouldEqual, 1)
+			var record JSONRecord
+			So(json.Unmarshal([]byte(lines[0]), &record), ShouldBeNil)
+			So(record.Done, ShouldBeTrue)
+			So(len(record.Active), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestOpenJSONTarget(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Unknown progress targets are rejected", t, func() {
+		_, err := OpenJSONTarget("stdout")
+		So(err, ShouldNotBeNil)
+		_, err = OpenJSONTarget("unix:/nonexistent/progress.sock")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -51,6 +51,12 @@ type Bar struct {
 	// hasRendered indicates that the bar has been rendered at least once
 	// and implies that when detaching should be rendered one more time
 	hasRendered bool
+
+	// firstRender and firstCount are the time and count of the first render;
+	// the estimated time remaining is based on the rate since then, so work
+	// done before the bar was attached doesn't skew it
+	firstRender time.Time
+	firstCount  int64
 }
 
 // Start starts the Bar goroutine. Once Start is called, a bar will
@@ -119,6 +125,9 @@ func (pb *Bar) renderToWriter() {
 		maxStr,
 		percent*100,
 	)
+	if eta := pb.eta(currentCount, maxCount, time.Now()); eta != "" {
+		fmt.Fprintf(pb.Writer, "\t%s", eta)
+	}
 }
 
 func (pb *Bar) renderToGridRow(grid *text.GridWriter) {
@@ -135,11 +144,28 @@ func (pb *Bar) renderToGridRow(grid *text.GridWriter) {
 			pb.Name,
 			fmt.Sprintf("%s/%s", currentStr, maxStr),
 			fmt.Sprintf("(%2.1f%%)", percent*100),
+			pb.eta(currentCount, maxCount, time.Now()),
 		)
 	}
 	grid.EndRow()
 }
 
+// eta returns the estimated time remaining as "ETA <duration>", or an empty
+// string until it can be estimated.
+func (pb *Bar) eta(currentCount, maxCount int64, now time.Time) string {
+	if pb.firstRender.IsZero() {
+		pb.firstRender, pb.firstCount = now, currentCount
+		return ""
+	}
+	elapsed := now.Sub(pb.firstRender)
+	done := currentCount - pb.firstCount
+	if elapsed <= 0 || done <= 0 || currentCount >= maxCount {
+		return ""
+	}
+	remaining := time.Duration(float64(maxCount-currentCount) / float64(done) * float64(elapsed))
+	return "ETA " + remaining.Round(time.Second).String()
+}
+
 // the main concurrent loop
 func (pb *Bar) start() {
 	if pb.WaitTime <= 0 {
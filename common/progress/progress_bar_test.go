@@ -91,6 +91,19 @@ func TestProgressBarWithNoMax(t *testing.T) {
 	})
 }
 
+func TestBarETA(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The estimated time remaining is based on the rate since the first render", t, func() {
+		pbar := &Bar{Name: "test", Watching: NewCounter(1000)}
+		start := time.Now()
+		So(pbar.eta(400, 1000, start), ShouldEqual, "")
+		So(pbar.eta(400, 1000, start.Add(time.Minute)), ShouldEqual, "")
+		So(pbar.eta(500, 1000, start.Add(time.Minute)), ShouldEqual, "ETA 5m0s")
+		So(pbar.eta(1000, 1000, start.Add(2*time.Minute)), ShouldEqual, "")
+	})
+}
+
 func TestBarConcurrency(t *testing.T) {
 	// TOOLS-2715: Disable flaky test
 	t.SkipNow()
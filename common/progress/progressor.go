@@ -31,9 +31,20 @@ type Updateable interface {
 	Set(amount int64)
 }
 
+// ByteCounter is implemented by progressors that also keep track of the
+// number of bytes processed, independently of their progress counter.
+type ByteCounter interface {
+	// IncBytes increments the byte counter by the given amount.
+	IncBytes(amount int64)
+
+	// Bytes returns the number of bytes processed so far.
+	Bytes() int64
+}
+
 // CountProgressor is an implementation of Progressor that uses
 type CountProgressor struct {
 	max, current int64
+	bytes        int64
 }
 
 // Progress returns the current and maximum values of the counter.
@@ -52,7 +63,17 @@ func (c *CountProgressor) Set(amount int64) {
 	atomic.StoreInt64(&c.current, amount)
 }
 
+// IncBytes atomically increments the byte counter by the given amount.
+func (c *CountProgressor) IncBytes(amount int64) {
+	atomic.AddInt64(&c.bytes, amount)
+}
+
+// Bytes returns the number of bytes counted with IncBytes.
+func (c *CountProgressor) Bytes() int64 {
+	return atomic.LoadInt64(&c.bytes)
+}
+
 // NewCounter constructs a CountProgressor with a given maximum count.
 func NewCounter(max int64) *CountProgressor {
-	return &CountProgressor{max, 0}
+	return &CountProgressor{max: max}
 }
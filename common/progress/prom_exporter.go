@@ -0,0 +1,106 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// PromExporter implements Manager. It serves the progress of the attached
+// progressors at /metrics in the Prometheus text format, for monitoring
+// systems to scrape. It describes the same progress as a JSONWriter's
+// records, as of the time of each scrape.
+type PromExporter struct {
+	records  *JSONWriter
+	listener net.Listener
+}
+
+// StartPromExporter serves /metrics on the address in the background. The
+// metric names start with the name of the tool.
+func StartPromExporter(addr, tool string) (*PromExporter, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on --prom address %v: %v", addr, err)
+	}
+	// the records are only built when scraped, so nothing is written
+	exporter := &PromExporter{records: NewJSONWriter(nil, tool, 0), listener: listener}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	go http.Serve(listener, mux)
+	return exporter, nil
+}
+
+// Attach registers the given progressor with the manager.
+func (p *PromExporter) Attach(name string, progressor Progressor) {
+	p.records.Attach(name, progressor)
+}
+
+// Detach removes the progressor with the given name, adding its final
+// progress to the completed totals.
+func (p *PromExporter) Detach(name string) {
+	p.records.Detach(name)
+}
+
+// Stop stops serving the metrics.
+func (p *PromExporter) Stop() {
+	p.listener.Close()
+}
+
+func (p *PromExporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(PromText(p.records.Record(time.Now())))
+}
+
+// PromText formats a progress record in the Prometheus text format. The
+// totals, which include the completed operations, are counters, and the
+// progress of each active operation is a gauge labelled with its name.
+func PromText(record JSONRecord) []byte {
+	buf := &bytes.Buffer{}
+	metric := func(name, kind, help string) string {
+		name = record.Tool + "_" + name
+		fmt.Fprintf(buf, "# HELP %v %v\n", name, help)
+		fmt.Fprintf(buf, "# TYPE %v %v\n", name, kind)
+		return name
+	}
+
+	name := metric("processed_total", "counter", "Progress made so far, such as the documents dumped, including completed operations.")
+	fmt.Fprintf(buf, "%v %v\n", name, record.TotalCurrent)
+	name = metric("processed_bytes_total", "counter", "Bytes processed so far, including completed operations.")
+	fmt.Fprintf(buf, "%v %v\n", name, record.TotalBytes)
+	name = metric("completed_operations_total", "counter", "Operations completed, such as namespaces dumped.")
+	fmt.Fprintf(buf, "%v %v\n", name, record.Completed)
+	name = metric("active_operations", "gauge", "Operations in progress.")
+	fmt.Fprintf(buf, "%v %v\n", name, len(record.Active))
+	if len(record.Active) == 0 {
+		return buf.Bytes()
+	}
+
+	name = metric("operation_processed", "gauge", "Progress of an operation in progress.")
+	for _, p := range record.Active {
+		fmt.Fprintf(buf, "%v{name=%q} %v\n", name, p.Name, p.Current)
+	}
+	name = metric("operation_expected", "gauge", "Expected progress of an operation in progress, or 0 if unknown.")
+	for _, p := range record.Active {
+		fmt.Fprintf(buf, "%v{name=%q} %v\n", name, p.Name, p.Total)
+	}
+	name = metric("operation_processed_bytes", "gauge", "Bytes processed by an operation in progress.")
+	for _, p := range record.Active {
+		fmt.Fprintf(buf, "%v{name=%q} %v\n", name, p.Name, p.Bytes)
+	}
+	// an operation whose ETA is unknown has no sample
+	name = metric("operation_eta_seconds", "gauge", "Estimated time until an operation in progress completes.")
+	for _, p := range record.Active {
+		if p.ETASeconds != nil {
+			fmt.Fprintf(buf, "%v{name=%q} %v\n", name, p.Name, *p.ETASeconds)
+		}
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,63 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package progress
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPromText(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A progress record is formatted as Prometheus metrics", t, func() {
+		eta := 1.5
+		text := string(PromText(JSONRecord{
+			Tool:         "mongodump",
+			Completed:    2,
+			TotalCurrent: 130,
+			TotalBytes:   4096,
+			Active: []JSONProgress{
+				{Name: "test.first", Current: 25, Total: 100, Bytes: 1000, ETASeconds: &eta},
+				{Name: "test.second", Current: 5},
+			},
+		}))
+		So(text, ShouldContainSubstring, "# TYPE mongodump_processed_total counter\nmongodump_processed_total 130\n")
+		So(text, ShouldContainSubstring, "mongodump_processed_bytes_total 4096\n")
+		So(text, ShouldContainSubstring, "mongodump_completed_operations_total 2\n")
+		So(text, ShouldContainSubstring, "mongodump_active_operations 2\n")
+		So(text, ShouldContainSubstring, "# TYPE mongodump_operation_processed gauge\n"+
+			"mongodump_operation_processed{name=\"test.first\"} 25\n"+
+			"mongodump_operation_processed{name=\"test.second\"} 5\n")
+		So(text, ShouldContainSubstring, "mongodump_operation_expected{name=\"test.first\"} 100\n")
+		So(text, ShouldContainSubstring, "mongodump_operation_processed_bytes{name=\"test.first\"} 1000\n")
+		So(text, ShouldContainSubstring, "mongodump_operation_eta_seconds{name=\"test.first\"} 1.5\n")
+		So(text, ShouldNotContainSubstring, "mongodump_operation_eta_seconds{name=\"test.second\"}")
+	})
+
+	Convey("A PromExporter serves the progress of its progressors", t, func() {
+		exporter := &PromExporter{records: NewJSONWriter(nil, "mongodump", 0)}
+		counter := NewCounter(10)
+		exporter.Attach("test.c", counter)
+		counter.Inc(4)
+
+		recorder := httptest.NewRecorder()
+		exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		So(recorder.Header().Get("Content-Type"), ShouldEqual, "text/plain; version=0.0.4")
+		So(recorder.Body.String(), ShouldContainSubstring, "mongodump_operation_processed{name=\"test.c\"} 4\n")
+
+		exporter.Detach("test.c")
+		recorder = httptest.NewRecorder()
+		exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		So(recorder.Body.String(), ShouldContainSubstring, "mongodump_processed_total 4\n")
+		So(recorder.Body.String(), ShouldContainSubstring, "mongodump_completed_operations_total 1\n")
+		So(recorder.Body.String(), ShouldNotContainSubstring, "mongodump_operation_processed")
+	})
+}
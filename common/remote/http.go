@@ -0,0 +1,56 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package remote
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+func httpStat(url string) (Object, error) {
+	resp, err := http.Head(url)
+	if err != nil {
+		return Object{}, fmt.Errorf("error fetching %v: %v", url, err)
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return Object{URL: url, Size: resp.ContentLength}, nil
+	case resp.StatusCode == http.StatusMethodNotAllowed:
+		// some servers only answer GET; the size is then unknown
+		return Object{URL: url, Size: -1}, nil
+	}
+	return Object{}, fmt.Errorf("error fetching %v: %v", url, resp.Status)
+}
+
+func httpOpener(url string) opener {
+	return func(offset int64) (io.ReadCloser, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching %v: %v", url, err)
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching %v: %v", url, err)
+		}
+		switch {
+		case offset == 0 && resp.StatusCode == http.StatusOK:
+			return resp.Body, nil
+		case offset > 0 && resp.StatusCode == http.StatusPartialContent:
+			return resp.Body, nil
+		}
+		resp.Body.Close()
+		if offset > 0 && resp.StatusCode == http.StatusOK {
+			return nil, fmt.Errorf("error fetching %v: the server does not support ranged reads", url)
+		}
+		return nil, fmt.Errorf("error fetching %v: %v", url, resp.Status)
+	}
+}
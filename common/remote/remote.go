@@ -0,0 +1,152 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package remote reads dump files and archives directly from HTTP(S) and S3
+// URLs. Objects are streamed rather than copied to local disk, and a stream
+// that fails part way through is resumed with a ranged read from the last
+// byte received.
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/log"
+)
+
+// maxReadAttempts is how many times reading from a given offset is attempted
+// before giving up.
+const maxReadAttempts = 5
+
+// retryBackoff is multiplied by the attempt number to get the delay before
+// reconnecting to a failed stream.
+var retryBackoff = time.Second
+
+// ErrNotListable is returned by List for URLs whose scheme has no way of
+// listing objects.
+var ErrNotListable = errors.New("only s3:// URLs can be listed")
+
+// Object is a single file stored under a URL.
+type Object struct {
+	URL string
+	// Size is -1 if the server did not report it.
+	Size int64
+}
+
+// opener starts a stream of an object's bytes from the given offset.
+type opener func(offset int64) (io.ReadCloser, error)
+
+// IsRemote reports whether path is a URL that this package can read.
+func IsRemote(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// Open returns a stream of the object at url.
+func Open(url string) (io.ReadCloser, error) {
+	obj, err := Stat(url)
+	if err != nil {
+		return nil, err
+	}
+	var open opener
+	if strings.HasPrefix(url, "s3://") {
+		open, err = s3Opener(url)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		open = httpOpener(url)
+	}
+	return newRangeReader(url, obj.Size, open)
+}
+
+// Stat looks up the object at url.
+func Stat(url string) (Object, error) {
+	switch {
+	case strings.HasPrefix(url, "s3://"):
+		return s3Stat(url)
+	case IsRemote(url):
+		return httpStat(url)
+	}
+	return Object{}, fmt.Errorf("unsupported URL '%v'", url)
+}
+
+// List returns every object under the directory-like prefix url, at any
+// depth. It returns ErrNotListable for HTTP URLs.
+func List(url string) ([]Object, error) {
+	if !strings.HasPrefix(url, "s3://") {
+		return nil, ErrNotListable
+	}
+	return s3List(url)
+}
+
+// rangeReader streams an object, reconnecting from the current offset when
+// the stream fails or ends before the object's size.
+type rangeReader struct {
+	url    string
+	size   int64
+	offset int64
+	open   opener
+	// body is nil after a failure, until the stream is reopened.
+	body io.ReadCloser
+}
+
+func newRangeReader(url string, size int64, open opener) (*rangeReader, error) {
+	body, err := open(0)
+	if err != nil {
+		return nil, err
+	}
+	return &rangeReader{url: url, size: size, open: open, body: body}, nil
+}
+
+// Read is part of the io.Reader interface.
+func (r *rangeReader) Read(p []byte) (int, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxReadAttempts; attempt++ {
+		if r.body == nil {
+			if attempt > 0 {
+				time.Sleep(time.Duration(attempt) * retryBackoff)
+			}
+			body, err := r.open(r.offset)
+			if err != nil {
+				log.Logvf(log.Info, "error reconnecting to %v: %v", r.url, err)
+				lastErr = err
+				continue
+			}
+			r.body = body
+		}
+
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == io.EOF && r.size >= 0 && r.offset < r.size {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		log.Logvf(log.Info, "error reading %v at byte %v, reconnecting: %v", r.url, r.offset, err)
+		r.body.Close()
+		r.body = nil
+		lastErr = err
+		if n > 0 {
+			// hand back what was read; the next Read reopens the stream
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("error reading %v at byte %v: %v", r.url, r.offset, lastErr)
+}
+
+// Close is part of the io.Closer interface.
+func (r *rangeReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
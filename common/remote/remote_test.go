@@ -0,0 +1,86 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package remote
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHTTPOpen(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+	retryBackoff = 0
+
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	var requests int32
+	// the first GET is cut off half way through the content
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Content-Length", "100000")
+			w.Write(content[:50000])
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "archive", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	Convey("With an HTTP server", t, func() {
+		Convey("URLs are recognized as remote", func() {
+			So(IsRemote(server.URL+"/archive"), ShouldBeTrue)
+			So(IsRemote("s3://bucket/archive"), ShouldBeTrue)
+			So(IsRemote("dump/archive"), ShouldBeFalse)
+		})
+
+		Convey("an interrupted stream is resumed from where it stopped", func() {
+			rc, err := Open(server.URL + "/archive")
+			So(err, ShouldBeNil)
+			defer rc.Close()
+			data, err := ioutil.ReadAll(rc)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(data, content), ShouldBeTrue)
+			So(atomic.LoadInt32(&requests), ShouldEqual, 2)
+		})
+
+		Convey("objects are looked up with their size", func() {
+			obj, err := Stat(server.URL + "/archive")
+			So(err, ShouldBeNil)
+			So(obj.Size, ShouldEqual, len(content))
+		})
+
+		Convey("HTTP URLs cannot be listed", func() {
+			_, err := List(server.URL + "/dump")
+			So(err, ShouldEqual, ErrNotListable)
+		})
+	})
+}
+
+func TestParseS3URL(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("S3 URLs are split into bucket and key", t, func() {
+		bucket, key, err := parseS3URL("s3://backups/nightly/dump.archive")
+		So(err, ShouldBeNil)
+		So(bucket, ShouldEqual, "backups")
+		So(key, ShouldEqual, "nightly/dump.archive")
+
+		bucket, key, err = parseS3URL("s3://backups")
+		So(err, ShouldBeNil)
+		So(bucket, ShouldEqual, "backups")
+		So(key, ShouldEqual, "")
+
+		_, _, err = parseS3URL("s3:///dump")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,133 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package remote
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// defaultS3Region is used to locate buckets when no region is configured.
+const defaultS3Region = "us-east-1"
+
+var (
+	s3ClientsLock sync.Mutex
+	// s3Clients caches a client per bucket, in the bucket's region.
+	s3Clients = map[string]*s3.S3{}
+)
+
+// parseS3URL splits an s3://<bucket>/<key> URL.
+func parseS3URL(url string) (bucket, key string, err error) {
+	rest := strings.TrimPrefix(url, "s3://")
+	bucket = rest
+	if i := strings.Index(rest, "/"); i >= 0 {
+		bucket, key = rest[:i], rest[i+1:]
+	}
+	if bucket == "" {
+		return "", "", fmt.Errorf("invalid S3 URL '%v': no bucket name", url)
+	}
+	return bucket, key, nil
+}
+
+// s3Client returns a client for the bucket. Credentials and the region come
+// from the usual AWS environment variables and shared config files.
+func s3Client(bucket string) (*s3.S3, error) {
+	s3ClientsLock.Lock()
+	defer s3ClientsLock.Unlock()
+	if client, ok := s3Clients[bucket]; ok {
+		return client, nil
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS session: %v", err)
+	}
+	region := aws.StringValue(sess.Config.Region)
+	if region == "" {
+		region, err = s3manager.GetBucketRegion(aws.BackgroundContext(), sess, bucket, defaultS3Region)
+		if err != nil {
+			return nil, fmt.Errorf("error finding the region of S3 bucket %v: %v", bucket, err)
+		}
+	}
+	client := s3.New(sess, aws.NewConfig().WithRegion(region))
+	s3Clients[bucket] = client
+	return client, nil
+}
+
+func s3Stat(url string) (Object, error) {
+	bucket, key, err := parseS3URL(url)
+	if err != nil {
+		return Object{}, err
+	}
+	client, err := s3Client(bucket)
+	if err != nil {
+		return Object{}, err
+	}
+	head, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return Object{}, fmt.Errorf("error fetching %v: %v", url, err)
+	}
+	return Object{URL: url, Size: aws.Int64Value(head.ContentLength)}, nil
+}
+
+func s3Opener(url string) (opener, error) {
+	bucket, key, err := parseS3URL(url)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s3Client(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return func(offset int64) (io.ReadCloser, error) {
+		input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+		if offset > 0 {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+		}
+		out, err := client.GetObject(input)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching %v: %v", url, err)
+		}
+		return out.Body, nil
+	}, nil
+}
+
+func s3List(url string) ([]Object, error) {
+	bucket, key, err := parseS3URL(url)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s3Client(bucket)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.TrimSuffix(key, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	var objects []Object
+	err = client.ListObjectsV2Pages(&s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)},
+		func(page *s3.ListObjectsV2Output, _ bool) bool {
+			for _, obj := range page.Contents {
+				objects = append(objects, Object{
+					URL:  "s3://" + bucket + "/" + aws.StringValue(obj.Key),
+					Size: aws.Int64Value(obj.Size),
+				})
+			}
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("error listing %v: %v", url, err)
+	}
+	return objects, nil
+}
@@ -9,6 +9,8 @@ package text
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -29,6 +31,39 @@ func FormatByteAmount(size int64) string {
 	return formatUnitAmount(binary, size, 3, longByteUnits)
 }
 
+// ParseByteAmount parses a human-readable size such as "512MB", "50GB" or
+// "1.5T" into a number of bytes. Units are binary (1KB = 1024 bytes) and a
+// bare number is taken to be bytes.
+func ParseByteAmount(amount string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(amount))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "IB"), "B")
+	multiplier := int64(1)
+	if str != "" {
+		switch str[len(str)-1] {
+		case 'K':
+			multiplier = binary
+		case 'M':
+			multiplier = binary * binary
+		case 'G':
+			multiplier = binary * binary * binary
+		case 'T':
+			multiplier = binary * binary * binary * binary
+		}
+		if multiplier > 1 {
+			str = str[:len(str)-1]
+		}
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || value < 0 || math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("invalid size '%v'", amount)
+	}
+	size := value * float64(multiplier)
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("size '%v' is too large", amount)
+	}
+	return int64(size), nil
+}
+
 // FormatMegabyteAmount is equivalent to FormatByteAmount but expects
 // an amount of MB instead of bytes.
 func FormatMegabyteAmount(size int64) string {
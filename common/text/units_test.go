@@ -113,3 +113,33 @@ func TestBitFormatPrecision(t *testing.T) {
 		})
 	})
 }
+
+func TestParseByteAmount(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With some sample size strings", t, func() {
+		Convey("valid sizes are converted to bytes", func() {
+			for input, expected := range map[string]int64{
+				"0":      0,
+				"100":    100,
+				"100B":   100,
+				"1K":     1024,
+				"1kb":    1024,
+				"512MB":  512 * 1024 * 1024,
+				"50GB":   50 * 1024 * 1024 * 1024,
+				"1.5GiB": 1536 * 1024 * 1024,
+				"2T":     2 * 1024 * 1024 * 1024 * 1024,
+			} {
+				size, err := ParseByteAmount(input)
+				So(err, ShouldBeNil)
+				So(size, ShouldEqual, expected)
+			}
+		})
+		Convey("invalid sizes are rejected", func() {
+			for _, input := range []string{"", "GB", "-1MB", "10XB", "abc", "1e30TB"} {
+				_, err := ParseByteAmount(input)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
@@ -0,0 +1,81 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket that limits some quantity (bytes, documents,
+// operations) to a fixed amount per second. The bucket holds at most one
+// second's worth of tokens. Callers may take more tokens than are available,
+// in which case they wait until the debt is paid off; this keeps large
+// requests from starving. A nil *RateLimiter never waits. It is safe for
+// concurrent use.
+type RateLimiter struct {
+	mu       sync.Mutex
+	rate     float64
+	tokens   float64
+	last     time.Time
+	nowFunc  func() time.Time
+	sleepFor func(time.Duration)
+}
+
+// NewRateLimiter returns a RateLimiter allowing perSecond tokens per second,
+// or nil if perSecond is not positive.
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:     perSecond,
+		tokens:   perSecond,
+		last:     time.Now(),
+		nowFunc:  time.Now,
+		sleepFor: time.Sleep,
+	}
+}
+
+// Rate returns the number of tokens allowed per second.
+func (r *RateLimiter) Rate() float64 {
+	if r == nil {
+		return 0
+	}
+	return r.rate
+}
+
+// Wait takes n tokens from the bucket, sleeping if the bucket does not
+// currently hold enough of them.
+func (r *RateLimiter) Wait(n int64) {
+	if r == nil || n <= 0 {
+		return
+	}
+	if d := r.reserve(n); d > 0 {
+		r.sleepFor(d)
+	}
+}
+
+// reserve takes n tokens and returns how long the caller must wait before
+// the tokens are considered available.
+func (r *RateLimiter) reserve(n int64) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.nowFunc()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.rate {
+		r.tokens = r.rate
+	}
+	r.last = now
+
+	r.tokens -= float64(n)
+	if r.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-r.tokens / r.rate * float64(time.Second))
+}
@@ -0,0 +1,64 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimiter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a rate limiter on a fake clock", t, func() {
+		now := time.Unix(0, 0)
+		var slept time.Duration
+		limiter := NewRateLimiter(100)
+		limiter.last = now
+		limiter.nowFunc = func() time.Time { return now }
+		limiter.sleepFor = func(d time.Duration) {
+			slept += d
+			now = now.Add(d)
+		}
+
+		Convey("requests within the burst do not wait", func() {
+			limiter.Wait(60)
+			limiter.Wait(40)
+			So(slept, ShouldEqual, 0)
+		})
+
+		Convey("requests beyond the burst wait for the deficit", func() {
+			limiter.Wait(100)
+			limiter.Wait(50)
+			So(slept, ShouldEqual, 500*time.Millisecond)
+		})
+
+		Convey("tokens refill over time but never beyond one second's worth", func() {
+			limiter.Wait(100)
+			now = now.Add(10 * time.Second)
+			limiter.Wait(100)
+			So(slept, ShouldEqual, 0)
+			limiter.Wait(100)
+			So(slept, ShouldEqual, time.Second)
+		})
+
+		Convey("large requests go into debt instead of starving", func() {
+			limiter.Wait(300)
+			So(slept, ShouldEqual, 2*time.Second)
+		})
+	})
+
+	Convey("A non-positive rate produces a nil limiter that never waits", t, func() {
+		limiter := NewRateLimiter(0)
+		So(limiter, ShouldBeNil)
+		limiter.Wait(1000)
+		So(limiter.Rate(), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StateFile is a file that records the state of a tool between runs, such
+// as the progress of a --resume dump or restore, as canonical extended JSON.
+// It is written atomically, so a tool that is interrupted leaves either the
+// old or the new state behind. Its lock is for the state it holds, which
+// callers should hold while they change and write it.
+type StateFile struct {
+	sync.Mutex
+
+	path string
+	// kind names the state in errors, such as "resume".
+	kind string
+}
+
+// NewStateFile returns the state file at path, holding the given kind of state.
+func NewStateFile(path, kind string) *StateFile {
+	return &StateFile{path: path, kind: kind}
+}
+
+// Path returns the location of the file.
+func (f *StateFile) Path() string {
+	return f.path
+}
+
+// Read reads the file into state, returning false if it doesn't exist yet.
+func (f *StateFile) Read(state interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading %v state: %v", f.kind, err)
+	}
+	if err = bson.UnmarshalExtJSON(data, true, state); err != nil {
+		return false, fmt.Errorf("error parsing %v state %v: %v", f.kind, f.path, err)
+	}
+	return true, nil
+}
+
+// Write replaces the file with state, creating its directory if needed.
+func (f *StateFile) Write(state interface{}) error {
+	data, err := bson.MarshalExtJSON(state, true, false)
+	if err != nil {
+		return fmt.Errorf("error marshalling %v state: %v", f.kind, err)
+	}
+	if err = os.MkdirAll(filepath.Dir(f.path), os.ModeDir|os.ModePerm); err != nil {
+		return fmt.Errorf("error creating directory for %v state: %v", f.kind, err)
+	}
+	tmp := f.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing %v state: %v", f.kind, err)
+	}
+	if err = os.Rename(tmp, f.path); err != nil {
+		return fmt.Errorf("error writing %v state: %v", f.kind, err)
+	}
+	return nil
+}
+
+// Remove deletes the file, such as once the tool has completed.
+func (f *StateFile) Remove() error {
+	err := os.Remove(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing %v state: %v", f.kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type testState struct {
+	LastID primitive.ObjectID `bson:"lastId"`
+	Docs   int64              `bson:"docs"`
+}
+
+func TestStateFile(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a state file in a directory that doesn't exist yet", t, func() {
+		path := filepath.Join(t.TempDir(), "state", "progress.json")
+		file := NewStateFile(path, "test")
+
+		Convey("reading it finds nothing", func() {
+			found, err := file.Read(&testState{})
+			So(err, ShouldBeNil)
+			So(found, ShouldBeFalse)
+		})
+
+		Convey("the state survives writing and reading it with its types intact", func() {
+			state := testState{LastID: primitive.NewObjectID(), Docs: 7}
+			So(file.Write(state), ShouldBeNil)
+			_, err := os.Stat(path + ".tmp")
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			var read testState
+			found, err := NewStateFile(path, "test").Read(&read)
+			So(err, ShouldBeNil)
+			So(found, ShouldBeTrue)
+			So(read, ShouldResemble, state)
+
+			So(file.Remove(), ShouldBeNil)
+			So(file.Remove(), ShouldBeNil)
+			_, err = os.Stat(path)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("a file that isn't extended JSON can't be read", func() {
+			So(os.MkdirAll(filepath.Dir(path), 0755), ShouldBeNil)
+			So(ioutil.WriteFile(path, []byte("not json"), 0644), ShouldBeNil)
+			_, err := file.Read(&testState{})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "error parsing test state")
+		})
+	})
+}
@@ -0,0 +1,122 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package util
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/log"
+)
+
+// throttleCheckInterval is how often a Throttle's monitor checks whether to
+// pause, such as for the replication lag of --maxReplicationLag.
+const throttleCheckInterval = 5 * time.Second
+
+// Throttle paces the documents a tool reads or writes according to limits
+// on bytes and documents per second, and pauses them while a check of the
+// server, such as of its replication lag, says to. It is shared by all of
+// the tool's goroutines so the limits apply to the tool as a whole. A nil
+// *Throttle never waits.
+type Throttle struct {
+	bytes *RateLimiter
+	docs  *RateLimiter
+
+	// what is paused, such as "reads", in log messages
+	what string
+
+	// paused is set while the monitor's check says to pause.
+	paused   int32
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// NewThrottle returns a Throttle that limits documents to bytesPerSec and
+// docsPerSec, where a limit that isn't positive is no limit. what names what
+// is throttled in log messages, such as "reads".
+func NewThrottle(what string, bytesPerSec, docsPerSec float64) *Throttle {
+	return &Throttle{
+		bytes:   NewRateLimiter(bytesPerSec),
+		docs:    NewRateLimiter(docsPerSec),
+		what:    what,
+		stopped: make(chan struct{}),
+	}
+}
+
+// Wait blocks until a document of the given size may be processed.
+func (t *Throttle) Wait(size int) {
+	if t == nil {
+		return
+	}
+	for atomic.LoadInt32(&t.paused) == 1 {
+		select {
+		case <-t.stopped:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+	t.docs.Wait(1)
+	t.bytes.Wait(int64(size))
+}
+
+// Stop ends the monitor and releases any paused callers. It may be called
+// more than once.
+func (t *Throttle) Stop() {
+	if t != nil {
+		t.stopOnce.Do(func() { close(t.stopped) })
+	}
+}
+
+// StopOn stops the throttle when done is closed, such as on shutdown.
+func (t *Throttle) StopOn(done <-chan struct{}) {
+	if t == nil {
+		return
+	}
+	go func() {
+		select {
+		case <-done:
+			t.Stop()
+		case <-t.stopped:
+		}
+	}()
+}
+
+// Monitor runs check periodically until the throttle stops, pausing while
+// check returns a reason to pause. If check fails, the monitor warns that
+// option will be ignored, stops pausing and returns. It is meant to run in
+// its own goroutine.
+func (t *Throttle) Monitor(option string, check func() (reason string, err error)) {
+	ticker := time.NewTicker(throttleCheckInterval)
+	defer ticker.Stop()
+	for {
+		reason, err := check()
+		if err != nil {
+			log.Logvf(log.Always, "warning: %v will be ignored: %v", option, err)
+			t.SetPaused("")
+			return
+		}
+		t.SetPaused(reason)
+
+		select {
+		case <-t.stopped:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetPaused pauses if reason is not empty and resumes otherwise.
+func (t *Throttle) SetPaused(reason string) {
+	if reason != "" {
+		if atomic.SwapInt32(&t.paused, 1) == 0 {
+			log.Logvf(log.Always, "%v, pausing %v", reason, t.what)
+		}
+	} else if atomic.SwapInt32(&t.paused, 0) == 1 {
+		log.Logvf(log.Always, "resuming %v", t.what)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestThrottle(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A throttle limits bytes and documents per second", t, func() {
+		throttle := NewThrottle("writes", 2*1024*1024, 100)
+		defer throttle.Stop()
+		So(throttle.bytes.Rate(), ShouldEqual, 2*1024*1024)
+		So(throttle.docs.Rate(), ShouldEqual, 100)
+
+		var none *Throttle
+		So(func() { none.Wait(100) }, ShouldNotPanic)
+		So(func() { none.Stop() }, ShouldNotPanic)
+	})
+
+	waitReturns := func(throttle *Throttle, within time.Duration) bool {
+		done := make(chan struct{})
+		go func() {
+			throttle.Wait(1)
+			close(done)
+		}()
+		select {
+		case <-done:
+			return true
+		case <-time.After(within):
+			return false
+		}
+	}
+
+	Convey("A paused throttle waits until it resumes", t, func() {
+		throttle := NewThrottle("writes", 0, 0)
+		defer throttle.Stop()
+		throttle.SetPaused("replication lag on the target is 1m0s")
+		So(waitReturns(throttle, 50*time.Millisecond), ShouldBeFalse)
+		throttle.SetPaused("")
+		So(waitReturns(throttle, 5*time.Second), ShouldBeTrue)
+	})
+
+	Convey("A paused throttle stops waiting when it is stopped", t, func() {
+		throttle := NewThrottle("reads", 0, 0)
+		done := make(chan struct{})
+		throttle.StopOn(done)
+		throttle.SetPaused("replication lag on the source is 1m0s")
+		So(waitReturns(throttle, 50*time.Millisecond), ShouldBeFalse)
+		close(done)
+		So(waitReturns(throttle, 5*time.Second), ShouldBeTrue)
+		So(func() { throttle.Stop() }, ShouldNotPanic)
+	})
+
+	Convey("A monitor whose check fails stops pausing", t, func() {
+		throttle := NewThrottle("reads", 0, 0)
+		defer throttle.Stop()
+		throttle.SetPaused("replication lag on the source is 1m0s")
+		throttle.Monitor("--maxReplicationLag", func() (string, error) {
+			return "", errors.New("not a replica set")
+		})
+		So(waitReturns(throttle, 5*time.Second), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,82 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// documentTransformer represents a callback that rewrites individual documents
+// before they are written. It takes the raw bytes of a BSON document and
+// returns the bytes to write in its place.
+type documentTransformer func([]byte) ([]byte, error)
+
+// transformingWriter applies a documentTransformer to everything written
+// through it. Every Write must be exactly one BSON document.
+type transformingWriter struct {
+	io.Writer
+	transform documentTransformer
+}
+
+// Write transforms doc and writes the result. It reports len(doc) bytes
+// written on success so that callers are unaware of the transformation.
+func (tw *transformingWriter) Write(doc []byte) (int, error) {
+	out, err := tw.transform(doc)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = tw.Writer.Write(out); err != nil {
+		return 0, err
+	}
+	return len(doc), nil
+}
+
+// authDBRewriter returns a documentTransformer for user and role documents
+// that replaces references to database from with database to: the "db"
+// fields of the document, its granted roles, and its privilege resources, as
+// well as the "<db>." prefix of its _id.
+func authDBRewriter(from, to string) documentTransformer {
+	return func(raw []byte) ([]byte, error) {
+		var doc bson.D
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return nil, fmt.Errorf("error decoding user or role document: %v", err)
+		}
+		for i, elem := range doc {
+			if id, ok := elem.Value.(string); ok && elem.Key == "_id" && strings.HasPrefix(id, from+".") {
+				doc[i].Value = to + "." + strings.TrimPrefix(id, from+".")
+			}
+		}
+		rewriteDBFields(doc, from, to)
+		out, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding user or role document: %v", err)
+		}
+		return out, nil
+	}
+}
+
+// rewriteDBFields replaces every "db" field equal to from with to, at any depth.
+func rewriteDBFields(value interface{}, from, to string) {
+	switch v := value.(type) {
+	case bson.D:
+		for i, elem := range v {
+			if db, ok := elem.Value.(string); ok && elem.Key == "db" && db == from {
+				v[i].Value = to
+				continue
+			}
+			rewriteDBFields(elem.Value, from, to)
+		}
+	case bson.A:
+		for _, elem := range v {
+			rewriteDBFields(elem, from, to)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAuthDBRewriter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a rewriter from tenant1 to tenant2", t, func() {
+		rewrite := authDBRewriter("tenant1", "tenant2")
+
+		Convey("user documents have their database and roles rewritten", func() {
+			user, err := bson.Marshal(bson.M{
+				"_id":  "tenant1.app",
+				"user": "app",
+				"db":   "tenant1",
+				"roles": bson.A{
+					bson.M{"role": "readWrite", "db": "tenant1"},
+					bson.M{"role": "read", "db": "shared"},
+				},
+			})
+			So(err, ShouldBeNil)
+
+			out, err := rewrite(user)
+			So(err, ShouldBeNil)
+			var result bson.M
+			So(bson.Unmarshal(out, &result), ShouldBeNil)
+			So(result["_id"], ShouldEqual, "tenant2.app")
+			So(result["db"], ShouldEqual, "tenant2")
+			roles := result["roles"].(bson.A)
+			So(roles[0].(bson.M)["db"], ShouldEqual, "tenant2")
+			So(roles[1].(bson.M)["db"], ShouldEqual, "shared")
+		})
+
+		Convey("role privileges are rewritten", func() {
+			role, err := bson.Marshal(bson.M{
+				"_id":  "tenant1.reporter",
+				"role": "reporter",
+				"db":   "tenant1",
+				"privileges": bson.A{
+					bson.M{"resource": bson.M{"db": "tenant1", "collection": "reports"}, "actions": bson.A{"find"}},
+				},
+			})
+			So(err, ShouldBeNil)
+
+			var buf bytes.Buffer
+			writer := &transformingWriter{Writer: &buf, transform: rewrite}
+			n, err := writer.Write(role)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, len(role))
+
+			var result bson.M
+			So(bson.Unmarshal(buf.Bytes(), &result), ShouldBeNil)
+			So(result["_id"], ShouldEqual, "tenant2.reporter")
+			resource := result["privileges"].(bson.A)[0].(bson.M)["resource"].(bson.M)
+			So(resource["db"], ShouldEqual, "tenant2")
+			So(resource["collection"], ShouldEqual, "reports")
+		})
+	})
+}
@@ -0,0 +1,288 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/bsonutil"
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// HashManifest records a hash of every _id range of every collection in a
+// dump. Given the manifest of an earlier dump, --baseManifest only writes out
+// the ranges whose hash has changed since.
+type HashManifest struct {
+	Created     time.Time                    `bson:"created"`
+	ChunkDocs   int                          `bson:"chunkDocs"`
+	Collections map[string]*CollectionHashes `bson:"collections"`
+
+	lock sync.Mutex
+}
+
+// CollectionHashes holds the ranges of one collection, in _id order.
+type CollectionHashes struct {
+	Ranges []RangeHash `bson:"ranges"`
+}
+
+// RangeHash describes the documents whose _id is at least Min and less than
+// the Min of the next range. The first range has no Min.
+type RangeHash struct {
+	Min   interface{} `bson:"min,omitempty"`
+	Count int64       `bson:"count"`
+	Hash  string      `bson:"hash"`
+	// Changed is set on ranges whose documents were written to the dump.
+	// To apply a differential dump, the documents in each changed range
+	// replace those in the same range of the base dump.
+	Changed bool `bson:"changed"`
+}
+
+// loadHashManifest reads a manifest written by an earlier --hashManifest.
+func loadHashManifest(path string) (*HashManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading hash manifest: %v", err)
+	}
+	manifest := &HashManifest{}
+	if err = bson.UnmarshalExtJSON(data, true, manifest); err != nil {
+		return nil, fmt.Errorf("error parsing hash manifest %v: %v", path, err)
+	}
+	if manifest.Collections == nil {
+		manifest.Collections = map[string]*CollectionHashes{}
+	}
+	return manifest, nil
+}
+
+// write saves the manifest as indented canonical extended JSON, which keeps
+// the types of the range boundaries intact.
+func (m *HashManifest) write(path string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	jsonBytes, err := bson.MarshalExtJSON(m, true, false)
+	if err != nil {
+		return fmt.Errorf("error marshalling hash manifest: %v", err)
+	}
+	var indented bytes.Buffer
+	if err = json.Indent(&indented, jsonBytes, "", "  "); err != nil {
+		return fmt.Errorf("error formatting hash manifest: %v", err)
+	}
+	indented.WriteByte('\n')
+	if err = ioutil.WriteFile(path, indented.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing hash manifest: %v", err)
+	}
+	return nil
+}
+
+func (m *HashManifest) ranges(ns string) []RangeHash {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if c, ok := m.Collections[ns]; ok {
+		return c.Ranges
+	}
+	return nil
+}
+
+func (m *HashManifest) setRanges(ns string, ranges []RangeHash) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.Collections[ns] = &CollectionHashes{Ranges: ranges}
+}
+
+// canHashIntent reports whether an intent's documents are split into hashed
+// ranges. Views, time series, and special collections are always dumped whole.
+func canHashIntent(intent *intents.Intent) bool {
+	return !intent.IsView() && !intent.IsTimeseries() && !intent.IsSpecialCollection() && !intent.IsOplog()
+}
+
+// rangeHasher sits in front of an intent's writer and hashes its documents
+// range by range. The documents of each range are held back until the range
+// is complete and only written if its hash differs from the base manifest.
+// Documents must arrive in _id order, one per Write.
+type rangeHasher struct {
+	out       io.Writer
+	base      []RangeHash
+	baseMins  []bson.RawValue
+	chunkDocs int
+
+	index   int
+	current *hashedRange
+	result  []RangeHash
+}
+
+// hashedRange is the state of the range being read.
+type hashedRange struct {
+	min   interface{}
+	count int64
+	whole hash.Hash
+	// pieces hash every chunkDocs documents separately so that large
+	// ranges can be split in the new manifest.
+	pieces     []RangeHash
+	piece      hash.Hash
+	pieceCount int64
+	pieceMin   interface{}
+
+	held bytes.Buffer
+	// passthrough is set once the range is known to have changed, after
+	// which its documents are written straight away.
+	passthrough bool
+}
+
+func newRangeHasher(out io.Writer, base []RangeHash, chunkDocs int) (*rangeHasher, error) {
+	h := &rangeHasher{out: out, base: base, chunkDocs: chunkDocs}
+	for i, r := range base {
+		if i == 0 {
+			h.baseMins = append(h.baseMins, bson.RawValue{})
+			continue
+		}
+		t, data, err := bson.MarshalValue(r.Min)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range boundary in hash manifest: %v", err)
+		}
+		h.baseMins = append(h.baseMins, bson.RawValue{Type: t, Value: data})
+	}
+	h.startRange(nil)
+	return h, nil
+}
+
+func (h *rangeHasher) startRange(min interface{}) {
+	h.current = &hashedRange{min: min, whole: sha256.New(), piece: sha256.New(), pieceMin: min}
+	// ranges that are not in the base manifest have always changed
+	if h.index >= len(h.base) {
+		h.current.passthrough = true
+	}
+}
+
+// baseRange returns the base manifest's entry for the current range, if any.
+func (h *rangeHasher) baseRange() *RangeHash {
+	if h.index < len(h.base) {
+		return &h.base[h.index]
+	}
+	return nil
+}
+
+// Write adds a document to the range its _id falls in.
+func (h *rangeHasher) Write(doc []byte) (int, error) {
+	id, err := bson.Raw(doc).LookupErr("_id")
+	if err != nil {
+		return 0, fmt.Errorf("document without _id: %v", err)
+	}
+	for h.index+1 < len(h.base) && bsonutil.CompareValues(id, h.baseMins[h.index+1]) >= 0 {
+		if err = h.endRange(); err != nil {
+			return 0, err
+		}
+		h.index++
+		h.startRange(h.base[h.index].Min)
+	}
+
+	r := h.current
+	if r.pieceCount == int64(h.chunkDocs) {
+		r.pieces = append(r.pieces, RangeHash{Min: r.pieceMin, Count: r.pieceCount, Hash: hex.EncodeToString(r.piece.Sum(nil))})
+		r.piece.Reset()
+		r.pieceCount = 0
+		var idValue interface{}
+		if err = id.Unmarshal(&idValue); err != nil {
+			return 0, fmt.Errorf("error decoding _id: %v", err)
+		}
+		r.pieceMin = idValue
+	}
+	r.whole.Write(doc)
+	r.piece.Write(doc)
+	r.count++
+	r.pieceCount++
+
+	// a range holding more documents than before has certainly changed
+	if base := h.baseRange(); !r.passthrough && base != nil && r.count > base.Count {
+		if err = h.release(); err != nil {
+			return 0, err
+		}
+	}
+	if r.passthrough {
+		if _, err = h.out.Write(doc); err != nil {
+			return 0, err
+		}
+	} else {
+		r.held.Write(doc)
+	}
+	return len(doc), nil
+}
+
+// release writes out the held documents of the current range and passes the
+// rest of the range through.
+func (h *rangeHasher) release() error {
+	r := h.current
+	r.passthrough = true
+	_, err := h.out.Write(r.held.Bytes())
+	r.held.Reset()
+	return err
+}
+
+// endRange decides whether the current range changed and records it.
+func (h *rangeHasher) endRange() error {
+	r := h.current
+	sum := hex.EncodeToString(r.whole.Sum(nil))
+	base := h.baseRange()
+	changed := base == nil || base.Hash != sum || base.Count != r.count
+	if changed {
+		if !r.passthrough {
+			if err := h.release(); err != nil {
+				return err
+			}
+		}
+	}
+	r.held.Reset()
+
+	if r.count <= int64(2*h.chunkDocs) {
+		h.result = append(h.result, RangeHash{Min: r.min, Count: r.count, Hash: sum, Changed: changed})
+		return nil
+	}
+	pieces := append(r.pieces, RangeHash{Min: r.pieceMin, Count: r.pieceCount, Hash: hex.EncodeToString(r.piece.Sum(nil))})
+	for _, piece := range pieces {
+		piece.Changed = changed
+		h.result = append(h.result, piece)
+	}
+	return nil
+}
+
+// finish completes the last range, as well as any base ranges that no longer
+// contain documents, and returns the ranges for the new manifest.
+func (h *rangeHasher) finish() ([]RangeHash, error) {
+	if err := h.endRange(); err != nil {
+		return nil, err
+	}
+	for h.index+1 < len(h.base) {
+		h.index++
+		h.startRange(h.base[h.index].Min)
+		if err := h.endRange(); err != nil {
+			return nil, err
+		}
+	}
+	return h.result, nil
+}
+
+// logSummary reports how much of a collection was written.
+func (h *rangeHasher) logSummary(ns string) {
+	var changed int
+	for _, r := range h.result {
+		if r.Changed {
+			changed++
+		}
+	}
+	log.Logvf(log.Info, "%v of %v %v changed in %v", changed, len(h.result),
+		util.Pluralize(len(h.result), "range", "ranges"), ns)
+}
@@ -0,0 +1,107 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// hashDocs writes documents with the given _ids and values through a
+// rangeHasher and returns the new ranges and the number of documents written.
+func hashDocs(base []RangeHash, ids []int32, value func(int32) string) ([]RangeHash, int) {
+	var out bytes.Buffer
+	hasher, err := newRangeHasher(&out, base, 2)
+	So(err, ShouldBeNil)
+	for _, id := range ids {
+		doc, err := bson.Marshal(bson.D{bson.E{Key: "_id", Value: id}, bson.E{Key: "v", Value: value(id)}})
+		So(err, ShouldBeNil)
+		_, err = hasher.Write(doc)
+		So(err, ShouldBeNil)
+	}
+	ranges, err := hasher.finish()
+	So(err, ShouldBeNil)
+
+	written := 0
+	for out.Len() > 0 {
+		doc, _, ok := bsoncore.ReadDocument(out.Bytes())
+		So(ok, ShouldBeTrue)
+		out.Next(len(doc))
+		written++
+	}
+	return ranges, written
+}
+
+func TestRangeHasher(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	ids := []int32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	original := func(id int32) string { return "original" }
+
+	Convey("With a collection hashed without a base manifest", t, func() {
+		ranges, written := hashDocs(nil, ids, original)
+		So(written, ShouldEqual, 10)
+		So(len(ranges), ShouldEqual, 5)
+		for _, r := range ranges {
+			So(r.Count, ShouldEqual, 2)
+			So(r.Changed, ShouldBeTrue)
+		}
+
+		Convey("an unchanged collection writes no documents", func() {
+			next, written := hashDocs(ranges, ids, original)
+			So(written, ShouldEqual, 0)
+			So(len(next), ShouldEqual, 5)
+			for i, r := range next {
+				So(r.Changed, ShouldBeFalse)
+				So(r.Hash, ShouldEqual, ranges[i].Hash)
+			}
+		})
+
+		Convey("only the ranges with modified documents are written", func() {
+			next, written := hashDocs(ranges, ids, func(id int32) string {
+				if id == 4 {
+					return "modified"
+				}
+				return "original"
+			})
+			So(written, ShouldEqual, 2)
+			So(next[1].Changed, ShouldBeTrue)
+			So(next[0].Changed || next[2].Changed, ShouldBeFalse)
+		})
+
+		Convey("inserted and deleted documents mark their ranges changed", func() {
+			next, written := hashDocs(ranges, []int32{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, original)
+			So(written, ShouldEqual, 3)
+			So(next[4].Changed, ShouldBeTrue)
+			So(next[4].Count, ShouldEqual, 3)
+
+			next, written = hashDocs(ranges, []int32{1, 2, 4, 5, 6, 7, 8, 9, 10}, original)
+			So(written, ShouldEqual, 1)
+			So(next[1].Changed, ShouldBeTrue)
+			So(next[1].Count, ShouldEqual, 1)
+		})
+
+		Convey("the manifest round-trips through a file", func() {
+			manifest := &HashManifest{ChunkDocs: 2, Collections: map[string]*CollectionHashes{}}
+			manifest.setRanges("db.c", ranges)
+			path := filepath.Join(t.TempDir(), "manifest.json")
+			So(manifest.write(path), ShouldBeNil)
+
+			loaded, err := loadHashManifest(path)
+			So(err, ShouldBeNil)
+			So(loaded.ChunkDocs, ShouldEqual, 2)
+			_, written := hashDocs(loaded.ranges("db.c"), ids, original)
+			So(written, ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,154 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Namespace types recorded in a dump plan.
+const (
+	planTypeCollection = "collection"
+	planTypeView       = "view"
+	planTypeTimeseries = "timeseries"
+)
+
+// DumpPlan describes everything a restore of the dump would recreate. It is
+// written by --dumpPlan so a restore can be reviewed before it is run.
+type DumpPlan struct {
+	ToolVersion   string          `bson:"toolVersion"`
+	ServerVersion string          `bson:"serverVersion"`
+	Created       time.Time       `bson:"created"`
+	Oplog         bool            `bson:"oplog"`
+	UsersAndRoles bool            `bson:"usersAndRoles"`
+	Namespaces    []DumpPlanEntry `bson:"namespaces"`
+}
+
+// DumpPlanEntry describes how a single namespace would be recreated.
+type DumpPlanEntry struct {
+	Namespace string `bson:"namespace"`
+	Type      string `bson:"type"`
+	UUID      string `bson:"uuid,omitempty"`
+
+	ViewOn             interface{} `bson:"viewOn,omitempty"`
+	Pipeline           interface{} `bson:"pipeline,omitempty"`
+	Validator          interface{} `bson:"validator,omitempty"`
+	ValidationLevel    interface{} `bson:"validationLevel,omitempty"`
+	ValidationAction   interface{} `bson:"validationAction,omitempty"`
+	Collation          interface{} `bson:"collation,omitempty"`
+	ClusteredIndex     interface{} `bson:"clusteredIndex,omitempty"`
+	Timeseries         interface{} `bson:"timeseries,omitempty"`
+	ExpireAfterSeconds interface{} `bson:"expireAfterSeconds,omitempty"`
+	Capped             interface{} `bson:"capped,omitempty"`
+	Size               interface{} `bson:"size,omitempty"`
+	Max                interface{} `bson:"max,omitempty"`
+	OtherOptions       bson.M      `bson:"otherOptions,omitempty"`
+
+	// BucketsOptions holds the options of a time series collection's
+	// underlying system.buckets collection.
+	BucketsOptions bson.M   `bson:"bucketsOptions,omitempty"`
+	Indexes        []bson.D `bson:"indexes"`
+}
+
+// newDumpPlanEntry builds the plan entry for an intent from its dumped metadata.
+func newDumpPlanEntry(intent *intents.Intent, meta *Metadata, viewsAsCollections bool) DumpPlanEntry {
+	entry := DumpPlanEntry{
+		Namespace:      intent.Namespace(),
+		Type:           planTypeCollection,
+		UUID:           meta.UUID,
+		BucketsOptions: meta.BucketsOptions,
+		Indexes:        meta.Indexes,
+	}
+	switch {
+	case intent.IsTimeseries():
+		entry.Type = planTypeTimeseries
+	case intent.IsView() && !viewsAsCollections:
+		entry.Type = planTypeView
+	}
+
+	fields := map[string]*interface{}{
+		"viewOn":             &entry.ViewOn,
+		"pipeline":           &entry.Pipeline,
+		"validator":          &entry.Validator,
+		"validationLevel":    &entry.ValidationLevel,
+		"validationAction":   &entry.ValidationAction,
+		"collation":          &entry.Collation,
+		"clusteredIndex":     &entry.ClusteredIndex,
+		"timeseries":         &entry.Timeseries,
+		"expireAfterSeconds": &entry.ExpireAfterSeconds,
+		"capped":             &entry.Capped,
+		"size":               &entry.Size,
+		"max":                &entry.Max,
+	}
+	for key, value := range meta.Options {
+		if field, ok := fields[key]; ok {
+			*field = value
+			continue
+		}
+		if entry.OtherOptions == nil {
+			entry.OtherOptions = bson.M{}
+		}
+		entry.OtherOptions[key] = value
+	}
+	return entry
+}
+
+// recordPlanEntry adds the metadata for an intent to the dump plan.
+func (dump *MongoDump) recordPlanEntry(intent *intents.Intent, meta *Metadata) {
+	dump.planLock.Lock()
+	defer dump.planLock.Unlock()
+	dump.planEntries = append(dump.planEntries,
+		newDumpPlanEntry(intent, meta, dump.OutputOptions.ViewsAsCollections))
+}
+
+// writeDumpPlan writes the recorded plan entries to the --dumpPlan file as
+// indented extended JSON.
+func (dump *MongoDump) writeDumpPlan(serverVersion string) error {
+	dump.planLock.Lock()
+	entries := append([]DumpPlanEntry{}, dump.planEntries...)
+	dump.planLock.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Namespace < entries[j].Namespace
+	})
+	plan := DumpPlan{
+		ToolVersion:   dump.ToolOptions.VersionStr,
+		ServerVersion: serverVersion,
+		Created:       time.Now().UTC(),
+		Oplog:         dump.OutputOptions.Oplog,
+		UsersAndRoles: !dump.SkipUsersAndRoles && !dump.OutputOptions.skipsData() &&
+			(dump.OutputOptions.DumpDBUsersAndRoles || dump.ToolOptions.DB == "" || dump.ToolOptions.DB == "admin"),
+		Namespaces: entries,
+	}
+
+	jsonBytes, err := bson.MarshalExtJSON(plan, false, false)
+	if err != nil {
+		return fmt.Errorf("error marshalling dump plan: %v", err)
+	}
+	var indented bytes.Buffer
+	if err = json.Indent(&indented, jsonBytes, "", "  "); err != nil {
+		return fmt.Errorf("error formatting dump plan: %v", err)
+	}
+	indented.WriteByte('\n')
+
+	if err = ioutil.WriteFile(dump.OutputOptions.DumpPlan, indented.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing dump plan: %v", err)
+	}
+	log.Logvf(log.Always, "wrote dump plan for %v %v to %v", len(entries),
+		util.Pluralize(len(entries), "namespace", "namespaces"), dump.OutputOptions.DumpPlan)
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNewDumpPlanEntry(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When building dump plan entries", t, func() {
+		Convey("view options are broken out", func() {
+			intent := &intents.Intent{DB: "test", C: "v", Type: "view"}
+			meta := &Metadata{
+				Options: bson.M{
+					"viewOn":    "c",
+					"pipeline":  bson.A{bson.M{"$match": bson.M{"x": 1}}},
+					"collation": bson.M{"locale": "fr"},
+				},
+				Indexes: []bson.D{},
+			}
+			entry := newDumpPlanEntry(intent, meta, false)
+			So(entry.Namespace, ShouldEqual, "test.v")
+			So(entry.Type, ShouldEqual, planTypeView)
+			So(entry.ViewOn, ShouldEqual, "c")
+			So(entry.Pipeline, ShouldNotBeNil)
+			So(entry.Collation, ShouldResemble, bson.M{"locale": "fr"})
+			So(entry.OtherOptions, ShouldBeNil)
+
+			So(newDumpPlanEntry(intent, meta, true).Type, ShouldEqual, planTypeCollection)
+		})
+
+		Convey("time series settings and unknown options are kept", func() {
+			intent := &intents.Intent{DB: "test", C: "ts", Type: "timeseries"}
+			meta := &Metadata{
+				Options: bson.M{
+					"timeseries":         bson.M{"timeField": "t", "granularity": "hours"},
+					"expireAfterSeconds": int64(60),
+					"storageEngine":      bson.M{},
+				},
+				BucketsOptions: bson.M{"clusteredIndex": true},
+			}
+			entry := newDumpPlanEntry(intent, meta, false)
+			So(entry.Type, ShouldEqual, planTypeTimeseries)
+			So(entry.Timeseries, ShouldResemble, bson.M{"timeField": "t", "granularity": "hours"})
+			So(entry.ExpireAfterSeconds, ShouldEqual, int64(60))
+			So(entry.BucketsOptions, ShouldResemble, bson.M{"clusteredIndex": true})
+			So(entry.OtherOptions, ShouldResemble, bson.M{"storageEngine": bson.M{}})
+		})
+	})
+}
@@ -53,10 +53,35 @@ func main() {
 	// verify uri options and log them
 	opts.URI.LogUnsupportedOptions()
 
-	// kick off the progress bar manager
-	progressManager := progress.NewBarWriter(log.Writer(0), progressBarWaitTime, progressBarLength, false)
-	progressManager.Start()
-	defer progressManager.Stop()
+	var progressManager progress.Manager
+	if opts.ProgressJSON != progress.JSONTargetStderr {
+		// kick off the progress bar manager
+		barWriter := progress.NewBarWriter(log.Writer(0), progressBarWaitTime, progressBarLength, false)
+		barWriter.Start()
+		defer barWriter.Stop()
+		progressManager = barWriter
+	}
+	if opts.ProgressJSON != "" {
+		progressOut, err := progress.OpenJSONTarget(opts.ProgressJSON)
+		if err != nil {
+			log.Logvf(log.Always, "error opening --progressJson target: %v", err)
+			os.Exit(util.ExitFailure)
+		}
+		defer progressOut.Close()
+		jsonWriter := progress.NewJSONWriter(progressOut, "mongodump", opts.ProgressJSONInterval)
+		jsonWriter.Start()
+		defer jsonWriter.Stop()
+		progressManager = addProgressManager(progressManager, jsonWriter)
+	}
+	if opts.Prom != "" {
+		exporter, err := progress.StartPromExporter(opts.Prom, "mongodump")
+		if err != nil {
+			log.Logvf(log.Always, "%v", err)
+			os.Exit(util.ExitFailure)
+		}
+		defer exporter.Stop()
+		progressManager = addProgressManager(progressManager, exporter)
+	}
 
 	dump := mongodump.MongoDump{
 		ToolOptions:     opts.ToolOptions,
@@ -78,3 +103,12 @@ func main() {
 		os.Exit(util.ExitFailure)
 	}
 }
+
+// addProgressManager returns a manager that registers progressors with both
+// managers, or only the added one if there is none yet.
+func addProgressManager(manager, added progress.Manager) progress.Manager {
+	if manager == nil {
+		return added
+	}
+	return progress.NewMultiManager(manager, added)
+}
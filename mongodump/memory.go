@@ -0,0 +1,151 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/huimingz/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// readAheadDocs is how many documents each dump routine may read ahead of
+// writing them when --maxMemoryMB bounds the memory they hold.
+const readAheadDocs = 256
+
+// documentPool holds the documents read from the server and waiting to be
+// written, for every dump routine. With --maxMemoryMB, routines wait for
+// memory to be freed rather than read more than their share, so that
+// dumping many wide collections in parallel can't exhaust memory. Freed
+// buffers are kept to be reused. A nil *documentPool never waits.
+type documentPool struct {
+	limit int64
+
+	lock      sync.Mutex
+	freed     *sync.Cond
+	inUse     int64
+	free      [][]byte
+	freeBytes int64
+}
+
+// newDocumentPool returns a pool holding at most limit bytes, or nil if
+// limit isn't positive.
+func newDocumentPool(limit int64) *documentPool {
+	if limit <= 0 {
+		return nil
+	}
+	p := &documentPool{limit: limit}
+	p.freed = sync.NewCond(&p.lock)
+	return p
+}
+
+// charge is what a buffer of size bytes counts against the limit. A
+// document larger than the whole limit is handed out once nothing else is
+// held, rather than never.
+func (p *documentPool) charge(size int) int64 {
+	if int64(size) > p.limit {
+		return p.limit
+	}
+	return int64(size)
+}
+
+// get returns a buffer of size bytes, waiting until it fits in the limit.
+func (p *documentPool) get(size int) []byte {
+	if p == nil {
+		return make([]byte, size)
+	}
+	charge := p.charge(size)
+	p.lock.Lock()
+	for p.inUse > 0 && p.inUse+charge > p.limit {
+		p.freed.Wait()
+	}
+	p.inUse += charge
+	var buf []byte
+	for i, candidate := range p.free {
+		if cap(candidate) >= size {
+			buf = candidate[:size]
+			p.free = append(p.free[:i], p.free[i+1:]...)
+			p.freeBytes -= int64(cap(candidate))
+			break
+		}
+	}
+	p.lock.Unlock()
+	if buf == nil {
+		buf = make([]byte, size)
+	}
+	return buf
+}
+
+// put returns a buffer from get once it has been written. Up to a quarter
+// of the limit is kept in freed buffers for reuse.
+func (p *documentPool) put(buf []byte) {
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	p.inUse -= p.charge(len(buf))
+	if p.freeBytes+int64(cap(buf)) <= p.limit/4 {
+		p.free = append(p.free, buf)
+		p.freeBytes += int64(cap(buf))
+	}
+	p.lock.Unlock()
+	p.freed.Broadcast()
+}
+
+// readAhead is how many documents each dump routine may hold ahead of
+// writing them.
+func (p *documentPool) readAhead() int {
+	if p == nil {
+		return 0
+	}
+	return readAheadDocs
+}
+
+// newDocumentPoolForOptions sets up --maxMemoryMB. Half of the memory is for
+// the documents waiting to be written and half for the batches the driver
+// reads for the collections being dumped in parallel.
+func (dump *MongoDump) newDocumentPoolForOptions() *documentPool {
+	if dump.OutputOptions.MaxMemoryMB <= 0 {
+		return nil
+	}
+	log.Logvf(log.Info, "limiting memory used for documents to %v MB", dump.OutputOptions.MaxMemoryMB)
+	return newDocumentPool(int64(dump.OutputOptions.MaxMemoryMB) * 1024 * 1024 / 2)
+}
+
+// batchSizeFor returns the cursor batch size keeping one batch of coll
+// within its share of --maxMemoryMB, or 0 to leave the batch size to the
+// server.
+func (dump *MongoDump) batchSizeFor(coll *mongo.Collection) int32 {
+	if dump.documents == nil {
+		return 0
+	}
+	var stats struct {
+		AvgObjSize float64 `bson:"avgObjSize"`
+	}
+	result := coll.Database().RunCommand(context.Background(), bson.D{{"collStats", coll.Name()}})
+	if err := result.Decode(&stats); err != nil || stats.AvgObjSize <= 0 {
+		log.Logvf(log.DebugLow, "unable to get the average document size of %v, using the default batch size", coll.Name())
+		return 0
+	}
+	return batchSizeForShare(dump.documents.limit/int64(dump.OutputOptions.NumParallelCollections), stats.AvgObjSize)
+}
+
+// batchSizeForShare returns how many documents of the average size fit in
+// share bytes, at least one.
+func batchSizeForShare(share int64, avgObjSize float64) int32 {
+	size := float64(share) / avgObjSize
+	switch {
+	case size < 1:
+		return 1
+	case size > math.MaxInt32:
+		return math.MaxInt32
+	}
+	return int32(size)
+}
@@ -0,0 +1,81 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDocumentPool(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a document pool limited to 100 bytes", t, func() {
+		pool := newDocumentPool(100)
+
+		Convey("buffers are handed out while they fit", func() {
+			first := pool.get(60)
+			So(first, ShouldHaveLength, 60)
+
+			got := make(chan []byte)
+			go func() { got <- pool.get(60) }()
+			select {
+			case <-got:
+				t.Fatal("buffer handed out over the limit")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			pool.put(first)
+			select {
+			case second := <-got:
+				So(second, ShouldHaveLength, 60)
+				pool.put(second)
+			case <-time.After(5 * time.Second):
+				t.Fatal("buffer not handed out once memory was freed")
+			}
+			So(pool.inUse, ShouldEqual, 0)
+		})
+
+		Convey("a document larger than the limit is handed out when nothing else is held", func() {
+			buf := pool.get(500)
+			So(buf, ShouldHaveLength, 500)
+			So(pool.inUse, ShouldEqual, 100)
+			pool.put(buf)
+			So(pool.inUse, ShouldEqual, 0)
+		})
+
+		Convey("freed buffers are reused", func() {
+			buf := pool.get(20)
+			pool.put(buf)
+			reused := pool.get(10)
+			So(cap(reused), ShouldEqual, 20)
+			So(reused, ShouldHaveLength, 10)
+		})
+	})
+
+	Convey("Without a limit there is no pool", t, func() {
+		pool := newDocumentPool(0)
+		So(pool, ShouldBeNil)
+		So(pool.get(10), ShouldHaveLength, 10)
+		So(pool.readAhead(), ShouldEqual, 0)
+		pool.put(nil)
+	})
+}
+
+func TestBatchSizeForShare(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Batches hold as many average documents as fit in the share", t, func() {
+		So(batchSizeForShare(1024*1024, 1024), ShouldEqual, 1024)
+		So(batchSizeForShare(1024, 4096), ShouldEqual, 1)
+		So(batchSizeForShare(math.MaxInt64, 1), ShouldEqual, math.MaxInt32)
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/huimingz/mongo-tools/common/db"
 	"github.com/huimingz/mongo-tools/common/intents"
@@ -24,6 +25,14 @@ type Metadata struct {
 	UUID           string   `bson:"uuid,omitempty"`
 	CollectionName string   `bson:"collectionName"`
 	Type           string   `bson:"type,omitempty"`
+	// BucketsOptions holds the options of the system.buckets collection
+	// backing a time series collection.
+	BucketsOptions bson.M `bson:"bucketsOptions,omitempty"`
+	// DifferentialBase is set on collections dumped with --baseManifest to
+	// the creation time of the base manifest. Such a dump only holds the
+	// ranges that changed since, so mongorestore only applies it on top of
+	// a restore of the base dump, with --applyDifferential.
+	DifferentialBase string `bson:"differentialBase,omitempty"`
 }
 
 // IndexDocumentFromDB is used internally to preserve key ordering.
@@ -44,7 +53,11 @@ func (dump *MongoDump) dumpMetadata(intent *intents.Intent, buffer resettableOut
 	}
 
 	// The collection options were already gathered while building the list of intents.
-	meta.Options = intent.Options
+	// --indexesOnly leaves them out, except for views and time series collections
+	// whose options are what define them.
+	if !dump.OutputOptions.IndexesOnly || intent.IsView() || intent.IsTimeseries() {
+		meta.Options = intent.Options
+	}
 
 	// If a collection has a UUID, it was gathered while building the list of
 	// intents.  Otherwise, it will be the empty string.
@@ -58,6 +71,10 @@ func (dump *MongoDump) dumpMetadata(intent *intents.Intent, buffer resettableOut
 		meta.Type = intent.Type
 	}
 
+	if dump.baseManifest != nil && canHashIntent(intent) {
+		meta.DifferentialBase = dump.baseManifest.Created.Format(time.RFC3339Nano)
+	}
+
 	// Second, we read the collection's index information by either calling
 	// listIndexes (pre-2.7 systems) or querying system.indexes.
 	// We keep a running list of all the indexes
@@ -70,6 +87,19 @@ func (dump *MongoDump) dumpMetadata(intent *intents.Intent, buffer resettableOut
 		return err
 	}
 
+	// Time series collections are stored in a system.buckets collection whose
+	// own options (clustering, validator, bucketing parameters) are recorded so
+	// that the bucket structure can be recreated exactly.
+	if intent.IsTimeseries() {
+		bucketsInfo, err := db.GetCollectionInfo(session.Database(intent.DB).Collection(intent.DataCollection()))
+		if err != nil {
+			return fmt.Errorf("error getting options for `%v`: %v", intent.DataNamespace(), err)
+		}
+		if bucketsInfo != nil {
+			meta.BucketsOptions = bucketsInfo.Options
+		}
+	}
+
 	if dump.OutputOptions.ViewsAsCollections || intent.IsView() {
 		log.Logvf(log.DebugLow, "not dumping indexes metadata for '%v' because it is a view", intent.Namespace())
 	} else {
@@ -100,6 +130,10 @@ func (dump *MongoDump) dumpMetadata(intent *intents.Intent, buffer resettableOut
 		}
 	}
 
+	if dump.OutputOptions.DumpPlan != "" {
+		dump.recordPlanEntry(intent, &meta)
+	}
+
 	// Finally, we send the results to the writer as JSON bytes
 	jsonBytes, err := bson.MarshalExtJSON(meta, true, false)
 	if err != nil {
@@ -19,6 +19,7 @@ import (
 	"github.com/huimingz/mongo-tools/common/log"
 	"github.com/huimingz/mongo-tools/common/options"
 	"github.com/huimingz/mongo-tools/common/progress"
+	"github.com/huimingz/mongo-tools/common/text"
 	"github.com/huimingz/mongo-tools/common/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -31,7 +32,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -73,6 +76,40 @@ type MongoDump struct {
 	// as well as the signal handler, and allows them to notify
 	// the intent dumpers that they should shutdown
 	shutdownIntentsNotifier *notifier
+	// oplogFollowNotifier ends the --oplogFollow window early. While
+	// followingOplog is set, interrupts are routed here instead of to
+	// shutdownIntentsNotifier so that the captured oplog is still finalized.
+	oplogFollowNotifier *notifier
+	followingOplog      int32
+	// planEntries collects the namespaces recorded for --dumpPlan.
+	planEntries []DumpPlanEntry
+	planLock    sync.Mutex
+	// excludedFields maps namespaces to the fields omitted by --excludeFields.
+	excludedFields map[string][]string
+	// nsIncludeRegex and nsExcludeRegex are the parsed --nsIncludeRegex and
+	// --nsExcludeRegex.
+	nsIncludeRegex []*regexp.Regexp
+	nsExcludeRegex []*regexp.Regexp
+	// throttle paces reads for --rateLimit, --maxOpsPerSec and --maxReplicationLag.
+	throttle *util.Throttle
+	// documents holds the documents waiting to be written, bounded by
+	// --maxMemoryMB.
+	documents *documentPool
+	// archiveMaxSize is the parsed --archiveMaxSize in bytes, or zero.
+	archiveMaxSize int64
+	// resumeState records per-namespace progress for --resume.
+	resumeState *resumeState
+	// failedNamespaces are set aside to be retried for --maxNamespaceRetries.
+	failedNamespaces failedNamespaces
+	// hashManifest collects the range hashes written by --hashManifest, and
+	// baseManifest holds those read from --baseManifest.
+	hashManifest *HashManifest
+	baseManifest *HashManifest
+	// usersFilter is the parsed --usersFilter.
+	usersFilter bson.D
+	// routerProvider is the mongos session kept for balancer checks when
+	// --shard replaces SessionProvider with a direct shard connection.
+	routerProvider *db.SessionProvider
 	// Writer to take care of BSON output when not writing to the local filesystem.
 	// This is initialized to os.Stdout if unset.
 	OutputWriter io.Writer
@@ -115,6 +152,10 @@ func (dump *MongoDump) ValidateOptions() error {
 			"Specifying the timeseries collection will dump the system.buckets collection")
 	case dump.OutputOptions.Oplog && dump.ToolOptions.Namespace.DB != "":
 		return fmt.Errorf("--oplog mode only supported on full dumps")
+	case dump.OutputOptions.OplogFollow < 0:
+		return fmt.Errorf("--oplogFollow must not be negative")
+	case dump.OutputOptions.OplogFollow > 0 && !dump.OutputOptions.Oplog:
+		return fmt.Errorf("--oplogFollow requires --oplog")
 	case len(dump.OutputOptions.ExcludedCollections) > 0 && dump.ToolOptions.Namespace.Collection != "":
 		return fmt.Errorf("--collection is not allowed when --excludeCollection is specified")
 	case len(dump.OutputOptions.ExcludedCollectionPrefixes) > 0 && dump.ToolOptions.Namespace.Collection != "":
@@ -123,12 +164,72 @@ func (dump *MongoDump) ValidateOptions() error {
 		return fmt.Errorf("--db is required when --excludeCollection is specified")
 	case len(dump.OutputOptions.ExcludedCollectionPrefixes) > 0 && dump.ToolOptions.Namespace.DB == "":
 		return fmt.Errorf("--db is required when --excludeCollectionsWithPrefix is specified")
+	case len(dump.OutputOptions.NSIncludeRegex) > 0 && dump.ToolOptions.Namespace.Collection != "":
+		return fmt.Errorf("--collection is not allowed when --nsIncludeRegex is specified")
+	case len(dump.OutputOptions.NSExcludeRegex) > 0 && dump.ToolOptions.Namespace.Collection != "":
+		return fmt.Errorf("--collection is not allowed when --nsExcludeRegex is specified")
 	case dump.OutputOptions.Out != "" && dump.OutputOptions.Archive != "":
 		return fmt.Errorf("--out not allowed when --archive is specified")
 	case dump.OutputOptions.Out == "-" && dump.OutputOptions.Gzip:
 		return fmt.Errorf("compression can't be used when dumping a single collection to standard output")
+	case dump.OutputOptions.Out == "-" && dump.OutputOptions.DumpPlan != "":
+		return fmt.Errorf("--dumpPlan can't be used when dumping a single collection to standard output")
+	case dump.OutputOptions.ArchiveMaxSize != "" && dump.OutputOptions.Archive == "":
+		return fmt.Errorf("--archiveMaxSize requires --archive")
+	case dump.OutputOptions.ArchiveMaxSize != "" && dump.OutputOptions.Archive == "-":
+		return fmt.Errorf("--archiveMaxSize can't be used when writing the archive to standard output")
+	case dump.OutputOptions.ArchiveIndex && dump.OutputOptions.Archive == "":
+		return fmt.Errorf("--archiveIndex requires --archive")
+	case dump.OutputOptions.MetadataOnly && dump.OutputOptions.IndexesOnly:
+		return fmt.Errorf("cannot use both --metadataOnly and --indexesOnly")
+	case dump.OutputOptions.skipsData() && dump.OutputOptions.Out == "-":
+		return fmt.Errorf("--metadataOnly and --indexesOnly can't be used when dumping a single collection to standard output")
+	case dump.OutputOptions.skipsData() && dump.OutputOptions.Oplog:
+		return fmt.Errorf("--oplog can't be used with --metadataOnly or --indexesOnly")
+	case dump.OutputOptions.skipsData() && dump.InputOptions.HasQuery():
+		return fmt.Errorf("--query can't be used with --metadataOnly or --indexesOnly")
+	case dump.OutputOptions.skipsData() && dump.OutputOptions.DumpDBUsersAndRoles:
+		return fmt.Errorf("--dumpDbUsersAndRoles can't be used with --metadataOnly or --indexesOnly")
+	case dump.OutputOptions.Resume && (dump.OutputOptions.Archive != "" || dump.OutputOptions.Out == "-"):
+		return fmt.Errorf("--resume is only supported when dumping to a directory")
+	case dump.OutputOptions.Resume && dump.OutputOptions.Gzip:
+		return fmt.Errorf("--resume can't be used with --gzip")
+	case dump.OutputOptions.Resume && dump.OutputOptions.Oplog:
+		return fmt.Errorf("--resume can't be used with --oplog")
+	case dump.OutputOptions.ProgressJSON != "" && dump.OutputOptions.ProgressJSONInterval <= 0:
+		return fmt.Errorf("--progressJsonInterval must be positive")
+	case dump.OutputOptions.UsersFilter != "" && !dump.OutputOptions.DumpDBUsersAndRoles:
+		return fmt.Errorf("--usersFilter requires --dumpDbUsersAndRoles")
+	case dump.OutputOptions.RewriteRoleDB != "" && !dump.OutputOptions.DumpDBUsersAndRoles:
+		return fmt.Errorf("--rewriteRoleDb requires --dumpDbUsersAndRoles")
+	case dump.OutputOptions.BaseManifest != "" && dump.OutputOptions.HashManifest == "":
+		return fmt.Errorf("--baseManifest requires --hashManifest")
+	case dump.OutputOptions.HashManifest != "" && dump.OutputOptions.HashChunkDocs <= 0:
+		return fmt.Errorf("--hashChunkDocs must be positive")
+	case dump.OutputOptions.HashManifest != "" && dump.OutputOptions.Out == "-":
+		return fmt.Errorf("--hashManifest can't be used when dumping a single collection to standard output")
+	case dump.OutputOptions.HashManifest != "" && dump.InputOptions.HasQuery():
+		return fmt.Errorf("--hashManifest can't be used with --query")
+	case dump.OutputOptions.HashManifest != "" && dump.OutputOptions.Resume:
+		return fmt.Errorf("--hashManifest can't be used with --resume")
+	case dump.InputOptions.Shard != "" && dump.InputOptions.ShardZone != "":
+		return fmt.Errorf("cannot use both --shard and --shardZone")
+	case dump.OutputOptions.IncludeShardingMetadata && (dump.OutputOptions.Archive != "" || dump.OutputOptions.Out == "-"):
+		return fmt.Errorf("--includeShardingMetadata is only supported when dumping to a directory")
+	case dump.OutputOptions.MaxNamespaceRetries < 0:
+		return fmt.Errorf("--maxNamespaceRetries must not be negative")
+	case dump.OutputOptions.MaxNamespaceRetries > 0 && (dump.OutputOptions.Archive != "" || dump.OutputOptions.Out == "-"):
+		return fmt.Errorf("--maxNamespaceRetries is only supported when dumping to a directory")
 	case dump.OutputOptions.NumParallelCollections <= 0:
 		return fmt.Errorf("numParallelCollections must be positive")
+	case dump.OutputOptions.MaxMemoryMB < 0:
+		return fmt.Errorf("--maxMemoryMB must not be negative")
+	case dump.InputOptions.RateLimit < 0:
+		return fmt.Errorf("--rateLimit must not be negative")
+	case dump.InputOptions.MaxOpsPerSec < 0:
+		return fmt.Errorf("--maxOpsPerSec must not be negative")
+	case dump.InputOptions.MaxReplicationLag < 0:
+		return fmt.Errorf("--maxReplicationLag must not be negative")
 	}
 	return nil
 }
@@ -160,6 +261,59 @@ func (dump *MongoDump) Init() error {
 	}
 	dump.ToolOptions.ReadPreference = pref
 
+	var defaultExcludeNS string
+	if dump.ToolOptions.Namespace.Collection != "" {
+		defaultExcludeNS = dump.ToolOptions.Namespace.String()
+	}
+	dump.excludedFields, err = parseExcludedFields(dump.OutputOptions.ExcludedFields, defaultExcludeNS)
+	if err != nil {
+		return fmt.Errorf("bad option: %v", err)
+	}
+
+	if dump.nsIncludeRegex, err = compileNamespaceRegexes("--nsIncludeRegex", dump.OutputOptions.NSIncludeRegex); err != nil {
+		return fmt.Errorf("bad option: %v", err)
+	}
+	if dump.nsExcludeRegex, err = compileNamespaceRegexes("--nsExcludeRegex", dump.OutputOptions.NSExcludeRegex); err != nil {
+		return fmt.Errorf("bad option: %v", err)
+	}
+
+	if dump.OutputOptions.UsersFilter != "" {
+		err = bson.UnmarshalExtJSON([]byte(dump.OutputOptions.UsersFilter), false, &dump.usersFilter)
+		if err != nil {
+			return fmt.Errorf("bad option: error parsing --usersFilter as Extended JSON: %v", err)
+		}
+	}
+	if dump.OutputOptions.RewriteRoleDB != "" {
+		if err = util.ValidateDBName(dump.OutputOptions.RewriteRoleDB); err != nil {
+			return fmt.Errorf("bad option: invalid --rewriteRoleDb: %v", err)
+		}
+	}
+
+	if dump.OutputOptions.HashManifest != "" {
+		dump.hashManifest = &HashManifest{
+			ChunkDocs:   dump.OutputOptions.HashChunkDocs,
+			Collections: map[string]*CollectionHashes{},
+		}
+		if dump.OutputOptions.BaseManifest != "" {
+			dump.baseManifest, err = loadHashManifest(dump.OutputOptions.BaseManifest)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if dump.OutputOptions.ArchiveMaxSize != "" {
+		dump.archiveMaxSize, err = text.ParseByteAmount(dump.OutputOptions.ArchiveMaxSize)
+		if err != nil {
+			return fmt.Errorf("bad option: --archiveMaxSize: %v", err)
+		}
+		if dump.archiveMaxSize <= 0 {
+			return fmt.Errorf("bad option: --archiveMaxSize must be positive")
+		}
+	}
+
+	dump.documents = dump.newDocumentPoolForOptions()
+
 	if dump.SessionProvider == nil {
 		dump.SessionProvider, err = db.NewSessionProvider(*dump.ToolOptions)
 		if err != nil {
@@ -167,15 +321,29 @@ func (dump *MongoDump) Init() error {
 		}
 	}
 
+	if dump.InputOptions.Shard != "" || dump.InputOptions.ShardZone != "" {
+		if err = dump.connectToShard(); err != nil {
+			return err
+		}
+	}
+
 	dump.isMongos, err = dump.SessionProvider.IsMongos()
 	if err != nil {
 		return fmt.Errorf("error checking for Mongos: %v", err)
 	}
 
+	if dump.InputOptions.WaitForBalancer && dump.balancerProvider() == nil {
+		return fmt.Errorf("--waitForBalancer requires a connection to a mongos")
+	}
+
 	if dump.isMongos && dump.OutputOptions.Oplog {
 		return fmt.Errorf("can't use --oplog option when dumping from a mongos")
 	}
 
+	if dump.isMongos && dump.InputOptions.MaxReplicationLag > 0 {
+		return fmt.Errorf("can't use --maxReplicationLag option when dumping from a mongos")
+	}
+
 	// warn if we are trying to dump from a secondary in a sharded cluster
 	if dump.isMongos && pref != readpref.Primary() {
 		log.Logvf(log.Always, db.WarningNonPrimaryMongosConnection)
@@ -205,6 +373,9 @@ func (dump *MongoDump) verifyCollectionExists() (bool, error) {
 // Dump handles some final options checking and executes MongoDump.
 func (dump *MongoDump) Dump() (err error) {
 	defer dump.SessionProvider.Close()
+	if dump.routerProvider != nil {
+		defer dump.routerProvider.Close()
+	}
 
 	exists, err := dump.verifyCollectionExists()
 	if err != nil {
@@ -219,6 +390,9 @@ func (dump *MongoDump) Dump() (err error) {
 	log.Logvf(log.DebugHigh, "starting Dump()")
 
 	dump.shutdownIntentsNotifier = newNotifier()
+	dump.oplogFollowNotifier = newNotifier()
+	dump.throttle = dump.newReadThrottle()
+	defer dump.throttle.Stop()
 
 	if dump.InputOptions.HasQuery() {
 		content, err := dump.InputOptions.GetQuery()
@@ -262,6 +436,9 @@ func (dump *MongoDump) Dump() (err error) {
 			Out: archiveOut,
 			Mux: archive.NewMultiplexer(archiveOut, dump.shutdownIntentsNotifier),
 		}
+		if dump.OutputOptions.ArchiveIndex {
+			dump.archive.Mux.EnableIndex()
+		}
 		go dump.archive.Mux.Run()
 		defer func() {
 			// The Mux runs until its Control is closed
@@ -318,6 +495,14 @@ func (dump *MongoDump) Dump() (err error) {
 		}
 	}
 
+	if dump.OutputOptions.Resume {
+		dump.resumeState, err = loadResumeState(dump.resumeStatePath())
+		if err != nil {
+			return err
+		}
+		log.Logvf(log.Info, "recording dump progress in %v", dump.resumeStatePath())
+	}
+
 	// IO Phase I
 	// metadata, users, roles, and versions
 
@@ -329,23 +514,31 @@ func (dump *MongoDump) Dump() (err error) {
 		return fmt.Errorf("error dumping metadata: %v", err)
 	}
 
-	if dump.OutputOptions.Archive != "" {
+	if dump.OutputOptions.IncludeShardingMetadata {
+		if err = dump.writeShardingMetadata(); err != nil {
+			return err
+		}
+	}
+
+	if dump.OutputOptions.Archive != "" || dump.OutputOptions.DumpPlan != "" {
 		serverVersion, err := dump.SessionProvider.ServerVersion()
 		if err != nil {
 			log.Logvf(log.Always, "warning, couldn't get version information from server: %v", err)
 			serverVersion = "unknown"
 		}
-		dump.archive.Prelude, err = archive.NewPrelude(dump.manager, dump.OutputOptions.NumParallelCollections, serverVersion, dump.ToolOptions.VersionStr)
-		if err != nil {
-			return fmt.Errorf("creating archive prelude: %v", err)
+		if dump.OutputOptions.DumpPlan != "" {
+			if err = dump.writeDumpPlan(serverVersion); err != nil {
+				return err
+			}
 		}
-		err = dump.archive.Prelude.Write(dump.archive.Out)
-		if err != nil {
-			return fmt.Errorf("error writing metadata into archive: %v", err)
+		if dump.OutputOptions.Archive != "" {
+			if err = dump.writeArchivePrelude(serverVersion); err != nil {
+				return err
+			}
 		}
 	}
 
-	if !dump.SkipUsersAndRoles {
+	if !dump.SkipUsersAndRoles && !dump.OutputOptions.skipsData() {
 		if dump.ToolOptions.DB == "admin" || dump.ToolOptions.DB == "" {
 			err = dump.DumpUsersAndRoles()
 			if err != nil {
@@ -381,6 +574,11 @@ func (dump *MongoDump) Dump() (err error) {
 		}
 	}
 
+	balancerStatus, err := dump.checkBalancer()
+	if err != nil {
+		return fmt.Errorf("error checking the balancer: %v", err)
+	}
+
 	if failpoint.Enabled(failpoint.PauseBeforeDumping) {
 		log.Logvf(log.Info, "failpoint.PauseBeforeDumping: sleeping 15 sec")
 		time.Sleep(15 * time.Second)
@@ -396,6 +594,18 @@ func (dump *MongoDump) Dump() (err error) {
 	if err := dump.DumpIntents(); err != nil {
 		return err
 	}
+	if err := dump.retryFailedNamespaces(); err != nil {
+		return err
+	}
+	dump.checkBalancerAfterDump(balancerStatus)
+
+	if dump.hashManifest != nil {
+		dump.hashManifest.Created = time.Now().UTC()
+		if err = dump.hashManifest.write(dump.OutputOptions.HashManifest); err != nil {
+			return err
+		}
+		log.Logvf(log.Always, "wrote hash manifest to %v", dump.OutputOptions.HashManifest)
+	}
 
 	// IO Phase III
 	// oplog
@@ -426,7 +636,11 @@ func (dump *MongoDump) Dump() (err error) {
 
 		log.Logvf(log.Always, "writing captured oplog to %v", dump.manager.Oplog().Location)
 
-		err = dump.DumpOplogBetweenTimestamps(dump.oplogStart, dump.oplogEnd)
+		if dump.OutputOptions.OplogFollow > 0 {
+			err = dump.DumpOplogFollowing(dump.oplogStart, dump.OutputOptions.OplogFollow)
+		} else {
+			err = dump.DumpOplogBetweenTimestamps(dump.oplogStart, dump.oplogEnd)
+		}
 		if err != nil {
 			return fmt.Errorf("error dumping oplog: %v", err)
 		}
@@ -446,11 +660,32 @@ func (dump *MongoDump) Dump() (err error) {
 		log.Logvf(log.DebugHigh, "oplog entry %v still exists", dump.oplogStart)
 	}
 
+	if dump.resumeState != nil {
+		if err = dump.resumeState.remove(); err != nil {
+			return err
+		}
+	}
+
 	log.Logvf(log.DebugLow, "finishing dump")
 
 	return err
 }
 
+// writeArchivePrelude writes the archive prelude describing every intent.
+func (dump *MongoDump) writeArchivePrelude(serverVersion string) error {
+	var err error
+	dump.archive.Prelude, err = archive.NewPrelude(dump.manager, dump.OutputOptions.NumParallelCollections, serverVersion, dump.ToolOptions.VersionStr)
+	if err != nil {
+		return fmt.Errorf("creating archive prelude: %v", err)
+	}
+	dump.archive.Prelude.Header.Indexed = dump.OutputOptions.ArchiveIndex
+	err = dump.archive.Prelude.Write(dump.archive.Out)
+	if err != nil {
+		return fmt.Errorf("error writing metadata into archive: %v", err)
+	}
+	return nil
+}
+
 type resettableOutputBuffer interface {
 	io.Writer
 	Close() error
@@ -506,7 +741,11 @@ func (dump *MongoDump) DumpIntents() error {
 				}
 				if intent.BSONFile != nil {
 					err := dump.DumpIntent(intent, buffer)
-					if err != nil {
+					if err != nil && dump.canRetryNamespace(intent) {
+						log.Logvf(log.Always, "failed to dump %v, will retry after the other namespaces: %v",
+							intent.DataNamespace(), err)
+						dump.failedNamespaces.add(intent, err)
+					} else if err != nil {
 						resultChan <- err
 						return
 					}
@@ -575,6 +814,9 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent, buffer resettableOutpu
 	}
 
 	findQuery := &db.DeferredQuery{Coll: coll}
+	if !isView {
+		findQuery.BatchSize = dump.batchSizeFor(coll)
+	}
 	switch {
 	case len(dump.query) > 0:
 		if intent.IsTimeseries() {
@@ -607,6 +849,33 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent, buffer resettableOutpu
 		}
 	}
 
+	if fields := dump.excludedFields[intent.Namespace()]; len(fields) > 0 {
+		if intent.IsTimeseries() {
+			return fmt.Errorf("cannot use --excludeFields on timeseries collection %s", intent.Namespace())
+		}
+		projection := bson.D{}
+		for _, field := range fields {
+			projection = append(projection, bson.E{Key: field, Value: 0})
+		}
+		findQuery.Projection = projection
+		log.Logvf(log.Info, "excluding fields %v from %v", strings.Join(fields, ", "), intent.Namespace())
+	}
+
+	if dump.OutputOptions.skipsData() {
+		return dump.skipIntentData(intent)
+	}
+
+	if dump.resumeState != nil {
+		done, err := dump.prepareResume(intent, findQuery)
+		if err != nil {
+			return err
+		}
+		if done {
+			log.Logvf(log.Always, "skipping %v, it was already dumped", intent.DataNamespace())
+			return nil
+		}
+	}
+
 	var dumpCount int64
 
 	if dump.OutputOptions.Out == "-" {
@@ -624,7 +893,14 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent, buffer resettableOutpu
 		return err
 	}
 
-	log.Logvf(log.Always, "done dumping %v (%v %v)", intent.DataNamespace(), dumpCount, docPlural(dumpCount))
+	if dump.resumeState != nil {
+		if err = dump.resumeState.record(intent.Namespace(), namespaceProgress{Complete: true}); err != nil {
+			return err
+		}
+	}
+
+	log.LogvfWithFields(log.Always, log.Fields{"ns": intent.DataNamespace(), "documents": dumpCount},
+		"done dumping %v (%v %v)", intent.DataNamespace(), dumpCount, docPlural(dumpCount))
 	return nil
 }
 
@@ -637,7 +913,7 @@ type documentValidator func([]byte) error
 // dumped, and any errors that occurred.
 func (dump *MongoDump) dumpQueryToIntent(
 	query *db.DeferredQuery, intent *intents.Intent, buffer resettableOutputBuffer) (dumpCount int64, err error) {
-	return dump.dumpValidatedQueryToIntent(query, intent, buffer, nil)
+	return dump.dumpValidatedQueryToIntent(context.Background(), query, intent, buffer, nil)
 }
 
 // getCount counts the number of documents in the namespace for the given intent. It does not run the count for
@@ -661,11 +937,29 @@ func (dump *MongoDump) getCount(query *db.DeferredQuery, intent *intents.Intent)
 	return int64(total), nil
 }
 
+// skipIntentData stands in for dumping an intent's documents when
+// --metadataOnly or --indexesOnly is set. Archives still get an empty
+// collection so that mongorestore sees every namespace in the prelude.
+func (dump *MongoDump) skipIntentData(intent *intents.Intent) error {
+	log.Logvf(log.Info, "skipping documents in %v", intent.DataNamespace())
+	if dump.OutputOptions.Archive == "" {
+		return nil
+	}
+	if err := intent.BSONFile.Open(); err != nil {
+		return err
+	}
+	if err := intent.BSONFile.Close(); err != nil {
+		return fmt.Errorf("error writing data for collection `%v` to archive: %v", intent.Namespace(), err)
+	}
+	return nil
+}
+
 // dumpValidatedQueryToIntent takes an mgo Query, its intent, a writer, and a document validator, performs the query,
 // validates the results with the validator,
 // and writes the raw bson results to the writer. Returns a final count of documents
-// dumped, and any errors that occurred.
-func (dump *MongoDump) dumpValidatedQueryToIntent(
+// dumped, and any errors that occurred. Cancelling ctx ends the dump cleanly with
+// whatever has been written so far.
+func (dump *MongoDump) dumpValidatedQueryToIntent(ctx context.Context,
 	query *db.DeferredQuery, intent *intents.Intent, buffer resettableOutputBuffer, validator documentValidator) (dumpCount int64, err error) {
 
 	// restore of views from archives require an empty collection as the trigger to create the view
@@ -709,11 +1003,49 @@ func (dump *MongoDump) dumpValidatedQueryToIntent(
 		}()
 	}
 
+	if dump.OutputOptions.RewriteRoleDB != "" && (intent.IsUsers() || intent.IsRoles()) {
+		f = &transformingWriter{Writer: f, transform: authDBRewriter(dump.ToolOptions.DB, dump.OutputOptions.RewriteRoleDB)}
+	}
+
+	var hasher *rangeHasher
+	if dump.hashManifest != nil && canHashIntent(intent) {
+		var base []RangeHash
+		if dump.baseManifest != nil {
+			base = dump.baseManifest.ranges(intent.Namespace())
+		}
+		hasher, err = newRangeHasher(f, base, dump.hashManifest.ChunkDocs)
+		if err != nil {
+			return 0, err
+		}
+		f = hasher
+		query.Sort = bson.D{bson.E{Key: "_id", Value: 1}}
+		query.Hint = nil
+	}
+
+	var checkpoints *checkpointWriter
+	if file, ok := intent.BSONFile.(*realBSONFile); ok && file.trackProgress {
+		checkpoints = newCheckpointWriter(f, dump.resumeState, intent.Namespace(), file.resumeOffset)
+		f = checkpoints
+	}
+
 	cursor, err := query.Iter()
 	if err != nil {
 		return
 	}
-	err = dump.dumpValidatedIterToWriter(cursor, f, dumpProgressor, validator)
+	err = dump.dumpValidatedIterToWriter(ctx, cursor, f, dumpProgressor, validator)
+	if checkpoints != nil {
+		// record what was written even if the dump was interrupted
+		if checkpointErr := checkpoints.checkpoint(); err == nil {
+			err = checkpointErr
+		}
+	}
+	if hasher != nil && err == nil {
+		var ranges []RangeHash
+		if ranges, err = hasher.finish(); err == nil {
+			dump.hashManifest.setRanges(intent.Namespace(), ranges)
+			hasher.logSummary(intent.Namespace())
+		}
+	}
 	dumpCount, _ = dumpProgressor.Progress()
 	if err != nil {
 		err = fmt.Errorf("error writing data for collection `%v` to disk: %v", intent.Namespace(), err)
@@ -725,12 +1057,12 @@ func (dump *MongoDump) dumpValidatedQueryToIntent(
 // a counter, and dumps the iterator's contents to the writer.
 func (dump *MongoDump) dumpIterToWriter(
 	iter *mongo.Cursor, writer io.Writer, progressCount progress.Updateable) error {
-	return dump.dumpValidatedIterToWriter(iter, writer, progressCount, nil)
+	return dump.dumpValidatedIterToWriter(context.Background(), iter, writer, progressCount, nil)
 }
 
 // dumpValidatedIterToWriter takes a cursor, a writer, an Updateable object, and a documentValidator and validates and
-// dumps the iterator's contents to the writer.
-func (dump *MongoDump) dumpValidatedIterToWriter(
+// dumps the iterator's contents to the writer. The iteration stops without error once ctx is done.
+func (dump *MongoDump) dumpValidatedIterToWriter(ctx context.Context,
 	iter *mongo.Cursor, writer io.Writer, progressCount progress.Updateable, validator documentValidator) error {
 	defer iter.Close(context.Background())
 	var termErr error
@@ -738,9 +1070,10 @@ func (dump *MongoDump) dumpValidatedIterToWriter(
 	// We run the result iteration in its own goroutine,
 	// this allows disk i/o to not block reads from the db,
 	// which gives a slight speedup on benchmarks
-	buffChan := make(chan []byte)
+	buffChan := make(chan []byte, dump.documents.readAhead())
+	// stopped is closed if writing fails, so that reading stops too
+	stopped := make(chan struct{})
 	go func() {
-		ctx := context.Background()
 		for {
 			select {
 			case <-dump.shutdownIntentsNotifier.notified:
@@ -750,7 +1083,7 @@ func (dump *MongoDump) dumpValidatedIterToWriter(
 				return
 			default:
 				if !iter.Next(ctx) {
-					if err := iter.Err(); err != nil {
+					if err := iter.Err(); err != nil && ctx.Err() == nil {
 						termErr = err
 					}
 					close(buffChan)
@@ -765,28 +1098,48 @@ func (dump *MongoDump) dumpValidatedIterToWriter(
 					}
 				}
 
-				out := make([]byte, len(iter.Current))
+				out := dump.documents.get(len(iter.Current))
 				copy(out, iter.Current)
-				buffChan <- out
+				select {
+				case buffChan <- out:
+				case <-stopped:
+					dump.documents.put(out)
+					close(buffChan)
+					return
+				}
 			}
 		}
 	}()
+	// the documents not written must go back to the pool, which is shared
+	// with the other dump routines
+	fail := func(err error) error {
+		close(stopped)
+		for buff := range buffChan {
+			dump.documents.put(buff)
+		}
+		return err
+	}
 
 	// while there are still results in the database,
 	// grab results from the goroutine and write them to filesystem
 	for {
 		buff, alive := <-buffChan
 		if !alive {
-			if iter.Err() != nil {
+			if iter.Err() != nil && ctx.Err() == nil {
 				return fmt.Errorf("error reading collection: %v", iter.Err())
 			}
 			break
 		}
+		dump.throttle.Wait(len(buff))
 		_, err := writer.Write(buff)
+		dump.documents.put(buff)
 		if err != nil {
-			return fmt.Errorf("error writing to file: %v", err)
+			return fail(fmt.Errorf("error writing to file: %v", err))
 		}
 		progressCount.Inc(1)
+		if counter, ok := progressCount.(progress.ByteCounter); ok {
+			counter.IncBytes(int64(len(buff)))
+		}
 	}
 	return termErr
 }
@@ -805,6 +1158,9 @@ func (dump *MongoDump) DumpUsersAndRolesForDB(name string) error {
 		Coll:   session.Database("admin").Collection("system.users"),
 		Filter: dbQuery,
 	}
+	if len(dump.usersFilter) > 0 {
+		usersQuery.Filter = bson.M{"$and": bson.A{dbQuery, dump.usersFilter}}
+	}
 	_, err = dump.dumpQueryToIntent(usersQuery, dump.manager.Users(), buffer)
 	if err != nil {
 		return fmt.Errorf("error dumping db users: %v", err)
@@ -887,22 +1243,26 @@ func (dump *MongoDump) getArchiveOut() (out io.WriteCloser, err error) {
 	if dump.OutputOptions.Archive == "-" {
 		out = &nopCloseWriter{dump.OutputWriter}
 	} else {
+		archiveFilePath := dump.OutputOptions.Archive
 		targetStat, err := os.Stat(dump.OutputOptions.Archive)
 		if err == nil && targetStat.IsDir() {
-			defaultArchiveFilePath :=
-				filepath.Join(dump.OutputOptions.Archive, "archive")
+			archiveFilePath = filepath.Join(dump.OutputOptions.Archive, "archive")
 			if dump.OutputOptions.Gzip {
-				defaultArchiveFilePath = defaultArchiveFilePath + ".gz"
-			}
-			out, err = os.Create(defaultArchiveFilePath)
-			if err != nil {
-				return nil, err
+				archiveFilePath = archiveFilePath + ".gz"
 			}
+		}
+		if dump.archiveMaxSize > 0 {
+			log.Logvf(log.Info, "writing archive volumes of at most %v to %v",
+				text.FormatByteAmount(dump.archiveMaxSize), archive.VolumeName(archiveFilePath, 1))
+			out, err = archive.NewVolumeWriter(archiveFilePath, dump.archiveMaxSize)
+		} else if archive.HasVolumes(archiveFilePath) {
+			return nil, fmt.Errorf("archive volumes starting with %v already exist; remove them before writing the archive %v",
+				archive.VolumeName(archiveFilePath, 1), archiveFilePath)
 		} else {
-			out, err = os.Create(dump.OutputOptions.Archive)
-			if err != nil {
-				return nil, err
-			}
+			out, err = os.Create(archiveFilePath)
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
 	if dump.OutputOptions.Gzip {
@@ -918,6 +1278,12 @@ func docPlural(count int64) string {
 }
 
 func (dump *MongoDump) HandleInterrupt() {
+	// An interrupt while following the oplog only ends the follow window, so
+	// the entries captured so far are still written out.
+	if atomic.LoadInt32(&dump.followingOplog) == 1 {
+		dump.oplogFollowNotifier.Notify()
+		return
+	}
 	if dump.shutdownIntentsNotifier != nil {
 		dump.shutdownIntentsNotifier.Notify()
 	}
@@ -589,6 +589,140 @@ func TestMongoDumpValidateOptions(t *testing.T) {
 			So(err.Error(), ShouldContainSubstring, "cannot dump using a query without a specified collection")
 		})
 
+		Convey("we cannot follow the oplog without --oplog", func() {
+			md.ToolOptions.Namespace.DB = ""
+			md.OutputOptions.OplogFollow = time.Minute
+
+			err := md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--oplogFollow requires --oplog")
+
+			md.OutputOptions.Oplog = true
+			So(md.ValidateOptions(), ShouldBeNil)
+
+			md.OutputOptions.OplogFollow = -time.Minute
+			err = md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--oplogFollow must not be negative")
+		})
+
+		Convey("throttling limits must not be negative", func() {
+			md.InputOptions.RateLimit = -1
+			err := md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--rateLimit must not be negative")
+
+			md.InputOptions.RateLimit = 0
+			md.InputOptions.MaxOpsPerSec = -1
+			err = md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--maxOpsPerSec must not be negative")
+		})
+
+		Convey("--archiveMaxSize requires an archive file", func() {
+			md.OutputOptions.ArchiveMaxSize = "50GB"
+			err := md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--archiveMaxSize requires --archive")
+
+			md.OutputOptions.Archive = "-"
+			err = md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "standard output")
+
+			md.OutputOptions.Archive = "backup.archive"
+			So(md.ValidateOptions(), ShouldBeNil)
+		})
+
+		Convey("users and roles options require --dumpDbUsersAndRoles", func() {
+			md.OutputOptions.UsersFilter = `{"user": "app"}`
+			err := md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--usersFilter requires --dumpDbUsersAndRoles")
+
+			md.OutputOptions.UsersFilter = ""
+			md.OutputOptions.RewriteRoleDB = "tenant2"
+			err = md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--rewriteRoleDb requires --dumpDbUsersAndRoles")
+
+			md.OutputOptions.DumpDBUsersAndRoles = true
+			So(md.ValidateOptions(), ShouldBeNil)
+		})
+
+		Convey("--metadataOnly and --indexesOnly skip document data", func() {
+			md.OutputOptions.MetadataOnly = true
+			So(md.ValidateOptions(), ShouldBeNil)
+
+			md.OutputOptions.IndexesOnly = true
+			err := md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cannot use both --metadataOnly and --indexesOnly")
+
+			md.OutputOptions.MetadataOnly = false
+			md.InputOptions.Query = `{"a": 1}`
+			md.ToolOptions.Namespace.Collection = "c"
+			err = md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--query can't be used")
+
+			md.InputOptions.Query = ""
+			md.ToolOptions.Namespace.DB = ""
+			md.ToolOptions.Namespace.Collection = ""
+			md.OutputOptions.Oplog = true
+			err = md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--oplog can't be used")
+		})
+
+		Convey("--maxNamespaceRetries requires a directory dump", func() {
+			md.OutputOptions.MaxNamespaceRetries = 2
+			So(md.ValidateOptions(), ShouldBeNil)
+
+			md.OutputOptions.Archive = "backup.archive"
+			err := md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "only supported when dumping to a directory")
+
+			md.OutputOptions.Archive = ""
+			md.OutputOptions.MaxNamespaceRetries = -1
+			err = md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "must not be negative")
+		})
+
+		Convey("--shard and --shardZone can't be combined", func() {
+			md.InputOptions.ShardZone = "backup"
+			So(md.ValidateOptions(), ShouldBeNil)
+
+			md.InputOptions.Shard = "shard0"
+			err := md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cannot use both --shard and --shardZone")
+		})
+
+		Convey("--includeShardingMetadata requires a directory dump", func() {
+			md.OutputOptions.IncludeShardingMetadata = true
+			So(md.ValidateOptions(), ShouldBeNil)
+
+			md.OutputOptions.Archive = "backup.archive"
+			err := md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "only supported when dumping to a directory")
+		})
+
+		Convey("namespace regular expressions can't be used with --collection", func() {
+			md.ToolOptions.Namespace.DB = "db"
+			md.ToolOptions.Namespace.Collection = "coll"
+			md.OutputOptions.NSExcludeRegex = []string{`db\.c.*`}
+			err := md.ValidateOptions()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--collection is not allowed when --nsExcludeRegex is specified")
+
+			md.ToolOptions.Namespace.Collection = ""
+			So(md.ValidateOptions(), ShouldBeNil)
+		})
+
 	})
 }
 
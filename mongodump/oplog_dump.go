@@ -10,6 +10,8 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/huimingz/mongo-tools/common/db"
 	"github.com/huimingz/mongo-tools/common/log"
@@ -180,10 +182,58 @@ func (dump *MongoDump) DumpOplogBetweenTimestamps(start, end primitive.Timestamp
 		Filter:    queryObj,
 		LogReplay: true,
 	}
-	oplogCount, err := dump.dumpValidatedQueryToIntent(oplogQuery, dump.manager.Oplog(), dump.getResettableOutputBuffer(), oplogDocumentValidator)
+	oplogCount, err := dump.dumpValidatedQueryToIntent(context.Background(), oplogQuery, dump.manager.Oplog(), dump.getResettableOutputBuffer(), oplogDocumentValidator)
 	if err == nil {
 		log.Logvf(log.Always, "\tdumped %v oplog %v",
 			oplogCount, util.Pluralize(int(oplogCount), "entry", "entries"))
 	}
 	return err
 }
+
+// DumpOplogFollowing dumps all oplog entries from the given start timestamp and then
+// keeps tailing the oplog, appending new entries, until the window elapses or the
+// dump is interrupted. On return, dump.oplogEnd holds the timestamp of the last
+// entry written.
+func (dump *MongoDump) DumpOplogFollowing(start primitive.Timestamp, window time.Duration) error {
+	session, err := dump.SessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	oplogQuery := &db.DeferredQuery{
+		Coll:      session.Database("local").Collection(dump.oplogCollection),
+		Filter:    bson.M{"ts": bson.M{"$gte": start}},
+		LogReplay: true,
+		Tailable:  true,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), window)
+	defer cancel()
+	go func() {
+		select {
+		case <-dump.oplogFollowNotifier.notified:
+			log.Logvf(log.Always, "ending oplog follow window early")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	atomic.StoreInt32(&dump.followingOplog, 1)
+	defer atomic.StoreInt32(&dump.followingOplog, 0)
+
+	log.Logvf(log.Always, "following oplog for up to %v", window)
+	validator := func(in []byte) error {
+		if err := oplogDocumentValidator(in); err != nil {
+			return err
+		}
+		if t, i, ok := bson.Raw(in).Lookup("ts").TimestampOK(); ok {
+			dump.oplogEnd = primitive.Timestamp{T: t, I: i}
+		}
+		return nil
+	}
+	oplogCount, err := dump.dumpValidatedQueryToIntent(ctx, oplogQuery, dump.manager.Oplog(), dump.getResettableOutputBuffer(), validator)
+	if err == nil {
+		log.Logvf(log.Always, "\tdumped %v oplog %v, last entry at %v",
+			oplogCount, util.Pluralize(int(oplogCount), "entry", "entries"), dump.oplogEnd)
+	}
+	return err
+}
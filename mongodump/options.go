@@ -9,6 +9,7 @@ package mongodump
 import (
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"github.com/huimingz/mongo-tools/common/options"
 )
@@ -29,6 +30,14 @@ type InputOptions struct {
 	QueryFile      string `long:"queryFile" description:"path to a file containing a query filter (v2 Extended JSON)"`
 	ReadPreference string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference mode (e.g. 'nearest') or a preference json object (e.g. '{mode: \"nearest\", tagSets: [{a: \"b\"}], maxStalenessSeconds: 123}')"`
 	TableScan      bool   `long:"forceTableScan" description:"force a table scan (do not use $snapshot or hint _id). Deprecated since this is default behavior on WiredTiger"`
+
+	RateLimit         float64       `long:"rateLimit" value-name:"<MiB/s>" description:"maximum rate, in mebibytes (MiB) per second, at which documents are read from the server"`
+	MaxOpsPerSec      int           `long:"maxOpsPerSec" value-name:"<count>" description:"maximum number of documents read from the server per second"`
+	MaxReplicationLag time.Duration `long:"maxReplicationLag" value-name:"<duration>" description:"pause reading while the replication lag of the member being read from exceeds this duration (e.g. 30s)"`
+
+	Shard           string `long:"shard" value-name:"<shard-name>" description:"when connected to a mongos, dump directly from the named shard instead of through the mongos; the credentials given must be valid on the shard. The tagSets of --readPreference select the members of the shard read from"`
+	ShardZone       string `long:"shardZone" value-name:"<zone>" description:"like --shard, but dump from the shard tagged with the given zone; the zone must have exactly one shard"`
+	WaitForBalancer bool   `long:"waitForBalancer" description:"when dumping a sharded cluster, wait for an active balancer round to finish before dumping"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -55,15 +64,36 @@ func (inputOptions *InputOptions) GetQuery() ([]byte, error) {
 
 // OutputOptions defines the set of options for writing dump data.
 type OutputOptions struct {
-	Out                        string   `long:"out" value-name:"<directory-path>" short:"o" description:"output directory, or '-' for stdout (default: 'dump')"`
-	Gzip                       bool     `long:"gzip" description:"compress archive or collection output with Gzip"`
-	Oplog                      bool     `long:"oplog" description:"use oplog for taking a point-in-time snapshot"`
-	Archive                    string   `long:"archive" value-name:"<file-path>" optional:"true" optional-value:"-" description:"dump as an archive to the specified path. If flag is specified without a value, archive is written to stdout"`
-	DumpDBUsersAndRoles        bool     `long:"dumpDbUsersAndRoles" description:"dump user and role definitions for the specified database"`
-	ExcludedCollections        []string `long:"excludeCollection" value-name:"<collection-name>" description:"collection to exclude from the dump (may be specified multiple times to exclude additional collections)"`
-	ExcludedCollectionPrefixes []string `long:"excludeCollectionsWithPrefix" value-name:"<collection-prefix>" description:"exclude all collections from the dump that have the given prefix (may be specified multiple times to exclude additional prefixes)"`
-	NumParallelCollections     int      `long:"numParallelCollections" short:"j" description:"number of collections to dump in parallel" default:"4" default-mask:"-"`
-	ViewsAsCollections         bool     `long:"viewsAsCollections" description:"dump views as normal collections with their produced data, omitting standard collections"`
+	Out                        string        `long:"out" value-name:"<directory-path>" short:"o" description:"output directory, or '-' for stdout (default: 'dump')"`
+	Gzip                       bool          `long:"gzip" description:"compress archive or collection output with Gzip"`
+	Oplog                      bool          `long:"oplog" description:"use oplog for taking a point-in-time snapshot"`
+	OplogFollow                time.Duration `long:"oplogFollow" value-name:"<duration>" description:"after dumping data, keep appending new oplog entries to the captured oplog for the given duration (e.g. 30m) or until interrupted; requires --oplog"`
+	Archive                    string        `long:"archive" value-name:"<file-path>" optional:"true" optional-value:"-" description:"dump as an archive to the specified path. If flag is specified without a value, archive is written to stdout"`
+	ArchiveMaxSize             string        `long:"archiveMaxSize" value-name:"<size>" description:"split the archive into numbered volumes (<archive>.001, <archive>.002, ...) of at most the given size, e.g. 50GB or 512MB; requires --archive with a file path"`
+	ArchiveIndex               bool          `long:"archiveIndex" description:"end the archive with an index of where each collection's data is, so that mongorestore can read only the collections it restores from an uncompressed archive file; archives with an index can't be read by earlier versions of mongorestore"`
+	DumpDBUsersAndRoles        bool          `long:"dumpDbUsersAndRoles" description:"dump user and role definitions for the specified database"`
+	UsersFilter                string        `long:"usersFilter" value-name:"<json>" description:"only dump the users matching this filter, as a v2 Extended JSON string, e.g. '{\"user\":{\"$in\":[\"app\",\"reporting\"]}}'; requires --dumpDbUsersAndRoles"`
+	RewriteRoleDB              string        `long:"rewriteRoleDb" value-name:"<database-name>" description:"rewrite references to the dumped database in user and role definitions (their database, granted roles and privileges) to the given database, so they can be restored into a database of that name; requires --dumpDbUsersAndRoles"`
+	ExcludedCollections        []string      `long:"excludeCollection" value-name:"<collection-name>" description:"collection to exclude from the dump (may be specified multiple times to exclude additional collections)"`
+	ExcludedCollectionPrefixes []string      `long:"excludeCollectionsWithPrefix" value-name:"<collection-prefix>" description:"exclude all collections from the dump that have the given prefix (may be specified multiple times to exclude additional prefixes)"`
+	NSIncludeRegex             []string      `long:"nsIncludeRegex" value-name:"<regex>" description:"only dump the namespaces (<db>.<collection>) wholly matched by the regular expression, e.g. 'tenant_[0-9]+\\.(orders|invoices)' (may be specified multiple times to include additional namespaces)"`
+	NSExcludeRegex             []string      `long:"nsExcludeRegex" value-name:"<regex>" description:"exclude the namespaces (<db>.<collection>) wholly matched by the regular expression from the dump (may be specified multiple times to exclude additional namespaces)"`
+	ExcludedFields             []string      `long:"excludeFields" value-name:"<namespace>=<field>[,<field>...]" description:"omit the given fields from documents dumped from a namespace, e.g. 'test.events=body,raw' (may be specified multiple times; the namespace may be left off when --collection is specified)"`
+	NumParallelCollections     int           `long:"numParallelCollections" short:"j" description:"number of collections to dump in parallel" default:"4" default-mask:"-"`
+	MaxMemoryMB                int           `long:"maxMemoryMB" value-name:"<megabytes>" description:"limit the memory used to hold documents read from the server but not yet written to about this many megabytes; the collections dumped in parallel share the limit and read smaller batches from the server (default: no limit)"`
+	IncludeShardingMetadata    bool          `long:"includeShardingMetadata" description:"when dumping a sharded cluster through a mongos, write the shard keys, chunk ranges and zones of the dumped collections to sharding.json in the dump directory, for use with mongorestore --restoreShardingMetadata"`
+	MaxNamespaceRetries        int           `long:"maxNamespaceRetries" value-name:"<count>" description:"instead of ending the dump when a namespace fails partway, e.g. because its cursor was killed, dump it again up to this many times once the other namespaces are done; namespaces that still fail are listed when the dump ends (default: 0)"`
+	ViewsAsCollections         bool          `long:"viewsAsCollections" description:"dump views as normal collections with their produced data, omitting standard collections"`
+	DumpPlan                   string        `long:"dumpPlan" value-name:"<file-path>" description:"write a JSON description of every namespace a restore would recreate (views, validators, collations, clustered and time series settings, indexes) to the given file"`
+	Resume                     bool          `long:"resume" description:"continue an interrupted directory dump, skipping namespaces that were completed and picking up partially dumped collections after the last _id written"`
+	ProgressJSON               string        `long:"progressJson" value-name:"stderr|unix:<socket-path>" optional:"true" optional-value:"stderr" description:"write periodic JSON progress records (documents and bytes dumped, rate and ETA per namespace) to stderr or to a listening unix socket instead of progress bars"`
+	ProgressJSONInterval       time.Duration `long:"progressJsonInterval" value-name:"<duration>" default:"5s" default-mask:"-" description:"how often to write --progressJson records (default: 5s)"`
+	Prom                       string        `long:"prom" value-name:"<address>" description:"serve the progress (documents and bytes dumped, and ETA per namespace) for Prometheus to scrape at http://<address>/metrics, e.g. ':9216'"`
+	HashManifest               string        `long:"hashManifest" value-name:"<file-path>" description:"write a manifest of hashes of every _id range of every collection to the given file, for use with --baseManifest in a later dump"`
+	BaseManifest               string        `long:"baseManifest" value-name:"<file-path>" description:"only dump the _id ranges whose hash differs from those in the manifest of an earlier dump; apply the result on top of a restore of the earlier dump with mongorestore --applyDifferential and the new manifest; requires --hashManifest"`
+	HashChunkDocs              int           `long:"hashChunkDocs" value-name:"<count>" default:"1000" default-mask:"-" description:"number of documents per hashed _id range in new manifests (default: 1000)"`
+	MetadataOnly               bool          `long:"metadataOnly" description:"dump collection options and index definitions without any documents"`
+	IndexesOnly                bool          `long:"indexesOnly" description:"dump index definitions without any documents or collection options"`
 }
 
 // Name returns a human-readable group name for output options.
@@ -71,6 +101,11 @@ func (*OutputOptions) Name() string {
 	return "output"
 }
 
+// skipsData reports whether document data is left out of the dump.
+func (o *OutputOptions) skipsData() bool {
+	return o.MetadataOnly || o.IndexesOnly
+}
+
 type Options struct {
 	*options.ToolOptions
 	*InputOptions
@@ -15,6 +15,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/huimingz/mongo-tools/common/archive"
@@ -65,6 +66,11 @@ type realBSONFile struct {
 	errorReader
 	intent *intents.Intent
 	NilPos
+	// resumeOffset is where writing picks up again for --resume; the file
+	// is truncated to it rather than recreated. trackProgress enables
+	// checkpointing of what has been written.
+	resumeOffset  int64
+	trackProgress bool
 }
 
 // Open is part of the intents.file interface. realBSONFiles need to have Open called before
@@ -81,6 +87,10 @@ func (f *realBSONFile) Open() (err error) {
 			filepath.Dir(f.path), err)
 	}
 
+	if f.resumeOffset > 0 {
+		return f.openForResume()
+	}
+
 	f.WriteCloser, err = os.Create(f.path)
 	if err != nil {
 		return fmt.Errorf("error creating BSON file %v: %v", f.path, err)
@@ -89,6 +99,24 @@ func (f *realBSONFile) Open() (err error) {
 	return nil
 }
 
+// openForResume opens an existing BSON file, discarding anything written
+// after resumeOffset.
+func (f *realBSONFile) openForResume() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("error opening BSON file %v: %v", f.path, err)
+	}
+	if err = file.Truncate(f.resumeOffset); err == nil {
+		_, err = file.Seek(f.resumeOffset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error resuming BSON file %v: %v", f.path, err)
+	}
+	f.WriteCloser = file
+	return nil
+}
+
 // realMetadataFile implements intent.file, and corresponds to a Metadata file on disk
 type realMetadataFile struct {
 	io.WriteCloser
@@ -202,6 +230,85 @@ func (dump *MongoDump) shouldSkipCollection(colName string) bool {
 	return false
 }
 
+// compileNamespaceRegexes compiles the regular expressions given with
+// option. Each must match a whole namespace, as --nsInclude does in
+// mongorestore.
+func compileNamespaceRegexes(option string, exprs []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, expr := range exprs {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v '%v': %v", option, expr, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// shouldSkipNamespace returns true when a namespace is left out by
+// --nsIncludeRegex or --nsExcludeRegex.
+func (dump *MongoDump) shouldSkipNamespace(dbName, colName string) bool {
+	ns := dbName + "." + colName
+	if len(dump.nsIncludeRegex) > 0 && !matchesAny(dump.nsIncludeRegex, ns) {
+		return true
+	}
+	return matchesAny(dump.nsExcludeRegex, ns)
+}
+
+func matchesAny(regexes []*regexp.Regexp, s string) bool {
+	for _, re := range regexes {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExcludedFields parses --excludeFields values of the form
+// <db>.<collection>=<field>[,<field>...] into a map from namespace to the
+// fields to omit. Values without a namespace apply to defaultNS, which is
+// empty unless a single collection is being dumped.
+func parseExcludedFields(specs []string, defaultNS string) (map[string][]string, error) {
+	excluded := map[string][]string{}
+	for _, spec := range specs {
+		ns, fieldList := defaultNS, spec
+		if i := strings.LastIndex(spec, "="); i >= 0 {
+			ns, fieldList = spec[:i], spec[i+1:]
+		}
+		if ns == "" {
+			return nil, fmt.Errorf("--excludeFields value '%v' must be of the form <namespace>=<field>[,<field>...]", spec)
+		}
+		if !strings.Contains(ns, ".") {
+			return nil, fmt.Errorf("--excludeFields namespace '%v' must be of the form <db>.<collection>", ns)
+		}
+		for _, field := range strings.Split(fieldList, ",") {
+			field = strings.TrimSpace(field)
+			switch {
+			case field == "":
+				return nil, fmt.Errorf("--excludeFields value '%v' contains an empty field name", spec)
+			case field == "_id":
+				return nil, fmt.Errorf("--excludeFields cannot exclude the _id field")
+			case strings.HasPrefix(field, "$"):
+				return nil, fmt.Errorf("--excludeFields field '%v' must not start with '$'", field)
+			}
+			for _, other := range excluded[ns] {
+				if fieldPathsOverlap(field, other) {
+					return nil, fmt.Errorf("--excludeFields fields '%v' and '%v' of %v overlap; give only one of them", other, field, ns)
+				}
+			}
+			excluded[ns] = append(excluded[ns], field)
+		}
+	}
+	return excluded, nil
+}
+
+// fieldPathsOverlap reports whether two dotted field paths are the same or
+// one is within the other, like "a" and "a.b", whose exclusion would depend
+// on the order they are applied in.
+func fieldPathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
+
 // outputPath creates a path for the collection to be written to (sans file extension).
 func (dump *MongoDump) outputPath(dbName, colName string) string {
 	var root string
@@ -419,6 +526,10 @@ func (dump *MongoDump) CreateIntentsForDatabase(dbName string) error {
 			log.Logvf(log.DebugLow, "skipping dump of %v.%v, it is excluded", dbName, collInfo.Name)
 			continue
 		}
+		if dump.shouldSkipNamespace(dbName, collInfo.Name) {
+			log.Logvf(log.DebugLow, "skipping dump of %v.%v, it is excluded by --nsIncludeRegex or --nsExcludeRegex", dbName, collInfo.Name)
+			continue
+		}
 
 		if dump.OutputOptions.ViewsAsCollections && !collInfo.IsView() {
 			log.Logvf(log.DebugLow, "skipping dump of %v.%v because it is not a view", dbName, collInfo.Name)
@@ -139,3 +139,84 @@ func TestShouldSkipSystemNamespace(t *testing.T) {
 		}
 	}
 }
+
+func TestParseExcludedFields(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When parsing --excludeFields values", t, func() {
+		Convey("fields are grouped by namespace", func() {
+			excluded, err := parseExcludedFields([]string{"test.events=body,raw", "test.images=data", "test.events=headers"}, "")
+			So(err, ShouldBeNil)
+			So(excluded["test.events"], ShouldResemble, []string{"body", "raw", "headers"})
+			So(excluded["test.images"], ShouldResemble, []string{"data"})
+		})
+
+		Convey("the namespace defaults to the dumped collection", func() {
+			excluded, err := parseExcludedFields([]string{"body, a.b"}, "test.events")
+			So(err, ShouldBeNil)
+			So(excluded["test.events"], ShouldResemble, []string{"body", "a.b"})
+
+			_, err = parseExcludedFields([]string{"body"}, "")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("overlapping fields are rejected", func() {
+			for _, specs := range [][]string{
+				{"test.events=a,a.b"},
+				{"test.events=a.b.c", "test.events=a.b"},
+				{"test.events=body,body"},
+			} {
+				_, err := parseExcludedFields(specs, "")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "overlap")
+			}
+
+			excluded, err := parseExcludedFields([]string{"test.events=a.b,a.bc,ab", "test.images=a"}, "")
+			So(err, ShouldBeNil)
+			So(excluded["test.events"], ShouldResemble, []string{"a.b", "a.bc", "ab"})
+		})
+
+		Convey("invalid values are rejected", func() {
+			for _, spec := range []string{"events=body", "test.events=", "test.events=a,,b", "test.events=_id", "test.events=$x"} {
+				_, err := parseExcludedFields([]string{spec}, "")
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestSkipNamespaceRegex(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a mongodump including and excluding namespaces by regular expression", t, func() {
+		include, err := compileNamespaceRegexes("--nsIncludeRegex", []string{`tenant_[0-9]+\.(orders|invoices)`, `shared\..*`})
+		So(err, ShouldBeNil)
+		exclude, err := compileNamespaceRegexes("--nsExcludeRegex", []string{`tenant_0+\..*`})
+		So(err, ShouldBeNil)
+		md := &MongoDump{nsIncludeRegex: include, nsExcludeRegex: exclude}
+
+		Convey("only namespaces wholly matching an include are dumped", func() {
+			So(md.shouldSkipNamespace("tenant_12", "orders"), ShouldBeFalse)
+			So(md.shouldSkipNamespace("tenant_12", "invoices"), ShouldBeFalse)
+			So(md.shouldSkipNamespace("shared", "settings"), ShouldBeFalse)
+			So(md.shouldSkipNamespace("tenant_12", "orders_archive"), ShouldBeTrue)
+			So(md.shouldSkipNamespace("tenant_x", "orders"), ShouldBeTrue)
+			So(md.shouldSkipNamespace("old_tenant_12", "orders"), ShouldBeTrue)
+		})
+
+		Convey("excludes take precedence over includes", func() {
+			So(md.shouldSkipNamespace("tenant_00", "orders"), ShouldBeTrue)
+		})
+
+		Convey("without includes every namespace not excluded is dumped", func() {
+			md.nsIncludeRegex = nil
+			So(md.shouldSkipNamespace("anything", "goes"), ShouldBeFalse)
+			So(md.shouldSkipNamespace("tenant_0", "goes"), ShouldBeTrue)
+		})
+
+		Convey("invalid regular expressions are rejected", func() {
+			_, err := compileNamespaceRegexes("--nsExcludeRegex", []string{"tenant_("})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
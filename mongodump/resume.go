@@ -0,0 +1,261 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+const (
+	// resumeStateFileName is the file in the root of the dump directory that
+	// records the progress of a --resume dump. It is removed once the dump
+	// completes.
+	resumeStateFileName = "mongodump.resume.json"
+
+	// A checkpoint is recorded after this many documents or this much time,
+	// whichever comes first.
+	resumeCheckpointDocs     = 10000
+	resumeCheckpointInterval = 10 * time.Second
+)
+
+// namespaceProgress is the high-water mark recorded for a single namespace.
+type namespaceProgress struct {
+	Complete bool `bson:"complete"`
+	// LastID is the _id of the last document known to be on disk, and
+	// Offset is the size of the BSON file up to and including it.
+	LastID interface{} `bson:"lastId,omitempty"`
+	Offset int64       `bson:"offset"`
+}
+
+// resumeState tracks the progress of every namespace in a --resume dump.
+type resumeState struct {
+	Namespaces map[string]*namespaceProgress `bson:"namespaces"`
+
+	file *util.StateFile
+}
+
+// loadResumeState reads the resume state from the given file, returning an
+// empty state if the file does not exist yet.
+func loadResumeState(path string) (*resumeState, error) {
+	state := &resumeState{file: util.NewStateFile(path, "resume")}
+	if _, err := state.file.Read(state); err != nil {
+		return nil, err
+	}
+	if state.Namespaces == nil {
+		state.Namespaces = map[string]*namespaceProgress{}
+	}
+	return state, nil
+}
+
+// progress returns a copy of the recorded progress for ns.
+func (s *resumeState) progress(ns string) namespaceProgress {
+	s.file.Lock()
+	defer s.file.Unlock()
+	if p, ok := s.Namespaces[ns]; ok {
+		return *p
+	}
+	return namespaceProgress{}
+}
+
+// record stores the progress for ns and saves the state file.
+func (s *resumeState) record(ns string, p namespaceProgress) error {
+	s.file.Lock()
+	defer s.file.Unlock()
+	s.Namespaces[ns] = &p
+	return s.file.Write(s)
+}
+
+// remove deletes the state file once the dump has completed.
+func (s *resumeState) remove() error {
+	return s.file.Remove()
+}
+
+// resumeStatePath returns the location of the resume state file.
+func (dump *MongoDump) resumeStatePath() string {
+	root := dump.OutputOptions.Out
+	if root == "" {
+		root = "dump"
+	}
+	return filepath.Join(root, resumeStateFileName)
+}
+
+// canResumeWithinIntent reports whether a partially dumped intent can be
+// continued from its last _id rather than dumped again from the start.
+// Views and time series collections have no usable _id ordering.
+func canResumeWithinIntent(intent *intents.Intent) bool {
+	_, isFile := intent.BSONFile.(*realBSONFile)
+	return isFile && !intent.IsView() && !intent.IsTimeseries()
+}
+
+// idTypeBrackets lists the BSON types an _id can have, grouped the way the
+// server sorts them: types in the same bracket compare with each other, and
+// every value of a bracket sorts after every value of the brackets before it.
+var idTypeBrackets = []struct {
+	types   []bsontype.Type
+	aliases []string
+}{
+	{[]bsontype.Type{bsontype.MinKey}, []string{"minKey"}},
+	{[]bsontype.Type{bsontype.Undefined}, []string{"undefined"}},
+	{[]bsontype.Type{bsontype.Null}, []string{"null"}},
+	{[]bsontype.Type{bsontype.Double, bsontype.Int32, bsontype.Int64, bsontype.Decimal128},
+		[]string{"double", "int", "long", "decimal"}},
+	{[]bsontype.Type{bsontype.String, bsontype.Symbol}, []string{"string", "symbol"}},
+	{[]bsontype.Type{bsontype.EmbeddedDocument}, []string{"object"}},
+	{[]bsontype.Type{bsontype.Array}, []string{"array"}},
+	{[]bsontype.Type{bsontype.Binary}, []string{"binData"}},
+	{[]bsontype.Type{bsontype.ObjectID}, []string{"objectId"}},
+	{[]bsontype.Type{bsontype.Boolean}, []string{"bool"}},
+	{[]bsontype.Type{bsontype.DateTime}, []string{"date"}},
+	{[]bsontype.Type{bsontype.Timestamp}, []string{"timestamp"}},
+	{[]bsontype.Type{bsontype.Regex}, []string{"regex"}},
+	{[]bsontype.Type{bsontype.DBPointer}, []string{"dbPointer"}},
+	{[]bsontype.Type{bsontype.JavaScript}, []string{"javascript"}},
+	{[]bsontype.Type{bsontype.CodeWithScope}, []string{"javascriptWithScope"}},
+	{[]bsontype.Type{bsontype.MaxKey}, []string{"maxKey"}},
+}
+
+// laterIDTypes returns the $type aliases of the brackets that sort after
+// the bracket of id, or nil if the type of id is unknown.
+func laterIDTypes(id interface{}) bson.A {
+	_, raw, err := bson.MarshalValue(bson.D{bson.E{Key: "_id", Value: id}})
+	if err != nil {
+		return nil
+	}
+	value, err := bson.Raw(raw).LookupErr("_id")
+	if err != nil {
+		return nil
+	}
+	for i, bracket := range idTypeBrackets {
+		for _, t := range bracket.types {
+			if t != value.Type {
+				continue
+			}
+			var later bson.A
+			for _, next := range idTypeBrackets[i+1:] {
+				for _, alias := range next.aliases {
+					later = append(later, alias)
+				}
+			}
+			return later
+		}
+	}
+	return nil
+}
+
+// resumeFilter restricts filter to documents after lastID in _id order.
+// $gt only matches values in the bracket of lastID, so the documents whose
+// _id has a type that sorts after it are matched by their type.
+func resumeFilter(filter interface{}, lastID interface{}) interface{} {
+	after := bson.M{"_id": bson.M{"$gt": lastID}}
+	if later := laterIDTypes(lastID); len(later) > 0 {
+		after = bson.M{"$or": bson.A{after, bson.M{"_id": bson.M{"$type": later}}}}
+	}
+	if filter == nil {
+		return after
+	}
+	if d, ok := filter.(bson.D); ok && len(d) == 0 {
+		return after
+	}
+	return bson.M{"$and": bson.A{filter, after}}
+}
+
+// prepareResume applies the recorded progress for an intent to its query and
+// BSON file. It returns true if the intent was already dumped completely.
+func (dump *MongoDump) prepareResume(intent *intents.Intent, query *db.DeferredQuery) (bool, error) {
+	ns := intent.Namespace()
+	progress := dump.resumeState.progress(ns)
+	if progress.Complete {
+		return true, nil
+	}
+	if !canResumeWithinIntent(intent) {
+		return false, nil
+	}
+	query.Sort = bson.D{bson.E{Key: "_id", Value: 1}}
+	query.Hint = nil
+
+	file := intent.BSONFile.(*realBSONFile)
+	if progress.LastID != nil {
+		stat, err := os.Stat(file.path)
+		if err != nil || stat.Size() < progress.Offset {
+			log.Logvf(log.Always, "%v does not match the resume state, dumping %v from the start", file.path, ns)
+			return false, dump.resumeState.record(ns, namespaceProgress{})
+		}
+		log.Logvf(log.Always, "resuming %v after _id %v", ns, progress.LastID)
+		query.Filter = resumeFilter(query.Filter, progress.LastID)
+		file.resumeOffset = progress.Offset
+	}
+	file.trackProgress = true
+	return false, nil
+}
+
+// checkpointWriter records the _id and file offset of the documents written
+// for an intent so that an interrupted dump can pick up where it left off.
+// Every Write must be exactly one BSON document.
+type checkpointWriter struct {
+	io.Writer
+	state *resumeState
+	ns    string
+
+	offset   int64
+	lastID   bson.RawValue
+	pending  int
+	lastSave time.Time
+}
+
+func newCheckpointWriter(w io.Writer, state *resumeState, ns string, offset int64) *checkpointWriter {
+	return &checkpointWriter{Writer: w, state: state, ns: ns, offset: offset, lastSave: time.Now()}
+}
+
+// Write writes a single document, checkpointing periodically.
+func (cw *checkpointWriter) Write(doc []byte) (int, error) {
+	n, err := cw.Writer.Write(doc)
+	cw.offset += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if id, lookupErr := bson.Raw(doc).LookupErr("_id"); lookupErr == nil {
+		// the document's buffer is reused once it is written
+		cw.lastID = bson.RawValue{Type: id.Type, Value: append([]byte(nil), id.Value...)}
+	}
+	cw.pending++
+	if cw.pending >= resumeCheckpointDocs || time.Since(cw.lastSave) >= resumeCheckpointInterval {
+		if err = cw.checkpoint(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// checkpoint flushes everything written so far and records it.
+func (cw *checkpointWriter) checkpoint() error {
+	if cw.pending == 0 {
+		return nil
+	}
+	if flusher, ok := cw.Writer.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			return err
+		}
+	}
+	var lastID interface{}
+	if err := cw.lastID.Unmarshal(&lastID); err != nil {
+		return fmt.Errorf("error recording _id for %v: %v", cw.ns, err)
+	}
+	cw.pending = 0
+	cw.lastSave = time.Now()
+	return cw.state.record(cw.ns, namespaceProgress{LastID: lastID, Offset: cw.offset})
+}
@@ -0,0 +1,122 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestResumeState(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a resume state file", t, func() {
+		dir, err := ioutil.TempDir("", "mongodump-resume")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, resumeStateFileName)
+
+		state, err := loadResumeState(path)
+		So(err, ShouldBeNil)
+		So(state.Namespaces, ShouldBeEmpty)
+
+		Convey("progress survives a reload with _id types intact", func() {
+			oid := primitive.NewObjectID()
+			So(state.record("test.a", namespaceProgress{LastID: oid, Offset: 42}), ShouldBeNil)
+			So(state.record("test.b", namespaceProgress{Complete: true}), ShouldBeNil)
+
+			reloaded, err := loadResumeState(path)
+			So(err, ShouldBeNil)
+			So(reloaded.progress("test.a").LastID, ShouldEqual, oid)
+			So(reloaded.progress("test.a").Offset, ShouldEqual, 42)
+			So(reloaded.progress("test.b").Complete, ShouldBeTrue)
+			So(reloaded.progress("test.c"), ShouldResemble, namespaceProgress{})
+
+			So(reloaded.remove(), ShouldBeNil)
+			_, err = os.Stat(path)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("a checkpoint writer records the last _id and offset", func() {
+			var out bytes.Buffer
+			cw := newCheckpointWriter(&out, state, "test.a", 10)
+			var size int64
+			for i := int32(1); i <= 3; i++ {
+				doc, err := bson.Marshal(bson.M{"_id": i})
+				So(err, ShouldBeNil)
+				_, err = cw.Write(doc)
+				So(err, ShouldBeNil)
+				size += int64(len(doc))
+			}
+			So(cw.checkpoint(), ShouldBeNil)
+
+			progress := state.progress("test.a")
+			So(progress.LastID, ShouldEqual, int32(3))
+			So(progress.Offset, ShouldEqual, 10+size)
+		})
+	})
+}
+
+func TestResumeFilter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Resume filters only match documents after the last _id", t, func() {
+		after := resumeFilter(nil, int32(5)).(bson.M)["$or"].(bson.A)
+		So(after, ShouldHaveLength, 2)
+		So(after[0], ShouldResemble, bson.M{"_id": bson.M{"$gt": int32(5)}})
+		So(resumeFilter(bson.D{}, int32(5)), ShouldResemble, resumeFilter(nil, int32(5)))
+
+		query := bson.D{bson.E{Key: "a", Value: 1}}
+		So(resumeFilter(query, int32(5)), ShouldResemble,
+			bson.M{"$and": bson.A{query, resumeFilter(nil, int32(5))}})
+	})
+
+	Convey("Resume filters match the _id types that sort after the last _id", t, func() {
+		later := resumeFilter(nil, int32(5)).(bson.M)["$or"].(bson.A)[1].(bson.M)["_id"].(bson.M)["$type"].(bson.A)
+		So(later, ShouldContain, "string")
+		So(later, ShouldContain, "objectId")
+		So(later, ShouldNotContain, "long")
+		So(later, ShouldNotContain, "null")
+
+		later = resumeFilter(nil, "x").(bson.M)["$or"].(bson.A)[1].(bson.M)["_id"].(bson.M)["$type"].(bson.A)
+		So(later, ShouldContain, "objectId")
+		So(later, ShouldNotContain, "int")
+		So(later, ShouldNotContain, "symbol")
+
+		So(resumeFilter(nil, primitive.MaxKey{}), ShouldResemble, bson.M{"_id": bson.M{"$gt": primitive.MaxKey{}}})
+	})
+}
+
+func TestRealBSONFileResume(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Resuming a BSON file discards data after the checkpoint", t, func() {
+		dir, err := ioutil.TempDir("", "mongodump-resume")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "c.bson")
+		So(ioutil.WriteFile(path, []byte("keptdiscarded"), 0644), ShouldBeNil)
+
+		file := &realBSONFile{path: path, resumeOffset: 4}
+		So(file.Open(), ShouldBeNil)
+		_, err = file.Write([]byte("-new"))
+		So(err, ShouldBeNil)
+		So(file.Close(), ShouldBeNil)
+
+		data, err := ioutil.ReadFile(path)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "kept-new")
+	})
+}
@@ -0,0 +1,122 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+)
+
+// namespaceRetryDelay is how long to wait before each round of retries, so
+// that transient conditions such as an election have time to clear.
+var namespaceRetryDelay = 5 * time.Second
+
+// namespaceFailure is a namespace whose dump failed, with the last error.
+type namespaceFailure struct {
+	intent *intents.Intent
+	err    error
+}
+
+// failedNamespaces collects the namespaces that failed during the main dump
+// when --maxNamespaceRetries is set.
+type failedNamespaces struct {
+	failures []namespaceFailure
+	lock     sync.Mutex
+}
+
+func (f *failedNamespaces) add(intent *intents.Intent, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.failures = append(f.failures, namespaceFailure{intent, err})
+}
+
+// canRetryNamespace reports whether a failed namespace should be set aside
+// to be retried once the other namespaces are dumped, rather than ending the
+// dump.
+func (dump *MongoDump) canRetryNamespace(intent *intents.Intent) bool {
+	if dump.OutputOptions.MaxNamespaceRetries <= 0 || dump.shuttingDown() {
+		return false
+	}
+	return !intent.IsOplog() && !intent.IsUsers() && !intent.IsRoles() && !intent.IsAuthVersion()
+}
+
+// shuttingDown reports whether the dump has been interrupted.
+func (dump *MongoDump) shuttingDown() bool {
+	select {
+	case <-dump.shutdownIntentsNotifier.notified:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryFailedNamespaces dumps the namespaces that failed during the main dump
+// again, one at a time, up to --maxNamespaceRetries times each. It returns an
+// error listing the namespaces that still failed.
+func (dump *MongoDump) retryFailedNamespaces() error {
+	failures := dump.failedNamespaces.failures
+	if len(failures) == 0 {
+		return nil
+	}
+	buffer := dump.getResettableOutputBuffer()
+	failures = retryNamespaces(failures, dump.OutputOptions.MaxNamespaceRetries, dump.shuttingDown,
+		func(intent *intents.Intent) error {
+			return dump.DumpIntent(intent, buffer)
+		})
+	return namespaceFailuresError(failures)
+}
+
+// retryNamespaces calls dumpIntent for each failed namespace, in rounds,
+// until it succeeds or has been retried maxRetries times, and returns the
+// namespaces that still failed. Retrying stops early if stop returns true.
+func retryNamespaces(failures []namespaceFailure, maxRetries int, stop func() bool,
+	dumpIntent func(*intents.Intent) error) []namespaceFailure {
+	for attempt := 1; attempt <= maxRetries && len(failures) > 0; attempt++ {
+		log.Logvf(log.Always, "retrying %v failed %v (attempt %v of %v)",
+			len(failures), namespacePlural(len(failures)), attempt, maxRetries)
+		time.Sleep(namespaceRetryDelay)
+		var remaining []namespaceFailure
+		for i, failure := range failures {
+			if stop() {
+				return append(remaining, failures[i:]...)
+			}
+			log.Logvf(log.Always, "retrying %v after error: %v", failure.intent.DataNamespace(), failure.err)
+			if err := dumpIntent(failure.intent); err != nil {
+				log.Logvf(log.Always, "retry of %v failed: %v", failure.intent.DataNamespace(), err)
+				remaining = append(remaining, namespaceFailure{failure.intent, err})
+			}
+		}
+		failures = remaining
+	}
+	return failures
+}
+
+// namespaceFailuresError returns an error summarizing the namespaces that
+// could not be dumped, or nil if there are none.
+func namespaceFailuresError(failures []namespaceFailure) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(failures))
+	for _, failure := range failures {
+		lines = append(lines, fmt.Sprintf("%v: %v", failure.intent.DataNamespace(), failure.err))
+	}
+	return fmt.Errorf("failed to dump %v %v:\n\t%v",
+		len(failures), namespacePlural(len(failures)), strings.Join(lines, "\n\t"))
+}
+
+func namespacePlural(count int) string {
+	if count == 1 {
+		return "namespace"
+	}
+	return "namespaces"
+}
@@ -0,0 +1,65 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRetryNamespaces(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+	log.SetWriter(ioutil.Discard)
+	namespaceRetryDelay = 0
+
+	Convey("With namespaces that failed during the dump", t, func() {
+		flaky := &intents.Intent{DB: "test", C: "flaky"}
+		broken := &intents.Intent{DB: "test", C: "broken"}
+		failures := []namespaceFailure{
+			{flaky, fmt.Errorf("cursor killed")},
+			{broken, fmt.Errorf("cursor killed")},
+		}
+		attempts := map[string]int{}
+		dumpIntent := func(intent *intents.Intent) error {
+			attempts[intent.C]++
+			if intent == broken || attempts[intent.C] < 2 {
+				return fmt.Errorf("attempt %v failed", attempts[intent.C])
+			}
+			return nil
+		}
+		never := func() bool { return false }
+
+		Convey("each is retried until it succeeds or runs out of retries", func() {
+			remaining := retryNamespaces(failures, 3, never, dumpIntent)
+			So(attempts, ShouldResemble, map[string]int{"flaky": 2, "broken": 3})
+			So(remaining, ShouldHaveLength, 1)
+			So(remaining[0].intent, ShouldEqual, broken)
+			So(remaining[0].err.Error(), ShouldEqual, "attempt 3 failed")
+
+			err := namespaceFailuresError(remaining)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "failed to dump 1 namespace")
+			So(err.Error(), ShouldContainSubstring, "test.broken: attempt 3 failed")
+		})
+
+		Convey("nothing is retried once the dump is interrupted", func() {
+			remaining := retryNamespaces(failures, 3, func() bool { return true }, dumpIntent)
+			So(attempts, ShouldBeEmpty)
+			So(remaining, ShouldHaveLength, 2)
+		})
+
+		Convey("no failures means no error", func() {
+			So(namespaceFailuresError(nil), ShouldBeNil)
+		})
+	})
+}
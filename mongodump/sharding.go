@@ -0,0 +1,152 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+)
+
+// balancerCheckInterval is how often the balancer is polled while waiting
+// for a balancer round to finish.
+const balancerCheckInterval = 5 * time.Second
+
+// connectToShard replaces the mongos session with one connected directly to
+// the shard named by --shard or tagged with --shardZone. The mongos session
+// is kept for balancer checks.
+func (dump *MongoDump) connectToShard() error {
+	option := "--shard"
+	if dump.InputOptions.ShardZone != "" {
+		option = "--shardZone"
+	}
+	isMongos, err := dump.SessionProvider.IsMongos()
+	if err != nil {
+		return fmt.Errorf("error checking for Mongos: %v", err)
+	}
+	if !isMongos {
+		return fmt.Errorf("%v requires a connection to a mongos", option)
+	}
+	var shard *db.Shard
+	if dump.InputOptions.ShardZone != "" {
+		shards, err := dump.SessionProvider.GetShards()
+		if err != nil {
+			return err
+		}
+		shard, err = shardInZone(shards, dump.InputOptions.ShardZone)
+		if err != nil {
+			return err
+		}
+	} else {
+		shard, err = dump.SessionProvider.GetShard(dump.InputOptions.Shard)
+		if err != nil {
+			return err
+		}
+	}
+	log.Logvf(log.Always, "dumping directly from shard %v (%v)", shard.ID, shard.Host)
+	log.Logvf(log.Always, "warning: documents read directly from a shard may include orphans left by chunk migrations")
+
+	provider, err := db.NewSessionProvider(db.ShardToolOptions(*dump.ToolOptions, shard))
+	if err != nil {
+		return fmt.Errorf("error connecting to shard %v: %v", shard.ID, err)
+	}
+	dump.routerProvider = dump.SessionProvider
+	dump.SessionProvider = provider
+	return nil
+}
+
+// shardInZone returns the only shard tagged with a zone.
+func shardInZone(shards []*db.Shard, zone string) (*db.Shard, error) {
+	var matches []*db.Shard
+	var names []string
+	for _, shard := range shards {
+		for _, tag := range shard.Tags {
+			if tag == zone {
+				matches = append(matches, shard)
+				names = append(names, shard.ID)
+				break
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no shard in the cluster is in zone '%v'", zone)
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("zone '%v' has %v shards (%v); choose one with --shard",
+		zone, len(matches), strings.Join(names, ", "))
+}
+
+// balancerProvider returns the session to run balancer checks against, or
+// nil if the dump is not of a sharded cluster.
+func (dump *MongoDump) balancerProvider() *db.SessionProvider {
+	if dump.routerProvider != nil {
+		return dump.routerProvider
+	}
+	if dump.isMongos {
+		return dump.SessionProvider
+	}
+	return nil
+}
+
+// checkBalancer warns if the balancer could move chunks during the dump and,
+// with --waitForBalancer, waits for an active balancer round to finish. It
+// returns the status seen, or nil if it could not be determined.
+func (dump *MongoDump) checkBalancer() (*db.BalancerStatus, error) {
+	provider := dump.balancerProvider()
+	if provider == nil {
+		return nil, nil
+	}
+	status, err := provider.GetBalancerStatus()
+	if err != nil {
+		log.Logvf(log.Always, "warning: unable to check the balancer: %v", err)
+		return nil, nil
+	}
+	if status.Mode != "off" {
+		log.Logvf(log.Always, "warning: the balancer is enabled (mode '%v'); chunk migrations during the "+
+			"dump can make it inconsistent. Stop the balancer for a consistent dump", status.Mode)
+	}
+	for status.InBalancerRound {
+		if !dump.InputOptions.WaitForBalancer {
+			log.Logvf(log.Always, "warning: a balancer round is in progress; "+
+				"use --waitForBalancer to wait for it to finish before dumping")
+			break
+		}
+		log.Logvf(log.Always, "waiting for the current balancer round to finish")
+		select {
+		case <-dump.shutdownIntentsNotifier.notified:
+			return nil, util.ErrTerminated
+		case <-time.After(balancerCheckInterval):
+		}
+		if status, err = provider.GetBalancerStatus(); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// checkBalancerAfterDump warns if the balancer ran while data was being dumped.
+func (dump *MongoDump) checkBalancerAfterDump(before *db.BalancerStatus) {
+	provider := dump.balancerProvider()
+	if before == nil || provider == nil {
+		return
+	}
+	after, err := provider.GetBalancerStatus()
+	if err != nil {
+		log.Logvf(log.Always, "warning: unable to check the balancer: %v", err)
+		return
+	}
+	if after.InBalancerRound || after.NumBalancerRounds != before.NumBalancerRounds {
+		log.Logvf(log.Always, "warning: the balancer ran while the dump was in progress; "+
+			"chunks may have been migrated and the dump may be inconsistent")
+	}
+}
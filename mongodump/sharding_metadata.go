@@ -0,0 +1,220 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// shardingMetadataFileName is the file in the root of the dump directory
+// written by --includeShardingMetadata.
+const shardingMetadataFileName = "sharding.json"
+
+// ShardingMetadata describes how the dumped collections were distributed
+// across a sharded cluster, as read from its config database, so that
+// mongorestore --restoreShardingMetadata can shard them the same way.
+type ShardingMetadata struct {
+	ToolVersion string              `bson:"toolVersion"`
+	Created     time.Time           `bson:"created"`
+	Shards      []ShardZones        `bson:"shards"`
+	Zones       []ZoneRange         `bson:"zones"`
+	Collections []ShardedCollection `bson:"collections"`
+}
+
+// ShardZones lists the zones a shard belongs to.
+type ShardZones struct {
+	Shard string   `bson:"shard"`
+	Zones []string `bson:"zones,omitempty"`
+}
+
+// ZoneRange is a range of shard key values assigned to a zone.
+type ZoneRange struct {
+	Namespace string `bson:"ns"`
+	Min       bson.D `bson:"min"`
+	Max       bson.D `bson:"max"`
+	Zone      string `bson:"zone"`
+}
+
+// ShardedCollection is the shard key and chunks of a sharded collection.
+type ShardedCollection struct {
+	Namespace string       `bson:"ns"`
+	Key       bson.D       `bson:"key"`
+	Unique    bool         `bson:"unique"`
+	Chunks    []ChunkRange `bson:"chunks"`
+}
+
+// ChunkRange is the range of shard key values of a chunk and the shard
+// that owned it.
+type ChunkRange struct {
+	Min   bson.D `bson:"min"`
+	Max   bson.D `bson:"max"`
+	Shard string `bson:"shard"`
+}
+
+// dumpedNamespaces returns the namespaces being dumped, including the
+// buckets collections of time series collections.
+func (dump *MongoDump) dumpedNamespaces() []string {
+	var namespaces []string
+	for _, intent := range dump.manager.Intents() {
+		if intent.IsView() && !intent.IsTimeseries() {
+			continue
+		}
+		namespaces = append(namespaces, intent.Namespace())
+		if intent.IsTimeseries() {
+			namespaces = append(namespaces, intent.DataNamespace())
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// getShardingMetadata reads the sharding metadata of the dumped namespaces
+// from the config database of the cluster.
+func (dump *MongoDump) getShardingMetadata() (*ShardingMetadata, error) {
+	provider := dump.balancerProvider()
+	if provider == nil {
+		return nil, fmt.Errorf("--includeShardingMetadata requires a connection to a mongos")
+	}
+	session, err := provider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	config := session.Database("config")
+	namespaces := dump.dumpedNamespaces()
+	metadata := &ShardingMetadata{
+		ToolVersion: dump.ToolOptions.VersionStr,
+		Created:     time.Now().UTC(),
+	}
+
+	shards, err := provider.GetShards()
+	if err != nil {
+		return nil, err
+	}
+	for _, shard := range shards {
+		metadata.Shards = append(metadata.Shards, ShardZones{Shard: shard.ID, Zones: shard.Tags})
+	}
+
+	findOpts := mopt.Find().SetSort(bson.D{{"ns", 1}, {"min", 1}})
+	cursor, err := config.Collection("tags").Find(context.Background(), bson.M{"ns": bson.M{"$in": namespaces}}, findOpts)
+	if err != nil {
+		return nil, fmt.Errorf("error reading zones: %v", err)
+	}
+	var tags []struct {
+		Namespace string `bson:"ns"`
+		Min       bson.D `bson:"min"`
+		Max       bson.D `bson:"max"`
+		Tag       string `bson:"tag"`
+	}
+	if err = cursor.All(context.Background(), &tags); err != nil {
+		return nil, fmt.Errorf("error reading zones: %v", err)
+	}
+	for _, tag := range tags {
+		metadata.Zones = append(metadata.Zones, ZoneRange{tag.Namespace, tag.Min, tag.Max, tag.Tag})
+	}
+
+	cursor, err = config.Collection("collections").Find(context.Background(),
+		bson.M{"_id": bson.M{"$in": namespaces}, "dropped": bson.M{"$ne": true}},
+		mopt.Find().SetSort(bson.D{{"_id", 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error reading sharded collections: %v", err)
+	}
+	var collections []struct {
+		Namespace string      `bson:"_id"`
+		Key       bson.D      `bson:"key"`
+		Unique    bool        `bson:"unique"`
+		UUID      interface{} `bson:"uuid"`
+	}
+	if err = cursor.All(context.Background(), &collections); err != nil {
+		return nil, fmt.Errorf("error reading sharded collections: %v", err)
+	}
+	for _, coll := range collections {
+		chunks, err := getChunks(config, coll.Namespace, coll.UUID)
+		if err != nil {
+			return nil, err
+		}
+		metadata.Collections = append(metadata.Collections, ShardedCollection{
+			Namespace: coll.Namespace,
+			Key:       coll.Key,
+			Unique:    coll.Unique,
+			Chunks:    chunks,
+		})
+	}
+	return metadata, nil
+}
+
+// getChunks reads the chunks of a sharded collection in shard key order.
+// Chunks refer to their collection by namespace before MongoDB 5.0 and by
+// UUID from then on.
+func getChunks(config *mongo.Database, ns string, uuid interface{}) ([]ChunkRange, error) {
+	filter := bson.M{"ns": ns}
+	if uuid != nil {
+		filter = bson.M{"$or": bson.A{bson.M{"ns": ns}, bson.M{"uuid": uuid}}}
+	}
+	cursor, err := config.Collection("chunks").Find(context.Background(), filter,
+		mopt.Find().SetSort(bson.D{{"min", 1}}).SetProjection(bson.M{"min": 1, "max": 1, "shard": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("error reading chunks of %v: %v", ns, err)
+	}
+	var chunks []ChunkRange
+	if err = cursor.All(context.Background(), &chunks); err != nil {
+		return nil, fmt.Errorf("error reading chunks of %v: %v", ns, err)
+	}
+	return chunks, nil
+}
+
+// writeShardingMetadata writes the sharding metadata of the dumped
+// namespaces to the root of the dump directory as indented canonical
+// extended JSON, which keeps the types of shard key values.
+func (dump *MongoDump) writeShardingMetadata() error {
+	metadata, err := dump.getShardingMetadata()
+	if err != nil {
+		return err
+	}
+	jsonBytes, err := bson.MarshalExtJSON(metadata, true, false)
+	if err != nil {
+		return fmt.Errorf("error marshalling sharding metadata: %v", err)
+	}
+	var indented bytes.Buffer
+	if err = json.Indent(&indented, jsonBytes, "", "  "); err != nil {
+		return fmt.Errorf("error formatting sharding metadata: %v", err)
+	}
+	indented.WriteByte('\n')
+
+	path := dump.shardingMetadataPath()
+	if err = os.MkdirAll(filepath.Dir(path), os.ModeDir|os.ModePerm); err != nil {
+		return fmt.Errorf("error creating directory for sharding metadata: %v", err)
+	}
+	if err = ioutil.WriteFile(path, indented.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing sharding metadata: %v", err)
+	}
+	log.Logvf(log.Always, "wrote sharding metadata for %v sharded %v to %v", len(metadata.Collections),
+		util.Pluralize(len(metadata.Collections), "collection", "collections"), path)
+	return nil
+}
+
+// shardingMetadataPath returns the location of the sharding metadata file.
+func (dump *MongoDump) shardingMetadataPath() string {
+	root := dump.OutputOptions.Out
+	if root == "" {
+		root = "dump"
+	}
+	return filepath.Join(root, shardingMetadataFileName)
+}
@@ -0,0 +1,43 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShardInZone(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	shards := []*db.Shard{
+		{ID: "shard0", Host: "rs0/a:27018", Tags: []string{"EU"}},
+		{ID: "shard1", Host: "rs1/b:27018", Tags: []string{"US", "backup"}},
+		{ID: "shard2", Host: "rs2/c:27018", Tags: []string{"US"}},
+	}
+
+	Convey("The shard of a zone with one shard is selected", t, func() {
+		shard, err := shardInZone(shards, "backup")
+		So(err, ShouldBeNil)
+		So(shard.ID, ShouldEqual, "shard1")
+	})
+
+	Convey("A zone with several shards is refused", t, func() {
+		_, err := shardInZone(shards, "US")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "shard1, shard2")
+	})
+
+	Convey("A zone without shards is refused", t, func() {
+		_, err := shardInZone(shards, "APAC")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "APAC")
+	})
+}
@@ -0,0 +1,55 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+)
+
+// newReadThrottle builds the throttle that paces document reads according to
+// --rateLimit, --maxOpsPerSec and --maxReplicationLag, returning nil if no
+// limits are set. It is shared by all dump routines so the limits apply to
+// the dump as a whole. The lag monitor, if any, runs until the throttle is
+// stopped or the dump shuts down.
+func (dump *MongoDump) newReadThrottle() *util.Throttle {
+	opts := dump.InputOptions
+	if opts.RateLimit <= 0 && opts.MaxOpsPerSec <= 0 && opts.MaxReplicationLag <= 0 {
+		return nil
+	}
+	t := util.NewThrottle("reads", opts.RateLimit*1024*1024, float64(opts.MaxOpsPerSec))
+	t.StopOn(dump.shutdownIntentsNotifier.notified)
+	if opts.RateLimit > 0 {
+		log.Logvf(log.Info, "limiting reads to %v MiB/s", opts.RateLimit)
+	}
+	if opts.MaxOpsPerSec > 0 {
+		log.Logvf(log.Info, "limiting reads to %v documents per second", opts.MaxOpsPerSec)
+	}
+	if opts.MaxReplicationLag > 0 {
+		log.Logvf(log.Info, "pausing reads while replication lag exceeds %v", opts.MaxReplicationLag)
+		go t.Monitor("--maxReplicationLag", dump.sourceLagCheck(opts.MaxReplicationLag))
+	}
+	return t
+}
+
+// sourceLagCheck returns a check of the replication lag of the member being
+// read from, giving a reason to pause reads while it is above maxLag.
+func (dump *MongoDump) sourceLagCheck(maxLag time.Duration) func() (string, error) {
+	return func() (string, error) {
+		status, err := dump.SessionProvider.GetReplSetStatus(dump.ToolOptions.ReadPreference)
+		if err != nil {
+			return "", fmt.Errorf("unable to check replication lag: %v", err)
+		}
+		if lag := status.SelfLag(); lag > maxLag {
+			return fmt.Sprintf("replication lag on the source is %v, above %v", lag, maxLag), nil
+		}
+		return "", nil
+	}
+}
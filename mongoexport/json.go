@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"io"
 
+	"github.com/huimingz/mongo-tools/common/bsonutil"
 	"github.com/huimingz/mongo-tools/common/json"
 	"go.mongodb.org/mongo-driver/bson"
 )
@@ -25,6 +26,8 @@ type JSONExportOutput struct {
 	Out          io.Writer
 	NumExported  int64
 	JSONFormat   JSONFormat
+
+	converter *bsonutil.DocumentConverter
 }
 
 // NewJSONExportOutput creates a new JSONExportOutput in array mode if specified,
@@ -36,6 +39,7 @@ func NewJSONExportOutput(arrayOutput bool, prettyOutput bool, out io.Writer, jso
 		out,
 		0,
 		jsonFormat,
+		nil,
 	}
 }
 
@@ -78,6 +82,32 @@ func (jsonExporter *JSONExportOutput) Flush() error {
 // ExportDocument converts the given document to extended JSON, and writes it
 // to the output.
 func (jsonExporter *JSONExportOutput) ExportDocument(document bson.D) error {
+	jsonOut, err := bson.MarshalExtJSON(document, jsonExporter.JSONFormat == Canonical, false)
+	if err != nil {
+		return err
+	}
+	return jsonExporter.writeDocument(jsonOut)
+}
+
+// ExportRaw converts a BSON document to extended JSON a value at a time,
+// without decoding it first, and writes it to the output.
+func (jsonExporter *JSONExportOutput) ExportRaw(document bson.Raw) error {
+	if jsonExporter.converter == nil {
+		format := bsonutil.RelaxedExtJSONStream
+		if jsonExporter.JSONFormat == Canonical {
+			format = bsonutil.CanonicalExtJSONStream
+		}
+		jsonExporter.converter = bsonutil.NewDocumentConverter(format)
+	}
+	jsonOut, err := jsonExporter.converter.ConvertBSON(document)
+	if err != nil {
+		return err
+	}
+	return jsonExporter.writeDocument(jsonOut)
+}
+
+// writeDocument writes a document converted to extended JSON to the output.
+func (jsonExporter *JSONExportOutput) writeDocument(jsonOut []byte) error {
 	if jsonExporter.ArrayOutput || jsonExporter.PrettyOutput {
 		if jsonExporter.NumExported >= 1 {
 			if jsonExporter.ArrayOutput {
@@ -92,30 +122,20 @@ func (jsonExporter *JSONExportOutput) ExportDocument(document bson.D) error {
 			}
 		}
 
-		jsonOut, err := bson.MarshalExtJSON(document, jsonExporter.JSONFormat == Canonical, false)
-		if err != nil {
-			return err
-		}
-
 		if jsonExporter.PrettyOutput {
 			var jsonFormatted bytes.Buffer
-			if err = json.Indent(&jsonFormatted, jsonOut, "", "\t"); err != nil {
+			if err := json.Indent(&jsonFormatted, jsonOut, "", "\t"); err != nil {
 				return err
 			}
 			jsonOut = jsonFormatted.Bytes()
 		}
 
-		if _, err = jsonExporter.Out.Write(jsonOut); err != nil {
+		if _, err := jsonExporter.Out.Write(jsonOut); err != nil {
 			return err
 		}
 	} else {
-		extendedDoc, err := bson.MarshalExtJSON(document, jsonExporter.JSONFormat == Canonical, false)
-		if err != nil {
-			return err
-		}
-
-		extendedDoc = append(extendedDoc, '\n')
-		if _, err = jsonExporter.Out.Write(extendedDoc); err != nil {
+		jsonOut = append(jsonOut, '\n')
+		if _, err := jsonExporter.Out.Write(jsonOut); err != nil {
 			return err
 		}
 	}
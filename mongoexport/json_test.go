@@ -9,6 +9,7 @@ package mongoexport
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/huimingz/mongo-tools/common/json"
 	"github.com/huimingz/mongo-tools/common/testtype"
@@ -94,3 +95,33 @@ func TestJSONArray(t *testing.T) {
 
 	})
 }
+
+func TestExportRaw(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Documents written from their BSON match decoded documents", t, func() {
+		docs := []bson.D{
+			{{"_id", primitive.NewObjectID()}, {"n", int32(1)}, {"f", 2.5}, {"big", int64(1) << 40}},
+			{{"_id", int32(2)}, {"when", primitive.NewDateTimeFromTime(time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))},
+				{"nested", bson.D{{"a", bson.A{"x", true, nil}}}}, {"d", primitive.NewDecimal128(1, 2)}},
+		}
+		for _, format := range []JSONFormat{Relaxed, Canonical} {
+			for _, mode := range [][2]bool{{false, false}, {true, false}, {false, true}, {true, true}} {
+				var decoded, raw bytes.Buffer
+				fromDocs := NewJSONExportOutput(mode[0], mode[1], &decoded, format)
+				fromRaw := NewJSONExportOutput(mode[0], mode[1], &raw, format)
+				So(fromDocs.WriteHeader(), ShouldBeNil)
+				So(fromRaw.WriteHeader(), ShouldBeNil)
+				for _, doc := range docs {
+					So(fromDocs.ExportDocument(doc), ShouldBeNil)
+					b, err := bson.Marshal(doc)
+					So(err, ShouldBeNil)
+					So(fromRaw.ExportRaw(b), ShouldBeNil)
+				}
+				So(fromDocs.WriteFooter(), ShouldBeNil)
+				So(fromRaw.WriteFooter(), ShouldBeNil)
+				So(raw.String(), ShouldEqual, decoded.String())
+			}
+		}
+	})
+}
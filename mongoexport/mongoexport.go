@@ -69,6 +69,9 @@ type MongoExport struct {
 
 	// Cached version of the collection info
 	collInfo *db.CollectionInfo
+
+	// maxDocSize is the parsed --maxDocSize, or 0 if it isn't set
+	maxDocSize int64
 }
 
 // ExportOutput is an interface that specifies how a document should be formatted
@@ -90,6 +93,12 @@ type ExportOutput interface {
 	Flush() error
 }
 
+// rawExportOutput is implemented by the outputs that can write a document
+// straight from the BSON returned by the server, without decoding it first.
+type rawExportOutput interface {
+	ExportRaw(bson.Raw) error
+}
+
 // New constructs a new MongoExport instance from the provided options.
 func New(opts Options) (*MongoExport, error) {
 	exporter := &MongoExport{
@@ -205,6 +214,73 @@ func (exp *MongoExport) validateSettings() error {
 			return err
 		}
 	}
+
+	if exp.InputOpts != nil && exp.InputOpts.Hint != "" {
+		if exp.InputOpts.ForceTableScan {
+			return fmt.Errorf("cannot use --forceTableScan when specifying --hint")
+		}
+		_, err := getHintFromArg(exp.InputOpts.Hint)
+		if err != nil {
+			return err
+		}
+	}
+
+	if exp.InputOpts != nil && exp.InputOpts.BatchSize < 0 {
+		return fmt.Errorf("--batchSize cannot be negative")
+	}
+
+	if exp.InputOpts != nil && exp.InputOpts.SinceField != "" {
+		if exp.InputOpts.Since == "" && exp.InputOpts.SinceStateFile == "" {
+			return fmt.Errorf("--sinceField requires --since or --sinceStateFile")
+		}
+		if exp.InputOpts.Since != "" {
+			if _, err := parseSinceTime(exp.InputOpts.Since); err != nil {
+				return err
+			}
+		}
+		if exp.InputOpts.SinceStateFile != "" && (exp.InputOpts.Limit != 0 || exp.InputOpts.Skip != 0) {
+			// the recorded value would come from a part of the documents
+			// and later runs would never export the others
+			return fmt.Errorf("cannot use --limit or --skip with --sinceStateFile")
+		}
+		if exp.InputOpts.SinceStateFile != "" && exp.OutputOpts.Fields != "" {
+			topLevel := strings.Split(exp.InputOpts.SinceField, ".")[0]
+			if _, ok := makeFieldSelector(exp.OutputOpts.Fields)[topLevel]; !ok {
+				return fmt.Errorf("--fields must include --sinceField '%v' when using --sinceStateFile", exp.InputOpts.SinceField)
+			}
+		}
+	} else if exp.InputOpts != nil && (exp.InputOpts.Since != "" || exp.InputOpts.SinceStateFile != "") {
+		return fmt.Errorf("--since and --sinceStateFile require --sinceField")
+	}
+
+	if exp.InputOpts != nil && exp.InputOpts.PaginateBy != "" {
+		if exp.InputOpts.Sort != "" {
+			return fmt.Errorf("cannot use --sort with --paginateBy, which sets the sort order")
+		}
+		if exp.InputOpts.SinceField != "" {
+			return fmt.Errorf("cannot use --sinceField with --paginateBy")
+		}
+		if exp.InputOpts.StateFile != "" && exp.InputOpts.Skip != 0 {
+			// the skipped documents would be behind the recorded key
+			return fmt.Errorf("cannot use --skip with --stateFile")
+		}
+		if exp.InputOpts.StateFile != "" && exp.OutputOpts.Fields != "" {
+			topLevel := strings.Split(exp.InputOpts.PaginateBy, ".")[0]
+			if _, ok := makeFieldSelector(exp.OutputOpts.Fields)[topLevel]; !ok {
+				return fmt.Errorf("--fields must include --paginateBy '%v' when using --stateFile", exp.InputOpts.PaginateBy)
+			}
+		}
+	} else if exp.InputOpts != nil && exp.InputOpts.StateFile != "" {
+		return fmt.Errorf("--stateFile requires --paginateBy")
+	}
+
+	if exp.OutputOpts.MaxDocSize != "" {
+		if exp.maxDocSize, err = parseMaxDocSize(exp.OutputOpts.MaxDocSize); err != nil {
+			return err
+		}
+	} else if exp.OutputOpts.OversizeFile != "" {
+		return fmt.Errorf("--oversizeFile requires --maxDocSize")
+	}
 	return nil
 }
 
@@ -266,7 +342,7 @@ func (exp *MongoExport) getCount() (int64, error) {
 	if exp.InputOpts != nil && exp.InputOpts.Limit != 0 {
 		return exp.InputOpts.Limit, nil
 	}
-	if exp.InputOpts != nil && exp.InputOpts.Query != "" {
+	if exp.InputOpts != nil && (exp.InputOpts.Query != "" || exp.InputOpts.SinceField != "" || exp.InputOpts.StateFile != "") {
 		return 0, nil
 	}
 	coll := session.Database(exp.ToolOptions.Namespace.DB).Collection(exp.ToolOptions.Namespace.Collection)
@@ -307,6 +383,9 @@ func (exp *MongoExport) getCursor() (*mongo.Cursor, error) {
 
 		findOpts.SetSort(sortD)
 	}
+	if exp.InputOpts != nil && exp.InputOpts.PaginateBy != "" {
+		findOpts.SetSort(exp.getPaginateSort())
+	}
 
 	query := bson.D{}
 	if exp.InputOpts != nil && exp.InputOpts.HasQuery() {
@@ -320,6 +399,14 @@ func (exp *MongoExport) getCursor() (*mongo.Cursor, error) {
 			return nil, fmt.Errorf("error parsing query as Extended JSON: %v", err)
 		}
 	}
+	query, err := exp.addSinceFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	query, err = exp.addPaginateFilter(query)
+	if err != nil {
+		return nil, err
+	}
 
 	session, err := exp.SessionProvider.GetSession()
 	if err != nil {
@@ -343,9 +430,19 @@ func (exp *MongoExport) getCursor() (*mongo.Cursor, error) {
 	// --forceTableScan.
 	shouldHintId := isMMAPV1 && (exp.InputOpts == nil || !exp.InputOpts.ForceTableScan)
 	// noSorting is true if the user did not ask for sorting.
-	noSorting := exp.InputOpts == nil || exp.InputOpts.Sort == ""
+	noSorting := exp.InputOpts == nil || (exp.InputOpts.Sort == "" && exp.InputOpts.PaginateBy == "")
 	coll := intendedDB.Collection(exp.ToolOptions.Namespace.Collection)
 
+	// a hint given by the user always takes precedence.
+	if exp.InputOpts != nil && exp.InputOpts.Hint != "" {
+		hint, err := getHintFromArg(exp.InputOpts.Hint)
+		if err != nil {
+			return nil, err
+		}
+		findOpts.SetHint(hint)
+		shouldHintId = false
+	}
+
 	// we want to hint _id if shouldHintId is true, and there is no query, and
 	// there is no sorting, as hinting is not needed if there is a query or sorting.
 	// we also do not want to hint for system collections or views.
@@ -365,6 +462,12 @@ func (exp *MongoExport) getCursor() (*mongo.Cursor, error) {
 	if exp.InputOpts != nil {
 		findOpts.SetLimit(exp.InputOpts.Limit)
 	}
+	if exp.InputOpts != nil && exp.InputOpts.BatchSize > 0 {
+		findOpts.SetBatchSize(exp.InputOpts.BatchSize)
+	}
+	if exp.InputOpts != nil && exp.InputOpts.NoCursorTimeout {
+		findOpts.SetNoCursorTimeout(true)
+	}
 
 	if len(exp.OutputOpts.Fields) > 0 {
 		findOpts.SetProjection(makeFieldSelector(exp.OutputOpts.Fields))
@@ -409,6 +512,17 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 		return 0, err
 	}
 
+	if exp.InputOpts != nil && exp.InputOpts.SinceField != "" {
+		if err = exp.verifySinceFieldIndexed(); err != nil {
+			return 0, err
+		}
+	}
+	if exp.InputOpts != nil && exp.InputOpts.PaginateBy != "" {
+		if err = exp.verifyFieldIndexed(exp.InputOpts.PaginateBy, "--paginateBy"); err != nil {
+			return 0, err
+		}
+	}
+
 	max, err := exp.getCount()
 	if err != nil {
 		return 0, err
@@ -438,18 +552,47 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 		return 0, err
 	}
 
+	oversize, err := exp.newOversizeFilter()
+	if err != nil {
+		return 0, err
+	}
+	defer oversize.Close()
+
 	docsCount := int64(0)
+	since := exp.newSinceTracker()
+	page := exp.newPaginateTracker()
 
 	// Write document content
 	for cursor.Next(nil) {
-		var result bson.D
-		if err := cursor.Decode(&result); err != nil {
-			return docsCount, err
+		if since != nil {
+			since.observe(cursor.Current)
+		}
+		if page != nil {
+			if err := page.observe(cursor.Current); err != nil {
+				return docsCount, err
+			}
+		}
+		// skipped documents are recorded, so they count towards the
+		// --sinceStateFile and --stateFile progress all the same
+		if skipped, err := oversize.skip(cursor.Current); err != nil || skipped {
+			if err != nil {
+				return docsCount, err
+			}
+			continue
 		}
 
-		err := exportOutput.ExportDocument(result)
-		if err != nil {
-			return docsCount, err
+		if rawOutput, ok := exportOutput.(rawExportOutput); ok {
+			if err := rawOutput.ExportRaw(cursor.Current); err != nil {
+				return docsCount, err
+			}
+		} else {
+			var result bson.D
+			if err := cursor.Decode(&result); err != nil {
+				return docsCount, err
+			}
+			if err := exportOutput.ExportDocument(result); err != nil {
+				return docsCount, err
+			}
 		}
 		docsCount++
 		if docsCount%watchProgressorUpdateFrequency == 0 {
@@ -467,6 +610,17 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 		return docsCount, err
 	}
 	exportOutput.Flush()
+	if err = oversize.Close(); err != nil {
+		return docsCount, err
+	}
+
+	// only record progress once everything up to it has been written
+	if err = exp.saveSinceState(since); err != nil {
+		return docsCount, err
+	}
+	if err = exp.savePaginateState(page); err != nil {
+		return docsCount, err
+	}
 	return docsCount, nil
 }
 
@@ -540,3 +694,20 @@ func getSortFromArg(queryRaw string) (bson.D, error) {
 	// TODO: verify sort specification before returning a nil error
 	return parsedJSON, nil
 }
+
+// getHintFromArg takes a hint given either as an index name or as an index key
+// pattern in JSON, and returns it in the form accepted by the find command.
+func getHintFromArg(hintRaw string) (interface{}, error) {
+	if !strings.HasPrefix(strings.TrimSpace(hintRaw), "{") {
+		return hintRaw, nil
+	}
+	keys := bson.D{}
+	err := json.Unmarshal([]byte(hintRaw), &keys)
+	if err != nil {
+		return nil, fmt.Errorf("hint '%v' is not valid JSON: %v", hintRaw, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("hint '%v' must name at least one key", hintRaw)
+	}
+	return keys, nil
+}
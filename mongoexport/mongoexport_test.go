@@ -243,3 +243,40 @@ func TestMongoExportTOOLS1952(t *testing.T) {
 		}
 	})
 }
+
+func TestHintArg(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Using getHintFromArg should accept index names and key patterns", t, func() {
+		hint, err := getHintFromArg("status_1")
+		So(err, ShouldBeNil)
+		So(hint, ShouldEqual, "status_1")
+
+		hint, err = getHintFromArg("{status: 1, updated: -1}")
+		So(err, ShouldBeNil)
+		So(hint, ShouldHaveLength, 2)
+		So(hint.(bson.D)[0].Key, ShouldEqual, "status")
+		So(hint.(bson.D)[1].Key, ShouldEqual, "updated")
+
+		_, err = getHintFromArg("{status: ")
+		So(err, ShouldNotBeNil)
+		_, err = getHintFromArg("{}")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("--hint can't be used with --forceTableScan", t, func() {
+		opts := simpleMongoExportOpts()
+		exp := &MongoExport{
+			ToolOptions: opts.ToolOptions,
+			OutputOpts:  opts.OutputFormatOptions,
+			InputOpts:   opts.InputOptions,
+		}
+		exp.InputOpts.Hint = "{status: 1}"
+		So(exp.validateSettings(), ShouldBeNil)
+		exp.InputOpts.ForceTableScan = true
+		So(exp.validateSettings(), ShouldNotBeNil)
+		exp.InputOpts.ForceTableScan = false
+		exp.InputOpts.BatchSize = -1
+		So(exp.validateSettings(), ShouldNotBeNil)
+	})
+}
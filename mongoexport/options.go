@@ -51,6 +51,12 @@ type OutputFormatOptions struct {
 
 	// JSONFormat specifies what extended JSON format to export (canonical or relaxed). Defaults to relaxed.
 	JSONFormat JSONFormat `long:"jsonFormat" value-name:"<type>" default:"relaxed" description:"the extended JSON format to output, either canonical or relaxed (defaults to 'relaxed')"`
+
+	// MaxDocSize, if set, skips documents whose BSON size is above it, e.g. "1MB".
+	MaxDocSize string `long:"maxDocSize" value-name:"<size>" description:"skip documents whose BSON size is larger than this, e.g. '1MB' or '256KB'; the _id of each skipped document is logged"`
+
+	// OversizeFile is where documents skipped by --maxDocSize are written.
+	OversizeFile string `long:"oversizeFile" value-name:"<filename>" description:"file to which documents skipped by --maxDocSize are written, one canonical extended JSON document per line"`
 }
 
 // Name returns a human-readable group name for output format options.
@@ -60,15 +66,23 @@ func (*OutputFormatOptions) Name() string {
 
 // InputOptions defines the set of options to use in retrieving data from the server.
 type InputOptions struct {
-	Query          string `long:"query" value-name:"<json>" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
-	QueryFile      string `long:"queryFile" value-name:"<filename>" description:"path to a file containing a query filter (JSON)"`
-	SlaveOk        bool   `long:"slaveOk" short:"k" hidden:"true" description:"allow secondary reads if available" default-mask:"-"`
-	ReadPreference string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference mode (e.g. 'nearest') or a preference json object (e.g. '{mode: \"nearest\", tagSets: [{a: \"b\"}], maxStalenessSeconds: 123}')"`
-	ForceTableScan bool   `long:"forceTableScan" description:"force a table scan (do not use $snapshot or hint _id). Deprecated since this is default behavior on WiredTiger"`
-	Skip           int64  `long:"skip" value-name:"<count>" description:"number of documents to skip"`
-	Limit          int64  `long:"limit" value-name:"<count>" description:"limit the number of documents to export"`
-	Sort           string `long:"sort" value-name:"<json>" description:"sort order, as a JSON string, e.g. '{x:1}'"`
-	AssertExists   bool   `long:"assertExists" description:"if specified, export fails if the collection does not exist"`
+	Query           string `long:"query" value-name:"<json>" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
+	QueryFile       string `long:"queryFile" value-name:"<filename>" description:"path to a file containing a query filter (JSON)"`
+	SlaveOk         bool   `long:"slaveOk" short:"k" hidden:"true" description:"allow secondary reads if available" default-mask:"-"`
+	ReadPreference  string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference mode (e.g. 'nearest') or a preference json object (e.g. '{mode: \"nearest\", tagSets: [{a: \"b\"}], maxStalenessSeconds: 123}')"`
+	ForceTableScan  bool   `long:"forceTableScan" description:"force a table scan (do not use $snapshot or hint _id). Deprecated since this is default behavior on WiredTiger"`
+	Skip            int64  `long:"skip" value-name:"<count>" description:"number of documents to skip"`
+	Limit           int64  `long:"limit" value-name:"<count>" description:"limit the number of documents to export"`
+	Sort            string `long:"sort" value-name:"<json>" description:"sort order, as a JSON string, e.g. '{x:1}'"`
+	AssertExists    bool   `long:"assertExists" description:"if specified, export fails if the collection does not exist"`
+	Hint            string `long:"hint" value-name:"<index>" description:"index to use for the query, either an index name or a key pattern as a JSON string, e.g. 'status_1' or '{status:1}'"`
+	BatchSize       int32  `long:"batchSize" value-name:"<count>" description:"number of documents to return in each batch of the cursor; if not specified, the server default is used"`
+	NoCursorTimeout bool   `long:"noCursorTimeout" description:"prevent the server from timing out the cursor after a period of inactivity"`
+	Since           string `long:"since" value-name:"<time>" description:"export only documents whose --sinceField is at or after this time, e.g. '2020-01-31T12:00:00Z' or '2020-01-31'"`
+	SinceField      string `long:"sinceField" value-name:"<field>" description:"indexed date field compared against --since or the value recorded in --sinceStateFile, e.g. updatedAt"`
+	SinceStateFile  string `long:"sinceStateFile" value-name:"<filename>" description:"file recording the largest --sinceField value exported; if it exists, only documents with a larger value are exported and --since is ignored, so documents written later with a value at or below it are missed; cannot be used with --limit or --skip"`
+	PaginateBy      string `long:"paginateBy" value-name:"<field>" description:"indexed field to sort the export by, with ties broken by _id, so that every run exports documents in the same order; the field must be present in every document with values of a single type"`
+	StateFile       string `long:"stateFile" value-name:"<filename>" description:"file recording the last --paginateBy key exported; if it exists, only documents after it are exported; cannot be used with --skip"`
 }
 
 // Name returns a human-readable group name for input options.
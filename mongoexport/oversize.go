@@ -0,0 +1,119 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/text"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// oversizeFilter skips documents larger than --maxDocSize, so that the
+// export can feed systems with a hard limit on message size. Skipped
+// documents are written to --oversizeFile, if set.
+type oversizeFilter struct {
+	maxSize int64
+	out     *bufio.Writer
+	closer  io.Closer
+	skipped int64
+	closed  bool
+}
+
+// newOversizeFilter returns a filter for --maxDocSize, or nil if it isn't
+// set. The caller must close the filter.
+func (exp *MongoExport) newOversizeFilter() (*oversizeFilter, error) {
+	if exp.maxDocSize == 0 {
+		return nil, nil
+	}
+	filter := &oversizeFilter{maxSize: exp.maxDocSize}
+	if path := exp.OutputOpts.OversizeFile; path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return nil, fmt.Errorf("error creating directory for --oversizeFile: %v", err)
+		}
+		file, err := os.Create(util.ToUniversalPath(path))
+		if err != nil {
+			return nil, fmt.Errorf("error creating --oversizeFile: %v", err)
+		}
+		filter.setOutput(file)
+	}
+	return filter, nil
+}
+
+func (f *oversizeFilter) setOutput(w io.WriteCloser) {
+	f.out = bufio.NewWriter(w)
+	f.closer = w
+}
+
+// skip returns true if doc is too large to export, after recording it.
+func (f *oversizeFilter) skip(doc bson.Raw) (bool, error) {
+	if f == nil || int64(len(doc)) <= f.maxSize {
+		return false, nil
+	}
+	f.skipped++
+	id, err := doc.LookupErr("_id")
+	if err == nil {
+		log.Logvf(log.Info, "skipping document with _id %v: its size of %v is over --maxDocSize",
+			id, text.FormatByteAmount(int64(len(doc))))
+	} else {
+		log.Logvf(log.Info, "skipping document without an _id: its size of %v is over --maxDocSize",
+			text.FormatByteAmount(int64(len(doc))))
+	}
+	if f.out == nil {
+		return true, nil
+	}
+	data, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		return true, fmt.Errorf("error converting oversize document to JSON: %v", err)
+	}
+	if _, err = f.out.Write(append(data, '\n')); err != nil {
+		return true, fmt.Errorf("error writing to --oversizeFile: %v", err)
+	}
+	return true, nil
+}
+
+// Close flushes the skipped documents and logs how many there were. Only
+// the first call has any effect.
+func (f *oversizeFilter) Close() error {
+	if f == nil || f.closed {
+		return nil
+	}
+	f.closed = true
+	if f.skipped > 0 {
+		log.Logvf(log.Always, "skipped %v %v larger than --maxDocSize of %v",
+			f.skipped, util.Pluralize(int(f.skipped), "document", "documents"), text.FormatByteAmount(f.maxSize))
+	}
+	if f.out == nil {
+		return nil
+	}
+	err := f.out.Flush()
+	if closeErr := f.closer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing to --oversizeFile: %v", err)
+	}
+	return nil
+}
+
+// parseMaxDocSize parses --maxDocSize, which must be positive.
+func parseMaxDocSize(size string) (int64, error) {
+	maxSize, err := text.ParseByteAmount(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --maxDocSize: %v", err)
+	}
+	if maxSize <= 0 {
+		return 0, fmt.Errorf("--maxDocSize must be positive")
+	}
+	return maxSize, nil
+}
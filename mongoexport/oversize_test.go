@@ -0,0 +1,94 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMaxDocSize(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a mongoexport limited by --maxDocSize", t, func() {
+		dir, err := ioutil.TempDir("", "mongoexport_oversize_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		opts := simpleMongoExportOpts()
+		exp := &MongoExport{
+			ToolOptions: opts.ToolOptions,
+			OutputOpts:  opts.OutputFormatOptions,
+			InputOpts:   opts.InputOptions,
+		}
+
+		Convey("the size is parsed and must be positive", func() {
+			exp.OutputOpts.MaxDocSize = "1KB"
+			So(exp.validateSettings(), ShouldBeNil)
+			So(exp.maxDocSize, ShouldEqual, 1024)
+
+			exp.OutputOpts.MaxDocSize = "0"
+			So(exp.validateSettings(), ShouldNotBeNil)
+			exp.OutputOpts.MaxDocSize = "big"
+			So(exp.validateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("--oversizeFile requires --maxDocSize", func() {
+			exp.OutputOpts.OversizeFile = filepath.Join(dir, "oversize.json")
+			So(exp.validateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("documents over the limit are skipped and written to --oversizeFile", func() {
+			exp.OutputOpts.MaxDocSize = "100"
+			exp.OutputOpts.OversizeFile = filepath.Join(dir, "out", "oversize.json")
+			So(exp.validateSettings(), ShouldBeNil)
+
+			filter, err := exp.newOversizeFilter()
+			So(err, ShouldBeNil)
+
+			small, err := bson.Marshal(bson.D{{"_id", 1}, {"x", "small"}})
+			So(err, ShouldBeNil)
+			large, err := bson.Marshal(bson.D{{"_id", 2}, {"x", strings.Repeat("a", 100)}})
+			So(err, ShouldBeNil)
+
+			skipped, err := filter.skip(small)
+			So(err, ShouldBeNil)
+			So(skipped, ShouldBeFalse)
+			skipped, err = filter.skip(large)
+			So(err, ShouldBeNil)
+			So(skipped, ShouldBeTrue)
+			So(filter.Close(), ShouldBeNil)
+			So(filter.Close(), ShouldBeNil)
+
+			data, err := ioutil.ReadFile(exp.OutputOpts.OversizeFile)
+			So(err, ShouldBeNil)
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+			So(len(lines), ShouldEqual, 1)
+			var doc bson.D
+			So(bson.UnmarshalExtJSON([]byte(lines[0]), true, &doc), ShouldBeNil)
+			So(doc[0].Value, ShouldEqual, 2)
+		})
+
+		Convey("no filter is used without --maxDocSize", func() {
+			So(exp.validateSettings(), ShouldBeNil)
+			filter, err := exp.newOversizeFilter()
+			So(err, ShouldBeNil)
+			So(filter, ShouldBeNil)
+			skipped, err := filter.skip(bson.Raw{})
+			So(err, ShouldBeNil)
+			So(skipped, ShouldBeFalse)
+			So(filter.Close(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,126 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// paginateState is the contents of a --stateFile: the sort key of the last
+// document exported by the last run.
+type paginateState struct {
+	Namespace string        `bson:"namespace"`
+	Field     string        `bson:"field"`
+	LastKey   bson.RawValue `bson:"lastKey"`
+	LastID    bson.RawValue `bson:"lastId"`
+}
+
+// getPaginateSort returns the sort order for --paginateBy. Documents with
+// the same value of the field are ordered by _id, so that the order doesn't
+// depend on how the server happens to scan them.
+func (exp *MongoExport) getPaginateSort() bson.D {
+	field := exp.InputOpts.PaginateBy
+	if field == "_id" {
+		return bson.D{{"_id", 1}}
+	}
+	return bson.D{{field, 1}, {"_id", 1}}
+}
+
+// getPaginateFilter returns the query condition selecting the documents
+// after the last one recorded in --stateFile, or nil if there is no state
+// yet and every document should be exported.
+func (exp *MongoExport) getPaginateFilter() (bson.D, error) {
+	if exp.InputOpts.StateFile == "" {
+		return nil, nil
+	}
+	state := &paginateState{}
+	found, err := util.NewStateFile(exp.InputOpts.StateFile, "pagination").Read(state)
+	if err != nil || !found {
+		return nil, err
+	}
+	field := exp.InputOpts.PaginateBy
+	if state.Field != field || state.Namespace != exp.namespace() {
+		return nil, fmt.Errorf("pagination state %v is for field '%v' of %v, not '%v' of %v",
+			exp.InputOpts.StateFile, state.Field, state.Namespace, field, exp.namespace())
+	}
+	if field == "_id" {
+		return bson.D{{"_id", bson.D{{"$gt", state.LastID}}}}, nil
+	}
+	return bson.D{{"$or", bson.A{
+		bson.D{{field, bson.D{{"$gt", state.LastKey}}}},
+		bson.D{{field, state.LastKey}, {"_id", bson.D{{"$gt", state.LastID}}}},
+	}}}, nil
+}
+
+// addPaginateFilter combines the query with the --stateFile condition, if
+// any.
+func (exp *MongoExport) addPaginateFilter(query bson.D) (bson.D, error) {
+	if exp.InputOpts == nil || exp.InputOpts.PaginateBy == "" {
+		return query, nil
+	}
+	paginateFilter, err := exp.getPaginateFilter()
+	if err != nil || paginateFilter == nil {
+		return query, err
+	}
+	if len(query) == 0 {
+		return paginateFilter, nil
+	}
+	return bson.D{{"$and", bson.A{query, paginateFilter}}}, nil
+}
+
+// paginateTracker records the sort key of the last document exported.
+type paginateTracker struct {
+	path    []string
+	lastKey bson.RawValue
+	lastID  bson.RawValue
+}
+
+// observe records the sort key of doc, which comes after every document
+// observed before it. Documents without the field can't be placed in the
+// order, so they are an error.
+func (t *paginateTracker) observe(doc bson.Raw) error {
+	id, err := doc.LookupErr("_id")
+	if err != nil {
+		return fmt.Errorf("document without an _id can't be exported with --paginateBy")
+	}
+	key, err := doc.LookupErr(t.path...)
+	if err != nil {
+		return fmt.Errorf("document with _id %v has no --paginateBy field '%v'", id, strings.Join(t.path, "."))
+	}
+	// the cursor reuses the document's buffer
+	t.lastKey = bson.RawValue{Type: key.Type, Value: append([]byte(nil), key.Value...)}
+	t.lastID = bson.RawValue{Type: id.Type, Value: append([]byte(nil), id.Value...)}
+	return nil
+}
+
+// newPaginateTracker returns a tracker for --paginateBy if --stateFile is
+// set, and nil otherwise.
+func (exp *MongoExport) newPaginateTracker() *paginateTracker {
+	if exp.InputOpts == nil || exp.InputOpts.StateFile == "" {
+		return nil
+	}
+	return &paginateTracker{path: strings.Split(exp.InputOpts.PaginateBy, ".")}
+}
+
+// savePaginateState records the last key exported in --stateFile. The file
+// is left untouched if no documents were exported.
+func (exp *MongoExport) savePaginateState(t *paginateTracker) error {
+	if t == nil || t.lastID.Type == 0 {
+		return nil
+	}
+	state := &paginateState{
+		Namespace: exp.namespace(),
+		Field:     exp.InputOpts.PaginateBy,
+		LastKey:   t.lastKey,
+		LastID:    t.lastID,
+	}
+	return util.NewStateFile(exp.InputOpts.StateFile, "pagination").Write(state)
+}
@@ -0,0 +1,106 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPaginateBy(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a mongoexport paginated by a field", t, func() {
+		dir, err := ioutil.TempDir("", "mongoexport_paginate_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		opts := simpleMongoExportOpts()
+		exp := &MongoExport{
+			ToolOptions: opts.ToolOptions,
+			OutputOpts:  opts.OutputFormatOptions,
+			InputOpts:   opts.InputOptions,
+		}
+		exp.InputOpts.PaginateBy = "seq"
+		exp.InputOpts.StateFile = filepath.Join(dir, "state.json")
+
+		Convey("documents are sorted by the field and then _id", func() {
+			So(exp.validateSettings(), ShouldBeNil)
+			So(exp.getPaginateSort(), ShouldResemble, bson.D{{"seq", 1}, {"_id", 1}})
+
+			exp.InputOpts.PaginateBy = "_id"
+			So(exp.getPaginateSort(), ShouldResemble, bson.D{{"_id", 1}})
+		})
+
+		Convey("the first run exports every document", func() {
+			query, err := exp.addPaginateFilter(bson.D{{"x", 1}})
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, bson.D{{"x", 1}})
+		})
+
+		Convey("the next run starts after the last document exported", func() {
+			tracker := exp.newPaginateTracker()
+			for _, seq := range []int32{1, 2, 2} {
+				doc, err := bson.Marshal(bson.D{{"_id", seq * 10}, {"seq", seq}})
+				So(err, ShouldBeNil)
+				So(tracker.observe(doc), ShouldBeNil)
+			}
+			So(exp.savePaginateState(tracker), ShouldBeNil)
+
+			query, err := exp.addPaginateFilter(bson.D{})
+			So(err, ShouldBeNil)
+			So(query, ShouldHaveLength, 1)
+			So(query[0].Key, ShouldEqual, "$or")
+			branches := query[0].Value.(bson.A)
+			So(branches, ShouldHaveLength, 2)
+			after := branches[1].(bson.D)
+			So(after[0].Key, ShouldEqual, "seq")
+			So(after[0].Value.(bson.RawValue).Int32(), ShouldEqual, 2)
+			So(after[1].Value.(bson.D)[0].Value.(bson.RawValue).Int32(), ShouldEqual, 20)
+
+			Convey("but not by an export paginated by a different field", func() {
+				exp.InputOpts.PaginateBy = "other"
+				_, err := exp.addPaginateFilter(bson.D{})
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("documents without the field are an error", func() {
+			tracker := exp.newPaginateTracker()
+			doc, err := bson.Marshal(bson.D{{"_id", 1}})
+			So(err, ShouldBeNil)
+			So(tracker.observe(doc), ShouldNotBeNil)
+		})
+
+		Convey("invalid combinations of options are rejected", func() {
+			exp.InputOpts.Sort = "{x:1}"
+			So(exp.validateSettings(), ShouldNotBeNil)
+			exp.InputOpts.Sort = ""
+
+			exp.OutputOpts.Fields = "name"
+			So(exp.validateSettings(), ShouldNotBeNil)
+			exp.OutputOpts.Fields = "name,seq"
+			So(exp.validateSettings(), ShouldBeNil)
+
+			exp.InputOpts.Skip = 10
+			So(exp.validateSettings(), ShouldNotBeNil)
+			exp.InputOpts.Skip = 0
+			exp.InputOpts.Limit = 10
+			So(exp.validateSettings(), ShouldBeNil)
+			exp.InputOpts.Limit = 0
+
+			exp.InputOpts.PaginateBy = ""
+			So(exp.validateSettings(), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,197 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/bsonutil"
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sinceTimeLayouts are the formats accepted by --since, tried in order.
+var sinceTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// sinceState is the contents of a --sinceStateFile: the largest value of
+// --sinceField exported by the last run.
+type sinceState struct {
+	Namespace string        `bson:"namespace"`
+	Field     string        `bson:"field"`
+	Max       bson.RawValue `bson:"max"`
+}
+
+// parseSinceTime parses a --since argument. Times without a zone are in UTC.
+func parseSinceTime(since string) (time.Time, error) {
+	for _, layout := range sinceTimeLayouts {
+		if t, err := time.Parse(layout, since); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since time '%v'; use a time such as '2006-01-02T15:04:05Z' or a date such as '2006-01-02'", since)
+}
+
+// loadSinceState reads the --sinceStateFile, returning nil if it doesn't
+// exist yet.
+func loadSinceState(path string) (*sinceState, error) {
+	state := &sinceState{}
+	found, err := util.NewStateFile(path, "since").Read(state)
+	if err != nil || !found {
+		return nil, err
+	}
+	return state, nil
+}
+
+// save writes the state file atomically.
+func (s *sinceState) save(path string) error {
+	return util.NewStateFile(path, "since").Write(s)
+}
+
+// getSinceFilter returns the query condition selecting documents modified
+// since the last export, or nil if every document should be exported. The
+// value recorded in --sinceStateFile takes precedence over --since, so the
+// same command line can be used for the first and every later run.
+//
+// The recorded value is compared with $gt, so a later run misses documents
+// written after the last run with a --sinceField value at or below the
+// recorded one: those sharing the largest value exported, and late writes
+// with older values. --sinceField should increase with every write.
+func (exp *MongoExport) getSinceFilter() (bson.D, error) {
+	field := exp.InputOpts.SinceField
+	if exp.InputOpts.SinceStateFile != "" {
+		state, err := loadSinceState(exp.InputOpts.SinceStateFile)
+		if err != nil {
+			return nil, err
+		}
+		if state != nil {
+			if state.Field != field || state.Namespace != exp.namespace() {
+				return nil, fmt.Errorf("since state %v is for field '%v' of %v, not '%v' of %v",
+					exp.InputOpts.SinceStateFile, state.Field, state.Namespace, field, exp.namespace())
+			}
+			// documents with the recorded value were exported by the last run
+			return bson.D{{field, bson.D{{"$gt", state.Max}}}}, nil
+		}
+	}
+	if exp.InputOpts.Since == "" {
+		return nil, nil
+	}
+	since, err := parseSinceTime(exp.InputOpts.Since)
+	if err != nil {
+		return nil, err
+	}
+	return bson.D{{field, bson.D{{"$gte", primitive.NewDateTimeFromTime(since)}}}}, nil
+}
+
+// addSinceFilter combines the query with the --since condition, if any.
+func (exp *MongoExport) addSinceFilter(query bson.D) (bson.D, error) {
+	if exp.InputOpts == nil || exp.InputOpts.SinceField == "" {
+		return query, nil
+	}
+	sinceFilter, err := exp.getSinceFilter()
+	if err != nil || sinceFilter == nil {
+		return query, err
+	}
+	if len(query) == 0 {
+		return sinceFilter, nil
+	}
+	return bson.D{{"$and", bson.A{query, sinceFilter}}}, nil
+}
+
+// verifySinceFieldIndexed returns an error if no index on the collection
+// has --sinceField as its first key, since the range query would otherwise
+// scan the whole collection on every incremental export.
+func (exp *MongoExport) verifySinceFieldIndexed() error {
+	return exp.verifyFieldIndexed(exp.InputOpts.SinceField, "--sinceField")
+}
+
+// verifyFieldIndexed returns an error if no index on the collection has
+// field, given with option, as its first key.
+func (exp *MongoExport) verifyFieldIndexed(field, option string) error {
+	if exp.collInfo.IsView() {
+		return nil
+	}
+	session, err := exp.SessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	coll := session.Database(exp.ToolOptions.Namespace.DB).Collection(exp.ToolOptions.Namespace.Collection)
+	cursor, err := db.GetIndexes(coll)
+	if err != nil {
+		return fmt.Errorf("error listing indexes of %v: %v", exp.namespace(), err)
+	}
+	defer cursor.Close(nil)
+	for cursor.Next(nil) {
+		var index struct {
+			Key bson.D `bson:"key"`
+		}
+		if err = cursor.Decode(&index); err != nil {
+			return fmt.Errorf("error reading indexes of %v: %v", exp.namespace(), err)
+		}
+		if len(index.Key) > 0 && index.Key[0].Key == field {
+			return nil
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return fmt.Errorf("error listing indexes of %v: %v", exp.namespace(), err)
+	}
+	return fmt.Errorf("no index on %v starts with %v '%v'", exp.namespace(), option, field)
+}
+
+// sinceTracker records the largest value of --sinceField among the exported
+// documents.
+type sinceTracker struct {
+	path []string
+	max  bson.RawValue
+}
+
+// observe updates the largest value seen with the field of doc, if present.
+func (t *sinceTracker) observe(doc bson.Raw) {
+	value, err := doc.LookupErr(t.path...)
+	if err != nil {
+		return
+	}
+	if t.max.Type == 0 || bsonutil.CompareValues(value, t.max) > 0 {
+		// the cursor reuses the document's buffer
+		t.max = bson.RawValue{Type: value.Type, Value: append([]byte(nil), value.Value...)}
+	}
+}
+
+// newSinceTracker returns a tracker for --sinceField if --sinceStateFile is
+// set, and nil otherwise.
+func (exp *MongoExport) newSinceTracker() *sinceTracker {
+	if exp.InputOpts == nil || exp.InputOpts.SinceStateFile == "" {
+		return nil
+	}
+	return &sinceTracker{path: strings.Split(exp.InputOpts.SinceField, ".")}
+}
+
+// saveSinceState records the largest value exported in --sinceStateFile. The
+// file is left untouched if no documents with the field were exported.
+func (exp *MongoExport) saveSinceState(t *sinceTracker) error {
+	if t == nil || t.max.Type == 0 {
+		return nil
+	}
+	state := &sinceState{
+		Namespace: exp.namespace(),
+		Field:     exp.InputOpts.SinceField,
+		Max:       t.max,
+	}
+	return state.save(exp.InputOpts.SinceStateFile)
+}
+
+// namespace returns the namespace being exported.
+func (exp *MongoExport) namespace() string {
+	return exp.ToolOptions.Namespace.DB + "." + exp.ToolOptions.Namespace.Collection
+}
@@ -0,0 +1,120 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseSinceTime(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("--since accepts times and dates", t, func() {
+		since, err := parseSinceTime("2020-01-31T12:30:00+01:00")
+		So(err, ShouldBeNil)
+		So(since.UTC(), ShouldResemble, time.Date(2020, 1, 31, 11, 30, 0, 0, time.UTC))
+
+		since, err = parseSinceTime("2020-01-31")
+		So(err, ShouldBeNil)
+		So(since, ShouldResemble, time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC))
+
+		_, err = parseSinceTime("yesterday")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestSinceFilter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a mongoexport of documents modified since a time", t, func() {
+		dir, err := ioutil.TempDir("", "mongoexport_since_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		opts := simpleMongoExportOpts()
+		exp := &MongoExport{
+			ToolOptions: opts.ToolOptions,
+			OutputOpts:  opts.OutputFormatOptions,
+			InputOpts:   opts.InputOptions,
+		}
+		exp.InputOpts.SinceField = "updatedAt"
+		exp.InputOpts.Since = "2020-01-31"
+		exp.InputOpts.SinceStateFile = filepath.Join(dir, "state.json")
+		since := primitive.NewDateTimeFromTime(time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC))
+
+		Convey("the query selects documents at or after --since", func() {
+			So(exp.validateSettings(), ShouldBeNil)
+			query, err := exp.addSinceFilter(bson.D{})
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, bson.D{{"updatedAt", bson.D{{"$gte", since}}}})
+
+			query, err = exp.addSinceFilter(bson.D{{"x", 1}})
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, bson.D{{"$and", bson.A{
+				bson.D{{"x", 1}},
+				bson.D{{"updatedAt", bson.D{{"$gte", since}}}},
+			}}})
+		})
+
+		Convey("the largest value exported is used by the next run", func() {
+			tracker := exp.newSinceTracker()
+			for _, day := range []int{3, 5, 4} {
+				doc, err := bson.Marshal(bson.D{{"updatedAt", time.Date(2020, 2, day, 0, 0, 0, 0, time.UTC)}})
+				So(err, ShouldBeNil)
+				tracker.observe(doc)
+			}
+			doc, err := bson.Marshal(bson.D{{"other", 1}})
+			So(err, ShouldBeNil)
+			tracker.observe(doc)
+			So(exp.saveSinceState(tracker), ShouldBeNil)
+
+			query, err := exp.addSinceFilter(bson.D{})
+			So(err, ShouldBeNil)
+			So(query, ShouldHaveLength, 1)
+			So(query[0].Key, ShouldEqual, "updatedAt")
+			bound := query[0].Value.(bson.D)[0]
+			So(bound.Key, ShouldEqual, "$gt")
+			So(bound.Value.(bson.RawValue).Time().Equal(time.Date(2020, 2, 5, 0, 0, 0, 0, time.UTC)), ShouldBeTrue)
+
+			Convey("but not by an export of a different field", func() {
+				exp.InputOpts.SinceField = "createdAt"
+				_, err := exp.addSinceFilter(bson.D{})
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("invalid combinations of options are rejected", func() {
+			exp.InputOpts.Since = "last week"
+			So(exp.validateSettings(), ShouldNotBeNil)
+
+			exp.InputOpts.Since = ""
+			exp.OutputOpts.Fields = "name"
+			So(exp.validateSettings(), ShouldNotBeNil)
+			exp.OutputOpts.Fields = "name,updatedAt"
+			So(exp.validateSettings(), ShouldBeNil)
+
+			exp.InputOpts.Limit = 10
+			So(exp.validateSettings(), ShouldNotBeNil)
+			exp.InputOpts.Limit = 0
+			exp.InputOpts.Skip = 10
+			So(exp.validateSettings(), ShouldNotBeNil)
+			exp.InputOpts.Skip = 0
+
+			exp.InputOpts.SinceField = ""
+			So(exp.validateSettings(), ShouldNotBeNil)
+		})
+	})
+}
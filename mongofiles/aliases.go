@@ -0,0 +1,90 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// parseAliases reads the aliases given by --aliasesField for 'put'.
+func (mf *MongoFiles) parseAliases() {
+	mf.aliases = nil
+	for _, value := range mf.StorageOptions.Aliases {
+		for _, alias := range strings.Split(value, ",") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				mf.aliases = append(mf.aliases, alias)
+			}
+		}
+	}
+}
+
+// nameQuery returns a query matching the files whose filename or one of
+// whose aliases matches condition.
+func nameQuery(condition interface{}) bson.M {
+	return bson.M{"$or": bson.A{bson.M{"filename": condition}, bson.M{"aliases": condition}}}
+}
+
+// setAliases stores the --aliasesField aliases in the aliases field of a
+// file written by 'put', where GridFS keeps the alternative names of a file.
+func (mf *MongoFiles) setAliases(gridFile *gfsFile) error {
+	if len(mf.aliases) == 0 {
+		return nil
+	}
+	_, err := mf.bucket.GetFilesCollection().UpdateOne(context.Background(),
+		bson.M{"_id": gridFile.ID}, bson.M{"$set": bson.M{"aliases": mf.aliases}})
+	if err != nil {
+		return fmt.Errorf("error storing the aliases of '%v': %v", gridFile.Name, err)
+	}
+	return nil
+}
+
+// originalPath returns the absolute path of a local file to store with its
+// upload for --storeOriginalPath, or "" if it isn't stored.
+func (mf *MongoFiles) originalPath(localFileName string) (string, error) {
+	if !mf.StorageOptions.StoreOriginalPath || localFileName == "-" {
+		return "", nil
+	}
+	path, err := filepath.Abs(localFileName)
+	if err != nil {
+		return "", fmt.Errorf("error resolving the path of '%v': %v", localFileName, err)
+	}
+	return filepath.ToSlash(path), nil
+}
+
+// byRequestedName returns a copy of each file for each of the given names it
+// has, as its filename or an alias, named by it, so that a file requested by
+// an alias is written under that alias.
+func byRequestedName(files []*gfsFile, names []string) []*gfsFile {
+	var named []*gfsFile
+	for _, file := range files {
+		for _, name := range names {
+			if name != file.Name && !util.StringSliceContains(file.Aliases, name) {
+				continue
+			}
+			copied := *file
+			copied.Name = name
+			named = append(named, &copied)
+		}
+	}
+	return named
+}
+
+// removeAlias removes a name from the aliases of the files that have it.
+func (mf *MongoFiles) removeAlias(name string) error {
+	_, err := mf.bucket.GetFilesCollection().UpdateMany(context.Background(),
+		bson.M{"aliases": name}, bson.M{"$pull": bson.M{"aliases": name}})
+	if err != nil {
+		return fmt.Errorf("error removing the alias '%v': %v", name, err)
+	}
+	return nil
+}
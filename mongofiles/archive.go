@@ -0,0 +1,439 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	driverOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// archiveIndexName is the first entry of an export archive. It has a line
+// of canonical Extended JSON for each file, naming the entry that holds
+// the file's data.
+const archiveIndexName = "index.json"
+
+// archiveIndexEntry describes a GridFS file in the index of an export archive.
+type archiveIndexEntry struct {
+	Entry      string      `bson:"entry"`
+	ID         interface{} `bson:"_id"`
+	Filename   string      `bson:"filename"`
+	Length     int64       `bson:"length"`
+	ChunkSize  int32       `bson:"chunkSize"`
+	UploadDate time.Time   `bson:"uploadDate"`
+	Md5        string      `bson:"md5,omitempty"`
+	Metadata   bson.Raw    `bson:"metadata,omitempty"`
+}
+
+func newArchiveIndexEntry(entry string, file *gfsFile) archiveIndexEntry {
+	indexEntry := archiveIndexEntry{
+		Entry:      entry,
+		ID:         file.ID,
+		Filename:   file.Name,
+		Length:     file.Length,
+		ChunkSize:  int32(file.ChunkSize),
+		UploadDate: file.UploadDate,
+		Md5:        file.Md5,
+	}
+	if file.rawMetadata.Type == bsontype.EmbeddedDocument {
+		indexEntry.Metadata = bson.Raw(file.rawMetadata.Value)
+	}
+	return indexEntry
+}
+
+// archiveFormat returns the format of an archive from its name: "zip",
+// "tar.gz" or "tar".
+func archiveFormat(path string) string {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	default:
+		return "tar"
+	}
+}
+
+// archiveWriter writes the entries of an export archive in order.
+type archiveWriter interface {
+	writeEntry(name string, size int64, modTime time.Time, data io.Reader) error
+	Close() error
+}
+
+type tarArchiveWriter struct {
+	tw      *tar.Writer
+	closers []io.Closer
+}
+
+func (w *tarArchiveWriter) writeEntry(name string, size int64, modTime time.Time, data io.Reader) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(w.tw, data)
+	return err
+}
+
+func (w *tarArchiveWriter) Close() error {
+	err := w.tw.Close()
+	for _, closer := range w.closers {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+type zipArchiveWriter struct {
+	zw  *zip.Writer
+	out io.Closer
+}
+
+func (w *zipArchiveWriter) writeEntry(name string, size int64, modTime time.Time, data io.Reader) error {
+	entry, err := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, data)
+	return err
+}
+
+func (w *zipArchiveWriter) Close() error {
+	err := w.zw.Close()
+	if closeErr := w.out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// createArchive creates an export archive, or writes a tar archive to
+// stdout if path is "-".
+func createArchive(path string) (archiveWriter, error) {
+	var out io.WriteCloser = nopWriteCloser{os.Stdout}
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("error creating archive '%v': %v", path, err)
+		}
+		out = file
+	}
+	switch archiveFormat(path) {
+	case "zip":
+		return &zipArchiveWriter{zw: zip.NewWriter(out), out: out}, nil
+	case "tar.gz":
+		gz := gzip.NewWriter(out)
+		return &tarArchiveWriter{tw: tar.NewWriter(gz), closers: []io.Closer{gz, out}}, nil
+	default:
+		return &tarArchiveWriter{tw: tar.NewWriter(out), closers: []io.Closer{out}}, nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// archiveReader reads the entries of an export archive in order. next
+// returns io.EOF after the last entry.
+type archiveReader interface {
+	next() (string, io.Reader, error)
+	Close() error
+}
+
+type tarArchiveReader struct {
+	tr      *tar.Reader
+	closers []io.Closer
+}
+
+func (r *tarArchiveReader) next() (string, io.Reader, error) {
+	for {
+		header, err := r.tr.Next()
+		if err != nil {
+			return "", nil, err
+		}
+		if header.Typeflag == tar.TypeReg {
+			return header.Name, r.tr, nil
+		}
+	}
+}
+
+func (r *tarArchiveReader) Close() error {
+	var err error
+	for _, closer := range r.closers {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+type zipArchiveReader struct {
+	zr      *zip.ReadCloser
+	current int
+	open    io.ReadCloser
+}
+
+func (r *zipArchiveReader) next() (string, io.Reader, error) {
+	if r.open != nil {
+		r.open.Close()
+		r.open = nil
+	}
+	for r.current < len(r.zr.File) {
+		file := r.zr.File[r.current]
+		r.current++
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return "", nil, err
+		}
+		r.open = rc
+		return file.Name, rc, nil
+	}
+	return "", nil, io.EOF
+}
+
+func (r *zipArchiveReader) Close() error {
+	if r.open != nil {
+		r.open.Close()
+	}
+	return r.zr.Close()
+}
+
+// openArchive opens an export archive, or reads a tar archive from stdin if
+// path is "-".
+func openArchive(path string) (archiveReader, error) {
+	if archiveFormat(path) == "zip" {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening archive '%v': %v", path, err)
+		}
+		return &zipArchiveReader{zr: zr}, nil
+	}
+
+	var in io.ReadCloser = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("error opening archive '%v': %v", path, err)
+		}
+		in = file
+	}
+	if archiveFormat(path) == "tar.gz" {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			in.Close()
+			return nil, fmt.Errorf("error opening archive '%v': %v", path, err)
+		}
+		return &tarArchiveReader{tr: tar.NewReader(gz), closers: []io.Closer{gz, in}}, nil
+	}
+	return &tarArchiveReader{tr: tar.NewReader(in), closers: []io.Closer{in}}, nil
+}
+
+// writeArchiveIndex writes the index of an export archive.
+func writeArchiveIndex(w io.Writer, entries []archiveIndexEntry) error {
+	for _, entry := range entries {
+		line, err := bson.MarshalExtJSON(entry, true, false)
+		if err != nil {
+			return fmt.Errorf("error converting the index entry of '%v' to JSON: %v", entry.Filename, err)
+		}
+		if _, err = fmt.Fprintf(w, "%s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readArchiveIndex reads the index of an export archive, by entry name.
+func readArchiveIndex(r io.Reader) (map[string]archiveIndexEntry, error) {
+	entries := map[string]archiveIndexEntry{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry archiveIndexEntry
+		if err := bson.UnmarshalExtJSON(line, true, &entry); err != nil {
+			return nil, fmt.Errorf("error parsing archive index: %v", err)
+		}
+		if entry.Entry == "" || entry.ID == nil {
+			return nil, fmt.Errorf("invalid archive index entry: %s", line)
+		}
+		entries[entry.Entry] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading archive index: %v", err)
+	}
+	return entries, nil
+}
+
+// handleExport contains the logic for the 'export' command, which writes
+// every file in the bucket to --archive.
+func (mf *MongoFiles) handleExport() (err error) {
+	gridFiles, err := mf.findGFSFiles(bson.M{})
+	if err != nil {
+		return fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+
+	entries := make([]archiveIndexEntry, len(gridFiles))
+	for i, gridFile := range gridFiles {
+		entries[i] = newArchiveIndexEntry(fmt.Sprintf("files/%d", i), gridFile)
+	}
+	var index bytes.Buffer
+	if err = writeArchiveIndex(&index, entries); err != nil {
+		return err
+	}
+
+	archive, err := createArchive(mf.StorageOptions.Archive)
+	if err != nil {
+		return err
+	}
+	dc := util.DeferredCloser{Closer: archive}
+	defer dc.CloseWithErrorCapture(&err)
+
+	if err = archive.writeEntry(archiveIndexName, int64(index.Len()), time.Now(), &index); err != nil {
+		return fmt.Errorf("error writing archive index: %v", err)
+	}
+	for i, gridFile := range gridFiles {
+		if err = mf.exportFile(archive, entries[i].Entry, gridFile); err != nil {
+			return err
+		}
+	}
+	log.Logvf(log.Always, "exported %v %v to %v", len(gridFiles),
+		util.Pluralize(len(gridFiles), "file", "files"), mf.StorageOptions.Archive)
+	return nil
+}
+
+func (mf *MongoFiles) exportFile(archive archiveWriter, entry string, gridFile *gfsFile) (err error) {
+	stream, err := gridFile.OpenStreamForReading()
+	if err != nil {
+		return err
+	}
+	dc := util.DeferredCloser{Closer: stream}
+	defer dc.CloseWithErrorCapture(&err)
+
+	log.Logvf(log.Info, "exporting '%v'", gridFile.Name)
+	if err = archive.writeEntry(entry, gridFile.Length, gridFile.UploadDate, stream); err != nil {
+		return fmt.Errorf("error exporting '%v': %v", gridFile.Name, err)
+	}
+	return nil
+}
+
+// handleImport contains the logic for the 'import' command, which adds the
+// files in an --archive written by export, keeping their _ids, upload dates
+// and metadata.
+func (mf *MongoFiles) handleImport() (err error) {
+	archive, err := openArchive(mf.StorageOptions.Archive)
+	if err != nil {
+		return err
+	}
+	dc := util.DeferredCloser{Closer: archive}
+	defer dc.CloseWithErrorCapture(&err)
+
+	name, data, err := archive.next()
+	if err != nil || name != archiveIndexName {
+		return fmt.Errorf("'%v' is not a mongofiles export archive: it must start with %v",
+			mf.StorageOptions.Archive, archiveIndexName)
+	}
+	index, err := readArchiveIndex(data)
+	if err != nil {
+		return err
+	}
+
+	imported := 0
+	for {
+		name, data, err = archive.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading archive: %v", err)
+		}
+		entry, ok := index[name]
+		if !ok {
+			log.Logvf(log.Always, "skipping archive entry '%v', which is not in the index", name)
+			continue
+		}
+		if err = mf.importFile(entry, data); err != nil {
+			return err
+		}
+		imported++
+	}
+
+	if imported < len(index) {
+		return fmt.Errorf("archive is missing %v of the %v files in its index", len(index)-imported, len(index))
+	}
+	log.Logvf(log.Always, "imported %v %v from %v", imported,
+		util.Pluralize(imported, "file", "files"), mf.StorageOptions.Archive)
+	return nil
+}
+
+func (mf *MongoFiles) importFile(entry archiveIndexEntry, data io.Reader) (err error) {
+	if mf.StorageOptions.Replace {
+		if err = mf.bucket.Delete(entry.ID); err != nil && err != gridfs.ErrFileNotFound {
+			return fmt.Errorf("error while removing '%v' from GridFS: %v", entry.Filename, err)
+		}
+	}
+
+	log.Logvf(log.Info, "importing '%v'", entry.Filename)
+	uploadOpts := driverOptions.GridFSUpload()
+	if entry.ChunkSize > 0 {
+		uploadOpts.SetChunkSizeBytes(entry.ChunkSize)
+	}
+	if entry.Metadata != nil {
+		uploadOpts.SetMetadata(entry.Metadata)
+	}
+	stream, err := mf.bucket.OpenUploadStreamWithID(entry.ID, entry.Filename, uploadOpts)
+	if err != nil {
+		return fmt.Errorf("could not open upload stream: %v", err)
+	}
+	n, err := io.Copy(stream, data)
+	if closeErr := stream.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error while importing '%v' into GridFS: %v", entry.Filename, err)
+	}
+	if n != entry.Length {
+		return fmt.Errorf("error while importing '%v' into GridFS: archive has %v bytes, expected %v",
+			entry.Filename, n, entry.Length)
+	}
+
+	// the upload stream sets the upload date to now and has no md5
+	set := bson.D{{Key: "uploadDate", Value: entry.UploadDate}}
+	if entry.Md5 != "" {
+		set = append(set, bson.E{Key: "md5", Value: entry.Md5})
+	}
+	_, err = mf.bucket.GetFilesCollection().UpdateOne(context.Background(),
+		bson.D{{Key: "_id", Value: entry.ID}}, bson.D{{Key: "$set", Value: set}})
+	if err != nil {
+		return fmt.Errorf("error restoring the upload date of '%v': %v", entry.Filename, err)
+	}
+	return nil
+}
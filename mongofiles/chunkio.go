@@ -0,0 +1,382 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	driverOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// chunksPerBatch is how many chunks each --ioWorkers worker reads or
+// inserts at a time.
+const chunksPerBatch = 16
+
+// uploadStream is a stream that writes a file to GridFS: either the
+// driver's upload stream or a parallelUploadStream.
+type uploadStream interface {
+	io.Writer
+	Close() error
+	Abort() error
+}
+
+// chunkBatch is a range of chunks read by one worker.
+type chunkBatch struct {
+	first, last int64
+	data        [][]byte
+	err         error
+	done        chan struct{}
+}
+
+// readChunksInParallel reads the chunks first to last with up to workers
+// reads at a time, and passes them to write in order. At most two batches
+// per worker are held in memory while waiting to be written.
+func readChunksInParallel(first, last int64, workers int,
+	read func(first, last int64) ([][]byte, error), write func(n int64, data []byte) error) error {
+	batches := make(chan *chunkBatch)
+	ordered := make(chan *chunkBatch, 2*workers)
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				batch.data, batch.err = read(batch.first, batch.last)
+				close(batch.done)
+			}
+		}()
+	}
+	go func() {
+		defer close(ordered)
+		defer close(batches)
+		for n := first; n <= last; n += chunksPerBatch {
+			batch := &chunkBatch{first: n, last: n + chunksPerBatch - 1, done: make(chan struct{})}
+			if batch.last > last {
+				batch.last = last
+			}
+			// a batch is queued to be written before it is read, so every
+			// batch the writer waits for is being or will be read
+			select {
+			case ordered <- batch:
+			case <-stop:
+				return
+			}
+			select {
+			case batches <- batch:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var err error
+	for batch := range ordered {
+		<-batch.done
+		if err = batch.err; err != nil {
+			break
+		}
+		for i, data := range batch.data {
+			if err = write(batch.first+int64(i), data); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+	return err
+}
+
+// writeRangeInParallel writes count bytes of a GridFS file from offset with
+// --ioWorkers concurrent chunk reads.
+func (mf *MongoFiles) writeRangeInParallel(gridFile *gfsFile, offset, count int64, out io.Writer) error {
+	if count <= 0 {
+		// an empty file or range has no chunks to read
+		return nil
+	}
+	chunkSize := int64(gridFile.ChunkSize)
+	firstChunk, lastChunk := offset/chunkSize, (offset+count-1)/chunkSize
+	read := func(first, last int64) ([][]byte, error) {
+		return mf.readChunks(gridFile, first, last)
+	}
+	write := func(n int64, data []byte) error {
+		if part := chunkPart(n, data, chunkSize, offset, count); len(part) > 0 {
+			if _, err := out.Write(part); err != nil {
+				return fmt.Errorf("error writing '%v': %v", gridFile.Name, err)
+			}
+		}
+		return nil
+	}
+	return readChunksInParallel(firstChunk, lastChunk, mf.StorageOptions.IOWorkers, read, write)
+}
+
+// readChunks reads the data of the chunks first to last of a GridFS file.
+func (mf *MongoFiles) readChunks(gridFile *gfsFile, first, last int64) (data [][]byte, err error) {
+	filter := bson.D{
+		{Key: "files_id", Value: gridFile.ID},
+		{Key: "n", Value: bson.D{{Key: "$gte", Value: first}, {Key: "$lte", Value: last}}},
+	}
+	findOpts := driverOptions.Find().SetSort(bson.D{{Key: "n", Value: 1}})
+	cursor, err := mf.bucket.GetChunksCollection().Find(context.Background(), filter, findOpts)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the chunks of '%v': %v", gridFile.Name, err)
+	}
+	dc := util.DeferredCloser{Closer: &util.CloserCursor{Cursor: cursor}}
+	defer dc.CloseWithErrorCapture(&err)
+
+	next := first
+	for cursor.Next(context.Background()) {
+		var chunk struct {
+			N    int64  `bson:"n"`
+			Data []byte `bson:"data"`
+		}
+		if err = cursor.Decode(&chunk); err != nil {
+			return nil, fmt.Errorf("error decoding a chunk of '%v': %v", gridFile.Name, err)
+		}
+		if chunk.N != next {
+			return nil, fmt.Errorf("chunk %v of '%v' is missing", next, gridFile.Name)
+		}
+		data = append(data, chunk.Data)
+		next++
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error reading the chunks of '%v': %v", gridFile.Name, err)
+	}
+	if next <= last {
+		return nil, fmt.Errorf("chunk %v of '%v' is missing", next, gridFile.Name)
+	}
+	return data, nil
+}
+
+// chunkPart returns the part of chunk n that lies within count bytes of the
+// file from offset.
+func chunkPart(n int64, data []byte, chunkSize, offset, count int64) []byte {
+	chunkStart := n * chunkSize
+	from := offset - chunkStart
+	if from < 0 {
+		from = 0
+	}
+	to := offset + count - chunkStart
+	if to > int64(len(data)) {
+		to = int64(len(data))
+	}
+	if from >= to {
+		return nil
+	}
+	return data[from:to]
+}
+
+// parallelUploadStream writes a file to GridFS with --ioWorkers concurrent
+// chunk inserts. The files document is written once every chunk is stored,
+// so the file only appears in the bucket when it is complete.
+type parallelUploadStream struct {
+	file      *gfsFile
+	metadata  bson.D
+	chunkSize int32
+
+	// buf is the chunk being filled and batch the chunks waiting to be
+	// handed to a worker.
+	buf    []byte
+	batch  []interface{}
+	n      int32
+	length int64
+
+	batches    chan []interface{}
+	stop       chan struct{}
+	stopOnce   sync.Once
+	finishOnce sync.Once
+	wg         sync.WaitGroup
+	lock       sync.Mutex
+	err        error
+
+	// insertChunks and insertFile write to the bucket and deleteChunks
+	// removes the chunks written so far; they are replaced in tests.
+	insertChunks func(chunks []interface{}) error
+	insertFile   func(doc bson.D) error
+	deleteChunks func() error
+}
+
+// newParallelUploadStream starts the workers of a parallel upload of file.
+func (mf *MongoFiles) newParallelUploadStream(file *gfsFile, metadata bson.D, chunkSize int32) (*parallelUploadStream, error) {
+	chunks, files := mf.bucket.GetChunksCollection(), mf.bucket.GetFilesCollection()
+	if err := ensureBucketIndexes(files, chunks); err != nil {
+		return nil, err
+	}
+	s := newParallelUploadStreamWith(file, metadata, chunkSize, mf.StorageOptions.IOWorkers)
+	s.insertChunks = func(batch []interface{}) error {
+		_, err := chunks.InsertMany(context.Background(), batch, driverOptions.InsertMany().SetOrdered(false))
+		return err
+	}
+	s.insertFile = func(doc bson.D) error {
+		_, err := files.InsertOne(context.Background(), doc)
+		return err
+	}
+	s.deleteChunks = func() error {
+		_, err := chunks.DeleteMany(context.Background(), bson.D{{Key: "files_id", Value: file.ID}})
+		return err
+	}
+	s.start(mf.StorageOptions.IOWorkers)
+	return s, nil
+}
+
+func newParallelUploadStreamWith(file *gfsFile, metadata bson.D, chunkSize int32, workers int) *parallelUploadStream {
+	return &parallelUploadStream{
+		file:      file,
+		metadata:  metadata,
+		chunkSize: chunkSize,
+		buf:       make([]byte, 0, chunkSize),
+		batches:   make(chan []interface{}, workers),
+		stop:      make(chan struct{}),
+	}
+}
+
+func (s *parallelUploadStream) start(workers int) {
+	for w := 0; w < workers; w++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for batch := range s.batches {
+				if s.error() != nil {
+					continue
+				}
+				if err := s.insertChunks(batch); err != nil {
+					s.fail(fmt.Errorf("error while storing '%v' into GridFS: %v", s.file.Name, err))
+				}
+			}
+		}()
+	}
+}
+
+func (s *parallelUploadStream) fail(err error) {
+	s.lock.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.lock.Unlock()
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+func (s *parallelUploadStream) error() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+// Write cuts p into chunks and hands them to the workers in batches.
+func (s *parallelUploadStream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if err := s.error(); err != nil {
+			return written, err
+		}
+		space := int(s.chunkSize) - len(s.buf)
+		if space > len(p) {
+			space = len(p)
+		}
+		s.buf = append(s.buf, p[:space]...)
+		p, written = p[space:], written+space
+		if len(s.buf) == int(s.chunkSize) {
+			if err := s.addChunk(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (s *parallelUploadStream) addChunk() error {
+	s.batch = append(s.batch, bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "files_id", Value: s.file.ID},
+		{Key: "n", Value: s.n},
+		{Key: "data", Value: s.buf},
+	})
+	s.n++
+	s.length += int64(len(s.buf))
+	s.buf = make([]byte, 0, s.chunkSize)
+	if len(s.batch) < chunksPerBatch {
+		return nil
+	}
+	return s.dispatch()
+}
+
+func (s *parallelUploadStream) dispatch() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	select {
+	case s.batches <- s.batch:
+	case <-s.stop:
+		return s.error()
+	}
+	s.batch = nil
+	return nil
+}
+
+// finish waits for the workers to write the batches handed to them.
+func (s *parallelUploadStream) finish() {
+	s.finishOnce.Do(func() {
+		close(s.batches)
+		s.wg.Wait()
+	})
+}
+
+// Close writes the last chunk and the files document, removing the chunks
+// if the upload failed.
+func (s *parallelUploadStream) Close() error {
+	if len(s.buf) > 0 {
+		if err := s.addChunk(); err != nil {
+			return s.abortWith(err)
+		}
+	}
+	if err := s.dispatch(); err != nil {
+		return s.abortWith(err)
+	}
+	s.finish()
+	if err := s.error(); err != nil {
+		return s.abortWith(err)
+	}
+	doc := bson.D{
+		{Key: "_id", Value: s.file.ID},
+		{Key: "length", Value: s.length},
+		{Key: "chunkSize", Value: s.chunkSize},
+		{Key: "uploadDate", Value: primitive.NewDateTimeFromTime(time.Now())},
+		{Key: "filename", Value: s.file.Name},
+	}
+	if s.metadata != nil {
+		doc = append(doc, bson.E{Key: "metadata", Value: s.metadata})
+	}
+	if err := s.insertFile(doc); err != nil {
+		return s.abortWith(err)
+	}
+	return nil
+}
+
+// Abort stops the upload and removes the chunks written so far.
+func (s *parallelUploadStream) Abort() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.finish()
+	return s.deleteChunks()
+}
+
+func (s *parallelUploadStream) abortWith(err error) error {
+	if abortErr := s.Abort(); abortErr != nil {
+		return fmt.Errorf("%v (and removing the partial upload failed: %v)", err, abortErr)
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestReadChunksInParallel(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With chunks read by several workers", t, func() {
+		const chunkSize = 4
+		content := make([]byte, 1000)
+		rand.Read(content)
+		numChunks := int64((len(content) + chunkSize - 1) / chunkSize)
+		read := func(first, last int64) ([][]byte, error) {
+			// finish the reads out of order
+			time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+			var data [][]byte
+			for n := first; n <= last; n++ {
+				end := (n + 1) * chunkSize
+				if end > int64(len(content)) {
+					end = int64(len(content))
+				}
+				data = append(data, content[n*chunkSize:end])
+			}
+			return data, nil
+		}
+
+		Convey("the chunks are written in order", func() {
+			var out bytes.Buffer
+			err := readChunksInParallel(0, numChunks-1, 4, read, func(n int64, data []byte) error {
+				out.Write(chunkPart(n, data, chunkSize, 0, int64(len(content))))
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(out.Bytes(), ShouldResemble, content)
+		})
+
+		Convey("a range of the file is cut from its chunks", func() {
+			var out bytes.Buffer
+			offset, count := int64(10), int64(501)
+			err := readChunksInParallel(offset/chunkSize, (offset+count-1)/chunkSize, 3, read, func(n int64, data []byte) error {
+				out.Write(chunkPart(n, data, chunkSize, offset, count))
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(out.Bytes(), ShouldResemble, content[offset:offset+count])
+		})
+
+		Convey("a failed read stops the transfer", func() {
+			var written int64
+			err := readChunksInParallel(0, numChunks-1, 4, func(first, last int64) ([][]byte, error) {
+				if first >= 5*chunksPerBatch {
+					return nil, fmt.Errorf("chunk %v of 'file' is missing", first)
+				}
+				return read(first, last)
+			}, func(n int64, data []byte) error {
+				written = n + 1
+				return nil
+			})
+			So(err, ShouldNotBeNil)
+			So(written, ShouldEqual, 5*chunksPerBatch)
+		})
+	})
+
+	Convey("An empty file is written without reading any chunk", t, func() {
+		var out bytes.Buffer
+		mf := &MongoFiles{StorageOptions: &StorageOptions{IOWorkers: 4}}
+		So(mf.writeRangeInParallel(&gfsFile{Name: "file", ChunkSize: 4}, 0, 0, &out), ShouldBeNil)
+		So(out.Len(), ShouldEqual, 0)
+	})
+}
+
+func TestParallelUploadStream(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a file written by several workers", t, func() {
+		var lock sync.Mutex
+		stored := map[int32][]byte{}
+		var fileDoc bson.D
+		deleted := false
+		s := newParallelUploadStreamWith(&gfsFile{ID: "id", Name: "file"}, bson.D{{Key: "a", Value: 1}}, 5, 3)
+		s.insertChunks = func(chunks []interface{}) error {
+			lock.Lock()
+			defer lock.Unlock()
+			for _, chunk := range chunks {
+				doc := chunk.(bson.D)
+				stored[doc[2].Value.(int32)] = doc[3].Value.([]byte)
+			}
+			return nil
+		}
+		s.insertFile = func(doc bson.D) error {
+			fileDoc = doc
+			return nil
+		}
+		s.deleteChunks = func() error {
+			deleted = true
+			return nil
+		}
+		s.start(3)
+
+		Convey("it is cut into chunks and the files document is written last", func() {
+			content := make([]byte, 5*chunksPerBatch*2+3)
+			rand.Read(content)
+			for i := 0; i < len(content); i += 7 {
+				end := i + 7
+				if end > len(content) {
+					end = len(content)
+				}
+				n, err := s.Write(content[i:end])
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, end-i)
+			}
+			So(s.Close(), ShouldBeNil)
+
+			So(stored, ShouldHaveLength, 2*chunksPerBatch+1)
+			var joined []byte
+			for n := int32(0); n < int32(len(stored)); n++ {
+				joined = append(joined, stored[n]...)
+			}
+			So(joined, ShouldResemble, content)
+			So(fileDoc[1], ShouldResemble, bson.E{Key: "length", Value: int64(len(content))})
+			So(fileDoc[4], ShouldResemble, bson.E{Key: "filename", Value: "file"})
+			So(deleted, ShouldBeFalse)
+		})
+
+		Convey("a failed insert removes the chunks", func() {
+			s.insertChunks = func([]interface{}) error {
+				return fmt.Errorf("not primary")
+			}
+			_, err := s.Write(make([]byte, 5*chunksPerBatch))
+			if err == nil {
+				err = s.Close()
+			} else {
+				s.Abort()
+			}
+			So(err, ShouldNotBeNil)
+			So(fileDoc, ShouldBeNil)
+			So(deleted, ShouldBeTrue)
+		})
+	})
+
+	Convey("A file without metadata has no metadata field", t, func() {
+		var fileDoc bson.D
+		s := newParallelUploadStreamWith(&gfsFile{ID: "id", Name: "file"}, nil, 5, 2)
+		s.insertChunks = func([]interface{}) error { return nil }
+		s.insertFile = func(doc bson.D) error {
+			fileDoc = doc
+			return nil
+		}
+		s.deleteChunks = func() error { return nil }
+		s.start(2)
+		_, err := s.Write([]byte("content"))
+		So(err, ShouldBeNil)
+		So(s.Close(), ShouldBeNil)
+		So(fileDoc, ShouldNotBeNil)
+		for _, elem := range fileDoc {
+			So(elem.Key, ShouldNotEqual, "metadata")
+		}
+	})
+}
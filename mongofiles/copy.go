@@ -0,0 +1,247 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	driverOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// copyTarget returns the database and prefix of the bucket cp writes to,
+// from --to-db and --to-prefix.
+func (mf *MongoFiles) copyTarget() (string, string) {
+	dbName, prefix := mf.StorageOptions.ToDB, mf.StorageOptions.ToPrefix
+	if dbName == "" {
+		dbName = mf.StorageOptions.DB
+	}
+	if prefix == "" {
+		prefix = mf.StorageOptions.GridFSPrefix
+	}
+	return dbName, prefix
+}
+
+// findNamedGFSFiles returns every version of the named file, or an error if there is none.
+func (mf *MongoFiles) findNamedGFSFiles(filename string) ([]*gfsFile, error) {
+	gridFiles, err := mf.findGFSFiles(bson.M{"filename": filename})
+	if err != nil {
+		return nil, err
+	}
+	if len(gridFiles) == 0 {
+		return nil, fmt.Errorf("no such file with name: %v", filename)
+	}
+	return gridFiles, nil
+}
+
+// handleMove contains the logic for the 'mv' command, which renames every
+// version of a file.
+func (mf *MongoFiles) handleMove() error {
+	gridFiles, err := mf.findNamedGFSFiles(mf.FileName)
+	if err != nil {
+		return err
+	}
+
+	if mf.StorageOptions.Replace {
+		// never delete the versions being renamed
+		ids := make(bson.A, 0, len(gridFiles))
+		for _, gridFile := range gridFiles {
+			ids = append(ids, gridFile.ID)
+		}
+		query := bson.M{"filename": mf.TargetFileName, "_id": bson.M{"$nin": ids}}
+		if err = mf.deleteMatching(query, fmt.Sprintf("'%v'", mf.TargetFileName)); err != nil {
+			return err
+		}
+	}
+
+	for _, gridFile := range gridFiles {
+		if err = mf.bucket.Rename(gridFile.ID, mf.TargetFileName); err != nil {
+			return fmt.Errorf("error renaming '%v' to '%v': %v", mf.FileName, mf.TargetFileName, err)
+		}
+	}
+	log.Logvf(log.Always, "successfully renamed '%v' to '%v'", mf.FileName, mf.TargetFileName)
+	return nil
+}
+
+// handleCopy contains the logic for the 'cp' command, which copies the
+// latest version of a file. When the server can, the chunks are copied by the
+// server with $merge; otherwise they are streamed through mongofiles.
+func (mf *MongoFiles) handleCopy() error {
+	gridFiles, err := mf.findNamedGFSFiles(mf.FileName)
+	if err != nil {
+		return err
+	}
+	source := gridFiles[0]
+	for _, gridFile := range gridFiles[1:] {
+		if gridFile.UploadDate.After(source.UploadDate) {
+			source = gridFile
+		}
+	}
+
+	dbName, prefix := mf.copyTarget()
+	target, err := mf.bucketFor(dbName, prefix)
+	if err != nil {
+		return err
+	}
+	if mf.StorageOptions.Replace {
+		if err = mf.deleteCopyTargets(target); err != nil {
+			return err
+		}
+	}
+
+	serverVersion, err := mf.SessionProvider.ServerVersionArray()
+	if err != nil {
+		return fmt.Errorf("error getting server version: %v", err)
+	}
+	if mf.canCopyOnServer(serverVersion) {
+		err = mf.copyOnServer(source, dbName, prefix)
+	} else {
+		err = mf.copyByStreaming(source, target)
+	}
+	if err != nil {
+		return fmt.Errorf("error copying '%v' to '%v': %v", mf.FileName, mf.TargetFileName, err)
+	}
+	log.Logvf(log.Always, "successfully copied '%v' to '%v' in %v.%v", mf.FileName, mf.TargetFileName, dbName, prefix)
+	return nil
+}
+
+// canCopyOnServer reports whether cp can copy the chunks with $merge. $merge
+// is available from MongoDB 4.2, but can only write to the collection being
+// aggregated from 4.4, so copies within a bucket need 4.4.
+func (mf *MongoFiles) canCopyOnServer(serverVersion db.Version) bool {
+	dbName, prefix := mf.copyTarget()
+	if dbName == mf.StorageOptions.DB && prefix == mf.StorageOptions.GridFSPrefix {
+		return serverVersion.GTE(db.Version{4, 4, 0})
+	}
+	return serverVersion.GTE(db.Version{4, 2, 0})
+}
+
+// deleteCopyTargets deletes the files cp would duplicate in the target bucket, for --replace.
+func (mf *MongoFiles) deleteCopyTargets(target *gridfs.Bucket) error {
+	cursor, err := target.Find(bson.M{"filename": mf.TargetFileName})
+	if err != nil {
+		return err
+	}
+	var existing []gfsFile
+	if err = cursor.All(context.Background(), &existing); err != nil {
+		return err
+	}
+	for _, gridFile := range existing {
+		if err = target.Delete(gridFile.ID); err != nil {
+			return fmt.Errorf("error while removing '%v' from GridFS: %v", mf.TargetFileName, err)
+		}
+	}
+	return nil
+}
+
+// copyOnServer copies a file's chunks to the target bucket with an
+// aggregation, then inserts its files document. The chunks are written
+// first, so that the copy can't be read before it is complete.
+func (mf *MongoFiles) copyOnServer(source *gfsFile, dbName, prefix string) error {
+	client, err := mf.SessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	filesColl := client.Database(dbName).Collection(prefix + ".files")
+	chunksColl := client.Database(dbName).Collection(prefix + ".chunks")
+	if err = ensureBucketIndexes(filesColl, chunksColl); err != nil {
+		return err
+	}
+
+	id := primitive.NewObjectID()
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"files_id": source.ID}},
+		// without an _id, $merge generates a new one for each chunk
+		bson.M{"$project": bson.M{"_id": 0, "files_id": bson.M{"$literal": id}, "n": 1, "data": 1}},
+		bson.M{"$merge": bson.M{
+			"into":           bson.M{"db": dbName, "coll": prefix + ".chunks"},
+			"whenMatched":    "fail",
+			"whenNotMatched": "insert",
+		}},
+	}
+	cursor, err := mf.bucket.GetChunksCollection().Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return err
+	}
+	if err = cursor.Close(context.Background()); err != nil {
+		return err
+	}
+
+	_, err = filesColl.InsertOne(context.Background(), copiedFilesDoc(source, id, mf.TargetFileName, time.Now()))
+	return err
+}
+
+// copiedFilesDoc returns the files document of a copy of a GridFS file.
+func copiedFilesDoc(source *gfsFile, id interface{}, filename string, uploadDate time.Time) bson.D {
+	doc := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "length", Value: source.Length},
+		{Key: "chunkSize", Value: source.ChunkSize},
+		{Key: "uploadDate", Value: primitive.NewDateTimeFromTime(uploadDate)},
+		{Key: "filename", Value: filename},
+	}
+	if source.Md5 != "" {
+		doc = append(doc, bson.E{Key: "md5", Value: source.Md5})
+	}
+	if source.rawMetadata.Type != 0 {
+		doc = append(doc, bson.E{Key: "metadata", Value: source.rawMetadata})
+	}
+	return doc
+}
+
+// ensureBucketIndexes creates the indexes GridFS uses, which drivers only
+// create on a bucket's first upload.
+func ensureBucketIndexes(filesColl, chunksColl *mongo.Collection) error {
+	_, err := filesColl.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "filename", Value: 1}, {Key: "uploadDate", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("error creating index on %v: %v", filesColl.Name(), err)
+	}
+	_, err = chunksColl.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "files_id", Value: 1}, {Key: "n", Value: 1}},
+		Options: driverOptions.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating index on %v: %v", chunksColl.Name(), err)
+	}
+	return nil
+}
+
+// copyByStreaming copies a file by reading it from GridFS and writing it to
+// the target bucket.
+func (mf *MongoFiles) copyByStreaming(source *gfsFile, target *gridfs.Bucket) (err error) {
+	download, err := source.OpenStreamForReading()
+	if err != nil {
+		return err
+	}
+	dc := util.DeferredCloser{Closer: download}
+	defer dc.CloseWithErrorCapture(&err)
+
+	uploadOpts := driverOptions.GridFSUpload().SetChunkSizeBytes(int32(source.ChunkSize))
+	if source.rawMetadata.Type != 0 {
+		uploadOpts.Metadata = source.rawMetadata
+	}
+	upload, err := target.OpenUploadStreamWithID(primitive.NewObjectID(), mf.TargetFileName, uploadOpts)
+	if err != nil {
+		return fmt.Errorf("could not open upload stream: %v", err)
+	}
+	uc := util.DeferredCloser{Closer: upload}
+	defer uc.CloseWithErrorCapture(&err)
+
+	_, err = io.Copy(upload, download)
+	return err
+}
@@ -0,0 +1,69 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/huimingz/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	driverOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// duplicateQuery returns the query for the files with the given MD5 checksum
+// and length.
+func duplicateQuery(md5Sum string, length int64) bson.M {
+	return bson.M{"md5": md5Sum, "length": length}
+}
+
+// sameNameDuplicateQuery returns the query for the files with the given MD5
+// checksum and length that already have the given name, as their filename
+// or an alias.
+func sameNameDuplicateQuery(md5Sum string, length int64, name string) bson.M {
+	return bson.M{"$and": bson.A{duplicateQuery(md5Sum, length), nameQuery(name)}}
+}
+
+// dedupe looks for a file in the bucket with the content of a local file,
+// for put --dedupe, and reports whether the upload can be skipped. A
+// duplicate that already has the name is simply reported. GridFS chunks
+// belong to a single files document, so a duplicate under another name has
+// the name, and any --aliasesField aliases, added to its aliases instead,
+// which get and delete find it by.
+func (mf *MongoFiles) dedupe(name, localFileName, md5Sum string) (bool, error) {
+	info, err := os.Stat(localFileName)
+	if err != nil {
+		return false, fmt.Errorf("error while opening local gridFile '%v' : %v", localFileName, err)
+	}
+
+	findOpts := driverOptions.GridFSFind().SetLimit(1)
+	duplicates, err := mf.findGFSFiles(sameNameDuplicateQuery(md5Sum, info.Size(), name), findOpts)
+	if err != nil {
+		return false, fmt.Errorf("error looking for copies of '%v' in GridFS: %v", name, err)
+	}
+	if len(duplicates) > 0 {
+		log.Logvf(log.Always, "skipping '%v': an identical file is already in GridFS (_id: %v)", name, duplicates[0].ID)
+		return true, nil
+	}
+
+	if duplicates, err = mf.findGFSFiles(duplicateQuery(md5Sum, info.Size()), findOpts); err != nil {
+		return false, fmt.Errorf("error looking for copies of '%v' in GridFS: %v", name, err)
+	}
+	if len(duplicates) == 0 {
+		return false, nil
+	}
+	names := append([]string{name}, mf.aliases...)
+	_, err = mf.bucket.GetFilesCollection().UpdateOne(context.Background(),
+		bson.M{"_id": duplicates[0].ID}, bson.M{"$addToSet": bson.M{"aliases": bson.M{"$each": names}}})
+	if err != nil {
+		return false, fmt.Errorf("error adding '%v' to the aliases of '%v': %v", name, duplicates[0].Name, err)
+	}
+	log.Logvf(log.Always, "stored '%v' as an alias of '%v' (_id: %v), which has the same content, saving %v bytes",
+		name, duplicates[0].Name, duplicates[0].ID, info.Size())
+	return true, nil
+}
@@ -0,0 +1,76 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// handlePutDir contains the logic for the 'put_dir' command. Every regular
+// file under the directory is added with its path relative to the directory,
+// using '/' as the separator, as its filename.
+func (mf *MongoFiles) handlePutDir() error {
+	root := mf.FileName
+	info, err := os.Stat(root)
+	if err != nil {
+		return fmt.Errorf("error reading local directory '%v': %v", root, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%v' is not a directory", root)
+	}
+
+	var count int
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error reading local directory '%v': %v", root, err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			log.Logvf(log.Always, "skipping '%v', which is not a regular file", path)
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		filename := filepath.ToSlash(rel)
+
+		log.Logvf(log.Always, "adding gridFile: %v\n", filename)
+		n, err := mf.put(primitive.NewObjectID(), filename, path)
+		if err != nil {
+			log.Logvf(log.Always, "error adding gridFile: %v\n", err)
+			return err
+		}
+		log.Logvf(log.DebugLow, "copied %v bytes to server", n)
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Logvf(log.Always, "added %v files from '%v'", count, root)
+	return nil
+}
+
+// outputDirPath returns where a GridFS file is written with --output-dir,
+// treating '/' in its filename as a directory separator.
+func outputDirPath(dir, filename string) (string, error) {
+	path := filepath.Join(dir, filepath.FromSlash(filename))
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("cannot write GridFS file '%v' within --output-dir '%v'", filename, dir)
+	}
+	return path, nil
+}
@@ -0,0 +1,143 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	driverOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// parseAge parses the value of --olderThan: a number of days ("30d") or
+// weeks ("2w"), or a Go duration such as "36h".
+func parseAge(age string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid --olderThan '%v': expected a number of days (30d), weeks (2w) or a duration like 36h", age)
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(age, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(age, "w"):
+		unit = 7 * 24 * time.Hour
+	default:
+		duration, err := time.ParseDuration(age)
+		if err != nil || duration <= 0 {
+			return 0, invalid
+		}
+		return duration, nil
+	}
+	count, err := strconv.Atoi(age[:len(age)-1])
+	if err != nil || count <= 0 {
+		return 0, invalid
+	}
+	return time.Duration(count) * unit, nil
+}
+
+// expireQuery returns the query for the files uploaded before cutoff whose
+// names start with prefix.
+func expireQuery(cutoff time.Time, prefix string) bson.M {
+	query := bson.M{"uploadDate": bson.M{"$lt": cutoff}}
+	if prefix != "" {
+		query["filename"] = bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}
+	}
+	return query
+}
+
+// throttleDelay returns how long to wait after deleting the given number of
+// files in elapsed time, to stay under rate deletions per second.
+func throttleDelay(deleted, rate int, elapsed time.Duration) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	target := time.Duration(deleted) * time.Second / time.Duration(rate)
+	if target <= elapsed {
+		return 0
+	}
+	return target - elapsed
+}
+
+// handleExpire contains the logic for the 'expire' command, which deletes
+// the files older than --olderThan, optionally only those whose names start
+// with the supporting argument. With --dryRun, it lists them instead.
+func (mf *MongoFiles) handleExpire() (output string, err error) {
+	age, err := parseAge(mf.StorageOptions.OlderThan)
+	if err != nil {
+		return "", err
+	}
+	query := expireQuery(time.Now().Add(-age), mf.FileName)
+
+	if mf.StorageOptions.DryRun {
+		return mf.findAndDisplay(query)
+	}
+
+	findOpts := driverOptions.GridFSFind().SetBatchSize(int32(mf.StorageOptions.ExpireBatchSize))
+	cursor, err := mf.bucket.Find(query, findOpts)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	dc := util.DeferredCloser{Closer: &util.CloserCursor{Cursor: cursor}}
+	defer dc.CloseWithErrorCapture(&err)
+
+	start := time.Now()
+	deleted := 0
+	batch := make([]interface{}, 0, mf.StorageOptions.ExpireBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := mf.deleteFileBatch(batch); err != nil {
+			return err
+		}
+		deleted += len(batch)
+		batch = batch[:0]
+		log.Logvf(log.Info, "deleted %v expired files", deleted)
+		time.Sleep(throttleDelay(deleted, mf.StorageOptions.MaxDeletesPerSecond, time.Since(start)))
+		return nil
+	}
+
+	for cursor.Next(context.Background()) {
+		var id bson.RawValue
+		if id, err = cursor.Current.LookupErr("_id"); err != nil {
+			return "", fmt.Errorf("error decoding GFSFile: %v", err)
+		}
+		batch = append(batch, id)
+		if len(batch) == mf.StorageOptions.ExpireBatchSize {
+			if err = flush(); err != nil {
+				return "", err
+			}
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return "", fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	if err = flush(); err != nil {
+		return "", err
+	}
+
+	log.Logvf(log.Always, "successfully deleted %v expired %v from GridFS", deleted, util.Pluralize(deleted, "file", "files"))
+	return "", nil
+}
+
+// deleteFileBatch deletes the files with the given _ids and their chunks, in
+// the same order as the driver's Delete.
+func (mf *MongoFiles) deleteFileBatch(ids []interface{}) error {
+	ctx := context.Background()
+	if _, err := mf.bucket.GetFilesCollection().DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return fmt.Errorf("error deleting expired files: %v", err)
+	}
+	if _, err := mf.bucket.GetChunksCollection().DeleteMany(ctx, bson.M{"files_id": bson.M{"$in": ids}}); err != nil {
+		return fmt.Errorf("error deleting the chunks of expired files: %v", err)
+	}
+	return nil
+}
@@ -7,9 +7,13 @@
 package mongofiles
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -24,6 +28,11 @@ type gfsFile struct {
 	UploadDate time.Time       `bson:"uploadDate"`
 	Metadata   gfsFileMetadata `bson:"metadata"`
 	ChunkSize  int             `bson:"chunkSize"`
+	Aliases    []string        `bson:"aliases,omitempty"`
+
+	// rawMetadata is the whole metadata document, including the fields not
+	// in gfsFileMetadata.
+	rawMetadata bson.RawValue
 
 	// Storage required for reading and writing GridFS files
 	mf *MongoFiles
@@ -31,7 +40,8 @@ type gfsFile struct {
 
 // Struct representing the metadata associated with a GridFS files collection document.
 type gfsFileMetadata struct {
-	ContentType string `bson:"contentType,omitempty"`
+	ContentType  string `bson:"contentType,omitempty"`
+	OriginalPath string `bson:"originalPath,omitempty"`
 }
 
 func newGfsFile(ID interface{}, name string, mf *MongoFiles) (*gfsFile, error) {
@@ -55,16 +65,63 @@ func newGfsFileFromCursor(cursor *mongo.Cursor, mf *MongoFiles) (*gfsFile, error
 	if out.ID == nil {
 		return nil, fmt.Errorf("invalid gfsFile, ID nil")
 	}
+	if metadata, err := cursor.Current.LookupErr("metadata"); err == nil {
+		out.rawMetadata = bson.RawValue{Type: metadata.Type, Value: append([]byte{}, metadata.Value...)}
+	}
 
 	out.mf = mf
 
 	return &out, nil
 }
 
+// JSONListing returns a description of the file as a line of relaxed
+// Extended JSON, for list and search with --json.
+func (file *gfsFile) JSONListing() (string, error) {
+	listing := bson.D{
+		{Key: "_id", Value: file.ID},
+		{Key: "filename", Value: file.Name},
+		{Key: "length", Value: file.Length},
+		{Key: "chunkSize", Value: file.ChunkSize},
+		{Key: "uploadDate", Value: file.UploadDate},
+	}
+	if file.Md5 != "" {
+		listing = append(listing, bson.E{Key: "md5", Value: file.Md5})
+	}
+	if len(file.Aliases) > 0 {
+		listing = append(listing, bson.E{Key: "aliases", Value: file.Aliases})
+	}
+	if file.Metadata.ContentType != "" {
+		listing = append(listing, bson.E{Key: "contentType", Value: file.Metadata.ContentType})
+	}
+	if file.rawMetadata.Type != 0 {
+		listing = append(listing, bson.E{Key: "metadata", Value: file.rawMetadata})
+	}
+
+	out, err := bson.MarshalExtJSON(listing, false, false)
+	if err != nil {
+		return "", fmt.Errorf("error converting '%v' to JSON: %v", file.Name, err)
+	}
+	return string(out), nil
+}
+
 // OpenStreamForWriting opens a stream for uploading data to a GridFS file that must be closed.
-func (file *gfsFile) OpenStreamForWriting() (*gridfs.UploadStream, error) {
+// With --ioWorkers, the chunks of the file are written concurrently.
+func (file *gfsFile) OpenStreamForWriting() (uploadStream, error) {
 	uploadOpts := options.GridFSUpload()
-	uploadOpts.Metadata = file.Metadata
+	metadata := file.mf.uploadMetadata(file.Metadata)
+	uploadOpts.Metadata = metadata
+	chunkSize := gridfs.DefaultChunkSize
+	if file.mf.StorageOptions.ChunkSize > 0 {
+		chunkSize = file.mf.StorageOptions.ChunkSize
+		uploadOpts.SetChunkSizeBytes(chunkSize)
+	}
+	if file.mf.StorageOptions.IOWorkers > 1 {
+		stream, err := file.mf.newParallelUploadStream(file, metadata, chunkSize)
+		if err != nil {
+			return nil, err
+		}
+		return stream, nil
+	}
 	stream, err := file.mf.bucket.OpenUploadStreamWithID(file.ID, file.Name, uploadOpts)
 	if err != nil {
 		return nil, fmt.Errorf("could not open upload stream: %v", err)
@@ -83,9 +140,38 @@ func (file *gfsFile) OpenStreamForReading() (*gridfs.DownloadStream, error) {
 	return stream, nil
 }
 
+// storedMD5 returns the MD5 checksum of the file: its md5 field if it has one,
+// and otherwise the checksum of its chunks, since the driver doesn't store it.
+func (file *gfsFile) storedMD5() (string, error) {
+	if file.Md5 != "" {
+		return file.Md5, nil
+	}
+	stream, err := file.OpenStreamForReading()
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+	hash := md5.New()
+	if _, err = io.Copy(hash, stream); err != nil {
+		return "", fmt.Errorf("error reading '%v' from GridFS: %v", file.Name, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 // Deletes the corresponding GridFS file in the database and its chunks.
 // Note: this file must be closed if it had been written to before being deleted. Any download streams will be closed as part of this deletion.
+// With --notifyURL, the deletion is reported once it is done.
 func (file *gfsFile) Delete() error {
+	if err := file.remove(); err != nil {
+		return err
+	}
+
+	return file.mf.notify(deleteEvent, file)
+}
+
+// remove deletes the file like Delete, without reporting it to --notifyURL,
+// for uploads that are discarded before they were reported.
+func (file *gfsFile) remove() error {
 	if err := file.mf.bucket.Delete(file.ID); err != nil {
 		return fmt.Errorf("error while removing '%v' from GridFS: %v", file.Name, err)
 	}
@@ -0,0 +1,113 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// splitIDList splits the argument of get_id and delete_id into its
+// comma-separated _ids. Commas inside Extended JSON documents and strings
+// don't separate _ids.
+func splitIDList(list string) []string {
+	var ids []string
+	depth, start := 0, 0
+	inString, escaped := false, false
+	for i, c := range list {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			ids = append(ids, list[start:i])
+			start = i + 1
+		}
+	}
+	return append(ids, list[start:])
+}
+
+// readIDFile reads the _ids in an --idFile, one per line. Blank lines are
+// skipped.
+func readIDFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening --idFile: %v", err)
+	}
+	defer file.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			ids = append(ids, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading --idFile: %v", err)
+	}
+	return ids, nil
+}
+
+// targetIDs returns the _ids given to get_id or delete_id, from the
+// argument and --idFile, without duplicates.
+func (mf *MongoFiles) targetIDs() ([]string, error) {
+	var ids []string
+	if mf.Id != "" {
+		ids = splitIDList(mf.Id)
+	}
+	if mf.StorageOptions.IDFile != "" {
+		fileIDs, err := readIDFile(mf.StorageOptions.IDFile)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, fileIDs...)
+	}
+
+	seen := map[string]bool{}
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("no _id given")
+	}
+	return unique, nil
+}
+
+// idQuery returns the query for the files with the given Extended JSON _ids.
+func idQuery(ids []string) (bson.M, error) {
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		value, err := parseID(id)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	if len(values) == 1 {
+		return bson.M{"_id": values[0]}, nil
+	}
+	return bson.M{"_id": bson.M{"$in": values}}, nil
+}
@@ -0,0 +1,111 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	driverOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// listSortFields maps the values of --sort to fields of the files collection.
+var listSortFields = map[string]string{
+	"uploadDate": "uploadDate",
+	"length":     "length",
+	"name":       "filename",
+}
+
+// parseUploadTime parses the value of --uploadedAfter or --uploadedBefore,
+// either an RFC 3339 timestamp or a date.
+func parseUploadTime(option, value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --%v '%v': expected a date like 2006-01-02 or 2006-01-02T15:04:05Z", option, value)
+}
+
+// parseListOptions checks the options that sort, page and filter the
+// listings of list, search and search_meta.
+func (mf *MongoFiles) parseListOptions(command string) error {
+	opts := mf.StorageOptions
+	switch command {
+	case List, Search, SearchMeta:
+	default:
+		if opts.Sort != "" || opts.Limit != 0 || opts.Skip != 0 || opts.UploadedAfter != "" || opts.UploadedBefore != "" {
+			return fmt.Errorf("--sort, --limit, --skip, --uploadedAfter and --uploadedBefore can only be used with %v, %v and %v",
+				List, Search, SearchMeta)
+		}
+		return nil
+	}
+
+	if _, ok := listSortFields[strings.TrimPrefix(opts.Sort, "-")]; opts.Sort != "" && !ok {
+		return fmt.Errorf("invalid --sort '%v': must be uploadDate, length or name, with a leading '-' for descending order", opts.Sort)
+	}
+	if opts.Limit < 0 || opts.Limit > math.MaxInt32 {
+		return fmt.Errorf("--limit must be between 0 and %v", math.MaxInt32)
+	}
+	if opts.Skip < 0 || opts.Skip > math.MaxInt32 {
+		return fmt.Errorf("--skip must be between 0 and %v", math.MaxInt32)
+	}
+
+	uploadDate := bson.M{}
+	if opts.UploadedAfter != "" {
+		after, err := parseUploadTime("uploadedAfter", opts.UploadedAfter)
+		if err != nil {
+			return err
+		}
+		uploadDate["$gt"] = after
+	}
+	if opts.UploadedBefore != "" {
+		before, err := parseUploadTime("uploadedBefore", opts.UploadedBefore)
+		if err != nil {
+			return err
+		}
+		uploadDate["$lt"] = before
+	}
+	mf.uploadDateFilter = nil
+	if len(uploadDate) > 0 {
+		mf.uploadDateFilter = uploadDate
+	}
+	return nil
+}
+
+// listFilter returns the query of a listing, restricted to the upload dates
+// given by --uploadedAfter and --uploadedBefore.
+func (mf *MongoFiles) listFilter(query interface{}) interface{} {
+	if mf.uploadDateFilter == nil {
+		return query
+	}
+	return bson.D{{Key: "$and", Value: bson.A{query, bson.M{"uploadDate": mf.uploadDateFilter}}}}
+}
+
+// listFindOptions returns the find options given by --sort, --limit and --skip.
+func (mf *MongoFiles) listFindOptions() *driverOptions.GridFSFindOptions {
+	opts := driverOptions.GridFSFind()
+	if sort := mf.StorageOptions.Sort; sort != "" {
+		direction := 1
+		if strings.HasPrefix(sort, "-") {
+			direction = -1
+		}
+		field := listSortFields[strings.TrimPrefix(sort, "-")]
+		// _id makes the order of files with the same value stable across pages
+		opts.SetSort(bson.D{{Key: field, Value: direction}, {Key: "_id", Value: direction}})
+	}
+	if mf.StorageOptions.Limit > 0 {
+		opts.SetLimit(int32(mf.StorageOptions.Limit))
+	}
+	if mf.StorageOptions.Skip > 0 {
+		opts.SetSkip(int32(mf.StorageOptions.Skip))
+	}
+	return opts
+}
@@ -0,0 +1,101 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// parseMetadata reads the metadata for 'put' from --metadata or --metadataFile.
+func (mf *MongoFiles) parseMetadata() error {
+	opts := mf.StorageOptions
+	var data []byte
+	switch {
+	case opts.Metadata != "" && opts.MetadataFile != "":
+		return fmt.Errorf("cannot use both --metadata and --metadataFile")
+	case opts.Metadata != "":
+		data = []byte(opts.Metadata)
+	case opts.MetadataFile != "":
+		var err error
+		if data, err = ioutil.ReadFile(opts.MetadataFile); err != nil {
+			return fmt.Errorf("error reading --metadataFile: %v", err)
+		}
+	default:
+		return nil
+	}
+
+	var metadata bson.D
+	if err := bson.UnmarshalExtJSON(data, false, &metadata); err != nil {
+		return fmt.Errorf("error parsing metadata as Extended JSON: %v", err)
+	}
+	mf.metadata = metadata
+	return nil
+}
+
+// uploadMetadata returns the metadata document of a file written by 'put':
+// the --metadata fields, with the contentType from --type and the
+// originalPath from --storeOriginalPath.
+func (mf *MongoFiles) uploadMetadata(fileMetadata gfsFileMetadata) bson.D {
+	metadata := bson.D{}
+	for _, elem := range mf.metadata {
+		if (fileMetadata.ContentType == "" || elem.Key != "contentType") &&
+			(fileMetadata.OriginalPath == "" || elem.Key != "originalPath") {
+			metadata = append(metadata, elem)
+		}
+	}
+	if fileMetadata.ContentType != "" {
+		metadata = append(metadata, bson.E{Key: "contentType", Value: fileMetadata.ContentType})
+	}
+	if fileMetadata.OriginalPath != "" {
+		metadata = append(metadata, bson.E{Key: "originalPath", Value: fileMetadata.OriginalPath})
+	}
+	return metadata
+}
+
+// parseMetadataQuery parses the query of 'search_meta', an Extended JSON
+// query on the fields of the files' metadata.
+func parseMetadataQuery(query string) (bson.D, error) {
+	var parsed bson.D
+	if err := bson.UnmarshalExtJSON([]byte(query), false, &parsed); err != nil {
+		return nil, fmt.Errorf("error parsing metadata query as Extended JSON: %v", err)
+	}
+	return metadataQuery(parsed), nil
+}
+
+// metadataQuery rewrites a query on metadata fields into a query on the
+// files collection, in which they are fields of the metadata document.
+func metadataQuery(query bson.D) bson.D {
+	rewritten := make(bson.D, 0, len(query))
+	for _, elem := range query {
+		switch {
+		case elem.Key == "$and" || elem.Key == "$or" || elem.Key == "$nor":
+			clauses, ok := elem.Value.(bson.A)
+			if !ok {
+				rewritten = append(rewritten, elem)
+				continue
+			}
+			rewrittenClauses := make(bson.A, len(clauses))
+			for i, clause := range clauses {
+				if clauseDoc, ok := clause.(bson.D); ok {
+					rewrittenClauses[i] = metadataQuery(clauseDoc)
+				} else {
+					rewrittenClauses[i] = clause
+				}
+			}
+			rewritten = append(rewritten, bson.E{Key: elem.Key, Value: rewrittenClauses})
+		case strings.HasPrefix(elem.Key, "$"):
+			rewritten = append(rewritten, elem)
+		default:
+			rewritten = append(rewritten, bson.E{Key: "metadata." + elem.Key, Value: elem.Value})
+		}
+	}
+	return rewritten
+}
@@ -9,9 +9,12 @@ package mongofiles
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -27,17 +30,31 @@ import (
 
 // List of possible commands for mongofiles.
 const (
-	List     = "list"
-	Search   = "search"
-	Put      = "put"
-	PutID    = "put_id"
-	Get      = "get"
-	GetID    = "get_id"
-	GetRegex = "get_regex"
-	Delete   = "delete"
-	DeleteID = "delete_id"
+	List        = "list"
+	Search      = "search"
+	SearchMeta  = "search_meta"
+	Put         = "put"
+	PutID       = "put_id"
+	PutDir      = "put_dir"
+	Sync        = "sync"
+	Get         = "get"
+	GetID       = "get_id"
+	GetRegex    = "get_regex"
+	Delete      = "delete"
+	DeleteID    = "delete_id"
+	DeleteRegex = "delete_regex"
+	DeleteQuery = "delete_query"
+	Move        = "mv"
+	Copy        = "cp"
+	Export      = "export"
+	Import      = "import"
+	Expire      = "expire"
 )
 
+// maxChunkSize is the largest --chunkSize. It leaves room for the other
+// fields of a chunk document within the maximum BSON document size.
+const maxChunkSize = db.MaxBSONSize - 16*1024
+
 // MongoFiles is a container for the user-specified options and
 // internal state used for running mongofiles.
 type MongoFiles struct {
@@ -62,6 +79,9 @@ type MongoFiles struct {
 	// ID to put into GridFS
 	Id string
 
+	// new filename for mv and cp
+	TargetFileName string
+
 	// List of filenames for use as supporting
 	// arguments in put and get commands
 	FileNameList []string
@@ -72,6 +92,18 @@ type MongoFiles struct {
 
 	// GridFS bucket to operate on
 	bucket *gridfs.Bucket
+
+	// metadata from --metadata or --metadataFile for files written by put
+	metadata bson.D
+
+	// aliases from --aliasesField for files written by put
+	aliases []string
+
+	// bytes to write with get --range
+	byteRange *byteRange
+
+	// condition on the uploadDate of listed files from --uploadedAfter and --uploadedBefore
+	uploadDateFilter bson.M
 }
 
 // New constructs a new mongofiles instance from the provided options. Will fail if cannot connect to server or if the
@@ -111,7 +143,7 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 	}
 
 	switch args[0] {
-	case List:
+	case List, Expire:
 		if len(args) > 2 {
 			return fmt.Errorf("too many non-URI positional arguments (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)")
 		}
@@ -128,7 +160,7 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 		}
 
 		mf.FileNameList = args[1:]
-	case GetRegex:
+	case GetRegex, DeleteRegex:
 		// mongofiles get_regex ... should work over a PCRE
 		// and a string of options passed to the $regex query
 		if len(args) == 1 || args[1] == "" {
@@ -138,7 +170,38 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 		}
 
 		mf.FileNameRegex = args[1]
-	case Search, Delete:
+	case PutDir, Sync:
+		if len(args) > 2 {
+			return fmt.Errorf("too many non-URI positional arguments (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)")
+		}
+		if len(args) == 1 || args[1] == "" {
+			return fmt.Errorf("'%v' argument missing", args[0])
+		}
+		if mf.StorageOptions.LocalFileName != "" {
+			return fmt.Errorf("cannot use --local with %v", args[0])
+		}
+		if args[0] == Sync && mf.StorageOptions.Replace {
+			// sync replaces changed files itself, once the new versions are written
+			return fmt.Errorf("cannot use --replace with %v", args[0])
+		}
+		mf.FileName = args[1]
+	case Export, Import:
+		if len(args) > 1 {
+			return fmt.Errorf("too many non-URI positional arguments (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)")
+		}
+		if mf.StorageOptions.Archive == "" {
+			return fmt.Errorf("'%v' requires --archive", args[0])
+		}
+	case Move, Copy:
+		if len(args) > 3 {
+			return fmt.Errorf("too many non-URI positional arguments (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)")
+		}
+		if len(args) < 3 || args[1] == "" || args[2] == "" {
+			return fmt.Errorf("'%v' argument(s) missing", args[0])
+		}
+		mf.FileName = args[1]
+		mf.TargetFileName = args[2]
+	case Search, SearchMeta, Delete, DeleteQuery:
 		if len(args) > 2 {
 			return fmt.Errorf("too many non-URI positional arguments (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)")
 		}
@@ -153,9 +216,12 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 			return fmt.Errorf("too many non-URI positional arguments (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)")
 		}
 		if len(args) == 1 || args[1] == "" {
-			return fmt.Errorf("'%v' argument missing", args[0])
+			if mf.StorageOptions.IDFile == "" {
+				return fmt.Errorf("'%v' argument missing", args[0])
+			}
+		} else {
+			mf.Id = args[1]
 		}
-		mf.Id = args[1]
 	case PutID:
 		if len(args) > 3 {
 			return fmt.Errorf("too many non-URI positional arguments (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)")
@@ -173,20 +239,146 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 		return fmt.Errorf("--prefix can not be blank")
 	}
 
+	if args[0] != Sync && (mf.StorageOptions.FromGridFS || mf.StorageOptions.DeleteExtraneous) {
+		return fmt.Errorf("--from-gridfs and --delete can only be used with %v", Sync)
+	}
+
+	if args[0] != Copy && (mf.StorageOptions.ToDB != "" || mf.StorageOptions.ToPrefix != "") {
+		return fmt.Errorf("--to-db and --to-prefix can only be used with %v", Copy)
+	}
+	if args[0] != GetID && args[0] != DeleteID && mf.StorageOptions.IDFile != "" {
+		return fmt.Errorf("--idFile can only be used with %v and %v", GetID, DeleteID)
+	}
+
+	if args[0] == Expire {
+		if mf.StorageOptions.OlderThan == "" {
+			return fmt.Errorf("'%v' requires --olderThan", Expire)
+		}
+		if _, err := parseAge(mf.StorageOptions.OlderThan); err != nil {
+			return err
+		}
+		if mf.StorageOptions.ExpireBatchSize <= 0 {
+			return fmt.Errorf("--batchSize must be positive")
+		}
+		if mf.StorageOptions.MaxDeletesPerSecond < 0 {
+			return fmt.Errorf("--maxDeletesPerSecond must not be negative")
+		}
+	} else if mf.StorageOptions.OlderThan != "" || mf.StorageOptions.DryRun {
+		return fmt.Errorf("--olderThan and --dryRun can only be used with %v", Expire)
+	}
+
+	if args[0] != Put && args[0] != PutID && (mf.StorageOptions.ReplaceIfDifferent || mf.StorageOptions.Dedupe) {
+		return fmt.Errorf("--replace-if-different and --dedupe can only be used with %v and %v", Put, PutID)
+	}
+
+	if args[0] != Export && args[0] != Import && mf.StorageOptions.Archive != "" {
+		return fmt.Errorf("--archive can only be used with %v and %v", Export, Import)
+	}
+
+	mf.parseAliases()
+	if len(mf.aliases) > 0 {
+		if args[0] != Put && args[0] != PutID {
+			return fmt.Errorf("--aliasesField can only be used with %v and %v", Put, PutID)
+		}
+		if len(mf.FileNameList) > 1 {
+			return fmt.Errorf("cannot give several files the same --aliasesField")
+		}
+	}
+	if err := mf.validateNotifyURL(); err != nil {
+		return err
+	}
+	if mf.StorageOptions.NotifyURL != "" {
+		switch args[0] {
+		case Put, PutID, PutDir, Sync, Delete, DeleteID, DeleteRegex, DeleteQuery:
+		default:
+			return fmt.Errorf("--notifyURL can only be used with %v, %v, %v, %v, %v, %v, %v and %v",
+				Put, PutID, PutDir, Sync, Delete, DeleteID, DeleteRegex, DeleteQuery)
+		}
+	}
+	if mf.StorageOptions.StoreOriginalPath && args[0] != Put && args[0] != PutID && args[0] != PutDir && args[0] != Sync {
+		return fmt.Errorf("--storeOriginalPath can only be used with %v, %v, %v and %v", Put, PutID, PutDir, Sync)
+	}
+
+	if args[0] == Move && mf.FileName == mf.TargetFileName {
+		return fmt.Errorf("cannot move '%v' onto itself", mf.FileName)
+	}
+	if args[0] == Copy {
+		dbName, prefix := mf.copyTarget()
+		if dbName == mf.StorageOptions.DB && prefix == mf.StorageOptions.GridFSPrefix && mf.FileName == mf.TargetFileName {
+			return fmt.Errorf("cannot copy '%v' onto itself", mf.FileName)
+		}
+		if err := util.ValidateFullNamespace(fmt.Sprintf("%s.%s.chunks", dbName, prefix)); err != nil {
+			return err
+		}
+	}
+
+	if mf.StorageOptions.OutputDir != "" && mf.StorageOptions.LocalFileName != "" {
+		return fmt.Errorf("cannot use both --local and --output-dir")
+	}
+
+	if err := mf.parseMetadata(); err != nil {
+		return err
+	}
+
+	if err := mf.parseListOptions(args[0]); err != nil {
+		return err
+	}
+
+	mf.byteRange = nil
+	if mf.StorageOptions.Range != "" {
+		if args[0] != Get && args[0] != GetID {
+			return fmt.Errorf("--range can only be used with %v and %v", Get, GetID)
+		}
+		if len(mf.FileNameList) > 1 {
+			return fmt.Errorf("cannot get a --range of several files")
+		}
+		if mf.StorageOptions.OutputDir != "" {
+			return fmt.Errorf("cannot use both --range and --output-dir")
+		}
+		var err error
+		if mf.byteRange, err = parseByteRange(mf.StorageOptions.Range); err != nil {
+			return err
+		}
+	}
+
+	if mf.StorageOptions.NumTransferWorkers < 0 {
+		return fmt.Errorf("--numTransferWorkers must not be negative")
+	}
+	if mf.StorageOptions.IOWorkers < 0 {
+		return fmt.Errorf("--ioWorkers must not be negative")
+	}
+	if mf.StorageOptions.LocalFileName != "" && mf.StorageOptions.NumTransferWorkers > 1 {
+		// every file would be read from or written to the same local file
+		log.Logvf(log.Info, "transferring one file at a time with --local")
+		mf.StorageOptions.NumTransferWorkers = 1
+	}
+
+	if mf.StorageOptions.ChunkSize < 0 || mf.StorageOptions.ChunkSize > maxChunkSize {
+		return fmt.Errorf("--chunkSize must be between 1 and %v bytes", maxChunkSize)
+	}
+
 	mf.Command = args[0]
 	return nil
 }
 
 // Query GridFS for files and display the results.
-func (mf *MongoFiles) findAndDisplay(query bson.M) (string, error) {
-	gridFiles, err := mf.findGFSFiles(query)
+func (mf *MongoFiles) findAndDisplay(query interface{}) (string, error) {
+	gridFiles, err := mf.findGFSFiles(mf.listFilter(query), mf.listFindOptions())
 	if err != nil {
 		return "", fmt.Errorf("error retrieving list of GridFS files: %v", err)
 	}
 
 	var display string
 	for _, gridFile := range gridFiles {
-		display += fmt.Sprintf("%s\t%d\n", gridFile.Name, gridFile.Length)
+		if !mf.StorageOptions.JSON {
+			display += fmt.Sprintf("%s\t%d\n", gridFile.Name, gridFile.Length)
+			continue
+		}
+		listing, err := gridFile.JSONListing()
+		if err != nil {
+			return "", err
+		}
+		display += listing + "\n"
 	}
 
 	return display, nil
@@ -214,22 +406,22 @@ func (mf *MongoFiles) handleGet() (err error) {
 		return err
 	}
 
-	if len(files) > 1 && mf.StorageOptions.LocalFileName != "" {
-		return fmt.Errorf("cannot get multiple files with --local specified")
+	if mf.byteRange != nil {
+		return mf.handleGetRange(files)
 	}
 
-	for _, file := range files {
-		if err = mf.writeGFSFileToLocal(file); err != nil {
-			return err
-		}
+	if len(files) > 1 && mf.StorageOptions.LocalFileName != "" {
+		return fmt.Errorf("cannot get multiple files with --local specified")
 	}
 
-	return nil
+	return mf.transferFiles(len(files), func(worker *MongoFiles, i int) error {
+		return worker.writeGFSFileToLocal(files[i])
+	})
 }
 
 // Gets all GridFS files that match the given query.
-func (mf *MongoFiles) findGFSFiles(query bson.M) (files []*gfsFile, err error) {
-	cursor, err := mf.bucket.Find(query)
+func (mf *MongoFiles) findGFSFiles(query interface{}, opts ...*driverOptions.GridFSFindOptions) (files []*gfsFile, err error) {
+	cursor, err := mf.bucket.Find(query, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -253,35 +445,39 @@ func (mf *MongoFiles) getTargetGFSFiles() ([]*gfsFile, error) {
 	var query bson.M
 	var minimumExpectedDocs = 1
 	var minimumExpectedDocsError error
+	// the names files are requested by, which may be aliases
+	var names []string
 
 	if len(mf.FileNameList) > 0 {
 		// Case supporting queries one or many files specified in mongofiles ... get ...
-		query = bson.M{"filename": bson.M{"$in": mf.FileNameList}}
+		query = nameQuery(bson.M{"$in": mf.FileNameList})
+		names = mf.FileNameList
 		minimumExpectedDocs = len(mf.FileNameList)
 		minimumExpectedDocsError = fmt.Errorf("requested files not found: %v", mf.FileNameList)
 	} else if mf.FileNameRegex != "" {
 		// Case supporting queries by regex specified in mongofiles ... get_regex ...
-		query = bson.M{
-			"filename": bson.M{
-				"$regex":   mf.FileNameRegex,
-				"$options": mf.StorageOptions.RegexOptions,
-			},
-		}
+		query = mf.regexQuery()
 		minimumExpectedDocsError = fmt.Errorf("files matching the following pattern were not found: %v", mf.FileNameRegex)
-	} else if mf.Id != "" {
-		// Case supporting queries by file ID specified in mongofiles ... get_id ...
-		minimumExpectedDocsError = fmt.Errorf("no such file with _id: %v", mf.Id)
-
-		id, err := mf.parseOrCreateID()
+	} else if mf.Id != "" || mf.StorageOptions.IDFile != "" {
+		// Case supporting queries by file IDs specified in mongofiles ... get_id ...
+		ids, err := mf.targetIDs()
 		if err != nil {
 			return nil, err
 		}
-
-		query = bson.M{"_id": id}
+		if query, err = idQuery(ids); err != nil {
+			return nil, err
+		}
+		minimumExpectedDocs = len(ids)
+		if len(ids) == 1 {
+			minimumExpectedDocsError = fmt.Errorf("no such file with _id: %v", ids[0])
+		} else {
+			minimumExpectedDocsError = fmt.Errorf("requested _ids not found: %v", ids)
+		}
 	} else {
 		// Case supporting queries of a single file with specific local
 		// file name, i.e. with mongofiles ... get ... --local ...
-		query = bson.M{"filename": mf.FileName}
+		query = nameQuery(mf.FileName)
+		names = []string{mf.FileName}
 		minimumExpectedDocsError = fmt.Errorf("no such file with name: %v", mf.FileName)
 	}
 
@@ -289,6 +485,9 @@ func (mf *MongoFiles) getTargetGFSFiles() ([]*gfsFile, error) {
 	if err != nil {
 		return nil, err
 	}
+	if names != nil {
+		gridFiles = byRequestedName(gridFiles, names)
+	}
 
 	if len(gridFiles) < minimumExpectedDocs {
 		return nil, minimumExpectedDocsError
@@ -297,12 +496,15 @@ func (mf *MongoFiles) getTargetGFSFiles() ([]*gfsFile, error) {
 	return gridFiles, nil
 }
 
-// Delete all files with the given filename.
+// Delete all files with the given filename, and remove it from the aliases of other files.
 func (mf *MongoFiles) deleteAll(filename string) error {
 	gridFiles, err := mf.findGFSFiles(bson.M{"filename": filename})
 	if err != nil {
 		return err
 	}
+	if err = mf.removeAlias(filename); err != nil {
+		return err
+	}
 
 	for _, gridFile := range gridFiles {
 		if err := gridFile.Delete(); err != nil {
@@ -314,6 +516,48 @@ func (mf *MongoFiles) deleteAll(filename string) error {
 	return nil
 }
 
+// Query for the files whose names match the regex given to get_regex or delete_regex.
+func (mf *MongoFiles) regexQuery() bson.M {
+	return bson.M{
+		"filename": bson.M{
+			"$regex":   mf.FileNameRegex,
+			"$options": mf.StorageOptions.RegexOptions,
+		},
+	}
+}
+
+// Delete all files matching the given query, described in the log by description.
+func (mf *MongoFiles) deleteMatching(query interface{}, description string) error {
+	gridFiles, err := mf.findGFSFiles(query)
+	if err != nil {
+		return err
+	}
+
+	for _, gridFile := range gridFiles {
+		if err := gridFile.Delete(); err != nil {
+			return err
+		}
+		log.Logvf(log.Info, "deleted '%v'", gridFile.Name)
+	}
+	log.Logvf(log.Always, "successfully deleted %v %v matching %v from GridFS", len(gridFiles),
+		util.Pluralize(len(gridFiles), "file", "files"), description)
+
+	return nil
+}
+
+// handleDeleteQuery contains the logic for the 'delete_query' command
+func (mf *MongoFiles) handleDeleteQuery() error {
+	query, err := parseMetadataQuery(mf.FileName)
+	if err != nil {
+		return err
+	}
+	if len(query) == 0 {
+		// an empty query would delete every file
+		return fmt.Errorf("'%v' requires a non-empty query", DeleteQuery)
+	}
+	return mf.deleteMatching(query, mf.FileName)
+}
+
 // handleDeleteID contains the logic for the 'delete_id' command
 func (mf *MongoFiles) handleDeleteID() error {
 	files, err := mf.getTargetGFSFiles()
@@ -321,18 +565,24 @@ func (mf *MongoFiles) handleDeleteID() error {
 		return err
 	}
 
-	file := files[0]
-	if err := file.Delete(); err != nil {
-		return err
+	for _, file := range files {
+		if err := file.Delete(); err != nil {
+			return err
+		}
+		log.Logvf(log.Always, "successfully deleted file with _id %v from GridFS", file.ID)
 	}
-	log.Logvf(log.Always, fmt.Sprintf("successfully deleted file with _id %v from GridFS", mf.Id))
 
 	return nil
 }
 
 // parse and convert input extended JSON _id. Generates a new ObjectID if no _id provided.
 func (mf *MongoFiles) parseOrCreateID() (interface{}, error) {
-	trimmed := strings.Trim(mf.Id, " ")
+	return parseID(mf.Id)
+}
+
+// parse and convert an extended JSON _id. Generates a new ObjectID if empty.
+func parseID(id string) (interface{}, error) {
+	trimmed := strings.Trim(id, " ")
 
 	if trimmed == "" {
 		return primitive.NewObjectID(), nil
@@ -358,6 +608,19 @@ func (mf *MongoFiles) parseOrCreateID() (interface{}, error) {
 // writeGFSFileToLocal writes a file from gridFS to stdout or the filesystem.
 func (mf *MongoFiles) writeGFSFileToLocal(gridFile *gfsFile) (err error) {
 	localFileName := mf.getLocalFileName(gridFile)
+	if mf.StorageOptions.OutputDir != "" {
+		if localFileName, err = outputDirPath(mf.StorageOptions.OutputDir, gridFile.Name); err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(localFileName), 0755); err != nil {
+			return fmt.Errorf("error creating directory for local file '%v': %v", localFileName, err)
+		}
+	}
+	return mf.writeGFSFile(gridFile, localFileName)
+}
+
+// writeGFSFile writes a file from gridFS to the given local file, or stdout if it is "-".
+func (mf *MongoFiles) writeGFSFile(gridFile *gfsFile, localFileName string) (err error) {
 	var localFile io.WriteCloser
 	if localFileName == "-" {
 		localFile = os.Stdout
@@ -370,6 +633,14 @@ func (mf *MongoFiles) writeGFSFileToLocal(gridFile *gfsFile) (err error) {
 		log.Logvf(log.DebugLow, "created local file '%v'", localFileName)
 	}
 
+	if mf.StorageOptions.IOWorkers > 1 && gridFile.ChunkSize > 0 {
+		if err = mf.writeRangeInParallel(gridFile, 0, gridFile.Length, localFile); err != nil {
+			return err
+		}
+		log.Logvf(log.Always, fmt.Sprintf("finished writing to %s\n", localFileName))
+		return nil
+	}
+
 	stream, err := gridFile.OpenStreamForReading()
 	if err != nil {
 		return err
@@ -385,14 +656,46 @@ func (mf *MongoFiles) writeGFSFileToLocal(gridFile *gfsFile) (err error) {
 	return nil
 }
 
-// Write the given GridFS file to the database. Will fail if file already exists and --replace flag turned off.
-func (mf *MongoFiles) put(id interface{}, name string) (bytesWritten int64, err error) {
+// Write the given GridFS file to the database from the given local file, or the one named by getLocalFileName if empty.
+// Will fail if file already exists and --replace flag turned off.
+func (mf *MongoFiles) put(id interface{}, name, localFileName string) (bytesWritten int64, err error) {
 	gridFile, err := newGfsFile(id, name, mf)
 	if err != nil {
 		return 0, err
 	}
 
-	localFileName := mf.getLocalFileName(gridFile)
+	if localFileName == "" {
+		localFileName = mf.getLocalFileName(gridFile)
+	}
+
+	// with --replace-if-different and --dedupe, a local file is compared
+	// before it is uploaded; standard input can only be read once, so with
+	// --replace-if-different it is hashed as it is uploaded, and the new
+	// version is removed again if it is identical to another
+	var md5Sum string
+	if mf.StorageOptions.Dedupe && localFileName == "-" {
+		return 0, fmt.Errorf("cannot use --dedupe with standard input")
+	}
+	compareAfterUpload := mf.StorageOptions.ReplaceIfDifferent && localFileName == "-"
+	if (mf.StorageOptions.ReplaceIfDifferent || mf.StorageOptions.Dedupe) && !compareAfterUpload {
+		if md5Sum, err = localMD5(localFileName); err != nil {
+			return 0, err
+		}
+	}
+	if mf.StorageOptions.ReplaceIfDifferent && !compareAfterUpload {
+		info, err := os.Stat(localFileName)
+		if err != nil {
+			return 0, fmt.Errorf("error while reading local file '%v': %v", localFileName, err)
+		}
+		if identical, err := mf.identicalFileExists(gridFile, md5Sum, info.Size()); err != nil || identical {
+			return 0, err
+		}
+	}
+	if mf.StorageOptions.Dedupe {
+		if duplicate, err := mf.dedupe(gridFile.Name, localFileName, md5Sum); err != nil || duplicate {
+			return 0, err
+		}
+	}
 
 	var localFile io.ReadCloser
 	if localFileName == "-" {
@@ -407,56 +710,149 @@ func (mf *MongoFiles) put(id interface{}, name string) (bytesWritten int64, err
 		log.Logvf(log.DebugLow, "creating GridFS gridFile '%v' from local gridFile '%v'", mf.FileName, localFileName)
 	}
 
-	// check if --replace flag turned on
-	if mf.StorageOptions.Replace {
-		if err = mf.deleteAll(gridFile.Name); err != nil {
-			return 0, err
-		}
-	}
-
 	if mf.StorageOptions.ContentType != "" {
 		gridFile.Metadata.ContentType = mf.StorageOptions.ContentType
 	}
+	if gridFile.Metadata.OriginalPath, err = mf.originalPath(localFileName); err != nil {
+		return 0, err
+	}
 
 	stream, err := gridFile.OpenStreamForWriting()
 	if err != nil {
 		return 0, err
 	}
-	dc := util.DeferredCloser{Closer: stream}
-	defer dc.CloseWithErrorCapture(&err)
 
-	n, err := io.Copy(stream, localFile)
+	// the data is streamed in chunks as it is read, so its length needn't be known
+	var reader io.Reader = localFile
+	hash := md5.New()
+	hashed := md5Sum == "" && (mf.StorageOptions.NotifyURL != "" || compareAfterUpload)
+	if hashed {
+		reader = io.TeeReader(localFile, hash)
+	}
+	n, err := io.Copy(stream, reader)
 	if err != nil {
+		// remove the chunks written so far instead of storing a truncated file
+		if abortErr := stream.Abort(); abortErr != nil {
+			log.Logvf(log.Always, "error removing the partial upload of '%v': %v", gridFile.Name, abortErr)
+		}
+		return n, fmt.Errorf("error while storing '%v' into GridFS: %v", localFileName, err)
+	}
+	if err = stream.Close(); err != nil {
 		return n, fmt.Errorf("error while storing '%v' into GridFS: %v", localFileName, err)
 	}
+	if hashed {
+		md5Sum = hex.EncodeToString(hash.Sum(nil))
+	}
+	if compareAfterUpload {
+		identical, err := mf.identicalFileExists(gridFile, md5Sum, n)
+		if err != nil {
+			return n, err
+		}
+		if identical {
+			// the upload hasn't been reported, so it is removed quietly
+			return 0, gridFile.remove()
+		}
+	}
+	if err = mf.setAliases(gridFile); err != nil {
+		return n, err
+	}
+
+	if mf.StorageOptions.Dedupe || mf.StorageOptions.ReplaceIfDifferent {
+		// later uploads of the same content are found by this checksum
+		if err = mf.setMD5(gridFile, md5Sum); err != nil {
+			return n, err
+		}
+	}
+
+	if mf.StorageOptions.NotifyURL != "" {
+		gridFile.Length = n
+		gridFile.Md5 = md5Sum
+		if err = mf.notify(putEvent, gridFile); err != nil {
+			return n, err
+		}
+	}
+
+	// the other versions are only removed once the new one is complete
+	if mf.StorageOptions.Replace || mf.StorageOptions.ReplaceIfDifferent {
+		if err = mf.deleteOtherVersions(gridFile); err != nil {
+			return n, err
+		}
+	}
 
 	return n, nil
 }
 
+// identicalFileExists reports whether another file with the name of gridFile
+// has the given length and MD5 checksum, for put --replace-if-different.
+// Files without a stored checksum are compared by the checksum of their
+// chunks.
+func (mf *MongoFiles) identicalFileExists(gridFile *gfsFile, md5Sum string, length int64) (bool, error) {
+	candidates, err := mf.findGFSFiles(bson.M{"filename": gridFile.Name, "length": length, "_id": bson.M{"$ne": gridFile.ID}})
+	if err != nil {
+		return false, fmt.Errorf("error looking for copies of '%v' in GridFS: %v", gridFile.Name, err)
+	}
+	for _, candidate := range candidates {
+		sum, err := candidate.storedMD5()
+		if err != nil {
+			return false, err
+		}
+		if sum == md5Sum {
+			log.Logvf(log.Always, "skipping '%v': an identical file is already in GridFS", gridFile.Name)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// setMD5 records the MD5 checksum of a file written by put, which the driver
+// doesn't store, so that later uploads can be compared with it.
+func (mf *MongoFiles) setMD5(gridFile *gfsFile, md5Sum string) error {
+	_, err := mf.bucket.GetFilesCollection().UpdateOne(context.Background(),
+		bson.M{"_id": gridFile.ID}, bson.M{"$set": bson.M{"md5": md5Sum}})
+	if err != nil {
+		return fmt.Errorf("error storing the checksum of '%v': %v", gridFile.Name, err)
+	}
+	return nil
+}
+
+// deleteOtherVersions deletes the files with the name of gridFile, other than gridFile itself.
+func (mf *MongoFiles) deleteOtherVersions(gridFile *gfsFile) error {
+	others, err := mf.findGFSFiles(bson.M{"filename": gridFile.Name, "_id": bson.M{"$ne": gridFile.ID}})
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		if err := other.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // handlePut contains the logic for the 'put' and 'put_id' commands
 func (mf *MongoFiles) handlePut() error {
 	if len(mf.FileNameList) == 0 {
 		mf.FileNameList = []string{mf.FileName}
 	}
 
-	for _, filename := range mf.FileNameList {
-		id, err := mf.parseOrCreateID()
+	return mf.transferFiles(len(mf.FileNameList), func(worker *MongoFiles, i int) error {
+		filename := mf.FileNameList[i]
+		id, err := worker.parseOrCreateID()
 		if err != nil {
 			return err
 		}
 
 		log.Logvf(log.Always, "adding gridFile: %v\n", filename)
 
-		n, err := mf.put(id, filename)
+		n, err := worker.put(id, filename, "")
 		if err != nil {
 			log.Logvf(log.Always, "error adding gridFile: %v\n", err)
 			return err
 		}
 		log.Logvf(log.DebugLow, "copied %v bytes to server", n)
 		log.Logvf(log.Always, "added gridFile: %v\n", filename)
-	}
-
-	return nil
+		return nil
+	})
 }
 
 // Run the mongofiles utility. If displayHost is true, the connected host/port is
@@ -482,10 +878,9 @@ func (mf *MongoFiles) Run(displayHost bool) (output string, finalErr error) {
 		return "", fmt.Errorf("error connecting to host: %v", err)
 	}
 
-	database := client.Database(mf.StorageOptions.DB)
-	mf.bucket, err = gridfs.NewBucket(database, &driverOptions.BucketOptions{Name: &mf.StorageOptions.GridFSPrefix})
+	mf.bucket, err = mf.newBucket()
 	if err != nil {
-		return "", fmt.Errorf("error getting GridFS bucket: %v", err)
+		return "", err
 	}
 
 	if displayHost {
@@ -507,28 +902,59 @@ func (mf *MongoFiles) Run(displayHost bool) (output string, finalErr error) {
 	case List:
 		query := bson.M{}
 		if mf.FileName != "" {
-			regex := bson.M{"$regex": "^" + regexp.QuoteMeta(mf.FileName)}
-			query = bson.M{"filename": regex}
+			query = nameQuery(bson.M{"$regex": "^" + regexp.QuoteMeta(mf.FileName)})
 		}
 		output, err = mf.findAndDisplay(query)
 
 	case Search:
-		regex := bson.M{"$regex": mf.FileName}
-		query := bson.M{"filename": regex}
+		query := nameQuery(bson.M{"$regex": mf.FileName})
 
 		output, err = mf.findAndDisplay(query)
 
+	case SearchMeta:
+		var query bson.D
+		if query, err = parseMetadataQuery(mf.FileName); err == nil {
+			output, err = mf.findAndDisplay(query)
+		}
+
 	case Get, GetID, GetRegex:
 		err = mf.handleGet()
 
 	case Put, PutID:
 		err = mf.handlePut()
 
+	case PutDir:
+		err = mf.handlePutDir()
+
+	case Sync:
+		err = mf.handleSync()
+
 	case DeleteID:
 		err = mf.handleDeleteID()
 
 	case Delete:
 		err = mf.deleteAll(mf.FileName)
+
+	case DeleteRegex:
+		err = mf.deleteMatching(mf.regexQuery(), fmt.Sprintf("'%v'", mf.FileNameRegex))
+
+	case DeleteQuery:
+		err = mf.handleDeleteQuery()
+
+	case Move:
+		err = mf.handleMove()
+
+	case Export:
+		err = mf.handleExport()
+
+	case Expire:
+		output, err = mf.handleExpire()
+
+	case Import:
+		err = mf.handleImport()
+
+	case Copy:
+		err = mf.handleCopy()
 	}
 
 	return output, err
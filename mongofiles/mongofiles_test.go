@@ -10,10 +10,16 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/huimingz/mongo-tools/common/db"
 	"github.com/huimingz/mongo-tools/common/log"
@@ -22,6 +28,8 @@ import (
 	"github.com/huimingz/mongo-tools/common/testutil"
 	"github.com/huimingz/mongo-tools/common/util"
 	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
@@ -324,6 +332,72 @@ func TestValidArguments(t *testing.T) {
 			}
 		})
 
+		Convey("delete_regex and delete_query take one supporting argument", func() {
+			So(mf.ValidateCommand([]string{"delete_regex", "^tmp/"}), ShouldBeNil)
+			So(mf.FileNameRegex, ShouldEqual, "^tmp/")
+			So(mf.regexQuery(), ShouldResemble, bson.M{"filename": bson.M{"$regex": "^tmp/", "$options": ""}})
+			So(mf.ValidateCommand([]string{"delete_query", `{"project": "apollo"}`}), ShouldBeNil)
+			So(mf.FileName, ShouldEqual, `{"project": "apollo"}`)
+
+			for _, command := range []string{"delete_regex", "delete_query"} {
+				So(mf.ValidateCommand([]string{command}), ShouldNotBeNil)
+				So(mf.ValidateCommand([]string{command, "a", "b"}), ShouldNotBeNil)
+			}
+		})
+
+		Convey("delete_query should error out on an empty query", func() {
+			So(mf.ValidateCommand([]string{"delete_query", "{}"}), ShouldBeNil)
+			So(mf.handleDeleteQuery(), ShouldNotBeNil)
+		})
+
+		Convey("It should error out when --chunkSize is out of range", func() {
+			args := []string{"put", "foo"}
+			mf.StorageOptions.ChunkSize = 1024 * 1024
+			So(mf.ValidateCommand(args), ShouldBeNil)
+			for _, size := range []int32{-1, maxChunkSize + 1} {
+				mf.StorageOptions.ChunkSize = size
+				err := mf.ValidateCommand(args)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, fmt.Sprintf("--chunkSize must be between 1 and %v bytes", maxChunkSize))
+			}
+		})
+
+		Convey("--replace-if-different can only be used with put and put_id", func() {
+			mf.StorageOptions.ReplaceIfDifferent = true
+			So(mf.ValidateCommand([]string{"put", "foo"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{"put_id", "foo", "id"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{"get", "foo"}), ShouldNotBeNil)
+		})
+
+		Convey("--dedupe looks for files with the same checksum and length", func() {
+			mf.StorageOptions.Dedupe = true
+			So(mf.ValidateCommand([]string{"put", "foo"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{"list"}), ShouldNotBeNil)
+			So(duplicateQuery("5d41402abc4b2a76b9719d911017c592", 5), ShouldResemble,
+				bson.M{"md5": "5d41402abc4b2a76b9719d911017c592", "length": int64(5)})
+			So(sameNameDuplicateQuery("5d41402abc4b2a76b9719d911017c592", 5, "foo"), ShouldResemble,
+				bson.M{"$and": bson.A{
+					bson.M{"md5": "5d41402abc4b2a76b9719d911017c592", "length": int64(5)},
+					bson.M{"$or": bson.A{bson.M{"filename": "foo"}, bson.M{"aliases": "foo"}}},
+				}})
+		})
+
+		Convey("Files requested by an alias are named by it", func() {
+			files := []*gfsFile{
+				{ID: 1, Name: "a.txt", Aliases: []string{"b.txt", "c.txt"}},
+				{ID: 2, Name: "d.txt"},
+			}
+			named := byRequestedName(files, []string{"a.txt", "c.txt", "d.txt"})
+			So(named, ShouldHaveLength, 3)
+			So(named[0].ID, ShouldEqual, 1)
+			So(named[0].Name, ShouldEqual, "a.txt")
+			So(named[1].ID, ShouldEqual, 1)
+			So(named[1].Name, ShouldEqual, "c.txt")
+			So(named[2].Name, ShouldEqual, "d.txt")
+			So(files[0].Name, ShouldEqual, "a.txt")
+			So(byRequestedName(files, []string{"e.txt"}), ShouldBeEmpty)
+		})
+
 		Convey("It should error out when a nonsensical command is given", func() {
 			args := []string{"commandnonexistent"}
 
@@ -335,6 +409,623 @@ func TestValidArguments(t *testing.T) {
 	})
 }
 
+func TestMetadata(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With metadata given for put", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("put", "file")
+		mf.StorageOptions.Metadata = `{"project": "apollo", "contentType": "text/plain", "version": {"$numberInt": "2"}}`
+		So(mf.ValidateCommand([]string{"put", "file"}), ShouldBeNil)
+
+		Convey("it is stored in the files document's metadata", func() {
+			So(mf.uploadMetadata(gfsFileMetadata{}), ShouldResemble, bson.D{
+				{Key: "project", Value: "apollo"},
+				{Key: "contentType", Value: "text/plain"},
+				{Key: "version", Value: int32(2)},
+			})
+		})
+
+		Convey("--type takes precedence over its contentType", func() {
+			So(mf.uploadMetadata(gfsFileMetadata{ContentType: "image/png"}), ShouldResemble, bson.D{
+				{Key: "project", Value: "apollo"},
+				{Key: "version", Value: int32(2)},
+				{Key: "contentType", Value: "image/png"},
+			})
+		})
+
+		Convey("it can't also be given in a file", func() {
+			mf.StorageOptions.MetadataFile = "metadata.json"
+			So(mf.ValidateCommand([]string{"put", "file"}), ShouldNotBeNil)
+		})
+	})
+
+	Convey("With --aliasesField and --storeOriginalPath", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("put", "file")
+		mf.StorageOptions.Aliases = []string{"a, b", "c"}
+		mf.StorageOptions.StoreOriginalPath = true
+		So(mf.ValidateCommand([]string{"put", "file"}), ShouldBeNil)
+		So(mf.aliases, ShouldResemble, []string{"a", "b", "c"})
+
+		Convey("the local path is stored in the metadata", func() {
+			path, err := mf.originalPath("testdata/file")
+			So(err, ShouldBeNil)
+			So(filepath.IsAbs(filepath.FromSlash(path)), ShouldBeTrue)
+			So(path, ShouldEndWith, "/testdata/file")
+			So(mf.uploadMetadata(gfsFileMetadata{OriginalPath: path}), ShouldResemble, bson.D{
+				{Key: "originalPath", Value: path},
+			})
+
+			path, err = mf.originalPath("-")
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "")
+		})
+
+		Convey("aliases are only given to a single file written by put", func() {
+			So(mf.ValidateCommand([]string{"put", "file", "other"}), ShouldNotBeNil)
+			So(mf.ValidateCommand([]string{"get", "file"}), ShouldNotBeNil)
+			mf.StorageOptions.Aliases = nil
+			So(mf.ValidateCommand([]string{"get", "file"}), ShouldNotBeNil)
+			So(mf.ValidateCommand([]string{"put_dir", "dir"}), ShouldBeNil)
+		})
+	})
+
+	Convey("A metadata query applies to the fields of the metadata document", t, func() {
+		query, err := parseMetadataQuery(`{"project": "apollo", "$or": [{"version": {"$gt": 1}}, {"draft": true}]}`)
+		So(err, ShouldBeNil)
+		So(query, ShouldResemble, bson.D{
+			{Key: "metadata.project", Value: "apollo"},
+			{Key: "$or", Value: bson.A{
+				bson.D{{Key: "metadata.version", Value: bson.D{{Key: "$gt", Value: int32(1)}}}},
+				bson.D{{Key: "metadata.draft", Value: true}},
+			}},
+		})
+
+		_, err = parseMetadataQuery(`{"project": `)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestJSONListing(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A file is listed as a line of JSON", t, func() {
+		metadata, err := bson.Marshal(bson.D{{Key: "contentType", Value: "text/plain"}, {Key: "project", Value: "apollo"}})
+		So(err, ShouldBeNil)
+		file := &gfsFile{
+			ID:          "report",
+			Name:        "report.txt",
+			Length:      1024,
+			ChunkSize:   261120,
+			UploadDate:  time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+			Md5:         "d41d8cd98f00b204e9800998ecf8427e",
+			Metadata:    gfsFileMetadata{ContentType: "text/plain"},
+			rawMetadata: bson.RawValue{Type: bsontype.EmbeddedDocument, Value: metadata},
+		}
+		listing, err := file.JSONListing()
+		So(err, ShouldBeNil)
+		So(listing, ShouldEqual, `{"_id":"report","filename":"report.txt","length":1024,"chunkSize":261120,`+
+			`"uploadDate":{"$date":"2021-06-01T12:00:00Z"},"md5":"d41d8cd98f00b204e9800998ecf8427e",`+
+			`"contentType":"text/plain","metadata":{"contentType":"text/plain","project":"apollo"}}`)
+
+		Convey("leaving out what the file doesn't have", func() {
+			file.Md5, file.Metadata, file.rawMetadata = "", gfsFileMetadata{}, bson.RawValue{}
+			listing, err := file.JSONListing()
+			So(err, ShouldBeNil)
+			So(listing, ShouldEqual, `{"_id":"report","filename":"report.txt","length":1024,"chunkSize":261120,`+
+				`"uploadDate":{"$date":"2021-06-01T12:00:00Z"}}`)
+		})
+	})
+}
+
+func TestDirectories(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("put_dir takes one local directory", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("put_dir", "")
+		So(mf.ValidateCommand([]string{"put_dir", "build"}), ShouldBeNil)
+		So(mf.FileName, ShouldEqual, "build")
+		So(mf.ValidateCommand([]string{"put_dir"}), ShouldNotBeNil)
+		So(mf.ValidateCommand([]string{"put_dir", "a", "b"}), ShouldNotBeNil)
+
+		mf.StorageOptions.LocalFileName = "file"
+		So(mf.ValidateCommand([]string{"put_dir", "build"}), ShouldNotBeNil)
+	})
+
+	Convey("--output-dir recreates the directories in filenames", t, func() {
+		dir := filepath.Join("out", "artifacts")
+		path, err := outputDirPath(dir, "linux/amd64/tool.tgz")
+		So(err, ShouldBeNil)
+		So(path, ShouldEqual, filepath.Join(dir, "linux", "amd64", "tool.tgz"))
+
+		path, err = outputDirPath(dir, "/etc/passwd")
+		So(err, ShouldBeNil)
+		So(path, ShouldEqual, filepath.Join(dir, "etc", "passwd"))
+
+		for _, name := range []string{"../escape", "a/../../escape", "/", "."} {
+			_, err = outputDirPath(dir, name)
+			So(err, ShouldNotBeNil)
+		}
+
+		mf := simpleMockMongoFilesInstanceWithFilename("get", "file")
+		mf.StorageOptions.OutputDir = dir
+		mf.StorageOptions.LocalFileName = "file"
+		So(mf.ValidateCommand([]string{"get", "file"}), ShouldNotBeNil)
+	})
+}
+
+func TestSyncPlan(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	uploaded := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	checksums := map[string]string{"local/b": "b-changed", "local/c": "c"}
+	checksum := func(path string) (string, error) { return checksums[path], nil }
+
+	local := map[string]localFileInfo{
+		"a":     {path: "local/a", size: 10, modTime: uploaded.Add(-time.Hour)},
+		"b":     {path: "local/b", size: 20, modTime: uploaded.Add(-time.Hour)},
+		"c":     {path: "local/c", size: 30, modTime: uploaded.Add(time.Hour)},
+		"d":     {path: "local/d", size: 40, modTime: uploaded.Add(time.Hour)},
+		"new/e": {path: "local/new/e", size: 50, modTime: uploaded},
+	}
+	remote := map[string][]*gfsFile{
+		"a":    {{Name: "a", Length: 10, UploadDate: uploaded}},
+		"b":    {{Name: "b", Length: 20, UploadDate: uploaded, Md5: "b"}},
+		"c":    {{Name: "c", Length: 30, UploadDate: uploaded, Md5: "c"}},
+		"d":    {{Name: "d", Length: 40, UploadDate: uploaded.Add(-time.Hour)}, {Name: "d", Length: 41, UploadDate: uploaded}},
+		"gone": {{Name: "gone", Length: 1, UploadDate: uploaded}},
+	}
+
+	Convey("Syncing to GridFS transfers new and changed local files", t, func() {
+		plan, err := planSync(local, remote, false, false, checksum)
+		So(err, ShouldBeNil)
+		So(plan.transfer, ShouldResemble, []string{"b", "d", "new/e"})
+		So(plan.remove, ShouldBeNil)
+		So(plan.unchanged, ShouldEqual, 2)
+
+		Convey("and with --delete removes the GridFS files that aren't local", func() {
+			plan, err := planSync(local, remote, false, true, checksum)
+			So(err, ShouldBeNil)
+			So(plan.remove, ShouldResemble, []string{"gone"})
+		})
+	})
+
+	Convey("Syncing from GridFS transfers the files uploaded after the local ones changed", t, func() {
+		plan, err := planSync(local, remote, true, true, checksum)
+		So(err, ShouldBeNil)
+		So(plan.transfer, ShouldResemble, []string{"a", "b", "d", "gone"})
+		So(plan.remove, ShouldResemble, []string{"new/e"})
+		So(plan.unchanged, ShouldEqual, 1)
+	})
+
+	Convey("sync takes one local directory and can't replace files itself", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("sync", "")
+		mf.StorageOptions.FromGridFS = true
+		mf.StorageOptions.DeleteExtraneous = true
+		So(mf.ValidateCommand([]string{"sync", "artifacts"}), ShouldBeNil)
+		So(mf.ValidateCommand([]string{"put", "artifacts"}), ShouldNotBeNil)
+
+		mf.StorageOptions.Replace = true
+		So(mf.ValidateCommand([]string{"sync", "artifacts"}), ShouldNotBeNil)
+	})
+}
+
+func TestTransferFiles(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With --numTransferWorkers", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("get", "file")
+		mf.StorageOptions.NumTransferWorkers = 4
+
+		Convey("every file is transferred, up to that many at a time", func() {
+			var lock sync.Mutex
+			var running, maxRunning int
+			transferred := make([]bool, 20)
+			err := mf.transferFiles(len(transferred), func(worker *MongoFiles, i int) error {
+				lock.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				lock.Unlock()
+				time.Sleep(time.Millisecond)
+				lock.Lock()
+				running--
+				transferred[i] = true
+				lock.Unlock()
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(maxRunning, ShouldBeLessThanOrEqualTo, 4)
+			for _, done := range transferred {
+				So(done, ShouldBeTrue)
+			}
+		})
+
+		Convey("a failed transfer is returned", func() {
+			err := mf.transferFiles(20, func(worker *MongoFiles, i int) error {
+				if i == 3 {
+					return fmt.Errorf("transfer failed")
+				}
+				return nil
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "transfer failed")
+		})
+
+		Convey("files are transferred one at a time with --local", func() {
+			mf.StorageOptions.LocalFileName = "file"
+			So(mf.ValidateCommand([]string{"put", "file"}), ShouldBeNil)
+			So(mf.StorageOptions.NumTransferWorkers, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestListOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With list", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("list", "")
+
+		Convey("--sort, --limit and --skip set the find options", func() {
+			mf.StorageOptions.Sort = "-length"
+			mf.StorageOptions.Limit = 10
+			mf.StorageOptions.Skip = 20
+			So(mf.ValidateCommand([]string{"list"}), ShouldBeNil)
+			opts := mf.listFindOptions()
+			So(opts.Sort, ShouldResemble, bson.D{{Key: "length", Value: -1}, {Key: "_id", Value: -1}})
+			So(*opts.Limit, ShouldEqual, 10)
+			So(*opts.Skip, ShouldEqual, 20)
+		})
+
+		Convey("invalid values are rejected", func() {
+			mf.StorageOptions.Sort = "md5"
+			So(mf.ValidateCommand([]string{"list"}), ShouldNotBeNil)
+			mf.StorageOptions.Sort = "name"
+			mf.StorageOptions.Limit = -1
+			So(mf.ValidateCommand([]string{"list"}), ShouldNotBeNil)
+			mf.StorageOptions.Limit = 0
+			mf.StorageOptions.UploadedAfter = "yesterday"
+			So(mf.ValidateCommand([]string{"list"}), ShouldNotBeNil)
+		})
+
+		Convey("--uploadedAfter and --uploadedBefore restrict the query", func() {
+			So(mf.ValidateCommand([]string{"list"}), ShouldBeNil)
+			So(mf.listFilter(bson.M{}), ShouldResemble, bson.M{})
+
+			mf.StorageOptions.UploadedAfter = "2021-06-01"
+			mf.StorageOptions.UploadedBefore = "2021-06-02T12:00:00Z"
+			So(mf.ValidateCommand([]string{"search", "report"}), ShouldBeNil)
+			So(mf.listFilter(bson.M{}), ShouldResemble, bson.D{{Key: "$and", Value: bson.A{bson.M{}, bson.M{"uploadDate": bson.M{
+				"$gt": time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+				"$lt": time.Date(2021, 6, 2, 12, 0, 0, 0, time.UTC),
+			}}}}})
+		})
+
+		Convey("the options can't be used with other commands", func() {
+			mf.StorageOptions.Limit = 10
+			So(mf.ValidateCommand([]string{"get", "file"}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestByteRange(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A --range resolves to an offset and count within the file", t, func() {
+		for _, tc := range []struct {
+			spec          string
+			offset, count int64
+		}{
+			{"0-99", 0, 100},
+			{"100-", 100, 900},
+			{"900-2000", 900, 100},
+			{"-10", 990, 10},
+			{"-5000", 0, 1000},
+		} {
+			r, err := parseByteRange(tc.spec)
+			So(err, ShouldBeNil)
+			offset, count, err := r.resolve(1000)
+			So(err, ShouldBeNil)
+			So(offset, ShouldEqual, tc.offset)
+			So(count, ShouldEqual, tc.count)
+		}
+
+		r, err := parseByteRange("1000-")
+		So(err, ShouldBeNil)
+		_, _, err = r.resolve(1000)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Invalid ranges are rejected", t, func() {
+		for _, spec := range []string{"", "10", "-", "-0", "a-b", "20-10", "-1-5"} {
+			_, err := parseByteRange(spec)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("--range is only used to get one file", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("get", "")
+		mf.StorageOptions.Range = "0-99"
+		So(mf.ValidateCommand([]string{"get", "file"}), ShouldBeNil)
+		So(mf.byteRange, ShouldResemble, &byteRange{start: 0, end: 99})
+		So(mf.ValidateCommand([]string{"get", "file", "other"}), ShouldNotBeNil)
+		So(mf.ValidateCommand([]string{"put", "file"}), ShouldNotBeNil)
+	})
+}
+
+func TestExpire(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("--olderThan takes days, weeks or a duration", t, func() {
+		for age, expected := range map[string]time.Duration{
+			"30d": 30 * 24 * time.Hour,
+			"2w":  14 * 24 * time.Hour,
+			"36h": 36 * time.Hour,
+		} {
+			duration, err := parseAge(age)
+			So(err, ShouldBeNil)
+			So(duration, ShouldEqual, expected)
+		}
+		for _, age := range []string{"", "d", "-1d", "30", "soon"} {
+			_, err := parseAge(age)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("expire deletes old files with names starting with its argument", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("expire", "")
+		So(mf.ValidateCommand([]string{"expire"}), ShouldNotBeNil)
+		mf.StorageOptions.OlderThan = "30d"
+		mf.StorageOptions.ExpireBatchSize = 100
+		So(mf.ValidateCommand([]string{"expire", "tmp/"}), ShouldBeNil)
+		So(mf.FileName, ShouldEqual, "tmp/")
+		So(mf.ValidateCommand([]string{"list"}), ShouldNotBeNil)
+
+		cutoff := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+		So(expireQuery(cutoff, "tmp/"), ShouldResemble, bson.M{
+			"uploadDate": bson.M{"$lt": cutoff},
+			"filename":   bson.M{"$regex": "^tmp/"},
+		})
+	})
+
+	Convey("Deletions are throttled to --maxDeletesPerSecond", t, func() {
+		So(throttleDelay(100, 0, 0), ShouldEqual, 0)
+		So(throttleDelay(100, 50, time.Second), ShouldEqual, time.Second)
+		So(throttleDelay(100, 50, 3*time.Second), ShouldEqual, 0)
+	})
+}
+
+func TestTargetIDs(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A list of _ids is split on commas outside documents and strings", t, func() {
+		So(splitIDList("a,b"), ShouldResemble, []string{"a", "b"})
+		So(splitIDList(`{"$oid":"5f9b3b3b3b3b3b3b3b3b3b3b"}, {"a": 1, "b": "x,y"}`), ShouldResemble,
+			[]string{`{"$oid":"5f9b3b3b3b3b3b3b3b3b3b3b"}`, ` {"a": 1, "b": "x,y"}`})
+	})
+
+	Convey("With get_id", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("get_id", "")
+		idFile := filepath.Join(t.TempDir(), "ids.txt")
+		So(ioutil.WriteFile(idFile, []byte("c\n\n{\"$oid\": \"5f9b3b3b3b3b3b3b3b3b3b3b\"}\na\n"), 0644), ShouldBeNil)
+
+		Convey("_ids come from the argument and --idFile, without duplicates", func() {
+			mf.StorageOptions.IDFile = idFile
+			So(mf.ValidateCommand([]string{"get_id", "a,b"}), ShouldBeNil)
+			ids, err := mf.targetIDs()
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []string{"a", "b", "c", `{"$oid": "5f9b3b3b3b3b3b3b3b3b3b3b"}`})
+
+			query, err := idQuery(ids)
+			So(err, ShouldBeNil)
+			oid, err := primitive.ObjectIDFromHex("5f9b3b3b3b3b3b3b3b3b3b3b")
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, bson.M{"_id": bson.M{"$in": []interface{}{"a", "b", "c", oid}}})
+		})
+
+		Convey("--idFile can replace the argument", func() {
+			So(mf.ValidateCommand([]string{"get_id"}), ShouldNotBeNil)
+			mf.StorageOptions.IDFile = idFile
+			So(mf.ValidateCommand([]string{"get_id"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{"delete_id"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{"get", "file"}), ShouldNotBeNil)
+		})
+
+		Convey("a single _id is queried directly", func() {
+			query, err := idQuery([]string{"a"})
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, bson.M{"_id": "a"})
+		})
+	})
+}
+
+func TestNotify(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("--notifyURL must be an http URL given with put or delete", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("put", "")
+		mf.StorageOptions.NotifyURL = "http://localhost:8080/gridfs"
+		So(mf.ValidateCommand([]string{"put", "file"}), ShouldBeNil)
+		So(mf.ValidateCommand([]string{"delete_regex", "^tmp"}), ShouldBeNil)
+		So(mf.ValidateCommand([]string{"get", "file"}), ShouldNotBeNil)
+
+		mf.StorageOptions.NotifyURL = "ftp://localhost/gridfs"
+		So(mf.ValidateCommand([]string{"put", "file"}), ShouldNotBeNil)
+	})
+
+	Convey("With --notifyURL", t, func() {
+		var lock sync.Mutex
+		var bodies []string
+		status := http.StatusNoContent
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			lock.Lock()
+			bodies = append(bodies, r.Header.Get("Content-Type")+" "+string(body))
+			lock.Unlock()
+			w.WriteHeader(status)
+		}))
+		defer server.Close()
+
+		mf := simpleMockMongoFilesInstanceWithFilename("put", "")
+		mf.StorageOptions.NotifyURL = server.URL
+		oid, err := primitive.ObjectIDFromHex("5f9b3b3b3b3b3b3b3b3b3b3b")
+		So(err, ShouldBeNil)
+		file := &gfsFile{ID: oid, Name: "a.txt", Length: 3, Md5: "900150983cd24fb0d6963f7d28e17f72"}
+
+		Convey("each operation is POSTed as a JSON event", func() {
+			So(mf.notify(putEvent, file), ShouldBeNil)
+			So(mf.notify(deleteEvent, &gfsFile{ID: "b", Name: "b.txt"}), ShouldBeNil)
+			So(bodies, ShouldResemble, []string{
+				`application/json {"operation":"put","filename":"a.txt","_id":{"$oid":"5f9b3b3b3b3b3b3b3b3b3b3b"},"length":3,"md5":"900150983cd24fb0d6963f7d28e17f72"}`,
+				`application/json {"operation":"delete","filename":"b.txt","_id":"b","length":0}`,
+			})
+		})
+
+		Convey("an event the URL doesn't accept is an error", func() {
+			status = http.StatusInternalServerError
+			So(mf.notify(putEvent, file), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Without --notifyURL nothing is sent", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("put", "")
+		So(mf.notify(putEvent, &gfsFile{ID: "a", Name: "a.txt"}), ShouldBeNil)
+	})
+}
+
+func TestExportArchive(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("export and import require --archive and take no arguments", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("export", "")
+		So(mf.ValidateCommand([]string{"export"}), ShouldNotBeNil)
+		mf.StorageOptions.Archive = "bucket.tar.gz"
+		So(mf.ValidateCommand([]string{"export"}), ShouldBeNil)
+		So(mf.ValidateCommand([]string{"import"}), ShouldBeNil)
+		So(mf.ValidateCommand([]string{"import", "file"}), ShouldNotBeNil)
+		So(mf.ValidateCommand([]string{"list"}), ShouldNotBeNil)
+	})
+
+	Convey("The archive format follows its name", t, func() {
+		So(archiveFormat("bucket.tar.gz"), ShouldEqual, "tar.gz")
+		So(archiveFormat("bucket.TGZ"), ShouldEqual, "tar.gz")
+		So(archiveFormat("bucket.zip"), ShouldEqual, "zip")
+		So(archiveFormat("bucket.tar"), ShouldEqual, "tar")
+		So(archiveFormat("-"), ShouldEqual, "tar")
+	})
+
+	Convey("Archive entries and their index can be read back", t, func() {
+		metadata, err := bson.Marshal(bson.D{{Key: "project", Value: "apollo"}})
+		So(err, ShouldBeNil)
+		uploaded := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		entry := newArchiveIndexEntry("files/0", &gfsFile{
+			ID:          primitive.NewObjectID(),
+			Name:        "docs/report.txt",
+			Length:      5,
+			ChunkSize:   255,
+			UploadDate:  uploaded,
+			Md5:         "5d41402abc4b2a76b9719d911017c592",
+			rawMetadata: bson.RawValue{Type: bsontype.EmbeddedDocument, Value: metadata},
+		})
+
+		for _, name := range []string{"bucket.tar", "bucket.tar.gz", "bucket.zip"} {
+			path := filepath.Join(t.TempDir(), name)
+			var index bytes.Buffer
+			So(writeArchiveIndex(&index, []archiveIndexEntry{entry}), ShouldBeNil)
+
+			writer, err := createArchive(path)
+			So(err, ShouldBeNil)
+			So(writer.writeEntry(archiveIndexName, int64(index.Len()), uploaded, &index), ShouldBeNil)
+			So(writer.writeEntry("files/0", 5, uploaded, strings.NewReader("hello")), ShouldBeNil)
+			So(writer.Close(), ShouldBeNil)
+
+			reader, err := openArchive(path)
+			So(err, ShouldBeNil)
+			entryName, data, err := reader.next()
+			So(err, ShouldBeNil)
+			So(entryName, ShouldEqual, archiveIndexName)
+			readIndex, err := readArchiveIndex(data)
+			So(err, ShouldBeNil)
+			So(readIndex, ShouldHaveLength, 1)
+			readEntry := readIndex["files/0"]
+			So(readEntry.ID, ShouldEqual, entry.ID)
+			So(readEntry.Filename, ShouldEqual, "docs/report.txt")
+			So(readEntry.UploadDate.Equal(uploaded), ShouldBeTrue)
+			So(readEntry.Md5, ShouldEqual, entry.Md5)
+			So(readEntry.Metadata, ShouldResemble, entry.Metadata)
+
+			entryName, data, err = reader.next()
+			So(err, ShouldBeNil)
+			So(entryName, ShouldEqual, "files/0")
+			content, err := ioutil.ReadAll(data)
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "hello")
+			_, _, err = reader.next()
+			So(err, ShouldEqual, io.EOF)
+			So(reader.Close(), ShouldBeNil)
+		}
+	})
+}
+
+func TestMoveAndCopy(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("mv and cp take a file and its new name", t, func() {
+		mf := simpleMockMongoFilesInstanceWithFilename("mv", "")
+		for _, command := range []string{"mv", "cp"} {
+			So(mf.ValidateCommand([]string{command, "old", "new"}), ShouldBeNil)
+			So(mf.FileName, ShouldEqual, "old")
+			So(mf.TargetFileName, ShouldEqual, "new")
+			So(mf.ValidateCommand([]string{command, "old"}), ShouldNotBeNil)
+			So(mf.ValidateCommand([]string{command, "old", "new", "extra"}), ShouldNotBeNil)
+		}
+
+		Convey("cp can copy a file to the same name in another bucket", func() {
+			So(mf.ValidateCommand([]string{"cp", "file", "file"}), ShouldNotBeNil)
+			mf.StorageOptions.ToPrefix = "archive"
+			So(mf.ValidateCommand([]string{"cp", "file", "file"}), ShouldBeNil)
+			dbName, prefix := mf.copyTarget()
+			So(dbName, ShouldEqual, testDB)
+			So(prefix, ShouldEqual, "archive")
+			So(mf.ValidateCommand([]string{"mv", "file", "other"}), ShouldNotBeNil)
+		})
+
+		Convey("cp only copies within a bucket on the server from 4.4", func() {
+			So(mf.canCopyOnServer(db.Version{4, 2, 0}), ShouldBeFalse)
+			So(mf.canCopyOnServer(db.Version{4, 4, 0}), ShouldBeTrue)
+			mf.StorageOptions.ToPrefix = "archive"
+			So(mf.canCopyOnServer(db.Version{4, 0, 0}), ShouldBeFalse)
+			So(mf.canCopyOnServer(db.Version{4, 2, 0}), ShouldBeTrue)
+		})
+
+		Convey("mv can't rename a file to its own name", func() {
+			So(mf.ValidateCommand([]string{"mv", "file", "file"}), ShouldNotBeNil)
+		})
+	})
+
+	Convey("A copy's files document keeps the length, chunk size and metadata of the source", t, func() {
+		uploaded := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		metadata, err := bson.Marshal(bson.D{{Key: "project", Value: "apollo"}})
+		So(err, ShouldBeNil)
+		source := &gfsFile{
+			ID:          "source",
+			Name:        "old",
+			Length:      1024,
+			ChunkSize:   255,
+			UploadDate:  uploaded.Add(-time.Hour),
+			rawMetadata: bson.RawValue{Type: bsontype.EmbeddedDocument, Value: metadata},
+		}
+		So(copiedFilesDoc(source, "copy", "new", uploaded), ShouldResemble, bson.D{
+			{Key: "_id", Value: "copy"},
+			{Key: "length", Value: int64(1024)},
+			{Key: "chunkSize", Value: 255},
+			{Key: "uploadDate", Value: primitive.NewDateTimeFromTime(uploaded)},
+			{Key: "filename", Value: "new"},
+			{Key: "metadata", Value: source.rawMetadata},
+		})
+	})
+}
+
 // Test that the output from mongofiles is actually correct
 func TestMongoFilesCommands(t *testing.T) {
 	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
@@ -678,6 +1369,49 @@ func TestMongoFilesCommands(t *testing.T) {
 			})
 		})
 
+		Convey("Testing 'put --replace-if-different' with a file that was put without a checksum should", func() {
+			localFile := util.ToUniversalPath("testdata/lorem_ipsum_multi_args_0.txt")
+			mf, err := simpleMongoFilesInstanceWithFilename("put", localFile)
+			So(err, ShouldBeNil)
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			Convey("compare the checksum of its chunks and skip the upload", func() {
+				mf, err := simpleMongoFilesInstanceWithFilename("put", localFile)
+				So(err, ShouldBeNil)
+				mf.StorageOptions.ReplaceIfDifferent = true
+				_, err = mf.Run(false)
+				So(err, ShouldBeNil)
+				versions, err := mf.findGFSFiles(bson.M{"filename": localFile})
+				So(err, ShouldBeNil)
+				So(versions, ShouldHaveLength, 1)
+			})
+
+			Convey("compare standard input after uploading it and remove the identical upload", func() {
+				contents, err := ioutil.ReadFile(localFile)
+				So(err, ShouldBeNil)
+				r, w, err := os.Pipe()
+				So(err, ShouldBeNil)
+				oldStdin := os.Stdin
+				os.Stdin = r
+				defer func() { os.Stdin = oldStdin }()
+				go func() {
+					w.Write(contents)
+					w.Close()
+				}()
+
+				mf, err := simpleMongoFilesInstanceWithFilename("put", localFile)
+				So(err, ShouldBeNil)
+				mf.StorageOptions.ReplaceIfDifferent = true
+				mf.StorageOptions.LocalFileName = "-"
+				_, err = mf.Run(false)
+				So(err, ShouldBeNil)
+				versions, err := mf.findGFSFiles(bson.M{"filename": localFile})
+				So(err, ShouldBeNil)
+				So(versions, ShouldHaveLength, 1)
+			})
+		})
+
 		Convey("Testing the 'put_id' command by putting some lorem ipsum file with 287613 bytes with different ids should succeed", func() {
 			for _, idToTest := range []string{`test_id`, `{"a":"b"}`, `{"$numberLong":"999999999999999"}`, `{"a":{"b":{"c":{}}}}`} {
 				runPutIDTestCase(idToTest, t)
@@ -0,0 +1,91 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Operations reported to --notifyURL.
+const (
+	putEvent    = "put"
+	deleteEvent = "delete"
+)
+
+// notifyTimeout bounds each request to --notifyURL.
+const notifyTimeout = 30 * time.Second
+
+// validateNotifyURL checks --notifyURL, which must be an http or https URL.
+func (mf *MongoFiles) validateNotifyURL() error {
+	if mf.StorageOptions.NotifyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(mf.StorageOptions.NotifyURL)
+	if err != nil {
+		return fmt.Errorf("invalid --notifyURL: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid --notifyURL '%v': must be an http or https URL", mf.StorageOptions.NotifyURL)
+	}
+	return nil
+}
+
+// notifyEvent returns the event POSTed to --notifyURL for an operation on a
+// file, as relaxed Extended JSON.
+func notifyEvent(operation string, file *gfsFile) ([]byte, error) {
+	event := bson.D{
+		{Key: "operation", Value: operation},
+		{Key: "filename", Value: file.Name},
+		{Key: "_id", Value: file.ID},
+		{Key: "length", Value: file.Length},
+	}
+	if file.Md5 != "" {
+		event = append(event, bson.E{Key: "md5", Value: file.Md5})
+	}
+	out, err := bson.MarshalExtJSON(event, false, false)
+	if err != nil {
+		return nil, fmt.Errorf("error converting the %v event of '%v' to JSON: %v", operation, file.Name, err)
+	}
+	return out, nil
+}
+
+// notify POSTs an event to --notifyURL after a file was put or deleted, so
+// that other processes can react to it without polling the files collection.
+// The operation has already succeeded, so an error only means that the
+// event was not delivered.
+func (mf *MongoFiles) notify(operation string, file *gfsFile) error {
+	if mf.StorageOptions.NotifyURL == "" {
+		return nil
+	}
+	event, err := notifyEvent(operation, file)
+	if err != nil {
+		return err
+	}
+	log.Logvf(log.DebugLow, "notifying %v of the %v of '%v'", mf.StorageOptions.NotifyURL, operation, file.Name)
+
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(mf.StorageOptions.NotifyURL, "application/json", bytes.NewReader(event))
+	if err != nil {
+		return fmt.Errorf("error notifying --notifyURL of the %v of '%v': %v", operation, file.Name, err)
+	}
+	defer resp.Body.Close()
+	// read the body so the connection can be reused
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("error notifying --notifyURL of the %v of '%v': %v", operation, file.Name, resp.Status)
+	}
+	return nil
+}
@@ -22,15 +22,25 @@ Manipulate gridfs files using the command line.
 Connection strings must begin with mongodb:// or mongodb+srv://.
 
 Possible commands include:
-	list      - list all files; 'filename' is an optional prefix which listed filenames must begin with
-	search    - search all files; 'filename' is a regex which listed filenames must match
-	put       - add files with filenames specified in the supporting arguments
-	put_id    - add a file with filename 'filename' and a given '_id'
-	get       - get files with filenames specified in the supporting arguments
-	get_id    - get a file with the given '_id'
-	get_regex - get files matching the supplied 'regex'
-	delete    - delete all files with filename 'filename'
-	delete_id - delete a file with the given '_id'
+	list         - list all files; 'filename' is an optional prefix which listed filenames or aliases must begin with
+	search       - search all files; 'filename' is a regex which listed filenames or aliases must match
+	search_meta  - search all files; 'query' is an Extended JSON query on the fields of the files' metadata
+	put          - add files with filenames specified in the supporting arguments
+	put_id       - add a file with filename 'filename' and a given '_id'
+	put_dir      - add every file in the directory 'localdir' and its subdirectories, named by their paths relative to it
+	sync         - copy the files in the directory 'localdir' that are new or changed to GridFS, or from GridFS with --from-gridfs
+	get          - get files with filenames or aliases specified in the supporting arguments
+	get_id       - get the files with the given comma-separated '_id's, or the '_id's in --idFile
+	get_regex    - get files matching the supplied 'regex'
+	delete       - delete all files with filename 'filename', and remove it from the aliases of other files
+	delete_id    - delete the files with the given comma-separated '_id's, or the '_id's in --idFile
+	delete_regex - delete files matching the supplied 'regex'
+	delete_query - delete files whose metadata matches 'query', an Extended JSON query like search_meta's
+	mv           - rename every version of the file 'filename' to 'newname'
+	cp           - copy the latest version of the file 'filename' to 'newname', into another bucket with --to-db and --to-prefix
+	export       - write every file, with its metadata, to the tar, tar.gz or zip file given by --archive
+	import       - add the files in an --archive written by export
+	expire       - delete the files uploaded more than --olderThan ago; 'filename' is an optional prefix which their names must begin with
 
 See http://docs.mongodb.com/database-tools/mongofiles/ for more information.`
 
@@ -90,23 +100,89 @@ type StorageOptions struct {
 	// 'LocalFileName' is an option that specifies what filename to use for (put|get)
 	LocalFileName string `long:"local" value-name:"<filename>" short:"l" description:"local filename for put|get"`
 
+	// 'OutputDir' is a directory that get writes files into, recreating the directories in their filenames
+	OutputDir string `long:"output-dir" value-name:"<directory>" description:"directory to write files to for get|get_id|get_regex, treating '/' in filenames as directory separators"`
+
+	// 'Range' makes get write only a range of bytes of the file, to stdout unless --local is given
+	Range string `long:"range" value-name:"<start>-<end>" description:"write only bytes start to end (inclusive) of the latest version of the file for get|get_id, to stdout unless --local is given; '<start>-' reads to the end and '-<count>' reads the last count bytes"`
+
+	// 'IDFile' names a file of _ids for get_id and delete_id, one Extended JSON _id per line
+	IDFile string `long:"idFile" value-name:"<filename>" description:"file of _ids for get_id|delete_id, one Extended JSON _id per line"`
+
 	// 'ContentType' is an option that specifies the Content/MIME type to use for 'put'
 	ContentType string `long:"type" value-nane:"<content-type>" short:"t" description:"content/MIME type for put (optional)"`
 
+	// ChunkSize sets the size of the chunks of files written by 'put'. Zero uses the driver default of 255 KiB.
+	ChunkSize int32 `long:"chunkSize" value-name:"<bytes>" description:"size in bytes of the GridFS chunks of files added with put|put_id; defaults to 261120 (255 KiB)"`
+
+	// 'Metadata' and 'MetadataFile' specify extra fields of the metadata document for 'put'
+	Metadata     string `long:"metadata" value-name:"<json>" description:"metadata for put, as an Extended JSON document stored in the files document's metadata field"`
+	MetadataFile string `long:"metadataFile" value-name:"<filename>" description:"file containing the metadata for put, as an Extended JSON document"`
+
+	// 'Aliases' are alternative names for a file written by 'put', which get, list and search match like its filename
+	Aliases []string `long:"aliasesField" value-name:"<alias>[,<alias>]*" description:"alternative names for the file added with put|put_id, stored in the aliases field of its files document; get, list and search match them as well as filenames (may be repeated)"`
+
+	// 'StoreOriginalPath' records where an uploaded file was read from
+	StoreOriginalPath bool `long:"storeOriginalPath" description:"store the absolute path of each local file added with put|put_id|put_dir|sync in the originalPath field of its metadata, where search_meta can find it"`
+
+	// 'FromGridFS' and 'DeleteExtraneous' set the direction of 'sync' and whether it removes files missing from the source
+	FromGridFS       bool `long:"from-gridfs" description:"sync from GridFS to the local directory instead of from the local directory to GridFS"`
+	DeleteExtraneous bool `long:"delete" description:"with sync, delete the files in the destination that are not in the source"`
+
+	// NumTransferWorkers is how many files get and put transfer at a time
+	NumTransferWorkers int `long:"numTransferWorkers" value-name:"<count>" default:"1" default-mask:"-" description:"number of files to transfer concurrently when get|get_regex|put are given several files (default: 1)"`
+
+	// IOWorkers is how many batches of chunks of each file get and put read or write at a time
+	IOWorkers int `long:"ioWorkers" value-name:"<count>" default:"1" default-mask:"-" description:"number of batches of chunks of each file to read or write concurrently with get|get_id|get_regex|put|put_id|put_dir|sync, to speed up the transfer of large files (default: 1)"`
+
 	// if set, 'Replace' will remove other files with same name after 'put'
 	Replace bool `long:"replace" short:"r" description:"remove other files with same name after put"`
 
+	// if set, 'ReplaceIfDifferent' skips 'put' when a file with the same name has the same MD5 checksum,
+	// and otherwise removes the other files with the same name after it
+	ReplaceIfDifferent bool `long:"replace-if-different" description:"skip put if a file with the same name has the same MD5 checksum, otherwise remove the other files with that name after put"`
+
+	// if set, 'Dedupe' skips 'put' when any file in the bucket has the same content, going by its MD5 checksum and length,
+	// and records the name as an alias of that file if it has another name
+	Dedupe bool `long:"dedupe" description:"skip put if a file with the same MD5 checksum and length is already in the bucket; if it has another name, add the name to its aliases instead of uploading the content again"`
+
+	// 'NotifyURL' receives a JSON event for each file put into or deleted from GridFS
+	NotifyURL string `long:"notifyURL" value-name:"<url>" description:"POST a JSON event with the operation, filename, _id, length and md5 of each file added by put|put_id|put_dir|sync or deleted by delete|delete_id|delete_regex|delete_query|sync to this URL once the operation succeeds"`
+
 	// GridFSPrefix specifies what GridFS prefix to use; defaults to 'fs'
 	GridFSPrefix string `long:"prefix" value-name:"<prefix>" default:"fs" default-mask:"-" description:"GridFS prefix to use"`
 
+	// 'Archive' is the file that 'export' writes to and 'import' reads from
+	Archive string `long:"archive" value-name:"<filename>" description:"archive for export|import; .zip, .tar.gz and .tgz files are compressed, other names and '-' (stdout or stdin) are tar files"`
+
+	// 'OlderThan', 'DryRun', 'ExpireBatchSize' and 'MaxDeletesPerSecond' control which files 'expire' deletes and how fast
+	OlderThan           string `long:"olderThan" value-name:"<age>" description:"with expire, delete files uploaded more than this long ago, e.g. 30d, 2w or 36h"`
+	DryRun              bool   `long:"dryRun" description:"with expire, list the files that would be deleted instead of deleting them"`
+	ExpireBatchSize     int    `long:"batchSize" value-name:"<count>" default:"1000" default-mask:"-" description:"number of files expire deletes at a time (default: 1000)"`
+	MaxDeletesPerSecond int    `long:"maxDeletesPerSecond" value-name:"<count>" description:"with expire, delete at most this many files per second; 0 means no limit"`
+
+	// 'ToDB' and 'ToPrefix' specify the bucket 'cp' copies to; they default to --db and --prefix
+	ToDB     string `long:"to-db" value-name:"<database-name>" description:"database of the GridFS bucket cp copies to (default: --db)"`
+	ToPrefix string `long:"to-prefix" value-name:"<prefix>" description:"GridFS prefix of the bucket cp copies to (default: --prefix)"`
+
 	// Specifies the write concern for each write operation that mongofiles writes to the target database.
 	// By default, mongofiles waits for a majority of members from the replica set to respond before returning.
 	// Cannot be used simultaneously with write concern options in a URI.
 	WriteConcern string `long:"writeConcern" value-name:"<write-concern>" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'"`
 
-	// RegexOptions specifies the options passed to "$regex" queries that are used for get_regex
+	// JSON prints the files found by list and search as newline-delimited JSON
+	JSON bool `long:"json" description:"print the files found by list|search|search_meta as one JSON document per line with their _id, length, chunkSize, uploadDate, md5, contentType and metadata"`
+
+	// 'Sort', 'Limit', 'Skip', 'UploadedAfter' and 'UploadedBefore' order, page and filter the files listed
+	Sort           string `long:"sort" value-name:"<field>" description:"sort the files listed by list|search|search_meta by uploadDate, length or name; prefix with '-' for descending order"`
+	Limit          int64  `long:"limit" value-name:"<count>" description:"list at most this many files with list|search|search_meta"`
+	Skip           int64  `long:"skip" value-name:"<count>" description:"skip this many files before listing with list|search|search_meta"`
+	UploadedAfter  string `long:"uploadedAfter" value-name:"<date>" description:"list only files uploaded after this date (e.g. 2006-01-02 or 2006-01-02T15:04:05Z) with list|search|search_meta"`
+	UploadedBefore string `long:"uploadedBefore" value-name:"<date>" description:"list only files uploaded before this date with list|search|search_meta"`
+
+	// RegexOptions specifies the options passed to "$regex" queries that are used for get_regex and delete_regex
 	// The default is to use no options, i.e. standard PCRE syntax
-	RegexOptions string `long:"regexOptions" default:"" value-name:"<regex-options>" description:"regex options used for get_regex"`
+	RegexOptions string `long:"regexOptions" default:"" value-name:"<regex-options>" description:"regex options used for get_regex|delete_regex"`
 }
 
 // Name returns a human-readable group name for storage options.
@@ -0,0 +1,162 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	driverOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// byteRange is the range of bytes given to get --range: "start-end" with an
+// inclusive end, "start-" for the rest of the file, or "-n" for its last n
+// bytes.
+type byteRange struct {
+	start, end int64 // end is -1 for the end of the file
+	suffix     int64
+}
+
+func parseByteRange(spec string) (*byteRange, error) {
+	invalid := fmt.Errorf("invalid --range '%v': expected <start>-<end>, <start>- or -<count>", spec)
+	dash := strings.Index(spec, "-")
+	if dash < 0 {
+		return nil, invalid
+	}
+	first, last := spec[:dash], spec[dash+1:]
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 {
+			return nil, invalid
+		}
+		return &byteRange{suffix: suffix}, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, invalid
+	}
+	end := int64(-1)
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return nil, invalid
+		}
+	}
+	return &byteRange{start: start, end: end}, nil
+}
+
+// resolve returns the offset and the number of bytes the range covers in a
+// file of the given length.
+func (r *byteRange) resolve(length int64) (int64, int64, error) {
+	if r.suffix > 0 {
+		if r.suffix > length {
+			return 0, length, nil
+		}
+		return length - r.suffix, r.suffix, nil
+	}
+	if r.start >= length {
+		return 0, 0, fmt.Errorf("--range starts at byte %v, after the end of the file (%v bytes)", r.start, length)
+	}
+	end := r.end
+	if end < 0 || end >= length {
+		end = length - 1
+	}
+	return r.start, end - r.start + 1, nil
+}
+
+// handleGetRange writes the --range of the latest of the given files to
+// --local, or stdout.
+func (mf *MongoFiles) handleGetRange(gridFiles []*gfsFile) (err error) {
+	sort.SliceStable(gridFiles, func(i, j int) bool { return gridFiles[i].UploadDate.After(gridFiles[j].UploadDate) })
+	gridFile := gridFiles[0]
+
+	offset, count, err := mf.byteRange.resolve(gridFile.Length)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if localFileName := mf.StorageOptions.LocalFileName; localFileName != "" && localFileName != "-" {
+		// assign the named err, which the deferred close reports into
+		var localFile *os.File
+		localFile, err = os.Create(localFileName)
+		if err != nil {
+			return fmt.Errorf("error while opening local file '%v': %v", localFileName, err)
+		}
+		dc := util.DeferredCloser{Closer: localFile}
+		defer dc.CloseWithErrorCapture(&err)
+		out = localFile
+	}
+
+	log.Logvf(log.Info, "writing bytes %v to %v of '%v'", offset, offset+count-1, gridFile.Name)
+	return mf.writeRange(gridFile, offset, count, out)
+}
+
+// writeRange writes count bytes of a GridFS file from offset, reading only
+// the chunks that hold them.
+func (mf *MongoFiles) writeRange(gridFile *gfsFile, offset, count int64, out io.Writer) (err error) {
+	if count == 0 {
+		return nil
+	}
+	chunkSize := int64(gridFile.ChunkSize)
+	if chunkSize <= 0 {
+		return fmt.Errorf("'%v' has an invalid chunk size of %v", gridFile.Name, chunkSize)
+	}
+	if mf.StorageOptions.IOWorkers > 1 {
+		return mf.writeRangeInParallel(gridFile, offset, count, out)
+	}
+	firstChunk, lastChunk := offset/chunkSize, (offset+count-1)/chunkSize
+
+	filter := bson.D{
+		{Key: "files_id", Value: gridFile.ID},
+		{Key: "n", Value: bson.D{{Key: "$gte", Value: firstChunk}, {Key: "$lte", Value: lastChunk}}},
+	}
+	findOpts := driverOptions.Find().SetSort(bson.D{{Key: "n", Value: 1}})
+	cursor, err := mf.bucket.GetChunksCollection().Find(context.Background(), filter, findOpts)
+	if err != nil {
+		return fmt.Errorf("error reading the chunks of '%v': %v", gridFile.Name, err)
+	}
+	dc := util.DeferredCloser{Closer: &util.CloserCursor{Cursor: cursor}}
+	defer dc.CloseWithErrorCapture(&err)
+
+	next := firstChunk
+	for cursor.Next(context.Background()) {
+		var chunk struct {
+			N    int64  `bson:"n"`
+			Data []byte `bson:"data"`
+		}
+		if err = cursor.Decode(&chunk); err != nil {
+			return fmt.Errorf("error decoding a chunk of '%v': %v", gridFile.Name, err)
+		}
+		if chunk.N != next {
+			return fmt.Errorf("chunk %v of '%v' is missing", next, gridFile.Name)
+		}
+
+		if part := chunkPart(chunk.N, chunk.Data, chunkSize, offset, count); len(part) > 0 {
+			if _, err = out.Write(part); err != nil {
+				return fmt.Errorf("error writing the range of '%v': %v", gridFile.Name, err)
+			}
+		}
+		next++
+	}
+	if err = cursor.Err(); err != nil {
+		return fmt.Errorf("error reading the chunks of '%v': %v", gridFile.Name, err)
+	}
+	if next <= lastChunk {
+		return fmt.Errorf("chunk %v of '%v' is missing", next, gridFile.Name)
+	}
+	return nil
+}
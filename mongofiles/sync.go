@@ -0,0 +1,248 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// localFileInfo describes a file found in the local directory of a sync.
+type localFileInfo struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// syncPlan lists the filenames a sync transfers and the ones it removes
+// from the destination.
+type syncPlan struct {
+	transfer  []string
+	remove    []string
+	unchanged int
+}
+
+// listLocalFiles returns the regular files under a directory by their paths
+// relative to it, using '/' as the separator.
+func listLocalFiles(root string) (map[string]localFileInfo, error) {
+	files := map[string]localFileInfo{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error reading local directory '%v': %v", root, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = localFileInfo{path: path, size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// listGFSFileVersions returns every GridFS file by filename, with the most
+// recently uploaded version last.
+func (mf *MongoFiles) listGFSFileVersions() (map[string][]*gfsFile, error) {
+	gridFiles, err := mf.findGFSFiles(bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	versions := map[string][]*gfsFile{}
+	for _, gridFile := range gridFiles {
+		versions[gridFile.Name] = append(versions[gridFile.Name], gridFile)
+	}
+	for _, files := range versions {
+		sort.SliceStable(files, func(i, j int) bool { return files[i].UploadDate.Before(files[j].UploadDate) })
+	}
+	return versions, nil
+}
+
+// localMD5 returns the hex MD5 checksum of a local file.
+func localMD5(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error while opening local file '%v': %v", path, err)
+	}
+	defer file.Close()
+	hash := md5.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("error while reading local file '%v': %v", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fileChanged reports whether a local file and the latest version of a
+// GridFS file differ. Files of the same length are compared by MD5 if the
+// GridFS file has one, and otherwise by whether the source was modified
+// after the destination was written.
+func fileChanged(local localFileInfo, remote *gfsFile, fromGridFS bool, checksum func(path string) (string, error)) (bool, error) {
+	if local.size != remote.Length {
+		return true, nil
+	}
+	if remote.Md5 != "" {
+		sum, err := checksum(local.path)
+		if err != nil {
+			return false, err
+		}
+		return sum != remote.Md5, nil
+	}
+	if fromGridFS {
+		return remote.UploadDate.After(local.modTime), nil
+	}
+	return local.modTime.After(remote.UploadDate), nil
+}
+
+// planSync works out which files a sync transfers and removes.
+func planSync(local map[string]localFileInfo, remote map[string][]*gfsFile, fromGridFS, deleteExtraneous bool,
+	checksum func(path string) (string, error)) (syncPlan, error) {
+	var plan syncPlan
+	names := make([]string, 0, len(local)+len(remote))
+	for name := range local {
+		names = append(names, name)
+	}
+	for name := range remote {
+		if _, ok := local[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		localInfo, inLocal := local[name]
+		versions, inRemote := remote[name]
+		inSource, inDestination := inLocal, inRemote
+		if fromGridFS {
+			inSource, inDestination = inRemote, inLocal
+		}
+		switch {
+		case !inSource:
+			if deleteExtraneous {
+				plan.remove = append(plan.remove, name)
+			}
+		case !inDestination:
+			plan.transfer = append(plan.transfer, name)
+		default:
+			changed, err := fileChanged(localInfo, versions[len(versions)-1], fromGridFS, checksum)
+			if err != nil {
+				return syncPlan{}, err
+			}
+			if changed {
+				plan.transfer = append(plan.transfer, name)
+			} else {
+				plan.unchanged++
+			}
+		}
+	}
+	return plan, nil
+}
+
+// handleSync contains the logic for the 'sync' command.
+func (mf *MongoFiles) handleSync() error {
+	root := mf.FileName
+	fromGridFS := mf.StorageOptions.FromGridFS
+	if fromGridFS {
+		if err := os.MkdirAll(root, 0755); err != nil {
+			return fmt.Errorf("error creating local directory '%v': %v", root, err)
+		}
+	} else if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return fmt.Errorf("'%v' is not a local directory", root)
+	}
+
+	local, err := listLocalFiles(root)
+	if err != nil {
+		return err
+	}
+	remote, err := mf.listGFSFileVersions()
+	if err != nil {
+		return err
+	}
+	plan, err := planSync(local, remote, fromGridFS, mf.StorageOptions.DeleteExtraneous, localMD5)
+	if err != nil {
+		return err
+	}
+
+	if fromGridFS {
+		err = mf.syncFromGridFS(root, plan, local, remote)
+	} else {
+		err = mf.syncToGridFS(plan, local, remote)
+	}
+	if err != nil {
+		return err
+	}
+	log.Logvf(log.Always, "sync complete: %v files transferred, %v deleted, %v unchanged",
+		len(plan.transfer), len(plan.remove), plan.unchanged)
+	return nil
+}
+
+// syncToGridFS uploads the new and changed local files, replacing the
+// previous versions of each, and deletes the files removed by the plan.
+func (mf *MongoFiles) syncToGridFS(plan syncPlan, local map[string]localFileInfo, remote map[string][]*gfsFile) error {
+	for _, name := range plan.transfer {
+		log.Logvf(log.Always, "adding gridFile: %v", name)
+		if _, err := mf.put(primitive.NewObjectID(), name, local[name].path); err != nil {
+			return err
+		}
+		for _, previous := range remote[name] {
+			if err := previous.Delete(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range plan.remove {
+		log.Logvf(log.Always, "deleting gridFile: %v", name)
+		for _, version := range remote[name] {
+			if err := version.Delete(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syncFromGridFS downloads the latest versions of the new and changed GridFS
+// files, and deletes the local files removed by the plan. Downloaded files
+// get their upload date as modification time, so that later syncs see them
+// as unchanged.
+func (mf *MongoFiles) syncFromGridFS(root string, plan syncPlan, local map[string]localFileInfo, remote map[string][]*gfsFile) error {
+	for _, name := range plan.transfer {
+		versions := remote[name]
+		latest := versions[len(versions)-1]
+		path, err := outputDirPath(root, name)
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("error creating directory for local file '%v': %v", path, err)
+		}
+		if err = mf.writeGFSFile(latest, path); err != nil {
+			return err
+		}
+		if err = os.Chtimes(path, latest.UploadDate, latest.UploadDate); err != nil {
+			return fmt.Errorf("error setting the modification time of local file '%v': %v", path, err)
+		}
+	}
+	for _, name := range plan.remove {
+		log.Logvf(log.Always, "deleting local file: %v", local[name].path)
+		if err := os.Remove(local[name].path); err != nil {
+			return fmt.Errorf("error deleting local file '%v': %v", local[name].path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	driverOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// newBucket returns a handle on the GridFS bucket given by --db and --prefix.
+func (mf *MongoFiles) newBucket() (*gridfs.Bucket, error) {
+	return mf.bucketFor(mf.StorageOptions.DB, mf.StorageOptions.GridFSPrefix)
+}
+
+// bucketFor returns a handle on the GridFS bucket with the given prefix in a database.
+func (mf *MongoFiles) bucketFor(dbName, prefix string) (*gridfs.Bucket, error) {
+	client, err := mf.SessionProvider.GetSession()
+	if err != nil {
+		return nil, fmt.Errorf("error getting client: %v", err)
+	}
+	bucket, err := gridfs.NewBucket(client.Database(dbName), &driverOptions.BucketOptions{Name: &prefix})
+	if err != nil {
+		return nil, fmt.Errorf("error getting GridFS bucket: %v", err)
+	}
+	return bucket, nil
+}
+
+// transferFiles calls transfer for each of count files, running up to
+// --numTransferWorkers transfers at a time. Each worker is a copy of mf with
+// its own bucket, so that the uploads of different workers don't share
+// state. No transfers are started after one fails, and the first error is
+// returned.
+func (mf *MongoFiles) transferFiles(count int, transfer func(worker *MongoFiles, i int) error) error {
+	numWorkers := mf.StorageOptions.NumTransferWorkers
+	if numWorkers > count {
+		numWorkers = count
+	}
+	if numWorkers <= 1 {
+		for i := 0; i < count; i++ {
+			if err := transfer(mf, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	workers := make([]*MongoFiles, numWorkers)
+	for w := range workers {
+		worker := *mf
+		if mf.bucket != nil {
+			bucket, err := mf.newBucket()
+			if err != nil {
+				return err
+			}
+			worker.bucket = bucket
+		}
+		workers[w] = &worker
+	}
+
+	indexes := make(chan int)
+	errs := make(chan error, numWorkers)
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func(worker *MongoFiles) {
+			defer wg.Done()
+			for i := range indexes {
+				if err := transfer(worker, i); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(worker)
+	}
+
+	var err error
+feed:
+	for i := 0; i < count; i++ {
+		select {
+		case indexes <- i:
+		case err = <-errs:
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if err == nil {
+		select {
+		case err = <-errs:
+		default:
+		}
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"fmt"
+	"strings"
+)
+
+// booleanWords are the cell values read as true and false, set with
+// --booleanWords. Words are matched without regard to case.
+type booleanWords struct {
+	words map[string]bool
+}
+
+// defaultBooleanWords are the words the boolean() type reads without
+// --booleanWords.
+var defaultBooleanWords = map[bool][]string{
+	true:  {"true", "1"},
+	false: {"false", "0"},
+}
+
+// parseBooleanWords parses a --booleanWords value of the form
+// 'true=yes,y,1;false=no,n,0'. Either side may be left out, in which case
+// that value keeps its default words.
+func parseBooleanWords(spec string) (*booleanWords, error) {
+	lists := map[bool][]string{}
+	for _, side := range strings.Split(spec, ";") {
+		if strings.TrimSpace(side) == "" {
+			continue
+		}
+		parts := strings.SplitN(side, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid --booleanWords '%v': expected true=<word>[,<word>]* or false=<word>[,<word>]*", side)
+		}
+		var value bool
+		switch strings.ToLower(strings.TrimSpace(parts[0])) {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		default:
+			return nil, fmt.Errorf("invalid --booleanWords '%v': words must be given for true or false", side)
+		}
+		if _, ok := lists[value]; ok {
+			return nil, fmt.Errorf("invalid --booleanWords: the words for %v are given twice", value)
+		}
+		var words []string
+		for _, word := range strings.Split(parts[1], ",") {
+			if word = strings.TrimSpace(word); word != "" {
+				words = append(words, word)
+			}
+		}
+		if len(words) == 0 {
+			return nil, fmt.Errorf("invalid --booleanWords '%v': no words are given for %v", side, value)
+		}
+		lists[value] = words
+	}
+	if len(lists) == 0 {
+		return nil, fmt.Errorf("invalid --booleanWords '%v': no words are given", spec)
+	}
+
+	bw := &booleanWords{words: map[string]bool{}}
+	for _, value := range []bool{true, false} {
+		words, ok := lists[value]
+		if !ok {
+			words = defaultBooleanWords[value]
+		}
+		for _, word := range words {
+			word = strings.ToLower(word)
+			if other, ok := bw.words[word]; ok && other != value {
+				return nil, fmt.Errorf("invalid --booleanWords: '%v' is given for both true and false", word)
+			}
+			bw.words[word] = value
+		}
+	}
+	return bw, nil
+}
+
+// parse returns the boolean a cell value stands for, if any.
+func (bw *booleanWords) parse(in string) (value bool, ok bool) {
+	value, ok = bw.words[strings.ToLower(strings.TrimSpace(in))]
+	return
+}
+
+// setBooleanWords makes the boolean() and auto() columns read the words of
+// --booleanWords as booleans.
+func setBooleanWords(colSpecs []ColumnSpec, words *booleanWords) {
+	if words == nil {
+		return
+	}
+	for _, spec := range colSpecs {
+		switch p := spec.Parser.(type) {
+		case *FieldBooleanParser:
+			p.words = words
+		case *FieldAutoParser:
+			p.booleans = words
+		}
+	}
+}
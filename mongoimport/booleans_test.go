@@ -0,0 +1,75 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestBooleanWords(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Parsing --booleanWords", t, func() {
+		Convey("reads the words for true and false", func() {
+			words, err := parseBooleanWords("true=yes,Y,1;false=no,n,0")
+			So(err, ShouldBeNil)
+			for in, expected := range map[string]bool{"yes": true, "YES": true, " y ": true, "1": true, "No": false, "0": false} {
+				value, ok := words.parse(in)
+				So(ok, ShouldBeTrue)
+				So(value, ShouldEqual, expected)
+			}
+			_, ok := words.parse("true")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("keeps the default words of a value left out", func() {
+			words, err := parseBooleanWords("true=oui")
+			So(err, ShouldBeNil)
+			value, ok := words.parse("false")
+			So(ok, ShouldBeTrue)
+			So(value, ShouldBeFalse)
+			_, ok = words.parse("true")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("rejects malformed values", func() {
+			for _, spec := range []string{"", "yes", "maybe=yes", "true=", "true=a;true=b", "true=x;false=x", "false=1"} {
+				_, err := parseBooleanWords(spec)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("With --booleanWords set on the columns", t, func() {
+		words, err := parseBooleanWords("true=yes,1;false=no,0")
+		So(err, ShouldBeNil)
+		colSpecs, err := ParseTypedHeaders([]string{"active.boolean()", "note.auto()", "count.int32()"}, pgStop)
+		So(err, ShouldBeNil)
+		setBooleanWords(colSpecs, words)
+
+		Convey("boolean() columns only read the words", func() {
+			doc, err := tokensToBSON(colSpecs, []string{"YES", "x", "1"}, 0, false, false, nil)
+			So(err, ShouldBeNil)
+			So(doc[0], ShouldResemble, bson.E{Key: "active", Value: true})
+			_, err = tokensToBSON(colSpecs, []string{"true", "x", "1"}, 0, false, false, nil)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("auto columns read the words that aren't numbers", func() {
+			doc, err := tokensToBSON(colSpecs, []string{"no", "no", "1"}, 0, false, false, nil)
+			So(err, ShouldBeNil)
+			So(doc[1], ShouldResemble, bson.E{Key: "note", Value: false})
+			doc, err = tokensToBSON(colSpecs, []string{"no", "0", "1"}, 0, false, false, nil)
+			So(err, ShouldBeNil)
+			So(doc[1], ShouldResemble, bson.E{Key: "note", Value: int32(0)})
+		})
+	})
+}
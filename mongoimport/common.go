@@ -9,6 +9,7 @@ package mongoimport
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -489,9 +490,15 @@ type coercionError struct{}
 func (coercionError) Error() string { return "coercionError" }
 
 // tokensToBSON reads in slice of records - along with ordered column names -
-// and returns a BSON document for the record.
-func tokensToBSON(colSpecs []ColumnSpec, tokens []string, numProcessed uint64, ignoreBlanks bool, useArrayIndexFields bool) (bson.D, error) {
+// and returns a BSON document for the record. Tokens beyond the columns, and
+// those that fail to parse with --parseGrace=autoCast, are read with
+// autoParser, so that they follow --decimalSeparator, --thousandsSeparator
+// and --booleanWords like auto() columns do.
+func tokensToBSON(colSpecs []ColumnSpec, tokens []string, numProcessed uint64, ignoreBlanks bool, useArrayIndexFields bool, autoParser *FieldAutoParser) (bson.D, error) {
 	log.Logvf(log.DebugHigh, "got line: %v", tokens)
+	if autoParser == nil {
+		autoParser = &FieldAutoParser{}
+	}
 	var parsedValue interface{}
 	document := bson.D{}
 	for index, token := range tokens {
@@ -506,7 +513,7 @@ func tokensToBSON(colSpecs []ColumnSpec, tokens []string, numProcessed uint64, i
 					numProcessed, colSpecs[index].Name, token, colSpecs[index].TypeName)
 				switch colSpecs[index].ParseGrace {
 				case pgAutoCast:
-					parsedValue = autoParse(token)
+					parsedValue, _ = autoParser.Parse(token)
 				case pgSkipField:
 					continue
 				case pgSkipRow:
@@ -527,7 +534,7 @@ func tokensToBSON(colSpecs []ColumnSpec, tokens []string, numProcessed uint64, i
 				document = append(document, bson.E{Key: colSpecs[index].Name, Value: parsedValue})
 			}
 		} else {
-			parsedValue = autoParse(token)
+			parsedValue, _ = autoParser.Parse(token)
 			key := "field" + strconv.Itoa(index)
 			if util.StringSliceContains(ColumnNames(colSpecs), key) {
 				return nil, fmt.Errorf("duplicate field name - on %v - for token #%v ('%v') in document #%v",
@@ -545,30 +552,46 @@ func tokensToBSON(colSpecs []ColumnSpec, tokens []string, numProcessed uint64, i
 //     (1). A field contains an invalid series of characters
 //     (2). Two fields are the same (e.g. a,a)
 //     (3). One field implies there is a value, another implies there is a document (e.g. a,a.b)
+//     (4). Two fields differ only in case (e.g. name,Name)
 //
 // In the case that --useArrayIndexFields is set, fields are also invalid in the following cases:
 //
-//     (4). One field implies there is a value, another implies there is an array (e.g. a,a.0).
-//     (5). One field implies that there is a document, another implies there is an array.
+//     (5). One field implies there is a value, another implies there is an array (e.g. a,a.0).
+//     (6). One field implies that there is a document, another implies there is an array.
 //          (e.g. a.b,a.0 or a.b.c,a.0.c)
-//     (6). The indexes for an array don't start from 0 (e.g. a.1,a.2)
-//     (7). Array indexes are out of order (e.g. a.0,a.2,a.1)
-//     (8). An array is missing an index (e.g. a.0,a.2)
+//     (7). The indexes for an array don't start from 0 (e.g. a.1,a.2)
+//     (8). Array indexes are out of order (e.g. a.0,a.2,a.1)
+//     (9). An array is missing an index (e.g. a.0,a.2)
+//
+// Every invalid field is reported in the error, so that a field list can be
+// fixed in one go before anything is imported.
 func validateFields(inputFields []string, useArrayIndexFields bool) error {
+	var problems []string
+	var validFields []string
 	for _, field := range inputFields {
-
 		// Here we check validity for case (1).
-		if strings.HasSuffix(field, ".") {
-			return fmt.Errorf("field '%v' cannot end with a '.'", field)
+		if err := validateFieldName(field); err != nil {
+			problems = append(problems, err.Error())
+			continue
 		}
-		if strings.HasPrefix(field, ".") {
-			return fmt.Errorf("field '%v' cannot start with a '.'", field)
+		validFields = append(validFields, field)
+	}
+
+	// Here we check validity for case (4).
+	spellings := map[string][]string{}
+	var folded []string
+	for _, field := range validFields {
+		key := strings.ToLower(field)
+		if _, ok := spellings[key]; !ok {
+			folded = append(folded, key)
 		}
-		if strings.HasPrefix(field, "$") {
-			return fmt.Errorf("field '%v' cannot start with a '$'", field)
+		if !util.StringSliceContains(spellings[key], field) {
+			spellings[key] = append(spellings[key], field)
 		}
-		if strings.Contains(field, "..") {
-			return fmt.Errorf("field '%v' cannot contain consecutive '.' characters", field)
+	}
+	for _, key := range folded {
+		if len(spellings[key]) > 1 {
+			problems = append(problems, fmt.Sprintf("fields '%v' differ only in case", strings.Join(spellings[key], "', '")))
 		}
 	}
 
@@ -580,16 +603,45 @@ func validateFields(inputFields []string, useArrayIndexFields bool) error {
 	// be another map or a bool. If useArrayIndexFields is set, the interface{} can also be
 	// a slice of interfaces which could be maps, bools, or other slices.
 	// The tree is equivalent to the structure of the BSON document that
-	// would be constructed by the list of fields provided.
+	// would be constructed by the list of fields provided. A field that can't
+	// be added leaves the tree as it was, so the remaining fields are still checked.
 	fieldTree := make(map[string]interface{})
 
-	for _, field := range inputFields {
+	for _, field := range validFields {
 		fieldParts := strings.Split(field, ".")
 		_, err := addFieldToTree(fieldParts, field, "", fieldTree, useArrayIndexFields)
 		if err != nil {
-			return err
+			problems = append(problems, err.Error())
 		}
 	}
+
+	switch len(problems) {
+	case 0:
+		return nil
+	case 1:
+		return errors.New(problems[0])
+	default:
+		return fmt.Errorf("%v problems with the fields:\n\t%v", len(problems), strings.Join(problems, "\n\t"))
+	}
+}
+
+// validateFieldName checks that a field name is made of valid characters.
+func validateFieldName(field string) error {
+	if strings.HasSuffix(field, ".") {
+		return fmt.Errorf("field '%v' cannot end with a '.'", field)
+	}
+	if strings.HasPrefix(field, ".") {
+		return fmt.Errorf("field '%v' cannot start with a '.'", field)
+	}
+	if strings.HasPrefix(field, "$") {
+		return fmt.Errorf("field '%v' cannot start with a '$'", field)
+	}
+	if strings.Contains(field, "..") {
+		return fmt.Errorf("field '%v' cannot contain consecutive '.' characters", field)
+	}
+	if strings.Contains(field, "\x00") {
+		return fmt.Errorf("field '%v' cannot contain a null character", field)
+	}
 	return nil
 }
 
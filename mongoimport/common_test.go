@@ -141,6 +141,25 @@ func TestValidateFields(t *testing.T) {
 		Convey("if the fields contain the same keys, an error should be thrown", func() {
 			So(validateFields([]string{"a", "ba", "a"}, false), ShouldNotBeNil)
 		})
+		Convey("if the fields differ only in case, an error should be thrown", func() {
+			So(validateFields([]string{"name", "b", "Name"}, false), ShouldNotBeNil)
+			So(validateFields([]string{"a.Name", "a.name"}, false), ShouldNotBeNil)
+			So(validateFields([]string{"Name", "name.first"}, false), ShouldBeNil)
+		})
+		Convey("every invalid field should be reported at once", func() {
+			err := validateFields([]string{"$id", "Total", "a", "a.b", "total", "c..d", "e", "e"}, false)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "5 problems with the fields:")
+			for _, problem := range []string{
+				"field '$id' cannot start with a '$'",
+				"field 'c..d' cannot contain consecutive '.' characters",
+				"fields 'Total', 'total' differ only in case",
+				"fields 'a' and 'a.b' are incompatible",
+				"fields cannot be identical: 'e' and 'e'",
+			} {
+				So(err.Error(), ShouldContainSubstring, problem)
+			}
+		})
 	})
 }
 
@@ -333,7 +352,7 @@ func TestTokensToBSON(t *testing.T) {
 				{"b", int32(2)},
 				{"c", "hello"},
 			}
-			bsonD, err := tokensToBSON(colSpecs, tokens, uint64(0), false, false)
+			bsonD, err := tokensToBSON(colSpecs, tokens, uint64(0), false, false, nil)
 			So(err, ShouldBeNil)
 			So(bsonD, ShouldResemble, expectedDocument)
 		})
@@ -352,7 +371,7 @@ func TestTokensToBSON(t *testing.T) {
 				{"field3", "mongodb"},
 				{"field4", "user"},
 			}
-			bsonD, err := tokensToBSON(colSpecs, tokens, uint64(0), false, false)
+			bsonD, err := tokensToBSON(colSpecs, tokens, uint64(0), false, false, nil)
 			So(err, ShouldBeNil)
 			So(bsonD, ShouldResemble, expectedDocument)
 		})
@@ -363,7 +382,7 @@ func TestTokensToBSON(t *testing.T) {
 				{"field3", new(FieldAutoParser), pgAutoCast, "auto", []string{"field3"}},
 			}
 			tokens := []string{"1", "2", "hello", "mongodb", "user"}
-			_, err := tokensToBSON(colSpecs, tokens, uint64(0), false, false)
+			_, err := tokensToBSON(colSpecs, tokens, uint64(0), false, false, nil)
 			So(err, ShouldNotBeNil)
 		})
 		Convey("fields with nested values should be set appropriately", func() {
@@ -381,7 +400,7 @@ func TestTokensToBSON(t *testing.T) {
 				{"b", int32(2)},
 				{"c", c},
 			}
-			bsonD, err := tokensToBSON(colSpecs, tokens, uint64(0), false, false)
+			bsonD, err := tokensToBSON(colSpecs, tokens, uint64(0), false, false, nil)
 			So(err, ShouldBeNil)
 			So(expectedDocument[0].Key, ShouldResemble, bsonD[0].Key)
 			So(expectedDocument[0].Value, ShouldResemble, bsonD[0].Value)
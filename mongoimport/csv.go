@@ -43,6 +43,18 @@ type CSVInputReader struct {
 
 	// useArrayIndexFields is whether field names include array indexes
 	useArrayIndexFields bool
+
+	// normalizeHeaders is how the field names of the header line are
+	// rewritten, if at all
+	normalizeHeaders string
+
+	// booleanWords are the words the columns of the header line read as
+	// booleans, if set
+	booleanWords *booleanWords
+
+	// numberFormat is how the numbers in the columns of the header line are
+	// written, if not the default
+	numberFormat *numberFormat
 }
 
 // CSVConverter implements the Converter interface for CSV input.
@@ -52,6 +64,7 @@ type CSVConverter struct {
 	index               uint64
 	ignoreBlanks        bool
 	useArrayIndexFields bool
+	autoParser          *FieldAutoParser
 	rejectWriter        *gocsv.Writer
 }
 
@@ -84,6 +97,11 @@ func (r *CSVInputReader) ReadAndValidateHeader() (err error) {
 		return err
 	}
 	r.colSpecs = ParseAutoHeaders(fields)
+	if err = normalizeColumnSpecs(r.colSpecs, r.normalizeHeaders); err != nil {
+		return err
+	}
+	setBooleanWords(r.colSpecs, r.booleanWords)
+	setNumberFormat(r.colSpecs, r.numberFormat)
 	return validateReaderFields(ColumnNames(r.colSpecs), r.useArrayIndexFields)
 }
 
@@ -98,6 +116,11 @@ func (r *CSVInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) (err
 	if err != nil {
 		return err
 	}
+	if err = normalizeColumnSpecs(r.colSpecs, r.normalizeHeaders); err != nil {
+		return err
+	}
+	setBooleanWords(r.colSpecs, r.booleanWords)
+	setNumberFormat(r.colSpecs, r.numberFormat)
 	return validateReaderFields(ColumnNames(r.colSpecs), r.useArrayIndexFields)
 }
 
@@ -107,6 +130,7 @@ func (r *CSVInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) (err
 func (r *CSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (retErr error) {
 	csvRecordChan := make(chan Converter, r.numDecoders)
 	csvErrChan := make(chan error)
+	autoParser := &FieldAutoParser{booleans: r.booleanWords, numbers: r.numberFormat}
 
 	// begin reading from source
 	go func() {
@@ -129,6 +153,7 @@ func (r *CSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 				index:               r.numProcessed,
 				ignoreBlanks:        r.ignoreBlanks,
 				useArrayIndexFields: r.useArrayIndexFields,
+				autoParser:          autoParser,
 				rejectWriter:        r.csvRejectWriter,
 			}
 			r.numProcessed++
@@ -151,6 +176,7 @@ func (c CSVConverter) Convert() (b bson.D, err error) {
 		c.index,
 		c.ignoreBlanks,
 		c.useArrayIndexFields,
+		c.autoParser,
 	)
 	if _, ok := err.(coercionError); ok {
 		c.Print()
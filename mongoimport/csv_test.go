@@ -284,6 +284,22 @@ func TestCSVReadAndValidateHeader(t *testing.T) {
 			So(NewCSVInputReader(colSpecs, bytes.NewReader([]byte(contents)), os.Stdout, 1, false, false).ReadAndValidateHeader(), ShouldNotBeNil)
 		})
 
+		Convey("setting the header with --normalizeHeaders should clean up the field names", func() {
+			contents := "  Order ID ,Customer.First Name,$price,unitPrice.double()"
+			r := NewCSVInputReader([]ColumnSpec{}, bytes.NewReader([]byte(contents)), os.Stdout, 1, false, false)
+			r.normalizeHeaders = normalizeSnake
+			So(r.ReadAndValidateHeader(), ShouldBeNil)
+			So(ColumnNames(r.colSpecs), ShouldResemble, []string{"order_id", "customer.first_name", "price", "unit_price.double"})
+			So(r.colSpecs[1].NameParts, ShouldResemble, []string{"customer", "first_name"})
+
+			contents = "Order ID.int32(),Customer.First Name.string(),unitPrice.double()"
+			r = NewCSVInputReader([]ColumnSpec{}, bytes.NewReader([]byte(contents)), os.Stdout, 1, false, false)
+			r.normalizeHeaders = normalizeLower
+			So(r.ReadAndValidateTypedHeader(pgAutoCast), ShouldBeNil)
+			So(ColumnNames(r.colSpecs), ShouldResemble, []string{"order id", "customer.first name", "unitprice"})
+			So(r.colSpecs[2].TypeName, ShouldEqual, "double")
+		})
+
 		Convey("setting the header using an empty file should return EOF", func() {
 			contents := ""
 			colSpecs := []ColumnSpec{}
@@ -0,0 +1,99 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/huimingz/mongo-tools/common/log"
+)
+
+// Ways --normalizeHeaders can rewrite the field names of a header line.
+const (
+	normalizeLower       = "lower"
+	normalizeSnake       = "snake"
+	normalizeStripSpaces = "strip-spaces"
+)
+
+// normalizeHeader rewrites a field name from a header line into a clean BSON
+// key. Each '.'-separated part of the name is trimmed and rewritten on its
+// own, so that dotted names still build subdocuments; parts left empty are
+// dropped and leading '$' characters are removed. The modes are:
+//
+//	lower:        lowercase the name
+//	snake:        lowercase the name, splitting camelCase words, and join the
+//	              words with '_' in place of spaces and other punctuation
+//	strip-spaces: remove all whitespace from the name
+func normalizeHeader(name, mode string) string {
+	var parts []string
+	for _, part := range strings.Split(name, ".") {
+		part = strings.TrimLeft(strings.TrimSpace(part), "$")
+		switch mode {
+		case normalizeLower:
+			part = strings.ToLower(part)
+		case normalizeSnake:
+			part = snakeCase(part)
+		case normalizeStripSpaces:
+			part = strings.Join(strings.Fields(part), "")
+		}
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// snakeCase lowercases s and joins its words with '_'. A word ends at any
+// character that isn't a letter or digit, and where a lowercase letter or
+// digit is followed by an uppercase letter.
+func snakeCase(s string) string {
+	var words []string
+	var word []rune
+	endWord := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	var prev rune
+	for _, r := range s {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			endWord()
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)):
+			endWord()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+		prev = r
+	}
+	endWord()
+	return strings.Join(words, "_")
+}
+
+// normalizeColumnSpecs applies --normalizeHeaders to the columns read from a
+// header line, before their names are validated.
+func normalizeColumnSpecs(colSpecs []ColumnSpec, mode string) error {
+	if mode == "" {
+		return nil
+	}
+	for i, spec := range colSpecs {
+		name := normalizeHeader(spec.Name, mode)
+		if name == "" {
+			return fmt.Errorf("header field '%v' is empty once normalized", spec.Name)
+		}
+		if name != spec.Name {
+			log.Logvf(log.DebugLow, "normalized header field '%v' to '%v'", spec.Name, name)
+		}
+		colSpecs[i].Name = name
+		colSpecs[i].NameParts = strings.Split(name, ".")
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNormalizeHeader(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With --normalizeHeaders", t, func() {
+		Convey("every mode trims the name and removes illegal parts", func() {
+			for _, mode := range []string{normalizeLower, normalizeSnake, normalizeStripSpaces} {
+				So(normalizeHeader(" $total ", mode), ShouldEqual, "total")
+				So(normalizeHeader(".a..b.", mode), ShouldEqual, "a.b")
+			}
+		})
+
+		Convey("lower lowercases the name", func() {
+			So(normalizeHeader("Ship To.City", normalizeLower), ShouldEqual, "ship to.city")
+		})
+
+		Convey("snake joins the words of the name with '_'", func() {
+			So(normalizeHeader("Ship To.City", normalizeSnake), ShouldEqual, "ship_to.city")
+			So(normalizeHeader("customerID", normalizeSnake), ShouldEqual, "customer_id")
+			So(normalizeHeader("unit-price (USD)", normalizeSnake), ShouldEqual, "unit_price_usd")
+			So(normalizeHeader("line2Total", normalizeSnake), ShouldEqual, "line2_total")
+		})
+
+		Convey("strip-spaces removes the whitespace from the name", func() {
+			So(normalizeHeader("Ship  To.City\tName", normalizeStripSpaces), ShouldEqual, "ShipTo.CityName")
+		})
+
+		Convey("a name left empty is an error", func() {
+			colSpecs := ParseAutoHeaders([]string{"a", " $ "})
+			So(normalizeColumnSpecs(colSpecs, normalizeSnake), ShouldNotBeNil)
+		})
+	})
+}
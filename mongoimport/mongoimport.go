@@ -79,6 +79,20 @@ type MongoImport struct {
 
 	// type of node the SessionProvider is connected to
 	nodeType db.NodeType
+
+	// files to import when --dbTemplate or --collectionTemplate is used
+	inputFiles []string
+
+	// words read as booleans, from --booleanWords
+	booleanWords *booleanWords
+
+	// how numbers are written, from --decimalSeparator and --thousandsSeparator
+	numberFormat *numberFormat
+
+	// namespaces already dropped when --drop is used with --routeField or
+	// name templates
+	droppedLock sync.Mutex
+	dropped     map[string]bool
 }
 
 type InputReader interface {
@@ -151,6 +165,10 @@ func (imp *MongoImport) validateSettings(args []string) error {
 		}
 	}
 
+	if imp.InputOptions.DecimalSeparator == "" {
+		imp.InputOptions.DecimalSeparator = "."
+	}
+
 	// ensure headers are supplied for CSV/TSV
 	if imp.InputOptions.Type == CSV ||
 		imp.InputOptions.Type == TSV {
@@ -175,10 +193,34 @@ func (imp *MongoImport) validateSettings(args []string) error {
 				return fmt.Errorf("incompatible options: --fieldFile and --headerline")
 			}
 		}
+		if imp.InputOptions.NormalizeHeaders != "" && !imp.InputOptions.HeaderLine {
+			return fmt.Errorf("--normalizeHeaders can only be used with --headerline")
+		}
 
 		if _, err := ValidatePG(imp.InputOptions.ParseGrace); err != nil {
 			return err
 		}
+
+		// check the whole field list before anything is imported; a header
+		// line is checked once it's read
+		if !imp.InputOptions.HeaderLine {
+			colSpecs, err := imp.getFieldColumns()
+			if err != nil {
+				return err
+			}
+			if err = validateFields(ColumnNames(colSpecs), imp.InputOptions.UseArrayIndexFields); err != nil {
+				return err
+			}
+		}
+		if imp.InputOptions.BooleanWords != "" {
+			if imp.booleanWords, err = parseBooleanWords(imp.InputOptions.BooleanWords); err != nil {
+				return err
+			}
+		}
+		imp.numberFormat, err = newNumberFormat(imp.InputOptions.DecimalSeparator, imp.InputOptions.ThousandsSeparator)
+		if err != nil {
+			return err
+		}
 		if imp.InputOptions.Legacy {
 			return fmt.Errorf("cannot use --legacy if input type is not JSON")
 		}
@@ -199,6 +241,15 @@ func (imp *MongoImport) validateSettings(args []string) error {
 		if imp.InputOptions.ColumnsHaveTypes {
 			return fmt.Errorf("can not use --columnsHaveTypes when input type is JSON")
 		}
+		if imp.InputOptions.NormalizeHeaders != "" {
+			return fmt.Errorf("can not use --normalizeHeaders when input type is JSON")
+		}
+		if imp.InputOptions.BooleanWords != "" {
+			return fmt.Errorf("can not use --booleanWords when input type is JSON")
+		}
+		if imp.InputOptions.DecimalSeparator != "." || imp.InputOptions.ThousandsSeparator != "" {
+			return fmt.Errorf("can not use --decimalSeparator or --thousandsSeparator when input type is JSON")
+		}
 	}
 
 	// deprecated
@@ -260,6 +311,21 @@ func (imp *MongoImport) validateSettings(args []string) error {
 		imp.IngestOptions.BulkBufferSize = 1000
 	}
 
+	if imp.InputOptions.DBTemplate != "" || imp.InputOptions.CollectionTemplate != "" {
+		return imp.validateTemplateSettings(args)
+	}
+
+	if imp.IngestOptions.RouteField != "" {
+		if err := validateFields([]string{imp.IngestOptions.RouteField}, false); err != nil {
+			return fmt.Errorf("invalid --routeField argument: %v", err)
+		}
+		// documents are routed to their own collections, so a default
+		// collection is only needed for those without the field
+		if imp.ToolOptions.Collection == "" && imp.InputOptions.File == "" {
+			return nil
+		}
+	}
+
 	// ensure we have a valid string to use for the collection
 	if imp.ToolOptions.Collection == "" {
 		log.Logvf(log.Always, "no collection specified")
@@ -316,6 +382,29 @@ func (fsp *fileSizeProgressor) Progress() (int64, int64) {
 // number of documents successfully imported to the appropriate namespace,
 // the number of failures, and any error encountered in doing this
 func (imp *MongoImport) ImportDocuments() (uint64, uint64, error) {
+	if imp.inputFiles == nil {
+		return imp.importSource()
+	}
+	var processedCount, failureCount uint64
+	var err error
+	for _, file := range imp.inputFiles {
+		if err = imp.useInputFile(file); err != nil {
+			break
+		}
+		log.Logvf(log.Always, "importing '%v' into %v", file, imp.namespaceDescription())
+		// the counts are totals across all files imported so far
+		processedCount, failureCount, err = imp.importSource()
+		if err != nil {
+			err = fmt.Errorf("error importing '%v': %v", file, err)
+			break
+		}
+	}
+	return processedCount, failureCount, err
+}
+
+// importSource imports the documents from a single input source, either
+// --file or stdin.
+func (imp *MongoImport) importSource() (uint64, uint64, error) {
 	source, fileSize, err := imp.getSourceReader()
 	if err != nil {
 		return 0, 0, err
@@ -339,7 +428,7 @@ func (imp *MongoImport) ImportDocuments() (uint64, uint64, error) {
 	}
 
 	bar := &progress.Bar{
-		Name:      fmt.Sprintf("%v.%v", imp.ToolOptions.DB, imp.ToolOptions.Collection),
+		Name:      imp.namespaceDescription(),
 		Watching:  &fileSizeProgressor{fileSize, inputReader},
 		Writer:    log.Writer(0),
 		BarLength: progressBarLength,
@@ -363,9 +452,7 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (uint64, uint64
 
 	log.Logvf(log.Always, "connected to: %v", util.SanitizeURI(imp.ToolOptions.URI.ConnectionString))
 
-	log.Logvf(log.Info, "ns: %v.%v",
-		imp.ToolOptions.Namespace.DB,
-		imp.ToolOptions.Namespace.Collection)
+	log.Logvf(log.Info, "ns: %v", imp.namespaceDescription())
 
 	// check if the server is a replica set, mongos, or standalone
 	imp.nodeType, err = imp.SessionProvider.GetNodeType()
@@ -374,8 +461,21 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (uint64, uint64
 	}
 	log.Logvf(log.Info, "connected to node type: %v", imp.nodeType)
 
-	// drop the database if necessary
-	if imp.IngestOptions.Drop {
+	// drop the database if necessary; routed collections are dropped as
+	// they're first written to, and collections several input files are
+	// imported into are only dropped once
+	if imp.IngestOptions.Drop && (imp.IngestOptions.RouteField != "" || imp.inputFiles != nil) {
+		if imp.dropped == nil {
+			imp.dropped = make(map[string]bool)
+		}
+		if imp.IngestOptions.RouteField == "" {
+			collection := session.Database(imp.ToolOptions.DB).
+				Collection(imp.ToolOptions.Collection)
+			if err := imp.dropCollectionOnce(collection); err != nil {
+				return 0, 0, err
+			}
+		}
+	} else if imp.IngestOptions.Drop {
 		log.Logvf(log.Always, "dropping: %v.%v",
 			imp.ToolOptions.DB,
 			imp.ToolOptions.Collection)
@@ -447,12 +547,10 @@ func (imp *MongoImport) runInsertionWorker(readDocs chan bson.D) (err error) {
 	if err != nil {
 		return fmt.Errorf("error connecting to mongod: %v", err)
 	}
-	collection := session.Database(imp.ToolOptions.DB).Collection(imp.ToolOptions.Collection)
 
-	inserter := db.NewUnorderedBufferedBulkInserter(collection, imp.IngestOptions.BulkBufferSize).
-		SetBypassDocumentValidation(imp.IngestOptions.BypassDocumentValidation).
-		SetOrdered(imp.IngestOptions.MaintainInsertionOrder).
-		SetUpsert(true)
+	// one inserter per target collection, created as documents for it arrive
+	inserters := make(map[string]*db.BufferedBulkInserter)
+	var names []string
 
 readLoop:
 	for {
@@ -461,7 +559,29 @@ readLoop:
 			if !alive {
 				break readLoop
 			}
-			err := imp.importDocument(inserter, document)
+			name, err := imp.routeDocument(document)
+			if err != nil {
+				atomic.AddUint64(&imp.failureCount, 1)
+				if imp.IngestOptions.StopOnError {
+					return err
+				}
+				log.Logvf(log.Always, "skipping document: %v", err)
+				continue
+			}
+			inserter, ok := inserters[name]
+			if !ok {
+				collection := session.Database(imp.ToolOptions.DB).Collection(name)
+				if err = imp.dropCollectionOnce(collection); err != nil {
+					return err
+				}
+				inserter = db.NewUnorderedBufferedBulkInserter(collection, imp.IngestOptions.BulkBufferSize).
+					SetBypassDocumentValidation(imp.IngestOptions.BypassDocumentValidation).
+					SetOrdered(imp.IngestOptions.MaintainInsertionOrder).
+					SetUpsert(true)
+				inserters[name] = inserter
+				names = append(names, name)
+			}
+			err = imp.importDocument(inserter, document)
 			if db.FilterError(imp.IngestOptions.StopOnError, err) != nil {
 				return err
 			}
@@ -469,9 +589,68 @@ readLoop:
 			return nil
 		}
 	}
-	result, err := inserter.Flush()
-	imp.updateCounts(result, err)
-	return db.FilterError(imp.IngestOptions.StopOnError, err)
+	for _, name := range names {
+		result, err := inserters[name].Flush()
+		imp.updateCounts(result, err)
+		if err = db.FilterError(imp.IngestOptions.StopOnError, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namespaceDescription returns the namespace documents are imported into,
+// for logging and the progress bar.
+func (imp *MongoImport) namespaceDescription() string {
+	if imp.IngestOptions.RouteField == "" {
+		return fmt.Sprintf("%v.%v", imp.ToolOptions.DB, imp.ToolOptions.Collection)
+	}
+	return fmt.Sprintf("%v.<%v>", imp.ToolOptions.DB, imp.IngestOptions.RouteField)
+}
+
+// routeDocument returns the name of the collection a document is imported
+// into: the value of its --routeField if it has one, and --collection
+// otherwise.
+func (imp *MongoImport) routeDocument(document bson.D) (string, error) {
+	if imp.IngestOptions.RouteField == "" {
+		return imp.ToolOptions.Collection, nil
+	}
+	value := getUpsertValue(imp.IngestOptions.RouteField, document)
+	if value == nil {
+		if imp.ToolOptions.Collection == "" {
+			return "", fmt.Errorf("document has no '%v' field and no --collection was given", imp.IngestOptions.RouteField)
+		}
+		return imp.ToolOptions.Collection, nil
+	}
+	name, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("value of '%v' is not a string: %v", imp.IngestOptions.RouteField, value)
+	}
+	if err := util.ValidateCollectionName(name); err != nil {
+		return "", fmt.Errorf("invalid collection name in '%v': %v", imp.IngestOptions.RouteField, err)
+	}
+	return name, nil
+}
+
+// dropCollectionOnce drops a collection that documents are imported into, if
+// --drop is set and the collection hasn't been dropped yet during this
+// import. Workers wait for the drop before writing to the collection.
+func (imp *MongoImport) dropCollectionOnce(collection *mongo.Collection) error {
+	if imp.dropped == nil {
+		return nil
+	}
+	imp.droppedLock.Lock()
+	defer imp.droppedLock.Unlock()
+	ns := collection.Database().Name() + "." + collection.Name()
+	if imp.dropped[ns] {
+		return nil
+	}
+	log.Logvf(log.Always, "dropping: %v", ns)
+	if err := collection.Drop(nil); err != nil {
+		return err
+	}
+	imp.dropped[ns] = true
+	return nil
 }
 
 func (imp *MongoImport) updateCounts(result *mongo.BulkWriteResult, err error) {
@@ -546,9 +725,8 @@ func splitInlineHeader(header string) (headers []string) {
 	return
 }
 
-// getInputReader returns an implementation of InputReader based on the input type
-func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
-	var colSpecs []ColumnSpec
+// getFieldColumns returns the columns given with --fields or --fieldFile, if any.
+func (imp *MongoImport) getFieldColumns() ([]ColumnSpec, error) {
 	var headers []string
 	var err error
 	if imp.InputOptions.Fields != nil {
@@ -560,13 +738,19 @@ func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
 		}
 	}
 	if imp.InputOptions.ColumnsHaveTypes {
-		colSpecs, err = ParseTypedHeaders(headers, ParsePG(imp.InputOptions.ParseGrace))
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		colSpecs = ParseAutoHeaders(headers)
+		return ParseTypedHeaders(headers, ParsePG(imp.InputOptions.ParseGrace))
+	}
+	return ParseAutoHeaders(headers), nil
+}
+
+// getInputReader returns an implementation of InputReader based on the input type
+func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
+	colSpecs, err := imp.getFieldColumns()
+	if err != nil {
+		return nil, err
 	}
+	setBooleanWords(colSpecs, imp.booleanWords)
+	setNumberFormat(colSpecs, imp.numberFormat)
 
 	// header fields validation can only happen once we have an input reader
 	if !imp.InputOptions.HeaderLine {
@@ -579,9 +763,17 @@ func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
 
 	ignoreBlanks := imp.IngestOptions.IgnoreBlanks && imp.InputOptions.Type != JSON
 	if imp.InputOptions.Type == CSV {
-		return NewCSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks, imp.InputOptions.UseArrayIndexFields), nil
+		r := NewCSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks, imp.InputOptions.UseArrayIndexFields)
+		r.normalizeHeaders = imp.InputOptions.NormalizeHeaders
+		r.booleanWords = imp.booleanWords
+		r.numberFormat = imp.numberFormat
+		return r, nil
 	} else if imp.InputOptions.Type == TSV {
-		return NewTSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks, imp.InputOptions.UseArrayIndexFields), nil
+		r := NewTSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks, imp.InputOptions.UseArrayIndexFields)
+		r.normalizeHeaders = imp.InputOptions.NormalizeHeaders
+		r.booleanWords = imp.booleanWords
+		r.numberFormat = imp.numberFormat
+		return r, nil
 	}
 	return NewJSONInputReader(imp.InputOptions.JSONArray, imp.InputOptions.Legacy, in, imp.IngestOptions.NumDecodingWorkers), nil
 }
@@ -245,6 +245,59 @@ func TestMongoImportValidateSettings(t *testing.T) {
 			So(imp.validateSettings([]string{}), ShouldNotBeNil)
 		})
 
+		Convey("an error should be thrown if --normalizeHeaders is used without --headerline", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.NormalizeHeaders = normalizeSnake
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.Type = CSV
+			fields := "a,b,c"
+			imp.InputOptions.Fields = &fields
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.Fields = nil
+			imp.InputOptions.HeaderLine = true
+			So(imp.validateSettings([]string{}), ShouldBeNil)
+		})
+
+		Convey("an error should be thrown if --booleanWords is invalid or used with JSON input", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.BooleanWords = "true=yes"
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			So(imp.validateSettings([]string{}), ShouldBeNil)
+			So(imp.booleanWords, ShouldNotBeNil)
+			imp.InputOptions.BooleanWords = "yes"
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if the number separators are invalid or used with JSON input", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.DecimalSeparator = ","
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			So(imp.validateSettings([]string{}), ShouldBeNil)
+			So(imp.numberFormat, ShouldNotBeNil)
+			imp.InputOptions.ThousandsSeparator = ","
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if --fields or --fieldFile lists invalid fields", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.Type = CSV
+			fields := "a,a.b,B,b"
+			imp.InputOptions.Fields = &fields
+			err := imp.validateSettings([]string{})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "2 problems with the fields")
+
+			imp = NewMockMongoImport()
+			imp.InputOptions.Type = TSV
+			fieldFile := "testdata/test_fields_invalid.txt"
+			imp.InputOptions.FieldFile = &fieldFile
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+		})
+
 		Convey("an error should be thrown if --fields is used with JSON input", func() {
 			imp := NewMockMongoImport()
 			fields := ""
@@ -274,7 +327,7 @@ func TestMongoImportValidateSettings(t *testing.T) {
 		Convey("no error should be thrown if --headerline is not supplied "+
 			"but --fieldFile is supplied", func() {
 			imp := NewMockMongoImport()
-			fieldFile := "test.csv"
+			fieldFile := "testdata/test_fields_valid.txt"
 			imp.InputOptions.FieldFile = &fieldFile
 			imp.InputOptions.Type = CSV
 			So(imp.validateSettings([]string{}), ShouldBeNil)
@@ -368,7 +421,7 @@ func TestMongoImportValidateSettings(t *testing.T) {
 
 		Convey("no error should be thrown if --fieldFile is supplied with CSV import", func() {
 			imp := NewMockMongoImport()
-			fieldFile := "test.csv"
+			fieldFile := "testdata/test_fields_valid.txt"
 			imp.InputOptions.FieldFile = &fieldFile
 			imp.InputOptions.Type = CSV
 			So(imp.validateSettings([]string{}), ShouldBeNil)
@@ -414,6 +467,54 @@ func TestMongoImportValidateSettings(t *testing.T) {
 			imp.InputOptions.Legacy = true
 			So(imp.validateSettings([]string{}), ShouldNotBeNil)
 		})
+
+		Convey("no collection is needed when reading stdin with --routeField", func() {
+			imp := NewMockMongoImport()
+			imp.ToolOptions.Namespace.Collection = ""
+			imp.IngestOptions.RouteField = "event.type"
+			So(imp.validateSettings([]string{}), ShouldBeNil)
+			So(imp.ToolOptions.Namespace.Collection, ShouldEqual, "")
+		})
+
+		Convey("an error should be thrown if --routeField isn't a valid field", func() {
+			imp := NewMockMongoImport()
+			imp.IngestOptions.RouteField = "$type"
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+			imp.IngestOptions.RouteField = "event..type"
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRouteDocument(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a mongoimport routing documents by a field", t, func() {
+		imp := NewMockMongoImport()
+		imp.IngestOptions.RouteField = "event.type"
+
+		Convey("documents go to the collection named by the field", func() {
+			name, err := imp.routeDocument(bson.D{{Key: "event", Value: bson.D{{Key: "type", Value: "clicks"}}}})
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "clicks")
+		})
+
+		Convey("documents without the field go to --collection", func() {
+			name, err := imp.routeDocument(bson.D{{Key: "event", Value: bson.D{}}})
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, imp.ToolOptions.Collection)
+
+			imp.ToolOptions.Collection = ""
+			_, err = imp.routeDocument(bson.D{{Key: "event", Value: bson.D{}}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("documents whose field isn't a collection name are rejected", func() {
+			_, err := imp.routeDocument(bson.D{{Key: "event", Value: bson.D{{Key: "type", Value: int32(3)}}}})
+			So(err, ShouldNotBeNil)
+			_, err = imp.routeDocument(bson.D{{Key: "event", Value: bson.D{{Key: "type", Value: "a$b"}}}})
+			So(err, ShouldNotBeNil)
+		})
 	})
 }
 
@@ -0,0 +1,112 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// numberFormat is how the numbers in CSV and TSV cells are written, set with
+// --decimalSeparator and --thousandsSeparator, e.g. "1.234,56". With
+// --thousandsSeparator '.', auto() cells that merely look like grouped
+// numbers, such as IP addresses ("10.200.300.400") or versions ("1.100"),
+// are read as integers; give those columns the string() type.
+type numberFormat struct {
+	decimal   string
+	thousands string
+}
+
+// newNumberFormat validates the separators of --decimalSeparator and
+// --thousandsSeparator, returning nil if they are the defaults.
+func newNumberFormat(decimal, thousands string) (*numberFormat, error) {
+	if decimal == "." && thousands == "" {
+		return nil, nil
+	}
+	seps := []struct{ name, value string }{{"--decimalSeparator", decimal}}
+	if thousands != "" {
+		seps = append(seps, struct{ name, value string }{"--thousandsSeparator", thousands})
+	}
+	for _, sep := range seps {
+		if utf8.RuneCountInString(sep.value) != 1 {
+			return nil, fmt.Errorf("%v must be a single character", sep.name)
+		}
+		if strings.ContainsAny(sep.value, "0123456789+-eE") {
+			return nil, fmt.Errorf("%v cannot be a digit, a sign or an exponent marker", sep.name)
+		}
+	}
+	if decimal == thousands {
+		return nil, fmt.Errorf("--decimalSeparator and --thousandsSeparator must be different")
+	}
+	return &numberFormat{decimal: decimal, thousands: thousands}, nil
+}
+
+// normalize rewrites a number written in the format into the form strconv
+// reads. It returns false if the cell isn't a number in the format: the
+// thousands separator must split the integer part into groups of three
+// digits, and only the decimal separator may mark the fraction.
+func (nf *numberFormat) normalize(in string) (string, bool) {
+	intPart, fracPart := in, ""
+	hasFrac := false
+	if i := strings.Index(in, nf.decimal); i >= 0 {
+		intPart, fracPart, hasFrac = in[:i], in[i+len(nf.decimal):], true
+		if strings.Contains(fracPart, nf.decimal) {
+			return "", false
+		}
+	}
+	if nf.decimal != "." && strings.Contains(in, ".") && nf.thousands != "." {
+		return "", false
+	}
+	if nf.thousands != "" {
+		if strings.Contains(fracPart, nf.thousands) {
+			return "", false
+		}
+		if strings.Contains(intPart, nf.thousands) {
+			sign := ""
+			if strings.HasPrefix(intPart, "-") || strings.HasPrefix(intPart, "+") {
+				sign, intPart = intPart[:1], intPart[1:]
+			}
+			groups := strings.Split(intPart, nf.thousands)
+			if len(groups[0]) < 1 || len(groups[0]) > 3 {
+				return "", false
+			}
+			for _, group := range groups[1:] {
+				if len(group) != 3 {
+					return "", false
+				}
+			}
+			intPart = sign + strings.Join(groups, "")
+		}
+	}
+	if hasFrac {
+		return intPart + "." + fracPart, true
+	}
+	return intPart, true
+}
+
+// setNumberFormat makes the numeric and auto() columns read numbers written
+// in the format of --decimalSeparator and --thousandsSeparator.
+func setNumberFormat(colSpecs []ColumnSpec, format *numberFormat) {
+	if format == nil {
+		return
+	}
+	for _, spec := range colSpecs {
+		switch p := spec.Parser.(type) {
+		case *FieldAutoParser:
+			p.numbers = format
+		case *FieldDoubleParser:
+			p.numbers = format
+		case *FieldDecimalParser:
+			p.numbers = format
+		case *FieldInt32Parser:
+			p.numbers = format
+		case *FieldInt64Parser:
+			p.numbers = format
+		}
+	}
+}
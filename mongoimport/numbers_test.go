@@ -0,0 +1,93 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNumberFormat(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Validating the separators", t, func() {
+		nf, err := newNumberFormat(".", "")
+		So(err, ShouldBeNil)
+		So(nf, ShouldBeNil)
+		nf, err = newNumberFormat(",", ".")
+		So(err, ShouldBeNil)
+		So(nf, ShouldResemble, &numberFormat{decimal: ",", thousands: "."})
+
+		for _, seps := range [][2]string{{",", ","}, {"", "."}, {",,", "."}, {",", "1"}, {"-", ""}, {",", "e"}} {
+			_, err = newNumberFormat(seps[0], seps[1])
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("With European separators", t, func() {
+		nf := &numberFormat{decimal: ",", thousands: "."}
+
+		Convey("numbers are rewritten for strconv", func() {
+			for in, expected := range map[string]string{
+				"1.234,56":     "1234.56",
+				"-1.234.567":   "-1234567",
+				"12,5":         "12.5",
+				"1,5e3":        "1.5e3",
+				"999":          "999",
+				"+12.345,0001": "+12345.0001",
+			} {
+				number, ok := nf.normalize(in)
+				So(ok, ShouldBeTrue)
+				So(number, ShouldEqual, expected)
+			}
+		})
+
+		Convey("misplaced separators are not numbers", func() {
+			for _, in := range []string{"3.14", "1.23,4.5", "1234.567,8", ".123", "1,234,5"} {
+				_, ok := nf.normalize(in)
+				So(ok, ShouldBeFalse)
+			}
+		})
+
+		Convey("the numeric and auto columns read them", func() {
+			colSpecs, err := ParseTypedHeaders([]string{"price.double()", "total.decimal()", "count.int64()", "note.auto()"}, pgStop)
+			So(err, ShouldBeNil)
+			setNumberFormat(colSpecs, nf)
+
+			doc, err := tokensToBSON(colSpecs, []string{"1.234,56", "0,1", "12.000", "2,5"}, 0, false, false, nil)
+			So(err, ShouldBeNil)
+			total, _ := primitive.ParseDecimal128("0.1")
+			So(doc, ShouldResemble, bson.D{
+				{"price", 1234.56},
+				{"total", total},
+				{"count", int64(12000)},
+				{"note", 2.5},
+			})
+
+			doc, err = tokensToBSON(colSpecs, []string{"1", "1", "1", "3.14"}, 0, false, false, nil)
+			So(err, ShouldBeNil)
+			So(doc[3], ShouldResemble, bson.E{Key: "note", Value: "3.14"})
+
+			_, err = tokensToBSON(colSpecs, []string{"3.14", "1", "1", "1"}, 0, false, false, nil)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("cells cast with autoCast and extra cells read them too", func() {
+			colSpecs, err := ParseTypedHeaders([]string{"count.int32()"}, pgAutoCast)
+			So(err, ShouldBeNil)
+			setNumberFormat(colSpecs, nf)
+
+			doc, err := tokensToBSON(colSpecs, []string{"2,5", "1.234,5"}, 0, false, false, &FieldAutoParser{numbers: nf})
+			So(err, ShouldBeNil)
+			So(doc, ShouldResemble, bson.D{{"count", 2.5}, {"field1", 1234.5}})
+		})
+	})
+}
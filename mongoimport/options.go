@@ -36,6 +36,9 @@ type InputOptions struct {
 	// Treats the input source's first line as field list (csv and tsv only).
 	HeaderLine bool `long:"headerline" description:"use first line in input source as the field list (CSV and TSV only)"`
 
+	// Rewrites the field names of the header line into clean BSON keys.
+	NormalizeHeaders string `long:"normalizeHeaders" value-name:"<mode>" choice:"lower" choice:"snake" choice:"strip-spaces" description:"with --headerline, trim the field names of the header line, remove leading '$' characters and empty name parts, and then rewrite them - lower: lowercase them. snake: lowercase them and join their words with '_', e.g. 'Order ID' becomes 'order_id'. strip-spaces: remove their whitespace"`
+
 	// Indicates that the underlying input source contains a single JSON array with the documents to import.
 	JSONArray bool `long:"jsonArray" description:"treat input source as a JSON array"`
 
@@ -46,11 +49,24 @@ type InputOptions struct {
 	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"input format to import: json, csv, or tsv"`
 
 	// Indicates that field names include type descriptions
-	ColumnsHaveTypes bool `long:"columnsHaveTypes" description:"indicates that the field list (from --fields, --fieldsFile, or --headerline) specifies types; They must be in the form of '<colName>.<type>(<arg>)'. The type can be one of: auto, binary, boolean, date, date_go, date_ms, date_oracle, decimal, double, int32, int64, string. For each of the date types, the argument is a datetime layout string. For the binary type, the argument can be one of: base32, base64, hex. All other types take an empty argument. Only valid for CSV and TSV imports. e.g. zipcode.string(), thumbnail.binary(base64)"`
+	ColumnsHaveTypes bool `long:"columnsHaveTypes" description:"indicates that the field list (from --fields, --fieldsFile, or --headerline) specifies types; They must be in the form of '<colName>.<type>(<arg>)'. The type can be one of: auto, binary, boolean, date, date_go, date_ms, date_oracle, decimal, double, int32, int64, json, string. For each of the date types, the argument is a datetime layout string. For the binary type, the argument can be one of: base32, base64, hex. The json type parses a cell holding a JSON object or array into a subdocument or array. All other types take an empty argument. Only valid for CSV and TSV imports. e.g. zipcode.string(), thumbnail.binary(base64)"`
+
+	// Sets the words that are read as true and false in CSV and TSV cells.
+	BooleanWords string `long:"booleanWords" value-name:"true=<word>[,<word>]*;false=<word>[,<word>]*" description:"words to read as booleans in boolean() columns, and in auto columns unless they are numbers, e.g. --booleanWords 'true=yes,y,1;false=no,n,0'; words are matched without regard to case, and a value left out keeps its default words (true, 1 or false, 0)"`
+
+	// Set how the numbers in CSV and TSV cells are written, e.g. "1.234,56".
+	DecimalSeparator   string `long:"decimalSeparator" value-name:"<char>" default:"." description:"character that separates the integer and fractional parts of numbers in CSV and TSV cells, e.g. --decimalSeparator ','"`
+	ThousandsSeparator string `long:"thousandsSeparator" value-name:"<char>" description:"character that separates groups of three digits in numbers in CSV and TSV cells, e.g. --thousandsSeparator '.' to read 1.234,56 with --decimalSeparator ','"`
 
 	// Indicates that the legacy extended JSON format should be used to parse JSON documents. Defaults to false.
 	Legacy bool `long:"legacy" description:"use the legacy extended JSON format"`
 
+	// Names the database each input file is imported into, e.g. '{{dir}}'.
+	DBTemplate string `long:"dbTemplate" value-name:"<template>" description:"import each input file into the database named by this template; one of the variables {{basename}}, {{filename}}, {{ext}} or {{dir}} is replaced by the file's base name, file name, extension or parent directory name, e.g. --dbTemplate='{{dir}}'"`
+
+	// Names the collection each input file is imported into, e.g. '{{basename}}'.
+	CollectionTemplate string `long:"collectionTemplate" value-name:"<template>" description:"import each input file into the collection named by this template, using the same variables as --dbTemplate, e.g. --collectionTemplate='{{basename}}'. With --dbTemplate or --collectionTemplate, any number of files and directories may be given"`
+
 	UseArrayIndexFields bool `long:"useArrayIndexFields" description:"indicates that field names may include array indexes that should be used to construct arrays during import (e.g. foo.0,foo.1). Indexes must start from 0 and increase sequentially (foo.1,foo.0 would fail)."`
 }
 
@@ -62,7 +78,7 @@ func (_ *InputOptions) Name() string {
 // IngestOptions defines the set of options for storing data.
 type IngestOptions struct {
 	// Drops target collection before importing.
-	Drop bool `long:"drop" description:"drop collection before inserting documents"`
+	Drop bool `long:"drop" description:"drop collection before inserting documents; with --routeField, each collection is dropped before its first document is inserted"`
 
 	// Ignores fields with empty values in CSV and TSV imports.
 	IgnoreBlanks bool `long:"ignoreBlanks" description:"ignore fields with empty values in CSV and TSV"`
@@ -87,6 +103,9 @@ type IngestOptions struct {
 
 	Upsert bool `long:"upsert" hidden:"true" description:"(deprecated; same as --mode=upsert) insert or update objects that already exist"`
 
+	// Names a field whose string value is the collection each document is imported into.
+	RouteField string `long:"routeField" value-name:"<field>" description:"import each document into the collection named by the string value of this field, e.g. --routeField=type; documents without the field are imported into --collection"`
+
 	// Specifies a list of fields for the query portion of the upsert; defaults to _id field.
 	UpsertFields string `long:"upsertFields" value-name:"<field>[,<field>]*" description:"comma-separated fields for the query part when --mode is set to upsert or merge"`
 
@@ -131,7 +150,11 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 		return Options{}, err
 	}
 
-	if len(extraArgs) > 1 {
+	// with a name template, every positional argument is a file or
+	// directory to import
+	useTemplates := inputOpts.DBTemplate != "" || inputOpts.CollectionTemplate != ""
+
+	if len(extraArgs) > 1 && !useTemplates {
 		return Options{}, fmt.Errorf("error parsing positional arguments: " +
 			"provide only one file name and only one MongoDB connection string. " +
 			"Connection strings must begin with mongodb:// or mongodb+srv:// schemes",
@@ -147,6 +170,19 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 	}
 	opts.WriteConcern = wc
 
+	if useTemplates {
+		if inputOpts.File != "" {
+			extraArgs = append([]string{inputOpts.File}, extraArgs...)
+			inputOpts.File = ""
+		}
+		return Options{
+			opts,
+			inputOpts,
+			ingestOpts,
+			extraArgs,
+		}, nil
+	}
+
 	// ensure either a positional argument is supplied or an argument is passed
 	// to the --file flag - and not both
 	if inputOpts.File != "" && len(extraArgs) != 0 {
@@ -0,0 +1,173 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/util"
+)
+
+// templateVariablePattern matches a variable such as {{basename}} in a
+// --dbTemplate or --collectionTemplate.
+var templateVariablePattern = regexp.MustCompile(`{{\s*([A-Za-z]+)\s*}}`)
+
+// templateVariables are the values that can be used in a --dbTemplate or
+// --collectionTemplate, computed from the path of an input file.
+var templateVariables = map[string]func(path string) string{
+	// the file name without its extension, e.g. "orders" for "exports/shop/orders.json"
+	"basename": func(path string) string {
+		base := filepath.Base(path)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	},
+	// the file name with its extension, e.g. "orders.json"
+	"filename": func(path string) string {
+		return filepath.Base(path)
+	},
+	// the extension without its leading '.', e.g. "json"
+	"ext": func(path string) string {
+		return strings.TrimPrefix(filepath.Ext(path), ".")
+	},
+	// the name of the directory holding the file, e.g. "shop"
+	"dir": func(path string) string {
+		return filepath.Base(filepath.Dir(path))
+	},
+}
+
+// expandNameTemplate returns a name template with its variables replaced by
+// the values for the input file at path.
+func expandNameTemplate(template, path string) (string, error) {
+	var err error
+	name := templateVariablePattern.ReplaceAllStringFunc(template, func(variable string) string {
+		key := templateVariablePattern.FindStringSubmatch(variable)[1]
+		value, ok := templateVariables[key]
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("unknown variable '%v' in template '%v'", variable, template)
+			}
+			return ""
+		}
+		return value(path)
+	})
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// validateNameTemplate returns an error if a name template uses unknown
+// variables.
+func validateNameTemplate(template string) error {
+	_, err := expandNameTemplate(template, "file.json")
+	return err
+}
+
+// expandInputPaths returns the files to import for the paths given on the
+// command line. Directories are replaced by the regular files they hold,
+// recursively and in lexical order; hidden files are skipped.
+func expandInputPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if file != path && strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.Mode().IsRegular() {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reading directory '%v': %v", path, err)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files found to import in %v", strings.Join(paths, ", "))
+	}
+	return files, nil
+}
+
+// validateTemplateSettings checks --dbTemplate and --collectionTemplate and
+// finds the files to import from the paths given on the command line.
+func (imp *MongoImport) validateTemplateSettings(paths []string) error {
+	if imp.InputOptions.DBTemplate != "" {
+		if err := validateNameTemplate(imp.InputOptions.DBTemplate); err != nil {
+			return fmt.Errorf("invalid --dbTemplate argument: %v", err)
+		}
+	}
+	// without a collection, each file is imported into the collection named
+	// for it, as with a single --file
+	if imp.InputOptions.CollectionTemplate == "" && imp.ToolOptions.Collection == "" {
+		imp.InputOptions.CollectionTemplate = "{{basename}}"
+	}
+	if imp.InputOptions.CollectionTemplate != "" {
+		if err := validateNameTemplate(imp.InputOptions.CollectionTemplate); err != nil {
+			return fmt.Errorf("invalid --collectionTemplate argument: %v", err)
+		}
+	} else if err := util.ValidateCollectionName(imp.ToolOptions.Collection); err != nil {
+		return fmt.Errorf("invalid collection name: %v", err)
+	}
+	if imp.IngestOptions.RouteField != "" {
+		if err := validateFields([]string{imp.IngestOptions.RouteField}, false); err != nil {
+			return fmt.Errorf("invalid --routeField argument: %v", err)
+		}
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("cannot read from stdin with --dbTemplate or --collectionTemplate; specify the files or directories to import")
+	}
+	files, err := expandInputPaths(paths)
+	if err != nil {
+		return err
+	}
+	imp.inputFiles = files
+	return nil
+}
+
+// useInputFile sets the input file and the namespace it's imported into,
+// expanding --dbTemplate and --collectionTemplate for it.
+func (imp *MongoImport) useInputFile(file string) error {
+	imp.InputOptions.File = file
+	if imp.InputOptions.DBTemplate != "" {
+		name, err := expandNameTemplate(imp.InputOptions.DBTemplate, file)
+		if err != nil {
+			return err
+		}
+		if err = util.ValidateDBName(name); err != nil {
+			return fmt.Errorf("invalid database name '%v' for '%v': %v", name, file, err)
+		}
+		imp.ToolOptions.DB = name
+	}
+	if imp.InputOptions.CollectionTemplate != "" {
+		name, err := expandNameTemplate(imp.InputOptions.CollectionTemplate, file)
+		if err != nil {
+			return err
+		}
+		if err = util.ValidateCollectionName(name); err != nil {
+			return fmt.Errorf("invalid collection name '%v' for '%v': %v", name, file, err)
+		}
+		imp.ToolOptions.Collection = name
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExpandNameTemplate(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With an input file path", t, func() {
+		path := filepath.Join("exports", "shop", "orders.2020.json")
+
+		Convey("each variable is replaced by its part of the path", func() {
+			name, err := expandNameTemplate("{{basename}}", path)
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "orders.2020")
+			name, err = expandNameTemplate("{{ filename }}", path)
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "orders.2020.json")
+			name, err = expandNameTemplate("{{dir}}_{{ext}}", path)
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "shop_json")
+		})
+
+		Convey("text outside variables is kept", func() {
+			name, err := expandNameTemplate("raw_{{basename}}", path)
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "raw_orders.2020")
+		})
+
+		Convey("unknown variables are an error", func() {
+			_, err := expandNameTemplate("{{base}}", path)
+			So(err, ShouldNotBeNil)
+			So(validateNameTemplate("{{base}}"), ShouldNotBeNil)
+			So(validateNameTemplate("{{dir}}.{{basename}}"), ShouldBeNil)
+		})
+	})
+}
+
+func TestTemplateSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a directory of partitioned exports", t, func() {
+		dir, err := ioutil.TempDir("", "mongoimport_templates_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		for _, file := range []string{"orders.json", "users.json", ".hidden.json", "archive/2019.json"} {
+			path := filepath.Join(dir, "shop", file)
+			So(os.MkdirAll(filepath.Dir(path), 0755), ShouldBeNil)
+			So(ioutil.WriteFile(path, []byte("{}"), 0644), ShouldBeNil)
+		}
+
+		Convey("directories are expanded to the files they hold", func() {
+			files, err := expandInputPaths([]string{dir})
+			So(err, ShouldBeNil)
+			So(files, ShouldResemble, []string{
+				filepath.Join(dir, "shop", "archive", "2019.json"),
+				filepath.Join(dir, "shop", "orders.json"),
+				filepath.Join(dir, "shop", "users.json"),
+			})
+			_, err = expandInputPaths([]string{filepath.Join(dir, "missing")})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("each file is imported into the namespace named by the templates", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.DBTemplate = "{{dir}}"
+			imp.InputOptions.CollectionTemplate = "{{basename}}"
+			So(imp.validateSettings([]string{filepath.Join(dir, "shop")}), ShouldBeNil)
+			So(imp.inputFiles, ShouldHaveLength, 3)
+
+			So(imp.useInputFile(imp.inputFiles[1]), ShouldBeNil)
+			So(imp.InputOptions.File, ShouldEqual, filepath.Join(dir, "shop", "orders.json"))
+			So(imp.ToolOptions.DB, ShouldEqual, "shop")
+			So(imp.ToolOptions.Collection, ShouldEqual, "orders")
+
+			So(imp.useInputFile(imp.inputFiles[0]), ShouldBeNil)
+			So(imp.ToolOptions.DB, ShouldEqual, "archive")
+			So(imp.ToolOptions.Collection, ShouldEqual, "2019")
+		})
+
+		Convey("without a collection, files are imported into collections named for them", func() {
+			imp := NewMockMongoImport()
+			imp.ToolOptions.Collection = ""
+			imp.InputOptions.DBTemplate = "{{dir}}"
+			So(imp.validateSettings([]string{filepath.Join(dir, "shop", "users.json")}), ShouldBeNil)
+			So(imp.useInputFile(imp.inputFiles[0]), ShouldBeNil)
+			So(imp.ToolOptions.DB, ShouldEqual, "shop")
+			So(imp.ToolOptions.Collection, ShouldEqual, "users")
+		})
+
+		Convey("invalid templates and names are errors", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.CollectionTemplate = "{{name}}"
+			So(imp.validateSettings([]string{dir}), ShouldNotBeNil)
+
+			imp = NewMockMongoImport()
+			imp.InputOptions.DBTemplate = "{{filename}}"
+			So(imp.validateSettings([]string{dir}), ShouldBeNil)
+			So(imp.useInputFile(imp.inputFiles[1]), ShouldNotBeNil)
+		})
+
+		Convey("stdin can't be imported with a template", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.CollectionTemplate = "{{basename}}"
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+		})
+	})
+}
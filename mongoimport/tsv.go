@@ -50,6 +50,18 @@ type TSVInputReader struct {
 
 	// useArrayIndexFields is whether field names include array indexes
 	useArrayIndexFields bool
+
+	// normalizeHeaders is how the field names of the header line are
+	// rewritten, if at all
+	normalizeHeaders string
+
+	// booleanWords are the words the columns of the header line read as
+	// booleans, if set
+	booleanWords *booleanWords
+
+	// numberFormat is how the numbers in the columns of the header line are
+	// written, if not the default
+	numberFormat *numberFormat
 }
 
 // TSVConverter implements the Converter interface for TSV input.
@@ -59,6 +71,7 @@ type TSVConverter struct {
 	index               uint64
 	ignoreBlanks        bool
 	useArrayIndexFields bool
+	autoParser          *FieldAutoParser
 	rejectWriter        io.Writer
 }
 
@@ -90,6 +103,11 @@ func (r *TSVInputReader) ReadAndValidateHeader() (err error) {
 		headerFields = append(headerFields, strings.TrimRight(field, "\r\n"))
 	}
 	r.colSpecs = ParseAutoHeaders(headerFields)
+	if err = normalizeColumnSpecs(r.colSpecs, r.normalizeHeaders); err != nil {
+		return err
+	}
+	setBooleanWords(r.colSpecs, r.booleanWords)
+	setNumberFormat(r.colSpecs, r.numberFormat)
 	return validateReaderFields(ColumnNames(r.colSpecs), r.useArrayIndexFields)
 }
 
@@ -108,6 +126,11 @@ func (r *TSVInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) (err
 	if err != nil {
 		return err
 	}
+	if err = normalizeColumnSpecs(r.colSpecs, r.normalizeHeaders); err != nil {
+		return err
+	}
+	setBooleanWords(r.colSpecs, r.booleanWords)
+	setNumberFormat(r.colSpecs, r.numberFormat)
 	return validateReaderFields(ColumnNames(r.colSpecs), r.useArrayIndexFields)
 }
 
@@ -117,6 +140,7 @@ func (r *TSVInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) (err
 func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (retErr error) {
 	tsvRecordChan := make(chan Converter, r.numDecoders)
 	tsvErrChan := make(chan error)
+	autoParser := &FieldAutoParser{booleans: r.booleanWords, numbers: r.numberFormat}
 
 	// begin reading from source
 	go func() {
@@ -139,6 +163,7 @@ func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 				index:               r.numProcessed,
 				ignoreBlanks:        r.ignoreBlanks,
 				useArrayIndexFields: r.useArrayIndexFields,
+				autoParser:          autoParser,
 				rejectWriter:        r.tsvRejectWriter,
 			}
 			r.numProcessed++
@@ -162,6 +187,7 @@ func (c TSVConverter) Convert() (b bson.D, err error) {
 		c.index,
 		c.ignoreBlanks,
 		c.useArrayIndexFields,
+		c.autoParser,
 	)
 	if _, ok := err.(coercionError); ok {
 		c.Print()
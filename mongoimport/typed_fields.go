@@ -10,6 +10,7 @@ import (
 	"encoding/base32"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math"
 	"regexp"
@@ -17,6 +18,7 @@ import (
 	"strings"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/huimingz/mongo-tools/mongoimport/dateconv"
@@ -38,6 +40,7 @@ const (
 	ctInt64
 	ctDecimal
 	ctString
+	ctJSON
 )
 
 var (
@@ -55,6 +58,7 @@ var (
 		"int32":       ctInt32,
 		"int64":       ctInt64,
 		"string":      ctString,
+		"json":        ctJSON,
 	}
 )
 
@@ -192,6 +196,8 @@ func NewFieldParser(t columnType, arg string) (parser FieldParser, err error) {
 		parser = new(FieldDecimalParser)
 	case ctString:
 		parser = new(FieldStringParser)
+	case ctJSON:
+		parser = new(FieldJSONParser)
 	default: // ctAuto
 		parser = new(FieldAutoParser)
 	}
@@ -213,10 +219,28 @@ func autoParse(in string) interface{} {
 	return in
 }
 
-type FieldAutoParser struct{}
+// FieldAutoParser reads numbers as numbers and other values as strings, or,
+// with --booleanWords, as booleans if they are one of the words. Numbers are
+// tried first, so numeric words are only read as booleans by boolean().
+type FieldAutoParser struct {
+	booleans *booleanWords
+	numbers  *numberFormat
+}
 
 func (ap *FieldAutoParser) Parse(in string) (interface{}, error) {
-	return autoParse(in), nil
+	value := autoParse(in)
+	if ap.numbers != nil {
+		value = in
+		if number, ok := ap.numbers.normalize(in); ok {
+			value = autoParse(number)
+		}
+	}
+	if _, ok := value.(string); ok && ap.booleans != nil {
+		if b, ok := ap.booleans.parse(in); ok {
+			return b, nil
+		}
+	}
+	return value, nil
 }
 
 type FieldBinaryParser struct {
@@ -242,9 +266,19 @@ func NewFieldBinaryParser(arg string) (*FieldBinaryParser, error) {
 	return &FieldBinaryParser{enc}, nil
 }
 
-type FieldBooleanParser struct{}
+// FieldBooleanParser reads "true", "false", "1" and "0", or the words of
+// --booleanWords, as booleans.
+type FieldBooleanParser struct {
+	words *booleanWords
+}
 
 func (bp *FieldBooleanParser) Parse(in string) (interface{}, error) {
+	if bp.words != nil {
+		if b, ok := bp.words.parse(in); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("failed to parse boolean: %s", in)
+	}
 	if strings.ToLower(in) == "true" || in == "1" {
 		return true, nil
 	}
@@ -262,28 +296,66 @@ func (dp *FieldDateParser) Parse(in string) (interface{}, error) {
 	return time.Parse(dp.layout, in)
 }
 
-type FieldDoubleParser struct{}
+// numberInFormat rewrites a number written in the format of
+// --decimalSeparator and --thousandsSeparator, if set, into the form strconv
+// reads.
+func numberInFormat(nf *numberFormat, in string) (string, error) {
+	if nf == nil {
+		return in, nil
+	}
+	number, ok := nf.normalize(in)
+	if !ok {
+		return "", fmt.Errorf("failed to parse number: %s", in)
+	}
+	return number, nil
+}
+
+type FieldDoubleParser struct {
+	numbers *numberFormat
+}
 
 func (dp *FieldDoubleParser) Parse(in string) (interface{}, error) {
+	in, err := numberInFormat(dp.numbers, in)
+	if err != nil {
+		return nil, err
+	}
 	return strconv.ParseFloat(in, 64)
 }
 
-type FieldInt32Parser struct{}
+type FieldInt32Parser struct {
+	numbers *numberFormat
+}
 
 func (ip *FieldInt32Parser) Parse(in string) (interface{}, error) {
+	in, err := numberInFormat(ip.numbers, in)
+	if err != nil {
+		return nil, err
+	}
 	value, err := strconv.ParseInt(in, 10, 32)
 	return int32(value), err
 }
 
-type FieldInt64Parser struct{}
+type FieldInt64Parser struct {
+	numbers *numberFormat
+}
 
 func (ip *FieldInt64Parser) Parse(in string) (interface{}, error) {
+	in, err := numberInFormat(ip.numbers, in)
+	if err != nil {
+		return nil, err
+	}
 	return strconv.ParseInt(in, 10, 64)
 }
 
-type FieldDecimalParser struct{}
+type FieldDecimalParser struct {
+	numbers *numberFormat
+}
 
 func (ip *FieldDecimalParser) Parse(in string) (interface{}, error) {
+	in, err := numberInFormat(ip.numbers, in)
+	if err != nil {
+		return nil, err
+	}
 	return primitive.ParseDecimal128(in)
 }
 
@@ -292,3 +364,22 @@ type FieldStringParser struct{}
 func (sp *FieldStringParser) Parse(in string) (interface{}, error) {
 	return in, nil
 }
+
+// FieldJSONParser parses a cell holding JSON, such as a column exported from
+// a relational database's JSON type, into the value it encodes: objects
+// become subdocuments and arrays become arrays. Extended JSON is understood.
+type FieldJSONParser struct{}
+
+func (jp *FieldJSONParser) Parse(in string) (interface{}, error) {
+	if !json.Valid([]byte(in)) {
+		return nil, fmt.Errorf("failed to parse JSON: %s", in)
+	}
+	// UnmarshalExtJSON only reads documents, so the value is read as a field
+	var wrapper struct {
+		Value interface{} `bson:"v"`
+	}
+	if err := bson.UnmarshalExtJSON([]byte(`{"v":`+in+"\n}"), false, &wrapper); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %v", err)
+	}
+	return wrapper.Value, nil
+}
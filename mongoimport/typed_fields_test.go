@@ -413,4 +413,33 @@ func TestFieldParsers(t *testing.T) {
 		})
 	})
 
+	Convey("Using FieldJSONParser", t, func() {
+		var p, _ = NewFieldParser(ctJSON, "")
+
+		Convey("parses objects and arrays into subdocuments and arrays", func() {
+			value, err := p.Parse(`{"color": "red", "sizes": [1, 2.5], "stock": {"$numberLong": "7"}}`)
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, primitive.D{
+				{"color", "red"},
+				{"sizes", primitive.A{int32(1), 2.5}},
+				{"stock", int64(7)},
+			})
+			value, err = p.Parse(` [{"a": null}, "b"] `)
+			So(err, ShouldBeNil)
+			So(value, ShouldResemble, primitive.A{primitive.D{{"a", nil}}, "b"})
+		})
+		Convey("does not parse invalid JSON", func() {
+			for _, in := range []string{"", "{", "{'a': 1}", `1, "w": 2`, "[1]]"} {
+				_, err := p.Parse(in)
+				So(err, ShouldNotBeNil)
+			}
+		})
+		Convey("is chosen by the json() type in a header", func() {
+			colSpec, err := ParseTypedHeader("attributes.json()", pgStop)
+			So(err, ShouldBeNil)
+			So(colSpec.Parser, ShouldResemble, new(FieldJSONParser))
+			_, err = ParseTypedHeader("attributes.json(strict)", pgStop)
+			So(err, ShouldNotBeNil)
+		})
+	})
 }
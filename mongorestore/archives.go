@@ -0,0 +1,113 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+
+	"github.com/huimingz/mongo-tools/common/idx"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// checkArchives returns an error if several --archive inputs can't be
+// restored with the other options given.
+func (restore *MongoRestore) checkArchives() error {
+	for _, path := range restore.InputOptions.Archives {
+		if path == "-" {
+			return fmt.Errorf("cannot read one of several archives from standard input")
+		}
+	}
+	switch {
+	case restore.TargetDirectory != "":
+		return fmt.Errorf("cannot restore a directory or file along with several archives")
+	case restore.InputOptions.OplogLimit != "":
+		return fmt.Errorf("cannot use --oplogLimit with several archives")
+	case restore.OutputOptions.Resume:
+		return fmt.Errorf("cannot use --resume with several archives")
+	case restore.OutputOptions.Verify:
+		return fmt.Errorf("cannot use --verify with several archives")
+	case restore.OutputOptions.ResetPasswordsFile != "":
+		return fmt.Errorf("cannot use --resetPasswordsFile with several archives")
+	}
+	return nil
+}
+
+// archiveStep returns a restore of one of several archives. Archives after
+// the first are restored on top of the ones before them: collections aren't
+// dropped, and documents that already exist are replaced unless --onDuplicate
+// says otherwise.
+func (restore *MongoRestore) archiveStep(path string, first bool) *MongoRestore {
+	inputOpts := *restore.InputOptions
+	inputOpts.Archives = []string{path}
+	inputOpts.Archive = path
+
+	outputOpts := *restore.OutputOptions
+	var impliedOnDuplicate bool
+	if !first {
+		outputOpts.Drop = false
+		outputOpts.PreserveUUID = false
+		outputOpts.RegenerateUUID = false
+		outputOpts.UUIDOverride = nil
+		if outputOpts.OnDuplicate == "" {
+			outputOpts.OnDuplicate = onDuplicateReplace
+			impliedOnDuplicate = true
+		}
+	}
+
+	return &MongoRestore{
+		ToolOptions:       restore.ToolOptions,
+		InputOptions:      &inputOpts,
+		OutputOptions:     &outputOpts,
+		NSOptions:         restore.NSOptions,
+		SessionProvider:   restore.SessionProvider,
+		ProgressManager:   restore.ProgressManager,
+		SkipUsersAndRoles: restore.SkipUsersAndRoles,
+		InputReader:       restore.InputReader,
+		PlanWriter:        restore.PlanWriter,
+		serverVersion:     restore.serverVersion,
+		indexCatalog:      idx.NewIndexCatalog(),
+
+		impliedOnDuplicate: impliedOnDuplicate,
+	}
+}
+
+// restoreArchives restores several archives in the order given, typically a
+// full archive followed by incremental ones. With --oplogReplay, the oplog of
+// each archive is replayed from where the previous archive's oplog ended, so
+// the target ends up as of the end of the last archive. An archive whose
+// oplog starts after that is refused, since changes would be missing.
+func (restore *MongoRestore) restoreArchives() Result {
+	if err := restore.checkArchives(); err != nil {
+		return Result{Err: err}
+	}
+
+	var total Result
+	var oplogAfter primitive.Timestamp
+	archives := restore.InputOptions.Archives
+	for i, path := range archives {
+		if restore.terminate {
+			return total.withErr(util.ErrTerminated)
+		}
+		log.Logvf(log.Always, "restoring archive %v of %v: %v", i+1, len(archives), path)
+		step := restore.archiveStep(path, i == 0)
+		step.oplogAfter = oplogAfter
+		restore.currentStep = step
+
+		result := step.Restore()
+		total.combineWith(result)
+		if result.Err != nil {
+			return total.withErr(fmt.Errorf("error restoring archive %v: %v", path, result.Err))
+		}
+		if !step.lastOplogTs.IsZero() {
+			oplogAfter = step.lastOplogTs
+		}
+	}
+	restore.currentStep = nil
+	return total
+}
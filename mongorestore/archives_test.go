@@ -0,0 +1,75 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMultipleArchives(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With several archives", t, func() {
+		mr := newMongoRestore()
+		mr.OutputOptions = &OutputOptions{Drop: true, PreserveUUID: true}
+		mr.InputOptions.Archives = []string{"full.archive", "incr.archive"}
+
+		Convey("options that apply to a single input are rejected", func() {
+			So(mr.checkArchives(), ShouldBeNil)
+			mr.OutputOptions.Resume = true
+			So(mr.checkArchives(), ShouldNotBeNil)
+			mr.OutputOptions.Resume = false
+			mr.InputOptions.Archives = append(mr.InputOptions.Archives, "-")
+			So(mr.checkArchives(), ShouldNotBeNil)
+		})
+
+		Convey("the first archive is restored as given", func() {
+			step := mr.archiveStep("full.archive", true)
+			So(step.InputOptions.Archive, ShouldEqual, "full.archive")
+			So(step.InputOptions.Archives, ShouldResemble, []string{"full.archive"})
+			So(step.OutputOptions.Drop, ShouldBeTrue)
+			So(step.OutputOptions.OnDuplicate, ShouldEqual, "")
+		})
+
+		Convey("later archives replace the documents of earlier ones", func() {
+			step := mr.archiveStep("incr.archive", false)
+			So(step.InputOptions.Archive, ShouldEqual, "incr.archive")
+			So(step.OutputOptions.Drop, ShouldBeFalse)
+			So(step.OutputOptions.PreserveUUID, ShouldBeFalse)
+			So(step.OutputOptions.OnDuplicate, ShouldEqual, onDuplicateReplace)
+			So(mr.OutputOptions.Drop, ShouldBeTrue)
+
+			mr.OutputOptions.OnDuplicate = onDuplicateSkip
+			So(mr.archiveStep("incr.archive", false).OutputOptions.OnDuplicate, ShouldEqual, onDuplicateSkip)
+		})
+	})
+
+	Convey("Oplog entries up to the end of the previous archive's oplog are not replayed again", t, func() {
+		mr := newMongoRestore()
+		So(mr.replayedBefore(primitive.Timestamp{T: 5, I: 1}), ShouldBeFalse)
+
+		mr.oplogAfter = primitive.Timestamp{T: 10, I: 2}
+		So(mr.replayedBefore(primitive.Timestamp{T: 9, I: 7}), ShouldBeTrue)
+		So(mr.replayedBefore(primitive.Timestamp{T: 10, I: 2}), ShouldBeTrue)
+		So(mr.replayedBefore(primitive.Timestamp{T: 10, I: 3}), ShouldBeFalse)
+		So(mr.replayedBefore(primitive.Timestamp{T: 11, I: 0}), ShouldBeFalse)
+	})
+
+	Convey("An oplog must continue from the previous archive's", t, func() {
+		mr := newMongoRestore()
+		So(mr.checkOplogContinues(primitive.Timestamp{T: 5, I: 1}), ShouldBeNil)
+
+		mr.oplogAfter = primitive.Timestamp{T: 10, I: 2}
+		So(mr.checkOplogContinues(primitive.Timestamp{T: 9, I: 7}), ShouldBeNil)
+		So(mr.checkOplogContinues(primitive.Timestamp{T: 10, I: 2}), ShouldBeNil)
+		So(mr.checkOplogContinues(primitive.Timestamp{T: 10, I: 3}), ShouldNotBeNil)
+	})
+}
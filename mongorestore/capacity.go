@@ -0,0 +1,233 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/compression"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/text"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// defaultStorageRatio is the share of the documents' size that a database
+// is assumed to take on disk when it doesn't hold enough data to measure it.
+// WiredTiger compresses collections with snappy by default, which usually
+// stores documents in half their size or less.
+const defaultStorageRatio = 0.5
+
+// minRatioDataSize is the least data a database must hold for the ratio of
+// its storage to its data size to be used for the estimate.
+const minRatioDataSize = 16 * 1024 * 1024
+
+// filesystemUsage is the disk usage of the filesystem holding a database,
+// and the share of its documents' size that the database takes on disk, as
+// reported by dbStats.
+type filesystemUsage struct {
+	total        int64
+	used         int64
+	storageRatio float64
+}
+
+// dumpSize is the size of the data the restore will write to a database:
+// the bytes of documents, and the bytes of compressed dump files, whose
+// documents' size is unknown.
+type dumpSize struct {
+	documents  int64
+	compressed int64
+}
+
+// storedSize estimates the disk space a database needs for the restore. The
+// documents are stored compressed, so their size is scaled by the storage
+// ratio. Compressed dump files are counted at their own size, since the
+// server compresses their documents about as much as the dump did.
+func (s dumpSize) storedSize(storageRatio float64) int64 {
+	return int64(float64(s.documents)*storageRatio) + s.compressed
+}
+
+// capacityShortfall is a filesystem of the target that the restore is not
+// expected to fit on.
+type capacityShortfall struct {
+	databases []string
+	required  int64
+	free      int64
+}
+
+func (s capacityShortfall) String() string {
+	return fmt.Sprintf("the restore into %v needs an estimated %v but only %v is free",
+		strings.Join(s.databases, ", "), text.FormatByteAmount(s.required), text.FormatByteAmount(s.free))
+}
+
+// estimateRequiredStorage returns the size of the data the restore will
+// write to each destination database, from the sizes of the dump files or
+// of the namespaces in the archive prelude.
+func (restore *MongoRestore) estimateRequiredStorage() map[string]dumpSize {
+	required := map[string]dumpSize{}
+	for _, intent := range restore.manager.NormalIntents() {
+		if intent.IsView() && !intent.IsTimeseries() {
+			continue
+		}
+		if intent.Size <= 0 {
+			continue
+		}
+		size := required[intent.DB]
+		if _, codec := compression.TrimExtension(intent.Location); codec != compression.None && restore.InputOptions.Archive == "" {
+			size.compressed += intent.Size
+		} else {
+			size.documents += intent.Size
+		}
+		required[intent.DB] = size
+	}
+	return required
+}
+
+// findCapacityShortfalls compares the data to be written to each database
+// with the free space of the filesystem holding it. Databases on the same
+// filesystem, as told by its total size, share its free space. Databases
+// whose usage is unknown are not checked.
+func findCapacityShortfalls(required, freed map[string]int64, usage map[string]filesystemUsage) []capacityShortfall {
+	byFilesystem := map[int64]*capacityShortfall{}
+	var totals []int64
+	for dbName, size := range required {
+		fs, ok := usage[dbName]
+		if !ok || fs.total <= 0 {
+			continue
+		}
+		shortfall, ok := byFilesystem[fs.total]
+		if !ok {
+			shortfall = &capacityShortfall{free: fs.total - fs.used}
+			byFilesystem[fs.total] = shortfall
+			totals = append(totals, fs.total)
+		}
+		shortfall.databases = append(shortfall.databases, dbName)
+		shortfall.required += size
+		shortfall.free += freed[dbName]
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i] < totals[j] })
+
+	var shortfalls []capacityShortfall
+	for _, total := range totals {
+		shortfall := byFilesystem[total]
+		if shortfall.required > shortfall.free {
+			sort.Strings(shortfall.databases)
+			shortfalls = append(shortfalls, *shortfall)
+		}
+	}
+	return shortfalls
+}
+
+// getFilesystemUsage runs dbStats on a database, returning false if the
+// server does not report the usage of its filesystem. Users with only the
+// restore role may not run dbStats, so the usage is then unknown too.
+func (restore *MongoRestore) getFilesystemUsage(dbName string) (filesystemUsage, bool) {
+	var stats bson.M
+	if err := restore.SessionProvider.Run(bson.D{{"dbStats", 1}}, &stats, dbName); err != nil {
+		log.Logvf(log.Always, "warning: unable to run dbStats on %v, not checking its free disk space: %v", dbName, err)
+		return filesystemUsage{}, false
+	}
+	return usageFromStats(stats)
+}
+
+// usageFromStats reads the filesystem usage from the result of dbStats. The
+// storage ratio is measured from the database's data when it holds enough.
+func usageFromStats(stats bson.M) (filesystemUsage, bool) {
+	total, err := util.ToFloat64(stats["fsTotalSize"])
+	if err != nil {
+		return filesystemUsage{}, false
+	}
+	used, err := util.ToFloat64(stats["fsUsedSize"])
+	if err != nil {
+		return filesystemUsage{}, false
+	}
+	usage := filesystemUsage{total: int64(total), used: int64(used), storageRatio: defaultStorageRatio}
+	dataSize, err := util.ToFloat64(stats["dataSize"])
+	if err != nil || dataSize < minRatioDataSize {
+		return usage, true
+	}
+	if storageSize, err := util.ToFloat64(stats["storageSize"]); err == nil && storageSize > 0 {
+		usage.storageRatio = storageSize / dataSize
+		if usage.storageRatio > 1 {
+			usage.storageRatio = 1
+		}
+	}
+	return usage, true
+}
+
+// getDroppedStorage returns the bytes that --drop will free in each database
+// by dropping the existing collections the restore replaces.
+func (restore *MongoRestore) getDroppedStorage() map[string]int64 {
+	freed := map[string]int64{}
+	if !restore.OutputOptions.Drop {
+		return freed
+	}
+	for _, intent := range restore.manager.NormalIntents() {
+		if intent.IsView() || strings.HasPrefix(intent.C, "system.") {
+			continue
+		}
+		var stats bson.M
+		// collStats fails on collections that don't exist, which free nothing
+		if err := restore.SessionProvider.Run(bson.D{{"collStats", intent.C}}, &stats, intent.DB); err != nil {
+			continue
+		}
+		for _, field := range []string{"storageSize", "totalIndexSize"} {
+			if size, err := util.ToFloat64(stats[field]); err == nil {
+				freed[intent.DB] += int64(size)
+			}
+		}
+	}
+	return freed
+}
+
+// checkTargetCapacity refuses the restore if the data it will write is not
+// expected to fit in the free disk space of the target, so that it does not
+// fail partway when the disk fills up. With --force the restore goes ahead
+// after a warning. The check is skipped for the databases whose disk usage
+// the target does not report.
+func (restore *MongoRestore) checkTargetCapacity() error {
+	sizes := restore.estimateRequiredStorage()
+	if len(sizes) == 0 {
+		return nil
+	}
+	usage := map[string]filesystemUsage{}
+	required := map[string]int64{}
+	var total int64
+	for dbName, size := range sizes {
+		fs, ok := restore.getFilesystemUsage(dbName)
+		if !ok {
+			continue
+		}
+		usage[dbName] = fs
+		required[dbName] = size.storedSize(fs.storageRatio)
+		total += required[dbName]
+	}
+	if len(usage) == 0 {
+		log.Logv(log.Info, "the target does not report its disk usage; skipping the capacity check")
+		return nil
+	}
+	log.Logvf(log.Info, "the restore will take an estimated %v of disk space", text.FormatByteAmount(total))
+
+	shortfalls := findCapacityShortfalls(required, restore.getDroppedStorage(), usage)
+	if len(shortfalls) == 0 {
+		return nil
+	}
+	if restore.OutputOptions.Force {
+		for _, shortfall := range shortfalls {
+			log.Logvf(log.Always, "warning: %v; restoring anyway because of --force", shortfall)
+		}
+		return nil
+	}
+	lines := make([]string, 0, len(shortfalls))
+	for _, shortfall := range shortfalls {
+		lines = append(lines, shortfall.String())
+	}
+	return fmt.Errorf("the target does not have enough free disk space:\n\t%v\nuse --force to restore anyway",
+		strings.Join(lines, "\n\t"))
+}
@@ -0,0 +1,98 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestEstimateRequiredStorage(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a directory dump", t, func() {
+		restore := &MongoRestore{
+			InputOptions: &InputOptions{},
+			manager:      intents.NewIntentManager(),
+		}
+		restore.manager.Put(&intents.Intent{DB: "a", C: "one", Location: "dump/a/one.bson", Size: 100})
+		restore.manager.Put(&intents.Intent{DB: "a", C: "two", Location: "dump/a/two.bson", Size: 50})
+		restore.manager.Put(&intents.Intent{DB: "b", C: "v", Location: "dump/b/v.metadata.json", Type: "view"})
+
+		Convey("the sizes of the dump files are added up by database", func() {
+			So(restore.estimateRequiredStorage(), ShouldResemble, map[string]dumpSize{"a": {documents: 150}})
+		})
+
+		Convey("compressed dump files are counted apart", func() {
+			restore.manager.Put(&intents.Intent{DB: "a", C: "three", Location: "dump/a/three.bson.zst", Size: 10})
+			So(restore.estimateRequiredStorage(), ShouldResemble, map[string]dumpSize{"a": {documents: 150, compressed: 10}})
+		})
+	})
+
+	Convey("The documents are scaled by the storage ratio but compressed files are not", t, func() {
+		So(dumpSize{documents: 1000, compressed: 100}.storedSize(0.25), ShouldEqual, 350)
+	})
+}
+
+func TestUsageFromStats(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A database without filesystem sizes has no usage", t, func() {
+		_, ok := usageFromStats(bson.M{"dataSize": 100.0})
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("The storage ratio of a small database is assumed", t, func() {
+		usage, ok := usageFromStats(bson.M{"fsTotalSize": 1000.0, "fsUsedSize": 400.0, "dataSize": 100.0, "storageSize": 4096.0})
+		So(ok, ShouldBeTrue)
+		So(usage, ShouldResemble, filesystemUsage{total: 1000, used: 400, storageRatio: defaultStorageRatio})
+	})
+
+	Convey("The storage ratio of a database with data is measured", t, func() {
+		stats := bson.M{"fsTotalSize": 1e12, "fsUsedSize": 1e11, "dataSize": 1e9, "storageSize": 3e8}
+		usage, ok := usageFromStats(stats)
+		So(ok, ShouldBeTrue)
+		So(usage.storageRatio, ShouldAlmostEqual, 0.3)
+
+		stats["storageSize"] = 2e9
+		usage, _ = usageFromStats(stats)
+		So(usage.storageRatio, ShouldEqual, 1)
+	})
+}
+
+func TestFindCapacityShortfalls(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Databases on the same filesystem share its free space", t, func() {
+		required := map[string]int64{"a": 600, "b": 500, "c": 10}
+		usage := map[string]filesystemUsage{
+			"a": {total: 2000, used: 1000},
+			"b": {total: 2000, used: 1000},
+			"c": {total: 5000, used: 0},
+		}
+		shortfalls := findCapacityShortfalls(required, nil, usage)
+		So(shortfalls, ShouldHaveLength, 1)
+		So(shortfalls[0].databases, ShouldResemble, []string{"a", "b"})
+		So(shortfalls[0].required, ShouldEqual, 1100)
+		So(shortfalls[0].free, ShouldEqual, 1000)
+
+		Convey("and the space freed by dropping collections counts", func() {
+			shortfalls := findCapacityShortfalls(required, map[string]int64{"b": 200}, usage)
+			So(shortfalls, ShouldBeEmpty)
+		})
+
+		Convey("databases whose usage is unknown are not checked", func() {
+			delete(usage, "a")
+			delete(usage, "b")
+			So(findCapacityShortfalls(required, nil, usage), ShouldBeEmpty)
+		})
+	})
+}
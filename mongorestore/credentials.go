@@ -0,0 +1,117 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// scramMechanisms are the mechanisms accepted by --credentialMechanisms.
+var scramMechanisms = map[string]bool{"SCRAM-SHA-1": true, "SCRAM-SHA-256": true}
+
+// passwordReset is a new password for a restored user.
+type passwordReset struct {
+	db, user, password string
+}
+
+func (r passwordReset) name() string {
+	return r.db + "." + r.user
+}
+
+// loadPasswordResets reads a --resetPasswordsFile, a JSON object that maps
+// "<database>.<user>" to the user's new password.
+func loadPasswordResets(path string) ([]passwordReset, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading --resetPasswordsFile: %v", err)
+	}
+	passwords := map[string]string{}
+	if err = json.Unmarshal(data, &passwords); err != nil {
+		return nil, fmt.Errorf("error parsing --resetPasswordsFile %v: expected a JSON object "+
+			"mapping \"<database>.<user>\" to passwords: %v", path, err)
+	}
+
+	var resets []passwordReset
+	for name, password := range passwords {
+		parts := strings.SplitN(name, ".", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid user %q in --resetPasswordsFile: expected <database>.<user>", name)
+		}
+		if password == "" {
+			return nil, fmt.Errorf("empty password for %v in --resetPasswordsFile", name)
+		}
+		resets = append(resets, passwordReset{db: parts[0], user: parts[1], password: password})
+	}
+	sort.Slice(resets, func(i, j int) bool { return resets[i].name() < resets[j].name() })
+	return resets, nil
+}
+
+// parseCredentialMechanisms parses --credentialMechanisms.
+func parseCredentialMechanisms(value string) ([]string, error) {
+	var mechanisms []string
+	for _, mechanism := range splitOptionList([]string{value}) {
+		if !scramMechanisms[mechanism] {
+			return nil, fmt.Errorf("invalid --credentialMechanisms %q: expected SCRAM-SHA-1 or SCRAM-SHA-256", mechanism)
+		}
+		mechanisms = append(mechanisms, mechanism)
+	}
+	return mechanisms, nil
+}
+
+// checkPasswordResets makes sure every user in --resetPasswordsFile is
+// restored from the dump of users.
+func (restore *MongoRestore) checkPasswordResets(users *intents.Intent) error {
+	if len(restore.passwordResets) == 0 {
+		return nil
+	}
+	if users == nil || !restore.ShouldRestoreUsersAndRoles() {
+		return fmt.Errorf("--resetPasswordsFile was given, but no users are restored")
+	}
+	for _, reset := range restore.passwordResets {
+		if users.DB != "admin" && reset.db != users.DB {
+			return fmt.Errorf("cannot reset the password of %v: only the users of database %v are restored",
+				reset.name(), users.DB)
+		}
+	}
+	return nil
+}
+
+// resetPasswords sets the passwords from --resetPasswordsFile on the restored
+// users, which makes the server generate new credentials in place of the
+// ones copied from the dump.
+func (restore *MongoRestore) resetPasswords() error {
+	if len(restore.passwordResets) == 0 {
+		return nil
+	}
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	for _, reset := range restore.passwordResets {
+		command := bson.D{
+			{Key: "updateUser", Value: reset.user},
+			{Key: "pwd", Value: reset.password},
+		}
+		if len(restore.credentialMechanisms) > 0 {
+			command = append(command, bson.E{Key: "mechanisms", Value: restore.credentialMechanisms})
+		}
+		if err = session.Database(reset.db).RunCommand(nil, command).Err(); err != nil {
+			return fmt.Errorf("error resetting the password of %v: %v", reset.name(), err)
+		}
+		log.Logvf(log.Info, "reset the password of %v", reset.name())
+	}
+	log.Logvf(log.Always, "reset the passwords of %v restored users", len(restore.passwordResets))
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/options"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPasswordResets(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	writeResets := func(content string) string {
+		path := filepath.Join(t.TempDir(), "passwords.json")
+		So(ioutil.WriteFile(path, []byte(content), 0600), ShouldBeNil)
+		return path
+	}
+
+	Convey("A passwords file maps users to passwords", t, func() {
+		resets, err := loadPasswordResets(writeResets(`{"app.svc.reader": "p2", "admin.root": "p1"}`))
+		So(err, ShouldBeNil)
+		So(resets, ShouldResemble, []passwordReset{
+			{db: "admin", user: "root", password: "p1"},
+			{db: "app", user: "svc.reader", password: "p2"},
+		})
+
+		for _, content := range []string{`["admin.root"]`, `{"root": "p1"}`, `{".root": "p1"}`, `{"admin.root": ""}`} {
+			_, err := loadPasswordResets(writeResets(content))
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("Only SCRAM mechanisms can be regenerated", t, func() {
+		mechanisms, err := parseCredentialMechanisms("SCRAM-SHA-256, SCRAM-SHA-1")
+		So(err, ShouldBeNil)
+		So(mechanisms, ShouldResemble, []string{"SCRAM-SHA-256", "SCRAM-SHA-1"})
+		_, err = parseCredentialMechanisms("MONGODB-X509")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("With a restore of the users of one database", t, func() {
+		mr := newMongoRestore()
+		mr.InputOptions.RestoreDBUsersAndRoles = true
+		mr.ToolOptions.Namespace = &options.Namespace{DB: "app"}
+		mr.passwordResets = []passwordReset{{db: "app", user: "svc", password: "p"}}
+
+		Convey("passwords can't be reset without users in the dump", func() {
+			So(mr.checkPasswordResets(nil), ShouldNotBeNil)
+		})
+
+		users := &intents.Intent{DB: "app", C: "$admin.system.users", BSONFile: &realBSONFile{}}
+		mr.manager.Put(users)
+		Convey("users of the restored database can be reset", func() {
+			So(mr.checkPasswordResets(users), ShouldBeNil)
+		})
+
+		Convey("users of other databases can't be reset", func() {
+			mr.passwordResets = append(mr.passwordResets, passwordReset{db: "admin", user: "root", password: "p"})
+			So(mr.checkPasswordResets(users), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,179 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// differentialDeleteBatch is the number of _ids deleted by each delete
+// command when clearing the changed ranges of a collection.
+const differentialDeleteBatch = 1000
+
+// checkDifferentialOptions returns an error if --applyDifferential is
+// combined with options it can't work with.
+func (restore *MongoRestore) checkDifferentialOptions() error {
+	if restore.OutputOptions.ApplyDifferential == "" {
+		return nil
+	}
+	switch {
+	case restore.OutputOptions.Drop:
+		return fmt.Errorf("cannot use %v with %v: the differential dump only holds the documents that changed",
+			ApplyDifferentialOption, DropOption)
+	case restore.OutputOptions.Resume:
+		// resuming would delete the documents already restored again
+		return fmt.Errorf("cannot use %v with --resume", ApplyDifferentialOption)
+	case restore.InputOptions.DocFilter != "":
+		return fmt.Errorf("cannot use %v with %v", ApplyDifferentialOption, DocFilterOption)
+	}
+	return nil
+}
+
+// prepareDifferential decides how --applyDifferential restores an intent.
+// A collection dumped with --baseManifest has its changed ranges replaced,
+// which are looked up under the namespace it was dumped as. Any other
+// collection, such as a view or a time series collection, was dumped whole
+// and so is replaced whole.
+func (restore *MongoRestore) prepareDifferential(intent *intents.Intent, metadata *Metadata) error {
+	if restore.differentialManifest == nil {
+		if metadata != nil && metadata.DifferentialBase != "" {
+			// restoring only the changed ranges would lose every other
+			// document, all the more so with --drop
+			return fmt.Errorf("cannot restore %v: it was dumped with --baseManifest and only holds the documents "+
+				"changed since the dump of %v; restore that dump, then apply this one with %v",
+				intent.Namespace(), metadata.DifferentialBase, ApplyDifferentialOption)
+		}
+		return nil
+	}
+	if restore.differentialRanges == nil {
+		restore.differentialRanges = map[string][]manifestRange{}
+		restore.replacedWhole = map[string]bool{}
+	}
+	if metadata == nil || metadata.DifferentialBase == "" {
+		restore.replacedWhole[intent.Namespace()] = true
+		return nil
+	}
+	for source, sourceIntent := range restore.manager.NormalIntentsBySource() {
+		if sourceIntent != intent {
+			continue
+		}
+		c, ok := restore.differentialManifest.Collections[source]
+		if !ok {
+			return fmt.Errorf("cannot apply %v: the hash manifest has no ranges for %v", intent.Namespace(), source)
+		}
+		restore.differentialRanges[intent.Namespace()] = c.Ranges
+		return nil
+	}
+	return fmt.Errorf("cannot apply %v: its source namespace is unknown", intent.Namespace())
+}
+
+// idSpan is a span of _ids from min up to but excluding max. A span with no
+// min starts at the lowest _id, and one with no max ends after the highest.
+type idSpan struct {
+	min, max       interface{}
+	hasMin, hasMax bool
+}
+
+// changedSpans joins the adjacent changed ranges of a manifest into spans.
+func changedSpans(ranges []manifestRange) []idSpan {
+	var spans []idSpan
+	for i := 0; i < len(ranges); i++ {
+		if !ranges[i].Changed {
+			continue
+		}
+		span := idSpan{min: ranges[i].Min, hasMin: i > 0}
+		for i+1 < len(ranges) && ranges[i+1].Changed {
+			i++
+		}
+		if i+1 < len(ranges) {
+			span.max, span.hasMax = ranges[i+1].Min, true
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// deleteChangedRanges deletes the documents of a collection in the ranges
+// that changed since the base dump, so that the documents of the
+// differential dump replace them.
+func (restore *MongoRestore) deleteChangedRanges(intent *intents.Intent) error {
+	spans := changedSpans(restore.differentialRanges[intent.Namespace()])
+	if len(spans) == 0 {
+		return nil
+	}
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	collection := session.Database(intent.DB).Collection(intent.C)
+	var deleted int64
+	for _, span := range spans {
+		n, err := deleteSpan(collection, span)
+		if err != nil {
+			return fmt.Errorf("error deleting the changed documents of %v: %v", intent.Namespace(), err)
+		}
+		deleted += n
+	}
+	log.Logvf(log.Always, "deleted %v %v in %v changed %v of %v", deleted, util.Pluralize(int(deleted), "document", "documents"),
+		len(spans), util.Pluralize(len(spans), "range", "ranges"), intent.Namespace())
+	return nil
+}
+
+// deleteSpan deletes the documents whose _id is in a span. The span is read
+// through the _id index, whose bounds follow the server's sort order across
+// types, unlike a $gte and $lt query.
+func deleteSpan(collection *mongo.Collection, span idSpan) (int64, error) {
+	opts := mopt.Find().
+		SetHint(bson.D{{"_id", 1}}).
+		SetProjection(bson.D{{"_id", 1}})
+	if span.hasMin {
+		opts.SetMin(bson.D{{"_id", span.min}})
+	}
+	if span.hasMax {
+		opts.SetMax(bson.D{{"_id", span.max}})
+	}
+	cursor, err := collection.Find(context.Background(), bson.D{}, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	var deleted int64
+	var ids bson.A
+	flush := func() error {
+		if len(ids) == 0 {
+			return nil
+		}
+		result, err := collection.DeleteMany(context.Background(), bson.D{{"_id", bson.D{{"$in", ids}}}})
+		if err != nil {
+			return err
+		}
+		deleted += result.DeletedCount
+		ids = nil
+		return nil
+	}
+	for cursor.Next(context.Background()) {
+		ids = append(ids, cursor.Current.Lookup("_id"))
+		if len(ids) == differentialDeleteBatch {
+			if err = flush(); err != nil {
+				return deleted, err
+			}
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return deleted, err
+	}
+	return deleted, flush()
+}
@@ -0,0 +1,83 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChangedSpans(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Adjacent changed ranges are joined into spans", t, func() {
+		ranges := []manifestRange{
+			{Changed: true},
+			{Min: int32(10)},
+			{Min: int32(20), Changed: true},
+			{Min: int32(30), Changed: true},
+			{Min: "a"},
+			{Min: "m", Changed: true},
+		}
+		So(changedSpans(ranges), ShouldResemble, []idSpan{
+			{max: int32(10), hasMax: true},
+			{min: int32(20), hasMin: true, max: "a", hasMax: true},
+			{min: "m", hasMin: true},
+		})
+	})
+
+	Convey("A manifest without changes has no spans", t, func() {
+		So(changedSpans([]manifestRange{{}, {Min: int32(5)}}), ShouldBeEmpty)
+	})
+}
+
+func TestPrepareDifferential(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	newRestore := func() (*MongoRestore, *intents.Intent) {
+		restore := &MongoRestore{manager: intents.NewIntentManager()}
+		intent := &intents.Intent{DB: "db", C: "c"}
+		restore.manager.PutWithNamespace("src.c", intent)
+		return restore, intent
+	}
+	differential := &Metadata{DifferentialBase: "2021-06-01T12:00:00Z"}
+
+	Convey("Without --applyDifferential a differential dump is refused", t, func() {
+		restore, intent := newRestore()
+		err := restore.prepareDifferential(intent, differential)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, ApplyDifferentialOption)
+		So(restore.prepareDifferential(intent, &Metadata{}), ShouldBeNil)
+	})
+
+	Convey("With --applyDifferential", t, func() {
+		restore, intent := newRestore()
+		restore.differentialManifest = &hashManifest{Collections: map[string]*manifestCollection{
+			"src.c": {Ranges: []manifestRange{{Changed: true}}},
+		}}
+
+		Convey("the ranges are looked up under the source namespace", func() {
+			So(restore.prepareDifferential(intent, differential), ShouldBeNil)
+			So(restore.differentialRanges["db.c"], ShouldHaveLength, 1)
+			So(restore.replacedWhole["db.c"], ShouldBeFalse)
+		})
+
+		Convey("a collection missing from the manifest is refused", func() {
+			delete(restore.differentialManifest.Collections, "src.c")
+			So(restore.prepareDifferential(intent, differential), ShouldNotBeNil)
+		})
+
+		Convey("a collection dumped whole is replaced", func() {
+			So(restore.prepareDifferential(intent, &Metadata{}), ShouldBeNil)
+			So(restore.replacedWhole["db.c"], ShouldBeTrue)
+			So(restore.differentialRanges, ShouldNotContainKey, "db.c")
+		})
+	})
+}
@@ -0,0 +1,218 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/idx"
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/text"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// writeRestorePlan prints what a restore would do for --dryRun: the
+// namespaces it would drop, create and insert into, the indexes it would
+// build, and how users, roles and the oplog would be restored. It only
+// reads from the destination, to find the collections that already exist.
+func (restore *MongoRestore) writeRestorePlan(w io.Writer) error {
+	bySource := restore.manager.NormalIntentsBySource()
+	sources := make([]string, 0, len(bySource))
+	for source := range bySource {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	fmt.Fprintf(w, "restore plan (dry run, nothing will be written):\n")
+	if len(sources) == 0 {
+		fmt.Fprintf(w, "  no collections to restore\n")
+	}
+	for _, source := range sources {
+		if err := restore.writeNamespacePlan(w, source, bySource[source]); err != nil {
+			return err
+		}
+	}
+	restore.writeUsersAndRolesPlan(w)
+	restore.writeOplogPlan(w)
+	return nil
+}
+
+func (restore *MongoRestore) writeNamespacePlan(w io.Writer, source string, intent *intents.Intent) error {
+	kind := "collection"
+	switch {
+	case intent.IsTimeseries():
+		kind = "timeseries collection"
+	case intent.IsView():
+		kind = "view"
+	}
+	if source == intent.Namespace() {
+		fmt.Fprintf(w, "  %v %v\n", kind, intent.Namespace())
+	} else {
+		fmt.Fprintf(w, "  %v %v (renamed from %v)\n", kind, intent.Namespace(), source)
+	}
+
+	if restore.stages(intent) {
+		fmt.Fprintf(w, "    restore into %v, build its indexes and check its count, then rename it over the %v\n",
+			stagingIntent(intent).Namespace(), kind)
+	}
+
+	exists, err := restore.CollectionExists(intent.DB, intent.C)
+	if err != nil {
+		return fmt.Errorf("error reading database: %v", err)
+	}
+	drop := restore.OutputOptions.Drop || restore.replacedWhole[intent.Namespace()]
+	switch {
+	case exists && drop && strings.HasPrefix(intent.C, "system."):
+		fmt.Fprintf(w, "    keep the existing %v; system collections are not dropped\n", kind)
+	case exists && drop:
+		fmt.Fprintf(w, "    drop the existing %v\n", kind)
+		exists = false
+	case exists:
+		fmt.Fprintf(w, "    restore into the existing %v without dropping it\n", kind)
+	}
+
+	if !exists {
+		switch {
+		case restore.OutputOptions.NoOptionsRestore:
+			fmt.Fprintf(w, "    create the %v without options\n", kind)
+		case len(intent.Options) == 0:
+			fmt.Fprintf(w, "    create the %v with no metadata\n", kind)
+		default:
+			fmt.Fprintf(w, "    create the %v with options %v\n", kind, planJSON(intent.Options))
+		}
+	}
+	if ranges, ok := restore.differentialRanges[intent.Namespace()]; ok && exists {
+		spans := changedSpans(ranges)
+		fmt.Fprintf(w, "    delete the documents in %v changed _id %v\n", len(spans), util.Pluralize(len(spans), "range", "ranges"))
+	}
+	if intent.BSONFile != nil && !intent.IsView() {
+		if restore.docFilter != nil {
+			fmt.Fprintf(w, "    insert documents matching --docFilter from %v (%v)\n", intent.Location, text.FormatByteAmount(intent.Size))
+		} else {
+			fmt.Fprintf(w, "    insert documents from %v (%v)\n", intent.Location, text.FormatByteAmount(intent.Size))
+		}
+	}
+
+	var indexes, skipped []string
+	for _, index := range restore.indexCatalog.GetIndexes(intent.DB, intent.C) {
+		name, _ := index.Options["name"].(string)
+		if name == "_id_" {
+			// the _id index is created with the collection
+			continue
+		}
+		if restore.skipIndex(intent.Namespace(), index) {
+			skipped = append(skipped, name)
+			continue
+		}
+		line := fmt.Sprintf("%v %v", name, planJSON(index.Key))
+		options := bson.M{}
+		for key, value := range index.Options {
+			if key != "name" && key != "v" && key != "ns" {
+				options[key] = value
+			}
+		}
+		restore.overrideIndexOptions(&idx.IndexDocument{Options: options})
+		if len(options) > 0 {
+			line += " " + planJSON(options)
+		}
+		indexes = append(indexes, line)
+	}
+	switch {
+	case len(indexes) == 0:
+	case restore.OutputOptions.NoIndexRestore:
+		fmt.Fprintf(w, "    skip %v %v (--noIndexRestore)\n", len(indexes), util.Pluralize(len(indexes), "index", "indexes"))
+	default:
+		fmt.Fprintf(w, "    build %v %v:\n", len(indexes), util.Pluralize(len(indexes), "index", "indexes"))
+		for _, index := range indexes {
+			fmt.Fprintf(w, "      %v\n", index)
+		}
+	}
+	if len(skipped) > 0 && !restore.OutputOptions.NoIndexRestore {
+		fmt.Fprintf(w, "    skip %v (--indexFilter)\n", strings.Join(skipped, ", "))
+	}
+	return nil
+}
+
+func (restore *MongoRestore) writeUsersAndRolesPlan(w io.Writer) {
+	if !restore.ShouldRestoreUsersAndRoles() {
+		return
+	}
+	for _, intent := range []*intents.Intent{restore.manager.Users(), restore.manager.Roles()} {
+		if intent == nil {
+			continue
+		}
+		kind := "users"
+		if intent.IsRoles() {
+			kind = "roles"
+		}
+		target := "all databases"
+		if intent.DB != "admin" {
+			target = "database " + intent.DB
+		}
+		fmt.Fprintf(w, "  %v from %v\n", kind, intent.Location)
+		if restore.OutputOptions.Drop {
+			fmt.Fprintf(w, "    replace the existing %v of %v\n", kind, target)
+		} else {
+			fmt.Fprintf(w, "    merge with the existing %v of %v\n", kind, target)
+		}
+		if intent.IsUsers() && len(restore.passwordResets) > 0 {
+			var names []string
+			for _, reset := range restore.passwordResets {
+				names = append(names, reset.name())
+			}
+			fmt.Fprintf(w, "    reset the passwords of %v\n", strings.Join(names, ", "))
+		}
+	}
+}
+
+func (restore *MongoRestore) writeOplogPlan(w io.Writer) {
+	if !restore.InputOptions.OplogReplay || restore.manager.Oplog() == nil {
+		return
+	}
+	fmt.Fprintf(w, "  oplog from %v\n", restore.manager.Oplog().Location)
+	if restore.InputOptions.OplogLimit != "" {
+		fmt.Fprintf(w, "    replay entries before %v\n", restore.InputOptions.OplogLimit)
+	} else {
+		fmt.Fprintf(w, "    replay all entries\n")
+	}
+	opts := restore.InputOptions
+	if len(opts.OplogNsInclude) > 0 {
+		fmt.Fprintf(w, "    only for namespaces matching %v\n", strings.Join(opts.OplogNsInclude, ", "))
+	}
+	if len(opts.OplogNsExclude) > 0 {
+		fmt.Fprintf(w, "    except for namespaces matching %v\n", strings.Join(opts.OplogNsExclude, ", "))
+	}
+	if opts.OplogOpFilter != "" {
+		fmt.Fprintf(w, "    only operations of type %v\n", opts.OplogOpFilter)
+	}
+}
+
+// planJSON formats a document for the plan, with map keys in sorted order so
+// that plans are stable.
+func planJSON(doc interface{}) string {
+	if m, ok := doc.(bson.M); ok {
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		d := bson.D{}
+		for _, key := range keys {
+			d = append(d, bson.E{Key: key, Value: m[key]})
+		}
+		doc = d
+	}
+	out, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return fmt.Sprintf("%v", doc)
+	}
+	return string(out)
+}
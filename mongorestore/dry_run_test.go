@@ -0,0 +1,91 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/idx"
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/options"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestWriteRestorePlan(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With intents for a renamed and an existing collection", t, func() {
+		mr := newMongoRestore()
+		mr.OutputOptions = &OutputOptions{}
+		mr.ToolOptions.Namespace = &options.Namespace{}
+		mr.indexCatalog = idx.NewIndexCatalog()
+		// the destination already has db1.c2 and nothing in db2
+		mr.knownCollections = map[string][]string{"db1": {"c2"}, "db2": {}}
+
+		renamed := &intents.Intent{DB: "db2", C: "c1", Location: "dump/db1/c1.bson", Size: 2048,
+			Options: bson.M{"validationLevel": "strict", "capped": true}}
+		renamed.BSONFile = &realBSONFile{path: renamed.Location, intent: renamed}
+		mr.manager.PutWithNamespace("db1.c1", renamed)
+		existing := &intents.Intent{DB: "db1", C: "c2", Location: "dump/db1/c2.bson", Size: 10}
+		existing.BSONFile = &realBSONFile{path: existing.Location, intent: existing}
+		mr.manager.Put(existing)
+
+		mr.indexCatalog.AddIndex("db2", "c1", &idx.IndexDocument{
+			Key:     bson.D{bson.E{Key: "_id", Value: 1}},
+			Options: bson.M{"name": "_id_", "v": 2},
+		})
+		mr.indexCatalog.AddIndex("db2", "c1", &idx.IndexDocument{
+			Key:     bson.D{bson.E{Key: "a", Value: 1}},
+			Options: bson.M{"name": "a_1", "v": 2, "unique": true},
+		})
+
+		Convey("the plan lists creations, inserts and index builds", func() {
+			var out bytes.Buffer
+			So(mr.writeRestorePlan(&out), ShouldBeNil)
+			plan := out.String()
+			So(plan, ShouldContainSubstring, "collection db2.c1 (renamed from db1.c1)")
+			So(plan, ShouldContainSubstring, `create the collection with options {"capped":true,"validationLevel":"strict"}`)
+			So(plan, ShouldContainSubstring, "insert documents from dump/db1/c1.bson (2.00KB)")
+			So(plan, ShouldContainSubstring, "build 1 index:")
+			So(plan, ShouldContainSubstring, `a_1 {"a":1}`)
+			So(plan, ShouldContainSubstring, `"unique":true`)
+			So(plan, ShouldNotContainSubstring, "_id_")
+			So(plan, ShouldContainSubstring, "restore into the existing collection without dropping it")
+		})
+
+		Convey("with --drop and --noIndexRestore, existing collections are dropped and indexes skipped", func() {
+			mr.OutputOptions.Drop = true
+			mr.OutputOptions.NoIndexRestore = true
+			var out bytes.Buffer
+			So(mr.writeRestorePlan(&out), ShouldBeNil)
+			plan := out.String()
+			So(plan, ShouldContainSubstring, "drop the existing collection")
+			So(plan, ShouldContainSubstring, "create the collection with no metadata")
+			So(plan, ShouldContainSubstring, "skip 1 index (--noIndexRestore)")
+		})
+
+		Convey("with --indexFilter and --hideIndexes, filtered indexes are skipped and the rest hidden", func() {
+			mr.indexCatalog.AddIndex("db2", "c1", &idx.IndexDocument{
+				Key:     bson.D{bson.E{Key: "tmp", Value: 1}},
+				Options: bson.M{"name": "tmp_1", "v": 2},
+			})
+			mr.OutputOptions.HideIndexes = true
+			filters, err := parseIndexFilters([]string{"tmp_*"})
+			So(err, ShouldBeNil)
+			mr.indexFilters = filters
+			var out bytes.Buffer
+			So(mr.writeRestorePlan(&out), ShouldBeNil)
+			plan := out.String()
+			So(plan, ShouldContainSubstring, "build 1 index:")
+			So(plan, ShouldContainSubstring, `"hidden":true`)
+			So(plan, ShouldContainSubstring, "skip tmp_1 (--indexFilter)")
+		})
+	})
+}
@@ -0,0 +1,142 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// --onDuplicate policies for documents whose _id already exists in the
+// target collection.
+const (
+	onDuplicateSkip    = "skip"
+	onDuplicateReplace = "replace"
+	onDuplicateMerge   = "merge"
+	onDuplicateFail    = "fail"
+)
+
+// upsertsDocuments reports whether documents are written with upserts
+// rather than inserts. Time series buckets can only be inserted, which
+// checkTimeseriesOnDuplicate makes sure of.
+func (restore *MongoRestore) upsertsDocuments(collectionType string) bool {
+	policy := restore.OutputOptions.OnDuplicate
+	return (policy == onDuplicateReplace || policy == onDuplicateMerge) && collectionType != "timeseries"
+}
+
+// checkTimeseriesOnDuplicate returns an error if --onDuplicate asks for
+// existing documents to be replaced or merged in a time series collection,
+// whose buckets can only be inserted. When replace is implied for a later
+// archive it is ignored instead: the collection must then be new, so it has
+// no documents to replace.
+func (restore *MongoRestore) checkTimeseriesOnDuplicate(intent *intents.Intent) error {
+	policy := restore.OutputOptions.OnDuplicate
+	if (policy != onDuplicateReplace && policy != onDuplicateMerge) || restore.impliedOnDuplicate {
+		return nil
+	}
+	return fmt.Errorf("cannot use %v=%v with the time series collection %v; use skip or fail, or exclude it with --nsExclude",
+		OnDuplicateOption, policy, intent.Namespace())
+}
+
+// writeDocument adds a document to the bulk writer according to --onDuplicate.
+// With replace or merge, the bulk writer must be set to upsert.
+func (restore *MongoRestore) writeDocument(bulk *db.BufferedBulkInserter, raw bson.Raw, collectionType string) (*mongo.BulkWriteResult, error) {
+	if !restore.upsertsDocuments(collectionType) {
+		return bulk.InsertRaw(raw)
+	}
+	id, err := raw.LookupErr("_id")
+	if err != nil {
+		// without an _id there is nothing to collide with
+		return bulk.InsertRaw(raw)
+	}
+	var doc bson.D
+	if err = bson.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("error decoding document: %v", err)
+	}
+	selector := bson.D{bson.E{Key: "_id", Value: id}}
+	if restore.OutputOptions.OnDuplicate == onDuplicateReplace {
+		return bulk.Replace(selector, doc)
+	}
+	// $set of the unchanged _id is allowed, and keeps the update valid for
+	// documents that only have an _id
+	return bulk.Update(selector, bson.D{bson.E{Key: "$set", Value: doc}})
+}
+
+// resultFromWrite converts the result of a bulk write according to
+// --onDuplicate, and filters out the errors that do not stop the restore.
+func (restore *MongoRestore) resultFromWrite(bulkResult *mongo.BulkWriteResult, err error) Result {
+	result := NewResultFromBulkResult(bulkResult, err)
+	if bulkResult != nil {
+		// upserted documents were inserted and matched ones overwritten
+		result.Successes += bulkResult.UpsertedCount + bulkResult.MatchedCount
+	}
+
+	switch restore.OutputOptions.OnDuplicate {
+	case onDuplicateSkip:
+		var duplicates int64
+		result.Err, duplicates = withoutDuplicateKeyErrors(result.Err)
+		result.Failures -= duplicates
+		result.Skipped += duplicates
+		if duplicates > 0 {
+			log.Logvf(log.DebugLow, "skipped %v documents that already exist", duplicates)
+		}
+	case onDuplicateFail:
+		if isDuplicateKeyError(result.Err) {
+			result.Err = fmt.Errorf("document already exists (--onDuplicate=fail): %v", result.Err)
+			return result
+		}
+	}
+	result.Err = db.FilterError(restore.OutputOptions.StopOnError, result.Err)
+	return result
+}
+
+// isDuplicateKeyError reports whether err includes a duplicate key error.
+func isDuplicateKeyError(err error) bool {
+	switch mongoErr := err.(type) {
+	case mongo.WriteError:
+		return mongoErr.Code == db.ErrDuplicateKeyCode
+	case mongo.BulkWriteException:
+		for _, writeErr := range mongoErr.WriteErrors {
+			if writeErr.Code == db.ErrDuplicateKeyCode {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return int(mongoErr.Code) == db.ErrDuplicateKeyCode
+	}
+	return false
+}
+
+// withoutDuplicateKeyErrors removes the duplicate key errors from err,
+// returning what is left of it and how many were removed.
+func withoutDuplicateKeyErrors(err error) (error, int64) {
+	switch mongoErr := err.(type) {
+	case mongo.WriteError:
+		if mongoErr.Code == db.ErrDuplicateKeyCode {
+			return nil, 1
+		}
+	case mongo.BulkWriteException:
+		var kept []mongo.BulkWriteError
+		for _, writeErr := range mongoErr.WriteErrors {
+			if writeErr.Code != db.ErrDuplicateKeyCode {
+				kept = append(kept, writeErr)
+			}
+		}
+		removed := int64(len(mongoErr.WriteErrors) - len(kept))
+		if len(kept) == 0 && mongoErr.WriteConcernError == nil {
+			return nil, removed
+		}
+		mongoErr.WriteErrors = kept
+		return mongoErr, removed
+	}
+	return err, 0
+}
@@ -0,0 +1,98 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func testBulkWriteException(codes ...int) mongo.BulkWriteException {
+	var bwe mongo.BulkWriteException
+	for i, code := range codes {
+		bwe.WriteErrors = append(bwe.WriteErrors, mongo.BulkWriteError{
+			WriteError: mongo.WriteError{Index: i, Code: code, Message: "error"},
+		})
+	}
+	return bwe
+}
+
+func TestOnDuplicate(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a bulk write that hit two duplicate keys", t, func() {
+		mr := newMongoRestore()
+		mr.OutputOptions = &OutputOptions{}
+		bulkResult := &mongo.BulkWriteResult{InsertedCount: 3}
+		bulkErr := testBulkWriteException(db.ErrDuplicateKeyCode, db.ErrDuplicateKeyCode)
+
+		Convey("by default they are logged as failures", func() {
+			result := mr.resultFromWrite(bulkResult, bulkErr)
+			So(result.Err, ShouldBeNil)
+			So(result.Successes, ShouldEqual, 3)
+			So(result.Failures, ShouldEqual, 2)
+		})
+
+		Convey("with skip they are counted as skipped", func() {
+			mr.OutputOptions.OnDuplicate = onDuplicateSkip
+			result := mr.resultFromWrite(bulkResult, bulkErr)
+			So(result.Err, ShouldBeNil)
+			So(result.Failures, ShouldEqual, 0)
+			So(result.Skipped, ShouldEqual, 2)
+		})
+
+		Convey("with fail the restore stops", func() {
+			mr.OutputOptions.OnDuplicate = onDuplicateFail
+			result := mr.resultFromWrite(bulkResult, bulkErr)
+			So(result.Err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Skip keeps the errors that are not duplicate keys", t, func() {
+		err, removed := withoutDuplicateKeyErrors(testBulkWriteException(db.ErrDuplicateKeyCode, 2))
+		So(removed, ShouldEqual, 1)
+		bwe, ok := err.(mongo.BulkWriteException)
+		So(ok, ShouldBeTrue)
+		So(bwe.WriteErrors, ShouldHaveLength, 1)
+		So(bwe.WriteErrors[0].Code, ShouldEqual, 2)
+	})
+
+	Convey("Upserts count matched documents as restored", t, func() {
+		mr := newMongoRestore()
+		mr.OutputOptions = &OutputOptions{OnDuplicate: onDuplicateReplace}
+		So(mr.upsertsDocuments(""), ShouldBeTrue)
+		So(mr.upsertsDocuments("timeseries"), ShouldBeFalse)
+		result := mr.resultFromWrite(&mongo.BulkWriteResult{UpsertedCount: 2, MatchedCount: 5}, nil)
+		So(result.Successes, ShouldEqual, 7)
+	})
+
+	Convey("Time series collections refuse replace and merge", t, func() {
+		mr := newMongoRestore()
+		mr.OutputOptions = &OutputOptions{}
+		intent := &intents.Intent{DB: "db", C: "weather", Type: "timeseries"}
+		for _, policy := range []string{"", onDuplicateSkip, onDuplicateFail} {
+			mr.OutputOptions.OnDuplicate = policy
+			So(mr.checkTimeseriesOnDuplicate(intent), ShouldBeNil)
+		}
+		for _, policy := range []string{onDuplicateReplace, onDuplicateMerge} {
+			mr.OutputOptions.OnDuplicate = policy
+			So(mr.checkTimeseriesOnDuplicate(intent), ShouldNotBeNil)
+		}
+
+		Convey("unless replace is implied for a later archive", func() {
+			mr.OutputOptions.OnDuplicate = ""
+			step := mr.archiveStep("incr.archive", false)
+			So(step.OutputOptions.OnDuplicate, ShouldEqual, onDuplicateReplace)
+			So(step.checkTimeseriesOnDuplicate(intent), ShouldBeNil)
+		})
+	})
+}
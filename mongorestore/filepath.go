@@ -17,8 +17,10 @@ import (
 	"sync/atomic"
 
 	"github.com/huimingz/mongo-tools/common/archive"
+	"github.com/huimingz/mongo-tools/common/compression"
 	"github.com/huimingz/mongo-tools/common/intents"
 	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/remote"
 	"github.com/huimingz/mongo-tools/common/util"
 )
 
@@ -98,6 +100,8 @@ type realBSONFile struct {
 	errorWriter
 	intent *intents.Intent
 	gzip   bool
+	// resumeOffset is where reading starts when resuming a restore.
+	resumeOffset int64
 }
 
 // Open is part of the intents.file interface. realBSONFiles need to be Opened before Read
@@ -107,11 +111,22 @@ func (f *realBSONFile) Open() (err error) {
 		// this error shouldn't happen normally
 		return fmt.Errorf("error reading BSON file for %v", f.intent.Namespace())
 	}
-	file, err := os.Open(f.path)
+	file, err := openInput(f.path)
 	if err != nil {
 		return fmt.Errorf("error reading BSON file %v: %v", f.path, err)
 	}
-	posFile := &posTrackingReader{0, file}
+	if f.resumeOffset > 0 {
+		seeker, ok := file.(io.Seeker)
+		if !ok {
+			file.Close()
+			return fmt.Errorf("error resuming BSON file %v: the file cannot be seeked", f.path)
+		}
+		if _, err = seeker.Seek(f.resumeOffset, io.SeekStart); err != nil {
+			file.Close()
+			return fmt.Errorf("error resuming BSON file %v: %v", f.path, err)
+		}
+	}
+	posFile := &posTrackingReader{f.resumeOffset, file}
 	if f.gzip {
 		gzFile, err := gzip.NewReader(posFile)
 		posUncompressedFile := &posTrackingReader{0, gzFile}
@@ -121,12 +136,40 @@ func (f *realBSONFile) Open() (err error) {
 		f.PosReader = &mixedPosTrackingReader{
 			readHolder: posUncompressedFile,
 			posHolder:  posFile}
-	} else {
+		return nil
+	}
+	if f.resumeOffset > 0 {
+		// only uncompressed files are resumed at an offset
 		f.PosReader = posFile
+		return nil
+	}
+	codec := f.codec()
+	decompressed, err := compression.NewCodecReader(codec, posFile)
+	if err != nil {
+		posFile.Close()
+		return fmt.Errorf("error decompressing compressed BSON file %v: %v", f.path, err)
+	}
+	if codec == compression.None {
+		f.PosReader = &posTrackingReader{0, &util.WrappedReadCloser{ReadCloser: decompressed, Inner: posFile}}
+		return nil
 	}
+	f.PosReader = &mixedPosTrackingReader{
+		readHolder: &posTrackingReader{0, decompressed},
+		posHolder:  posFile}
 	return nil
 }
 
+// codec returns the compression of the file, going by the --gzip option and
+// the file's extension. The contents are never sniffed: a plain BSON file may
+// start with the bytes of a compression format's magic number.
+func (f *realBSONFile) codec() compression.Codec {
+	if f.gzip {
+		return compression.Gzip
+	}
+	_, codec := compression.TrimExtension(f.path)
+	return codec
+}
+
 // realMetadataFile implements the intents.file interface. It lets intents read from real
 // metadata.json files on disk via an embedded os.File
 // The Read, Write and Close methods of the intents.file interface is implemented here by the
@@ -148,7 +191,7 @@ func (f *realMetadataFile) Open() (err error) {
 	if f.path == "" {
 		return fmt.Errorf("error reading metadata for %v", f.intent.Namespace())
 	}
-	file, err := os.Open(f.path)
+	file, err := openInput(f.path)
 	if err != nil {
 		return fmt.Errorf("error reading metadata %v: %v", f.path, err)
 	}
@@ -159,7 +202,13 @@ func (f *realMetadataFile) Open() (err error) {
 		}
 		f.ReadCloser = &util.WrappedReadCloser{gzFile, file}
 	} else {
-		f.ReadCloser = file
+		_, codec := compression.TrimExtension(f.path)
+		decompressed, err := compression.NewCodecReader(codec, file)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("error reading compressed metadata %v: %v", f.path, err)
+		}
+		f.ReadCloser = &util.WrappedReadCloser{ReadCloser: decompressed, Inner: file}
 	}
 	return nil
 }
@@ -234,14 +283,22 @@ func (restore *MongoRestore) getInfoFromFile(filename string) (string, FileType,
 			fileType = BSONFileType
 			metadataFullPath = strings.TrimSuffix(filename, ".bson.gz") + ".metadata.json.gz"
 		}
-	} else if strings.HasSuffix(baseFileName, ".metadata.json") {
-		collName = strings.TrimSuffix(baseFileName, ".metadata.json")
-		fileType = MetadataFileType
-		metadataFullPath = filename
-	} else if strings.HasSuffix(baseFileName, ".bson") {
-		collName = strings.TrimSuffix(baseFileName, ".bson")
-		fileType = BSONFileType
-		metadataFullPath = strings.TrimSuffix(filename, ".bson") + ".metadata.json"
+	} else {
+		// files written with zstd or lz4 compression keep their extension,
+		// and are decompressed when they are read
+		name, ext := baseFileName, ""
+		if trimmed, codec := compression.TrimExtension(baseFileName); codec == compression.Zstd || codec == compression.LZ4 {
+			name, ext = trimmed, strings.TrimPrefix(baseFileName, trimmed)
+		}
+		if strings.HasSuffix(name, ".metadata.json") {
+			collName = strings.TrimSuffix(name, ".metadata.json")
+			fileType = MetadataFileType
+			metadataFullPath = filename
+		} else if strings.HasSuffix(name, ".bson") {
+			collName = strings.TrimSuffix(name, ".bson")
+			fileType = BSONFileType
+			metadataFullPath = strings.TrimSuffix(filename, ".bson"+ext) + ".metadata.json" + ext
+		}
 	}
 
 	// If the collection name is truncated, parse the full name from the metadata file.
@@ -372,7 +429,7 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike) error {
 
 // CreateIntentForOplog creates an intent for a file that we want to treat as an oplog.
 func (restore *MongoRestore) CreateIntentForOplog() error {
-	target, err := newActualPath(restore.InputOptions.OplogFile)
+	target, err := newTargetPath(restore.InputOptions.OplogFile)
 	db := ""
 	collection := "oplog"
 	if err != nil {
@@ -464,6 +521,9 @@ func (restore *MongoRestore) CreateIntentsForDB(db string, dir archive.DirLike)
 					C:    destC,
 					Size: entry.Size(),
 				}
+				if strings.HasPrefix(collection, "system.buckets.") {
+					intent.Type = "timeseries"
+				}
 				if restore.InputOptions.Archive != "" {
 					if restore.InputOptions.Archive == "-" {
 						intent.Location = "archive on stdin"
@@ -584,7 +644,7 @@ func (restore *MongoRestore) CreateIntentForCollection(db string, collection str
 		return err
 	}
 	if fileType != BSONFileType {
-		return fmt.Errorf("file %v does not have .bson or .bson.gz extension", bsonFile.Path())
+		return fmt.Errorf("file %v does not have a .bson, .bson.gz, .bson.zst or .bson.lz4 extension", bsonFile.Path())
 	}
 
 	var isTimeseries bool
@@ -607,9 +667,6 @@ func (restore *MongoRestore) CreateIntentForCollection(db string, collection str
 	log.Logvf(log.DebugLow, "scanning directory %v for metadata", bsonFile.Parent())
 	entries, err := bsonFile.Parent().ReadDir()
 	if err != nil {
-		if isTimeseries {
-			return fmt.Errorf("could not find the timeseries collection metadata file for %s", db+"."+collection)
-		}
 		log.Logvf(log.Info, "error attempting to locate metadata for file: %v", err)
 		log.Logv(log.Info, "restoring collection without metadata")
 		restore.manager.Put(intent)
@@ -621,7 +678,12 @@ func (restore *MongoRestore) CreateIntentForCollection(db string, collection str
 	if restore.InputOptions.Gzip {
 		metadataName = strings.TrimSuffix(bsonFile.Name(), ".bson.gz") + ".metadata.json.gz"
 	} else {
-		metadataName = strings.TrimSuffix(bsonFile.Name(), ".bson") + ".metadata.json"
+		name, codec := compression.TrimExtension(bsonFile.Name())
+		ext := ""
+		if codec != compression.None {
+			ext = strings.TrimPrefix(bsonFile.Name(), name)
+		}
+		metadataName = strings.TrimSuffix(name, ".bson") + ".metadata.json" + ext
 	}
 
 	if isTimeseries {
@@ -640,9 +702,6 @@ func (restore *MongoRestore) CreateIntentForCollection(db string, collection str
 	}
 
 	if intent.MetadataFile == nil {
-		if isTimeseries {
-			return fmt.Errorf("could not find the timeseries collection metadata file for %s", db+"."+collection)
-		}
 		log.Logv(log.Info, "restoring collection without metadata")
 	}
 
@@ -764,3 +823,141 @@ func (ap actualPath) IsDir() bool {
 	}
 	return stat.IsDir()
 }
+
+// openInput opens a file on disk or streams one from a URL.
+func openInput(path string) (io.ReadCloser, error) {
+	if remote.IsRemote(path) {
+		return remote.Open(path)
+	}
+	return os.Open(path)
+}
+
+// newTargetPath returns the DirLike for a dump directory or file, which may
+// be on disk or under a URL.
+func newTargetPath(path string) (archive.DirLike, error) {
+	if remote.IsRemote(path) {
+		rp, err := newRemotePath(path)
+		if err != nil {
+			return nil, err
+		}
+		return rp, nil
+	}
+	ap, err := newActualPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return ap, nil
+}
+
+// remotePath implements archive.DirLike for dumps stored under a URL. Only
+// S3 URLs can be listed, so restoring a dump directory requires one; a
+// single BSON file can be restored from any URL.
+type remotePath struct {
+	url    string
+	size   int64
+	isDir  bool
+	parent *remotePath
+	// children is filled in from a listing of the directory on first use.
+	children []archive.DirLike
+	listed   bool
+}
+
+func newRemotePath(url string) (*remotePath, error) {
+	url = strings.TrimSuffix(url, "/")
+	parent := &remotePath{url: parentURL(url), isDir: true}
+	objects, err := remote.List(url)
+	if err != nil && err != remote.ErrNotListable {
+		return nil, err
+	}
+	if len(objects) > 0 {
+		dir := &remotePath{url: url, isDir: true, parent: parent}
+		dir.addObjects(objects)
+		return dir, nil
+	}
+	obj, err := remote.Stat(url)
+	if err != nil {
+		return nil, err
+	}
+	return &remotePath{url: url, size: obj.Size, parent: parent}, nil
+}
+
+// parentURL strips the last path element from url, keeping at least the
+// bucket or host.
+func parentURL(url string) string {
+	hostStart := strings.Index(url, "://") + len("://")
+	if i := strings.LastIndex(url, "/"); i > hostStart {
+		return url[:i]
+	}
+	return url
+}
+
+// addObjects builds the tree of directories and files below rp from a
+// recursive listing of its objects.
+func (rp *remotePath) addObjects(objects []remote.Object) {
+	rp.listed = true
+	dirs := map[string]*remotePath{rp.url: rp}
+	for _, obj := range objects {
+		rel := strings.TrimPrefix(obj.URL, rp.url+"/")
+		parts := strings.Split(rel, "/")
+		dir := rp
+		for i, part := range parts {
+			if part == "" {
+				// "directory" marker objects have a trailing slash
+				break
+			}
+			url := dir.url + "/" + part
+			if i == len(parts)-1 {
+				dir.children = append(dir.children, &remotePath{url: url, size: obj.Size, parent: dir})
+				break
+			}
+			child, ok := dirs[url]
+			if !ok {
+				child = &remotePath{url: url, isDir: true, parent: dir, listed: true}
+				dirs[url] = child
+				dir.children = append(dir.children, child)
+			}
+			dir = child
+		}
+	}
+}
+
+func (rp *remotePath) Name() string {
+	return rp.url[strings.LastIndex(rp.url, "/")+1:]
+}
+
+func (rp *remotePath) Path() string {
+	return rp.url
+}
+
+func (rp *remotePath) Size() int64 {
+	return rp.size
+}
+
+func (rp *remotePath) IsDir() bool {
+	return rp.isDir
+}
+
+func (rp *remotePath) Stat() (archive.DirLike, error) {
+	return rp, nil
+}
+
+func (rp *remotePath) Parent() archive.DirLike {
+	if rp.parent == nil {
+		return nil
+	}
+	return rp.parent
+}
+
+func (rp *remotePath) ReadDir() ([]archive.DirLike, error) {
+	if !rp.isDir {
+		return nil, fmt.Errorf("%v is not a directory", rp.url)
+	}
+	if !rp.listed {
+		objects, err := remote.List(rp.url)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %v: %v", rp.url, err)
+		}
+		rp.addObjects(objects)
+	}
+	return rp.children, nil
+}
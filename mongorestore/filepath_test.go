@@ -8,17 +8,24 @@ package mongorestore
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/huimingz/mongo-tools/common/compression"
 	"github.com/huimingz/mongo-tools/common/intents"
 	"github.com/huimingz/mongo-tools/common/log"
 	"github.com/huimingz/mongo-tools/common/options"
 	commonOpts "github.com/huimingz/mongo-tools/common/options"
+	"github.com/huimingz/mongo-tools/common/remote"
 	"github.com/huimingz/mongo-tools/common/testtype"
 	"github.com/huimingz/mongo-tools/common/util"
 	"github.com/huimingz/mongo-tools/mongorestore/ns"
+	"github.com/klauspost/compress/zstd"
 	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func init() {
@@ -507,3 +514,113 @@ func TestCreateIntentsForLongCollectionName(t *testing.T) {
 		})
 	})
 }
+
+func TestCreateAllIntentsFromRemotePath(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a dump directory listed from S3", t, func() {
+		mr := newMongoRestore()
+		dir := &remotePath{url: "s3://backups/dump", isDir: true}
+		dir.addObjects([]remote.Object{
+			{URL: "s3://backups/dump/", Size: 0},
+			{URL: "s3://backups/dump/db1/c1.bson", Size: 100},
+			{URL: "s3://backups/dump/db1/c1.metadata.json", Size: 10},
+			{URL: "s3://backups/dump/db1/c2.bson", Size: 200},
+			{URL: "s3://backups/dump/db2/c1.bson", Size: 300},
+		})
+
+		Convey("the objects form a directory tree", func() {
+			entries, err := dir.ReadDir()
+			So(err, ShouldBeNil)
+			So(len(entries), ShouldEqual, 2)
+			So(entries[0].Name(), ShouldEqual, "db1")
+			So(entries[0].IsDir(), ShouldBeTrue)
+			So(entries[0].Parent().Path(), ShouldEqual, "s3://backups/dump")
+			So(parentURL("s3://backups/dump"), ShouldEqual, "s3://backups")
+			So(parentURL("s3://backups"), ShouldEqual, "s3://backups")
+		})
+
+		Convey("intents are created for each collection", func() {
+			So(mr.CreateAllIntents(dir), ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+
+			i0 := mr.manager.Pop()
+			So(i0.Namespace(), ShouldEqual, "db1.c1")
+			So(i0.Location, ShouldEqual, "s3://backups/dump/db1/c1.bson")
+			So(i0.MetadataLocation, ShouldEqual, "s3://backups/dump/db1/c1.metadata.json")
+			So(i0.Size, ShouldEqual, 100)
+			i1 := mr.manager.Pop()
+			So(i1.Namespace(), ShouldEqual, "db1.c2")
+			So(i1.MetadataLocation, ShouldEqual, "")
+			i2 := mr.manager.Pop()
+			So(i2.Namespace(), ShouldEqual, "db2.c1")
+			So(mr.manager.Pop(), ShouldBeNil)
+		})
+	})
+}
+
+func TestCreateAllIntentsFromCompressedFiles(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A plain BSON file starting with the bytes of a gzip header is read as is", t, func() {
+		// a document of 35615 bytes starts with 0x1f 0x8b
+		doc, err := bson.Marshal(bson.D{bson.E{Key: "s", Value: strings.Repeat("x", 35602)}})
+		So(err, ShouldBeNil)
+		So(doc[:2], ShouldResemble, []byte{0x1f, 0x8b})
+		path := filepath.Join(t.TempDir(), "c.bson")
+		So(ioutil.WriteFile(path, doc, 0644), ShouldBeNil)
+
+		file := &realBSONFile{path: path, intent: &intents.Intent{DB: "db", C: "c"}}
+		So(file.codec(), ShouldEqual, compression.None)
+		So(file.Open(), ShouldBeNil)
+		data, err := ioutil.ReadAll(file)
+		So(err, ShouldBeNil)
+		So(file.Close(), ShouldBeNil)
+		So(data, ShouldResemble, []byte(doc))
+	})
+
+	Convey("With a dump directory written with zstd compression", t, func() {
+		mr := newMongoRestore()
+		root := t.TempDir()
+		So(os.Mkdir(filepath.Join(root, "db1"), 0755), ShouldBeNil)
+		doc, err := bson.Marshal(bson.D{bson.E{Key: "_id", Value: 1}})
+		So(err, ShouldBeNil)
+		writeZstd := func(name string, data []byte) {
+			var buf bytes.Buffer
+			w, err := zstd.NewWriter(&buf)
+			So(err, ShouldBeNil)
+			_, _ = w.Write(data)
+			So(w.Close(), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(root, "db1", name), buf.Bytes(), 0644), ShouldBeNil)
+		}
+		writeZstd("c1.bson.zst", doc)
+		writeZstd("c1.metadata.json.zst", []byte(`{"options":{},"indexes":[]}`))
+		dir, err := newActualPath(root)
+		So(err, ShouldBeNil)
+
+		Convey("intents are created for the compressed files", func() {
+			So(mr.CreateAllIntents(dir), ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+
+			intent := mr.manager.Pop()
+			So(intent.Namespace(), ShouldEqual, "db1.c1")
+			So(intent.MetadataLocation, ShouldEqual, filepath.Join(root, "db1", "c1.metadata.json.zst"))
+
+			Convey("and the files are decompressed when read", func() {
+				So(intent.BSONFile.Open(), ShouldBeNil)
+				data, err := ioutil.ReadAll(intent.BSONFile)
+				So(err, ShouldBeNil)
+				So(intent.BSONFile.Close(), ShouldBeNil)
+				So(data, ShouldResemble, []byte(doc))
+
+				So(intent.MetadataFile.Open(), ShouldBeNil)
+				metadata, err := ioutil.ReadAll(intent.MetadataFile)
+				So(err, ShouldBeNil)
+				So(intent.MetadataFile.Close(), ShouldBeNil)
+				So(string(metadata), ShouldEqual, `{"options":{},"indexes":[]}`)
+
+				So(intent.BSONFile.(*realBSONFile).codec(), ShouldEqual, compression.Zstd)
+			})
+		})
+	})
+}
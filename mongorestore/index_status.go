@@ -0,0 +1,192 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// indexStatusInterval is how often the status of running index builds is
+// reported.
+const indexStatusInterval = 30 * time.Second
+
+// progressSuffix matches the progress at the end of a currentOp message.
+var progressSuffix = regexp.MustCompile(`:?\s*\d+/\d+\s+\d+%$`)
+
+// indexBuildMonitor reports the server's progress on the index builds
+// mongorestore started, as shown by currentOp. A nil *indexBuildMonitor
+// tracks nothing.
+type indexBuildMonitor struct {
+	sync.Mutex
+	// building maps the namespaces with running index builds to the time
+	// the builds started.
+	building map[string]time.Time
+	stopped  chan struct{}
+}
+
+// startIndexBuildMonitor starts reporting index builds until stop is called.
+func (restore *MongoRestore) startIndexBuildMonitor() *indexBuildMonitor {
+	m := &indexBuildMonitor{
+		building: map[string]time.Time{},
+		stopped:  make(chan struct{}),
+	}
+	go m.run(restore.SessionProvider)
+	return m
+}
+
+// begin records that index builds on a namespace started.
+func (m *indexBuildMonitor) begin(ns string) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	m.building[ns] = time.Now()
+}
+
+// end records that the index builds on a namespace finished.
+func (m *indexBuildMonitor) end(ns string) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	delete(m.building, ns)
+}
+
+// stop ends the reporting.
+func (m *indexBuildMonitor) stop() {
+	if m != nil {
+		close(m.stopped)
+	}
+}
+
+// running returns the namespaces with running index builds and when they
+// started.
+func (m *indexBuildMonitor) running() map[string]time.Time {
+	m.Lock()
+	defer m.Unlock()
+	running := make(map[string]time.Time, len(m.building))
+	for ns, started := range m.building {
+		running[ns] = started
+	}
+	return running
+}
+
+func (m *indexBuildMonitor) run(provider *db.SessionProvider) {
+	ticker := time.NewTicker(indexStatusInterval)
+	defer ticker.Stop()
+	checkCurrentOp := true
+	for {
+		select {
+		case <-m.stopped:
+			return
+		case <-ticker.C:
+		}
+
+		running := m.running()
+		if len(running) == 0 {
+			continue
+		}
+		var statuses map[string]string
+		if checkCurrentOp {
+			var err error
+			statuses, err = currentIndexBuilds(provider)
+			if err != nil {
+				log.Logvf(log.DebugLow, "not reporting index build progress from currentOp: %v", err)
+				checkCurrentOp = false
+			}
+		}
+		for _, line := range indexStatusLines(running, statuses, time.Now()) {
+			log.Logv(log.Always, line)
+		}
+	}
+}
+
+// currentIndexBuilds returns the progress message of each namespace with an
+// index build in currentOp.
+func currentIndexBuilds(provider *db.SessionProvider) (map[string]string, error) {
+	command := bson.D{
+		{Key: "currentOp", Value: 1},
+		{Key: "$or", Value: bson.A{
+			bson.M{"command.createIndexes": bson.M{"$exists": true}},
+			bson.M{"msg": bson.M{"$regex": "^Index Build"}},
+		}},
+	}
+	var result struct {
+		InProg []bson.M `bson:"inprog"`
+	}
+	if err := provider.Run(command, &result, "admin"); err != nil {
+		return nil, err
+	}
+	statuses := map[string]string{}
+	for _, op := range result.InProg {
+		ns, status := indexBuildStatus(op)
+		if _, seen := statuses[ns]; ns == "" || status == "" || seen && op["progress"] == nil {
+			// prefer the operations that report their progress
+			continue
+		}
+		statuses[ns] = status
+	}
+	return statuses, nil
+}
+
+// indexBuildStatus returns the namespace of an index build operation from
+// currentOp and a description of its progress, if it reports any.
+func indexBuildStatus(op bson.M) (string, string) {
+	ns, _ := op["ns"].(string)
+	if command, ok := op["command"].(bson.M); ok {
+		if coll, ok := command["createIndexes"].(string); ok {
+			// the createIndexes command runs on <db>.$cmd
+			ns = strings.SplitN(ns, ".", 2)[0] + "." + coll
+		}
+	}
+	msg, _ := op["msg"].(string)
+	// the message repeats its phase, as in "Index Build: scanning collection
+	// Index Build: scanning collection: 500/1000 50%"
+	msg = progressSuffix.ReplaceAllString(msg, "")
+	if i := strings.LastIndex(msg, "Index Build:"); i > 0 {
+		msg = msg[i:]
+	}
+	if progress, ok := op["progress"].(bson.M); ok {
+		done, _ := util.ToInt(progress["done"])
+		total, _ := util.ToInt(progress["total"])
+		if total > 0 {
+			msg = fmt.Sprintf("%v %v/%v (%2.1f%%)", msg, done, total, float64(done)/float64(total)*100)
+		}
+	}
+	return ns, strings.TrimSpace(msg)
+}
+
+// indexStatusLines describes each running index build, in namespace order.
+func indexStatusLines(running map[string]time.Time, statuses map[string]string, now time.Time) []string {
+	var namespaces []string
+	for ns := range running {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	lines := make([]string, 0, len(namespaces))
+	for _, ns := range namespaces {
+		line := fmt.Sprintf("building indexes for %v for %v", ns, now.Sub(running[ns]).Round(time.Second))
+		if status := statuses[ns]; status != "" {
+			line += ": " + status
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,50 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIndexBuildStatus(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("An index build thread reports its phase and progress", t, func() {
+		ns, status := indexBuildStatus(bson.M{
+			"ns":       "db.c",
+			"msg":      "Index Build: scanning collection Index Build: scanning collection: 500/1000 50%",
+			"progress": bson.M{"done": int64(500), "total": int64(1000)},
+		})
+		So(ns, ShouldEqual, "db.c")
+		So(status, ShouldEqual, "Index Build: scanning collection 500/1000 (50.0%)")
+	})
+
+	Convey("A createIndexes command is matched to its collection", t, func() {
+		ns, status := indexBuildStatus(bson.M{
+			"ns":      "db.$cmd",
+			"command": bson.M{"createIndexes": "c"},
+			"msg":     "Index Build: draining writes received during build",
+		})
+		So(ns, ShouldEqual, "db.c")
+		So(status, ShouldEqual, "Index Build: draining writes received during build")
+	})
+
+	Convey("Each running build is described with how long it has run", t, func() {
+		now := time.Now()
+		running := map[string]time.Time{"db.b": now.Add(-90 * time.Second), "db.a": now.Add(-time.Hour)}
+		lines := indexStatusLines(running, map[string]string{"db.b": "Index Build: scanning collection 5/10 (50.0%)"}, now)
+		So(lines, ShouldResemble, []string{
+			"building indexes for db.a for 1h0m0s",
+			"building indexes for db.b for 1m30s: Index Build: scanning collection 5/10 (50.0%)",
+		})
+	})
+}
@@ -0,0 +1,204 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/huimingz/mongo-tools/common/idx"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/options"
+)
+
+// indexPattern is a compiled --indexFilter pattern. A nil ns matches every
+// namespace.
+type indexPattern struct {
+	ns   *regexp.Regexp
+	name *regexp.Regexp
+}
+
+// wildcardRegexp compiles a pattern in which * matches any run of characters.
+func wildcardRegexp(pattern string) *regexp.Regexp {
+	return regexp.MustCompile("^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1) + "$")
+}
+
+// parseIndexFilters compiles --indexFilter patterns of the form
+// [<database>.<collection>:]<index name>.
+func parseIndexFilters(patterns []string) ([]indexPattern, error) {
+	var filters []indexPattern
+	for _, pattern := range patterns {
+		var filter indexPattern
+		name := pattern
+		if i := strings.Index(pattern, ":"); i >= 0 {
+			if i == 0 {
+				return nil, fmt.Errorf("invalid --indexFilter %q: empty namespace", pattern)
+			}
+			filter.ns = wildcardRegexp(pattern[:i])
+			name = pattern[i+1:]
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid --indexFilter %q: empty index name", pattern)
+		}
+		filter.name = wildcardRegexp(name)
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// skipIndex reports whether an index is excluded by --indexFilter.
+func (restore *MongoRestore) skipIndex(ns string, index *idx.IndexDocument) bool {
+	name, _ := index.Options["name"].(string)
+	for _, filter := range restore.indexFilters {
+		if (filter.ns == nil || filter.ns.MatchString(ns)) && filter.name.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// overrideIndexOptions applies --hideIndexes, --indexBackground and
+// --indexUnique to an index.
+func (restore *MongoRestore) overrideIndexOptions(index *idx.IndexDocument) {
+	if restore.OutputOptions.HideIndexes {
+		index.Options["hidden"] = true
+	}
+	switch restore.OutputOptions.IndexBackground {
+	case "true":
+		index.Options["background"] = true
+	case "false":
+		delete(index.Options, "background")
+	}
+	switch restore.OutputOptions.IndexUnique {
+	case "true":
+		if canBeUnique(index) {
+			index.Options["unique"] = true
+		}
+	case "false":
+		delete(index.Options, "unique")
+	}
+}
+
+// canBeUnique reports whether the server can build an index as unique. Text,
+// geospatial, hashed and wildcard indexes, whose keys are given by a string
+// or a $** path, cannot be.
+func canBeUnique(index *idx.IndexDocument) bool {
+	for _, key := range index.Key {
+		if _, ok := key.Value.(string); ok {
+			return false
+		}
+		if key.Key == "$**" || strings.HasSuffix(key.Key, ".$**") {
+			return false
+		}
+	}
+	return true
+}
+
+// filterIndexes drops the indexes excluded by --indexFilter and applies the
+// option overrides to the rest.
+func (restore *MongoRestore) filterIndexes(ns string, indexes []*idx.IndexDocument) []*idx.IndexDocument {
+	var kept []*idx.IndexDocument
+	for _, index := range indexes {
+		if restore.skipIndex(ns, index) {
+			log.Logvf(log.Always, "skipping index %v on %v (--indexFilter)", index.Options["name"], ns)
+			continue
+		}
+		restore.overrideIndexOptions(index)
+		kept = append(kept, index)
+	}
+	return kept
+}
+
+// indexBuildWorkers returns the number of collections whose indexes are
+// built in parallel.
+func (restore *MongoRestore) indexBuildWorkers() int {
+	if restore.OutputOptions.IndexBuildConcurrency > 0 {
+		return restore.OutputOptions.IndexBuildConcurrency
+	}
+	return restore.OutputOptions.NumParallelCollections
+}
+
+// buildIndexesEarly reports whether a collection's indexes are built as soon
+// as its documents are restored, rather than after everything else. The
+// oplog may change indexes, so they are always built last when replaying it.
+func (restore *MongoRestore) buildIndexesEarly() bool {
+	return restore.OutputOptions.IndexBuildConcurrency > 0 &&
+		!restore.OutputOptions.IndexesLast &&
+		!restore.OutputOptions.NoIndexRestore &&
+		!restore.InputOptions.OplogReplay
+}
+
+// indexBuilder builds the indexes of collections while other collections are
+// still being restored. A nil indexBuilder ignores everything.
+type indexBuilder struct {
+	queue     chan *options.Namespace
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	lock  sync.Mutex
+	built map[string]bool
+	err   error
+}
+
+// startIndexBuilder starts the index build workers.
+func (restore *MongoRestore) startIndexBuilder() *indexBuilder {
+	builder := &indexBuilder{
+		queue: make(chan *options.Namespace, len(restore.manager.NormalIntents())),
+		built: map[string]bool{},
+	}
+	workers := restore.indexBuildWorkers()
+	log.Logvf(log.DebugLow, "building indexes of restored collections up to %v at a time", workers)
+	for i := 0; i < workers; i++ {
+		builder.wg.Add(1)
+		go func() {
+			defer builder.wg.Done()
+			for namespace := range builder.queue {
+				err := restore.RestoreIndexesForNamespace(namespace)
+				builder.lock.Lock()
+				builder.built[namespace.String()] = true
+				if err != nil && builder.err == nil {
+					builder.err = err
+				}
+				builder.lock.Unlock()
+			}
+		}()
+	}
+	return builder
+}
+
+// enqueue schedules the index builds for a restored namespace.
+func (builder *indexBuilder) enqueue(db, collection string) {
+	if builder == nil {
+		return
+	}
+	builder.queue <- &options.Namespace{DB: db, Collection: collection}
+}
+
+// wait stops accepting namespaces and waits for the queued builds. It can
+// be called more than once.
+func (builder *indexBuilder) wait() error {
+	if builder == nil {
+		return nil
+	}
+	builder.closeOnce.Do(func() { close(builder.queue) })
+	builder.wg.Wait()
+	builder.lock.Lock()
+	defer builder.lock.Unlock()
+	return builder.err
+}
+
+// isBuilt reports whether the indexes of a namespace were already built.
+func (builder *indexBuilder) isBuilt(ns string) bool {
+	if builder == nil {
+		return false
+	}
+	builder.lock.Lock()
+	defer builder.lock.Unlock()
+	return builder.built[ns]
+}
@@ -0,0 +1,119 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/idx"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func testIndex(name string, options bson.M) *idx.IndexDocument {
+	if options == nil {
+		options = bson.M{}
+	}
+	options["name"] = name
+	return &idx.IndexDocument{Key: bson.D{bson.E{Key: "a", Value: 1}}, Options: options}
+}
+
+func TestIndexFilters(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With --indexFilter patterns", t, func() {
+		mr := newMongoRestore()
+		mr.OutputOptions = &OutputOptions{}
+		filters, err := parseIndexFilters([]string{"tmp_*", "db.c*:a_1"})
+		So(err, ShouldBeNil)
+		mr.indexFilters = filters
+
+		Convey("a bare pattern matches index names in every namespace", func() {
+			So(mr.skipIndex("db.c", testIndex("tmp_x", nil)), ShouldBeTrue)
+			So(mr.skipIndex("other.d", testIndex("tmp_", nil)), ShouldBeTrue)
+			So(mr.skipIndex("db.c", testIndex("b_1", nil)), ShouldBeFalse)
+		})
+
+		Convey("a namespace pattern restricts the match", func() {
+			So(mr.skipIndex("db.coll", testIndex("a_1", nil)), ShouldBeTrue)
+			So(mr.skipIndex("db2.coll", testIndex("a_1", nil)), ShouldBeFalse)
+			So(mr.skipIndex("db.coll", testIndex("a_10", nil)), ShouldBeFalse)
+		})
+
+		Convey("filterIndexes keeps only the unmatched indexes", func() {
+			kept := mr.filterIndexes("db.c", []*idx.IndexDocument{testIndex("tmp_1", nil), testIndex("b_1", nil)})
+			So(kept, ShouldHaveLength, 1)
+			So(kept[0].Options["name"], ShouldEqual, "b_1")
+		})
+	})
+
+	Convey("Invalid patterns are rejected", t, func() {
+		_, err := parseIndexFilters([]string{":a_1"})
+		So(err, ShouldNotBeNil)
+		_, err = parseIndexFilters([]string{"db.c:"})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestOverrideIndexOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With index option overrides", t, func() {
+		mr := newMongoRestore()
+		mr.OutputOptions = &OutputOptions{}
+
+		Convey("nothing changes without overrides", func() {
+			index := testIndex("a_1", bson.M{"unique": true, "background": true})
+			mr.overrideIndexOptions(index)
+			So(index.Options, ShouldResemble, bson.M{"name": "a_1", "unique": true, "background": true})
+		})
+
+		Convey("--hideIndexes, --indexBackground and --indexUnique are applied", func() {
+			mr.OutputOptions.HideIndexes = true
+			mr.OutputOptions.IndexBackground = "true"
+			mr.OutputOptions.IndexUnique = "false"
+			index := testIndex("a_1", bson.M{"unique": true})
+			mr.overrideIndexOptions(index)
+			So(index.Options, ShouldResemble, bson.M{"name": "a_1", "hidden": true, "background": true})
+		})
+
+		Convey("--indexUnique only makes the index types that can be unique unique", func() {
+			mr.OutputOptions.IndexUnique = "true"
+			index := testIndex("a_1", nil)
+			mr.overrideIndexOptions(index)
+			So(index.Options["unique"], ShouldEqual, true)
+
+			for _, key := range []bson.D{
+				{{"a", "text"}},
+				{{"loc", "2dsphere"}, {"a", 1}},
+				{{"a", "hashed"}},
+				{{"$**", 1}},
+				{{"a.$**", 1}},
+			} {
+				index := testIndex("other", nil)
+				index.Key = key
+				mr.overrideIndexOptions(index)
+				So(index.Options, ShouldNotContainKey, "unique")
+			}
+		})
+	})
+
+	Convey("Indexes are built early only with --indexBuildConcurrency", t, func() {
+		mr := newMongoRestore()
+		mr.OutputOptions = &OutputOptions{NumParallelCollections: 4}
+		So(mr.buildIndexesEarly(), ShouldBeFalse)
+		So(mr.indexBuildWorkers(), ShouldEqual, 4)
+
+		mr.OutputOptions.IndexBuildConcurrency = 2
+		So(mr.buildIndexesEarly(), ShouldBeTrue)
+		So(mr.indexBuildWorkers(), ShouldEqual, 2)
+
+		mr.OutputOptions.IndexesLast = true
+		So(mr.buildIndexesEarly(), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/archive"
+	"github.com/huimingz/mongo-tools/common/text"
+	"github.com/huimingz/mongo-tools/common/util"
+)
+
+// InspectArchives writes a summary of each --archive to w: the namespaces in
+// it with their document counts, sizes and indexes, and the details of the
+// dump. It neither connects to a server nor restores anything.
+func InspectArchives(opts Options, w io.Writer) error {
+	if len(opts.Archives) == 0 {
+		return fmt.Errorf("--inspect requires --archive")
+	}
+	for _, path := range opts.Archives {
+		inputOpts := *opts.InputOptions
+		inputOpts.Archive = path
+		restore := &MongoRestore{
+			ToolOptions:  opts.ToolOptions,
+			InputOptions: &inputOpts,
+			InputReader:  os.Stdin,
+		}
+		if err := restore.inspectArchive(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (restore *MongoRestore) inspectArchive(w io.Writer) error {
+	name := fmt.Sprintf("archive '%v'", restore.InputOptions.Archive)
+	if restore.InputOptions.Archive == "-" {
+		name = "archive on stdin"
+	}
+	in, err := restore.getArchiveReader()
+	if err != nil {
+		return fmt.Errorf("error opening %v: %v", name, err)
+	}
+	defer in.Close()
+
+	summary, err := archive.Inspect(in)
+	if summary == nil {
+		return fmt.Errorf("error reading %v: %v", name, err)
+	}
+	header := summary.Header
+	fmt.Fprintf(w, "%v: format %v, written by mongodump %v from MongoDB %v\n",
+		name, header.FormatVersion, header.ToolVersion, header.ServerVersion)
+	details := []string{fmt.Sprintf("%v collections dumped in parallel", header.ConcurrentCollections)}
+	if header.Indexed {
+		details = append(details, "indexed")
+	}
+	fmt.Fprintf(w, "  %v\n", strings.Join(details, ", "))
+	if len(summary.Namespaces) == 0 {
+		fmt.Fprintf(w, "  no namespaces\n")
+	}
+	for _, ns := range summary.Namespaces {
+		restore.writeNamespaceSummary(w, ns)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %v: %v", name, err)
+	}
+	return nil
+}
+
+func (restore *MongoRestore) writeNamespaceSummary(w io.Writer, ns *archive.NamespaceSummary) {
+	kind := "collection"
+	switch ns.Type {
+	case "timeseries":
+		kind = "timeseries collection"
+	case "view":
+		kind = "view"
+	}
+	var details []string
+	if ns.HasData {
+		details = append(details,
+			fmt.Sprintf("%v %v", ns.Documents, util.Pluralize(int(ns.Documents), "document", "documents")),
+			text.FormatByteAmount(ns.Size))
+		if !ns.Complete {
+			details = append(details, "data ends early")
+		}
+	}
+	if metadata, err := restore.MetadataFromJSON([]byte(ns.Metadata)); err != nil {
+		details = append(details, fmt.Sprintf("unreadable metadata: %v", err))
+	} else if metadata != nil && len(metadata.Indexes) > 0 {
+		details = append(details,
+			fmt.Sprintf("%v %v", len(metadata.Indexes), util.Pluralize(len(metadata.Indexes), "index", "indexes")))
+	}
+	if len(details) == 0 {
+		fmt.Fprintf(w, "  %v %v\n", kind, ns.Namespace())
+		return
+	}
+	fmt.Fprintf(w, "  %v %v: %v\n", kind, ns.Namespace(), strings.Join(details, ", "))
+}
@@ -39,6 +39,14 @@ func main() {
 		return
 	}
 
+	if opts.Inspect {
+		if err = mongorestore.InspectArchives(opts, os.Stdout); err != nil {
+			log.Logvf(log.Always, "Failed: %v", err)
+			os.Exit(util.ExitFailure)
+		}
+		os.Exit(util.ExitSuccess)
+	}
+
 	restore, err := mongorestore.New(opts)
 	if err != nil {
 		log.Logvf(log.Always, err.Error())
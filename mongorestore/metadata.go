@@ -41,6 +41,12 @@ type Metadata struct {
 	Indexes        []*idx.IndexDocument `bson:"indexes"`
 	UUID           string               `bson:"uuid"`
 	CollectionName string               `bson:"collectionName"`
+	// BucketsOptions holds the options of the system.buckets collection
+	// backing a time series collection, as recorded by mongodump.
+	BucketsOptions bson.D `bson:"bucketsOptions,omitempty"`
+	// DifferentialBase is set by mongodump --baseManifest on collections
+	// that only hold the ranges changed since an earlier dump.
+	DifferentialBase string `bson:"differentialBase"`
 }
 
 // MetadataFromJSON takes a slice of JSON bytes and unmarshals them into usable
@@ -193,6 +199,9 @@ func (restore *MongoRestore) CreateIndexes(dbName string, collectionName string,
 		rawCommand = append(rawCommand, bson.E{"ignoreUnknownIndexOptions", true})
 	}
 
+	restore.indexMonitor.begin(dbName + "." + collectionName)
+	defer restore.indexMonitor.end(dbName + "." + collectionName)
+
 	err = session.Database(dbName).RunCommand(nil, rawCommand).Err()
 	if err == nil {
 		return nil
@@ -410,7 +419,7 @@ func (restore *MongoRestore) RestoreUsersOrRoles(users, roles *intents.Intent) e
 		}
 
 		log.Logvf(log.DebugLow, "restoring %v to temporary collection", arg.intentType)
-		result := restore.RestoreCollectionToDB("admin", arg.tempCollectionName, bsonSource, arg.intent.BSONFile, 0, "")
+		result := restore.RestoreCollectionToDB("admin", arg.tempCollectionName, bsonSource, arg.intent.BSONFile, 0, "", nil, nil)
 		if result.Err != nil {
 			return fmt.Errorf("error restoring %v: %v", arg.intentType, result.Err)
 		}
@@ -473,7 +482,7 @@ func (restore *MongoRestore) RestoreUsersOrRoles(users, roles *intents.Intent) e
 	if util.IsFalsy(res["ok"]) {
 		return fmt.Errorf("_mergeAuthzCollections command: %v", res["errmsg"])
 	}
-	return nil
+	return restore.resetPasswords()
 }
 
 // GetDumpAuthVersion reads the admin.system.version collection in the dump directory
@@ -9,8 +9,12 @@ package mongorestore
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/huimingz/mongo-tools/common/bsonutil"
+	"github.com/huimingz/mongo-tools/common/idx"
 	"github.com/huimingz/mongo-tools/common/intents"
 	commonOpts "github.com/huimingz/mongo-tools/common/options"
 	"github.com/huimingz/mongo-tools/common/testtype"
@@ -233,3 +237,45 @@ func readCollationTestData(filename string) (bson.D, error) {
 	}
 	return data, nil
 }
+
+func TestDifferentialDumpIsRefused(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A collection dumped with --baseManifest is not restored", t, func() {
+		dir, err := ioutil.TempDir("", "differential")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "c.metadata.json")
+		metadata := `{"indexes":[],"collectionName":"c","differentialBase":"2021-06-01T12:00:00Z"}`
+		So(ioutil.WriteFile(path, []byte(metadata), 0644), ShouldBeNil)
+
+		restore := &MongoRestore{manager: intents.NewIntentManager(), indexCatalog: idx.NewIndexCatalog(), OutputOptions: &OutputOptions{}}
+		restore.manager.Put(&intents.Intent{DB: "db", C: "c", MetadataLocation: path,
+			MetadataFile: &realMetadataFile{path: path}})
+		err = restore.PopulateMetadataForIntents()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "--baseManifest")
+	})
+}
+
+func TestDocFilterRefusesTimeseries(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A time series collection is not restored with --docFilter", t, func() {
+		dir, err := ioutil.TempDir("", "docfilter")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "weather.metadata.json")
+		metadata := `{"options":{"timeseries":{"timeField":"ts"}},"indexes":[],"collectionName":"weather","type":"timeseries"}`
+		So(ioutil.WriteFile(path, []byte(metadata), 0644), ShouldBeNil)
+
+		restore := &MongoRestore{manager: intents.NewIntentManager(), indexCatalog: idx.NewIndexCatalog(), OutputOptions: &OutputOptions{}}
+		restore.docFilter, err = bsonutil.ParseDocFilter(`{"sensor":1}`)
+		So(err, ShouldBeNil)
+		restore.manager.Put(&intents.Intent{DB: "db", C: "weather", MetadataLocation: path,
+			MetadataFile: &realMetadataFile{path: path}})
+		err = restore.PopulateMetadataForIntents()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, DocFilterOption)
+	})
+}
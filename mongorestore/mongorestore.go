@@ -20,12 +20,14 @@ import (
 
 	"github.com/huimingz/mongo-tools/common/archive"
 	"github.com/huimingz/mongo-tools/common/auth"
+	"github.com/huimingz/mongo-tools/common/bsonutil"
 	"github.com/huimingz/mongo-tools/common/db"
 	"github.com/huimingz/mongo-tools/common/idx"
 	"github.com/huimingz/mongo-tools/common/intents"
 	"github.com/huimingz/mongo-tools/common/log"
 	"github.com/huimingz/mongo-tools/common/options"
 	"github.com/huimingz/mongo-tools/common/progress"
+	"github.com/huimingz/mongo-tools/common/remote"
 	"github.com/huimingz/mongo-tools/common/util"
 	"github.com/huimingz/mongo-tools/mongorestore/ns"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -75,6 +77,12 @@ type MongoRestore struct {
 	includer *ns.Matcher
 	excluder *ns.Matcher
 
+	// oplogIncluder, oplogExcluder and oplogOps select the oplog entries
+	// to replay. A nil matcher or map selects everything.
+	oplogIncluder *ns.Matcher
+	oplogExcluder *ns.Matcher
+	oplogOps      map[string]bool
+
 	// indexes belonging to dbs and collections
 	dbCollectionIndexes map[string]collectionIndexes
 
@@ -85,10 +93,85 @@ type MongoRestore struct {
 	// boolean set if termination signal received; false by default
 	terminate bool
 
+	// resumeState records per-namespace progress for --resume.
+	resumeState *resumeState
+
+	// shardedCollections are the collections sharded by
+	// --restoreShardingMetadata, by the namespace they are restored to.
+	shardedCollections map[string]*shardedCollection
+	// targetShards are the shards of the target cluster, by name.
+	targetShards map[string]bool
+
+	// verifier and verifyManifest hold what --verify checks after restoring.
+	verifier       *restoreVerifier
+	verifyManifest *hashManifest
+
+	// differentialManifest is read from --applyDifferential. The ranges of
+	// the collections dumped with --baseManifest are kept in
+	// differentialRanges, and replacedWhole holds those dumped whole; both
+	// are keyed by the namespace restored to.
+	differentialManifest *hashManifest
+	differentialRanges   map[string][]manifestRange
+	replacedWhole        map[string]bool
+
+	// indexFilters are the compiled --indexFilter patterns, and indexBuilder
+	// builds indexes during the restore with --indexBuildConcurrency.
+	indexFilters []indexPattern
+	indexBuilder *indexBuilder
+
+	// docFilter selects the documents restored with --docFilter; nil
+	// restores all of them.
+	docFilter bsonutil.DocPredicate
+
+	// clusteredMatcher and cappedOverrides select the collections whose
+	// storage options are changed by --convertToClustered and --cappedOverride.
+	clusteredMatcher *ns.Matcher
+	cappedOverrides  []cappedOverride
+
+	// uuidOverrides are the parsed --uuidOverride entries, and uuidMap maps
+	// the UUIDs in the dump to those of the restored collections, or to ""
+	// where the server assigned one.
+	uuidOverrides []uuidOverride
+	uuidMap       map[string]string
+	uuidLock      sync.Mutex
+
+	// promoted holds the namespaces restored with --staging whose staging
+	// collections replaced them, indexes included.
+	promoted    map[string]bool
+	stagingLock sync.Mutex
+
+	// passwordResets and credentialMechanisms are read from
+	// --resetPasswordsFile and --credentialMechanisms.
+	passwordResets       []passwordReset
+	credentialMechanisms []string
+
+	// oplogAfter is the last oplog entry replayed from the archive before
+	// this one when restoring several archives, and lastOplogTs is the last
+	// one replayed by this restore.
+	oplogAfter  primitive.Timestamp
+	lastOplogTs primitive.Timestamp
+
+	// currentStep is the restore of the current archive when restoring
+	// several archives.
+	currentStep *MongoRestore
+	// impliedOnDuplicate is set when --onDuplicate=replace was not given
+	// but implied for an archive after the first.
+	impliedOnDuplicate bool
+
+	// indexMonitor reports the progress of the index builds in flight.
+	indexMonitor *indexBuildMonitor
+
+	// throttle paces writes for --rateLimit, --maxOpsPerSec and --maxReplicationLag.
+	throttle *util.Throttle
+
 	// Reader to take care of BSON input if not reading from the local filesystem.
 	// This is initialized to os.Stdin if unset.
 	InputReader io.Reader
 
+	// Writer for the restore plan printed by --dryRun.
+	// This is initialized to os.Stdout if unset.
+	PlanWriter io.Writer
+
 	// Server version for version-specific behavior
 	serverVersion db.Version
 }
@@ -188,6 +271,9 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 	if restore.InputOptions.RestoreDBUsersAndRoles && restore.ToolOptions.Namespace.DB == "admin" {
 		return fmt.Errorf("cannot use --restoreDbUsersAndRoles with the admin database")
 	}
+	if len(restore.OutputOptions.OpComment) > db.MaxCommentBytes {
+		return fmt.Errorf("%v can be at most %v bytes long", OpCommentOption, db.MaxCommentBytes)
+	}
 
 	var err error
 	restore.isMongos, err = restore.SessionProvider.IsMongos()
@@ -281,6 +367,10 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		return fmt.Errorf("invalid excludes: %v", err)
 	}
 
+	if err = restore.parseOplogFilters(); err != nil {
+		return err
+	}
+
 	if len(restore.NSOptions.NSFrom) != len(restore.NSOptions.NSTo) {
 		return fmt.Errorf("--nsFrom and --nsTo arguments must be specified an equal number of times")
 	}
@@ -294,22 +384,86 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 			"cannot specify a negative number of insertion workers per collection")
 	}
 
+	if restore.OutputOptions.CredentialMechanisms != "" {
+		if restore.OutputOptions.ResetPasswordsFile == "" {
+			return fmt.Errorf("--credentialMechanisms requires --resetPasswordsFile")
+		}
+		restore.credentialMechanisms, err = parseCredentialMechanisms(restore.OutputOptions.CredentialMechanisms)
+		if err != nil {
+			return err
+		}
+	}
+
+	if restore.OutputOptions.MaxRestoreRetries < 0 {
+		return fmt.Errorf("--maxRestoreRetries must not be negative")
+	}
+
 	if restore.OutputOptions.MaintainInsertionOrder {
 		restore.OutputOptions.StopOnError = true
 		restore.OutputOptions.NumInsertionWorkers = 1
 	}
 
-	if restore.OutputOptions.PreserveUUID {
-		if !restore.OutputOptions.Drop {
-			return fmt.Errorf("cannot specify --preserveUUID without --drop")
-		}
+	if err = restore.parseUUIDOptions(); err != nil {
+		return err
+	}
+	if err = restore.checkUUIDSupport(); err != nil {
+		return err
+	}
 
-		ok, err := SupportsCollectionUUID(restore.SessionProvider)
-		if err != nil {
-			return err
+	if err = restore.checkStagingOptions(); err != nil {
+		return err
+	}
+	if err = restore.checkDifferentialOptions(); err != nil {
+		return err
+	}
+
+	if restore.OutputOptions.Resume && restore.OutputOptions.ResumeStateFile == "" {
+		return fmt.Errorf("--resumeStateFile must not be empty with --resume")
+	}
+
+	if restore.OutputOptions.VerifyManifest != "" && !restore.OutputOptions.Verify {
+		return fmt.Errorf("--verifyManifest requires --verify")
+	}
+
+	if restore.OutputOptions.RestoreShardingMetadata &&
+		(restore.InputOptions.Archive != "" || restore.TargetDirectory == "-") {
+		return fmt.Errorf("--restoreShardingMetadata is only supported when restoring from a directory")
+	}
+
+	switch {
+	case restore.OutputOptions.RateLimit < 0:
+		return fmt.Errorf("--rateLimit must not be negative")
+	case restore.OutputOptions.MaxOpsPerSec < 0:
+		return fmt.Errorf("--maxOpsPerSec must not be negative")
+	case restore.OutputOptions.MaxReplicationLag < 0:
+		return fmt.Errorf("--maxReplicationLag must not be negative")
+	}
+
+	if restore.OutputOptions.IndexBuildConcurrency < 0 {
+		return fmt.Errorf(
+			"cannot specify a negative number of concurrent index builds: %v",
+			restore.OutputOptions.IndexBuildConcurrency)
+	}
+	restore.indexFilters, err = parseIndexFilters(restore.OutputOptions.IndexFilter)
+	if err != nil {
+		return err
+	}
+	if err = restore.parseStorageOverrides(); err != nil {
+		return err
+	}
+
+	if restore.InputOptions.DocFilter != "" {
+		switch {
+		case restore.InputOptions.OplogReplay:
+			return fmt.Errorf("cannot use --docFilter with --oplogReplay")
+		case restore.OutputOptions.Resume:
+			return fmt.Errorf("cannot use --docFilter with --resume")
+		case restore.OutputOptions.VerifyManifest != "":
+			return fmt.Errorf("cannot use --docFilter with --verifyManifest")
 		}
-		if !ok {
-			return fmt.Errorf("target host does not support --preserveUUID")
+		restore.docFilter, err = bsonutil.ParseDocFilter(restore.InputOptions.DocFilter)
+		if err != nil {
+			return fmt.Errorf("invalid --docFilter: %v", err)
 		}
 	}
 
@@ -326,12 +480,19 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 	if restore.InputReader == nil {
 		restore.InputReader = os.Stdin
 	}
+	if restore.PlanWriter == nil {
+		restore.PlanWriter = os.Stdout
+	}
 
 	return nil
 }
 
 // Restore runs the mongorestore program.
 func (restore *MongoRestore) Restore() Result {
+	if len(restore.InputOptions.Archives) > 1 {
+		return restore.restoreArchives()
+	}
+
 	var target archive.DirLike
 	err := restore.ParseAndValidateOptions()
 	if err != nil {
@@ -374,7 +535,7 @@ func (restore *MongoRestore) Restore() Result {
 			log.Logv(log.Always, "using default 'dump' directory")
 			usedDefaultTarget = true
 		}
-		target, err = newActualPath(restore.TargetDirectory)
+		target, err = newTargetPath(restore.TargetDirectory)
 		if err != nil {
 			if usedDefaultTarget {
 				log.Logv(log.Always, util.ShortUsage("mongorestore"))
@@ -479,11 +640,38 @@ func (restore *MongoRestore) Restore() Result {
 		return Result{Err: fmt.Errorf("cannot restore with conflicting namespace destinations")}
 	}
 
+	if restore.OutputOptions.ResetPasswordsFile != "" {
+		restore.passwordResets, err = loadPasswordResets(restore.OutputOptions.ResetPasswordsFile)
+		if err != nil {
+			return Result{Err: err}
+		}
+		if err = restore.checkPasswordResets(restore.manager.Users()); err != nil {
+			return Result{Err: err}
+		}
+	}
+
 	if restore.OutputOptions.DryRun {
+		// indexes in system.indexes collections of archives can only be
+		// read once the archive is demultiplexed, so they are left out
+		if restore.InputOptions.Archive == "" {
+			if err = restore.LoadIndexesFromBSON(); err != nil {
+				return Result{Err: fmt.Errorf("restore error: %v", err)}
+			}
+		}
+		if err = restore.PopulateMetadataForIntents(); err != nil {
+			return Result{Err: fmt.Errorf("restore error: %v", err)}
+		}
+		if err = restore.writeRestorePlan(restore.PlanWriter); err != nil {
+			return Result{Err: fmt.Errorf("error writing restore plan: %v", err)}
+		}
 		log.Logvf(log.Always, "dry run completed")
 		return Result{}
 	}
 
+	if err = restore.checkTargetCapacity(); err != nil {
+		return Result{Err: err}
+	}
+
 	demuxFinished := make(chan interface{})
 	var demuxErr error
 	if restore.InputOptions.Archive != "" {
@@ -492,8 +680,12 @@ func (restore *MongoRestore) Restore() Result {
 		restore.archive.Demux.NamespaceChan = namespaceChan
 		restore.archive.Demux.NamespaceErrorChan = namespaceErrorChan
 
+		indexed := restore.readArchiveThroughIndex()
 		go func() {
 			demuxErr = restore.archive.Demux.Run()
+			if indexed != nil {
+				indexed.Close()
+			}
 			close(demuxFinished)
 		}()
 		// consume the new namespace announcement from the demux for all of the special collections
@@ -531,6 +723,37 @@ func (restore *MongoRestore) Restore() Result {
 		}
 	}
 
+	if restore.OutputOptions.RestoreShardingMetadata {
+		if err = restore.prepareShardingMetadata(); err != nil {
+			return Result{Err: err}
+		}
+	}
+
+	if restore.OutputOptions.Resume {
+		restore.resumeState, err = loadResumeState(restore.OutputOptions.ResumeStateFile, restore.resumeSource())
+		if err != nil {
+			return Result{Err: err}
+		}
+		log.Logvf(log.Always, "recording restore progress in %v", restore.OutputOptions.ResumeStateFile)
+	}
+
+	if restore.OutputOptions.Verify {
+		restore.verifier = newRestoreVerifier()
+		if restore.OutputOptions.VerifyManifest != "" {
+			restore.verifyManifest, err = loadHashManifest(restore.OutputOptions.VerifyManifest)
+			if err != nil {
+				return Result{Err: err}
+			}
+		}
+	}
+
+	if restore.OutputOptions.ApplyDifferential != "" {
+		restore.differentialManifest, err = loadHashManifest(restore.OutputOptions.ApplyDifferential)
+		if err != nil {
+			return Result{Err: err}
+		}
+	}
+
 	// If restoring users and roles, make sure we validate auth versions
 	if restore.ShouldRestoreUsersAndRoles() {
 		log.Logv(log.Info, "comparing auth version of the dump directory and target server")
@@ -584,24 +807,65 @@ func (restore *MongoRestore) Restore() Result {
 		restore.manager.Finalize(intents.Legacy)
 	}
 
+	restore.throttle = restore.newWriteThrottle()
+	defer restore.throttle.Stop()
+
+	if !restore.OutputOptions.NoIndexRestore {
+		restore.indexMonitor = restore.startIndexBuildMonitor()
+		defer restore.indexMonitor.stop()
+	}
+
+	if restore.buildIndexesEarly() {
+		restore.indexBuilder = restore.startIndexBuilder()
+		// the builds already queued finish even if the restore fails
+		defer restore.indexBuilder.wait()
+	}
+
 	result := restore.RestoreIntents()
 	if result.Err != nil {
 		return result
 	}
+	if err = restore.indexBuilder.wait(); err != nil {
+		return result.withErr(err)
+	}
+
+	if restore.verifier != nil {
+		if err = restore.verifyRestore(); err != nil {
+			return result.withErr(err)
+		}
+	}
 
 	// Restore users/roles
 	if restore.ShouldRestoreUsersAndRoles() {
-		err = restore.RestoreUsersOrRoles(restore.manager.Users(), restore.manager.Roles())
-		if err != nil {
-			return result.withErr(fmt.Errorf("restore error: %v", err))
+		if restore.resumeState != nil && restore.resumeState.UsersAndRoles {
+			log.Logvf(log.Always, "users and roles were already restored, skipping")
+		} else {
+			err = restore.RestoreUsersOrRoles(restore.manager.Users(), restore.manager.Roles())
+			if err != nil {
+				return result.withErr(fmt.Errorf("restore error: %v", err))
+			}
+			if restore.resumeState != nil {
+				if err = restore.resumeState.markUsersAndRoles(); err != nil {
+					return result.withErr(err)
+				}
+			}
 		}
 	}
 
 	// Restore oplog
 	if restore.InputOptions.OplogReplay {
-		err = restore.RestoreOplog()
-		if err != nil {
-			return result.withErr(fmt.Errorf("restore error: %v", err))
+		if restore.resumeState != nil && restore.resumeState.Oplog {
+			log.Logvf(log.Always, "the oplog was already replayed, skipping")
+		} else {
+			err = restore.RestoreOplog()
+			if err != nil {
+				return result.withErr(fmt.Errorf("restore error: %v", err))
+			}
+			if restore.resumeState != nil {
+				if err = restore.resumeState.markOplog(); err != nil {
+					return result.withErr(err)
+				}
+			}
 		}
 	}
 
@@ -614,9 +878,16 @@ func (restore *MongoRestore) Restore() Result {
 
 	if restore.InputOptions.Archive != "" {
 		<-demuxFinished
-		return result.withErr(demuxErr)
+		if demuxErr != nil {
+			return result.withErr(demuxErr)
+		}
 	}
 
+	if restore.resumeState != nil {
+		if err = restore.resumeState.remove(); err != nil {
+			return result.withErr(err)
+		}
+	}
 	return result
 }
 
@@ -624,8 +895,12 @@ func (restore *MongoRestore) preFlightChecks() error {
 
 	for _, intent := range restore.manager.Intents() {
 		if intent.Type == "timeseries" {
+			if err := restore.checkTimeseriesOnDuplicate(intent); err != nil {
+				return err
+			}
 
-			if !restore.OutputOptions.Drop {
+			// a partially restored collection is expected to exist
+			if !restore.OutputOptions.Drop && !restore.resumeProgress(intent).started() {
 				timeseriesExists, err := restore.CollectionExists(intent.DB, intent.C)
 				if err != nil {
 					return err
@@ -653,6 +928,15 @@ func (restore *MongoRestore) preFlightChecks() error {
 		}
 	}
 
+	if restore.OutputOptions.HideIndexes && !restore.OutputOptions.NoIndexRestore &&
+		restore.serverVersion.LT(db.Version{4, 4, 0}) {
+		return fmt.Errorf("--hideIndexes requires MongoDB 4.4 or later on the destination")
+	}
+
+	if restore.clusteredMatcher != nil && restore.serverVersion.LT(db.Version{5, 3, 0}) {
+		return fmt.Errorf("--convertToClustered requires MongoDB 5.3 or later on the destination")
+	}
+
 	if restore.serverVersion.GTE(db.Version{4, 9, 0}) && !restore.OutputOptions.NoIndexRestore {
 		namespaces := restore.indexCatalog.Namespaces()
 		for _, ns := range namespaces {
@@ -672,28 +956,85 @@ func (restore *MongoRestore) preFlightChecks() error {
 	return nil
 }
 
+// readArchiveThroughIndex makes the demultiplexer read only the blocks of the
+// collections being restored, if the archive is a file written with an index
+// by mongodump --archiveIndex. Otherwise the whole archive is read as a
+// stream. It returns the indexed archive, which must be closed once the
+// demultiplexer finishes.
+func (restore *MongoRestore) readArchiveThroughIndex() *archive.IndexedArchive {
+	if !restore.archive.Prelude.Header.Indexed || restore.InputOptions.Gzip ||
+		restore.InputOptions.Archive == "-" || remote.IsRemote(restore.InputOptions.Archive) {
+		return nil
+	}
+	archiveFilePath := restore.InputOptions.Archive
+	stat, err := os.Stat(archiveFilePath)
+	if err != nil {
+		// split into volumes
+		return nil
+	}
+	if stat.IsDir() {
+		archiveFilePath = filepath.Join(archiveFilePath, "archive")
+	}
+	indexed, err := archive.OpenIndexed(archiveFilePath)
+	if err != nil {
+		log.Logvf(log.Always, "warning: can't use the archive index, reading the whole archive: %v", err)
+		return nil
+	}
+	if indexed == nil {
+		// compressed
+		return nil
+	}
+
+	skipped := map[string]bool{}
+	for _, ns := range restore.archive.Demux.SkipMuted() {
+		skipped[ns] = true
+	}
+	var namespaces []string
+	for ns := range indexed.Index {
+		if !skipped[ns] {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	log.Logvf(log.DebugLow, "reading %v of %v namespaces through the archive index, skipping %v",
+		len(namespaces), len(indexed.Index), len(skipped))
+	restore.archive.Demux.In = indexed.Reader(namespaces)
+	return indexed
+}
+
 func (restore *MongoRestore) getArchiveReader() (rc io.ReadCloser, err error) {
 	if restore.InputOptions.Archive == "-" {
 		rc = ioutil.NopCloser(restore.InputReader)
+	} else if remote.IsRemote(restore.InputOptions.Archive) {
+		log.Logvf(log.DebugLow, "streaming archive from %v", restore.InputOptions.Archive)
+		rc, err = remote.Open(restore.InputOptions.Archive)
+		if err != nil {
+			return nil, err
+		}
 	} else {
+		archiveFilePath := restore.InputOptions.Archive
 		targetStat, err := os.Stat(restore.InputOptions.Archive)
-		if err != nil {
+		if err != nil && !(os.IsNotExist(err) && archive.HasVolumes(archiveFilePath)) {
 			return nil, err
 		}
-		if targetStat.IsDir() {
-			defaultArchiveFilePath := filepath.Join(restore.InputOptions.Archive, "archive")
+		if err == nil && targetStat.IsDir() {
+			archiveFilePath = filepath.Join(restore.InputOptions.Archive, "archive")
 			if restore.InputOptions.Gzip {
-				defaultArchiveFilePath = defaultArchiveFilePath + ".gz"
-			}
-			rc, err = os.Open(defaultArchiveFilePath)
-			if err != nil {
-				return nil, err
+				archiveFilePath = archiveFilePath + ".gz"
 			}
+		}
+		if err = archive.CheckVolumeConflict(archiveFilePath); err != nil {
+			return nil, err
+		}
+		// archives written with mongodump --archiveMaxSize are split into
+		// numbered volumes, which are read back as one stream
+		if _, err = os.Stat(archiveFilePath); os.IsNotExist(err) && archive.HasVolumes(archiveFilePath) {
+			log.Logvf(log.DebugLow, "reading archive volumes starting with %v", archive.VolumeName(archiveFilePath, 1))
+			rc, err = archive.NewVolumeReader(archiveFilePath)
 		} else {
-			rc, err = os.Open(restore.InputOptions.Archive)
-			if err != nil {
-				return nil, err
-			}
+			rc, err = os.Open(archiveFilePath)
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
 	if restore.InputOptions.Gzip {
@@ -703,9 +1044,14 @@ func (restore *MongoRestore) getArchiveReader() (rc io.ReadCloser, err error) {
 		}
 		return &util.WrappedReadCloser{gzrc, rc}, nil
 	}
-	return rc, nil
+	// zstd and lz4 archives, and gzip ones restored without --gzip, are
+	// recognized by their first bytes
+	return archive.NewDecompressingReader(rc)
 }
 
 func (restore *MongoRestore) HandleInterrupt() {
 	restore.terminate = true
+	if restore.currentStep != nil {
+		restore.currentStep.HandleInterrupt()
+	}
 }
@@ -19,6 +19,7 @@ import (
 	"github.com/huimingz/mongo-tools/common/progress"
 	"github.com/huimingz/mongo-tools/common/txn"
 	"github.com/huimingz/mongo-tools/common/util"
+	"github.com/huimingz/mongo-tools/mongorestore/ns"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -34,7 +35,11 @@ type oplogContext struct {
 	progressor *progress.CountProgressor
 	session    *mongo.Client
 	totalOps   int
-	txnBuffer  *txn.Buffer
+	skippedOps int
+	// replayedOps counts the entries already replayed from an earlier
+	// archive.
+	replayedOps int
+	txnBuffer   *txn.Buffer
 }
 
 var knownCommands = map[string]bool{
@@ -74,6 +79,84 @@ func shouldIgnoreNamespace(ns string) bool {
 	return false
 }
 
+// oplogFilterOps are the operation types accepted by --oplogOpFilter.
+var oplogFilterOps = map[string]bool{"i": true, "u": true, "d": true, "c": true}
+
+// parseOplogFilters sets up --oplogNsInclude, --oplogNsExclude and
+// --oplogOpFilter.
+func (restore *MongoRestore) parseOplogFilters() error {
+	opts := restore.InputOptions
+	if !opts.OplogReplay {
+		if len(opts.OplogNsInclude) > 0 || len(opts.OplogNsExclude) > 0 || opts.OplogOpFilter != "" {
+			return fmt.Errorf("--oplogNsInclude, --oplogNsExclude and --oplogOpFilter require --oplogReplay")
+		}
+		return nil
+	}
+
+	var err error
+	if len(opts.OplogNsInclude) > 0 {
+		restore.oplogIncluder, err = ns.NewMatcher(opts.OplogNsInclude)
+		if err != nil {
+			return fmt.Errorf("invalid --oplogNsInclude: %v", err)
+		}
+	}
+	if len(opts.OplogNsExclude) > 0 {
+		restore.oplogExcluder, err = ns.NewMatcher(opts.OplogNsExclude)
+		if err != nil {
+			return fmt.Errorf("invalid --oplogNsExclude: %v", err)
+		}
+	}
+	if opts.OplogOpFilter != "" {
+		restore.oplogOps = map[string]bool{}
+		for _, op := range strings.Split(opts.OplogOpFilter, ",") {
+			op = strings.TrimSpace(op)
+			if !oplogFilterOps[op] {
+				return fmt.Errorf("invalid --oplogOpFilter operation %q, expected i, u, d or c", op)
+			}
+			restore.oplogOps[op] = true
+		}
+	}
+	return nil
+}
+
+// oplogTargetNamespace returns the namespace an oplog entry applies to. For
+// commands on a collection, this is the collection rather than <db>.$cmd.
+func oplogTargetNamespace(op db.Oplog) string {
+	if op.Operation != "c" || len(op.Object) == 0 {
+		return op.Namespace
+	}
+	target, ok := op.Object[0].Value.(string)
+	if !ok {
+		return op.Namespace
+	}
+	if op.Object[0].Key == "renameCollection" {
+		// the source of a rename is a full namespace
+		return target
+	}
+	dbName := strings.SplitN(op.Namespace, ".", 2)[0]
+	return dbName + "." + target
+}
+
+// skipOplogEntry reports whether an oplog entry is excluded by the oplog
+// filters. applyOps commands are never skipped themselves; the operations
+// they contain are filtered individually.
+func (restore *MongoRestore) skipOplogEntry(op db.Oplog) bool {
+	if op.Operation == "c" && isApplyOpsCmd(op.Object) {
+		return false
+	}
+	if restore.oplogOps != nil && !restore.oplogOps[op.Operation] {
+		return true
+	}
+	if restore.oplogIncluder == nil && restore.oplogExcluder == nil {
+		return false
+	}
+	target := oplogTargetNamespace(op)
+	if restore.oplogIncluder != nil && !restore.oplogIncluder.Has(target) {
+		return true
+	}
+	return restore.oplogExcluder != nil && restore.oplogExcluder.Has(target)
+}
+
 // RestoreOplog attempts to restore a MongoDB oplog.
 func (restore *MongoRestore) RestoreOplog() error {
 	log.Logv(log.Always, "replaying oplog")
@@ -124,6 +207,7 @@ func (restore *MongoRestore) RestoreOplog() error {
 			break
 		}
 		oplogCtx.progressor.Inc(int64(len(rawOplogEntry)))
+		restore.throttle.Wait(len(rawOplogEntry))
 
 		entryAsOplog := db.Oplog{}
 
@@ -132,6 +216,16 @@ func (restore *MongoRestore) RestoreOplog() error {
 			return fmt.Errorf("error reading oplog: %v", err)
 		}
 
+		if restore.replayedBefore(entryAsOplog.Timestamp) {
+			oplogCtx.replayedOps++
+			continue
+		}
+		if restore.lastOplogTs.IsZero() && oplogCtx.replayedOps == 0 {
+			if err = restore.checkOplogContinues(entryAsOplog.Timestamp); err != nil {
+				return err
+			}
+		}
+
 		err := restore.HandleOp(oplogCtx, entryAsOplog)
 		if err == errorTimestampBeforeLimit {
 			break
@@ -139,16 +233,26 @@ func (restore *MongoRestore) RestoreOplog() error {
 		if err != nil {
 			return err
 		}
-
+		restore.lastOplogTs = entryAsOplog.Timestamp
 	}
 	if fileNeedsIOBuffer, ok := intent.BSONFile.(intents.FileNeedsIOBuffer); ok {
 		fileNeedsIOBuffer.ReleaseIOBuffer()
 	}
 
 	log.Logvf(log.Always, "applied %v oplog entries", oplogCtx.totalOps)
+	if oplogCtx.skippedOps > 0 {
+		log.Logvf(log.Always, "skipped %v oplog entries excluded by the oplog filters", oplogCtx.skippedOps)
+	}
 	if err := decodedBsonSource.Err(); err != nil {
 		return fmt.Errorf("error reading oplog bson input: %v", err)
 	}
+	if oplogCtx.replayedOps > 0 {
+		if restore.lastOplogTs.IsZero() {
+			return fmt.Errorf("the oplog ends at or before the previous archive's oplog at %v; "+
+				"archives must be given oldest first", restore.oplogAfter)
+		}
+		log.Logvf(log.Always, "skipped %v oplog entries already replayed from the previous archive", oplogCtx.replayedOps)
+	}
 	return nil
 
 }
@@ -202,6 +306,10 @@ func (restore *MongoRestore) HandleOp(oplogCtx *oplogContext, op db.Oplog) error
 }
 
 func (restore *MongoRestore) HandleNonTxnOp(oplogCtx *oplogContext, op db.Oplog) error {
+	if restore.skipOplogEntry(op) {
+		oplogCtx.skippedOps++
+		return nil
+	}
 	oplogCtx.totalOps++
 
 	op, err := restore.filterUUIDs(op)
@@ -411,6 +519,24 @@ func (restore *MongoRestore) ApplyOps(session *mongo.Client, entries []interface
 	return nil
 }
 
+// replayedBefore reports whether an oplog entry was already replayed from the
+// previous of several archives.
+func (restore *MongoRestore) replayedBefore(ts primitive.Timestamp) bool {
+	return !restore.oplogAfter.IsZero() && !util.TimestampGreaterThan(ts, restore.oplogAfter)
+}
+
+// checkOplogContinues returns an error if the oplog of one of several
+// archives starts with an entry after the one the previous archive's oplog
+// ended with, since the changes made in between would be missing.
+func (restore *MongoRestore) checkOplogContinues(first primitive.Timestamp) error {
+	if restore.oplogAfter.IsZero() || restore.replayedBefore(first) {
+		return nil
+	}
+	return fmt.Errorf("the oplog starts at %v, after the previous archive's oplog ended at %v; "+
+		"the changes made in between are missing, so the archive must be dumped with an oplog "+
+		"that starts at or before the end of the previous one", first, restore.oplogAfter)
+}
+
 // TimestampBeforeLimit returns true if the given timestamp is allowed to be
 // applied to mongorestore's target database.
 func (restore *MongoRestore) TimestampBeforeLimit(ts primitive.Timestamp) bool {
@@ -467,8 +593,10 @@ func (restore *MongoRestore) needsCreateIndexWorkaround() bool {
 // filterUUIDs removes 'ui' entries from ops, including nested applyOps ops.
 // It also modifies ops that rely on 'ui'.
 func (restore *MongoRestore) filterUUIDs(op db.Oplog) (db.Oplog, error) {
-	// Remove UUIDs from oplog entries
-	if !restore.OutputOptions.PreserveUUID {
+	// Remove UUIDs from oplog entries, unless they follow a restored collection
+	if ui, keep := restore.oplogUUID(op.UI); keep {
+		op.UI = ui
+	} else {
 		op.UI = nil
 
 		// The createIndexes oplog command requires 'ui' for some server versions, so
@@ -602,6 +602,59 @@ func TestOplogRestoreTools2002(t *testing.T) {
 	})
 }
 
+func TestOplogFilters(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	insert := db.Oplog{Operation: "i", Namespace: "db.keep"}
+	update := db.Oplog{Operation: "u", Namespace: "db.noisy"}
+	drop := db.Oplog{Operation: "c", Namespace: "db.$cmd",
+		Object: bson.D{bson.E{Key: "drop", Value: "noisy"}}}
+	applyOps := db.Oplog{Operation: "c", Namespace: "admin.$cmd",
+		Object: bson.D{bson.E{Key: "applyOps", Value: bson.A{}}}}
+
+	newRestore := func(opts InputOptions) *MongoRestore {
+		opts.OplogReplay = true
+		mr := &MongoRestore{InputOptions: &opts}
+		So(mr.parseOplogFilters(), ShouldBeNil)
+		return mr
+	}
+
+	Convey("Without oplog filters nothing is skipped", t, func() {
+		mr := newRestore(InputOptions{})
+		So(mr.skipOplogEntry(insert), ShouldBeFalse)
+		So(mr.skipOplogEntry(drop), ShouldBeFalse)
+	})
+
+	Convey("--oplogNsExclude skips entries and commands on matching collections", t, func() {
+		mr := newRestore(InputOptions{OplogNsExclude: []string{"db.noisy"}})
+		So(mr.skipOplogEntry(insert), ShouldBeFalse)
+		So(mr.skipOplogEntry(update), ShouldBeTrue)
+		So(mr.skipOplogEntry(drop), ShouldBeTrue)
+	})
+
+	Convey("--oplogNsInclude replays only matching collections", t, func() {
+		mr := newRestore(InputOptions{OplogNsInclude: []string{"db.keep"}})
+		So(mr.skipOplogEntry(insert), ShouldBeFalse)
+		So(mr.skipOplogEntry(update), ShouldBeTrue)
+		So(mr.skipOplogEntry(applyOps), ShouldBeFalse)
+	})
+
+	Convey("--oplogOpFilter replays only the given operation types", t, func() {
+		mr := newRestore(InputOptions{OplogOpFilter: "i,d"})
+		So(mr.skipOplogEntry(insert), ShouldBeFalse)
+		So(mr.skipOplogEntry(update), ShouldBeTrue)
+		So(mr.skipOplogEntry(drop), ShouldBeTrue)
+		So(mr.skipOplogEntry(applyOps), ShouldBeFalse)
+	})
+
+	Convey("Invalid oplog filters are rejected", t, func() {
+		mr := &MongoRestore{InputOptions: &InputOptions{OplogReplay: true, OplogOpFilter: "i,x"}}
+		So(mr.parseOplogFilters(), ShouldNotBeNil)
+		mr = &MongoRestore{InputOptions: &InputOptions{OplogNsExclude: []string{"db.c"}}}
+		So(mr.parseOplogFilters(), ShouldNotBeNil)
+	})
+}
+
 type testTable struct {
 	ns     string
 	output bool
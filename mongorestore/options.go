@@ -13,6 +13,7 @@ import (
 	"github.com/huimingz/mongo-tools/common/util"
 
 	"fmt"
+	"time"
 )
 
 // Usage describes basic usage of mongorestore
@@ -42,6 +43,13 @@ const (
 	OplogReplayOption            = "--oplogReplay"
 	OplogLimitOption             = "--oplogLimit"
 	OplogFileOption              = "--oplogFile"
+	OplogNsIncludeOption         = "--oplogNsInclude"
+	OplogNsExcludeOption         = "--oplogNsExclude"
+	OplogOpFilterOption          = "--oplogOpFilter"
+	TimeseriesTimeFieldOption    = "--timeseriesTimeField"
+	TimeseriesMetaFieldOption    = "--timeseriesMetaField"
+	TimeseriesGranularityOption  = "--timeseriesGranularity"
+	DocFilterOption              = "--docFilter"
 	ArchiveOption                = "--archive" // Value is optional, so must use '=' if specifying one
 	RestoreDBUsersAndRolesOption = "--restoreDbUsersAndRoles"
 	DirectoryOption              = "--dir"
@@ -50,14 +58,25 @@ const (
 
 // InputOptions defines the set of options to use in configuring the restore process.
 type InputOptions struct {
-	Objcheck               bool   `long:"objcheck" description:"validate all objects before inserting"`
-	OplogReplay            bool   `long:"oplogReplay" description:"replay oplog for point-in-time restore"`
-	OplogLimit             string `long:"oplogLimit" value-name:"<seconds>[:ordinal]" description:"only include oplog entries before the provided Timestamp"`
-	OplogFile              string `long:"oplogFile" value-name:"<filename>" description:"oplog file to use for replay of oplog"`
-	Archive                string `long:"archive" value-name:"<filename>" optional:"true" optional-value:"-" description:"restore dump from the specified archive file.  If flag is specified without a value, archive is read from stdin"`
-	RestoreDBUsersAndRoles bool   `long:"restoreDbUsersAndRoles" description:"restore user and role definitions for the given database"`
-	Directory              string `long:"dir" value-name:"<directory-name>" description:"input directory, use '-' for stdin"`
-	Gzip                   bool   `long:"gzip" description:"decompress gzipped input"`
+	Objcheck               bool     `long:"objcheck" description:"validate all objects before inserting"`
+	OplogReplay            bool     `long:"oplogReplay" description:"replay oplog for point-in-time restore"`
+	OplogLimit             string   `long:"oplogLimit" value-name:"<seconds>[:ordinal]" description:"only include oplog entries before the provided Timestamp"`
+	OplogFile              string   `long:"oplogFile" value-name:"<filename>" description:"oplog file to use for replay of oplog"`
+	OplogNsInclude         []string `long:"oplogNsInclude" value-name:"<namespace-pattern>" description:"only replay oplog entries for matching namespaces; commands that are not on a collection have the namespace <database>.$cmd"`
+	OplogNsExclude         []string `long:"oplogNsExclude" value-name:"<namespace-pattern>" description:"don't replay oplog entries for matching namespaces"`
+	OplogOpFilter          string   `long:"oplogOpFilter" value-name:"<op>[,<op>]*" description:"only replay oplog entries of the given operation types: i (insert), u (update), d (delete) and c (command), e.g. --oplogOpFilter i,u,d"`
+	Archives               []string `long:"archive" value-name:"<filename>" optional:"true" optional-value:"-" description:"restore dump from the specified archive file, or stream it from an http(s):// or s3://<bucket>/<key> URL.  If flag is specified without a value, archive is read from stdin. May be repeated to restore a full archive followed by incremental archives, oldest first"`
+	RestoreDBUsersAndRoles bool     `long:"restoreDbUsersAndRoles" description:"restore user and role definitions for the given database"`
+	Directory              string   `long:"dir" value-name:"<directory-name>" description:"input directory, or an s3://<bucket>/<prefix> URL to stream the dump from S3; use '-' for stdin"`
+	Gzip                   bool     `long:"gzip" description:"decompress gzipped input; archives compressed with zstd or lz4 are detected, and dump files with a .zst or .lz4 extension are decompressed, without it"`
+	TimeseriesTimeField    string   `long:"timeseriesTimeField" value-name:"<field>" description:"time field of time series collections whose buckets were dumped without time series options; detected from the buckets if not given"`
+	TimeseriesMetaField    string   `long:"timeseriesMetaField" value-name:"<field>" description:"meta field of time series collections whose buckets were dumped without time series options"`
+	TimeseriesGranularity  string   `long:"timeseriesGranularity" value-name:"seconds|minutes|hours" choice:"seconds" choice:"minutes" choice:"hours" description:"granularity of time series collections whose buckets were dumped without time series options"`
+	Inspect                bool     `long:"inspect" description:"list the namespaces in each --archive with their types, document counts, sizes and indexes, and the dump details, without connecting to a server or restoring anything"`
+	DocFilter              string   `long:"docFilter" value-name:"<json>" description:"only restore the documents matching this query, as a v2 Extended JSON string, e.g. '{\"customerId\":1234}'; supports field equality and $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $and, $or and $nor; time series collections can't be filtered"`
+
+	// Archive is the archive being restored, one of Archives.
+	Archive string `no-flag:"true"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -79,34 +98,80 @@ const (
 	NumInsertionWorkersOption      = "--numInsertionWorkersPerCollection"
 	StopOnErrorOption              = "--stopOnError"
 	BypassDocumentValidationOption = "--bypassDocumentValidation"
+	OpCommentOption                = "--opComment"
 	PreserveUUIDOption             = "--preserveUUID"
+	RegenerateUUIDOption           = "--regenerateUUID"
+	UUIDOverrideOption             = "--uuidOverride"
 	TempUsersCollOption            = "--tempUsersColl"
 	TempRolesCollOption            = "--tempRolesColl"
 	BulkBufferSizeOption           = "--batchSize"
 	FixDottedHashedIndexesOption   = "--fixDottedHashIndex"
+	IndexFilterOption              = "--indexFilter"
+	HideIndexesOption              = "--hideIndexes"
+	IndexBackgroundOption          = "--indexBackground"
+	IndexUniqueOption              = "--indexUnique"
+	IndexesLastOption              = "--indexesLast"
+	IndexBuildConcurrencyOption    = "--indexBuildConcurrency"
+	OnDuplicateOption              = "--onDuplicate"
+	RateLimitOption                = "--rateLimit"
+	MaxOpsPerSecOption             = "--maxOpsPerSec"
+	MaxReplicationLagOption        = "--maxReplicationLag"
+	ConvertToClusteredOption       = "--convertToClustered"
+	CappedOverrideOption           = "--cappedOverride"
+	MaxRestoreRetriesOption        = "--maxRestoreRetries"
+	ResetPasswordsFileOption       = "--resetPasswordsFile"
+	CredentialMechanismsOption     = "--credentialMechanisms"
+	StagingOption                  = "--staging"
+	ApplyDifferentialOption        = "--applyDifferential"
 )
 
 // OutputOptions defines the set of options for restoring dump data.
 type OutputOptions struct {
 	Drop   bool `long:"drop" description:"drop each collection before import"`
-	DryRun bool `long:"dryRun" description:"view summary without importing anything. recommended with verbosity"`
+	DryRun bool `long:"dryRun" description:"print the namespaces, index builds and user and role changes the restore would make, without writing anything"`
+	Force  bool `long:"force" description:"restore even if the data is estimated not to fit in the free disk space of the target; a warning is logged instead"`
 
 	// By default mongorestore uses a write concern of 'majority'.
-	WriteConcern             string `long:"writeConcern" value-name:"<write-concern>" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'"`
-	NoIndexRestore           bool   `long:"noIndexRestore" description:"don't restore indexes"`
-	ConvertLegacyIndexes     bool   `long:"convertLegacyIndexes" description:"Removes invalid index options and rewrites legacy option values (e.g. true becomes 1)."`
-	NoOptionsRestore         bool   `long:"noOptionsRestore" description:"don't restore collection options"`
-	KeepIndexVersion         bool   `long:"keepIndexVersion" description:"don't update index version"`
-	MaintainInsertionOrder   bool   `long:"maintainInsertionOrder" description:"restore the documents in the order of their appearance in the input source. By default the insertions will be performed in an arbitrary order. Setting this flag also enables the behavior of --stopOnError and restricts NumInsertionWorkersPerCollection to 1."`
-	NumParallelCollections   int    `long:"numParallelCollections" short:"j" description:"number of collections to restore in parallel" default:"4" default-mask:"-"`
-	NumInsertionWorkers      int    `long:"numInsertionWorkersPerCollection" description:"number of insert operations to run concurrently per collection" default:"1" default-mask:"-"`
-	StopOnError              bool   `long:"stopOnError" description:"halt after encountering any error during insertion. By default, mongorestore will attempt to continue through document validation and DuplicateKey errors, but with this option enabled, the tool will stop instead. A small number of documents may be inserted after encountering an error even with this option enabled; use --maintainInsertionOrder to halt immediately after an error"`
-	BypassDocumentValidation bool   `long:"bypassDocumentValidation" description:"bypass document validation"`
-	PreserveUUID             bool   `long:"preserveUUID" description:"preserve original collection UUIDs (off by default, requires drop)"`
-	TempUsersColl            string `long:"tempUsersColl" default:"tempusers" hidden:"true"`
-	TempRolesColl            string `long:"tempRolesColl" default:"temproles" hidden:"true"`
-	BulkBufferSize           int    `long:"batchSize" default:"1000" hidden:"true"`
-	FixDottedHashedIndexes   bool   `long:"fixDottedHashIndex" description:"when enabled, all the hashed indexes on dotted fields will be created as single field ascending indexes on the destination"`
+	WriteConcern             string        `long:"writeConcern" value-name:"<write-concern>" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'"`
+	NoIndexRestore           bool          `long:"noIndexRestore" description:"don't restore indexes"`
+	ConvertLegacyIndexes     bool          `long:"convertLegacyIndexes" description:"Removes invalid index options and rewrites legacy option values (e.g. true becomes 1)."`
+	NoOptionsRestore         bool          `long:"noOptionsRestore" description:"don't restore collection options"`
+	KeepIndexVersion         bool          `long:"keepIndexVersion" description:"don't update index version"`
+	MaintainInsertionOrder   bool          `long:"maintainInsertionOrder" description:"restore the documents in the order of their appearance in the input source. By default the insertions will be performed in an arbitrary order. Setting this flag also enables the behavior of --stopOnError and restricts NumInsertionWorkersPerCollection to 1."`
+	NumParallelCollections   int           `long:"numParallelCollections" short:"j" description:"number of collections to restore in parallel" default:"4" default-mask:"-"`
+	NumInsertionWorkers      int           `long:"numInsertionWorkersPerCollection" description:"number of insert operations to run concurrently per collection" default:"1" default-mask:"-"`
+	MaxRestoreRetries        int           `long:"maxRestoreRetries" value-name:"<count>" default:"3" default-mask:"-" description:"number of times writes that fail with a transient error, such as a network error or a primary step-down, are split into smaller batches and retried before they count as failed; 0 disables retrying (default: 3)"`
+	StopOnError              bool          `long:"stopOnError" description:"halt after encountering any error during insertion. By default, mongorestore will attempt to continue through document validation and DuplicateKey errors, but with this option enabled, the tool will stop instead. A small number of documents may be inserted after encountering an error even with this option enabled; use --maintainInsertionOrder to halt immediately after an error"`
+	OnDuplicate              string        `long:"onDuplicate" value-name:"skip|replace|merge|fail" choice:"skip" choice:"replace" choice:"merge" choice:"fail" description:"what to do with documents whose _id already exists in the target: skip them quietly, replace the existing documents, merge their fields into the existing documents, or fail the restore. By default the duplicate key errors are logged and the restore continues. replace and merge are refused for time series collections"`
+	BypassDocumentValidation bool          `long:"bypassDocumentValidation" description:"bypass document validation"`
+	OpComment                string        `long:"opComment" value-name:"<string>" description:"attach this comment to the commands that write the restored documents, so that restore traffic can be identified in the profiler, currentOp and the server logs (requires MongoDB 4.4+)"`
+	PreserveUUID             bool          `long:"preserveUUID" description:"preserve original collection UUIDs (off by default, requires drop)"`
+	RegenerateUUID           bool          `long:"regenerateUUID" description:"create each collection with a new UUID, and rewrite the UUIDs of the oplog entries replayed for it with --oplogReplay to match (requires drop)"`
+	UUIDOverride             []string      `long:"uuidOverride" value-name:"<namespace-pattern>=preserve|regenerate|discard[,...]" description:"for the matching collections, preserve or regenerate the UUID, or discard it so the server assigns one, in place of --preserveUUID or --regenerateUUID; may be repeated"`
+	ResetPasswordsFile       string        `long:"resetPasswordsFile" value-name:"<filename>" description:"JSON file mapping \"<database>.<user>\" to a new password for restored users; the server generates new credentials from it instead of keeping the ones in the dump"`
+	CredentialMechanisms     string        `long:"credentialMechanisms" value-name:"<mechanism>[,<mechanism>]" description:"with --resetPasswordsFile, the SCRAM mechanisms (SCRAM-SHA-1, SCRAM-SHA-256) to generate credentials for; defaults to those the server supports"`
+	TempUsersColl            string        `long:"tempUsersColl" default:"tempusers" hidden:"true"`
+	TempRolesColl            string        `long:"tempRolesColl" default:"temproles" hidden:"true"`
+	BulkBufferSize           int           `long:"batchSize" default:"1000" hidden:"true"`
+	Resume                   bool          `long:"resume" description:"continue a failed restore, skipping namespaces that were completed and documents that were already inserted, as recorded in --resumeStateFile"`
+	ResumeStateFile          string        `long:"resumeStateFile" value-name:"<filename>" default:"mongorestore.resume.json" default-mask:"-" description:"file to record the progress of a --resume restore in; it is removed once the restore completes (default: mongorestore.resume.json)"`
+	RestoreShardingMetadata  bool          `long:"restoreShardingMetadata" description:"when restoring to a mongos, shard each collection the restore creates the way it was sharded in the dump, recreating its zone ranges, pre-splitting its chunks and moving each to the shard of the same name it was on, as recorded by mongodump --includeShardingMetadata; shards in the dump's zones are added to them when the target has a shard of the same name"`
+	Verify                   bool          `long:"verify" description:"after restoring, check that every collection holds the documents read from the input, failing the restore if any diverge"`
+	VerifyManifest           string        `long:"verifyManifest" value-name:"<filename>" description:"with --verify, also compare the hashes of each collection's _id ranges with a manifest written by mongodump --hashManifest"`
+	ApplyDifferential        string        `long:"applyDifferential" value-name:"<filename>" description:"apply a dump made with mongodump --baseManifest on top of a restore of its base dump: the documents in each _id range that changed, as recorded in the manifest the dump wrote with --hashManifest, are deleted and replaced with the dumped ones, and collections dumped whole, such as views, are replaced (cannot be used with --drop)"`
+	FixDottedHashedIndexes   bool          `long:"fixDottedHashIndex" description:"when enabled, all the hashed indexes on dotted fields will be created as single field ascending indexes on the destination"`
+	IndexFilter              []string      `long:"indexFilter" value-name:"<pattern>" description:"don't restore indexes matching [<database>.<collection>:]<index name>, where * matches any characters; may be repeated"`
+	HideIndexes              bool          `long:"hideIndexes" description:"create the restored indexes as hidden indexes (requires MongoDB 4.4+)"`
+	IndexBackground          string        `long:"indexBackground" value-name:"true|false" choice:"true" choice:"false" description:"override the background option of every restored index"`
+	IndexUnique              string        `long:"indexUnique" value-name:"true|false" choice:"true" choice:"false" description:"override the unique option of every restored index other than _id; text, geospatial, hashed and wildcard indexes are never made unique"`
+	IndexesLast              bool          `long:"indexesLast" description:"with --indexBuildConcurrency, still build all indexes only after every collection has been restored"`
+	IndexBuildConcurrency    int           `long:"indexBuildConcurrency" value-name:"<count>" description:"build the indexes of up to <count> collections at a time, starting as soon as each collection is restored unless --indexesLast or --oplogReplay is set (default: --numParallelCollections, after all collections are restored)"`
+	RateLimit                float64       `long:"rateLimit" value-name:"<MiB/s>" description:"maximum rate, in mebibytes (MiB) per second, at which documents are written to the server"`
+	MaxOpsPerSec             int           `long:"maxOpsPerSec" value-name:"<count>" description:"maximum number of documents and oplog entries written to the server per second"`
+	MaxReplicationLag        time.Duration `long:"maxReplicationLag" value-name:"<duration>" description:"pause writing while the replication lag of the target's secondaries exceeds this duration (e.g. 30s). Writing also pauses while flow control is throttling the target, with or without this option"`
+	ConvertToClustered       []string      `long:"convertToClustered" value-name:"<namespace-pattern>[,<namespace-pattern>]*" description:"create the matching collections as clustered collections ordered by _id (requires MongoDB 5.3+); may be repeated"`
+	CappedOverride           []string      `long:"cappedOverride" value-name:"<namespace-pattern>=<size>[,...]" description:"create the matching collections as capped collections of <size> bytes; may be repeated"`
+	Staging                  bool          `long:"staging" description:"restore each collection into <collection>.__restore_tmp, build its indexes and check its document count, then rename it over the collection, so that applications never see it partially restored; views, time series, system and capped collections are restored in place (requires --drop, cannot be used with --preserveUUID)"`
 }
 
 // Name returns a human-readable group name for output options.
@@ -168,6 +233,10 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 
 	log.SetVerbosity(opts.Verbosity)
 
+	if len(inputOpts.Archives) > 0 {
+		inputOpts.Archive = inputOpts.Archives[0]
+	}
+
 	// verify uri options and log them
 	opts.URI.LogUnsupportedOptions()
 
@@ -257,3 +257,13 @@ func TestPositionalArgumentParsing(t *testing.T) {
 		}
 	})
 }
+
+func TestArchiveOptionParsing(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+	Convey("Every --archive is collected, and the first is restored first", t, func() {
+		opts, err := ParseOptions([]string{"--archive=full.archive", "--archive=incr1.archive", "--archive=incr2.archive"}, "", "")
+		So(err, ShouldBeNil)
+		So(opts.InputOptions.Archives, ShouldResemble, []string{"full.archive", "incr1.archive", "incr2.archive"})
+		So(opts.InputOptions.Archive, ShouldEqual, "full.archive")
+	})
+}
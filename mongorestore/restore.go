@@ -31,14 +31,34 @@ const insertBufferFactor = 16
 type Result struct {
 	Successes int64
 	Failures  int64
-	Err       error
+	// Skipped counts the documents not written because they already
+	// existed, with --onDuplicate=skip.
+	Skipped int64
+	// Unconfirmed counts the documents whose insert was retried after an
+	// attempt with an unknown outcome and then found a document with the
+	// same _id, which the first attempt may or may not have inserted.
+	Unconfirmed int64
+	Err         error
+
+	// read is the number of documents read from the input.
+	read int64
 }
 
 // log pretty-prints the result, associated with restoring the given namespace
 func (result *Result) log(ns string) {
-	log.Logvf(log.Always, "finished restoring %v (%v %v, %v %v)",
+	fields := log.Fields{"ns": ns, "documents": result.Successes, "failures": result.Failures}
+	var extra string
+	if result.Skipped > 0 {
+		fields["skipped"] = result.Skipped
+		extra += fmt.Sprintf(", %v skipped", result.Skipped)
+	}
+	if result.Unconfirmed > 0 {
+		fields["unconfirmed"] = result.Unconfirmed
+		extra += fmt.Sprintf(", %v unconfirmed", result.Unconfirmed)
+	}
+	log.LogvfWithFields(log.Always, fields, "finished restoring %v (%v %v, %v %v%v)",
 		ns, result.Successes, util.Pluralize(int(result.Successes), "document", "documents"),
-		result.Failures, util.Pluralize(int(result.Failures), "failure", "failures"))
+		result.Failures, util.Pluralize(int(result.Failures), "failure", "failures"), extra)
 }
 
 // combineWith sums the successes and failures from both results and the overwrites the existing Err with the Err from
@@ -46,6 +66,9 @@ func (result *Result) log(ns string) {
 func (result *Result) combineWith(other Result) {
 	result.Successes += other.Successes
 	result.Failures += other.Failures
+	result.Skipped += other.Skipped
+	result.Unconfirmed += other.Unconfirmed
+	result.read += other.read
 	result.Err = other.Err
 }
 
@@ -68,19 +91,20 @@ func NewResultFromBulkResult(result *mongo.BulkWriteResult, err error) Result {
 		nFailure = int64(len(bwe.WriteErrors))
 	}
 
-	return Result{nSuccess, nFailure, err}
+	return Result{Successes: nSuccess, Failures: nFailure, Err: err}
 }
 
 func (restore *MongoRestore) RestoreIndexes() error {
-	log.Logvf(log.DebugLow, "building indexes up to %v collections in parallel", restore.OutputOptions.NumParallelCollections)
+	workers := restore.indexBuildWorkers()
+	log.Logvf(log.DebugLow, "building indexes up to %v collections in parallel", workers)
 
 	namespaceQueue := restore.indexCatalog.Queue()
 
-	if restore.OutputOptions.NumParallelCollections > 0 {
+	if workers > 0 {
 		errChan := make(chan error)
 
 		// start a goroutine for each job thread
-		for i := 0; i < restore.OutputOptions.NumParallelCollections; i++ {
+		for i := 0; i < workers; i++ {
 			go func(id int) {
 				log.Logvf(log.DebugHigh, "starting index build routine with id=%v", id)
 				for {
@@ -90,6 +114,9 @@ func (restore *MongoRestore) RestoreIndexes() error {
 						errChan <- nil // done
 						return
 					}
+					if restore.indexesBuilt(namespace.String()) {
+						continue
+					}
 					err := restore.RestoreIndexesForNamespace(namespace)
 					if err != nil {
 						errChan <- err
@@ -100,7 +127,7 @@ func (restore *MongoRestore) RestoreIndexes() error {
 		}
 
 		// wait until all goroutines are done or one of them errors out
-		for i := 0; i < restore.OutputOptions.NumParallelCollections; i++ {
+		for i := 0; i < workers; i++ {
 			err := <-errChan
 			if err != nil {
 				// Return first error we encounter
@@ -116,6 +143,9 @@ func (restore *MongoRestore) RestoreIndexes() error {
 		if namespace == nil {
 			break
 		}
+		if restore.indexesBuilt(namespace.String()) {
+			continue
+		}
 		err := restore.RestoreIndexesForNamespace(namespace)
 		if err != nil {
 			return err
@@ -125,6 +155,13 @@ func (restore *MongoRestore) RestoreIndexes() error {
 }
 
 func (restore *MongoRestore) RestoreIndexesForNamespace(namespace *options.Namespace) error {
+	return restore.restoreIndexesInto(namespace, namespace.Collection)
+}
+
+// restoreIndexesInto builds the indexes of a namespace on a collection of the
+// same database, which is the namespace's own collection unless it was
+// restored with --staging.
+func (restore *MongoRestore) restoreIndexesInto(namespace *options.Namespace, collection string) error {
 	var err error
 	namespaceString := fmt.Sprintf("%s.%s", namespace.DB, namespace.Collection)
 	indexes := restore.indexCatalog.GetIndexes(namespace.DB, namespace.Collection)
@@ -139,6 +176,10 @@ func (restore *MongoRestore) RestoreIndexesForNamespace(namespace *options.Names
 		}
 	}
 
+	if !restore.OutputOptions.NoIndexRestore {
+		indexes = restore.filterIndexes(namespaceString, indexes)
+	}
+
 	if len(indexes) > 0 && !restore.OutputOptions.NoIndexRestore {
 		log.Logvf(log.Always, "restoring indexes for collection %v from metadata", namespaceString)
 		if restore.OutputOptions.ConvertLegacyIndexes {
@@ -150,7 +191,7 @@ func (restore *MongoRestore) RestoreIndexesForNamespace(namespace *options.Names
 		for _, index := range indexes {
 			log.Logvf(log.Always, "index: %#v", index)
 		}
-		err = restore.CreateIndexes(namespace.DB, namespace.Collection, indexes)
+		err = restore.CreateIndexes(namespace.DB, collection, indexes)
 		if err != nil {
 			return fmt.Errorf("%s: error creating indexes for %s: %v", namespaceString, namespaceString, err)
 		}
@@ -193,6 +234,7 @@ func (restore *MongoRestore) PopulateMetadataForIntents() error {
 			}
 			if metadata != nil {
 				intent.Options = metadata.Options.Map()
+				applyBucketsOptions(intent, metadata.BucketsOptions.Map())
 
 				for _, indexDefinition := range metadata.Indexes {
 					restore.indexCatalog.AddIndex(intent.DB, intent.C, indexDefinition)
@@ -204,14 +246,26 @@ func (restore *MongoRestore) PopulateMetadataForIntents() error {
 
 				restore.indexCatalog.SetCollation(intent.DB, intent.C, intent.HasSimpleCollation())
 
-				if restore.OutputOptions.PreserveUUID {
-					if metadata.UUID == "" {
-						log.Logvf(log.Always, "--preserveUUID used but no UUID found in %v, generating new UUID for %v", intent.MetadataLocation, intent.Namespace())
-					}
-					intent.UUID = metadata.UUID
+				if err := restore.setIntentUUID(intent, metadata.UUID); err != nil {
+					return err
 				}
 			}
 		}
+		if err := restore.prepareDifferential(intent, metadata); err != nil {
+			return err
+		}
+		if restore.docFilter != nil && intent.IsTimeseries() {
+			// the dump holds buckets of measurements, not the documents the
+			// filter is written for
+			return fmt.Errorf("cannot use %v with the time series collection %v; exclude it with --nsExclude",
+				DocFilterOption, intent.Namespace())
+		}
+		if err := restore.ensureTimeseriesOptions(intent); err != nil {
+			return err
+		}
+		if err := restore.applyStorageOverrides(intent); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -290,29 +344,52 @@ func (restore *MongoRestore) RestoreIntents() Result {
 
 // RestoreIntent attempts to restore a given intent into MongoDB.
 func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) Result {
-	collectionExists, err := restore.CollectionExists(intent.DB, intent.C)
+	resumed := restore.resumeProgress(intent)
+	if resumed.Complete {
+		log.Logvf(log.Always, "%v was already restored, skipping", intent.Namespace())
+		restore.verifier.expect(intent, resumed.Docs, restore.OutputOptions.Drop)
+		if !intent.IsView() {
+			restore.indexBuilder.enqueue(intent.DB, intent.C)
+		}
+		return Result{Err: drainIntent(intent)}
+	}
+
+	// with --staging the documents go to a staging collection that replaces
+	// the intent's collection once it is complete
+	target := intent
+	if restore.stages(intent) {
+		target = stagingIntent(intent)
+	}
+
+	collectionExists, err := restore.CollectionExists(target.DB, target.C)
 	if err != nil {
 		return Result{Err: fmt.Errorf("error reading database: %v", err)}
 	}
+	if resumed.started() && collectionExists {
+		log.Logvf(log.Info, "%v was partially restored; not dropping or creating it", intent.Namespace())
+	}
 
-	if !restore.OutputOptions.Drop && collectionExists {
+	// with --applyDifferential, collections that were dumped whole replace
+	// those of the base dump
+	drop := restore.OutputOptions.Drop || restore.replacedWhole[intent.Namespace()]
+	if !drop && collectionExists {
 		log.Logvf(log.Always, "restoring to existing collection %v without dropping", intent.Namespace())
 	}
 
-	if restore.OutputOptions.Drop {
+	if drop && !(resumed.started() && collectionExists) {
 		if collectionExists {
 			if strings.HasPrefix(intent.C, "system.") {
 				log.Logvf(log.Always, "cannot drop system collection %v, skipping", intent.Namespace())
 			} else {
-				log.Logvf(log.Always, "dropping collection %v before restoring", intent.Namespace())
-				err = restore.DropCollection(intent)
+				log.Logvf(log.Always, "dropping collection %v before restoring", target.Namespace())
+				err = restore.DropCollection(target)
 				if err != nil {
 					return Result{Err: err} // no context needed
 				}
 				collectionExists = false
 			}
 		} else {
-			log.Logvf(log.DebugLow, "collection %v doesn't exist, skipping drop command", intent.Namespace())
+			log.Logvf(log.DebugLow, "collection %v doesn't exist, skipping drop command", target.Namespace())
 		}
 	}
 
@@ -327,14 +404,15 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) Result {
 
 	// The only way to specify options on the idIndex is at collection creation time.
 	IDIndex := restore.indexCatalog.GetIndex(intent.DB, intent.C, "_id_")
-	if IDIndex != nil {
+	// Clustered collections have no separate _id index.
+	if _, clustered := intent.Options["clusteredIndex"]; IDIndex != nil && !clustered {
 		// Remove the index version (to use the default) unless otherwise specified.
 		// If preserving UUID, we have to create a collection via
 		// applyops, which requires the "v" key.
-		if !restore.OutputOptions.KeepIndexVersion && !restore.OutputOptions.PreserveUUID {
+		if !restore.OutputOptions.KeepIndexVersion && uuid == "" {
 			delete(IDIndex.Options, "v")
 		}
-		IDIndex.Options["ns"] = intent.Namespace()
+		IDIndex.Options["ns"] = target.Namespace()
 
 		// If the collection has an idIndex, then we are about to create it, so
 		// ignore the value of autoIndexId.
@@ -354,15 +432,33 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) Result {
 	}
 
 	if !collectionExists {
-		log.Logvf(log.Info, "creating collection %v %s", intent.Namespace(), logMessageSuffix)
+		log.Logvf(log.Info, "creating collection %v %s", target.Namespace(), logMessageSuffix)
 		log.Logvf(log.DebugHigh, "using collection options: %#v", options)
-		err = restore.CreateCollection(intent, options, uuid)
+		err = restore.CreateCollection(target, options, uuid)
 		if err != nil {
-			return Result{Err: fmt.Errorf("error creating collection %v: %v", intent.Namespace(), err)}
+			return Result{Err: fmt.Errorf("error creating collection %v: %v", target.Namespace(), err)}
+		}
+		restore.addToKnownCollections(target)
+		if err = restore.shardRestoredCollection(intent); err != nil {
+			return Result{Err: fmt.Errorf("error sharding collection %v: %v", intent.Namespace(), err)}
 		}
-		restore.addToKnownCollections(intent)
 	} else {
 		log.Logvf(log.Info, "collection %v already exists - skipping collection create", intent.Namespace())
+		if restore.hasStorageOverride(intent) {
+			log.Logvf(log.Always, "warning: %v already exists, so its storage options are not changed; "+
+				"use --drop to recreate it", intent.Namespace())
+		}
+	}
+
+	if _, ok := restore.differentialRanges[intent.Namespace()]; ok {
+		if err = restore.deleteChangedRanges(intent); err != nil {
+			return Result{Err: err}
+		}
+	}
+
+	var checkpoints *restoreCheckpointer
+	if restore.resumeState != nil {
+		checkpoints = restore.prepareResume(intent, resumed)
 	}
 
 	var result Result
@@ -373,18 +469,44 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) Result {
 		}
 		defer intent.BSONFile.Close()
 
-		log.Logvf(log.Always, "restoring %v from %v", intent.DataNamespace(), intent.Location)
+		log.Logvf(log.Always, "restoring %v from %v", target.DataNamespace(), intent.Location)
 
 		bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(intent.BSONFile))
 		defer bsonSource.Close()
 
-		result = restore.RestoreCollectionToDB(intent.DB, intent.DataCollection(), bsonSource, intent.BSONFile, intent.Size, intent.Type)
+		result = restore.RestoreCollectionToDB(target.DB, target.DataCollection(), bsonSource, intent.BSONFile, intent.Size, intent.Type, checkpoints, restore.docFilter)
+		// record what was inserted even if the restore failed
+		if err = checkpoints.checkpoint(); err != nil && result.Err == nil {
+			result.Err = err
+		}
 		if result.Err != nil {
 			result.Err = fmt.Errorf("error restoring from %v: %v", intent.Location, result.Err)
 			return result
 		}
 	}
 
+	if target != intent {
+		if err = restore.promoteStaging(intent, target, result.Successes, result.Unconfirmed); err != nil {
+			return result.withErr(err)
+		}
+	}
+
+	// a collection that existed before and was not dropped may hold other documents
+	exact := !collectionExists
+	if resumed.started() {
+		exact = restore.OutputOptions.Drop
+	}
+	restore.verifier.expect(intent, resumed.Docs+result.read, exact)
+	if !intent.IsView() && target == intent {
+		restore.indexBuilder.enqueue(intent.DB, intent.C)
+	}
+	if restore.resumeState != nil {
+		done := namespaceProgress{Complete: true, Docs: resumed.Docs + result.read}
+		if err = restore.resumeState.record(intent.Namespace(), done); err != nil {
+			return result.withErr(err)
+		}
+	}
+
 	return result
 }
 
@@ -442,8 +564,12 @@ func fixDottedHashedIndex(index *idx.IndexDocument) {
 
 // RestoreCollectionToDB pipes the given BSON data into the database.
 // Returns the number of documents restored and any errors that occurred.
+// If checkpoints is not nil, it skips the documents already restored and
+// is told about every batch inserted. If match is not nil, only the
+// documents it matches are restored.
 func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
-	bsonSource *db.DecodedBSONSource, file PosReader, fileSize int64, collectionType string) Result {
+	bsonSource *db.DecodedBSONSource, file PosReader, fileSize int64, collectionType string,
+	checkpoints *restoreCheckpointer, match bsonutil.DocPredicate) Result {
 
 	var termErr error
 	session, err := restore.SessionProvider.GetSession()
@@ -463,16 +589,29 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 
 	maxInsertWorkers := restore.OutputOptions.NumInsertionWorkers
 
-	docChan := make(chan bson.Raw, insertBufferFactor)
+	docChan := make(chan sequencedDoc, insertBufferFactor)
 	resultChan := make(chan Result, maxInsertWorkers)
 
+	var skip int64
+	if checkpoints != nil {
+		skip = checkpoints.skip
+	}
+
 	// stream documents for this collection on docChan
 	go func() {
+		var seq int64
 		for {
 			doc := bsonSource.LoadNext()
 			if doc == nil {
 				break
 			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if match != nil && !match(doc) {
+				continue
+			}
 
 			if restore.terminate {
 				log.Logvf(log.Always, "terminating read on %v.%v", dbName, colName)
@@ -483,7 +622,8 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 
 			rawBytes := make([]byte, len(doc))
 			copy(rawBytes, doc)
-			docChan <- bson.Raw(rawBytes)
+			docChan <- sequencedDoc{raw: bson.Raw(rawBytes), seq: seq}
+			seq++
 			documentCount++
 		}
 		close(docChan)
@@ -496,29 +636,55 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 			var result Result
 
 			bulk := db.NewUnorderedBufferedBulkInserter(collection, restore.OutputOptions.BulkBufferSize).
-				SetOrdered(restore.OutputOptions.MaintainInsertionOrder)
+				SetOrdered(restore.OutputOptions.MaintainInsertionOrder).
+				SetMaxRetries(restore.OutputOptions.MaxRestoreRetries)
 			if collectionType != "timeseries" {
 				bulk.SetBypassDocumentValidation(restore.OutputOptions.BypassDocumentValidation)
 			}
-			for rawDoc := range docChan {
+			bulk.SetUpsert(restore.upsertsDocuments(collectionType))
+			bulk.SetComment(restore.OutputOptions.OpComment)
+			// finish sends the worker's result, counting the inserts whose
+			// outcome is unknown separately
+			finish := func() {
+				result.Unconfirmed = bulk.Unconfirmed()
+				resultChan <- result
+			}
+			// buffered holds the documents in the bulk inserter's buffer
+			var buffered []sequencedDoc
+			for doc := range docChan {
 				if restore.objCheck {
-					result.Err = bson.Unmarshal(rawDoc, &bson.D{})
+					result.Err = bson.Unmarshal(doc.raw, &bson.D{})
 					if result.Err != nil {
-						resultChan <- result
+						finish()
 						return
 					}
 				}
-				result.combineWith(NewResultFromBulkResult(bulk.InsertRaw(rawDoc)))
-				result.Err = db.FilterError(restore.OutputOptions.StopOnError, result.Err)
+				if checkpoints != nil {
+					buffered = append(buffered, doc)
+				}
+				restore.throttle.Wait(len(doc.raw))
+				bulkResult, bulkErr := restore.writeDocument(bulk, doc.raw, collectionType)
+				flushed := bulkResult != nil || bulkErr != nil
+				result.combineWith(restore.resultFromWrite(bulkResult, bulkErr))
 				if result.Err != nil {
-					resultChan <- result
+					finish()
 					return
 				}
+				if flushed {
+					if result.Err = checkpoints.complete(buffered); result.Err != nil {
+						finish()
+						return
+					}
+					buffered = buffered[:0]
+				}
 				watchProgressor.Set(file.Pos())
 			}
 			// flush the remaining docs
-			result.combineWith(NewResultFromBulkResult(bulk.Flush()))
-			resultChan <- result.withErr(db.FilterError(restore.OutputOptions.StopOnError, result.Err))
+			result.combineWith(restore.resultFromWrite(bulk.Flush()))
+			if result.Err == nil {
+				result.Err = checkpoints.complete(buffered)
+			}
+			finish()
 			return
 		}()
 
@@ -544,6 +710,8 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 		totalResult.Err = fmt.Errorf("reading bson input: %v", err)
 	} else if termErr != nil {
 		totalResult.Err = termErr
+	} else {
+		totalResult.read = documentCount
 	}
 	return totalResult
 }
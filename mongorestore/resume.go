@@ -0,0 +1,259 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/compression"
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/remote"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// A checkpoint is recorded once this many more documents have been inserted
+// or this much time has passed, whichever comes first.
+const (
+	resumeCheckpointDocs     = 10000
+	resumeCheckpointInterval = 10 * time.Second
+)
+
+// namespaceProgress is the high-water mark recorded for a single namespace.
+type namespaceProgress struct {
+	Complete bool `bson:"complete"`
+	// Docs is the number of documents at the start of the namespace's BSON
+	// data that are known to be inserted, and Offset is their size in bytes.
+	Docs   int64 `bson:"docs"`
+	Offset int64 `bson:"offset"`
+}
+
+// started reports whether any of the namespace has been restored, in which
+// case it must not be dropped or created again.
+func (p namespaceProgress) started() bool {
+	return p.Complete || p.Docs > 0
+}
+
+// resumeState tracks the progress of a --resume restore.
+type resumeState struct {
+	// Source is the archive or directory being restored, so that the state
+	// of one restore is not applied to another.
+	Source        string                        `bson:"source"`
+	Namespaces    map[string]*namespaceProgress `bson:"namespaces"`
+	UsersAndRoles bool                          `bson:"usersAndRoles"`
+	Oplog         bool                          `bson:"oplog"`
+
+	file *util.StateFile
+}
+
+// loadResumeState reads the resume state from the given file, returning an
+// empty state for source if the file does not exist yet.
+func loadResumeState(path, source string) (*resumeState, error) {
+	state := &resumeState{file: util.NewStateFile(path, "resume")}
+	found, err := state.file.Read(state)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		state.Source = source
+		state.Namespaces = map[string]*namespaceProgress{}
+		return state, nil
+	}
+	if state.Source != source {
+		return nil, fmt.Errorf("resume state %v is for a restore of '%v', not '%v'; remove it to start over",
+			path, state.Source, source)
+	}
+	if state.Namespaces == nil {
+		state.Namespaces = map[string]*namespaceProgress{}
+	}
+	return state, nil
+}
+
+// progress returns a copy of the recorded progress for ns.
+func (s *resumeState) progress(ns string) namespaceProgress {
+	s.file.Lock()
+	defer s.file.Unlock()
+	if p, ok := s.Namespaces[ns]; ok {
+		return *p
+	}
+	return namespaceProgress{}
+}
+
+// record stores the progress for ns and saves the state file.
+func (s *resumeState) record(ns string, p namespaceProgress) error {
+	s.file.Lock()
+	defer s.file.Unlock()
+	s.Namespaces[ns] = &p
+	return s.file.Write(s)
+}
+
+// markUsersAndRoles records that users and roles have been restored.
+func (s *resumeState) markUsersAndRoles() error {
+	s.file.Lock()
+	defer s.file.Unlock()
+	s.UsersAndRoles = true
+	return s.file.Write(s)
+}
+
+// markOplog records that the oplog has been replayed.
+func (s *resumeState) markOplog() error {
+	s.file.Lock()
+	defer s.file.Unlock()
+	s.Oplog = true
+	return s.file.Write(s)
+}
+
+// remove deletes the state file once the restore has completed.
+func (s *resumeState) remove() error {
+	return s.file.Remove()
+}
+
+// resumeSource identifies the input of the restore in the resume state.
+func (restore *MongoRestore) resumeSource() string {
+	if restore.InputOptions.Archive != "" {
+		return "archive:" + restore.InputOptions.Archive
+	}
+	return "dir:" + restore.TargetDirectory
+}
+
+// resumeProgress returns the recorded progress for an intent, which is empty
+// unless --resume is used.
+func (restore *MongoRestore) resumeProgress(intent *intents.Intent) namespaceProgress {
+	if restore.resumeState == nil {
+		return namespaceProgress{}
+	}
+	return restore.resumeState.progress(intent.Namespace())
+}
+
+// prepareResume sets up an intent's BSON file to continue after the recorded
+// progress. Plain BSON files on disk are seeked past the restored documents;
+// other input is read from the start and the restored documents skipped. It
+// returns the checkpointer to record further progress with.
+func (restore *MongoRestore) prepareResume(intent *intents.Intent, progress namespaceProgress) *restoreCheckpointer {
+	checkpoints := newRestoreCheckpointer(restore.resumeState, intent.Namespace(), progress)
+	if progress.Docs == 0 {
+		return checkpoints
+	}
+	log.Logvf(log.Always, "resuming %v after %v restored documents", intent.Namespace(), progress.Docs)
+	if file, ok := intent.BSONFile.(*realBSONFile); ok && !remote.IsRemote(file.path) && !isCompressedFile(file) {
+		file.resumeOffset = progress.Offset
+	} else {
+		checkpoints.skip = progress.Docs
+	}
+	return checkpoints
+}
+
+// drainIntent reads and discards the data of an intent that was already
+// restored. Archive collections have to be read for the demultiplexer to
+// move on; files on disk are left alone.
+func drainIntent(intent *intents.Intent) error {
+	if intent.BSONFile == nil {
+		return nil
+	}
+	if _, ok := intent.BSONFile.(*realBSONFile); ok {
+		return nil
+	}
+	if err := intent.BSONFile.Open(); err != nil {
+		return err
+	}
+	defer intent.BSONFile.Close()
+	_, err := io.Copy(ioutil.Discard, intent.BSONFile)
+	return err
+}
+
+// restoreCheckpointer records how many documents of a namespace have been
+// inserted. Insertion workers complete their batches out of order, so it
+// tracks the completed documents by their sequence number in the input and
+// only records the contiguous run of them from the start.
+type restoreCheckpointer struct {
+	state *resumeState
+	ns    string
+	// skip is the number of already restored documents to skip in the input.
+	skip int64
+
+	lock     sync.Mutex
+	next     int64
+	progress namespaceProgress
+	// done holds the sizes of completed documents after next.
+	done     map[int64]int
+	pending  int64
+	lastSave time.Time
+}
+
+// sequencedDoc is a document along with its position in the input, counted
+// from the first document not yet restored.
+type sequencedDoc struct {
+	raw bson.Raw
+	seq int64
+}
+
+func newRestoreCheckpointer(state *resumeState, ns string, progress namespaceProgress) *restoreCheckpointer {
+	return &restoreCheckpointer{
+		state:    state,
+		ns:       ns,
+		progress: progress,
+		done:     map[int64]int{},
+		lastSave: time.Now(),
+	}
+}
+
+// complete records that the given documents were inserted.
+func (c *restoreCheckpointer) complete(docs []sequencedDoc) error {
+	if c == nil || len(docs) == 0 {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, doc := range docs {
+		c.done[doc.seq] = len(doc.raw)
+	}
+	for {
+		size, ok := c.done[c.next]
+		if !ok {
+			break
+		}
+		delete(c.done, c.next)
+		c.next++
+		c.progress.Docs++
+		c.progress.Offset += int64(size)
+		c.pending++
+	}
+	if c.pending >= resumeCheckpointDocs || time.Since(c.lastSave) >= resumeCheckpointInterval {
+		return c.checkpointLocked()
+	}
+	return nil
+}
+
+// checkpoint saves the progress recorded so far.
+func (c *restoreCheckpointer) checkpoint() error {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.checkpointLocked()
+}
+
+func (c *restoreCheckpointer) checkpointLocked() error {
+	if c.pending == 0 {
+		return nil
+	}
+	c.pending = 0
+	c.lastSave = time.Now()
+	return c.state.record(c.ns, c.progress)
+}
+
+// isCompressedFile reports whether a dump file has to be decompressed, and so
+// cannot be resumed at an offset.
+func isCompressedFile(file *realBSONFile) bool {
+	return file.codec() != compression.None
+}
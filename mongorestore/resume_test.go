@@ -0,0 +1,95 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRestoreResumeState(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a resume state file", t, func() {
+		path := filepath.Join(t.TempDir(), "mongorestore.resume.json")
+		state, err := loadResumeState(path, "dir:dump")
+		So(err, ShouldBeNil)
+		So(state.progress("db.c").started(), ShouldBeFalse)
+
+		Convey("progress survives a reload", func() {
+			So(state.record("db.c", namespaceProgress{Docs: 3, Offset: 120}), ShouldBeNil)
+			So(state.markUsersAndRoles(), ShouldBeNil)
+
+			loaded, err := loadResumeState(path, "dir:dump")
+			So(err, ShouldBeNil)
+			So(loaded.progress("db.c"), ShouldResemble, namespaceProgress{Docs: 3, Offset: 120})
+			So(loaded.UsersAndRoles, ShouldBeTrue)
+			So(loaded.Oplog, ShouldBeFalse)
+
+			Convey("but is not applied to a different source", func() {
+				_, err := loadResumeState(path, "archive:other.archive")
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestRestoreCheckpointer(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a checkpointer resuming after two documents", t, func() {
+		state, err := loadResumeState(filepath.Join(t.TempDir(), "state.json"), "dir:dump")
+		So(err, ShouldBeNil)
+		checkpoints := newRestoreCheckpointer(state, "db.c", namespaceProgress{Docs: 2, Offset: 20})
+
+		docs := make([]sequencedDoc, 5)
+		for i := range docs {
+			raw, err := bson.Marshal(bson.M{"_id": i})
+			So(err, ShouldBeNil)
+			docs[i] = sequencedDoc{raw: raw, seq: int64(i)}
+		}
+		size := int64(len(docs[0].raw))
+
+		Convey("only the contiguous run of inserted documents is recorded", func() {
+			So(checkpoints.complete([]sequencedDoc{docs[2], docs[3]}), ShouldBeNil)
+			So(checkpoints.checkpoint(), ShouldBeNil)
+			So(state.progress("db.c").started(), ShouldBeFalse)
+
+			So(checkpoints.complete([]sequencedDoc{docs[0]}), ShouldBeNil)
+			So(checkpoints.checkpoint(), ShouldBeNil)
+			So(state.progress("db.c"), ShouldResemble, namespaceProgress{Docs: 3, Offset: 20 + size})
+
+			So(checkpoints.complete([]sequencedDoc{docs[1], docs[4]}), ShouldBeNil)
+			So(checkpoints.checkpoint(), ShouldBeNil)
+			So(state.progress("db.c"), ShouldResemble, namespaceProgress{Docs: 7, Offset: 20 + 5*size})
+		})
+	})
+}
+
+func TestResumeBSONFile(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A BSON file with a resume offset is read from that offset", t, func() {
+		path := filepath.Join(t.TempDir(), "c.bson")
+		So(ioutil.WriteFile(path, []byte("0123456789"), 0644), ShouldBeNil)
+
+		intent := &intents.Intent{DB: "db", C: "c"}
+		file := &realBSONFile{path: path, intent: intent, resumeOffset: 6}
+		So(file.Open(), ShouldBeNil)
+		defer file.Close()
+		data, err := ioutil.ReadAll(file)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "6789")
+		So(file.Pos(), ShouldEqual, 10)
+	})
+}
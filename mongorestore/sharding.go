@@ -0,0 +1,259 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/huimingz/mongo-tools/common/bsonutil"
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// shardingMetadataFileName is the file written to the root of the dump
+// directory by mongodump --includeShardingMetadata.
+const shardingMetadataFileName = "sharding.json"
+
+// shardingMetadata is the file written by mongodump --includeShardingMetadata.
+type shardingMetadata struct {
+	Shards []struct {
+		Shard string   `bson:"shard"`
+		Zones []string `bson:"zones"`
+	} `bson:"shards"`
+	Zones       []zoneRange          `bson:"zones"`
+	Collections []*shardedCollection `bson:"collections"`
+}
+
+// zoneRange is a range of shard key values assigned to a zone.
+type zoneRange struct {
+	Namespace string `bson:"ns"`
+	Min       bson.D `bson:"min"`
+	Max       bson.D `bson:"max"`
+	Zone      string `bson:"zone"`
+}
+
+// shardedCollection is how a collection was sharded in the dumped cluster.
+// Zones holds the zone ranges of the collection.
+type shardedCollection struct {
+	Namespace string `bson:"ns"`
+	Key       bson.D `bson:"key"`
+	Unique    bool   `bson:"unique"`
+	Chunks    []struct {
+		Min   bson.D `bson:"min"`
+		Shard string `bson:"shard"`
+	} `bson:"chunks"`
+	Zones []zoneRange `bson:"-"`
+}
+
+// loadShardingMetadata reads the sharding metadata from the root of the dump
+// directory. When the target is a database directory in the dump, the file
+// is in its parent.
+func loadShardingMetadata(target string) (*shardingMetadata, error) {
+	path := filepath.Join(target, shardingMetadataFileName)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		path = filepath.Join(filepath.Dir(filepath.Clean(target)), shardingMetadataFileName)
+		data, err = ioutil.ReadFile(path)
+	}
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no %v found in %v; dump with mongodump --includeShardingMetadata",
+			shardingMetadataFileName, target)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading sharding metadata: %v", err)
+	}
+	metadata := &shardingMetadata{}
+	if err = bson.UnmarshalExtJSON(data, true, metadata); err != nil {
+		return nil, fmt.Errorf("error parsing sharding metadata %v: %v", path, err)
+	}
+	log.Logvf(log.Info, "read sharding metadata from %v", path)
+	return metadata, nil
+}
+
+// byDestination returns the sharded collections by the namespace they are
+// restored to, with their zone ranges, applying any renames.
+func (m *shardingMetadata) byDestination(rename func(string) string) map[string]*shardedCollection {
+	collections := map[string]*shardedCollection{}
+	for _, coll := range m.Collections {
+		collections[rename(coll.Namespace)] = coll
+	}
+	for _, zone := range m.Zones {
+		if coll, ok := collections[rename(zone.Namespace)]; ok {
+			coll.Zones = append(coll.Zones, zone)
+		}
+	}
+	return collections
+}
+
+// isHashed reports whether the shard key has a hashed field.
+func (c *shardedCollection) isHashed() bool {
+	for _, key := range c.Key {
+		if key.Value == "hashed" {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareShardingMetadata loads the sharding metadata for
+// --restoreShardingMetadata and makes sure the zones it uses exist on the
+// target cluster. A zone that belonged to a shard of the same name in the
+// dumped cluster is added to that shard; ranges of zones that can't be
+// placed are skipped with a warning.
+func (restore *MongoRestore) prepareShardingMetadata() error {
+	if !restore.isMongos {
+		return fmt.Errorf("--restoreShardingMetadata requires a connection to a mongos")
+	}
+	metadata, err := loadShardingMetadata(restore.TargetDirectory)
+	if err != nil {
+		return err
+	}
+	restore.shardedCollections = metadata.byDestination(restore.renamer.Get)
+
+	targetShards, err := restore.SessionProvider.GetShards()
+	if err != nil {
+		return err
+	}
+	zoneExists := map[string]bool{}
+	shardExists := map[string]bool{}
+	for _, shard := range targetShards {
+		shardExists[shard.ID] = true
+		for _, zone := range shard.Tags {
+			zoneExists[zone] = true
+		}
+	}
+	restore.targetShards = shardExists
+	for _, shard := range metadata.Shards {
+		for _, zone := range shard.Zones {
+			if zoneExists[zone] || !shardExists[shard.Shard] {
+				continue
+			}
+			log.Logvf(log.Always, "adding shard %v to zone %v", shard.Shard, zone)
+			if err = restore.runShardingCommand(bson.D{{"addShardToZone", shard.Shard}, {"zone", zone}}); err != nil {
+				return err
+			}
+			zoneExists[zone] = true
+		}
+	}
+	for ns, coll := range restore.shardedCollections {
+		var placed []zoneRange
+		for _, zone := range coll.Zones {
+			if !zoneExists[zone.Zone] {
+				log.Logvf(log.Always, "warning: no shard is in zone %v, so its ranges of %v are not restored", zone.Zone, ns)
+				continue
+			}
+			placed = append(placed, zone)
+		}
+		coll.Zones = placed
+	}
+	return nil
+}
+
+// shardRestoredCollection shards a newly created collection the way it was
+// sharded in the dumped cluster, recreating its zone ranges and splitting it
+// at the bounds of its dumped chunks. Each chunk is then moved to the shard
+// it was on, if the target has a shard of that name, so that documents are
+// spread across the shards as they are inserted. Chunks of collections with
+// a hashed shard key are left to the server.
+func (restore *MongoRestore) shardRestoredCollection(intent *intents.Intent) error {
+	coll, ok := restore.shardedCollections[intent.Namespace()]
+	if !ok {
+		return nil
+	}
+	if intent.IsTimeseries() {
+		log.Logvf(log.Always, "warning: not sharding time series collection %v", intent.Namespace())
+		return nil
+	}
+	ns := intent.Namespace()
+	log.Logvf(log.Always, "sharding %v on %v", ns, bsonutil.CreateExtJSONString(coll.Key))
+
+	// enableSharding is implicit from MongoDB 6.0 and fails if it has already been run before that
+	if err := restore.runShardingCommand(bson.D{{"enableSharding", intent.DB}}); err != nil {
+		log.Logvf(log.DebugLow, "enableSharding on %v: %v", intent.DB, err)
+	}
+	err := restore.runShardingCommand(bson.D{{"shardCollection", ns}, {"key", coll.Key}, {"unique", coll.Unique}})
+	if err != nil {
+		return err
+	}
+	for _, zone := range coll.Zones {
+		err = restore.runShardingCommand(bson.D{
+			{"updateZoneKeyRange", ns}, {"min", zone.Min}, {"max", zone.Max}, {"zone", zone.Zone},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if coll.isHashed() {
+		log.Logvf(log.Info, "not pre-splitting %v, which has a hashed shard key", ns)
+		return nil
+	}
+	// the first chunk starts at MinKey, which is not a split point
+	for i := 1; i < len(coll.Chunks); i++ {
+		if err = restore.runShardingCommand(bson.D{{"split", ns}, {"middle", coll.Chunks[i].Min}}); err != nil {
+			return err
+		}
+	}
+	if len(coll.Chunks) > 1 {
+		log.Logvf(log.Always, "split %v into %v chunks", ns, len(coll.Chunks))
+	}
+
+	var moved int
+	for _, move := range coll.chunkMoves(ns, restore.targetShards) {
+		// the chunk may already be on its shard, and a chunk left behind
+		// only costs balance, so a failed move doesn't stop the restore
+		if err = restore.runShardingCommand(move); err != nil {
+			log.Logvf(log.Always, "warning: could not move a chunk of %v: %v", ns, err)
+			continue
+		}
+		moved++
+	}
+	if moved > 0 {
+		log.Logvf(log.Always, "moved %v %v of %v to the shards they were on", moved, util.Pluralize(moved, "chunk", "chunks"), ns)
+	}
+	return nil
+}
+
+// chunkMoves returns the moveChunk commands that put each dumped chunk of a
+// collection on the shard it was on, for the chunks whose shard the target
+// cluster has. The last chunk ends at MaxKey.
+func (c *shardedCollection) chunkMoves(ns string, targetShards map[string]bool) []bson.D {
+	var moves []bson.D
+	for i, chunk := range c.Chunks {
+		if chunk.Shard == "" || !targetShards[chunk.Shard] {
+			continue
+		}
+		var max bson.D
+		if i+1 < len(c.Chunks) {
+			max = c.Chunks[i+1].Min
+		} else {
+			for _, key := range c.Key {
+				max = append(max, bson.E{Key: key.Key, Value: primitive.MaxKey{}})
+			}
+		}
+		moves = append(moves, bson.D{
+			{"moveChunk", ns}, {"bounds", bson.A{chunk.Min, max}}, {"to", chunk.Shard},
+		})
+	}
+	return moves
+}
+
+// runShardingCommand runs a sharding administration command on the admin
+// database of the target cluster.
+func (restore *MongoRestore) runShardingCommand(cmd bson.D) error {
+	var result bson.M
+	if err := restore.SessionProvider.Run(cmd, &result, "admin"); err != nil {
+		return fmt.Errorf("error running %v: %v", cmd[0].Key, err)
+	}
+	return nil
+}
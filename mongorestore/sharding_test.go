@@ -0,0 +1,96 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testShardingMetadata = `{
+  "shards": [{"shard": "shard0", "zones": ["east"]}, {"shard": "shard1"}],
+  "zones": [
+    {"ns": "test.users", "min": {"region": "a"}, "max": {"region": "m"}, "zone": "east"},
+    {"ns": "other.coll", "min": {"x": 1}, "max": {"x": 2}, "zone": "east"}
+  ],
+  "collections": [
+    {"ns": "test.users", "key": {"region": 1}, "unique": false,
+     "chunks": [{"min": {"region": {"$minKey": 1}}, "shard": "shard0"}, {"min": {"region": "g"}, "shard": "shard2"},
+                {"min": {"region": "p"}, "shard": "shard1"}]},
+    {"ns": "test.events", "key": {"_id": "hashed"}, "unique": false, "chunks": []}
+  ]
+}`
+
+func TestLoadShardingMetadata(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With sharding metadata at the root of a dump", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_sharding_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		So(ioutil.WriteFile(filepath.Join(dir, shardingMetadataFileName), []byte(testShardingMetadata), 0644), ShouldBeNil)
+
+		Convey("it is read from the dump directory or a database directory in it", func() {
+			metadata, err := loadShardingMetadata(dir)
+			So(err, ShouldBeNil)
+			So(metadata.Collections, ShouldHaveLength, 2)
+			So(metadata.Shards[0].Zones, ShouldResemble, []string{"east"})
+
+			metadata, err = loadShardingMetadata(filepath.Join(dir, "test"))
+			So(err, ShouldBeNil)
+			So(metadata.Zones, ShouldHaveLength, 2)
+		})
+
+		Convey("collections are keyed by the namespace they are restored to", func() {
+			metadata, err := loadShardingMetadata(dir)
+			So(err, ShouldBeNil)
+			collections := metadata.byDestination(func(ns string) string {
+				return strings.Replace(ns, "test.", "copy.", 1)
+			})
+			So(collections, ShouldHaveLength, 2)
+			users := collections["copy.users"]
+			So(users, ShouldNotBeNil)
+			So(users.Key, ShouldResemble, bson.D{{"region", int32(1)}})
+			So(users.Zones, ShouldHaveLength, 1)
+			So(users.Chunks, ShouldHaveLength, 3)
+			So(users.isHashed(), ShouldBeFalse)
+			So(collections["copy.events"].isHashed(), ShouldBeTrue)
+		})
+
+		Convey("chunks are moved to the shards of the target that they were on", func() {
+			metadata, err := loadShardingMetadata(dir)
+			So(err, ShouldBeNil)
+			users := metadata.byDestination(func(ns string) string { return ns })["test.users"]
+			moves := users.chunkMoves("test.users", map[string]bool{"shard0": true, "shard1": true})
+			So(moves, ShouldHaveLength, 2)
+			So(moves[0], ShouldResemble, bson.D{
+				{"moveChunk", "test.users"},
+				{"bounds", bson.A{bson.D{{"region", primitive.MinKey{}}}, bson.D{{"region", "g"}}}},
+				{"to", "shard0"},
+			})
+			So(moves[1], ShouldResemble, bson.D{
+				{"moveChunk", "test.users"},
+				{"bounds", bson.A{bson.D{{"region", "p"}}, bson.D{{"region", primitive.MaxKey{}}}}},
+				{"to", "shard1"},
+			})
+		})
+
+		Convey("a dump without it is rejected", func() {
+			_, err := loadShardingMetadata(filepath.Join(os.TempDir(), "no_such_dump", "db"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--includeShardingMetadata")
+		})
+	})
+}
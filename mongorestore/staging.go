@@ -0,0 +1,129 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/options"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// stagingSuffix is appended to the name of a collection to get the name of
+// the collection it is restored into with --staging.
+const stagingSuffix = ".__restore_tmp"
+
+// checkStagingOptions returns an error if --staging is combined with options
+// it can't work with.
+func (restore *MongoRestore) checkStagingOptions() error {
+	if !restore.OutputOptions.Staging {
+		return nil
+	}
+	switch {
+	case !restore.OutputOptions.Drop:
+		return fmt.Errorf("%v replaces each restored collection, so it requires %v", StagingOption, DropOption)
+	case restore.InputOptions.OplogReplay:
+		return fmt.Errorf("cannot use %v with %v", StagingOption, OplogReplayOption)
+	case restore.OutputOptions.Resume:
+		return fmt.Errorf("cannot use %v with --resume", StagingOption)
+	case restore.OutputOptions.RestoreShardingMetadata:
+		return fmt.Errorf("cannot use %v with --restoreShardingMetadata: sharded collections can't be renamed", StagingOption)
+	case restore.OutputOptions.PreserveUUID:
+		// the collection being replaced usually still has the dumped UUID
+		return fmt.Errorf("cannot use %v with %v", StagingOption, PreserveUUIDOption)
+	}
+	for _, override := range restore.uuidOverrides {
+		if override.mode == uuidPreserve {
+			return fmt.Errorf("cannot use %v with a %v that preserves UUIDs", StagingOption, UUIDOverrideOption)
+		}
+	}
+	return nil
+}
+
+// stages reports whether an intent is restored into a staging collection.
+// Views, time series and system collections can't be renamed, so they are
+// always restored in place. So are capped collections, which may evict
+// documents and so never hold every document inserted.
+func (restore *MongoRestore) stages(intent *intents.Intent) bool {
+	return restore.OutputOptions.Staging &&
+		!intent.IsView() &&
+		!intent.IsTimeseries() &&
+		!intent.IsSpecialCollection() &&
+		!strings.HasPrefix(intent.C, "system.") &&
+		!util.IsTruthy(intent.Options["capped"])
+}
+
+// stagingIntent returns a copy of an intent that restores into its staging
+// collection.
+func stagingIntent(intent *intents.Intent) *intents.Intent {
+	staging := *intent
+	staging.C = intent.C + stagingSuffix
+	return &staging
+}
+
+// promoteStaging completes the restore of an intent into its staging
+// collection: it builds the indexes of the intent's collection on the
+// staging collection, checks that it holds every document inserted, and
+// renames it over the intent's collection. Applications see the collection
+// either as it was before the restore or with every document and index.
+// Inserts with an unconfirmed outcome may or may not have added a document.
+func (restore *MongoRestore) promoteStaging(intent, staging *intents.Intent, inserted, unconfirmed int64) error {
+	namespace := &options.Namespace{DB: intent.DB, Collection: intent.C}
+	if err := restore.restoreIndexesInto(namespace, staging.C); err != nil {
+		return err
+	}
+	restore.stagingLock.Lock()
+	if restore.promoted == nil {
+		restore.promoted = map[string]bool{}
+	}
+	restore.promoted[intent.Namespace()] = true
+	restore.stagingLock.Unlock()
+
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	count, err := session.Database(staging.DB).Collection(staging.C).CountDocuments(context.Background(), bson.D{})
+	if err != nil {
+		return fmt.Errorf("error counting documents in %v: %v", staging.Namespace(), err)
+	}
+	if count < inserted || count > inserted+unconfirmed {
+		expected := fmt.Sprint(inserted)
+		if unconfirmed > 0 {
+			expected = fmt.Sprintf("%v to %v", inserted, inserted+unconfirmed)
+		}
+		return fmt.Errorf("not replacing %v with %v: %v documents in the input but %v in the collection; the staging collection is left in place",
+			intent.Namespace(), staging.Namespace(), expected, count)
+	}
+
+	log.Logvf(log.Always, "replacing %v with %v", intent.Namespace(), staging.Namespace())
+	rename := bson.D{
+		{"renameCollection", staging.Namespace()},
+		{"to", intent.Namespace()},
+		{"dropTarget", true},
+	}
+	if err = session.Database("admin").RunCommand(context.Background(), rename).Err(); err != nil {
+		return fmt.Errorf("error renaming %v to %v: %v", staging.Namespace(), intent.Namespace(), err)
+	}
+	return nil
+}
+
+// indexesBuilt reports whether the indexes of a namespace were already built,
+// either as soon as it was restored or on its staging collection.
+func (restore *MongoRestore) indexesBuilt(ns string) bool {
+	if restore.indexBuilder.isBuilt(ns) {
+		return true
+	}
+	restore.stagingLock.Lock()
+	defer restore.stagingLock.Unlock()
+	return restore.promoted[ns]
+}
@@ -0,0 +1,86 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestStaging(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With --staging", t, func() {
+		mr := &MongoRestore{
+			InputOptions:  &InputOptions{},
+			OutputOptions: &OutputOptions{Staging: true, Drop: true},
+		}
+		So(mr.checkStagingOptions(), ShouldBeNil)
+
+		Convey("regular collections are restored into a staging collection", func() {
+			intent := &intents.Intent{DB: "db", C: "c"}
+			So(mr.stages(intent), ShouldBeTrue)
+			staging := stagingIntent(intent)
+			So(staging.Namespace(), ShouldEqual, "db.c.__restore_tmp")
+			So(intent.Namespace(), ShouldEqual, "db.c")
+		})
+
+		Convey("views, time series and system collections are restored in place", func() {
+			view := &intents.Intent{DB: "db", C: "v", Type: "view"}
+			So(mr.stages(view), ShouldBeFalse)
+			timeseries := &intents.Intent{DB: "db", C: "t", Type: "timeseries"}
+			So(mr.stages(timeseries), ShouldBeFalse)
+			So(mr.stages(&intents.Intent{DB: "db", C: "system.js"}), ShouldBeFalse)
+			So(mr.stages(&intents.Intent{DB: "admin", C: "system.users"}), ShouldBeFalse)
+		})
+
+		Convey("capped collections are restored in place", func() {
+			capped := &intents.Intent{DB: "db", C: "log", Options: bson.M{"capped": true, "size": 4096}}
+			So(mr.stages(capped), ShouldBeFalse)
+		})
+
+		Convey("promoted namespaces don't have their indexes built again", func() {
+			So(mr.indexesBuilt("db.c"), ShouldBeFalse)
+			mr.promoted = map[string]bool{"db.c": true}
+			So(mr.indexesBuilt("db.c"), ShouldBeTrue)
+		})
+
+		Convey("options it can't work with are rejected", func() {
+			mr.OutputOptions.Drop = false
+			So(mr.checkStagingOptions(), ShouldNotBeNil)
+			mr.OutputOptions.Drop = true
+
+			mr.InputOptions.OplogReplay = true
+			So(mr.checkStagingOptions(), ShouldNotBeNil)
+			mr.InputOptions.OplogReplay = false
+
+			mr.OutputOptions.Resume = true
+			So(mr.checkStagingOptions(), ShouldNotBeNil)
+			mr.OutputOptions.Resume = false
+
+			mr.OutputOptions.PreserveUUID = true
+			So(mr.checkStagingOptions(), ShouldNotBeNil)
+			mr.OutputOptions.PreserveUUID = false
+
+			mr.OutputOptions.UUIDOverride = []string{"db.*=preserve"}
+			So(mr.parseUUIDOptions(), ShouldBeNil)
+			So(mr.checkStagingOptions(), ShouldNotBeNil)
+			mr.OutputOptions.UUIDOverride = []string{"db.*=regenerate"}
+			So(mr.parseUUIDOptions(), ShouldBeNil)
+			So(mr.checkStagingOptions(), ShouldBeNil)
+		})
+	})
+
+	Convey("Without --staging, nothing is restored into a staging collection", t, func() {
+		mr := &MongoRestore{OutputOptions: &OutputOptions{}}
+		So(mr.stages(&intents.Intent{DB: "db", C: "c"}), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,132 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/mongorestore/ns"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// cappedOverride is a parsed --cappedOverride entry.
+type cappedOverride struct {
+	matcher *ns.Matcher
+	size    int64
+}
+
+// splitOptionList splits repeated, comma-separated option values.
+func splitOptionList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// parseStorageOverrides compiles --convertToClustered and --cappedOverride.
+func (restore *MongoRestore) parseStorageOverrides() error {
+	clustered := splitOptionList(restore.OutputOptions.ConvertToClustered)
+	capped := splitOptionList(restore.OutputOptions.CappedOverride)
+	if len(clustered) == 0 && len(capped) == 0 {
+		return nil
+	}
+	if restore.OutputOptions.NoOptionsRestore {
+		return fmt.Errorf("cannot use --convertToClustered or --cappedOverride with --noOptionsRestore")
+	}
+
+	if len(clustered) > 0 {
+		matcher, err := ns.NewMatcher(clustered)
+		if err != nil {
+			return fmt.Errorf("invalid --convertToClustered: %v", err)
+		}
+		restore.clusteredMatcher = matcher
+	}
+
+	for _, entry := range capped {
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return fmt.Errorf("invalid --cappedOverride %q: expected <namespace>=<size in bytes>", entry)
+		}
+		size, err := strconv.ParseInt(entry[i+1:], 10, 64)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("invalid --cappedOverride %q: size must be a positive number of bytes", entry)
+		}
+		matcher, err := ns.NewMatcher([]string{entry[:i]})
+		if err != nil {
+			return fmt.Errorf("invalid --cappedOverride %q: %v", entry, err)
+		}
+		restore.cappedOverrides = append(restore.cappedOverrides, cappedOverride{matcher, size})
+	}
+	return nil
+}
+
+// storageOverride returns whether a namespace is converted to a clustered
+// collection, and the size it is capped to, or 0.
+func (restore *MongoRestore) storageOverride(namespace string) (bool, int64) {
+	clustered := restore.clusteredMatcher != nil && restore.clusteredMatcher.Has(namespace)
+	for _, override := range restore.cappedOverrides {
+		if override.matcher.Has(namespace) {
+			return clustered, override.size
+		}
+	}
+	return clustered, 0
+}
+
+// applyStorageOverrides rewrites the options an intent's collection is
+// created with for --convertToClustered and --cappedOverride.
+func (restore *MongoRestore) applyStorageOverrides(intent *intents.Intent) error {
+	clustered, cappedSize := restore.storageOverride(intent.Namespace())
+	if !clustered && cappedSize == 0 {
+		return nil
+	}
+	if intent.IsView() || intent.IsTimeseries() || intent.IsSpecialCollection() {
+		log.Logvf(log.Always, "not changing the storage options of %v: only regular collections can be converted",
+			intent.Namespace())
+		return nil
+	}
+	if clustered && cappedSize > 0 {
+		return fmt.Errorf("%v matches both --convertToClustered and --cappedOverride", intent.Namespace())
+	}
+
+	if intent.Options == nil {
+		intent.Options = bson.M{}
+	}
+	if clustered {
+		for _, key := range []string{"capped", "size", "max", "autoIndexId", "idIndex"} {
+			delete(intent.Options, key)
+		}
+		intent.Options["clusteredIndex"] = bson.D{
+			{Key: "key", Value: bson.D{{Key: "_id", Value: 1}}},
+			{Key: "unique", Value: true},
+		}
+		log.Logvf(log.Info, "creating %v as a clustered collection", intent.Namespace())
+		return nil
+	}
+
+	delete(intent.Options, "clusteredIndex")
+	delete(intent.Options, "expireAfterSeconds")
+	intent.Options["capped"] = true
+	intent.Options["size"] = cappedSize
+	log.Logvf(log.Info, "creating %v as a capped collection of %v bytes", intent.Namespace(), cappedSize)
+	return nil
+}
+
+// hasStorageOverride reports whether the options of an intent were changed by
+// --convertToClustered or --cappedOverride.
+func (restore *MongoRestore) hasStorageOverride(intent *intents.Intent) bool {
+	clustered, cappedSize := restore.storageOverride(intent.Namespace())
+	return clustered || cappedSize > 0
+}
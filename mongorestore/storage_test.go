@@ -0,0 +1,70 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestStorageOverrides(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With storage overrides", t, func() {
+		mr := &MongoRestore{OutputOptions: &OutputOptions{
+			ConvertToClustered: []string{"db.events,db.logs"},
+			CappedOverride:     []string{"db.recent=4096", "other.*=1024"},
+		}}
+		So(mr.parseStorageOverrides(), ShouldBeNil)
+
+		Convey("a collection is converted to a clustered collection", func() {
+			intent := &intents.Intent{DB: "db", C: "events", Options: bson.M{"capped": true, "size": 100, "validator": bson.M{}}}
+			So(mr.applyStorageOverrides(intent), ShouldBeNil)
+			So(intent.Options["capped"], ShouldBeNil)
+			So(intent.Options["size"], ShouldBeNil)
+			So(intent.Options["validator"], ShouldNotBeNil)
+			So(intent.Options["clusteredIndex"], ShouldResemble, bson.D{
+				{Key: "key", Value: bson.D{{Key: "_id", Value: 1}}},
+				{Key: "unique", Value: true},
+			})
+		})
+
+		Convey("a collection is capped to the given size", func() {
+			intent := &intents.Intent{DB: "other", C: "c"}
+			So(mr.applyStorageOverrides(intent), ShouldBeNil)
+			So(intent.Options, ShouldResemble, bson.M{"capped": true, "size": int64(1024)})
+		})
+
+		Convey("other collections and views are left alone", func() {
+			intent := &intents.Intent{DB: "db", C: "c", Options: bson.M{"validator": bson.M{}}}
+			So(mr.applyStorageOverrides(intent), ShouldBeNil)
+			So(intent.Options, ShouldResemble, bson.M{"validator": bson.M{}})
+
+			view := &intents.Intent{DB: "db", C: "logs", Type: "view", Options: bson.M{"viewOn": "events"}}
+			So(mr.applyStorageOverrides(view), ShouldBeNil)
+			So(view.Options, ShouldResemble, bson.M{"viewOn": "events"})
+		})
+
+		Convey("a collection cannot be both clustered and capped", func() {
+			mr.OutputOptions.CappedOverride = []string{"db.*=1024"}
+			mr.cappedOverrides = nil
+			So(mr.parseStorageOverrides(), ShouldBeNil)
+			So(mr.applyStorageOverrides(&intents.Intent{DB: "db", C: "logs"}), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Invalid capped overrides are rejected", t, func() {
+		for _, entry := range []string{"db.c", "=10", "db.c=0", "db.c=big"} {
+			mr := &MongoRestore{OutputOptions: &OutputOptions{CappedOverride: []string{entry}}}
+			So(mr.parseStorageOverrides(), ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+)
+
+// newWriteThrottle builds the throttle that paces document writes according
+// to --rateLimit, --maxOpsPerSec and --maxReplicationLag, returning nil if no
+// limits are set. Whether or not --maxReplicationLag is given, writes also
+// pause while flow control is throttling a target that reports it. The
+// throttle is shared by all insertion workers and the oplog replay so the
+// limits apply to the restore as a whole. The monitor of the target, if any,
+// runs until the throttle is stopped.
+func (restore *MongoRestore) newWriteThrottle() *util.Throttle {
+	opts := restore.OutputOptions
+	flowControl := restore.reportsFlowControl()
+	if opts.RateLimit <= 0 && opts.MaxOpsPerSec <= 0 && opts.MaxReplicationLag <= 0 && !flowControl {
+		return nil
+	}
+	t := util.NewThrottle("writes", opts.RateLimit*1024*1024, float64(opts.MaxOpsPerSec))
+	if opts.RateLimit > 0 {
+		log.Logvf(log.Info, "limiting writes to %v MiB/s", opts.RateLimit)
+	}
+	if opts.MaxOpsPerSec > 0 {
+		log.Logvf(log.Info, "limiting writes to %v documents per second", opts.MaxOpsPerSec)
+	}
+
+	var replLag func() (time.Duration, error)
+	var flowControlStatus func() (*db.FlowControlStatus, error)
+	option := "the flow control backoff"
+	if opts.MaxReplicationLag > 0 {
+		log.Logvf(log.Info, "pausing writes while replication lag exceeds %v", opts.MaxReplicationLag)
+		replLag = restore.targetReplicationLag
+		option = MaxReplicationLagOption
+	}
+	if flowControl {
+		log.Logvf(log.Info, "pausing writes while flow control is throttling the target")
+		flowControlStatus = restore.SessionProvider.GetFlowControlStatus
+	}
+	if replLag != nil || flowControlStatus != nil {
+		go t.Monitor(option, targetLagCheck(opts.MaxReplicationLag, replLag, flowControlStatus))
+	}
+	return t
+}
+
+// reportsFlowControl reports whether the target reports the state of its
+// flow control, which mongos and servers before 4.2 don't.
+func (restore *MongoRestore) reportsFlowControl() bool {
+	if restore.SessionProvider == nil {
+		return false
+	}
+	status, err := restore.SessionProvider.GetFlowControlStatus()
+	if err != nil || status == nil {
+		log.Logvf(log.DebugLow, "not checking flow control on the target: %v", err)
+		return false
+	}
+	return true
+}
+
+// targetReplicationLag returns the replication lag of the target's
+// secondaries.
+func (restore *MongoRestore) targetReplicationLag() (time.Duration, error) {
+	status, err := restore.SessionProvider.GetReplSetStatus(nil)
+	if err != nil {
+		return 0, err
+	}
+	return status.MaxSecondaryLag(), nil
+}
+
+// targetLagCheck returns a check of the replication lag of the target's
+// secondaries, if replLag is given, and of whether the primary is throttling
+// writes with flow control, if flowControl is given, giving a reason to
+// pause writes while either is the case.
+func targetLagCheck(maxLag time.Duration, replLag func() (time.Duration, error),
+	flowControl func() (*db.FlowControlStatus, error)) func() (string, error) {
+	return func() (string, error) {
+		if replLag != nil {
+			lag, err := replLag()
+			if err != nil {
+				return "", fmt.Errorf("unable to check replication lag: %v", err)
+			}
+			if lag > maxLag {
+				return "replication lag on the target is " + lag.String(), nil
+			}
+		}
+		if flowControl != nil {
+			status, err := flowControl()
+			if err != nil || status == nil {
+				log.Logvf(log.DebugLow, "not checking flow control on the target: %v", err)
+				flowControl = nil
+			} else if status.Enabled && status.IsLagged {
+				return "flow control is throttling writes on the target", nil
+			}
+		}
+		return "", nil
+	}
+}
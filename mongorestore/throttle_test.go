@@ -0,0 +1,92 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriteThrottle(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Without limits there is no throttle", t, func() {
+		mr := newMongoRestore()
+		mr.OutputOptions = &OutputOptions{}
+		throttle := mr.newWriteThrottle()
+		So(throttle, ShouldBeNil)
+		So(func() { throttle.Wait(100) }, ShouldNotPanic)
+		So(func() { throttle.Stop() }, ShouldNotPanic)
+	})
+
+	Convey("With --rateLimit and --maxOpsPerSec", t, func() {
+		mr := newMongoRestore()
+		mr.OutputOptions = &OutputOptions{RateLimit: 2, MaxOpsPerSec: 100}
+		throttle := mr.newWriteThrottle()
+		defer throttle.Stop()
+		So(throttle, ShouldNotBeNil)
+	})
+
+	Convey("Without --maxReplicationLag the target is checked only for flow control", t, func() {
+		flowControl := &db.FlowControlStatus{Enabled: true}
+		flowControlChecks := 0
+		check := targetLagCheck(0, nil, func() (*db.FlowControlStatus, error) {
+			flowControlChecks++
+			return flowControl, nil
+		})
+
+		reason, err := check()
+		So(err, ShouldBeNil)
+		So(reason, ShouldEqual, "")
+
+		flowControl.IsLagged = true
+		reason, err = check()
+		So(err, ShouldBeNil)
+		So(reason, ShouldContainSubstring, "flow control")
+
+		Convey("and stops checking once the target doesn't report it", func() {
+			flowControl = nil
+			reason, err = check()
+			So(err, ShouldBeNil)
+			So(reason, ShouldEqual, "")
+			_, _ = check()
+			So(flowControlChecks, ShouldEqual, 3)
+		})
+	})
+
+	Convey("With --maxReplicationLag the lag is checked before flow control", t, func() {
+		lag := 10 * time.Second
+		var lagErr error
+		flowControlChecks := 0
+		check := targetLagCheck(30*time.Second, func() (time.Duration, error) {
+			return lag, lagErr
+		}, func() (*db.FlowControlStatus, error) {
+			flowControlChecks++
+			return &db.FlowControlStatus{Enabled: true, IsLagged: true}, nil
+		})
+
+		reason, err := check()
+		So(err, ShouldBeNil)
+		So(reason, ShouldContainSubstring, "flow control")
+		So(flowControlChecks, ShouldEqual, 1)
+
+		lag = time.Minute
+		reason, err = check()
+		So(err, ShouldBeNil)
+		So(reason, ShouldContainSubstring, "replication lag")
+		So(flowControlChecks, ShouldEqual, 1)
+
+		lagErr = fmt.Errorf("not a replica set")
+		_, err = check()
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,146 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// bucketOnlyOptions are options of a system.buckets collection that the
+// server sets itself and rejects when creating a time series collection.
+var bucketOnlyOptions = []string{"validator", "validationLevel", "validationAction", "clusteredIndex"}
+
+// applyBucketsOptions completes the options of a time series intent with
+// those mongodump recorded for its system.buckets collection: the time
+// series options, if the collection's own are missing, and the storage
+// engine options, which the server applies to the buckets collection.
+func applyBucketsOptions(intent *intents.Intent, bucketsOptions bson.M) {
+	if len(bucketsOptions) == 0 {
+		return
+	}
+	if intent.Options == nil {
+		intent.Options = bson.M{}
+	}
+	for _, key := range []string{"timeseries", "storageEngine"} {
+		if value, ok := bucketsOptions[key]; ok {
+			if _, exists := intent.Options[key]; !exists {
+				intent.Options[key] = value
+			}
+		}
+	}
+}
+
+// ensureTimeseriesOptions makes sure a time series intent is created as a
+// time series collection. If the dump holds the bucket collection without
+// time series options, they are taken from --timeseriesTimeField,
+// --timeseriesMetaField and --timeseriesGranularity, or detected from the
+// first bucket.
+func (restore *MongoRestore) ensureTimeseriesOptions(intent *intents.Intent) error {
+	if !intent.IsTimeseries() {
+		return nil
+	}
+	if _, ok := intent.Options["timeseries"]; ok {
+		return nil
+	}
+
+	timeseries := bson.M{}
+	timeField := restore.InputOptions.TimeseriesTimeField
+	if timeField == "" {
+		bucket, err := firstBucket(intent)
+		if err != nil {
+			return fmt.Errorf("no time series options for %v and could not detect them: %v; "+
+				"specify --timeseriesTimeField", intent.Namespace(), err)
+		}
+		detected, err := detectTimeseriesOptions(bucket, restore.InputOptions.TimeseriesMetaField)
+		if err != nil {
+			return fmt.Errorf("no time series options for %v and could not detect them: %v", intent.Namespace(), err)
+		}
+		timeseries = detected
+		log.Logvf(log.Always, "detected time series options for %v from its buckets: %v", intent.Namespace(), timeseries)
+	} else {
+		timeseries["timeField"] = timeField
+		if restore.InputOptions.TimeseriesMetaField != "" {
+			timeseries["metaField"] = restore.InputOptions.TimeseriesMetaField
+		}
+	}
+	if restore.InputOptions.TimeseriesGranularity != "" {
+		timeseries["granularity"] = restore.InputOptions.TimeseriesGranularity
+	}
+
+	if intent.Options == nil {
+		intent.Options = bson.M{}
+	}
+	for _, key := range bucketOnlyOptions {
+		delete(intent.Options, key)
+	}
+	intent.Options["timeseries"] = timeseries
+	return nil
+}
+
+// firstBucket reads the first document of a bucket collection in the dump.
+// Only plain dump files can be read ahead of the restore.
+func firstBucket(intent *intents.Intent) (bson.Raw, error) {
+	file, ok := intent.BSONFile.(*realBSONFile)
+	if !ok {
+		return nil, fmt.Errorf("buckets can only be read ahead from a dump directory")
+	}
+	if err := file.Open(); err != nil {
+		return nil, err
+	}
+	source := db.NewBSONSource(file)
+	defer source.Close()
+	doc := source.LoadNext()
+	if doc == nil {
+		if err := source.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("the bucket collection is empty")
+	}
+	return bson.Raw(doc), nil
+}
+
+// detectTimeseriesOptions works out the time series options from a bucket.
+// The time field is the only date in the bucket's control.min; the name of
+// the meta field is not stored in buckets, so it must be given if the bucket
+// has a meta value.
+func detectTimeseriesOptions(bucket bson.Raw, metaField string) (bson.M, error) {
+	min, ok := bucket.Lookup("control", "min").DocumentOK()
+	if !ok {
+		return nil, fmt.Errorf("the bucket has no control.min document")
+	}
+	elements, err := min.Elements()
+	if err != nil {
+		return nil, fmt.Errorf("invalid bucket: %v", err)
+	}
+	var dateFields []string
+	for _, element := range elements {
+		if element.Key() != "_id" && element.Value().Type == bson.TypeDateTime {
+			dateFields = append(dateFields, element.Key())
+		}
+	}
+	switch len(dateFields) {
+	case 0:
+		return nil, fmt.Errorf("the bucket has no date fields")
+	case 1:
+	default:
+		return nil, fmt.Errorf("the bucket has several date fields %v; specify --timeseriesTimeField", dateFields)
+	}
+
+	options := bson.M{"timeField": dateFields[0]}
+	if _, err = bucket.LookupErr("meta"); err == nil {
+		if metaField == "" {
+			return nil, fmt.Errorf("the buckets have a meta field, whose name is not stored in them; specify --timeseriesMetaField")
+		}
+		options["metaField"] = metaField
+	}
+	return options, nil
+}
@@ -0,0 +1,127 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func testBucket(withMeta bool, dateFields ...string) bson.Raw {
+	min := bson.D{bson.E{Key: "_id", Value: 1}, bson.E{Key: "temp", Value: 20}}
+	for _, field := range dateFields {
+		min = append(min, bson.E{Key: field, Value: time.Unix(1600000000, 0)})
+	}
+	bucket := bson.D{
+		bson.E{Key: "_id", Value: 1},
+		bson.E{Key: "control", Value: bson.D{bson.E{Key: "version", Value: 1}, bson.E{Key: "min", Value: min}}},
+	}
+	if withMeta {
+		bucket = append(bucket, bson.E{Key: "meta", Value: "sensor-1"})
+	}
+	raw, err := bson.Marshal(bucket)
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
+
+func TestDetectTimeseriesOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The time field is the only date in control.min", t, func() {
+		options, err := detectTimeseriesOptions(testBucket(false, "ts"), "")
+		So(err, ShouldBeNil)
+		So(options, ShouldResemble, bson.M{"timeField": "ts"})
+	})
+
+	Convey("Several date fields are ambiguous", t, func() {
+		_, err := detectTimeseriesOptions(testBucket(false, "ts", "other"), "")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Buckets with a meta value need --timeseriesMetaField", t, func() {
+		_, err := detectTimeseriesOptions(testBucket(true, "ts"), "")
+		So(err, ShouldNotBeNil)
+		options, err := detectTimeseriesOptions(testBucket(true, "ts"), "sensor")
+		So(err, ShouldBeNil)
+		So(options, ShouldResemble, bson.M{"timeField": "ts", "metaField": "sensor"})
+	})
+}
+
+func TestEnsureTimeseriesOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a bucket collection dumped without time series options", t, func() {
+		mr := newMongoRestore()
+		path := filepath.Join(t.TempDir(), "system.buckets.weather.bson")
+		So(ioutil.WriteFile(path, testBucket(false, "ts"), 0644), ShouldBeNil)
+		intent := &intents.Intent{DB: "db", C: "weather", Type: "timeseries", Location: path,
+			Options: bson.M{"validator": bson.M{}, "clusteredIndex": true, "expireAfterSeconds": 60}}
+		intent.BSONFile = &realBSONFile{path: path, intent: intent}
+
+		Convey("the options are detected from the first bucket", func() {
+			mr.InputOptions.TimeseriesGranularity = "minutes"
+			So(mr.ensureTimeseriesOptions(intent), ShouldBeNil)
+			So(intent.Options, ShouldResemble, bson.M{
+				"expireAfterSeconds": 60,
+				"timeseries":         bson.M{"timeField": "ts", "granularity": "minutes"},
+			})
+		})
+
+		Convey("the options can be given with flags", func() {
+			mr.InputOptions.TimeseriesTimeField = "when"
+			mr.InputOptions.TimeseriesMetaField = "where"
+			So(mr.ensureTimeseriesOptions(intent), ShouldBeNil)
+			So(intent.Options["timeseries"], ShouldResemble, bson.M{"timeField": "when", "metaField": "where"})
+		})
+
+		Convey("existing time series options are kept", func() {
+			intent.Options = bson.M{"timeseries": bson.M{"timeField": "t"}}
+			mr.InputOptions.TimeseriesTimeField = "when"
+			So(mr.ensureTimeseriesOptions(intent), ShouldBeNil)
+			So(intent.Options["timeseries"], ShouldResemble, bson.M{"timeField": "t"})
+		})
+	})
+}
+
+func TestApplyBucketsOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The options of the buckets collection complete a time series collection's", t, func() {
+		buckets := bson.M{
+			"validator":      bson.M{},
+			"clusteredIndex": true,
+			"timeseries":     bson.M{"timeField": "ts", "bucketMaxSpanSeconds": 3600},
+			"storageEngine":  bson.M{"wiredTiger": bson.M{"configString": "block_compressor=zstd"}},
+		}
+
+		Convey("the storage engine options are added", func() {
+			intent := &intents.Intent{DB: "db", C: "weather", Type: "timeseries",
+				Options: bson.M{"timeseries": bson.M{"timeField": "t"}}}
+			applyBucketsOptions(intent, buckets)
+			So(intent.Options, ShouldResemble, bson.M{
+				"timeseries":    bson.M{"timeField": "t"},
+				"storageEngine": bson.M{"wiredTiger": bson.M{"configString": "block_compressor=zstd"}},
+			})
+		})
+
+		Convey("missing time series options are taken from the buckets", func() {
+			intent := &intents.Intent{DB: "db", C: "weather"}
+			applyBucketsOptions(intent, buckets)
+			So(intent.Options["timeseries"], ShouldResemble, bson.M{"timeField": "ts", "bucketMaxSpanSeconds": 3600})
+			So(intent.Options, ShouldNotContainKey, "validator")
+		})
+	})
+}
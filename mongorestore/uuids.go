@@ -0,0 +1,183 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/mongorestore/ns"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// What happens to the UUID of a restored collection.
+const (
+	// uuidDiscard lets the server assign the collection a new UUID.
+	uuidDiscard = "discard"
+	// uuidPreserve creates the collection with the UUID in the dump.
+	uuidPreserve = "preserve"
+	// uuidRegenerate creates the collection with a new UUID chosen by
+	// mongorestore, so that the oplog entries for it can be rewritten.
+	uuidRegenerate = "regenerate"
+)
+
+// uuidOverride is a parsed --uuidOverride entry.
+type uuidOverride struct {
+	matcher *ns.Matcher
+	mode    string
+}
+
+// parseUUIDOptions checks --preserveUUID and --regenerateUUID and compiles
+// --uuidOverride.
+func (restore *MongoRestore) parseUUIDOptions() error {
+	if restore.OutputOptions.PreserveUUID && restore.OutputOptions.RegenerateUUID {
+		return fmt.Errorf("cannot use both --preserveUUID and --regenerateUUID")
+	}
+	restore.uuidOverrides = nil
+	for _, entry := range splitOptionList(restore.OutputOptions.UUIDOverride) {
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return fmt.Errorf("invalid --uuidOverride %q: expected <namespace>=preserve|regenerate|discard", entry)
+		}
+		mode := entry[i+1:]
+		switch mode {
+		case uuidPreserve, uuidRegenerate, uuidDiscard:
+		default:
+			return fmt.Errorf("invalid --uuidOverride %q: the UUID must be preserve, regenerate or discard", entry)
+		}
+		matcher, err := ns.NewMatcher([]string{entry[:i]})
+		if err != nil {
+			return fmt.Errorf("invalid --uuidOverride %q: %v", entry, err)
+		}
+		restore.uuidOverrides = append(restore.uuidOverrides, uuidOverride{matcher, mode})
+	}
+	return nil
+}
+
+// uuidOption returns the option that has collections created with a given
+// UUID, or "" if the server assigns every UUID.
+func (restore *MongoRestore) uuidOption() string {
+	switch {
+	case restore.OutputOptions.PreserveUUID:
+		return PreserveUUIDOption
+	case restore.OutputOptions.RegenerateUUID:
+		return RegenerateUUIDOption
+	}
+	for _, override := range restore.uuidOverrides {
+		if override.mode != uuidDiscard {
+			return UUIDOverrideOption
+		}
+	}
+	return ""
+}
+
+// checkUUIDSupport returns an error if collections are to be created with
+// a given UUID and that can't be done: the UUID of an existing collection
+// can't be changed, and servers before featureCompatibilityVersion 3.6 have
+// no collection UUIDs.
+func (restore *MongoRestore) checkUUIDSupport() error {
+	option := restore.uuidOption()
+	if option == "" {
+		return nil
+	}
+	if !restore.OutputOptions.Drop {
+		return fmt.Errorf("cannot specify %v without --drop", option)
+	}
+	ok, err := SupportsCollectionUUID(restore.SessionProvider)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("target host does not support %v: collection UUIDs require "+
+			"featureCompatibilityVersion 3.6 or later on the destination", option)
+	}
+	return nil
+}
+
+// uuidMode returns what happens to the UUID of a namespace. The first
+// matching --uuidOverride wins.
+func (restore *MongoRestore) uuidMode(namespace string) string {
+	for _, override := range restore.uuidOverrides {
+		if override.matcher.Has(namespace) {
+			return override.mode
+		}
+	}
+	switch {
+	case restore.OutputOptions.PreserveUUID:
+		return uuidPreserve
+	case restore.OutputOptions.RegenerateUUID:
+		return uuidRegenerate
+	}
+	return uuidDiscard
+}
+
+// setIntentUUID sets the UUID an intent's collection is created with, and
+// records what became of the UUID in the dump so that oplog entries for the
+// collection can follow it.
+func (restore *MongoRestore) setIntentUUID(intent *intents.Intent, dumpedUUID string) error {
+	intent.UUID = ""
+	switch restore.uuidMode(intent.Namespace()) {
+	case uuidPreserve:
+		if dumpedUUID == "" {
+			log.Logvf(log.Always, "--preserveUUID used but no UUID found in %v, generating new UUID for %v", intent.MetadataLocation, intent.Namespace())
+		}
+		intent.UUID = dumpedUUID
+	case uuidRegenerate:
+		uuid, err := newCollectionUUID()
+		if err != nil {
+			return fmt.Errorf("error generating a UUID for %v: %v", intent.Namespace(), err)
+		}
+		log.Logvf(log.DebugLow, "creating %v with the new UUID %v", intent.Namespace(), uuid)
+		intent.UUID = uuid
+	}
+	if dumpedUUID != "" {
+		restore.uuidLock.Lock()
+		if restore.uuidMap == nil {
+			restore.uuidMap = map[string]string{}
+		}
+		restore.uuidMap[strings.ToLower(dumpedUUID)] = intent.UUID
+		restore.uuidLock.Unlock()
+	}
+	return nil
+}
+
+// oplogUUID returns the 'ui' an oplog entry is applied with, or false if it
+// must be removed. UUIDs of restored collections follow the collections;
+// other UUIDs are only kept with --preserveUUID.
+func (restore *MongoRestore) oplogUUID(ui *primitive.Binary) (*primitive.Binary, bool) {
+	if ui != nil {
+		restore.uuidLock.Lock()
+		mapped, ok := restore.uuidMap[hex.EncodeToString(ui.Data)]
+		restore.uuidLock.Unlock()
+		if ok {
+			if mapped == "" {
+				return nil, false
+			}
+			data, err := hex.DecodeString(mapped)
+			if err != nil {
+				return nil, false
+			}
+			return &primitive.Binary{Subtype: ui.Subtype, Data: data}, true
+		}
+	}
+	return ui, restore.OutputOptions.PreserveUUID
+}
+
+// newCollectionUUID returns a random (version 4) UUID as a hex string.
+func newCollectionUUID() (string, error) {
+	uuid := make([]byte, 16)
+	if _, err := rand.Read(uuid); err != nil {
+		return "", err
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return hex.EncodeToString(uuid), nil
+}
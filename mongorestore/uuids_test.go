@@ -0,0 +1,108 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUUIDOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	const dumped = "0123456789abcdef0123456789abcdef"
+	dumpedBinary := func() *primitive.Binary {
+		data, _ := hex.DecodeString(dumped)
+		return &primitive.Binary{Subtype: 0x04, Data: data}
+	}
+
+	Convey("With --regenerateUUID and a per-namespace override", t, func() {
+		mr := &MongoRestore{OutputOptions: &OutputOptions{
+			RegenerateUUID: true,
+			UUIDOverride:   []string{"db.keep=preserve,db.server*=discard"},
+		}}
+		So(mr.parseUUIDOptions(), ShouldBeNil)
+		So(mr.uuidOption(), ShouldEqual, RegenerateUUIDOption)
+
+		Convey("overrides choose the mode of matching namespaces", func() {
+			So(mr.uuidMode("db.keep"), ShouldEqual, uuidPreserve)
+			So(mr.uuidMode("db.serverSide"), ShouldEqual, uuidDiscard)
+			So(mr.uuidMode("db.other"), ShouldEqual, uuidRegenerate)
+		})
+
+		Convey("a regenerated UUID is new and oplog entries follow it", func() {
+			intent := &intents.Intent{DB: "db", C: "other"}
+			So(mr.setIntentUUID(intent, dumped), ShouldBeNil)
+			So(intent.UUID, ShouldHaveLength, 32)
+			So(intent.UUID, ShouldNotEqual, dumped)
+
+			ui, keep := mr.oplogUUID(dumpedBinary())
+			So(keep, ShouldBeTrue)
+			So(hex.EncodeToString(ui.Data), ShouldEqual, intent.UUID)
+		})
+
+		Convey("a preserved UUID is kept in oplog entries", func() {
+			intent := &intents.Intent{DB: "db", C: "keep"}
+			So(mr.setIntentUUID(intent, dumped), ShouldBeNil)
+			So(intent.UUID, ShouldEqual, dumped)
+
+			ui, keep := mr.oplogUUID(dumpedBinary())
+			So(keep, ShouldBeTrue)
+			So(hex.EncodeToString(ui.Data), ShouldEqual, dumped)
+		})
+
+		Convey("a discarded UUID is removed from oplog entries", func() {
+			intent := &intents.Intent{DB: "db", C: "serverSide"}
+			So(mr.setIntentUUID(intent, dumped), ShouldBeNil)
+			So(intent.UUID, ShouldEqual, "")
+
+			_, keep := mr.oplogUUID(dumpedBinary())
+			So(keep, ShouldBeFalse)
+		})
+
+		Convey("UUIDs of collections not restored are removed", func() {
+			_, keep := mr.oplogUUID(dumpedBinary())
+			So(keep, ShouldBeFalse)
+		})
+	})
+
+	Convey("With --preserveUUID, UUIDs of collections not restored are kept", t, func() {
+		mr := &MongoRestore{OutputOptions: &OutputOptions{PreserveUUID: true}}
+		So(mr.parseUUIDOptions(), ShouldBeNil)
+		ui, keep := mr.oplogUUID(dumpedBinary())
+		So(keep, ShouldBeTrue)
+		So(hex.EncodeToString(ui.Data), ShouldEqual, dumped)
+	})
+
+	Convey("Discarding every UUID needs no support from the server", t, func() {
+		mr := &MongoRestore{OutputOptions: &OutputOptions{UUIDOverride: []string{"*.*=discard"}}}
+		So(mr.parseUUIDOptions(), ShouldBeNil)
+		So(mr.uuidOption(), ShouldEqual, "")
+		So(mr.checkUUIDSupport(), ShouldBeNil)
+	})
+
+	Convey("Invalid UUID options are rejected", t, func() {
+		mr := &MongoRestore{OutputOptions: &OutputOptions{PreserveUUID: true, RegenerateUUID: true}}
+		So(mr.parseUUIDOptions(), ShouldNotBeNil)
+
+		for _, entry := range []string{"db.c", "=preserve", "db.c=keep"} {
+			mr := &MongoRestore{OutputOptions: &OutputOptions{UUIDOverride: []string{entry}}}
+			So(mr.parseUUIDOptions(), ShouldNotBeNil)
+		}
+
+		mr = &MongoRestore{OutputOptions: &OutputOptions{UUIDOverride: []string{"db.*=regenerate"}}}
+		So(mr.parseUUIDOptions(), ShouldBeNil)
+		err := mr.checkUUIDSupport()
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "cannot specify --uuidOverride without --drop")
+	})
+}
@@ -0,0 +1,274 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/huimingz/mongo-tools/common/bsonutil"
+	"github.com/huimingz/mongo-tools/common/intents"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// hashManifest is the manifest written by mongodump --hashManifest. It holds
+// a hash of every _id range of every collection in the dump.
+type hashManifest struct {
+	Collections map[string]*manifestCollection `bson:"collections"`
+}
+
+// manifestCollection holds the ranges of one collection, in _id order.
+type manifestCollection struct {
+	Ranges []manifestRange `bson:"ranges"`
+}
+
+// manifestRange describes the documents whose _id is at least Min and less
+// than the Min of the next range. The first range has no Min.
+type manifestRange struct {
+	Min   interface{} `bson:"min,omitempty"`
+	Count int64       `bson:"count"`
+	Hash  string      `bson:"hash"`
+	// Changed is set by mongodump --baseManifest on the ranges it dumped.
+	Changed bool `bson:"changed"`
+}
+
+// loadHashManifest reads a manifest for --verifyManifest or
+// --applyDifferential.
+func loadHashManifest(path string) (*hashManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading hash manifest: %v", err)
+	}
+	manifest := &hashManifest{}
+	if err = bson.UnmarshalExtJSON(data, true, manifest); err != nil {
+		return nil, fmt.Errorf("error parsing hash manifest %v: %v", path, err)
+	}
+	return manifest, nil
+}
+
+// countExpectation is the number of documents a namespace should hold after
+// the restore. If exact is false, the collection existed before the restore
+// and may hold more.
+type countExpectation struct {
+	docs  int64
+	exact bool
+}
+
+// restoreVerifier collects what was restored for --verify. A nil verifier
+// ignores everything.
+type restoreVerifier struct {
+	lock   sync.Mutex
+	counts map[string]countExpectation
+}
+
+func newRestoreVerifier() *restoreVerifier {
+	return &restoreVerifier{counts: map[string]countExpectation{}}
+}
+
+// expect records the documents read from the input for an intent.
+func (v *restoreVerifier) expect(intent *intents.Intent, docs int64, exact bool) {
+	if v == nil {
+		return
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.counts[intent.Namespace()] = countExpectation{docs: docs, exact: exact}
+}
+
+func (v *restoreVerifier) expectation(ns string) (countExpectation, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	e, ok := v.counts[ns]
+	return e, ok
+}
+
+// verifyRestore compares the restored collections with the input: their
+// document counts with the number of documents read, and with
+// --verifyManifest the hashes of their _id ranges with the manifest of the
+// dump. It returns an error if any namespace diverges.
+func (restore *MongoRestore) verifyRestore() error {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+
+	bySource := restore.manager.NormalIntentsBySource()
+	sources := make([]string, 0, len(bySource))
+	for source := range bySource {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var failed int
+	for _, source := range sources {
+		intent := bySource[source]
+		if intent.IsView() {
+			continue
+		}
+		collection := session.Database(intent.DB).Collection(intent.DataCollection())
+		problems, err := restore.verifyCount(collection, intent)
+		if err != nil {
+			return err
+		}
+		if restore.verifyManifest != nil && !intent.IsTimeseries() {
+			if c, ok := restore.verifyManifest.Collections[source]; ok {
+				rangeProblems, err := verifyRanges(collection, c.Ranges)
+				if err != nil {
+					return fmt.Errorf("error verifying %v: %v", intent.Namespace(), err)
+				}
+				problems = append(problems, rangeProblems...)
+			} else {
+				log.Logvf(log.Info, "no ranges for %v in the hash manifest", source)
+			}
+		}
+		for _, problem := range problems {
+			log.Logvf(log.Always, "verification failed for %v: %v", intent.Namespace(), problem)
+		}
+		if len(problems) > 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("verification failed for %v %v", failed, util.Pluralize(failed, "namespace", "namespaces"))
+	}
+	log.Logvf(log.Always, "verified %v %v", len(sources), util.Pluralize(len(sources), "namespace", "namespaces"))
+	return nil
+}
+
+// verifyCount compares a collection's document count with the documents read.
+func (restore *MongoRestore) verifyCount(collection *mongo.Collection, intent *intents.Intent) ([]string, error) {
+	expected, ok := restore.verifier.expectation(intent.Namespace())
+	if !ok {
+		return nil, nil
+	}
+	count, err := collection.CountDocuments(context.Background(), bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("error counting documents in %v: %v", intent.Namespace(), err)
+	}
+	return checkCount(expected, count), nil
+}
+
+func checkCount(expected countExpectation, count int64) []string {
+	switch {
+	case expected.exact && count != expected.docs:
+		return []string{fmt.Sprintf("%v documents in the input but %v in the collection", expected.docs, count)}
+	case !expected.exact && count < expected.docs:
+		return []string{fmt.Sprintf("%v documents in the input but only %v in the collection", expected.docs, count)}
+	}
+	return nil
+}
+
+// verifyRanges hashes a collection's documents in _id order over the given
+// ranges, the same way mongodump --hashManifest does, and reports the
+// ranges whose count or hash differ.
+func verifyRanges(collection *mongo.Collection, ranges []manifestRange) ([]string, error) {
+	cursor, err := collection.Find(context.Background(), bson.D{},
+		mopt.Find().SetSort(bson.D{bson.E{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	hasher, err := newRangeVerifier(ranges)
+	if err != nil {
+		return nil, err
+	}
+	for cursor.Next(context.Background()) {
+		if err = hasher.add(cursor.Current); err != nil {
+			return nil, err
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, err
+	}
+	return hasher.finish(), nil
+}
+
+// rangeVerifier hashes documents into the ranges of a manifest.
+type rangeVerifier struct {
+	ranges []manifestRange
+	mins   []bson.RawValue
+
+	index    int
+	count    int64
+	hash     hash.Hash
+	problems []string
+}
+
+func newRangeVerifier(ranges []manifestRange) (*rangeVerifier, error) {
+	v := &rangeVerifier{ranges: ranges, hash: sha256.New()}
+	for i, r := range ranges {
+		if i == 0 {
+			v.mins = append(v.mins, bson.RawValue{})
+			continue
+		}
+		t, data, err := bson.MarshalValue(r.Min)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range boundary in hash manifest: %v", err)
+		}
+		v.mins = append(v.mins, bson.RawValue{Type: t, Value: data})
+	}
+	return v, nil
+}
+
+func (v *rangeVerifier) add(doc bson.Raw) error {
+	id, err := doc.LookupErr("_id")
+	if err != nil {
+		return fmt.Errorf("document without _id: %v", err)
+	}
+	for v.index+1 < len(v.ranges) && bsonutil.CompareValues(id, v.mins[v.index+1]) >= 0 {
+		v.endRange()
+	}
+	v.count++
+	v.hash.Write(doc)
+	return nil
+}
+
+func (v *rangeVerifier) endRange() {
+	if v.index < len(v.ranges) {
+		r := v.ranges[v.index]
+		sum := hex.EncodeToString(v.hash.Sum(nil))
+		switch {
+		case r.Count != v.count:
+			v.problems = append(v.problems, fmt.Sprintf("range %v has %v documents, expected %v", v.describe(), v.count, r.Count))
+		case r.Hash != sum:
+			v.problems = append(v.problems, fmt.Sprintf("range %v has different documents", v.describe()))
+		}
+	} else if v.count > 0 {
+		v.problems = append(v.problems, fmt.Sprintf("%v documents in a collection with no ranges in the manifest", v.count))
+	}
+	v.index++
+	v.count = 0
+	v.hash.Reset()
+}
+
+// describe names the current range by its lower bound.
+func (v *rangeVerifier) describe() string {
+	if v.index == 0 {
+		return "starting at the lowest _id"
+	}
+	return fmt.Sprintf("starting at _id %v", v.mins[v.index])
+}
+
+// finish completes the remaining ranges and returns the problems found.
+func (v *rangeVerifier) finish() []string {
+	v.endRange()
+	for v.index < len(v.ranges) {
+		v.endRange()
+	}
+	return v.problems
+}
@@ -0,0 +1,99 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func verifyTestDocs(ids ...int32) []bson.Raw {
+	var docs []bson.Raw
+	for _, id := range ids {
+		raw, err := bson.Marshal(bson.D{bson.E{Key: "_id", Value: id}, bson.E{Key: "x", Value: "v"}})
+		if err != nil {
+			panic(err)
+		}
+		docs = append(docs, raw)
+	}
+	return docs
+}
+
+func verifyTestRange(min interface{}, docs []bson.Raw) manifestRange {
+	h := sha256.New()
+	for _, doc := range docs {
+		h.Write(doc)
+	}
+	return manifestRange{Min: min, Count: int64(len(docs)), Hash: hex.EncodeToString(h.Sum(nil))}
+}
+
+func TestVerifyRanges(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a manifest of two ranges", t, func() {
+		docs := verifyTestDocs(1, 2, 3, 4)
+		ranges := []manifestRange{
+			verifyTestRange(nil, docs[:2]),
+			verifyTestRange(int32(3), docs[2:]),
+		}
+		check := func(docs []bson.Raw) []string {
+			v, err := newRangeVerifier(ranges)
+			So(err, ShouldBeNil)
+			for _, doc := range docs {
+				So(v.add(doc), ShouldBeNil)
+			}
+			return v.finish()
+		}
+
+		Convey("identical documents verify", func() {
+			So(check(docs), ShouldBeEmpty)
+		})
+
+		Convey("a missing document is reported for its range", func() {
+			problems := check(append([]bson.Raw{docs[0]}, docs[2:]...))
+			So(problems, ShouldHaveLength, 1)
+			So(problems[0], ShouldContainSubstring, "lowest _id")
+		})
+
+		Convey("a changed document is reported for its range", func() {
+			changed, err := bson.Marshal(bson.D{bson.E{Key: "_id", Value: int32(4)}, bson.E{Key: "x", Value: "w"}})
+			So(err, ShouldBeNil)
+			problems := check(append(docs[:3:3], changed))
+			So(problems, ShouldHaveLength, 1)
+			So(problems[0], ShouldContainSubstring, "different documents")
+		})
+
+		Convey("an empty collection fails every non-empty range", func() {
+			So(check(nil), ShouldHaveLength, 2)
+		})
+	})
+}
+
+func TestVerifyCounts(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("An exact expectation requires the same count", t, func() {
+		So(checkCount(countExpectation{docs: 3, exact: true}, 3), ShouldBeEmpty)
+		So(checkCount(countExpectation{docs: 3, exact: true}, 4), ShouldHaveLength, 1)
+		So(checkCount(countExpectation{docs: 3, exact: true}, 2), ShouldHaveLength, 1)
+	})
+
+	Convey("A collection that existed may hold more documents", t, func() {
+		So(checkCount(countExpectation{docs: 3}, 5), ShouldBeEmpty)
+		So(checkCount(countExpectation{docs: 3}, 2), ShouldHaveLength, 1)
+	})
+
+	Convey("A nil verifier ignores expectations", t, func() {
+		var v *restoreVerifier
+		So(func() { v.expect(nil, 1, true) }, ShouldNotPanic)
+	})
+}
@@ -8,6 +8,7 @@
 package main
 
 import (
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -15,6 +16,7 @@ import (
 	"github.com/huimingz/mongo-tools/common/log"
 	"github.com/huimingz/mongo-tools/common/password"
 	"github.com/huimingz/mongo-tools/common/signals"
+	"github.com/huimingz/mongo-tools/common/text"
 	"github.com/huimingz/mongo-tools/common/util"
 	"github.com/huimingz/mongo-tools/mongostat"
 	"github.com/huimingz/mongo-tools/mongostat/stat_consumer"
@@ -95,16 +97,80 @@ func main() {
 		os.Exit(util.ExitFailure)
 	}
 
+	if opts.NDJSON && (opts.Json || opts.Interactive) {
+		log.Logvf(log.Always, "cannot use output format --ndjson with --json or --interactive")
+		os.Exit(util.ExitFailure)
+	}
+
+	if opts.Dashboard && (opts.Json || opts.NDJSON || opts.Interactive) {
+		log.Logvf(log.Always, "cannot use --dashboard with another output format")
+		os.Exit(util.ExitFailure)
+	}
+
+	if opts.OutFile != "" && (opts.Dashboard || opts.Interactive) {
+		log.Logvf(log.Always, "cannot use --outFile with --dashboard or --interactive")
+		os.Exit(util.ExitFailure)
+	}
+
+	var rotateSize int64
+	if opts.RotateSize != "" {
+		if opts.OutFile == "" {
+			log.Logvf(log.Always, "--rotateSize can only be used when --outFile is also specified")
+			os.Exit(util.ExitFailure)
+		}
+		if rotateSize, err = text.ParseByteAmount(opts.RotateSize); err != nil {
+			log.Logvf(log.Always, "error parsing --rotateSize: %v", err)
+			os.Exit(util.ExitFailure)
+		}
+	}
+
 	if opts.Deprecated && !opts.Json {
 		log.Logvf(log.Always, "--useDeprecatedJsonKeys can only be used when --json is also specified")
 		os.Exit(util.ExitFailure)
 	}
 
+	if opts.Minimal && (opts.Columns != "" || opts.All) {
+		log.Logvf(log.Always, "--minimal cannot be used with -o or --all")
+		os.Exit(util.ExitFailure)
+	}
+
 	if opts.Columns != "" && opts.AppendColumns != "" {
 		log.Logvf(log.Always, "-O cannot be used if -o is also specified")
 		os.Exit(util.ExitFailure)
 	}
 
+	var alerter *stat_consumer.Alerter
+	if opts.Alert != "" {
+		rules, err := stat_consumer.ParseAlertRules(opts.Alert)
+		if err != nil {
+			log.Logvf(log.Always, "error parsing --alert: %v", err)
+			os.Exit(util.ExitFailure)
+		}
+		if opts.AlertIntervals < 1 {
+			log.Logvf(log.Always, "--alertIntervals must be at least 1")
+			os.Exit(util.ExitFailure)
+		}
+		alerter = stat_consumer.NewAlerter(rules, opts.AlertIntervals, opts.AlertCmd)
+	} else if opts.AlertCmd != "" {
+		log.Logvf(log.Always, "--alertCmd can only be used when --alert is also specified")
+		os.Exit(util.ExitFailure)
+	}
+
+	if opts.DiscoverEvery < 1 {
+		log.Logvf(log.Always, "--discoverInterval must be at least 1 second")
+		os.Exit(util.ExitFailure)
+	}
+
+	if opts.Top < 0 {
+		log.Logvf(log.Always, "--top must not be negative")
+		os.Exit(util.ExitFailure)
+	}
+
+	if opts.Replay != "" && opts.Record != "" {
+		log.Logvf(log.Always, "cannot use --record and --replay together")
+		os.Exit(util.ExitFailure)
+	}
+
 	if opts.HumanReadable != "true" && opts.HumanReadable != "false" {
 		log.Logvf(log.Always, "--humanReadable must be set to either 'true' or 'false'")
 		os.Exit(util.ExitFailure)
@@ -112,7 +178,7 @@ func main() {
 
 	// we have to check this here, otherwise the user will be prompted
 	// for a password for each discovered node
-	if opts.Auth.ShouldAskForPassword() {
+	if opts.Replay == "" && opts.Auth.ShouldAskForPassword() {
 		pass, err := password.Prompt()
 		if err != nil {
 			log.Logvf(log.Always, "Failed: %v", err)
@@ -124,8 +190,12 @@ func main() {
 	var factory stat_consumer.FormatterConstructor
 	if opts.Json {
 		factory = stat_consumer.FormatterConstructors["json"]
+	} else if opts.NDJSON {
+		factory = stat_consumer.FormatterConstructors["ndjson"]
 	} else if opts.Interactive {
 		factory = stat_consumer.FormatterConstructors["interactive"]
+	} else if opts.Dashboard {
+		factory = stat_consumer.FormatterConstructors["dashboard"]
 	} else {
 		factory = stat_consumer.FormatterConstructors[""]
 	}
@@ -141,7 +211,10 @@ func main() {
 		if opts.All {
 			cliFlags |= line.FlagAll
 		}
-		if strings.Contains(opts.Host, ",") {
+		if opts.Minimal {
+			cliFlags |= line.FlagMinimal
+		}
+		if strings.Contains(opts.Host, ",") || opts.Replay != "" {
 			cliFlags |= line.FlagHosts
 		}
 	}
@@ -170,13 +243,48 @@ func main() {
 
 	readerConfig := &status.ReaderConfig{
 		HumanReadable: opts.HumanReadable == "true",
+		Raw:           opts.NDJSON || opts.Dashboard || alerter != nil,
+		Top:           opts.Top,
 	}
 	if opts.Json {
 		readerConfig.TimeFormat = "15:04:05"
 	}
 
+	var out io.Writer = os.Stdout
+	if opts.OutFile != "" {
+		outFile, err := mongostat.NewRotatingFile(opts.OutFile, rotateSize, opts.RotateKeep)
+		if err != nil {
+			log.Logv(log.Always, err.Error())
+			os.Exit(util.ExitFailure)
+		}
+		defer outFile.Close()
+		out = outFile
+	}
+
 	consumer := stat_consumer.NewStatConsumer(cliFlags, customHeaders,
-		keyNames, readerConfig, formatter, os.Stdout)
+		keyNames, readerConfig, formatter, out)
+	if alerter != nil {
+		consumer.SetAlerter(alerter)
+	}
+
+	if opts.Replay != "" {
+		in, err := os.Open(opts.Replay)
+		if err != nil {
+			log.Logvf(log.Always, "error opening --replay file: %v", err)
+			os.Exit(util.ExitFailure)
+		}
+		err = mongostat.Replay(in, consumer)
+		formatter.Finish()
+		if err != nil {
+			log.Logvf(log.Always, "Failed: %v", err)
+			os.Exit(util.ExitFailure)
+		}
+		if alerter != nil && alerter.Fired() {
+			os.Exit(util.ExitFailure)
+		}
+		return
+	}
+
 	seedHosts := util.CreateConnectionAddrs(opts.Host, opts.Port)
 	var cluster mongostat.ClusterMonitor
 	if opts.Discover || len(seedHosts) > 1 {
@@ -194,6 +302,16 @@ func main() {
 		}
 	}
 
+	if opts.Record != "" {
+		out, err := os.Create(opts.Record)
+		if err != nil {
+			log.Logvf(log.Always, "error creating --record file: %v", err)
+			os.Exit(util.ExitFailure)
+		}
+		defer out.Close()
+		cluster = mongostat.NewRecordingClusterMonitor(cluster, out)
+	}
+
 	var discoverChan chan string
 	if opts.Discover {
 		discoverChan = make(chan string, 128)
@@ -226,4 +344,7 @@ func main() {
 		log.Logvf(log.Always, "Failed: %v", err)
 		os.Exit(util.ExitFailure)
 	}
+	if alerter != nil && alerter.Fired() {
+		os.Exit(util.ExitFailure)
+	}
 }
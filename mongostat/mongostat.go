@@ -8,6 +8,7 @@
 package mongostat
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strings"
@@ -21,6 +22,10 @@ import (
 	"github.com/huimingz/mongo-tools/mongostat/stat_consumer/line"
 	"github.com/huimingz/mongo-tools/mongostat/status"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopt "go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // MongoStat is a container for the user-specified options and
@@ -48,6 +53,9 @@ type MongoStat struct {
 
 	// Mutex to handle safe concurrent adding to or looping over discovered nodes.
 	nodesLock sync.RWMutex
+
+	// Whether the seed nodes have been added and discovery has begun.
+	discovering bool
 }
 
 // ConfigShard holds a mapping for the format of shard hosts as they
@@ -68,6 +76,12 @@ type NodeMonitor struct {
 
 	// The most recent error encountered when collecting stats for this node.
 	Err error
+
+	// Whether to also run the top command on each poll, for --top.
+	CollectTop bool
+
+	// How often to look for shards added to a cluster, when discovering.
+	DiscoverInterval time.Duration
 }
 
 // SyncClusterMonitor is an implementation of ClusterMonitor that writes output
@@ -274,7 +288,6 @@ func (node *NodeMonitor) Disconnect() {
 // Report collects the stat info for a single node and sends found hostnames on
 // the "discover" channel if checkShards is true.
 func (node *NodeMonitor) Poll(discover chan string, checkShards bool) (*status.ServerStatus, error) {
-	stat := &status.ServerStatus{}
 	log.Logvf(log.DebugHigh, "getting session on server: %v", node.host)
 	session, err := node.sessionProvider.GetSession()
 	if err != nil {
@@ -294,11 +307,14 @@ func (node *NodeMonitor) Poll(discover chan string, checkShards bool) (*status.S
 		log.Logvf(log.Always, "Encountered error decoding serverStatus: %v\n", err)
 		return nil, fmt.Errorf("Error decoding serverStatus: %v\n", err)
 	}
-	err = bson.Unmarshal(tempBson, &stat)
+	stat, skipped, err := status.DecodeServerStatus(tempBson)
 	if err != nil {
 		log.Logvf(log.Always, "Encountered error reading serverStatus: %v\n", err)
 		return nil, fmt.Errorf("Error reading serverStatus: %v\n", err)
 	}
+	if len(skipped) > 0 {
+		log.Logvf(log.DebugLow, "could not read %v in the serverStatus of %v", strings.Join(skipped, ", "), node.host)
+	}
 	// The flattened version is required by some lookup functions
 	statMap := make(map[string]interface{})
 	err = result.Decode(&statMap)
@@ -320,6 +336,20 @@ func (node *NodeMonitor) Poll(discover chan string, checkShards bool) (*status.S
 	}
 	node.alias = stat.Host
 	stat.Host = node.host
+	if discover != nil && status.IsPrimary(stat) {
+		window, err := oplogWindow(session, stat)
+		if err != nil {
+			log.Logvf(log.DebugLow, "could not read the oplog window of %v: %v", node.host, err)
+		}
+		stat.OplogWindow = window
+	}
+	if node.CollectTop && !status.IsMongos(stat) {
+		top, err := readTop(session)
+		if err != nil {
+			log.Logvf(log.DebugLow, "could not run top on %v: %v", node.host, err)
+		}
+		stat.Top = top
+	}
 	if discover != nil && stat != nil && status.IsMongos(stat) && checkShards {
 		log.Logvf(log.DebugLow, "checking config database to discover shards")
 		shardCursor, err := session.Database("config").Collection("shards").Find(nil, bson.M{}, nil)
@@ -342,14 +372,68 @@ func (node *NodeMonitor) Poll(discover chan string, checkShards bool) (*status.S
 	return stat, nil
 }
 
+// oplogWindow returns the time between the first entry of a primary's oplog
+// and its latest write.
+func oplogWindow(session *mongo.Client, stat *status.ServerStatus) (time.Duration, error) {
+	oplog := session.Database("local").Collection("oplog.rs")
+	readTs := func(direction int) (primitive.Timestamp, error) {
+		var entry struct {
+			Ts primitive.Timestamp `bson:"ts"`
+		}
+		findOpts := mopt.FindOne().SetSort(bson.D{{Key: "$natural", Value: direction}}).SetProjection(bson.D{{Key: "ts", Value: 1}})
+		err := oplog.FindOne(context.Background(), bson.D{}, findOpts).Decode(&entry)
+		return entry.Ts, err
+	}
+
+	first, err := readTs(1)
+	if err != nil {
+		return 0, err
+	}
+	var last primitive.Timestamp
+	if stat.Repl.LastWrite != nil {
+		last = stat.Repl.LastWrite.OpTime.Ts
+	} else if last, err = readTs(-1); err != nil {
+		return 0, err
+	}
+	return time.Duration(int64(last.T)-int64(first.T)) * time.Second, nil
+}
+
+// readTop returns the output of the top command by namespace.
+func readTop(session *mongo.Client) (map[string]status.NSTop, error) {
+	var result struct {
+		Totals map[string]bson.RawValue `bson:"totals"`
+	}
+	err := session.Database("admin").RunCommand(context.Background(), bson.D{{Key: "top", Value: 1}}).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	top := make(map[string]status.NSTop, len(result.Totals))
+	for ns, value := range result.Totals {
+		// skip the "note" string that comes along with the namespaces
+		if value.Type != bsontype.EmbeddedDocument {
+			continue
+		}
+		var nsTop status.NSTop
+		if err = value.Unmarshal(&nsTop); err != nil {
+			return nil, fmt.Errorf("error decoding top for %v: %v", ns, err)
+		}
+		top[ns] = nsTop
+	}
+	return top, nil
+}
+
 // Watch continuously collects and processes stats for a single node on a
 // regular interval. At each interval, it triggers the node's Poll function
 // with the 'discover' channel.
 func (node *NodeMonitor) Watch(sleep time.Duration, discover chan string, cluster ClusterMonitor) {
-	var cycle uint64
+	var lastShardCheck time.Time
 	for ticker := time.Tick(sleep); ; <-ticker {
 		log.Logvf(log.DebugHigh, "polling server: %v", node.host)
-		stat, err := node.Poll(discover, cycle%10 == 0)
+		checkShards := time.Since(lastShardCheck) >= node.DiscoverInterval
+		if checkShards {
+			lastShardCheck = time.Now()
+		}
+		stat, err := node.Poll(discover, checkShards)
 
 		if stat != nil {
 			log.Logvf(log.DebugHigh, "successfully got statline from host: %v", node.host)
@@ -359,7 +443,6 @@ func (node *NodeMonitor) Watch(sleep time.Duration, discover chan string, cluste
 			nodeError = status.NewNodeError(node.host, err)
 		}
 		cluster.Update(stat, nodeError)
-		cycle++
 	}
 }
 
@@ -388,12 +471,20 @@ func (mstat *MongoStat) AddNewNode(fullhost string) error {
 			return nil
 		}
 	}
-	log.Logvf(log.DebugLow, "adding new host to monitoring: %v", fullhost)
+	if mstat.discovering {
+		log.Logvf(log.Always, "discovered new host: %v", fullhost)
+	} else {
+		log.Logvf(log.DebugLow, "adding new host to monitoring: %v", fullhost)
+	}
 	// Create a new node monitor for this host
 	node, err := NewNodeMonitor(*mstat.Options, fullhost)
 	if err != nil {
 		return err
 	}
+	if mstat.StatOptions != nil {
+		node.CollectTop = mstat.StatOptions.Top > 0
+		node.DiscoverInterval = time.Duration(mstat.StatOptions.DiscoverEvery) * time.Second
+	}
 	mstat.Nodes[fullhost] = node
 	go node.Watch(mstat.SleepInterval, mstat.Discovered, mstat.Cluster)
 	return nil
@@ -403,6 +494,8 @@ func (mstat *MongoStat) AddNewNode(fullhost string) error {
 // and discovery goroutines
 func (mstat *MongoStat) Run() error {
 	if mstat.Discovered != nil {
+		// nodes added from now on joined the topology after the seeds
+		mstat.discovering = true
 		go func() {
 			for {
 				newHost := <-mstat.Discovered
@@ -7,12 +7,18 @@
 package mongostat
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/huimingz/mongo-tools/common/testtype"
+	"github.com/huimingz/mongo-tools/mongostat/stat_consumer"
 	"github.com/huimingz/mongo-tools/mongostat/stat_consumer/line"
 	"github.com/huimingz/mongo-tools/mongostat/status"
 	. "github.com/smartystreets/goconvey/convey"
@@ -73,6 +79,22 @@ func TestStatLine(t *testing.T) {
 		So(statsLine.Fields["conn"], ShouldEqual, "5")
 	})
 
+	Convey("StatsLine should carry raw values when asked", t, func() {
+		rawConfig := &status.ReaderConfig{Raw: true}
+		statsLine := line.NewStatLine(serverStatusOld, serverStatusNew, append(defaultHeaders, "mem.bits"), rawConfig)
+		So(statsLine.Raw["insert"], ShouldEqual, 10)
+		So(statsLine.Raw["getmore"], ShouldEqual, 3)
+		So(statsLine.Raw["faults"], ShouldEqual, 5)
+		So(statsLine.Raw["qr"], ShouldEqual, 3)
+		So(statsLine.Raw["aw"], ShouldEqual, 6)
+		So(statsLine.Raw["net_in_bytes"], ShouldEqual, 2000)
+		So(statsLine.Raw["conn"], ShouldEqual, 5)
+		So(statsLine.Raw["host"], ShouldEqual, serverStatusNew.Host)
+		So(statsLine.Raw, ShouldContainKey, "mem.bits")
+
+		So(line.NewStatLine(serverStatusOld, serverStatusNew, defaultHeaders, defaultConfig).Raw, ShouldBeNil)
+	})
+
 	serverStatusNew.SampleTime, _ = time.Parse("2006 Jan 02 15:04:05", "2015 Nov 30 4:25:33")
 	Convey("StatsLine with non-default interval should calculate average diffs", t, func() {
 		statsLine := line.NewStatLine(serverStatusOld, serverStatusNew, defaultHeaders, defaultConfig)
@@ -102,6 +124,384 @@ func TestStatLine(t *testing.T) {
 	})
 }
 
+func TestWiredTigerColumns(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	sampleTime := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	newStat := func(secs int, evicted, ckptMs int64) *status.ServerStatus {
+		stat := &status.ServerStatus{
+			SampleTime:    sampleTime.Add(time.Duration(secs) * time.Second),
+			StorageEngine: &status.StorageEngine{Name: "wiredTiger"},
+			WiredTiger:    &status.WiredTiger{},
+			Metrics:       &status.MetricsStats{Cursor: &status.CursorStats{}},
+		}
+		stat.WiredTiger.Cache.CurrentCachedBytes = 3 * 1024 * 1024
+		stat.WiredTiger.Cache.TrackedDirtyBytes = 1024
+		stat.WiredTiger.Cache.UnmodifiedPagesEvict = evicted
+		stat.WiredTiger.Cache.ModifiedPagesEvict = evicted
+		stat.WiredTiger.Transaction.CheckpointMostRecentMs = ckptMs
+		stat.Metrics.Cursor.Open.Total = 12
+		stat.Metrics.Cursor.Open.Pinned = 2
+		return stat
+	}
+	oldStat, curStat := newStat(0, 100, 500), newStat(2, 300, 1500)
+	headers := []string{"cache_bytes", "cache_dirty", "evicted", "ckpt_time", "cursors"}
+
+	Convey("WiredTiger cache, checkpoint and cursor columns are read from serverStatus", t, func() {
+		statsLine := line.NewStatLine(oldStat, curStat, headers, &status.ReaderConfig{HumanReadable: true})
+		So(statsLine.Fields["cache_bytes"], ShouldEqual, "3.00MB")
+		So(statsLine.Fields["cache_dirty"], ShouldEqual, "1.00KB")
+		So(statsLine.Fields["evicted"], ShouldEqual, "200")
+		So(statsLine.Fields["ckpt_time"], ShouldEqual, "1.5s")
+		So(statsLine.Fields["cursors"], ShouldEqual, "12|2")
+
+		statsLine = line.NewStatLine(oldStat, curStat, headers, &status.ReaderConfig{Raw: true})
+		So(statsLine.Fields["cache_bytes"], ShouldEqual, "3145728")
+		So(statsLine.Fields["ckpt_time"], ShouldEqual, "1500")
+		So(statsLine.Raw["evicted"], ShouldEqual, 200)
+		So(statsLine.Raw["checkpoint_ms"], ShouldEqual, 1500)
+		So(statsLine.Raw["cursors_open"], ShouldEqual, 12)
+	})
+}
+
+func TestFlowControlAndTransactions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	sampleTime := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	newStat := func(secs int, lagged bool, acquiringMicros, committed, aborted, timedOut int64) *status.ServerStatus {
+		return &status.ServerStatus{
+			SampleTime: sampleTime.Add(time.Duration(secs) * time.Second),
+			FlowControl: &status.FlowControlStats{
+				Enabled:             true,
+				IsLagged:            lagged,
+				TimeAcquiringMicros: acquiringMicros,
+			},
+			Transactions: &status.TxnStats{CurrentActive: 4, TotalCommitted: committed, TotalAborted: aborted},
+			Metrics:      &status.MetricsStats{Cursor: &status.CursorStats{TimedOut: timedOut}},
+		}
+	}
+	oldStat, curStat := newStat(0, false, 1000000, 100, 10, 1), newStat(2, true, 1500000, 300, 14, 4)
+	headers := []string{"fc_lagged", "fc_wait", "txn", "cursor_to"}
+
+	Convey("Flow control, transaction and cursor timeout columns are read from serverStatus", t, func() {
+		statsLine := line.NewStatLine(oldStat, curStat, headers, &status.ReaderConfig{Raw: true})
+		So(statsLine.Fields["fc_lagged"], ShouldEqual, "yes")
+		So(statsLine.Fields["fc_wait"], ShouldEqual, "250")
+		So(statsLine.Fields["txn"], ShouldEqual, "4|100|2")
+		So(statsLine.Fields["cursor_to"], ShouldEqual, "3")
+		So(statsLine.Raw["fc_lagged"], ShouldEqual, true)
+		So(statsLine.Raw["fc_wait_ms"], ShouldEqual, 250)
+		So(statsLine.Raw["txn_committed"], ShouldEqual, 100)
+		So(statsLine.Raw["cursors_timed_out"], ShouldEqual, 3)
+	})
+
+	Convey("Flow control columns are empty when it is disabled", t, func() {
+		curStat.FlowControl.Enabled = false
+		statsLine := line.NewStatLine(oldStat, curStat, headers, &status.ReaderConfig{})
+		So(statsLine.Fields["fc_lagged"], ShouldEqual, "")
+	})
+}
+
+func TestReplicationLag(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	written := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	member := func(host string, primary bool, lastWrite time.Time) *status.ServerStatus {
+		stat := &status.ServerStatus{
+			Host:       host,
+			SampleTime: time.Now(),
+			Repl: &status.ReplStatus{
+				SetName:   "rs",
+				IsMaster:  primary,
+				Secondary: !primary,
+				LastWrite: &status.LastWrite{LastWriteDate: lastWrite},
+			},
+		}
+		if primary {
+			stat.OplogWindow = 36 * time.Hour
+		}
+		return stat
+	}
+
+	Convey("Secondaries report their lag behind the primary", t, func() {
+		headers := []string{"lag", "oplog_window"}
+		consumer := stat_consumer.NewStatConsumer(0, headers, line.DefaultKeyMap(),
+			&status.ReaderConfig{HumanReadable: true}, stat_consumer.NewJSONLineFormatter(0, false), ioutil.Discard)
+
+		var lines []*line.StatLine
+		for i := 0; i < 2; i++ {
+			for _, stat := range []*status.ServerStatus{
+				member("primary:27017", true, written),
+				member("secondary:27017", false, written.Add(-5*time.Second)),
+			} {
+				if statLine, ok := consumer.Update(stat); ok {
+					lines = append(lines, statLine)
+				}
+			}
+		}
+		So(lines, ShouldHaveLength, 2)
+		So(lines[0].Fields["lag"], ShouldEqual, "")
+		So(lines[0].Fields["oplog_window"], ShouldEqual, "36h0m0s")
+		So(lines[1].Fields["lag"], ShouldEqual, "5s")
+		So(lines[1].Fields["oplog_window"], ShouldEqual, "")
+	})
+}
+
+func TestLimitedServerStatus(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Sections of serverStatus that can't be read are skipped", t, func() {
+		raw, err := bson.Marshal(bson.D{
+			{"host", "serverless:27017"},
+			{"mem", "unavailable"},
+			{"opcounters", bson.D{{"insert", int64(7)}}},
+			{"connections", bson.D{{"current", int32(3)}}},
+		})
+		So(err, ShouldBeNil)
+		stat, skipped, err := status.DecodeServerStatus(raw)
+		So(err, ShouldBeNil)
+		So(skipped, ShouldResemble, []string{"mem"})
+		So(stat.Host, ShouldEqual, "serverless:27017")
+		So(stat.Opcounters.Insert, ShouldEqual, 7)
+		So(stat.Connections.Current, ShouldEqual, 3)
+		So(stat.Mem, ShouldBeNil)
+		So(status.MissingSections(stat), ShouldResemble, []string{"mem", "network"})
+
+		stat.Mem = &status.MemStats{}
+		stat.Network = &status.NetworkStats{}
+		So(status.MissingSections(stat), ShouldBeEmpty)
+	})
+
+	Convey("A node missing the default columns falls back to the --minimal layout", t, func() {
+		sampleTime := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+		newStat := func(secs int, inserts int64) *status.ServerStatus {
+			return &status.ServerStatus{
+				Host:        "serverless:27017",
+				SampleTime:  sampleTime.Add(time.Duration(secs) * time.Second),
+				Opcounters:  &status.OpcountStats{Insert: inserts},
+				Connections: &status.ConnectionStats{Current: 3},
+			}
+		}
+		var out bytes.Buffer
+		consumer := stat_consumer.NewStatConsumer(line.FlagAlways, nil, line.DefaultKeyMap(),
+			&status.ReaderConfig{}, stat_consumer.NewGridLineFormatter(0, true), &out)
+		_, seen := consumer.Update(newStat(0, 10))
+		So(seen, ShouldBeFalse)
+		statLine, seen := consumer.Update(newStat(1, 15))
+		So(seen, ShouldBeTrue)
+		So(statLine.Fields["insert"], ShouldEqual, "5")
+		So(statLine.Fields["conn"], ShouldEqual, "3")
+		So(statLine.Fields["net_in"], ShouldEqual, "")
+		So(statLine.Fields, ShouldNotContainKey, "vsize")
+
+		consumer.FormatLines([]*line.StatLine{statLine})
+		header := strings.Fields(strings.Split(out.String(), "\n")[0])
+		So(header, ShouldResemble, []string{"insert", "query", "update", "delete", "getmore", "command",
+			"net_in", "net_out", "conn", "time"})
+	})
+
+	Convey("The default columns read a node without any optional sections", t, func() {
+		headers := make([]string, len(line.CondHeaders))
+		for i, h := range line.CondHeaders {
+			headers[i] = h.Key
+		}
+		empty := &status.ServerStatus{}
+		So(func() { line.NewStatLine(empty, empty, headers, &status.ReaderConfig{}) }, ShouldNotPanic)
+	})
+}
+
+func TestAlerts(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Alert rules compare a metric with a number or a duration", t, func() {
+		rules, err := stat_consumer.ParseAlertRules("qrw>100, lag>=10s,conn<5")
+		So(err, ShouldBeNil)
+		So(rules, ShouldHaveLength, 3)
+		So(rules[0].Field, ShouldEqual, "qrw")
+		So(rules[1].Op, ShouldEqual, ">=")
+		So(rules[1].Threshold, ShouldEqual, 10)
+		So(rules[2].String(), ShouldEqual, "conn<5")
+
+		for _, spec := range []string{"qrw", "qrw>>1", "lag>soon", ""} {
+			_, err := stat_consumer.ParseAlertRules(spec)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("An alert fires once a threshold is crossed for enough intervals", t, func() {
+		rules, err := stat_consumer.ParseAlertRules("qrw>100,lag>10s")
+		So(err, ShouldBeNil)
+		alerter := stat_consumer.NewAlerter(rules, 2, "")
+		statLine := func(qr int64, lag float64) []*line.StatLine {
+			return []*line.StatLine{{
+				Fields: map[string]string{"host": "db:27017"},
+				Raw:    map[string]interface{}{"qr": qr, "qw": int64(0), "repl_lag_secs": lag},
+			}}
+		}
+
+		So(alerter.Check(statLine(150, 0)), ShouldBeEmpty)
+		So(alerter.Check(statLine(50, 0)), ShouldBeEmpty)
+		So(alerter.Check(statLine(150, 0)), ShouldBeEmpty)
+		alerts := alerter.Check(statLine(150, 12))
+		So(alerts, ShouldHaveLength, 1)
+		So(alerts[0].Rule, ShouldEqual, "qrw>100")
+		So(alerts[0].Value, ShouldEqual, 150)
+		So(alerter.Check(statLine(150, 12)), ShouldHaveLength, 1)
+		So(alerter.Check(statLine(150, 12)), ShouldBeEmpty)
+		So(alerter.Fired(), ShouldBeTrue)
+	})
+}
+
+func TestTopCollections(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	sample := func(usersMicros, ordersMicros, ops int64) *status.ServerStatus {
+		return &status.ServerStatus{
+			Host:       "db:27017",
+			SampleTime: time.Now(),
+			Top: map[string]status.NSTop{
+				"app.users": {
+					Total: status.TopField{Time: usersMicros, Count: ops},
+					Read:  status.TopField{Time: usersMicros, Count: ops},
+				},
+				"app.orders": {
+					Total: status.TopField{Time: ordersMicros, Count: ops},
+					Write: status.TopField{Time: ordersMicros, Count: ops},
+				},
+				"app.idle": {Total: status.TopField{Time: 5000, Count: 1}},
+			},
+		}
+	}
+
+	Convey("The busiest namespaces of an interval come first", t, func() {
+		busiest := status.BusiestCollections(sample(150000, 40000, 60), sample(100000, 20000, 10), 5)
+		So(busiest, ShouldResemble, []status.CollectionActivity{
+			{Namespace: "app.users", TotalMs: 50, ReadMs: 50, Ops: 50},
+			{Namespace: "app.orders", TotalMs: 20, WriteMs: 20, Ops: 50},
+		})
+		So(status.BusiestCollections(sample(150000, 40000, 60), sample(100000, 20000, 10), 1), ShouldHaveLength, 1)
+		So(status.BusiestCollections(sample(150000, 40000, 60), &status.ServerStatus{}, 5), ShouldBeNil)
+	})
+
+	Convey("The busiest namespaces are printed after each interval", t, func() {
+		var out bytes.Buffer
+		consumer := stat_consumer.NewStatConsumer(0, []string{"host"}, line.DefaultKeyMap(),
+			&status.ReaderConfig{Top: 1}, stat_consumer.NewGridLineFormatter(0, true), &out)
+		consumer.Update(sample(100000, 20000, 10))
+		statLine, ok := consumer.Update(sample(150000, 40000, 60))
+		So(ok, ShouldBeTrue)
+		consumer.FormatLines([]*line.StatLine{statLine})
+		So(out.String(), ShouldContainSubstring, "busiest collections on db:27017")
+		So(out.String(), ShouldContainSubstring, "app.users")
+		So(out.String(), ShouldNotContainSubstring, "app.orders")
+	})
+}
+
+// updateRecorder is a ClusterMonitor that keeps the samples it is updated with.
+type updateRecorder struct {
+	stats  []*status.ServerStatus
+	errors []*status.NodeError
+}
+
+func (recorder *updateRecorder) Monitor(time.Duration) error { return nil }
+
+func (recorder *updateRecorder) Update(stat *status.ServerStatus, err *status.NodeError) {
+	recorder.stats = append(recorder.stats, stat)
+	recorder.errors = append(recorder.errors, err)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A recorded session replays with the normal formatting", t, func() {
+		serverStatusOld := readBSONFile("test_data/server_status_old.bson", t)
+		serverStatusNew := readBSONFile("test_data/server_status_new.bson", t)
+		serverStatusOld.Host = "db:27017"
+		serverStatusNew.Host = "db:27017"
+
+		var recording bytes.Buffer
+		monitor := &updateRecorder{}
+		recorder := NewRecordingClusterMonitor(monitor, &recording)
+		recorder.Update(serverStatusOld, nil)
+		recorder.Update(serverStatusNew, nil)
+		recorder.Update(nil, status.NewNodeError("db:27017", errors.New("connection refused")))
+		So(monitor.stats, ShouldHaveLength, 3)
+		So(monitor.errors[2], ShouldNotBeNil)
+
+		var out bytes.Buffer
+		consumer := stat_consumer.NewStatConsumer(line.FlagAlways|line.FlagHosts, nil, line.DefaultKeyMap(),
+			&status.ReaderConfig{HumanReadable: true}, stat_consumer.NewGridLineFormatter(0, true), &out)
+		So(Replay(ioutil.NopCloser(&recording), consumer), ShouldBeNil)
+
+		output := out.String()
+		So(output, ShouldContainSubstring, "db:27017")
+		So(output, ShouldContainSubstring, "connection refused")
+		So(strings.Count(output, "\n"), ShouldEqual, 3)
+	})
+
+	Convey("A truncated recording fails to replay", t, func() {
+		consumer := stat_consumer.NewStatConsumer(line.FlagAlways, nil, line.DefaultKeyMap(),
+			&status.ReaderConfig{}, stat_consumer.NewGridLineFormatter(0, true), ioutil.Discard)
+		So(Replay(ioutil.NopCloser(strings.NewReader("\x20\x00")), consumer), ShouldNotBeNil)
+	})
+}
+
+func TestRotatingFile(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("An --outFile rotates once it reaches --rotateSize", t, func() {
+		path := filepath.Join(t.TempDir(), "stats.log")
+		out, err := NewRotatingFile(path, 10, 2)
+		So(err, ShouldBeNil)
+		for _, interval := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+			_, err = out.Write([]byte(interval))
+			So(err, ShouldBeNil)
+		}
+		So(out.Close(), ShouldBeNil)
+
+		read := func(name string) string {
+			data, err := ioutil.ReadFile(name)
+			So(err, ShouldBeNil)
+			return string(data)
+		}
+		So(read(path), ShouldEqual, "fourth\n")
+		So(read(path+".1"), ShouldEqual, "third\n")
+		So(read(path+".2"), ShouldEqual, "second\n")
+		_, err = os.Stat(path + ".3")
+		So(os.IsNotExist(err), ShouldBeTrue)
+	})
+}
+
+func TestDashboardHelpers(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Sparklines scale values between their minimum and maximum", t, func() {
+		So(stat_consumer.Sparkline([]float64{0, 7, 14}), ShouldEqual, "▁▄█")
+		So(stat_consumer.Sparkline([]float64{3, 3}), ShouldEqual, "▁▁")
+		So(stat_consumer.Sparkline(nil), ShouldEqual, "")
+	})
+
+	Convey("Hosts sort numerically by their raw metrics", t, func() {
+		statLine := func(host string, command int64) *line.StatLine {
+			return &line.StatLine{
+				Fields: map[string]string{"host": host, "command": fmt.Sprintf("%v|0", command)},
+				Raw:    map[string]interface{}{"command": command},
+			}
+		}
+		lines := []*line.StatLine{statLine("a:27017", 9), statLine("b:27017", 10), statLine("c:27017", 2)}
+		lines = append(lines, &line.StatLine{Fields: map[string]string{"host": "d:27017"}, Error: errors.New("down")})
+
+		stat_consumer.SortLines(lines, "command", true)
+		So(lines[0].Fields["host"], ShouldEqual, "b:27017")
+		So(lines[1].Fields["host"], ShouldEqual, "a:27017")
+		So(lines[2].Fields["host"], ShouldEqual, "c:27017")
+		So(lines[3].Fields["host"], ShouldEqual, "d:27017")
+
+		stat_consumer.SortLines(lines, "host", false)
+		So(lines[0].Fields["host"], ShouldEqual, "a:27017")
+	})
+}
+
 func TestIsMongos(t *testing.T) {
 	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
 
@@ -24,17 +24,30 @@ See http://docs.mongodb.com/database-tools/mongostat/ for more information.`
 
 // StatOptions defines the set of options to use for configuring mongostat.
 type StatOptions struct {
-	Columns       string `short:"o" value-name:"<field>[,<field>]*" description:"fields to show. For custom fields, use dot-syntax to index into serverStatus output, and optional methods .diff() and .rate() e.g. metrics.record.moves.diff()"`
-	AppendColumns string `short:"O" value-name:"<field>[,<field>]*" description:"like -o, but preloaded with default fields. Specified fields inserted after default output"`
-	HumanReadable string `long:"humanReadable" default:"true" description:"print sizes and time in human readable format (e.g. 1K 234M 2G). To use the more precise machine readable format, use --humanReadable=false"`
-	NoHeaders     bool   `long:"noheaders" description:"don't output column names"`
-	RowCount      int64  `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
-	Discover      bool   `long:"discover" description:"discover nodes and display stats for all"`
-	Http          bool   `long:"http" description:"use HTTP instead of raw db connection"`
-	All           bool   `long:"all" description:"all optional fields"`
-	Json          bool   `long:"json" description:"output as JSON rather than a formatted table"`
-	Deprecated    bool   `long:"useDeprecatedJsonKeys" description:"use old key names; only valid with the json output option."`
-	Interactive   bool   `short:"i" long:"interactive" description:"display stats in a non-scrolling interface"`
+	Columns        string `short:"o" value-name:"<field>[,<field>]*" description:"fields to show. For custom fields, use dot-syntax to index into serverStatus output, and optional methods .diff() and .rate() e.g. metrics.record.moves.diff()"`
+	AppendColumns  string `short:"O" value-name:"<field>[,<field>]*" description:"like -o, but preloaded with default fields. Specified fields inserted after default output"`
+	HumanReadable  string `long:"humanReadable" default:"true" description:"print sizes and time in human readable format (e.g. 1K 234M 2G). To use the more precise machine readable format, use --humanReadable=false"`
+	NoHeaders      bool   `long:"noheaders" description:"don't output column names"`
+	RowCount       int64  `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
+	Discover       bool   `long:"discover" description:"discover nodes and display stats for all"`
+	DiscoverEvery  int    `long:"discoverInterval" value-name:"<seconds>" default:"10" description:"with --discover, how often to look for shards added to the cluster; replica set members are looked for on every poll"`
+	Http           bool   `long:"http" description:"use HTTP instead of raw db connection"`
+	All            bool   `long:"all" description:"all optional fields"`
+	Minimal        bool   `long:"minimal" description:"only show the columns every deployment reports: host, opcounters, network, connections, set, repl and time; used automatically for nodes, such as Atlas serverless instances, whose serverStatus lacks the default columns"`
+	Json           bool   `long:"json" description:"output as JSON rather than a formatted table"`
+	NDJSON         bool   `long:"ndjson" description:"output one JSON document per line for each host and polling interval, with raw metric values rather than formatted columns"`
+	Deprecated     bool   `long:"useDeprecatedJsonKeys" description:"use old key names; only valid with the json output option."`
+	Alert          string `long:"alert" value-name:"<field><op><threshold>[,...]" description:"fire an alert when a metric crosses a threshold, e.g. \"qrw>100,lag>10s\"; mongostat then exits with a non-zero status after its last line"`
+	AlertCmd       string `long:"alertCmd" value-name:"<command>|<url>" description:"program to run, or webhook URL to POST a JSON document to, when an alert fires; programs get the alert in MONGOSTAT_ALERT_* environment variables"`
+	AlertIntervals int    `long:"alertIntervals" value-name:"<count>" default:"1" description:"number of consecutive polling intervals a threshold must be crossed before its alert fires"`
+	Top            int    `long:"top" value-name:"<count>" description:"after each interval, show the <count> collections that spent the most time locked, from the top command"`
+	Record         string `long:"record" value-name:"<file>" description:"write every sample to a file that --replay can render later"`
+	Replay         string `long:"replay" value-name:"<file>" description:"render the samples written by --record instead of connecting to a server"`
+	OutFile        string `long:"outFile" value-name:"<file>" description:"append output to a file instead of writing it to stdout"`
+	RotateSize     string `long:"rotateSize" value-name:"<size>" description:"with --outFile, start a new file once the current one reaches a size such as 100MB; the previous file is renamed to <file>.1, and so on"`
+	RotateKeep     int    `long:"rotateKeep" value-name:"<count>" default:"5" description:"number of rotated files that --rotateSize keeps"`
+	Dashboard      bool   `long:"dashboard" description:"display a full-screen table of the hosts that can be sorted by any column, with sparklines of recent trends"`
+	Interactive    bool   `short:"i" long:"interactive" description:"display stats in a non-scrolling interface"`
 }
 
 // Name returns a human-readable group name for mongostat options.
@@ -64,6 +77,9 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 		interactiveOption.LongName = ""
 		interactiveOption.ShortName = 0
 	}
+	if _, available := stat_consumer.FormatterConstructors["dashboard"]; !available {
+		opts.FindOptionByLongName("dashboard").LongName = ""
+	}
 
 	args, err := opts.ParseArgs(rawArgs)
 	if err != nil {
@@ -185,3 +185,17 @@ func TestPositionalArgumentParsing(t *testing.T) {
 		}
 	})
 }
+
+func TestDiscoverInterval(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Shards are looked for every 10 seconds unless --discoverInterval says otherwise", t, func() {
+		opts, err := ParseOptions([]string{"--discover"}, "", "")
+		So(err, ShouldBeNil)
+		So(opts.DiscoverEvery, ShouldEqual, 10)
+
+		opts, err = ParseOptions([]string{"--discover", "--discoverInterval", "60"}, "", "")
+		So(err, ShouldBeNil)
+		So(opts.DiscoverEvery, ShouldEqual, 60)
+	})
+}
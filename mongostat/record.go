@@ -0,0 +1,124 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongostat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/mongostat/stat_consumer"
+	"github.com/huimingz/mongo-tools/mongostat/stat_consumer/line"
+	"github.com/huimingz/mongo-tools/mongostat/status"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RecordedSample is an entry of a --record file, which is a sequence of
+// BSON documents: either the status of a host or the error polling it.
+type RecordedSample struct {
+	Host        string                  `bson:"host"`
+	Error       string                  `bson:"error,omitempty"`
+	Status      *status.ServerStatus    `bson:"status,omitempty"`
+	OplogWindow time.Duration           `bson:"oplogWindow,omitempty"`
+	Top         map[string]status.NSTop `bson:"top,omitempty"`
+}
+
+// RecordingClusterMonitor is a ClusterMonitor that writes every sample it is
+// updated with to a --record file before passing it on.
+type RecordingClusterMonitor struct {
+	ClusterMonitor
+
+	out  io.Writer
+	lock sync.Mutex
+}
+
+// NewRecordingClusterMonitor wraps a ClusterMonitor to record its samples to out.
+func NewRecordingClusterMonitor(cluster ClusterMonitor, out io.Writer) *RecordingClusterMonitor {
+	return &RecordingClusterMonitor{ClusterMonitor: cluster, out: out}
+}
+
+// Update records the sample and passes it to the wrapped ClusterMonitor.
+func (recorder *RecordingClusterMonitor) Update(stat *status.ServerStatus, err *status.NodeError) {
+	sample := RecordedSample{Status: stat}
+	if err != nil {
+		sample = RecordedSample{Host: err.Host, Error: err.Error()}
+	} else if stat != nil {
+		sample.Host = stat.Host
+		sample.OplogWindow = stat.OplogWindow
+		sample.Top = stat.Top
+	}
+	if writeErr := recorder.write(sample); writeErr != nil {
+		log.Logvf(log.Always, "error writing to --record file: %v", writeErr)
+	}
+	recorder.ClusterMonitor.Update(stat, err)
+}
+
+func (recorder *RecordingClusterMonitor) write(sample RecordedSample) error {
+	doc, err := bson.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	_, err = recorder.out.Write(doc)
+	return err
+}
+
+// Replay renders the samples of a --record file with the consumer. Samples
+// are grouped into the intervals they were polled in: an interval ends when
+// a host it already has a sample for is sampled again.
+func Replay(in io.ReadCloser, consumer *stat_consumer.StatConsumer) error {
+	source := db.NewDecodedBSONSource(db.NewBSONSource(in))
+	defer source.Close()
+
+	var lines []*line.StatLine
+	seen := map[string]bool{}
+	flush := func() bool {
+		if len(lines) == 0 {
+			return false
+		}
+		done := consumer.FormatLines(lines)
+		lines, seen = nil, map[string]bool{}
+		return done
+	}
+
+	for {
+		var sample RecordedSample
+		if !source.Next(&sample) {
+			break
+		}
+		if seen[sample.Host] && flush() {
+			return nil
+		}
+		seen[sample.Host] = true
+
+		if sample.Error != "" {
+			lines = append(lines, &line.StatLine{
+				Error:  status.NewNodeError(sample.Host, errors.New(sample.Error)),
+				Fields: map[string]string{"host": sample.Host},
+			})
+			continue
+		}
+		if sample.Status == nil {
+			continue
+		}
+		sample.Status.OplogWindow = sample.OplogWindow
+		sample.Status.Top = sample.Top
+		if statLine, ok := consumer.Update(sample.Status); ok {
+			lines = append(lines, statLine)
+		}
+	}
+	if err := source.Err(); err != nil {
+		return fmt.Errorf("error reading --replay file: %v", err)
+	}
+	flush()
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongostat
+
+import (
+	"fmt"
+	"os"
+)
+
+// RotatingFile is a writer for --outFile. Once a write would take the file
+// past its maximum size, the file is renamed to <path>.1, older files are
+// shifted to <path>.2 and so on, and writing starts over in a new file.
+// Writes are never split, so every interval ends up whole in one file.
+type RotatingFile struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile opens a file to append to, which rotates once it reaches
+// maxSize bytes and keeps the given number of rotated files. A maxSize of 0
+// never rotates.
+func NewRotatingFile(path string, maxSize int64, keep int) (*RotatingFile, error) {
+	rf := &RotatingFile{path: path, maxSize: maxSize, keep: keep}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening --outFile: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error reading --outFile: %v", err)
+	}
+	rf.file, rf.size = file, info.Size()
+	return nil
+}
+
+// Write writes to the current file, rotating it first if needed.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return fmt.Errorf("error closing --outFile: %v", err)
+	}
+	if rf.keep < 1 {
+		if err := os.Remove(rf.path); err != nil {
+			return fmt.Errorf("error rotating --outFile: %v", err)
+		}
+		return rf.open()
+	}
+	os.Remove(fmt.Sprintf("%v.%v", rf.path, rf.keep))
+	for i := rf.keep - 1; i >= 1; i-- {
+		older := fmt.Sprintf("%v.%v", rf.path, i)
+		if _, err := os.Stat(older); err == nil {
+			if err = os.Rename(older, fmt.Sprintf("%v.%v", rf.path, i+1)); err != nil {
+				return fmt.Errorf("error rotating --outFile: %v", err)
+			}
+		}
+	}
+	if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+		return fmt.Errorf("error rotating --outFile: %v", err)
+	}
+	return rf.open()
+}
+
+// Close closes the current file.
+func (rf *RotatingFile) Close() error {
+	return rf.file.Close()
+}
@@ -0,0 +1,205 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/alert"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/mongostat/stat_consumer/line"
+)
+
+// AlertRule is a threshold given to --alert, such as "qrw>100" or "lag>10s".
+type AlertRule = alert.Rule
+
+// alertSyntax is the syntax of --alert: any column, and a number or a
+// duration such as 10s that is compared in seconds.
+var alertSyntax = alert.Syntax{
+	Fields:   `[^<>=\s]+`,
+	Expected: "<field><op><threshold> with op one of >, >=, <, <=",
+	Threshold: func(text string) (float64, error) {
+		if threshold, err := strconv.ParseFloat(text, 64); err == nil {
+			return threshold, nil
+		}
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return 0, errors.New("expected a number or a duration")
+		}
+		return duration.Seconds(), nil
+	},
+}
+
+// ParseAlertRules parses a comma-separated list of alert rules.
+func ParseAlertRules(spec string) ([]AlertRule, error) {
+	return alert.ParseRules(spec, alertSyntax)
+}
+
+// alertFields maps the column names that don't match a raw metric to a way
+// of computing one from the raw metrics.
+var alertFields = map[string]func(raw map[string]interface{}) (float64, bool){
+	"qrw":          sumOf("qr", "qw"),
+	"arw":          sumOf("ar", "aw"),
+	"lag":          sumOf("repl_lag_secs"),
+	"oplog_window": sumOf("oplog_window_secs"),
+	"net_in":       sumOf("net_in_bytes"),
+	"net_out":      sumOf("net_out_bytes"),
+	"vsize":        sumOf("vsize_bytes"),
+	"res":          sumOf("res_bytes"),
+	"cursor_to":    sumOf("cursors_timed_out"),
+	"fc_wait":      sumOf("fc_wait_ms"),
+	"dirty":        percentOf("cache_dirty_bytes", "cache_max_bytes"),
+	"used":         percentOf("cache_used_bytes", "cache_max_bytes"),
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func sumOf(keys ...string) func(raw map[string]interface{}) (float64, bool) {
+	return func(raw map[string]interface{}) (float64, bool) {
+		var sum float64
+		for _, key := range keys {
+			value, ok := toFloat(raw[key])
+			if !ok {
+				return 0, false
+			}
+			sum += value
+		}
+		return sum, true
+	}
+}
+
+func percentOf(key, outOfKey string) func(raw map[string]interface{}) (float64, bool) {
+	return func(raw map[string]interface{}) (float64, bool) {
+		value, ok := toFloat(raw[key])
+		outOf, outOfOk := toFloat(raw[outOfKey])
+		if !ok || !outOfOk || outOf == 0 {
+			return 0, false
+		}
+		return 100 * value / outOf, true
+	}
+}
+
+// metricValue returns the value of a column in a StatLine's raw metrics.
+func metricValue(field string, raw map[string]interface{}) (float64, bool) {
+	if compute, ok := alertFields[field]; ok {
+		return compute(raw)
+	}
+	return toFloat(raw[field])
+}
+
+// Alert describes a breached threshold, as it is sent to --alertCmd.
+type Alert struct {
+	Host  string    `json:"host"`
+	Rule  string    `json:"rule"`
+	Value float64   `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// Alerter checks the alert rules against every StatLine and fires an alert
+// when a rule is breached by a host for the given number of consecutive
+// intervals.
+type Alerter struct {
+	rules   []AlertRule
+	command string
+	streaks *alert.Streaks
+	fired   bool
+
+	// notify sends an alert to the command; replaced in tests
+	notify func(alert Alert) error
+}
+
+// NewAlerter creates an Alerter that runs command, a program or a webhook
+// URL, for each alert.
+func NewAlerter(rules []AlertRule, intervals int, command string) *Alerter {
+	alerter := &Alerter{
+		rules:   rules,
+		command: command,
+		streaks: alert.NewStreaks(intervals),
+	}
+	alerter.notify = alerter.runCommand
+	return alerter
+}
+
+// Fired reports whether any alert has fired.
+func (a *Alerter) Fired() bool {
+	return a.fired
+}
+
+// Check checks the rules against the StatLines of an interval and returns the
+// alerts that fired. Lines that were already checked are skipped.
+func (a *Alerter) Check(lines []*line.StatLine) []Alert {
+	var alerts []Alert
+	for _, l := range lines {
+		if l.Printed || l.Error != nil || l.Raw == nil {
+			continue
+		}
+		host := l.Fields["host"]
+		for _, rule := range a.rules {
+			value, ok := metricValue(rule.Field, l.Raw)
+			if !a.streaks.Update(host, rule, ok && rule.Breached(value)) {
+				continue
+			}
+			fired := Alert{Host: host, Rule: rule.String(), Value: value, Time: time.Now()}
+			alerts = append(alerts, fired)
+			a.fired = true
+			log.Logvf(log.Always, "alert: %v on %v (value %v)", rule, host, value)
+			if a.command != "" {
+				if err := a.notify(fired); err != nil {
+					log.Logvf(log.Always, "error running --alertCmd: %v", err)
+				}
+			}
+		}
+	}
+	return alerts
+}
+
+// runCommand posts the alert as JSON to a webhook URL, or runs a program
+// with the alert in MONGOSTAT_ALERT_* environment variables.
+func (a *Alerter) runCommand(fired Alert) error {
+	if strings.HasPrefix(a.command, "http://") || strings.HasPrefix(a.command, "https://") {
+		body, err := json.Marshal(fired)
+		if err != nil {
+			return err
+		}
+		client := http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Post(a.command, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned %v", resp.Status)
+		}
+		return nil
+	}
+
+	return alert.RunCommand(a.command,
+		"MONGOSTAT_ALERT_HOST="+fired.Host,
+		"MONGOSTAT_ALERT_RULE="+fired.Rule,
+		fmt.Sprintf("MONGOSTAT_ALERT_VALUE=%v", fired.Value),
+		"MONGOSTAT_ALERT_TIME="+fired.Time.Format(time.RFC3339),
+	)
+}
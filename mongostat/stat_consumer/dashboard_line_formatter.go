@@ -0,0 +1,237 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// +build !solaris
+
+package stat_consumer
+
+import (
+	"fmt"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/huimingz/mongo-tools/mongostat/stat_consumer/line"
+	"github.com/nsf/termbox-go"
+)
+
+// trendLength is the number of intervals a dashboard sparkline covers
+const trendLength = 30
+
+// DashboardLineFormatter shows a full-screen table with a row per host that
+// can be sorted by any column, and a sparkline of the recent trend of one
+// column for each host
+type DashboardLineFormatter struct {
+	*limitableFormatter
+
+	lines      []*line.StatLine
+	headerKeys []string
+	keyNames   map[string]string
+
+	// raw metrics of the latest intervals, by host
+	history map[string][]map[string]interface{}
+
+	sortCol    int
+	descending bool
+	trendKey   string
+	showHelp   bool
+	sync.Mutex
+}
+
+func NewDashboardLineFormatter(_ int64, _ bool) LineFormatter {
+	dlf := &DashboardLineFormatter{
+		limitableFormatter: &limitableFormatter{maxRows: 1},
+		history:            map[string][]map[string]interface{}{},
+	}
+	if err := termbox.Init(); err != nil {
+		fmt.Printf("Error setting up terminal UI: %v", err)
+		panic("could not set up dashboard terminal interface")
+	}
+
+	go func() {
+		for {
+			dlf.handleEvent(termbox.PollEvent())
+			dlf.update()
+		}
+	}()
+	return dlf
+}
+
+func init() {
+	FormatterConstructors["dashboard"] = NewDashboardLineFormatter
+}
+
+func (dlf *DashboardLineFormatter) Finish() {
+	termbox.Close()
+}
+
+// FormatLines keeps the StatLines of the interval and redraws the dashboard
+func (dlf *DashboardLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []string, keyNames map[string]string) string {
+	defer dlf.update() // so that it runs after the unlock, because update locks again
+	dlf.Lock()
+	defer dlf.Unlock()
+
+	dlf.lines = lines
+	dlf.headerKeys = headerKeys
+	dlf.keyNames = keyNames
+	if dlf.sortCol >= len(headerKeys) {
+		dlf.sortCol = 0
+	}
+	if dlf.trendKey == "" {
+		dlf.trendKey = defaultTrendKey(headerKeys)
+	}
+
+	for _, l := range lines {
+		if l.Printed || l.Error != nil || l.Raw == nil {
+			continue
+		}
+		host := l.Fields["host"]
+		history := append(dlf.history[host], l.Raw)
+		if len(history) > trendLength {
+			history = history[len(history)-trendLength:]
+		}
+		dlf.history[host] = history
+	}
+	for _, l := range lines {
+		l.Printed = true
+	}
+	return ""
+}
+
+// defaultTrendKey picks the column the sparklines show until another is chosen
+func defaultTrendKey(headerKeys []string) string {
+	for _, preferred := range []string{"command", "query", "insert", "conn"} {
+		for _, key := range headerKeys {
+			if key == preferred {
+				return key
+			}
+		}
+	}
+	if len(headerKeys) > 0 {
+		return headerKeys[len(headerKeys)-1]
+	}
+	return ""
+}
+
+// trend returns the sparkline of the trend column for a host
+func (dlf *DashboardLineFormatter) trend(host string) string {
+	var values []float64
+	for _, raw := range dlf.history[host] {
+		if value, ok := metricValue(dlf.trendKey, raw); ok {
+			values = append(values, value)
+		}
+	}
+	return Sparkline(values)
+}
+
+func (dlf *DashboardLineFormatter) handleEvent(ev termbox.Event) {
+	dlf.Lock()
+	defer dlf.Unlock()
+	if ev.Type != termbox.EventKey {
+		return
+	}
+
+	switch {
+	case ev.Key == termbox.KeyCtrlC, ev.Key == termbox.KeyEsc, ev.Ch == 'q':
+		// our max rowCount is set to 1; increment to exit
+		dlf.increment()
+	case ev.Key == termbox.KeyArrowRight, ev.Ch == 'l':
+		if dlf.sortCol+1 < len(dlf.headerKeys) {
+			dlf.sortCol++
+		}
+	case ev.Key == termbox.KeyArrowLeft, ev.Ch == 'h':
+		if dlf.sortCol > 0 {
+			dlf.sortCol--
+		}
+	case ev.Ch == 'o':
+		dlf.descending = !dlf.descending
+	case ev.Ch == 't':
+		if dlf.sortCol < len(dlf.headerKeys) {
+			dlf.trendKey = dlf.headerKeys[dlf.sortCol]
+		}
+	case ev.Ch == 'r':
+		termbox.Sync()
+	case ev.Ch == '?':
+		dlf.showHelp = !dlf.showHelp
+	default:
+		// output a bell on unknown inputs
+		fmt.Printf("\a")
+	}
+}
+
+const dashboardHelpMessage = `
+Exit: 'q' or <Esc>
+Sorting: arrow keys or 'h' and 'l' to pick the column
+         'o' to switch between ascending and descending order
+Trend: 't' to show the trend of the sorted column
+Redraw: 'r' to fix broken-looking output`
+
+func (dlf *DashboardLineFormatter) update() {
+	dlf.Lock()
+	defer dlf.Unlock()
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	if len(dlf.headerKeys) == 0 {
+		termbox.Flush()
+		return
+	}
+
+	lines := append([]*line.StatLine(nil), dlf.lines...)
+	SortLines(lines, dlf.headerKeys[dlf.sortCol], dlf.descending)
+
+	order := "ascending"
+	if dlf.descending {
+		order = "descending"
+	}
+	writeString(0, 0, fmt.Sprintf("sorted by %v (%v), trend of %v",
+		dlf.keyNames[dlf.headerKeys[dlf.sortCol]], order, dlf.keyNames[dlf.trendKey]),
+		termbox.ColorWhite|termbox.AttrBold, termbox.ColorDefault)
+
+	// one column per header, then the trend
+	widths := make([]int, len(dlf.headerKeys))
+	for i, key := range dlf.headerKeys {
+		widths[i] = utf8.RuneCountInString(dlf.keyNames[key])
+		for _, l := range lines {
+			if w := utf8.RuneCountInString(l.Fields[key]); l.Error == nil && w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	x := 0
+	for i, key := range dlf.headerKeys {
+		fg, bg := termbox.ColorWhite|termbox.AttrBold|termbox.AttrUnderline, termbox.ColorDefault
+		if i == dlf.sortCol {
+			fg, bg = termbox.ColorBlack, termbox.ColorWhite
+		}
+		header := dlf.keyNames[key]
+		writeString(x+widths[i]-utf8.RuneCountInString(header), 2, header, fg, bg)
+		x += widths[i] + 1
+	}
+	writeString(x+1, 2, "trend", termbox.ColorWhite|termbox.AttrBold|termbox.AttrUnderline, termbox.ColorDefault)
+
+	for j, l := range lines {
+		y := 3 + j
+		if l.Error != nil {
+			writeString(0, y, fmt.Sprintf("%s: %s", l.Fields["host"], l.Error), termbox.ColorRed, termbox.ColorDefault)
+			continue
+		}
+		x = 0
+		for i, key := range dlf.headerKeys {
+			text := l.Fields[key]
+			writeString(x+widths[i]-utf8.RuneCountInString(text), y, text, termbox.ColorWhite, termbox.ColorDefault)
+			x += widths[i] + 1
+		}
+		for k, ch := range []rune(dlf.trend(l.Fields["host"])) {
+			termbox.SetCell(x+1+k, y, ch, termbox.ColorGreen, termbox.ColorDefault)
+		}
+	}
+
+	y := 4 + len(lines)
+	writeString(0, y, helpPrompt, termbox.ColorWhite, termbox.ColorDefault)
+	if dlf.showHelp {
+		writeString(0, y+1, dashboardHelpMessage, termbox.ColorWhite, termbox.ColorDefault)
+	}
+	termbox.Flush()
+}
@@ -112,5 +112,29 @@ func (glf *GridLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []s
 		gridLine = fmt.Sprintf("\n%s", gridLine)
 	}
 	glf.increment()
-	return gridLine
+	return gridLine + formatTopGrid(lines)
+}
+
+// formatTopGrid formats the busiest namespaces of each StatLine, for --top
+func formatTopGrid(lines []*line.StatLine) string {
+	buf := &bytes.Buffer{}
+	for _, l := range lines {
+		if l.Error != nil || len(l.Top) == 0 {
+			continue
+		}
+		out := &text.GridWriter{ColumnPadding: 4}
+		out.WriteCells("", "ns", "total", "read", "write", "ops")
+		out.EndRow()
+		for _, ns := range l.Top {
+			out.WriteCells("", ns.Namespace,
+				fmt.Sprintf("%vms", ns.TotalMs),
+				fmt.Sprintf("%vms", ns.ReadMs),
+				fmt.Sprintf("%vms", ns.WriteMs),
+				fmt.Sprintf("%v", ns.Ops))
+			out.EndRow()
+		}
+		fmt.Fprintf(buf, "busiest collections on %v:\n", l.Fields["host"])
+		out.Flush(buf)
+	}
+	return buf.String()
 }
@@ -54,6 +54,9 @@ func (jlf *JSONLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []s
 		for _, key := range headerKeys {
 			lineJson[keyNames[key]] = l.Fields[key]
 		}
+		if len(l.Top) > 0 {
+			lineJson["top"] = l.Top
+		}
 		jsonFormat[l.Fields["host"]] = lineJson
 	}
 
@@ -15,6 +15,12 @@ type StatLine struct {
 	Fields  map[string]string
 	Error   error
 	Printed bool
+
+	// Raw holds the unformatted metric values when the ReaderConfig asks for them
+	Raw map[string]interface{}
+
+	// Top holds the busiest namespaces of the interval when the ReaderConfig asks for them
+	Top []status.CollectionActivity
 }
 
 type StatLines []*StatLine
@@ -47,5 +53,15 @@ func NewStatLine(oldStat, newStat *status.ServerStatus, headerKeys []string, c *
 	// We always need host and storage_engine, even if they aren't being displayed
 	line.Fields["host"] = StatHeaders["host"].ReadField(c, newStat, oldStat)
 	line.Fields["storage_engine"] = StatHeaders["storage_engine"].ReadField(c, newStat, oldStat)
+
+	if c.Raw {
+		line.Raw = status.RawMetrics(newStat, oldStat)
+		for _, key := range headerKeys {
+			if _, ok := StatHeaders[key]; !ok {
+				line.Raw[key] = status.InterpretRawField(key, newStat, oldStat)
+			}
+		}
+	}
+	line.Top = status.BusiestCollections(newStat, oldStat, c.Top)
 	return line
 }
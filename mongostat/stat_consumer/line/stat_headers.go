@@ -20,6 +20,7 @@ const (
 	FlagAll                  // only active if mongostat was run with --all option
 	FlagMMAP                 // only active if node has mmap-specific fields
 	FlagWT                   // only active if node has wiredtiger-specific fields
+	FlagMinimal              // use the MinimalHeaders layout instead of CondHeaders
 )
 
 // StatHeader describes a single column for mongostat's terminal output,
@@ -43,6 +44,15 @@ var (
 		"command":        {"command", "Command opcounter (diff)", "command"},
 		"dirty":          {"dirty", "Cache dirty (percentage)", "% dirty"},
 		"used":           {"used", "Cache used (percentage)", "% used"},
+		"cache_bytes":    {"cache_bytes", "Cache used (size)", "cache bytes"},
+		"cache_dirty":    {"cache_dirty", "Cache dirty (size)", "cache dirty"},
+		"evicted":        {"evicted", "Cache pages evicted (diff)", "evicted"},
+		"ckpt_time":      {"ckpt_time", "Duration of the most recent checkpoint", "ckpt time"},
+		"cursors":        {"cursors", "Open cursors, total|pinned", "cursors"},
+		"cursor_to":      {"cursor_to", "Cursors timed out (diff)", "cursor timeouts"},
+		"txn":            {"txn", "Transactions, active|committed|aborted (diff)", "txn"},
+		"fc_lagged":      {"fc_lagged", "Flow control is throttling writes", "flow lagged"},
+		"fc_wait":        {"fc_wait", "Time waiting for flow control, ms (diff)", "flow wait"},
 		"flushes":        {"flushes", "Number of flushes (diff)", "flushes"},
 		"mapped":         {"mapped", "Mapped (size)", "mapped"},
 		"vsize":          {"vsize", "Virtual (size)", "vsize"},
@@ -59,6 +69,8 @@ var (
 		"conn":           {"conn", "Current connection count", "conn"},
 		"set":            {"set", "FlagReplica set name", "set"},
 		"repl":           {"repl", "FlagReplica set type", "repl"},
+		"lag":            {"lag", "Replication lag behind the primary", "repl lag"},
+		"oplog_window":   {"oplog_window", "Oplog window of the primary", "oplog window"},
 		"time":           {"time", "Time of sample", "time"},
 	}
 	StatHeaders = map[string]StatHeader{
@@ -72,6 +84,15 @@ var (
 		"command":        {status.ReadCommand},
 		"dirty":          {status.ReadDirty},
 		"used":           {status.ReadUsed},
+		"cache_bytes":    {status.ReadCacheBytes},
+		"cache_dirty":    {status.ReadCacheDirtyBytes},
+		"evicted":        {status.ReadEvicted},
+		"ckpt_time":      {status.ReadCheckpointTime},
+		"cursors":        {status.ReadCursors},
+		"cursor_to":      {status.ReadCursorTimeouts},
+		"txn":            {status.ReadTransactions},
+		"fc_lagged":      {status.ReadFlowControlLagged},
+		"fc_wait":        {status.ReadFlowControlWait},
 		"flushes":        {status.ReadFlushes},
 		"mapped":         {status.ReadMapped},
 		"vsize":          {status.ReadVSize},
@@ -88,6 +109,8 @@ var (
 		"conn":           {status.ReadConn},
 		"set":            {status.ReadSet},
 		"repl":           {status.ReadRepl},
+		"lag":            {status.ReadReplLag},
+		"oplog_window":   {status.ReadOplogWindow},
 		"time":           {status.ReadTime},
 	}
 	CondHeaders = []struct {
@@ -103,6 +126,15 @@ var (
 		{"command", FlagAlways},
 		{"dirty", FlagWT},
 		{"used", FlagWT},
+		{"cache_bytes", FlagWT | FlagAll},
+		{"cache_dirty", FlagWT | FlagAll},
+		{"evicted", FlagWT | FlagAll},
+		{"ckpt_time", FlagWT | FlagAll},
+		{"cursors", FlagAll},
+		{"cursor_to", FlagAll},
+		{"txn", FlagAll},
+		{"fc_lagged", FlagRepl | FlagAll},
+		{"fc_wait", FlagRepl | FlagAll},
 		{"flushes", FlagAlways},
 		{"mapped", FlagMMAP},
 		{"vsize", FlagAlways},
@@ -119,6 +151,30 @@ var (
 		{"conn", FlagAlways},
 		{"set", FlagRepl},
 		{"repl", FlagRepl},
+		{"lag", FlagRepl | FlagDiscover},
+		{"oplog_window", FlagRepl | FlagDiscover},
+		{"time", FlagAlways},
+	}
+	// MinimalHeaders is the --minimal column layout, made of the metrics
+	// that every deployment reports, including Atlas serverless instances
+	// and users whose roles limit serverStatus. mongostat falls back to it
+	// when a node doesn't report what the default layout needs.
+	MinimalHeaders = []struct {
+		Key  string
+		Flag int
+	}{
+		{"host", FlagHosts},
+		{"insert", FlagAlways},
+		{"query", FlagAlways},
+		{"update", FlagAlways},
+		{"delete", FlagAlways},
+		{"getmore", FlagAlways},
+		{"command", FlagAlways},
+		{"net_in", FlagAlways},
+		{"net_out", FlagAlways},
+		{"conn", FlagAlways},
+		{"set", FlagRepl},
+		{"repl", FlagRepl},
 		{"time", FlagAlways},
 	}
 )
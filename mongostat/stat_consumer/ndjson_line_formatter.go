@@ -0,0 +1,78 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/huimingz/mongo-tools/mongostat/stat_consumer/line"
+)
+
+// NDJSONLineFormatter converts each StatLine to a line of JSON with the raw
+// metric values, rather than the formatted columns
+type NDJSONLineFormatter struct {
+	*limitableFormatter
+}
+
+func NewNDJSONLineFormatter(maxRows int64, _ bool) LineFormatter {
+	return &NDJSONLineFormatter{
+		limitableFormatter: &limitableFormatter{maxRows: maxRows},
+	}
+}
+
+func init() {
+	FormatterConstructors["ndjson"] = NewNDJSONLineFormatter
+}
+
+func (nlf *NDJSONLineFormatter) Finish() {
+}
+
+// FormatLines formats each StatLine as a JSON document on its own line
+func (nlf *NDJSONLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []string, keyNames map[string]string) string {
+	buf := &bytes.Buffer{}
+	sort.Sort(line.StatLines(lines))
+
+	for _, l := range lines {
+		if l.Printed && l.Error == nil {
+			l.Error = fmt.Errorf("no data received")
+		}
+		l.Printed = true
+
+		doc := map[string]interface{}{}
+		if l.Error != nil {
+			doc["host"] = l.Fields["host"]
+			doc["error"] = l.Error.Error()
+		} else {
+			for key, value := range l.Raw {
+				doc[key] = value
+			}
+			// custom -o fields are named as the user asked
+			for _, key := range headerKeys {
+				if _, builtin := line.StatHeaders[key]; !builtin && keyNames[key] != "" && keyNames[key] != key {
+					doc[keyNames[key]] = doc[key]
+					delete(doc, key)
+				}
+			}
+			if len(l.Top) > 0 {
+				doc["top"] = l.Top
+			}
+		}
+
+		docBytes, err := json.Marshal(doc)
+		if err != nil {
+			docBytes = []byte(fmt.Sprintf(`{"json error": %q}`, err.Error()))
+		}
+		buf.Write(docBytes)
+		buf.WriteByte('\n')
+	}
+
+	nlf.increment()
+	return buf.String()
+}
@@ -0,0 +1,64 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"sort"
+
+	"github.com/huimingz/mongo-tools/mongostat/stat_consumer/line"
+)
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline draws values as a row of bars scaled between their minimum and
+// maximum.
+func Sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	min, max := values[0], values[0]
+	for _, value := range values {
+		if value < min {
+			min = value
+		}
+		if value > max {
+			max = value
+		}
+	}
+	spark := make([]rune, len(values))
+	for i, value := range values {
+		tick := 0
+		if max > min {
+			tick = int((value - min) / (max - min) * float64(len(sparkTicks)-1))
+		}
+		spark[i] = sparkTicks[tick]
+	}
+	return string(spark)
+}
+
+// SortLines orders StatLines by a column: numerically by its raw metric when
+// the lines have one, and by its formatted value otherwise. Lines with errors
+// go last, and ties are broken by host.
+func SortLines(lines []*line.StatLine, key string, descending bool) {
+	sort.SliceStable(lines, func(i, j int) bool {
+		a, b := lines[i], lines[j]
+		if (a.Error != nil) != (b.Error != nil) {
+			return b.Error != nil
+		}
+		aValue, aOk := metricValue(key, a.Raw)
+		bValue, bOk := metricValue(key, b.Raw)
+		if aOk && bOk && aValue != bValue {
+			return (aValue < bValue) != descending
+		}
+		if !aOk || !bOk {
+			if a.Fields[key] != b.Fields[key] {
+				return (a.Fields[key] < b.Fields[key]) != descending
+			}
+		}
+		return a.Fields["host"] < b.Fields["host"]
+	})
+}
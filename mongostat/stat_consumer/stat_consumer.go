@@ -10,7 +10,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/huimingz/mongo-tools/common/log"
 	"github.com/huimingz/mongo-tools/common/util"
 	"github.com/huimingz/mongo-tools/mongostat/stat_consumer/line"
 	"github.com/huimingz/mongo-tools/mongostat/status"
@@ -27,6 +30,12 @@ type StatConsumer struct {
 	keyNames               map[string]string
 	writer                 io.Writer
 	flags                  int
+
+	// time of the latest write on the primary of each replica set, by set name
+	primaryWrites map[string]time.Time
+
+	// checks the --alert thresholds, if any
+	alerter *Alerter
 }
 
 // NewStatConsumer creates a new StatConsumer with no previous records
@@ -35,6 +44,7 @@ func NewStatConsumer(flags int, customHeaders []string, keyNames map[string]stri
 		formatter:     formatter,
 		readerConfig:  readerConfig,
 		oldStats:      make(map[string]*status.ServerStatus),
+		primaryWrites: make(map[string]time.Time),
 		customHeaders: customHeaders,
 		keyNames:      keyNames,
 		writer:        writer,
@@ -48,6 +58,7 @@ func NewStatConsumer(flags int, customHeaders []string, keyNames map[string]stri
 
 // Update takes in a ServerStatus and returns a StatLine if it has a previous record
 func (sc *StatConsumer) Update(newStat *status.ServerStatus) (l *line.StatLine, seen bool) {
+	sc.trackPrimaryWrites(newStat)
 	oldStat, seen := sc.oldStats[newStat.Host]
 	sc.oldStats[newStat.Host] = newStat
 	if seen {
@@ -56,6 +67,11 @@ func (sc *StatConsumer) Update(newStat *status.ServerStatus) (l *line.StatLine,
 	}
 
 	if sc.flags != 0 {
+		if missing := status.MissingSections(newStat); len(missing) > 0 && sc.flags&line.FlagMinimal == 0 {
+			log.Logvf(log.Always, "%v does not report %v in serverStatus; showing the --minimal columns",
+				newStat.Host, strings.Join(missing, ", "))
+			sc.flags |= line.FlagMinimal
+		}
 		if status.IsMMAP(newStat) {
 			sc.flags |= line.FlagMMAP
 		} else if status.IsWT(newStat) {
@@ -69,8 +85,12 @@ func (sc *StatConsumer) Update(newStat *status.ServerStatus) (l *line.StatLine,
 		}
 
 		// Modify headers
+		conds := line.CondHeaders
+		if sc.flags&line.FlagMinimal != 0 {
+			conds = line.MinimalHeaders
+		}
 		sc.headers = []string{}
-		for _, desc := range line.CondHeaders {
+		for _, desc := range conds {
 			if desc.Flag&sc.flags == desc.Flag {
 				sc.headers = append(sc.headers, desc.Key)
 			}
@@ -80,9 +100,30 @@ func (sc *StatConsumer) Update(newStat *status.ServerStatus) (l *line.StatLine,
 	return
 }
 
+// trackPrimaryWrites records the latest write of a primary, and gives the
+// latest write of its primary to a secondary so its lag can be computed.
+func (sc *StatConsumer) trackPrimaryWrites(stat *status.ServerStatus) {
+	if stat.Repl == nil || stat.Repl.SetName == "" {
+		return
+	}
+	if status.IsPrimary(stat) && stat.Repl.LastWrite != nil {
+		sc.primaryWrites[stat.Repl.SetName] = stat.Repl.LastWrite.LastWriteDate
+		return
+	}
+	stat.PrimaryLastWrite = sc.primaryWrites[stat.Repl.SetName]
+}
+
+// SetAlerter makes the StatConsumer check the StatLines it formats for alerts.
+func (sc *StatConsumer) SetAlerter(alerter *Alerter) {
+	sc.alerter = alerter
+}
+
 // FormatLines consumes StatLines, formats them, and sends them to its writer
 // It returns true if the formatter should no longer receive data
 func (sc *StatConsumer) FormatLines(lines []*line.StatLine) bool {
+	if sc.alerter != nil {
+		sc.alerter.Check(lines)
+	}
 	str := sc.formatter.FormatLines(lines, sc.headers, sc.keyNames)
 	_, err := fmt.Fprintf(sc.writer, "%s", str)
 	if err != nil {
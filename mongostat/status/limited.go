@@ -0,0 +1,71 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DecodeServerStatus decodes the output of serverStatus. Deployments such as
+// Atlas serverless instances report some sections in a different shape than
+// a mongod does; rather than fail, each top-level section that can't be read
+// is left out and its name returned in skipped.
+func DecodeServerStatus(raw bson.Raw) (stat *ServerStatus, skipped []string, err error) {
+	stat = &ServerStatus{}
+	if err = bson.Unmarshal(raw, stat); err == nil {
+		return stat, nil, nil
+	}
+
+	elements, err := raw.Elements()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading serverStatus: %v", err)
+	}
+	stat = &ServerStatus{}
+	for _, element := range elements {
+		section := bson.D{{element.Key(), element.Value()}}
+		doc, err := bson.Marshal(section)
+		if err != nil {
+			skipped = append(skipped, element.Key())
+			continue
+		}
+		// decode into a scratch value first so that a section that fails
+		// partway leaves nothing behind
+		if err = bson.Unmarshal(doc, &ServerStatus{}); err != nil {
+			skipped = append(skipped, element.Key())
+			continue
+		}
+		if err = bson.Unmarshal(doc, stat); err != nil {
+			return nil, nil, fmt.Errorf("error reading serverStatus: %v", err)
+		}
+	}
+	return stat, skipped, nil
+}
+
+// MissingSections returns the sections of serverStatus that the default
+// column layout can't show without and that the node doesn't report, as
+// happens on Atlas serverless instances and for users whose roles limit
+// serverStatus. globalLock is not one of them: qrw and arw read a missing
+// globalLock as no queued or active operations, as they always have.
+func MissingSections(stat *ServerStatus) (missing []string) {
+	sections := []struct {
+		name    string
+		present bool
+	}{
+		{"opcounters", stat.Opcounters != nil},
+		{"mem", stat.Mem != nil},
+		{"network", stat.Network != nil},
+		{"connections", stat.Connections != nil},
+	}
+	for _, section := range sections {
+		if !section.present {
+			missing = append(missing, section.name)
+		}
+	}
+	return
+}
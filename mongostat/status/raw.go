@@ -0,0 +1,124 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"github.com/huimingz/mongo-tools/common/util"
+)
+
+// RawMetrics returns the metrics behind mongostat's columns as unformatted
+// values, for --ndjson: operation and network rates are per second, and
+// memory and cache sizes are in bytes.
+func RawMetrics(newStat, oldStat *ServerStatus) map[string]interface{} {
+	sampleSecs := newStat.SampleTime.Sub(oldStat.SampleTime).Seconds()
+	raw := map[string]interface{}{
+		"host":           newStat.Host,
+		"storage_engine": getStorageEngine(newStat),
+		"time":           newStat.SampleTime,
+		"sample_secs":    sampleSecs,
+	}
+
+	addOpcounters := func(prefix string, newOps, oldOps *OpcountStats) {
+		if newOps == nil || oldOps == nil {
+			return
+		}
+		raw[prefix+"insert"] = diff(newOps.Insert, oldOps.Insert, sampleSecs)
+		raw[prefix+"query"] = diff(newOps.Query, oldOps.Query, sampleSecs)
+		raw[prefix+"update"] = diff(newOps.Update, oldOps.Update, sampleSecs)
+		raw[prefix+"delete"] = diff(newOps.Delete, oldOps.Delete, sampleSecs)
+		raw[prefix+"getmore"] = diff(newOps.GetMore, oldOps.GetMore, sampleSecs)
+		raw[prefix+"command"] = diff(newOps.Command, oldOps.Command, sampleSecs)
+	}
+	addOpcounters("", newStat.Opcounters, oldStat.Opcounters)
+	addOpcounters("repl_", newStat.OpcountersRepl, oldStat.OpcountersRepl)
+
+	if newStat.WiredTiger != nil {
+		raw["cache_dirty_bytes"] = newStat.WiredTiger.Cache.TrackedDirtyBytes
+		raw["cache_used_bytes"] = newStat.WiredTiger.Cache.CurrentCachedBytes
+		raw["cache_max_bytes"] = newStat.WiredTiger.Cache.MaxBytesConfigured
+		raw["checkpoint_ms"] = newStat.WiredTiger.Transaction.CheckpointMostRecentMs
+		if oldStat.WiredTiger != nil {
+			raw["evicted"] = diff(pagesEvicted(newStat), pagesEvicted(oldStat), sampleSecs)
+		}
+	}
+	if newStat.Metrics != nil && newStat.Metrics.Cursor != nil {
+		raw["cursors_open"] = newStat.Metrics.Cursor.Open.Total
+		raw["cursors_pinned"] = newStat.Metrics.Cursor.Open.Pinned
+	}
+	if newStat.Metrics != nil && newStat.Metrics.Cursor != nil && oldStat.Metrics != nil && oldStat.Metrics.Cursor != nil {
+		raw["cursors_timed_out"] = newStat.Metrics.Cursor.TimedOut - oldStat.Metrics.Cursor.TimedOut
+	}
+	if newStat.Transactions != nil && oldStat.Transactions != nil {
+		raw["txn_active"] = newStat.Transactions.CurrentActive
+		raw["txn_committed"] = diff(newStat.Transactions.TotalCommitted, oldStat.Transactions.TotalCommitted, sampleSecs)
+		raw["txn_aborted"] = diff(newStat.Transactions.TotalAborted, oldStat.Transactions.TotalAborted, sampleSecs)
+	}
+	if newStat.FlowControl != nil && newStat.FlowControl.Enabled {
+		raw["fc_lagged"] = newStat.FlowControl.IsLagged
+		if oldStat.FlowControl != nil {
+			raw["fc_wait_ms"] = diff(newStat.FlowControl.TimeAcquiringMicros, oldStat.FlowControl.TimeAcquiringMicros, sampleSecs) / 1000
+		}
+	}
+	if newStat.WiredTiger != nil && oldStat.WiredTiger != nil {
+		raw["flushes"] = newStat.WiredTiger.Transaction.TransCheckpoints - oldStat.WiredTiger.Transaction.TransCheckpoints
+	} else if newStat.BackgroundFlushing != nil && oldStat.BackgroundFlushing != nil {
+		raw["flushes"] = newStat.BackgroundFlushing.Flushes - oldStat.BackgroundFlushing.Flushes
+	}
+
+	if newStat.Mem != nil && util.IsTruthy(newStat.Mem.Supported) {
+		raw["vsize_bytes"] = newStat.Mem.Virtual * 1024 * 1024
+		raw["res_bytes"] = newStat.Mem.Resident * 1024 * 1024
+		if IsMMAP(newStat) {
+			raw["mapped_bytes"] = newStat.Mem.Mapped * 1024 * 1024
+		}
+	}
+	if oldStat.ExtraInfo != nil && newStat.ExtraInfo != nil &&
+		oldStat.ExtraInfo.PageFaults != nil && newStat.ExtraInfo.PageFaults != nil {
+		raw["faults"] = diff(*newStat.ExtraInfo.PageFaults, *oldStat.ExtraInfo.PageFaults, sampleSecs)
+	}
+
+	raw["qr"], raw["qw"] = queuedOps(newStat)
+	raw["ar"], raw["aw"] = activeOps(newStat)
+	if newStat.Network != nil && oldStat.Network != nil {
+		raw["net_in_bytes"] = diff(newStat.Network.BytesIn, oldStat.Network.BytesIn, sampleSecs)
+		raw["net_out_bytes"] = diff(newStat.Network.BytesOut, oldStat.Network.BytesOut, sampleSecs)
+	}
+	if newStat.Connections != nil {
+		raw["conn"] = newStat.Connections.Current
+	}
+	if IsReplSet(newStat) || IsMongos(newStat) {
+		raw["set"] = ReadSet(nil, newStat, oldStat)
+		raw["repl"] = ReadRepl(nil, newStat, oldStat)
+	}
+	if lag, ok := replLag(newStat); ok {
+		raw["repl_lag_secs"] = lag.Seconds()
+	}
+	if newStat.OplogWindow > 0 {
+		raw["oplog_window_secs"] = newStat.OplogWindow.Seconds()
+	}
+	return raw
+}
+
+// InterpretRawField is InterpretField for --ndjson: it returns the value of
+// a custom -o field without formatting it, or nil if it isn't available.
+func InterpretRawField(field string, newStat, oldStat *ServerStatus) interface{} {
+	match := literalRE.FindStringSubmatch(field)
+	if len(match) == 4 {
+		switch match[3] {
+		case "diff", "rate":
+			d, ok := statDiff(match[1], newStat, oldStat)
+			if !ok {
+				return nil
+			}
+			if match[3] == "rate" {
+				return diff(d, 0, newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
+			}
+			return d
+		}
+	}
+	return newStat.Flattened[field]
+}
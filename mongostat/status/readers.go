@@ -19,6 +19,12 @@ import (
 type ReaderConfig struct {
 	HumanReadable bool
 	TimeFormat    string
+
+	// Raw makes StatLines carry unformatted metric values, for --ndjson
+	Raw bool
+
+	// Top is the number of busiest namespaces StatLines carry, for --top
+	Top int
 }
 
 type LockUsage struct {
@@ -48,6 +54,13 @@ func formatBits(should bool, amt int64) string {
 	return fmt.Sprintf("%v", amt)
 }
 
+func formatBytes(should bool, amt int64) string {
+	if should {
+		return text.FormatByteAmount(amt)
+	}
+	return fmt.Sprintf("%v", amt)
+}
+
 func formatMegabyteAmount(should bool, amt int64) string {
 	if should {
 		return text.FormatMegabyteAmount(amt)
@@ -168,6 +181,11 @@ func IsReplSet(stat *ServerStatus) (res bool) {
 	return
 }
 
+// memSupported reports whether the node reports its memory use.
+func memSupported(stat *ServerStatus) bool {
+	return stat.Mem != nil && util.IsTruthy(stat.Mem.Supported)
+}
+
 func IsMMAP(stat *ServerStatus) bool {
 	return getStorageEngine(stat) == "mmapv1"
 }
@@ -208,9 +226,12 @@ func ReadDelete(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
 	}, false)
 }
 
-func ReadGetMore(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
-	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
-	return fmt.Sprintf("%d", diff(newStat.Opcounters.GetMore, oldStat.Opcounters.GetMore, sampleSecs))
+func ReadGetMore(_ *ReaderConfig, newStat, oldStat *ServerStatus) (val string) {
+	if newStat.Opcounters != nil && oldStat.Opcounters != nil {
+		sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
+		val = fmt.Sprintf("%d", diff(newStat.Opcounters.GetMore, oldStat.Opcounters.GetMore, sampleSecs))
+	}
+	return
 }
 
 func ReadCommand(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
@@ -247,6 +268,86 @@ func ReadUsed(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
 	return
 }
 
+func ReadCacheBytes(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
+	if newStat.WiredTiger != nil {
+		val = formatBytes(c.HumanReadable, newStat.WiredTiger.Cache.CurrentCachedBytes)
+	}
+	return
+}
+
+func ReadCacheDirtyBytes(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
+	if newStat.WiredTiger != nil {
+		val = formatBytes(c.HumanReadable, newStat.WiredTiger.Cache.TrackedDirtyBytes)
+	}
+	return
+}
+
+// pagesEvicted returns the number of pages evicted from the WiredTiger cache.
+func pagesEvicted(stat *ServerStatus) int64 {
+	return stat.WiredTiger.Cache.UnmodifiedPagesEvict + stat.WiredTiger.Cache.ModifiedPagesEvict
+}
+
+func ReadEvicted(_ *ReaderConfig, newStat, oldStat *ServerStatus) (val string) {
+	if newStat.WiredTiger != nil && oldStat.WiredTiger != nil {
+		sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
+		val = fmt.Sprintf("%d", diff(pagesEvicted(newStat), pagesEvicted(oldStat), sampleSecs))
+	}
+	return
+}
+
+func ReadCheckpointTime(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
+	if newStat.WiredTiger != nil {
+		ms := newStat.WiredTiger.Transaction.CheckpointMostRecentMs
+		if c.HumanReadable {
+			return (time.Duration(ms) * time.Millisecond).String()
+		}
+		val = fmt.Sprintf("%d", ms)
+	}
+	return
+}
+
+func ReadCursors(_ *ReaderConfig, newStat, _ *ServerStatus) (val string) {
+	if newStat.Metrics != nil && newStat.Metrics.Cursor != nil {
+		val = fmt.Sprintf("%d|%d", newStat.Metrics.Cursor.Open.Total, newStat.Metrics.Cursor.Open.Pinned)
+	}
+	return
+}
+
+func ReadCursorTimeouts(_ *ReaderConfig, newStat, oldStat *ServerStatus) (val string) {
+	if newStat.Metrics != nil && newStat.Metrics.Cursor != nil && oldStat.Metrics != nil && oldStat.Metrics.Cursor != nil {
+		val = fmt.Sprintf("%d", newStat.Metrics.Cursor.TimedOut-oldStat.Metrics.Cursor.TimedOut)
+	}
+	return
+}
+
+func ReadTransactions(_ *ReaderConfig, newStat, oldStat *ServerStatus) (val string) {
+	if newStat.Transactions != nil && oldStat.Transactions != nil {
+		sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
+		val = fmt.Sprintf("%d|%d|%d", newStat.Transactions.CurrentActive,
+			diff(newStat.Transactions.TotalCommitted, oldStat.Transactions.TotalCommitted, sampleSecs),
+			diff(newStat.Transactions.TotalAborted, oldStat.Transactions.TotalAborted, sampleSecs))
+	}
+	return
+}
+
+func ReadFlowControlLagged(_ *ReaderConfig, newStat, _ *ServerStatus) (val string) {
+	if newStat.FlowControl != nil && newStat.FlowControl.Enabled {
+		val = "no"
+		if newStat.FlowControl.IsLagged {
+			val = "yes"
+		}
+	}
+	return
+}
+
+func ReadFlowControlWait(_ *ReaderConfig, newStat, oldStat *ServerStatus) (val string) {
+	if newStat.FlowControl != nil && oldStat.FlowControl != nil {
+		sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
+		val = fmt.Sprintf("%d", diff(newStat.FlowControl.TimeAcquiringMicros, oldStat.FlowControl.TimeAcquiringMicros, sampleSecs)/1000)
+	}
+	return
+}
+
 func ReadFlushes(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
 	var val int64
 	if newStat.WiredTiger != nil && oldStat.WiredTiger != nil {
@@ -258,28 +359,28 @@ func ReadFlushes(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
 }
 
 func ReadMapped(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
-	if util.IsTruthy(newStat.Mem.Supported) && IsMongos(newStat) {
+	if memSupported(newStat) && IsMongos(newStat) {
 		val = formatMegabyteAmount(c.HumanReadable, newStat.Mem.Mapped)
 	}
 	return
 }
 
 func ReadVSize(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
-	if util.IsTruthy(newStat.Mem.Supported) {
+	if memSupported(newStat) {
 		val = formatMegabyteAmount(c.HumanReadable, newStat.Mem.Virtual)
 	}
 	return
 }
 
 func ReadRes(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
-	if util.IsTruthy(newStat.Mem.Supported) {
+	if memSupported(newStat) {
 		val = formatMegabyteAmount(c.HumanReadable, newStat.Mem.Resident)
 	}
 	return
 }
 
 func ReadNonMapped(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
-	if util.IsTruthy(newStat.Mem.Supported) && !IsMongos(newStat) {
+	if memSupported(newStat) && !IsMongos(newStat) {
 		val = formatMegabyteAmount(c.HumanReadable, newStat.Mem.Virtual-newStat.Mem.Mapped)
 	}
 	return
@@ -381,15 +482,14 @@ func ReadLockedDB(_ *ReaderConfig, newStat, oldStat *ServerStatus) (val string)
 	return
 }
 
-func ReadQRW(_ *ReaderConfig, newStat, _ *ServerStatus) string {
-	var qr int64
-	var qw int64
-	gl := newStat.GlobalLock
+// queuedOps returns the number of queued reads and writes.
+func queuedOps(stat *ServerStatus) (qr, qw int64) {
+	gl := stat.GlobalLock
 	if gl != nil && gl.CurrentQueue != nil {
 		// If we have wiredtiger stats, use those instead
-		if newStat.WiredTiger != nil {
-			qr = gl.CurrentQueue.Readers + gl.ActiveClients.Readers - newStat.WiredTiger.Concurrent.Read.Out
-			qw = gl.CurrentQueue.Writers + gl.ActiveClients.Writers - newStat.WiredTiger.Concurrent.Write.Out
+		if stat.WiredTiger != nil {
+			qr = gl.CurrentQueue.Readers + gl.ActiveClients.Readers - stat.WiredTiger.Concurrent.Read.Out
+			qw = gl.CurrentQueue.Writers + gl.ActiveClients.Writers - stat.WiredTiger.Concurrent.Write.Out
 			if qr < 0 {
 				qr = 0
 			}
@@ -401,37 +501,55 @@ func ReadQRW(_ *ReaderConfig, newStat, _ *ServerStatus) string {
 			qw = gl.CurrentQueue.Writers
 		}
 	}
-	return fmt.Sprintf("%v|%v", qr, qw)
+	return
 }
 
-func ReadARW(_ *ReaderConfig, newStat, _ *ServerStatus) string {
-	var ar int64
-	var aw int64
-	if gl := newStat.GlobalLock; gl != nil {
-		if newStat.WiredTiger != nil {
-			ar = newStat.WiredTiger.Concurrent.Read.Out
-			aw = newStat.WiredTiger.Concurrent.Write.Out
-		} else if newStat.GlobalLock.ActiveClients != nil {
+// activeOps returns the number of active reads and writes.
+func activeOps(stat *ServerStatus) (ar, aw int64) {
+	if gl := stat.GlobalLock; gl != nil {
+		if stat.WiredTiger != nil {
+			ar = stat.WiredTiger.Concurrent.Read.Out
+			aw = stat.WiredTiger.Concurrent.Write.Out
+		} else if stat.GlobalLock.ActiveClients != nil {
 			ar = gl.ActiveClients.Readers
 			aw = gl.ActiveClients.Writers
 		}
 	}
+	return
+}
+
+func ReadQRW(_ *ReaderConfig, newStat, _ *ServerStatus) string {
+	qr, qw := queuedOps(newStat)
+	return fmt.Sprintf("%v|%v", qr, qw)
+}
+
+func ReadARW(_ *ReaderConfig, newStat, _ *ServerStatus) string {
+	ar, aw := activeOps(newStat)
 	return fmt.Sprintf("%v|%v", ar, aw)
 }
 
 func ReadNetIn(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	if newStat.Network == nil || oldStat.Network == nil {
+		return ""
+	}
 	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
 	val := diff(newStat.Network.BytesIn, oldStat.Network.BytesIn, sampleSecs)
 	return formatBits(c.HumanReadable, val)
 }
 
 func ReadNetOut(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	if newStat.Network == nil || oldStat.Network == nil {
+		return ""
+	}
 	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
 	val := diff(newStat.Network.BytesOut, oldStat.Network.BytesOut, sampleSecs)
 	return formatBits(c.HumanReadable, val)
 }
 
 func ReadConn(_ *ReaderConfig, newStat, _ *ServerStatus) string {
+	if newStat.Connections == nil {
+		return ""
+	}
 	return fmt.Sprintf("%d", newStat.Connections.Current)
 }
 
@@ -466,6 +584,44 @@ func ReadRepl(_ *ReaderConfig, newStat, _ *ServerStatus) string {
 	}
 }
 
+// IsPrimary reports whether the node is the primary of its replica set.
+func IsPrimary(stat *ServerStatus) bool {
+	return stat.Repl != nil && util.IsTruthy(stat.Repl.IsMaster) && IsReplSet(stat)
+}
+
+// replLag returns how far a secondary's latest write is behind its primary's.
+func replLag(stat *ServerStatus) (time.Duration, bool) {
+	if IsPrimary(stat) || stat.Repl == nil || stat.Repl.LastWrite == nil || stat.PrimaryLastWrite.IsZero() {
+		return 0, false
+	}
+	lag := stat.PrimaryLastWrite.Sub(stat.Repl.LastWrite.LastWriteDate)
+	if lag < 0 {
+		lag = 0
+	}
+	return lag, true
+}
+
+func formatDuration(should bool, d time.Duration) string {
+	if should {
+		return d.Round(time.Second).String()
+	}
+	return fmt.Sprintf("%d", int64(d.Seconds()))
+}
+
+func ReadReplLag(c *ReaderConfig, newStat, _ *ServerStatus) string {
+	if lag, ok := replLag(newStat); ok {
+		return formatDuration(c.HumanReadable, lag)
+	}
+	return ""
+}
+
+func ReadOplogWindow(c *ReaderConfig, newStat, _ *ServerStatus) string {
+	if newStat.OplogWindow > 0 {
+		return formatDuration(c.HumanReadable, newStat.OplogWindow)
+	}
+	return ""
+}
+
 func ReadTime(c *ReaderConfig, newStat, _ *ServerStatus) string {
 	if c.TimeFormat != "" {
 		return newStat.SampleTime.Format(c.TimeFormat)
@@ -484,29 +640,31 @@ func ReadStatField(field string, stat *ServerStatus) string {
 	return "INVALID"
 }
 
-func ReadStatDiff(field string, newStat, oldStat *ServerStatus) string {
+// statDiff returns the change in a numeric serverStatus field between two samples.
+func statDiff(field string, newStat, oldStat *ServerStatus) (int64, bool) {
 	new, validNew := newStat.Flattened[field]
 	old, validOld := oldStat.Flattened[field]
 	if validNew && validOld {
 		new, validNew := numberToInt64(new)
 		old, validOld := numberToInt64(old)
 		if validNew && validOld {
-			return fmt.Sprintf("%v", new-old)
+			return new - old, true
 		}
 	}
+	return 0, false
+}
+
+func ReadStatDiff(field string, newStat, oldStat *ServerStatus) string {
+	if d, ok := statDiff(field, newStat, oldStat); ok {
+		return fmt.Sprintf("%v", d)
+	}
 	return "INVALID"
 }
 
 func ReadStatRate(field string, newStat, oldStat *ServerStatus) string {
 	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
-	new, validNew := newStat.Flattened[field]
-	old, validOld := oldStat.Flattened[field]
-	if validNew && validOld {
-		new, validNew := numberToInt64(new)
-		old, validOld := numberToInt64(old)
-		if validNew && validOld {
-			return fmt.Sprintf("%v", diff(new, old, sampleSecs))
-		}
+	if d, ok := statDiff(field, newStat, oldStat); ok {
+		return fmt.Sprintf("%v", diff(d, 0, sampleSecs))
 	}
 	return "INVALID"
 }
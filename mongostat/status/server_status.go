@@ -6,7 +6,11 @@
 
 package status
 
-import "time"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type ServerStatus struct {
 	SampleTime         time.Time              `bson:""`
@@ -35,6 +39,52 @@ type ServerStatus struct {
 	ShardCursorType    map[string]interface{} `bson:"shardCursorType"`
 	StorageEngine      *StorageEngine         `bson:"storageEngine"`
 	WiredTiger         *WiredTiger            `bson:"wiredTiger"`
+	Metrics            *MetricsStats          `bson:"metrics"`
+	FlowControl        *FlowControlStats      `bson:"flowControl"`
+	Transactions       *TxnStats              `bson:"transactions"`
+
+	// OplogWindow is the time between the first and last entries of the
+	// oplog of a primary, measured by mongostat rather than serverStatus.
+	OplogWindow time.Duration `bson:"-"`
+
+	// PrimaryLastWrite is the time of the latest write on the primary of the
+	// node's replica set, from that primary's most recent serverStatus.
+	PrimaryLastWrite time.Time `bson:"-"`
+
+	// Top holds the output of the top command by namespace, which mongostat
+	// only runs for --top.
+	Top map[string]NSTop `bson:"-"`
+}
+
+// FlowControlStats stores the state of flow control, which throttles writes
+// on a primary when its majority commit point lags behind.
+type FlowControlStats struct {
+	Enabled             bool  `bson:"enabled"`
+	IsLagged            bool  `bson:"isLagged"`
+	TargetRateLimit     int64 `bson:"targetRateLimit"`
+	TimeAcquiringMicros int64 `bson:"timeAcquiringMicros"`
+}
+
+// TxnStats stores the counts of multi-document transactions.
+type TxnStats struct {
+	CurrentActive  int64 `bson:"currentActive"`
+	CurrentOpen    int64 `bson:"currentOpen"`
+	TotalCommitted int64 `bson:"totalCommitted"`
+	TotalAborted   int64 `bson:"totalAborted"`
+}
+
+// MetricsStats stores the parts of serverStatus.metrics that mongostat reports.
+type MetricsStats struct {
+	Cursor *CursorStats `bson:"cursor"`
+}
+
+// CursorStats stores the number of cursors open on the server.
+type CursorStats struct {
+	TimedOut int64 `bson:"timedOut"`
+	Open     struct {
+		Total  int64 `bson:"total"`
+		Pinned int64 `bson:"pinned"`
+	} `bson:"open"`
 }
 
 // WiredTiger stores information related to the WiredTiger storage engine.
@@ -59,14 +109,17 @@ type StorageEngine struct {
 
 // CacheStats stores cache statistics for WiredTiger.
 type CacheStats struct {
-	TrackedDirtyBytes  int64 `bson:"tracked dirty bytes in the cache"`
-	CurrentCachedBytes int64 `bson:"bytes currently in the cache"`
-	MaxBytesConfigured int64 `bson:"maximum bytes configured"`
+	TrackedDirtyBytes    int64 `bson:"tracked dirty bytes in the cache"`
+	CurrentCachedBytes   int64 `bson:"bytes currently in the cache"`
+	MaxBytesConfigured   int64 `bson:"maximum bytes configured"`
+	UnmodifiedPagesEvict int64 `bson:"unmodified pages evicted"`
+	ModifiedPagesEvict   int64 `bson:"modified pages evicted"`
 }
 
 // TransactionStats stores transaction checkpoints in WiredTiger.
 type TransactionStats struct {
-	TransCheckpoints int64 `bson:"transaction checkpoints"`
+	TransCheckpoints       int64 `bson:"transaction checkpoints"`
+	CheckpointMostRecentMs int64 `bson:"transaction checkpoint most recent time (msecs)"`
 }
 
 // ReplStatus stores data related to replica sets.
@@ -79,6 +132,15 @@ type ReplStatus struct {
 	Hosts        []string    `bson:"hosts"`
 	Passives     []string    `bson:"passives"`
 	Me           string      `bson:"me"`
+	LastWrite    *LastWrite  `bson:"lastWrite"`
+}
+
+// LastWrite stores the optime and date of the latest write a replica set member has applied.
+type LastWrite struct {
+	OpTime struct {
+		Ts primitive.Timestamp `bson:"ts"`
+	} `bson:"opTime"`
+	LastWriteDate time.Time `bson:"lastWriteDate"`
 }
 
 // DBRecordStats stores data related to memory operations across databases.
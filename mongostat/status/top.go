@@ -0,0 +1,73 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"sort"
+)
+
+// NSTop holds the lock times and operation counts of a namespace since the
+// server started, from the top command.
+type NSTop struct {
+	Total TopField `bson:"total"`
+	Read  TopField `bson:"readLock"`
+	Write TopField `bson:"writeLock"`
+}
+
+// TopField is the time in microseconds and the number of operations of one
+// kind of lock in the output of the top command.
+type TopField struct {
+	Time  int64 `bson:"time"`
+	Count int64 `bson:"count"`
+}
+
+// CollectionActivity is the activity of a namespace between two samples.
+type CollectionActivity struct {
+	Namespace string `json:"ns"`
+	TotalMs   int64  `json:"total_ms"`
+	ReadMs    int64  `json:"read_ms"`
+	WriteMs   int64  `json:"write_ms"`
+	Ops       int64  `json:"ops"`
+}
+
+// BusiestCollections returns the n namespaces that spent the most time
+// locked between two samples, busiest first. Idle namespaces are left out.
+func BusiestCollections(newStat, oldStat *ServerStatus, n int) []CollectionActivity {
+	if newStat.Top == nil || oldStat.Top == nil || n <= 0 {
+		return nil
+	}
+	var activity []CollectionActivity
+	for ns, newTop := range newStat.Top {
+		oldTop, ok := oldStat.Top[ns]
+		if !ok {
+			continue
+		}
+		diff := CollectionActivity{
+			Namespace: ns,
+			TotalMs:   (newTop.Total.Time - oldTop.Total.Time) / 1000,
+			ReadMs:    (newTop.Read.Time - oldTop.Read.Time) / 1000,
+			WriteMs:   (newTop.Write.Time - oldTop.Write.Time) / 1000,
+			Ops:       newTop.Total.Count - oldTop.Total.Count,
+		}
+		if diff.TotalMs > 0 || diff.Ops > 0 {
+			activity = append(activity, diff)
+		}
+	}
+	sort.Slice(activity, func(i, j int) bool {
+		if activity[i].TotalMs != activity[j].TotalMs {
+			return activity[i].TotalMs > activity[j].TotalMs
+		}
+		if activity[i].Ops != activity[j].Ops {
+			return activity[i].Ops > activity[j].Ops
+		}
+		return activity[i].Namespace < activity[j].Namespace
+	})
+	if len(activity) > n {
+		activity = activity[:n]
+	}
+	return activity
+}
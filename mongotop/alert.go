@@ -0,0 +1,145 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/alert"
+)
+
+// alertSyntax is the syntax of --alert: the total, read or write time of a
+// namespace and a duration such as 500ms, or a number of milliseconds.
+var alertSyntax = alert.Syntax{
+	Fields:   "total|read|write",
+	Expected: "total, read or write, one of >, >=, <, <=, and a time",
+	Threshold: func(text string) (float64, error) {
+		if ms, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return float64(ms), nil
+		}
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return 0, errors.New("expected a duration such as 500ms")
+		}
+		return float64(duration.Milliseconds()), nil
+	},
+}
+
+// parseAlertRules parses a comma-separated list of alert rules on the lock
+// times of a namespace, with thresholds in ms.
+func parseAlertRules(spec string) ([]alert.Rule, error) {
+	return alert.ParseRules(spec, alertSyntax)
+}
+
+// nsTimes is the time in ms a namespace spent in each kind of lock.
+type nsTimes struct {
+	total, read, write int64
+}
+
+// lockTime returns the time in ms spent in the lock an alert rule checks.
+func (times nsTimes) lockTime(field string) float64 {
+	switch field {
+	case "read":
+		return float64(times.read)
+	case "write":
+		return float64(times.write)
+	}
+	return float64(times.total)
+}
+
+// alerter checks the --alert rules against the namespaces of every diff, and
+// fires an alert when a namespace breaches a rule for enough consecutive polls.
+type alerter struct {
+	rules   []alert.Rule
+	command string
+	streaks *alert.Streaks
+}
+
+func newAlerter(rules []alert.Rule, intervals int, command string) *alerter {
+	return &alerter{rules: rules, command: command, streaks: alert.NewStreaks(intervals)}
+}
+
+// check returns the rules each namespace breaches in this poll, and the
+// "<rule> on <namespace>" alerts that fired.
+func (a *alerter) check(times map[string]nsTimes) (breached map[string][]string, fired []string) {
+	breached = map[string][]string{}
+	for ns, nsTime := range times {
+		for _, rule := range a.rules {
+			isBreached := rule.Breached(nsTime.lockTime(rule.Field))
+			if isBreached {
+				breached[ns] = append(breached[ns], rule.String())
+			}
+			if a.streaks.Update(ns, rule, isBreached) {
+				fired = append(fired, rule.String()+" on "+ns)
+			}
+		}
+	}
+	a.streaks.EndPoll()
+	sort.Strings(fired)
+	return breached, fired
+}
+
+// runCommand runs the --alertCmd with the alert in the MONGOTOP_ALERT
+// environment variable.
+func (a *alerter) runCommand(fired string) error {
+	return alert.RunCommand(a.command, "MONGOTOP_ALERT="+fired)
+}
+
+// diffTimes returns the lock times of the namespaces of a diff. Namespaces
+// of a ShardedTopDiff are named "<shard>/<namespace>".
+func diffTimes(diff FormattableDiff) map[string]nsTimes {
+	times := map[string]nsTimes{}
+	switch d := diff.(type) {
+	case TopDiff:
+		for ns, info := range d.Totals {
+			times[ns] = nsTimes{int64(info.Total.Time), int64(info.Read.Time), int64(info.Write.Time)}
+		}
+	case ShardedTopDiff:
+		for shard, totals := range d.Shards {
+			for ns, info := range totals {
+				times[shard+"/"+ns] = nsTimes{int64(info.Total.Time), int64(info.Read.Time), int64(info.Write.Time)}
+			}
+		}
+	case ServerStatusDiff:
+		for ns, delta := range d.Totals {
+			times[ns] = nsTimes{delta.Read + delta.Write, delta.Read, delta.Write}
+		}
+	}
+	return times
+}
+
+// withAlerts returns the diff with the rules its namespaces breach, so they
+// are highlighted in the output.
+func withAlerts(diff FormattableDiff, breached map[string][]string) FormattableDiff {
+	if len(breached) == 0 {
+		return diff
+	}
+	switch d := diff.(type) {
+	case TopDiff:
+		d.Alerts = breached
+		return d
+	case ShardedTopDiff:
+		d.Alerts = breached
+		return d
+	case ServerStatusDiff:
+		d.Alerts = breached
+		return d
+	}
+	return diff
+}
+
+// alertMarker is the text that highlights a namespace in the grid.
+func alertMarker(rules []string) string {
+	if len(rules) == 0 {
+		return ""
+	}
+	return "ALERT " + strings.Join(rules, ",")
+}
@@ -0,0 +1,69 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAlerts(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Alert rules compare a lock time with a duration", t, func() {
+		rules, err := parseAlertRules("write>500ms, total>=2s,read<10")
+		So(err, ShouldBeNil)
+		So(rules, ShouldHaveLength, 3)
+		So(rules[0].Threshold, ShouldEqual, 500)
+		So(rules[1].Threshold, ShouldEqual, 2000)
+		So(rules[2].Threshold, ShouldEqual, 10)
+
+		for _, spec := range []string{"write", "writes>1s", "write>soon", ""} {
+			_, err := parseAlertRules(spec)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("An alert fires once a namespace breaches a rule for enough polls", t, func() {
+		rules, err := parseAlertRules("write>500ms")
+		So(err, ShouldBeNil)
+		a := newAlerter(rules, 2, "")
+		poll := func(writeMs int) (map[string][]string, []string) {
+			diff := TopDiff{Totals: map[string]NSTopInfo{
+				"app.orders": {Total: TopField{Time: writeMs}, Write: TopField{Time: writeMs}},
+				"app.users":  {Total: TopField{Time: 10}, Read: TopField{Time: 10}},
+			}}
+			return a.check(diffTimes(diff))
+		}
+
+		breached, fired := poll(600)
+		So(breached, ShouldResemble, map[string][]string{"app.orders": {"write>500ms"}})
+		So(fired, ShouldBeEmpty)
+		_, fired = poll(700)
+		So(fired, ShouldResemble, []string{"write>500ms on app.orders"})
+		_, fired = poll(800)
+		So(fired, ShouldBeEmpty)
+
+		_, fired = poll(100)
+		So(fired, ShouldBeEmpty)
+		poll(600)
+		_, fired = poll(600)
+		So(fired, ShouldHaveLength, 1)
+	})
+
+	Convey("Namespaces that breach a rule are highlighted", t, func() {
+		diff := TopDiff{Totals: map[string]NSTopInfo{"app.orders": {Write: TopField{Time: 900}}}}
+		highlighted := withAlerts(diff, map[string][]string{"app.orders": {"write>500ms"}})
+		So(highlighted.Grid(), ShouldContainSubstring, "ALERT write>500ms")
+		var decoded TopDiff
+		So(json.Unmarshal([]byte(highlighted.JSON()), &decoded), ShouldBeNil)
+		So(decoded.Alerts, ShouldResemble, map[string][]string{"app.orders": {"write>500ms"}})
+	})
+}
@@ -10,7 +10,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"sort"
 	"time"
 
 	"github.com/huimingz/mongo-tools/common/text"
@@ -50,6 +49,15 @@ type ServerStatusDiff struct {
 	// namespace -> lock times
 	Totals map[string]LockDelta `json:"totals"`
 	Time   time.Time            `json:"time"`
+
+	// whether the totals are since the server started rather than since the previous poll
+	Cumulative bool `json:"cumulative,omitempty"`
+
+	// the --alert rules each namespace breaches
+	Alerts map[string][]string `json:"alerts,omitempty"`
+
+	// number of the busiest databases to report, from --limit
+	limit int
 }
 
 // LockDelta represents the differences in read/write lock times between two samples.
@@ -63,6 +71,15 @@ type TopDiff struct {
 	// namespace -> totals
 	Totals map[string]NSTopInfo `json:"totals"`
 	Time   time.Time            `json:"time"`
+
+	// whether the totals are since the server started rather than since the previous poll
+	Cumulative bool `json:"cumulative,omitempty"`
+
+	// the --alert rules each namespace breaches
+	Alerts map[string][]string `json:"alerts,omitempty"`
+
+	// number of the busiest namespaces to report, from --limit
+	limit int
 }
 
 // Top holds raw output of the "top" command.
@@ -134,6 +151,18 @@ func (top Top) Diff(previous Top) TopDiff {
 	return diff
 }
 
+// Cumulative produces a TopDiff of the totals of each metric since the
+// server started.
+func (top Top) Cumulative() TopDiff {
+	start := Top{Totals: make(map[string]NSTopInfo, len(top.Totals))}
+	for ns := range top.Totals {
+		start.Totals[ns] = NSTopInfo{}
+	}
+	diff := top.Diff(start)
+	diff.Cumulative = true
+	return diff
+}
+
 // Grid returns a tabular representation of the TopDiff.
 func (td TopDiff) Grid() string {
 	buf := &bytes.Buffer{}
@@ -141,31 +170,41 @@ func (td TopDiff) Grid() string {
 	out.WriteCells("ns", "total", "read", "write", time.Now().Format("2006-01-02T15:04:05Z07:00"))
 	out.EndRow()
 
-	//Sort by total time
-	totals := make(sortableTotals, 0, len(td.Totals))
-	for ns, diff := range td.Totals {
-		totals = append(totals, sortableTotal{ns, int64(diff.Total.Time)})
+	limit := td.limit
+	if limit == 0 {
+		limit = defaultGridLimit
 	}
-
-	sort.Sort(sort.Reverse(totals))
-	for i, st := range totals {
-		diff := td.Totals[st.Name]
-		out.WriteCells(st.Name,
+	for _, ns := range busiest(td.sortableTotals(), limit) {
+		diff := td.Totals[ns]
+		out.WriteCells(ns,
 			fmt.Sprintf("%vms", diff.Total.Time),
 			fmt.Sprintf("%vms", diff.Read.Time),
 			fmt.Sprintf("%vms", diff.Write.Time),
-			"")
+			alertMarker(td.Alerts[ns]))
 		out.EndRow()
-		if i >= 9 {
-			break
-		}
 	}
 	out.Flush(buf)
 	return buf.String()
 }
 
+// sortableTotals returns the namespaces of the TopDiff by total time.
+func (td TopDiff) sortableTotals() sortableTotals {
+	totals := make(sortableTotals, 0, len(td.Totals))
+	for ns, diff := range td.Totals {
+		totals = append(totals, sortableTotal{ns, int64(diff.Total.Time)})
+	}
+	return totals
+}
+
 // JSON returns a JSON representation of the TopDiff.
 func (td TopDiff) JSON() string {
+	if td.limit > 0 {
+		limited := make(map[string]NSTopInfo, td.limit)
+		for _, ns := range busiest(td.sortableTotals(), td.limit) {
+			limited[ns] = td.Totals[ns]
+		}
+		td.Totals = limited
+	}
 	bytes, err := json.Marshal(td)
 	if err != nil {
 		panic(err)
@@ -173,8 +212,24 @@ func (td TopDiff) JSON() string {
 	return string(bytes)
 }
 
+// sortableTotals returns the databases of the ServerStatusDiff by total lock time.
+func (ssd ServerStatusDiff) sortableTotals() sortableTotals {
+	totals := make(sortableTotals, 0, len(ssd.Totals))
+	for ns, diff := range ssd.Totals {
+		totals = append(totals, sortableTotal{ns, diff.Read + diff.Write})
+	}
+	return totals
+}
+
 // JSON returns a JSON representation of the ServerStatusDiff.
 func (ssd ServerStatusDiff) JSON() string {
+	if ssd.limit > 0 {
+		limited := make(map[string]LockDelta, ssd.limit)
+		for _, ns := range busiest(ssd.sortableTotals(), ssd.limit) {
+			limited[ns] = ssd.Totals[ns]
+		}
+		ssd.Totals = limited
+	}
 	bytes, err := json.Marshal(ssd)
 	if err != nil {
 		panic(err)
@@ -189,30 +244,36 @@ func (ssd ServerStatusDiff) Grid() string {
 	out.WriteCells("db", "total", "read", "write", time.Now().Format("2006-01-02T15:04:05Z07:00"))
 	out.EndRow()
 
-	//Sort by total time
-	totals := make(sortableTotals, 0, len(ssd.Totals))
-	for ns, diff := range ssd.Totals {
-		totals = append(totals, sortableTotal{ns, diff.Read + diff.Write})
+	limit := ssd.limit
+	if limit == 0 {
+		limit = defaultGridLimit
 	}
-
-	sort.Sort(sort.Reverse(totals))
-	for i, st := range totals {
-		diff := ssd.Totals[st.Name]
-		out.WriteCells(st.Name,
+	for _, ns := range busiest(ssd.sortableTotals(), limit) {
+		diff := ssd.Totals[ns]
+		out.WriteCells(ns,
 			fmt.Sprintf("%vms", diff.Read+diff.Write),
 			fmt.Sprintf("%vms", diff.Read),
 			fmt.Sprintf("%vms", diff.Write),
-			"")
+			alertMarker(ssd.Alerts[ns]))
 		out.EndRow()
-		if i >= 9 {
-			break
-		}
 	}
 
 	out.Flush(buf)
 	return buf.String()
 }
 
+// Cumulative produces a ServerStatusDiff of the lock times of each database
+// since the server started.
+func (ss ServerStatus) Cumulative() ServerStatusDiff {
+	start := ServerStatus{Locks: make(map[string]LockStats, len(ss.Locks))}
+	for ns := range ss.Locks {
+		start.Locks[ns] = LockStats{}
+	}
+	diff := ss.Diff(start)
+	diff.Cumulative = true
+	return diff
+}
+
 // Diff takes an older ServerStatus sample, and produces a ServerStatusDiff
 // representing the deltas of each metric between the two samples.
 func (ss ServerStatus) Diff(previous ServerStatus) ServerStatusDiff {
@@ -0,0 +1,123 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTopDiffs(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	sample := func(readMicros, writeMicros int) Top {
+		return Top{Totals: map[string]NSTopInfo{
+			"app.users": {
+				Total: TopField{Time: readMicros + writeMicros, Count: 3},
+				Read:  TopField{Time: readMicros, Count: 2},
+				Write: TopField{Time: writeMicros, Count: 1},
+			},
+		}}
+	}
+
+	Convey("Deltas are the differences between two polls", t, func() {
+		diff := sample(9000, 4000).Diff(sample(5000, 1000))
+		So(diff.Cumulative, ShouldBeFalse)
+		So(diff.Totals["app.users"].Total.Time, ShouldEqual, 7)
+		So(diff.Totals["app.users"].Read.Count, ShouldEqual, 0)
+	})
+
+	Convey("Cumulative totals are since the server started", t, func() {
+		diff := sample(9000, 4000).Cumulative()
+		So(diff.Totals["app.users"].Total.Time, ShouldEqual, 13)
+		So(diff.Totals["app.users"].Read.Time, ShouldEqual, 9)
+		So(diff.Totals["app.users"].Write.Count, ShouldEqual, 1)
+
+		var decoded map[string]interface{}
+		So(json.Unmarshal([]byte(diff.JSON()), &decoded), ShouldBeNil)
+		So(decoded["cumulative"], ShouldEqual, true)
+	})
+
+	Convey("Cumulative lock times are since the server started", t, func() {
+		status := ServerStatus{Locks: map[string]LockStats{
+			"app": {TimeLockedMicros: ReadWriteLockTimes{Read: 2000, ReadLower: 1000, Write: 5000}},
+		}}
+		diff := status.Cumulative()
+		So(diff.Cumulative, ShouldBeTrue)
+		So(diff.Totals["app"], ShouldResemble, LockDelta{Read: 3, Write: 5})
+	})
+}
+
+func TestNamespaceFiltering(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("--nsFilter patterns match namespaces with wildcards", t, func() {
+		patterns, err := parseNSFilter("mydb.*, *.orders")
+		So(err, ShouldBeNil)
+		So(patterns, ShouldResemble, []string{"mydb.*", "*.orders"})
+		So(nsMatches(patterns, "mydb.users"), ShouldBeTrue)
+		So(nsMatches(patterns, "shop.orders"), ShouldBeTrue)
+		So(nsMatches(patterns, "shop.users"), ShouldBeFalse)
+		So(nsMatches(nil, "shop.users"), ShouldBeTrue)
+
+		_, err = parseNSFilter("mydb.[")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("--limit keeps the busiest namespaces", t, func() {
+		diff := TopDiff{Totals: map[string]NSTopInfo{}}
+		for i, ns := range []string{"a.quiet", "a.busy", "a.busier", "a.busiest"} {
+			diff.Totals[ns] = NSTopInfo{Total: TopField{Time: i}}
+		}
+		So(busiest(diff.sortableTotals(), 2), ShouldResemble, []string{"a.busiest", "a.busier"})
+		So(busiest(diff.sortableTotals(), 0), ShouldHaveLength, 4)
+
+		diff.limit = 2
+		var decoded TopDiff
+		So(json.Unmarshal([]byte(diff.JSON()), &decoded), ShouldBeNil)
+		So(decoded.Totals, ShouldHaveLength, 2)
+		So(decoded.Totals, ShouldContainKey, "a.busiest")
+
+		grid := diff.Grid()
+		So(grid, ShouldContainSubstring, "a.busier")
+		So(grid, ShouldNotContainSubstring, "a.busy ")
+	})
+}
+
+func TestShardedTop(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	shardTop := func(micros int) Top {
+		return Top{Totals: map[string]NSTopInfo{
+			"app.users": {Total: TopField{Time: micros, Count: 1}, Write: TopField{Time: micros, Count: 1}},
+		}}
+	}
+
+	Convey("Totals of a namespace are added up across shards", t, func() {
+		merged := mergeTops(map[string]Top{"rs0": shardTop(2000), "rs1": shardTop(3000)})
+		So(merged.Totals["app.users"].Total, ShouldResemble, TopField{Time: 5000, Count: 2})
+		So(merged.Totals["app.users"].Write.Count, ShouldEqual, 2)
+	})
+
+	Convey("--byShard reports each shard's namespaces in a shard column", t, func() {
+		diff := ShardedTopDiff{Shards: map[string]map[string]NSTopInfo{
+			"rs0": shardTop(2000).Cumulative().Totals,
+			"rs1": shardTop(30000).Cumulative().Totals,
+		}}
+		So(diff.busiest(0), ShouldResemble, [][2]string{{"rs1", "app.users"}, {"rs0", "app.users"}})
+		So(diff.Grid(), ShouldContainSubstring, "shard")
+
+		diff.limit = 1
+		var decoded ShardedTopDiff
+		So(json.Unmarshal([]byte(diff.JSON()), &decoded), ShouldBeNil)
+		So(decoded.Shards, ShouldHaveLength, 1)
+		So(decoded.Shards["rs1"]["app.users"].Total.Time, ShouldEqual, 30)
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// promExporter serves the lock times mongotop has seen for each namespace
+// in the Prometheus text format, for --prom. The times are counters that
+// start when mongotop does, or at the server's totals with --cumulative.
+type promExporter struct {
+	sync.Mutex
+	totals  map[string]nsTimes
+	byShard bool
+}
+
+// startPromExporter serves /metrics on the address in the background.
+// byShard is whether the namespaces are prefixed with their shard.
+func startPromExporter(addr string, byShard bool) (*promExporter, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on --prom address %v: %v", addr, err)
+	}
+	exporter := &promExporter{totals: map[string]nsTimes{}, byShard: byShard}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	go http.Serve(listener, mux)
+	return exporter, nil
+}
+
+// update adds the times of a poll to the counters, or replaces them with
+// the server's totals when the times are cumulative.
+func (p *promExporter) update(times map[string]nsTimes, cumulative bool) {
+	p.Lock()
+	defer p.Unlock()
+	for ns, nsTime := range times {
+		if !cumulative {
+			previous := p.totals[ns]
+			nsTime = nsTimes{previous.total + nsTime.total, previous.read + nsTime.read, previous.write + nsTime.write}
+		}
+		p.totals[ns] = nsTime
+	}
+}
+
+func (p *promExporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	p.Lock()
+	defer p.Unlock()
+	names := make([]string, 0, len(p.totals))
+	for ns := range p.totals {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("# HELP mongotop_lock_time_seconds_total Time spent holding locks on a namespace, as reported by the top command.\n")
+	buf.WriteString("# TYPE mongotop_lock_time_seconds_total counter\n")
+	for _, ns := range names {
+		nsTime := p.totals[ns]
+		for _, lock := range []struct {
+			name string
+			ms   int64
+		}{{"total", nsTime.total}, {"read", nsTime.read}, {"write", nsTime.write}} {
+			labels := fmt.Sprintf("ns=%q,lock=%q", ns, lock.name)
+			if shard, shardNS := splitShardNS(ns, p.byShard); shard != "" {
+				labels = fmt.Sprintf("shard=%q,ns=%q,lock=%q", shard, shardNS, lock.name)
+			}
+			fmt.Fprintf(buf, "mongotop_lock_time_seconds_total{%v} %v\n", labels, float64(lock.ms)/1000)
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(buf.Bytes())
+}
+
+// splitShardNS splits the "<shard>/<namespace>" names of --byShard. Without
+// it, names are plain namespaces, whose collection may contain a '/'.
+func splitShardNS(name string, byShard bool) (shard, ns string) {
+	if i := strings.IndexByte(name, '/'); byShard && i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// statsdMaxPacket keeps the datagrams sent to StatsD under a typical MTU.
+const statsdMaxPacket = 1400
+
+var statsdUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// statsdEmitter sends the lock times of each poll to StatsD, for --statsd.
+type statsdEmitter struct {
+	conn    net.Conn
+	byShard bool
+}
+
+func newStatsdEmitter(addr string, byShard bool) (*statsdEmitter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to --statsd address %v: %v", addr, err)
+	}
+	return &statsdEmitter{conn: conn, byShard: byShard}, nil
+}
+
+// statsdName turns a namespace into a StatsD metric path of
+// "mongotop.[<shard>.]<db>.<collection>", with unsafe characters replaced.
+func statsdName(name string, byShard bool) string {
+	shard, ns := splitShardNS(name, byShard)
+	parts := strings.SplitN(ns, ".", 2)
+	if shard != "" {
+		parts = append([]string{shard}, parts...)
+	}
+	for i, part := range parts {
+		parts[i] = statsdUnsafe.ReplaceAllString(part, "_")
+	}
+	return "mongotop." + strings.Join(parts, ".")
+}
+
+// emit sends the milliseconds spent in each lock as counters, or as gauges
+// when the times are cumulative totals.
+func (s *statsdEmitter) emit(times map[string]nsTimes, cumulative bool) error {
+	kind := "c"
+	if cumulative {
+		kind = "g"
+	}
+	names := make([]string, 0, len(times))
+	for ns := range times {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+
+	packet := &bytes.Buffer{}
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := s.conn.Write(bytes.TrimSuffix(packet.Bytes(), []byte("\n")))
+		packet.Reset()
+		return err
+	}
+	for _, ns := range names {
+		nsTime := times[ns]
+		name := statsdName(ns, s.byShard)
+		lines := fmt.Sprintf("%v.total_ms:%v|%v\n%v.read_ms:%v|%v\n%v.write_ms:%v|%v\n",
+			name, nsTime.total, kind, name, nsTime.read, kind, name, nsTime.write, kind)
+		if packet.Len()+len(lines) > statsdMaxPacket {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		packet.WriteString(lines)
+	}
+	return flush()
+}
@@ -0,0 +1,67 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExporters(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Prometheus counters add up the lock times of each poll", t, func() {
+		exporter := &promExporter{totals: map[string]nsTimes{}, byShard: true}
+		exporter.update(map[string]nsTimes{"app.users": {total: 1500, read: 1000, write: 500}}, false)
+		exporter.update(map[string]nsTimes{"app.users": {total: 500, read: 500}, "rs1/app.orders": {total: 20, write: 20}}, false)
+
+		recorder := httptest.NewRecorder()
+		exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		body := recorder.Body.String()
+		So(body, ShouldContainSubstring, "# TYPE mongotop_lock_time_seconds_total counter")
+		So(body, ShouldContainSubstring, `mongotop_lock_time_seconds_total{ns="app.users",lock="total"} 2`+"\n")
+		So(body, ShouldContainSubstring, `mongotop_lock_time_seconds_total{ns="app.users",lock="read"} 1.5`+"\n")
+		So(body, ShouldContainSubstring, `mongotop_lock_time_seconds_total{shard="rs1",ns="app.orders",lock="write"} 0.02`+"\n")
+
+		exporter.update(map[string]nsTimes{"app.users": {total: 100}}, true)
+		recorder = httptest.NewRecorder()
+		exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		So(recorder.Body.String(), ShouldContainSubstring, `mongotop_lock_time_seconds_total{ns="app.users",lock="total"} 0.1`+"\n")
+
+		Convey("a '/' in a collection name is kept without --byShard", func() {
+			exporter := &promExporter{totals: map[string]nsTimes{}}
+			exporter.update(map[string]nsTimes{"app.a/b": {total: 1000}}, false)
+			recorder := httptest.NewRecorder()
+			exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+			So(recorder.Body.String(), ShouldContainSubstring, `mongotop_lock_time_seconds_total{ns="app.a/b",lock="total"} 1`+"\n")
+		})
+	})
+
+	Convey("StatsD metrics are named after the namespace", t, func() {
+		So(statsdName("app.system.views", false), ShouldEqual, "mongotop.app.system_views")
+		So(statsdName("rs0/my-db.a:b", true), ShouldEqual, "mongotop.rs0.my-db.a_b")
+		So(statsdName("app.a/b", false), ShouldEqual, "mongotop.app.a_b")
+
+		listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer listener.Close()
+		emitter, err := newStatsdEmitter(listener.LocalAddr().String(), false)
+		So(err, ShouldBeNil)
+		So(emitter.emit(map[string]nsTimes{"app.users": {total: 12, read: 10, write: 2}}, false), ShouldBeNil)
+
+		packet := make([]byte, statsdMaxPacket)
+		So(listener.SetReadDeadline(time.Now().Add(5*time.Second)), ShouldBeNil)
+		n, _, err := listener.ReadFrom(packet)
+		So(err, ShouldBeNil)
+		So(string(packet[:n]), ShouldEqual, "mongotop.app.users.total_ms:12|c\nmongotop.app.users.read_ms:10|c\nmongotop.app.users.write_ms:2|c")
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// defaultGridLimit is the number of namespaces the table shows without --limit.
+const defaultGridLimit = 10
+
+// parseNSFilter splits an --nsFilter into its patterns, such as "mydb.*" or
+// "*.orders", and checks that they are valid.
+func parseNSFilter(spec string) ([]string, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var patterns []string
+	for _, pattern := range strings.Split(spec, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid --nsFilter pattern '%v': %v", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// nsMatches reports whether a namespace matches any of the patterns. Every
+// namespace matches when there are none.
+func nsMatches(patterns []string, ns string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, ns); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// busiest returns the names of the totals from the busiest down, keeping the
+// first limit of them if limit is positive.
+func busiest(totals sortableTotals, limit int) []string {
+	sort.Sort(sort.Reverse(totals))
+	if limit > 0 && len(totals) > limit {
+		totals = totals[:limit]
+	}
+	names := make([]string, len(totals))
+	for i, total := range totals {
+		names[i] = total.Name
+	}
+	return names
+}
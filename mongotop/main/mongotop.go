@@ -80,8 +80,12 @@ func main() {
 		log.Logvf(log.Always, "Failed: %v", err)
 		os.Exit(util.ExitFailure)
 	}
-	if isMongos {
-		log.Logvf(log.Always, "cannot run mongotop against a mongos")
+	if isMongos && opts.Locks {
+		log.Logvf(log.Always, "cannot use --locks against a mongos")
+		os.Exit(util.ExitFailure)
+	}
+	if !isMongos && opts.ByShard {
+		log.Logvf(log.Always, "--byShard requires a connection to a mongos")
 		os.Exit(util.ExitFailure)
 	}
 
@@ -91,6 +95,7 @@ func main() {
 		OutputOptions:   opts.Output,
 		SessionProvider: sessionProvider,
 		Sleeptime:       time.Duration(opts.SleepTime) * time.Second,
+		Sharded:         isMongos,
 	}
 
 	// kick it off
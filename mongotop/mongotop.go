@@ -34,43 +34,81 @@ type MongoTop struct {
 	// Length of time to sleep between each polling.
 	Sleeptime time.Duration
 
+	// Whether SessionProvider is connected to a mongos, so that top is
+	// run on each shard instead.
+	Sharded bool
+
 	previousServerStatus *ServerStatus
 	previousTop          *Top
+
+	shards            []shardSource
+	previousShardTops map[string]Top
+
+	alerter *alerter
+	prom    *promExporter
+	statsd  *statsdEmitter
 }
 
 func (mt *MongoTop) runDiff() (outDiff FormattableDiff, err error) {
 	if mt.OutputOptions.Locks {
 		return mt.runServerStatusDiff()
 	}
+	if mt.Sharded {
+		return mt.runShardedTopDiff()
+	}
 	return mt.runTopDiff()
 }
 
-func (mt *MongoTop) runTopDiff() (outDiff FormattableDiff, err error) {
+// readTop runs the top command and returns the totals of the namespaces
+// that match the --nsFilter.
+func (mt *MongoTop) readTop(sessionProvider *db.SessionProvider) (Top, error) {
 	commandName := "top"
 	dest := &bsonx.Doc{}
-	err = mt.SessionProvider.RunString(commandName, dest, "admin")
+	err := sessionProvider.RunString(commandName, dest, "admin")
 	if err != nil {
-		mt.previousTop = nil
-		return nil, err
+		return Top{}, err
 	}
 	// Remove 'note' field that prevents easy decoding, then round-trip
 	// again to simplify unpacking into the nested data structure
 	totals, err := dest.LookupErr("totals")
 	if err != nil {
-		return nil, err
+		return Top{}, err
 	}
 	recoded, err := totals.Document().Delete("note").MarshalBSON()
 	if err != nil {
-		return nil, err
+		return Top{}, err
 	}
 	topinfo := make(map[string]NSTopInfo)
 	err = bson.Unmarshal(recoded, &topinfo)
 	if err != nil {
+		return Top{}, err
+	}
+	patterns, err := parseNSFilter(mt.OutputOptions.NSFilter)
+	if err != nil {
+		return Top{}, err
+	}
+	for ns := range topinfo {
+		if !nsMatches(patterns, ns) {
+			delete(topinfo, ns)
+		}
+	}
+	return Top{Totals: topinfo}, nil
+}
+
+func (mt *MongoTop) runTopDiff() (outDiff FormattableDiff, err error) {
+	currentTop, err := mt.readTop(mt.SessionProvider)
+	if err != nil {
+		mt.previousTop = nil
 		return nil, err
 	}
-	currentTop := Top{Totals: topinfo}
+	if mt.OutputOptions.Cumulative {
+		topDiff := currentTop.Cumulative()
+		topDiff.limit = mt.OutputOptions.Limit
+		return topDiff, nil
+	}
 	if mt.previousTop != nil {
 		topDiff := currentTop.Diff(*mt.previousTop)
+		topDiff.limit = mt.OutputOptions.Limit
 		outDiff = topDiff
 	}
 	mt.previousTop = &currentTop
@@ -94,8 +132,23 @@ func (mt *MongoTop) runServerStatusDiff() (outDiff FormattableDiff, err error) {
 			return nil, fmt.Errorf("server does not support reporting lock information")
 		}
 	}
+	patterns, err := parseNSFilter(mt.OutputOptions.NSFilter)
+	if err != nil {
+		return nil, err
+	}
+	for dbName := range currentServerStatus.Locks {
+		if !nsMatches(patterns, dbName) {
+			delete(currentServerStatus.Locks, dbName)
+		}
+	}
+	if mt.OutputOptions.Cumulative {
+		serverStatusDiff := currentServerStatus.Cumulative()
+		serverStatusDiff.limit = mt.OutputOptions.Limit
+		return serverStatusDiff, nil
+	}
 	if mt.previousServerStatus != nil {
 		serverStatusDiff := currentServerStatus.Diff(*mt.previousServerStatus)
+		serverStatusDiff.limit = mt.OutputOptions.Limit
 		outDiff = serverStatusDiff
 	}
 	mt.previousServerStatus = &currentServerStatus
@@ -107,6 +160,28 @@ func (mt *MongoTop) Run() error {
 	hasData := false
 	numPrinted := 0
 
+	if mt.OutputOptions.Alert != "" {
+		rules, err := parseAlertRules(mt.OutputOptions.Alert)
+		if err != nil {
+			return err
+		}
+		mt.alerter = newAlerter(rules, mt.OutputOptions.AlertIntervals, mt.OutputOptions.AlertCmd)
+	}
+	if mt.OutputOptions.Prom != "" {
+		prom, err := startPromExporter(mt.OutputOptions.Prom, mt.OutputOptions.ByShard)
+		if err != nil {
+			return err
+		}
+		mt.prom = prom
+	}
+	if mt.OutputOptions.StatsD != "" {
+		statsd, err := newStatsdEmitter(mt.OutputOptions.StatsD, mt.OutputOptions.ByShard)
+		if err != nil {
+			return err
+		}
+		mt.statsd = statsd
+	}
+
 	for {
 		if mt.OutputOptions.RowCount > 0 && numPrinted > mt.OutputOptions.RowCount {
 			return nil
@@ -132,6 +207,22 @@ func (mt *MongoTop) Run() error {
 
 		hasData = true
 
+		if diff != nil && mt.prom != nil {
+			mt.prom.update(diffTimes(diff), mt.OutputOptions.Cumulative)
+		}
+		if diff != nil && mt.statsd != nil {
+			if err := mt.statsd.emit(diffTimes(diff), mt.OutputOptions.Cumulative); err != nil {
+				log.Logvf(log.Always, "error sending to --statsd: %v", err)
+			}
+		}
+
+		var fired []string
+		if diff != nil && mt.alerter != nil {
+			var breached map[string][]string
+			breached, fired = mt.alerter.check(diffTimes(diff))
+			diff = withAlerts(diff, breached)
+		}
+
 		if diff != nil {
 			if mt.OutputOptions.Json {
 				fmt.Println(diff.JSON())
@@ -139,6 +230,16 @@ func (mt *MongoTop) Run() error {
 				fmt.Println(diff.Grid())
 			}
 		}
+
+		for _, alert := range fired {
+			if mt.alerter.command == "" {
+				return fmt.Errorf("alert: %v", alert)
+			}
+			log.Logvf(log.Always, "alert: %v", alert)
+			if err := mt.alerter.runCommand(alert); err != nil {
+				log.Logvf(log.Always, "error running --alertCmd: %v", err)
+			}
+		}
 		time.Sleep(mt.Sleeptime)
 	}
 }
@@ -29,9 +29,18 @@ type Options struct {
 
 // Output defines the set of options to use in displaying data from the server.
 type Output struct {
-	Locks    bool `long:"locks" description:"report on use of per-database locks"`
-	RowCount int  `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
-	Json     bool `long:"json" description:"format output as JSON"`
+	Locks          bool   `long:"locks" description:"report on use of per-database locks"`
+	RowCount       int    `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
+	Json           bool   `long:"json" description:"format output as JSON"`
+	Cumulative     bool   `long:"cumulative" description:"report the totals since the server started instead of the differences between polls"`
+	NSFilter       string `long:"nsFilter" value-name:"<pattern>[,<pattern>]" description:"only report namespaces (or databases with --locks) matching one of the patterns, e.g. 'mydb.*'"`
+	ByShard        bool   `long:"byShard" description:"when connected to a mongos, report the namespaces of each shard separately instead of merging them"`
+	Alert          string `long:"alert" value-name:"<field><op><time>[,...]" description:"alert when a namespace's total, read or write time crosses a threshold, e.g. 'write>500ms'; mongotop exits with a non-zero status unless --alertCmd is given"`
+	AlertCmd       string `long:"alertCmd" value-name:"<command>" description:"program to run when an alert fires instead of exiting; it gets the alert in the MONGOTOP_ALERT environment variable"`
+	AlertIntervals int    `long:"alertIntervals" value-name:"<count>" default:"3" description:"number of consecutive polls a threshold must be crossed before its alert fires"`
+	Prom           string `long:"prom" value-name:"<address>" description:"serve the lock times of each namespace for Prometheus to scrape at http://<address>/metrics, e.g. ':9091'"`
+	StatsD         string `long:"statsd" value-name:"<host>:<port>" description:"send the lock times of each namespace to a StatsD server after each poll"`
+	Limit          int    `long:"limit" value-name:"<count>" description:"number of the busiest namespaces to report (defaults to 10 in tables and all of them in JSON)"`
 }
 
 // Name returns a human-readable group name for output options.
@@ -60,6 +69,24 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 		)
 	}
 
+	if _, err = parseNSFilter(outputOpts.NSFilter); err != nil {
+		return Options{}, err
+	}
+	if outputOpts.Limit < 0 {
+		return Options{}, fmt.Errorf("invalid value for --limit: %v", outputOpts.Limit)
+	}
+
+	if outputOpts.Alert != "" {
+		if _, err = parseAlertRules(outputOpts.Alert); err != nil {
+			return Options{}, err
+		}
+		if outputOpts.AlertIntervals < 1 {
+			return Options{}, fmt.Errorf("--alertIntervals must be at least 1")
+		}
+	} else if outputOpts.AlertCmd != "" {
+		return Options{}, fmt.Errorf("--alertCmd can only be used when --alert is also specified")
+	}
+
 	sleeptime := 1 // default to 1 second sleep time
 	if len(extraArgs) > 0 {
 		sleeptime, err = strconv.Atoi(extraArgs[0])
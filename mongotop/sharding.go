@@ -0,0 +1,202 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/huimingz/mongo-tools/common/db"
+	"github.com/huimingz/mongo-tools/common/log"
+	"github.com/huimingz/mongo-tools/common/text"
+)
+
+// shardSource is a connection to one shard of the cluster mongotop was
+// pointed at.
+type shardSource struct {
+	name            string
+	sessionProvider *db.SessionProvider
+}
+
+// ShardedTopDiff contains the differences between top samples for each
+// namespace of each shard, for --byShard.
+type ShardedTopDiff struct {
+	// shard -> namespace -> totals
+	Shards map[string]map[string]NSTopInfo `json:"shards"`
+	Time   time.Time                       `json:"time"`
+
+	// whether the totals are since the servers started rather than since the previous poll
+	Cumulative bool `json:"cumulative,omitempty"`
+
+	// the --alert rules each "<shard>/<namespace>" breaches
+	Alerts map[string][]string `json:"alerts,omitempty"`
+
+	// number of the busiest namespaces to report, from --limit
+	limit int
+}
+
+// connectShards connects to every shard of the cluster. Shards are connected
+// to once, so shards added later need a restart of mongotop.
+func (mt *MongoTop) connectShards() error {
+	shards, err := mt.SessionProvider.GetShards()
+	if err != nil {
+		return err
+	}
+	if len(shards) == 0 {
+		return fmt.Errorf("the cluster has no shards")
+	}
+	for _, shard := range shards {
+		log.Logvf(log.DebugLow, "connecting to shard %v (%v)", shard.ID, shard.Host)
+		provider, err := db.NewSessionProvider(db.ShardToolOptions(*mt.Options, shard))
+		if err != nil {
+			return fmt.Errorf("error connecting to shard %v: %v", shard.ID, err)
+		}
+		mt.shards = append(mt.shards, shardSource{name: shard.ID, sessionProvider: provider})
+	}
+	return nil
+}
+
+// mergeTops adds up the totals of each namespace across shards.
+func mergeTops(tops map[string]Top) Top {
+	merged := Top{Totals: map[string]NSTopInfo{}}
+	for _, top := range tops {
+		for ns, info := range top.Totals {
+			sum := merged.Totals[ns]
+			sum.Total = TopField{Time: sum.Total.Time + info.Total.Time, Count: sum.Total.Count + info.Total.Count}
+			sum.Read = TopField{Time: sum.Read.Time + info.Read.Time, Count: sum.Read.Count + info.Read.Count}
+			sum.Write = TopField{Time: sum.Write.Time + info.Write.Time, Count: sum.Write.Count + info.Write.Count}
+			merged.Totals[ns] = sum
+		}
+	}
+	return merged
+}
+
+// runShardedTopDiff runs top on every shard, and reports either the merged
+// totals of each namespace or, with --byShard, the totals of each shard.
+func (mt *MongoTop) runShardedTopDiff() (outDiff FormattableDiff, err error) {
+	if mt.shards == nil {
+		if err = mt.connectShards(); err != nil {
+			return nil, err
+		}
+	}
+
+	currentTops := make(map[string]Top, len(mt.shards))
+	for _, shard := range mt.shards {
+		top, err := mt.readTop(shard.sessionProvider)
+		if err != nil {
+			mt.previousShardTops = nil
+			return nil, fmt.Errorf("error running top on shard %v: %v", shard.name, err)
+		}
+		currentTops[shard.name] = top
+	}
+	previousTops := mt.previousShardTops
+	mt.previousShardTops = currentTops
+
+	if !mt.OutputOptions.ByShard {
+		merged := mergeTops(currentTops)
+		var topDiff TopDiff
+		switch {
+		case mt.OutputOptions.Cumulative:
+			topDiff = merged.Cumulative()
+		case previousTops != nil:
+			topDiff = merged.Diff(mergeTops(previousTops))
+		default:
+			return nil, nil
+		}
+		topDiff.limit = mt.OutputOptions.Limit
+		return topDiff, nil
+	}
+
+	if previousTops == nil && !mt.OutputOptions.Cumulative {
+		return nil, nil
+	}
+	shardedDiff := ShardedTopDiff{
+		Shards:     map[string]map[string]NSTopInfo{},
+		Time:       time.Now(),
+		Cumulative: mt.OutputOptions.Cumulative,
+		limit:      mt.OutputOptions.Limit,
+	}
+	for name, top := range currentTops {
+		if mt.OutputOptions.Cumulative {
+			shardedDiff.Shards[name] = top.Cumulative().Totals
+		} else {
+			shardedDiff.Shards[name] = top.Diff(previousTops[name]).Totals
+		}
+	}
+	return shardedDiff, nil
+}
+
+// sortableTotals returns the namespaces of every shard by total time, named
+// "<shard>\x00<namespace>".
+func (std ShardedTopDiff) sortableTotals() sortableTotals {
+	var totals sortableTotals
+	for shard, shardTotals := range std.Shards {
+		for ns, diff := range shardTotals {
+			totals = append(totals, sortableTotal{shard + "\x00" + ns, int64(diff.Total.Time)})
+		}
+	}
+	return totals
+}
+
+// busiest returns the shard and namespace of the busiest namespaces.
+func (std ShardedTopDiff) busiest(limit int) [][2]string {
+	var busiestNS [][2]string
+	for _, name := range busiest(std.sortableTotals(), limit) {
+		shard, ns := name, ""
+		if i := strings.IndexByte(name, 0); i >= 0 {
+			shard, ns = name[:i], name[i+1:]
+		}
+		busiestNS = append(busiestNS, [2]string{shard, ns})
+	}
+	return busiestNS
+}
+
+// Grid returns a tabular representation of the ShardedTopDiff.
+func (std ShardedTopDiff) Grid() string {
+	buf := &bytes.Buffer{}
+	out := &text.GridWriter{ColumnPadding: 4}
+	out.WriteCells("ns", "shard", "total", "read", "write", time.Now().Format("2006-01-02T15:04:05Z07:00"))
+	out.EndRow()
+
+	limit := std.limit
+	if limit == 0 {
+		limit = defaultGridLimit
+	}
+	for _, shardNS := range std.busiest(limit) {
+		diff := std.Shards[shardNS[0]][shardNS[1]]
+		out.WriteCells(shardNS[1], shardNS[0],
+			fmt.Sprintf("%vms", diff.Total.Time),
+			fmt.Sprintf("%vms", diff.Read.Time),
+			fmt.Sprintf("%vms", diff.Write.Time),
+			alertMarker(std.Alerts[shardNS[0]+"/"+shardNS[1]]))
+		out.EndRow()
+	}
+	out.Flush(buf)
+	return buf.String()
+}
+
+// JSON returns a JSON representation of the ShardedTopDiff.
+func (std ShardedTopDiff) JSON() string {
+	if std.limit > 0 {
+		limited := map[string]map[string]NSTopInfo{}
+		for _, shardNS := range std.busiest(std.limit) {
+			if limited[shardNS[0]] == nil {
+				limited[shardNS[0]] = map[string]NSTopInfo{}
+			}
+			limited[shardNS[0]][shardNS[1]] = std.Shards[shardNS[0]][shardNS[1]]
+		}
+		std.Shards = limited
+	}
+	bytes, err := json.Marshal(std)
+	if err != nil {
+		panic(err)
+	}
+	return string(bytes)
+}